@@ -0,0 +1,36 @@
+package main
+
+import "time"
+
+// Activity is what the scale is doing right now, for a live indicator of the frontend
+type Activity string
+
+const (
+	ActivityIdle      Activity = "idle"
+	ActivityPouring   Activity = "pouring"
+	ActivityKegChange Activity = "keg_change_in_progress" // detected keg change waits for confirmation or its deadline
+	ActivityOffline   Activity = "offline"                // the scale did not report within OkLimit
+)
+
+// activity returns the current activity, a missing scale beats anything it reported before
+// caller has to hold the lock
+func (s *Scale) activity(now time.Time) Activity {
+	switch {
+	case now.Sub(s.LastOk) >= OkLimit:
+		return ActivityOffline
+	case s.PendingKeg != nil:
+		return ActivityKegChange
+	case s.pours.Progress().Active:
+		return ActivityPouring
+	default:
+		return ActivityIdle
+	}
+}
+
+// Activity returns the current activity of the scale
+func (s *Scale) Activity() Activity {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.activity(time.Now())
+}
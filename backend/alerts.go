@@ -0,0 +1,112 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// AlertmanagerWebhook is the payload of Prometheus Alertmanager webhook notifications
+// https://prometheus.io/docs/alerting/latest/configuration/#webhook_config
+type AlertmanagerWebhook struct {
+	Version  string              `json:"version"`
+	Receiver string              `json:"receiver"`
+	Status   string              `json:"status"`
+	Alerts   []AlertmanagerAlert `json:"alerts"`
+}
+
+// AlertmanagerAlert is a single alert of the webhook notification
+type AlertmanagerAlert struct {
+	Status      string            `json:"status"` // firing or resolved
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+	Fingerprint string            `json:"fingerprint"`
+}
+
+// ExternalAlert is an alert raised outside the scale (e.g. fridge temperature from another exporter)
+type ExternalAlert struct {
+	Fingerprint string    `json:"fingerprint"`
+	Name        string    `json:"name"`
+	Severity    string    `json:"severity"`
+	Summary     string    `json:"summary"`
+	Firing      bool      `json:"firing"`
+	StartsAt    time.Time `json:"starts_at"`
+}
+
+// NewExternalAlert converts the Alertmanager alert
+// summary falls back to the description and the alert name
+func NewExternalAlert(alert AlertmanagerAlert) ExternalAlert {
+	summary := alert.Annotations["summary"]
+	if summary == "" {
+		summary = alert.Annotations["description"]
+	}
+	if summary == "" {
+		summary = alert.Labels["alertname"]
+	}
+
+	return ExternalAlert{
+		Fingerprint: alert.Fingerprint,
+		Name:        alert.Labels["alertname"],
+		Severity:    alert.Labels["severity"],
+		Summary:     summary,
+		Firing:      alert.Status == "firing",
+		StartsAt:    alert.StartsAt,
+	}
+}
+
+// AlertBoard keeps external alerts which are firing
+type AlertBoard struct {
+	mux    sync.Mutex
+	alerts map[string]ExternalAlert // fingerprint => alert
+}
+
+func NewAlertBoard() *AlertBoard {
+	return &AlertBoard{
+		mux:    sync.Mutex{},
+		alerts: map[string]ExternalAlert{},
+	}
+}
+
+// Apply updates the board with the notification
+// it returns alerts which changed their state (new firing or resolved ones)
+// Alertmanager repeats notifications, the repeated ones are not returned again
+func (ab *AlertBoard) Apply(webhook AlertmanagerWebhook) []ExternalAlert {
+	ab.mux.Lock()
+	defer ab.mux.Unlock()
+
+	var changed []ExternalAlert
+	for _, a := range webhook.Alerts {
+		alert := NewExternalAlert(a)
+		_, found := ab.alerts[alert.Fingerprint]
+
+		if alert.Firing {
+			ab.alerts[alert.Fingerprint] = alert
+			if !found {
+				changed = append(changed, alert)
+			}
+		} else if found {
+			delete(ab.alerts, alert.Fingerprint)
+			changed = append(changed, alert)
+		}
+	}
+
+	return changed
+}
+
+// Active returns firing alerts ordered by their start
+func (ab *AlertBoard) Active() []ExternalAlert {
+	ab.mux.Lock()
+	defer ab.mux.Unlock()
+
+	active := make([]ExternalAlert, 0, len(ab.alerts))
+	for _, alert := range ab.alerts {
+		active = append(active, alert)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].StartsAt.Before(active[j].StartsAt)
+	})
+
+	return active
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlertBoard_Apply(t *testing.T) {
+	board := NewAlertBoard()
+	fridge := AlertmanagerAlert{
+		Status:      "firing",
+		Labels:      map[string]string{"alertname": "FridgeTooWarm", "severity": "warning"},
+		Annotations: map[string]string{"summary": "Fridge is at 9 °C"},
+		StartsAt:    time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC),
+		Fingerprint: "a",
+	}
+
+	changed := board.Apply(AlertmanagerWebhook{Alerts: []AlertmanagerAlert{fridge}})
+	assert.Len(t, changed, 1)
+	assert.Equal(t, "Fridge is at 9 °C", changed[0].Summary)
+	assert.Equal(t, "warning", changed[0].Severity)
+	assert.Len(t, board.Active(), 1)
+
+	changed = board.Apply(AlertmanagerWebhook{Alerts: []AlertmanagerAlert{fridge}})
+	assert.Empty(t, changed, "repeated notification")
+
+	fridge.Status = "resolved"
+	changed = board.Apply(AlertmanagerWebhook{Alerts: []AlertmanagerAlert{fridge}})
+	assert.Len(t, changed, 1)
+	assert.False(t, changed[0].Firing)
+	assert.Empty(t, board.Active())
+
+	changed = board.Apply(AlertmanagerWebhook{Alerts: []AlertmanagerAlert{fridge}})
+	assert.Empty(t, changed, "unknown resolved alert")
+}
+
+func TestNewExternalAlert_SummaryFallback(t *testing.T) {
+	alert := NewExternalAlert(AlertmanagerAlert{Labels: map[string]string{"alertname": "CO2Low"}})
+	assert.Equal(t, "CO2Low", alert.Summary)
+}
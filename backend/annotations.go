@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxAnnotationsRange limits the period of annotations, Grafana asks for the range of the dashboard
+const maxAnnotationsRange = 366 * 24 * time.Hour
+
+// kinds of annotations, they can be picked by the query of the Grafana annotation
+const (
+	AnnotationChangeover = "changeover"
+	AnnotationKeg        = "keg"
+	AnnotationLowKeg     = "low_keg"
+	AnnotationPub        = "pub"
+)
+
+var annotationKinds = []string{AnnotationChangeover, AnnotationKeg, AnnotationLowKeg, AnnotationPub}
+
+// GrafanaAnnotationQuery is the request of the Grafana JSON data source for annotations
+type GrafanaAnnotationQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Annotation struct {
+		Name  string `json:"name"`
+		Query string `json:"query"` // kinds separated by comma, empty for all
+	} `json:"annotation"`
+}
+
+// parseAnnotationKinds parses comma separated kinds of annotations, empty value selects all of them
+func parseAnnotationKinds(raw string) (map[string]bool, error) {
+	kinds := map[string]bool{}
+	for _, kind := range strings.Split(raw, ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" {
+			continue
+		}
+		if !slices.Contains(annotationKinds, kind) {
+			return nil, fmt.Errorf("unknown kind %q", kind)
+		}
+		kinds[kind] = true
+	}
+
+	if len(kinds) == 0 {
+		for _, kind := range annotationKinds {
+			kinds[kind] = true
+		}
+	}
+
+	return kinds, nil
+}
+
+// inRange returns true if the time is in [from, to)
+func inRange(t, from, to time.Time) bool {
+	return !t.IsZero() && !t.Before(from) && t.Before(to)
+}
+
+// KegAnnotations returns annotations of kegs tapped in [from, to)
+func KegAnnotations(kegs []KegInfo, from, to time.Time) []GrafanaAnnotation {
+	annotations := []GrafanaAnnotation{}
+	for _, keg := range kegs {
+		if !inRange(keg.TappedAt, from, to) {
+			continue
+		}
+
+		text := fmt.Sprintf("%d l keg", keg.Size)
+		if keg.Beer != "" {
+			text = fmt.Sprintf("%d l keg of %s", keg.Size, keg.Beer)
+		}
+		annotations = append(annotations, GrafanaAnnotation{
+			Time:  keg.TappedAt.UnixMilli(),
+			Title: "Keg tapped",
+			Text:  text,
+			Tags:  []string{AnnotationKeg, fmt.Sprintf("%dl", keg.Size)},
+		})
+	}
+
+	return annotations
+}
+
+// LowKegAnnotations returns annotations of kegs running low in [from, to)
+func LowKegAnnotations(kegs []KegInfo, from, to time.Time) []GrafanaAnnotation {
+	annotations := []GrafanaAnnotation{}
+	for _, keg := range kegs {
+		if !inRange(keg.LowAt, from, to) {
+			continue
+		}
+
+		annotations = append(annotations, GrafanaAnnotation{
+			Time:  keg.LowAt.UnixMilli(),
+			Title: "Keg is low",
+			Text:  fmt.Sprintf("%d l keg tapped at %s", keg.Size, keg.TappedAt.Format(time.DateTime)),
+			Tags:  []string{AnnotationLowKeg},
+		})
+	}
+
+	return annotations
+}
+
+// SessionAnnotations returns regions of pub sessions opened in [from, to)
+func SessionAnnotations(sessions []PubSession, from, to time.Time) []GrafanaAnnotation {
+	annotations := []GrafanaAnnotation{}
+	for _, session := range sessions {
+		if !inRange(session.OpenedAt, from, to) {
+			continue
+		}
+
+		annotation := GrafanaAnnotation{
+			Time:  session.OpenedAt.UnixMilli(),
+			Title: "Pub open",
+			Tags:  []string{AnnotationPub},
+		}
+		if !session.ClosedAt.IsZero() {
+			annotation.TimeEnd = session.ClosedAt.UnixMilli()
+			annotation.Text = fmt.Sprintf("open for %s", session.ClosedAt.Sub(session.OpenedAt).Round(time.Minute))
+		}
+		annotations = append(annotations, annotation)
+	}
+
+	return annotations
+}
+
+// Annotations returns annotations of the selected kinds in [from, to) ordered by time
+func (s *Scale) Annotations(kinds map[string]bool, from, to time.Time) ([]GrafanaAnnotation, error) {
+	annotations := []GrafanaAnnotation{}
+
+	if kinds[AnnotationChangeover] || kinds[AnnotationKeg] || kinds[AnnotationLowKeg] {
+		kegs, err := s.store.GetKegs()
+		if err != nil {
+			return nil, fmt.Errorf("could not load kegs: %w", err)
+		}
+		if kinds[AnnotationChangeover] {
+			annotations = append(annotations, ChangeoverAnnotations(kegs, from, to, s.config)...)
+		}
+		if kinds[AnnotationKeg] {
+			annotations = append(annotations, KegAnnotations(kegs, from, to)...)
+		}
+		if kinds[AnnotationLowKeg] {
+			annotations = append(annotations, LowKegAnnotations(kegs, from, to)...)
+		}
+	}
+
+	if kinds[AnnotationPub] {
+		sessions, err := s.store.GetPubSessions(from, to)
+		if err != nil {
+			return nil, fmt.Errorf("could not load pub sessions: %w", err)
+		}
+
+		// the current session is stored when the pub closes
+		s.mux.Lock()
+		if s.Pub.IsOpen {
+			sessions = append(sessions, PubSession{OpenedAt: s.Pub.OpenedAt})
+		}
+		s.mux.Unlock()
+
+		annotations = append(annotations, SessionAnnotations(sessions, from, to)...)
+	}
+
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].Time < annotations[j].Time
+	})
+
+	return annotations, nil
+}
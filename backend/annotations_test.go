@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAnnotationKinds(t *testing.T) {
+	kinds, err := parseAnnotationKinds("")
+	assert.Nil(t, err)
+	assert.Len(t, kinds, len(annotationKinds), "all by default")
+
+	kinds, err = parseAnnotationKinds("pub, low_keg")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]bool{AnnotationPub: true, AnnotationLowKeg: true}, kinds)
+
+	_, err = parseAnnotationKinds("keg,weather")
+	assert.Error(t, err)
+}
+
+func TestKegAnnotations(t *testing.T) {
+	start := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	kegs := []KegInfo{
+		NewKegInfo(50, "Pilsner", start, 60000),
+		NewKegInfo(30, "", start.AddDate(0, 0, 3), 40000),
+	}
+	kegs[0].LowAt = start.AddDate(0, 0, 2)
+
+	annotations := KegAnnotations(kegs, start, start.AddDate(0, 0, 3))
+	assert.Len(t, annotations, 1, "the last one is out of range")
+	assert.Equal(t, "50 l keg of Pilsner", annotations[0].Text)
+	assert.Equal(t, []string{"keg", "50l"}, annotations[0].Tags)
+
+	annotations = LowKegAnnotations(kegs, start, start.AddDate(0, 0, 3))
+	assert.Len(t, annotations, 1, "the second keg is not low")
+	assert.Equal(t, start.AddDate(0, 0, 2).UnixMilli(), annotations[0].Time)
+}
+
+func TestSessionAnnotations(t *testing.T) {
+	start := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	sessions := []PubSession{
+		{OpenedAt: start, ClosedAt: start.Add(5*time.Hour + 30*time.Minute)},
+		{OpenedAt: start.AddDate(0, 0, 1)}, // still open
+	}
+
+	annotations := SessionAnnotations(sessions, start, start.AddDate(0, 0, 2))
+	assert.Len(t, annotations, 2)
+	assert.Equal(t, start.Add(5*time.Hour+30*time.Minute).UnixMilli(), annotations[0].TimeEnd)
+	assert.Equal(t, "open for 5h30m0s", annotations[0].Text)
+	assert.Zero(t, annotations[1].TimeEnd)
+}
+
+func TestScale_LowAt(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	assert.True(t, s.KegInfo.LowAt.IsZero())
+
+	assert.Nil(t, s.AddMeasurement(9000, SourceHttp))
+	assert.False(t, s.KegInfo.LowAt.IsZero())
+
+	keg, err := s.store.GetKeg(s.KegInfo.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, s.KegInfo.LowAt, keg.LowAt, "kept in the history")
+}
+
+func TestAnnotationsHandler(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+	start := time.Now().Add(-48 * time.Hour)
+	assert.Nil(t, s.store.AddPubSession(PubSession{OpenedAt: start, ClosedAt: start.Add(4 * time.Hour)}))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/stats/annotations", bytes.NewBufferString(body))
+		r.Header.Set("Authorization", s.config.Password)
+		w := httptest.NewRecorder()
+		hr.annotationsHandler()(w, r)
+		return w
+	}
+
+	query := `{"range": {"from": "` + start.Add(-time.Hour).Format(time.RFC3339) + `", "to": "` +
+		time.Now().Add(time.Hour).Format(time.RFC3339) + `"}, "annotation": {"query": "%s"}}`
+
+	w := post(fmt.Sprintf(query, "pub"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var annotations []GrafanaAnnotation
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &annotations))
+	assert.Len(t, annotations, 1)
+	assert.Equal(t, []string{"pub"}, annotations[0].Tags)
+
+	w = post(fmt.Sprintf(query, ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &annotations))
+	assert.Len(t, annotations, 2, "pub session and the tapped keg")
+
+	assert.Equal(t, http.StatusBadRequest, post(fmt.Sprintf(query, "weather")).Code)
+	assert.Equal(t, http.StatusBadRequest, post("garbage").Code)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"time"
+)
+
+// KegArchive is everything we know about a single keg
+// it's meant for record-keeping and sharing with the brewery
+type KegArchive struct {
+	Keg          KegInfo        `json:"keg"`
+	Yield        KegYield       `json:"yield"`
+	Measurements []Measurement  `json:"measurements"`
+	Pours        []PourProgress `json:"pours"`
+	Events       []Event        `json:"events"`
+	GeneratedAt  time.Time      `json:"generated_at"`
+}
+
+// BuildKegArchive reconstructs pours and events of the keg from measurements during its life
+// live events are not stored, so they are derived the same way the scale derived them
+func BuildKegArchive(keg KegInfo, yield KegYield, measurements []Measurement, config *Config, now time.Time) KegArchive {
+	archive := KegArchive{
+		Keg:          keg,
+		Yield:        yield,
+		Measurements: measurements,
+		Pours:        []PourProgress{},
+		Events:       []Event{},
+		GeneratedAt:  now,
+	}
+
+	event := func(eventType string, at time.Time, data any) {
+		archive.Events = append(archive.Events, Event{
+			Type:    eventType,
+			Version: EventVersions[eventType],
+			At:      at,
+			Data:    data,
+		})
+	}
+
+	event(KegChangeEventType, keg.TappedAt, keg)
+
+	pours := NewPourTracker(config.GlassFor(keg.Beer), config.PourMinRate, config.MaxPourDuration)
+	addPour := func(pour *PourProgress) {
+		if pour == nil {
+			return
+		}
+		at := pour.StartedAt.Add(time.Duration(pour.Duration * float64(time.Second)))
+		archive.Pours = append(archive.Pours, *pour)
+		if pour.Runaway {
+			event(RunawayTapEventType, at, *pour)
+		}
+		event(PourEventType, at, *pour)
+	}
+
+	for _, m := range measurements {
+		_, finished := pours.Add(m)
+		addPour(finished)
+	}
+	addPour(pours.Expire(now, 0))
+
+	return archive
+}
+
+// GetKegArchive returns archive of the active or a historical keg
+func (s *Scale) GetKegArchive(id string) (KegArchive, error) {
+	yield, err := s.GetKegYield(id)
+	if err != nil {
+		return KegArchive{}, err
+	}
+
+	keg := yield.Keg
+	to := keg.FinishedAt
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	measurements, err := s.store.GetMeasurements(keg.TappedAt, to)
+	if err != nil {
+		return KegArchive{}, err
+	}
+
+	return BuildKegArchive(keg, yield, measurements, s.config, time.Now()), nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildKegArchive(t *testing.T) {
+	tapped := time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return tapped.Add(time.Duration(seconds) * time.Second)
+	}
+
+	keg := NewKegInfo(15, "Pilsner", tapped, 22000)
+	measurements := []Measurement{
+		{Weight: 22000, At: at(0)},
+		{Weight: 21750, At: at(5)},
+		{Weight: 21500, At: at(10)},
+		{Weight: 21500, At: at(600)},
+		{Weight: 21250, At: at(605)}, // pour still in progress
+	}
+
+	config := &Config{GlassSize: 500, PourMinRate: 10, MaxPourDuration: time.Minute}
+	archive := BuildKegArchive(keg, KegYield{Keg: keg}, measurements, config, at(700))
+
+	assert.Len(t, archive.Measurements, 5)
+	assert.Len(t, archive.Pours, 2)
+	assert.Equal(t, 500.0, archive.Pours[0].Grams)
+	assert.Equal(t, 250.0, archive.Pours[1].Grams)
+
+	types := []string{}
+	for _, e := range archive.Events {
+		types = append(types, e.Type)
+	}
+	assert.Equal(t, []string{KegChangeEventType, PourEventType, PourEventType}, types)
+}
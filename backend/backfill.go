@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// backfillMaxPoints keeps range queries under the Prometheus limit of 11000 points per series
+const backfillMaxPoints = 10000
+
+// Backfill fills empty storage of a fresh deployment with the weight history scraped by Prometheus
+// so dashboards aren't empty after migration
+type Backfill struct {
+	config *Config
+	store  Storage
+	logger *logrus.Logger
+	client *http.Client
+}
+
+func NewBackfill(config *Config, store Storage, logger *logrus.Logger) *Backfill {
+	return &Backfill{
+		config: config,
+		store:  store,
+		logger: logger,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Enabled returns true if the Prometheus url is configured
+func (b *Backfill) Enabled() bool {
+	return b.config.BackfillPrometheusUrl != ""
+}
+
+// Run backfills measurements of [Config.BackfillPeriod] before now if the storage has none
+// it returns the number of stored measurements
+func (b *Backfill) Run(ctx context.Context, now time.Time) (int, error) {
+	count, err := b.store.CountMeasurements(time.Unix(0, 0), now)
+	if err != nil {
+		return 0, fmt.Errorf("could not count measurements: %w", err)
+	}
+	if count > 0 {
+		b.logger.Infof("Storage has %d measurements, backfill skipped", count)
+		return 0, nil
+	}
+
+	step := b.config.BackfillStep
+	chunk := step * backfillMaxPoints
+	stored := 0
+	for from := now.Add(-b.config.BackfillPeriod); from.Before(now); from = from.Add(chunk) {
+		to := from.Add(chunk)
+		if to.After(now) {
+			to = now
+		}
+
+		measurements, err := b.queryRange(ctx, from, to, step)
+		if err != nil {
+			return stored, err
+		}
+		for _, m := range measurements {
+			if err := b.store.AddMeasurement(m); err != nil {
+				return stored, fmt.Errorf("could not store measurement: %w", err)
+			}
+			stored++
+		}
+	}
+
+	b.logger.Infof("Backfilled %d measurements from Prometheus", stored)
+	return stored, nil
+}
+
+// queryRange returns samples of the query in [from, to]
+// the end is inclusive in Prometheus, the next chunk starts one step later
+func (b *Backfill) queryRange(ctx context.Context, from, to time.Time, step time.Duration) ([]Measurement, error) {
+	params := url.Values{}
+	params.Set("query", b.config.BackfillQuery)
+	params.Set("start", strconv.FormatInt(from.Unix(), 10))
+	params.Set("end", strconv.FormatInt(to.Add(-time.Second).Unix(), 10))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+
+	endpoint := b.config.BackfillPrometheusUrl + "/api/v1/query_range?" + params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not query prometheus: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []struct {
+				Metric map[string]string `json:"metric"`
+				Values [][2]any          `json:"values"` // [unix seconds, "value"]
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid prometheus response (status %d): %w", res.StatusCode, err)
+	}
+	if body.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s", body.Error)
+	}
+	if len(body.Data.Result) == 0 {
+		return nil, nil
+	}
+	if len(body.Data.Result) > 1 {
+		b.logger.Warnf("Backfill query returned %d series, using %v", len(body.Data.Result), body.Data.Result[0].Metric)
+	}
+
+	measurements := make([]Measurement, 0, len(body.Data.Result[0].Values))
+	for _, sample := range body.Data.Result[0].Values {
+		at, ok := sample[0].(float64)
+		raw, ok2 := sample[1].(string)
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid sample %v", sample)
+		}
+		weight, err := strconv.ParseFloat(raw, 64)
+		if err != nil || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			continue
+		}
+		measurements = append(measurements, Measurement{
+			Weight: weight,
+			At:     time.UnixMilli(int64(at * 1000)),
+			Source: SourceBackfill,
+		})
+	}
+
+	return measurements, nil
+}
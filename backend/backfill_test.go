@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfill(t *testing.T) {
+	queries := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/query_range", r.URL.Path)
+		assert.Equal(t, "scale_weight", r.URL.Query().Get("query"))
+		assert.Equal(t, "60", r.URL.Query().Get("step"))
+		queries++
+
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+		values := []string{}
+		for at := start; at <= end; at += 60 {
+			values = append(values, fmt.Sprintf(`[%d, "%d"]`, at, 20000))
+		}
+		values = append(values, fmt.Sprintf(`[%d, "NaN"]`, end))
+		_, _ = fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "matrix", "result": [{"metric": {}, "values": [%s]}]}}`, strings.Join(values, ","))
+	}))
+	defer srv.Close()
+
+	config := NewConfig()
+	config.BackfillPrometheusUrl = srv.URL
+	config.BackfillPeriod = 10 * 24 * time.Hour // 14400 minutes, two queries
+	store := &FakeStore{}
+	b := NewBackfill(config, store, logrus.New())
+
+	now := time.Unix(1714600000, 0)
+	stored, err := b.Run(context.Background(), now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, queries)
+	assert.Equal(t, 14400, stored)
+	count, err := store.CountMeasurements(now.Add(-config.BackfillPeriod), now)
+	assert.Nil(t, err)
+	assert.Equal(t, 14400, count, "chunks don't overlap")
+	measurements, err := store.GetMeasurements(now.Add(-time.Minute), now)
+	assert.Nil(t, err)
+	assert.Equal(t, SourceBackfill, measurements[0].Source)
+
+	// storage is not empty anymore
+	stored, err = b.Run(context.Background(), now)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stored)
+	assert.Equal(t, 2, queries)
+}
+
+func TestBackfill_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"status": "error", "errorType": "bad_data", "error": "parse error"}`))
+	}))
+	defer srv.Close()
+
+	config := NewConfig()
+	config.BackfillPrometheusUrl = srv.URL
+	_, err := NewBackfill(config, &FakeStore{}, logrus.New()).Run(context.Background(), time.Now())
+	assert.ErrorContains(t, err, "parse error")
+}
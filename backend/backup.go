@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// backupVersion is the format of the archive, newer archives are refused by restore
+// version 2 added records of additional scales
+const backupVersion = 2
+
+// kinds of records framing the archive
+const (
+	backupKindHeader = "header"
+	backupKindEnd    = "end"
+)
+
+// BackupHeader is the first record of the archive
+type BackupHeader struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Since     time.Time `json:"since"` // history in [since, until) is included
+	Until     time.Time `json:"until"`
+	Devices   []string  `json:"devices,omitempty"` // additional scales, the restored server needs them in SCALE_DEVICES
+}
+
+// backupRecord is a single line of the archive, the archive is gzipped JSON lines
+//
+//	{"kind": "header", "data": {"version": 1, ...}}
+//	{"kind": "keg", "data": {...}}
+//	{"kind": "measurement", "data": {...}}
+//	{"kind": "measurement", "device": "tap2", "data": {...}}
+//	{"kind": "end", "data": {"keg": 1, "measurement": 2}}
+type backupRecord struct {
+	Kind   string          `json:"kind"`
+	Device string          `json:"device,omitempty"` // additional scale owning the record, empty for the default scale
+	Data   json.RawMessage `json:"data"`
+}
+
+// backupSharedKinds are pub-wide records, they are stored by the default scale only, see [DeviceStorage]
+var backupSharedKinds = []string{"firmware", "person", "keg_model", "pour", "weather", "settlement"}
+
+// backupRestorers store a record of the kind into the destination
+// state is restored by setters, the calibration history is stored oldest first, so the last one becomes current
+var backupRestorers = map[string]func(dst Storage, data json.RawMessage) error{
+	"weight":         func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetWeight) },
+	"weight_at":      func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetWeightAt) },
+	"active_keg":     func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetActiveKeg) },
+	"keg_info":       func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetKegInfo) },
+	"beers_left":     func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetBeersLeft) },
+	"is_low":         func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetIsLow) },
+	"warehouse":      func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetWarehouse) },
+	"cleaning_until": func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetCleaningUntil) },
+	"shadow":         func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetShadow) },
+	"tap_beer":       func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetTapBeer) },
+	"snapshot":       func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetSnapshot) },
+	"firmware":       func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetFirmware) },
+	"calibration":    func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetCalibration) },
+	"keg":            func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SaveKeg) },
+	"rating":         func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.AddRating) },
+	"person":         func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SavePerson) },
+	"keg_model":      func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SaveKegModel) },
+	"measurement":    func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.AddMeasurement) },
+	"pour":           func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.AddPour) },
+	"weather":        func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.AddWeather) },
+	"settlement":     func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.AddSettlement) },
+	"pub_session":    func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.AddPubSession) },
+	"session_tag":    func(dst Storage, data json.RawMessage) error { return restoreRecord(data, dst.SetSessionTag) },
+}
+
+// restoreRecord decodes the record and stores it by the setter
+func restoreRecord[T any](data json.RawMessage, set func(T) error) error {
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return set(value)
+}
+
+// backupWriter writes records of the archive and counts them per kind
+type backupWriter struct {
+	encoder *json.Encoder
+	counts  map[string]int
+	device  string // scale of the records being written
+}
+
+func (bw *backupWriter) write(kind string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", kind, err)
+	}
+	if kind != backupKindHeader && kind != backupKindEnd {
+		bw.counts[kind]++
+	}
+	return bw.encoder.Encode(backupRecord{Kind: kind, Device: bw.device, Data: data})
+}
+
+// shared returns true if records of the kind are written with another scale
+func (bw *backupWriter) shared(kind string) bool {
+	return bw.device != "" && slices.Contains(backupSharedKinds, kind)
+}
+
+// writeBackupRecords writes all records returned by get
+func writeBackupRecords[T any](bw *backupWriter, kind string, records []T, err error) error {
+	if err != nil {
+		return fmt.Errorf("could not load %s: %w", kind, err)
+	}
+	for _, record := range records {
+		if err := bw.write(kind, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteBackup streams a complete dump of the default scale (src) and additional scales (devices by the id)
+// to out as a gzipped archive, pub-wide data is written once with the default scale
+// history in [since, now) is read in chunks like by [MigrateStore], so the whole history is never held in memory
+// the archive ends with counts of records, a restore of a truncated archive fails
+func WriteBackup(src Storage, devices map[string]Storage, since, now time.Time, out io.Writer) (MigrateReport, error) {
+	report := MigrateReport{Counts: map[string]int{}}
+	if err := src.Ping(); err != nil {
+		return report, fmt.Errorf("storage is not reachable: %w", err)
+	}
+
+	ids := make([]string, 0, len(devices))
+	for device := range devices {
+		ids = append(ids, device)
+	}
+	slices.Sort(ids)
+
+	zw := gzip.NewWriter(out)
+	bw := &backupWriter{encoder: json.NewEncoder(zw), counts: report.Counts}
+	if err := bw.write(backupKindHeader, BackupHeader{Version: backupVersion, CreatedAt: now, Since: since, Until: now, Devices: ids}); err != nil {
+		return report, err
+	}
+
+	if err := writeBackupScale(bw, src, since, now); err != nil {
+		return report, err
+	}
+	for _, device := range ids {
+		bw.device = device
+		if err := writeBackupScale(bw, devices[device], since, now); err != nil {
+			return report, fmt.Errorf("scale %s: %w", device, err)
+		}
+	}
+	bw.device = ""
+
+	if err := bw.write(backupKindEnd, report.Counts); err != nil {
+		return report, err
+	}
+	return report, zw.Close()
+}
+
+// writeBackupScale writes records of the scale stored in src
+func writeBackupScale(bw *backupWriter, src Storage, since, now time.Time) error {
+	// current values, the ones never stored are skipped
+	state := []struct {
+		kind string
+		get  func() (any, error)
+	}{
+		{"weight", func() (any, error) { return src.GetWeight() }},
+		{"weight_at", func() (any, error) { return src.GetWeightAt() }},
+		{"active_keg", func() (any, error) { return src.GetActiveKeg() }},
+		{"keg_info", func() (any, error) { return src.GetKegInfo() }},
+		{"beers_left", func() (any, error) { return src.GetBeersLeft() }},
+		{"is_low", func() (any, error) { return src.GetIsLow() }},
+		{"warehouse", func() (any, error) { return src.GetWarehouse() }},
+		{"cleaning_until", func() (any, error) { return src.GetCleaningUntil() }},
+		{"shadow", func() (any, error) { return src.GetShadow() }},
+		{"tap_beer", func() (any, error) { return src.GetTapBeer() }},
+		{"snapshot", func() (any, error) { return src.GetSnapshot() }},
+		{"firmware", func() (any, error) { return src.GetFirmware() }},
+	}
+	for _, value := range state {
+		if bw.shared(value.kind) {
+			continue
+		}
+		data, err := value.get()
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not load %s: %w", value.kind, err)
+		}
+		if err := bw.write(value.kind, data); err != nil {
+			return err
+		}
+	}
+
+	history, err := src.GetCalibrationHistory()
+	if err != nil {
+		return fmt.Errorf("could not load calibration history: %w", err)
+	}
+	if len(history) == 0 {
+		current, err := src.GetCalibration()
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("could not load calibration: %w", err)
+		}
+		if err == nil {
+			history = []Calibration{current}
+		}
+	}
+	slices.Reverse(history)
+	if err := writeBackupRecords(bw, "calibration", history, nil); err != nil {
+		return err
+	}
+
+	kegs, err := src.GetKegs()
+	if err := writeBackupRecords(bw, "keg", kegs, err); err != nil {
+		return err
+	}
+	for _, keg := range kegs {
+		ratings, err := src.GetRatings(keg.Id)
+		if err := writeBackupRecords(bw, "rating", ratings, err); err != nil {
+			return err
+		}
+	}
+	if !bw.shared("person") {
+		people, err := src.GetPeople()
+		if err := writeBackupRecords(bw, "person", people, err); err != nil {
+			return err
+		}
+		models, err := src.GetKegModels()
+		if err := writeBackupRecords(bw, "keg_model", models, err); err != nil {
+			return err
+		}
+	}
+
+	for from := since; from.Before(now); from = from.Add(migrateChunk) {
+		to := from.Add(migrateChunk)
+		if to.After(now) {
+			to = now
+		}
+		if err := writeBackupRange(bw, src, from, to); err != nil {
+			return fmt.Errorf("could not back up %s - %s: %w", from.Format(time.DateOnly), to.Format(time.DateOnly), err)
+		}
+	}
+
+	return nil
+}
+
+// writeBackupRange writes the history in [from, to)
+func writeBackupRange(bw *backupWriter, src Storage, from, to time.Time) error {
+	measurements, err := src.GetMeasurements(from, to)
+	if err := writeBackupRecords(bw, "measurement", measurements, err); err != nil {
+		return err
+	}
+	if !bw.shared("pour") {
+		pours, err := src.GetPours(from, to)
+		if err := writeBackupRecords(bw, "pour", pours, err); err != nil {
+			return err
+		}
+		weather, err := src.GetWeather(from, to)
+		if err := writeBackupRecords(bw, "weather", weather, err); err != nil {
+			return err
+		}
+		settlements, err := src.GetSettlements(from, to)
+		if err := writeBackupRecords(bw, "settlement", settlements, err); err != nil {
+			return err
+		}
+	}
+	sessions, err := src.GetPubSessions(from, to)
+	if err := writeBackupRecords(bw, "pub_session", sessions, err); err != nil {
+		return err
+	}
+	tags, err := src.GetSessionTags(from, to)
+	return writeBackupRecords(bw, "session_tag", tags, err)
+}
+
+// RestoreBackup loads the archive written by [WriteBackup] into dst
+// the destination has to be empty unless force is set, records are merged into it then
+func RestoreBackup(dst Storage, in io.Reader, force bool) (BackupHeader, MigrateReport, error) {
+	report := MigrateReport{Counts: map[string]int{}}
+	header := BackupHeader{}
+	if err := dst.Ping(); err != nil {
+		return header, report, fmt.Errorf("destination is not reachable: %w", err)
+	}
+
+	zr, err := gzip.NewReader(bufio.NewReader(in))
+	if err != nil {
+		return header, report, fmt.Errorf("invalid archive: %w", err)
+	}
+	defer zr.Close()
+	decoder := json.NewDecoder(zr)
+
+	var record backupRecord
+	if err := decoder.Decode(&record); err != nil || record.Kind != backupKindHeader {
+		return header, report, fmt.Errorf("invalid archive: missing header")
+	}
+	if err := json.Unmarshal(record.Data, &header); err != nil {
+		return header, report, fmt.Errorf("invalid archive: %w", err)
+	}
+	if header.Version > backupVersion {
+		return header, report, fmt.Errorf("archive version %d is not supported, upgrade the server", header.Version)
+	}
+	// records of additional scales are stored by their own stores
+	stores := map[string]Storage{"": dst}
+	if len(header.Devices) > 0 {
+		deviceStore, ok := dst.(DeviceStorage)
+		if !ok {
+			return header, report, fmt.Errorf("destination does not support more scales")
+		}
+		for _, device := range header.Devices {
+			stores[device] = deviceStore.ForDevice(device)
+		}
+	}
+	if !force {
+		for _, store := range stores {
+			if err := checkEmptyStore(store, header.Since, header.Until); err != nil {
+				return header, report, err
+			}
+		}
+	}
+
+	for {
+		record = backupRecord{}
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return header, report, fmt.Errorf("archive is truncated after %d records", countRecords(report))
+			}
+			return header, report, fmt.Errorf("invalid archive: %w", err)
+		}
+		if record.Kind == backupKindEnd {
+			break
+		}
+
+		restore, found := backupRestorers[record.Kind]
+		if !found {
+			return header, report, fmt.Errorf("unknown record %q, upgrade the server", record.Kind)
+		}
+		store, found := stores[record.Device]
+		if !found {
+			return header, report, fmt.Errorf("invalid archive: scale %q is not listed in the header", record.Device)
+		}
+		if err := restore(store, record.Data); err != nil {
+			return header, report, fmt.Errorf("could not restore %s: %w", record.Kind, err)
+		}
+		report.Counts[record.Kind]++
+	}
+
+	// the trailer holds counts of the written records
+	expected := map[string]int{}
+	if err := json.Unmarshal(record.Data, &expected); err != nil {
+		return header, report, fmt.Errorf("invalid archive: %w", err)
+	}
+	for kind, count := range expected {
+		if report.Counts[kind] != count {
+			return header, report, fmt.Errorf("verification failed, %d of %d %s records restored", report.Counts[kind], count, kind)
+		}
+	}
+	stored := 0
+	for _, store := range stores {
+		count, err := store.CountMeasurements(header.Since, header.Until)
+		if err != nil {
+			return header, report, err
+		}
+		stored += count
+	}
+	if stored < report.Counts["measurement"] {
+		return header, report, fmt.Errorf("verification failed, %d of %d measurements stored", stored, report.Counts["measurement"])
+	}
+
+	return header, report, nil
+}
+
+// countRecords returns the number of all records of the report
+func countRecords(report MigrateReport) int {
+	total := 0
+	for _, count := range report.Counts {
+		total += count
+	}
+	return total
+}
+
+// runRestoreCommand implements `keg-scale restore -to sqlite -file backup.jsonl.gz [flags]`
+// the archive is downloaded by POST /api/backup, connection details not given by flags are taken from the environment
+func runRestoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	to := fs.String("to", "", "destination storage driver (redis, sqlite, postgres)")
+	toDsn := fs.String("to-dsn", "", "destination sqlite file, postgres connection string or redis address")
+	file := fs.String("file", "", "archive written by POST /api/backup, - reads standard input")
+	force := fs.Bool("force", false, "merge into a destination which already holds data")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || *to == "memory" || *file == "" {
+		return fmt.Errorf("usage: keg-scale restore -to redis|sqlite|postgres -file backup.jsonl.gz [flags]")
+	}
+
+	in := io.Reader(os.Stdin)
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return fmt.Errorf("could not open archive: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	dst, err := openStorage(NewConfig(), *to, *toDsn)
+	if err != nil {
+		return fmt.Errorf("could not open destination: %w", err)
+	}
+
+	header, report, err := RestoreBackup(dst, in, *force)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("restored backup from %s\n", header.CreatedAt.Format(time.RFC3339))
+	if len(header.Devices) > 0 {
+		fmt.Printf("scales: %s, list them in SCALE_DEVICES\n", strings.Join(header.Devices, ","))
+	}
+	kinds := make([]string, 0, len(report.Counts))
+	for kind := range report.Counts {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("%s: %d\n", kind, report.Counts[kind])
+	}
+	return nil
+}
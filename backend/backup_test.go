@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup(t *testing.T) {
+	now := time.Date(2024, 5, 13, 12, 0, 0, 0, getTz())
+	since := now.AddDate(0, 0, -30)
+
+	src := &FakeStore{}
+	keg := NewKegInfo(50, "Pilsner", now.AddDate(0, 0, -20), 60000)
+	assert.Nil(t, src.SetKegInfo(keg))
+	assert.Nil(t, src.SaveKeg(keg))
+	assert.Nil(t, src.AddRating(Rating{KegId: keg.Id, Up: true, At: now.AddDate(0, 0, -1)}))
+	assert.Nil(t, src.SetBeersLeft(42))
+	assert.Nil(t, src.SetWarehouse([5]int{1, 2, 3, 4, 5}))
+	assert.Nil(t, src.SetCalibration(Calibration{Offset: 1, Factor: 20}))
+	assert.Nil(t, src.SetCalibration(Calibration{Offset: 2, Factor: 21}))
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, src.AddMeasurement(Measurement{Weight: 60000 - float64(i)*100, At: since.Add(time.Duration(i) * 6 * time.Hour)}))
+	}
+	assert.Nil(t, src.AddPour(Pour{KegId: keg.Id, At: now.AddDate(0, 0, -2)}))
+	assert.Nil(t, src.AddPubSession(PubSession{OpenedAt: now.AddDate(0, 0, -3), ClosedAt: now.AddDate(0, 0, -3).Add(4 * time.Hour)}))
+
+	var archive bytes.Buffer
+	report, err := WriteBackup(src, nil, since, now, &archive)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, report.Counts["measurement"])
+	assert.Equal(t, 2, report.Counts["calibration"])
+
+	dst := newSqliteStore(t, filepath.Join(t.TempDir(), "scale.db"))
+	header, restored, err := RestoreBackup(dst, bytes.NewReader(archive.Bytes()), false)
+	assert.Nil(t, err)
+	assert.Equal(t, backupVersion, header.Version)
+	assert.True(t, header.Until.Equal(now))
+	assert.Equal(t, report.Counts, restored.Counts)
+
+	count, err := dst.CountMeasurements(since, now)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, count)
+	warehouse, err := dst.GetWarehouse()
+	assert.Nil(t, err)
+	assert.Equal(t, [5]int{1, 2, 3, 4, 5}, warehouse)
+	calibration, err := dst.GetCalibration()
+	assert.Nil(t, err)
+	assert.Equal(t, 21.0, calibration.Factor, "the newest calibration is current")
+	ratings, err := dst.GetRatings(keg.Id)
+	assert.Nil(t, err)
+	assert.Len(t, ratings, 1)
+	sessions, err := dst.GetPubSessions(since, now)
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+
+	// destination holds data now
+	_, _, err = RestoreBackup(dst, bytes.NewReader(archive.Bytes()), false)
+	assert.ErrorContains(t, err, "destination is not empty")
+
+	_, _, err = RestoreBackup(&FakeStore{}, bytes.NewReader(archive.Bytes()[:archive.Len()/2]), false)
+	assert.ErrorContains(t, err, "truncated")
+}
+
+// tapsStore keeps stores of additional scales, so restored records can be checked
+type tapsStore struct {
+	FakeStore
+	devices map[string]Storage
+}
+
+func (s *tapsStore) ForDevice(device string) Storage {
+	if _, found := s.devices[device]; !found {
+		s.devices[device] = s.FakeStore.ForDevice(device)
+	}
+	return s.devices[device]
+}
+
+// corruptedStore holds a shadow which can't be read
+type corruptedStore struct {
+	FakeStore
+}
+
+func (s *corruptedStore) GetShadow() (DeviceShadow, error) {
+	return DeviceShadow{}, fmt.Errorf("invalid shadow format in the storage")
+}
+
+func TestBackup_Devices(t *testing.T) {
+	now := time.Now()
+	since := now.AddDate(0, 0, -1)
+	src := &tapsStore{devices: map[string]Storage{}}
+	tap2 := src.ForDevice("tap2")
+	assert.Nil(t, src.AddMeasurement(Measurement{Weight: 30000, At: now.Add(-time.Hour)}))
+	assert.Nil(t, tap2.AddMeasurement(Measurement{Weight: 20000, At: now.Add(-time.Hour)}))
+	assert.Nil(t, tap2.AddMeasurement(Measurement{Weight: 19500, At: now.Add(-time.Minute)}))
+	assert.Nil(t, tap2.SetKegInfo(NewKegInfo(30, "Kozel", now.AddDate(0, 0, -1), 20000)))
+	assert.Nil(t, tap2.AddPour(Pour{At: now.Add(-time.Minute)}))
+
+	var archive bytes.Buffer
+	report, err := WriteBackup(src, map[string]Storage{"tap2": tap2}, since, now, &archive)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Counts["measurement"])
+	assert.Equal(t, 1, report.Counts["pour"], "pub-wide records are written once")
+
+	dst := &tapsStore{devices: map[string]Storage{}}
+	header, restored, err := RestoreBackup(dst, bytes.NewReader(archive.Bytes()), false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tap2"}, header.Devices)
+	assert.Equal(t, report.Counts, restored.Counts)
+	measurements, err := dst.ForDevice("tap2").GetMeasurements(since, now)
+	assert.Nil(t, err)
+	assert.Len(t, measurements, 2)
+	info, err := dst.ForDevice("tap2").GetKegInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, "Kozel", info.Beer)
+	measurements, err = dst.GetMeasurements(since, now)
+	assert.Nil(t, err)
+	assert.Len(t, measurements, 1, "the default scale keeps its own history")
+
+	_, _, err = RestoreBackup(newSqliteStore(t, filepath.Join(t.TempDir(), "scale.db")), bytes.NewReader(archive.Bytes()), false)
+	assert.ErrorContains(t, err, "destination does not support more scales")
+
+	// only values which were never stored are skipped
+	_, err = WriteBackup(&corruptedStore{}, nil, since, now, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "could not load shadow: invalid shadow format")
+	_, err = WriteBackup(src, map[string]Storage{"tap2": &corruptedStore{}}, since, now, &bytes.Buffer{})
+	assert.ErrorContains(t, err, "scale tap2: could not load shadow")
+}
+
+func TestHandlerRepository_Backup(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	s.config.ScaleDevices = []string{"tap2"}
+	scales := NewScaleRegistry(s)
+	assert.Nil(t, scales.AddDevices(s.config, s.monitor, s.store, s.logger))
+	tap2, _ := scales.Get("tap2")
+	assert.Nil(t, tap2.AddMeasurement(20000, SourceHttp))
+	hr := &HandlerRepository{scale: s, scales: scales, config: s.config, monitor: s.monitor, logger: s.logger}
+	post := func(auth, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/backup"+query, nil)
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		hr.backupHandler()(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("wrong", "").Code)
+	assert.Equal(t, http.StatusBadRequest, post("test", "?since=yesterday").Code)
+
+	w := post("test", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".jsonl.gz")
+
+	dst := &FakeStore{}
+	header, report, err := RestoreBackup(dst, w.Body, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tap2"}, header.Devices, "every scale of the registry")
+	assert.Equal(t, 2, report.Counts["measurement"])
+	assert.Equal(t, 2, report.Counts["weight"])
+}
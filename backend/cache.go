@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// publicCacheControl returns the Cache-Control of public widget responses, so a CDN in front of the server
+// absorbs the traffic and keeps serving the last response while it revalidates or the server is down
+// s-maxage applies to shared caches only, browsers keep the response for max-age
+func publicCacheControl(c *Config) string {
+	if c.PublicCacheMaxAge <= 0 && c.PublicCacheSharedMaxAge <= 0 {
+		return "no-cache"
+	}
+
+	directives := []string{
+		"public",
+		fmt.Sprintf("max-age=%d", int(c.PublicCacheMaxAge/time.Second)),
+		fmt.Sprintf("s-maxage=%d", int(c.PublicCacheSharedMaxAge/time.Second)),
+	}
+	if c.PublicCacheStale > 0 {
+		stale := int(c.PublicCacheStale / time.Second)
+		directives = append(directives, fmt.Sprintf("stale-while-revalidate=%d", stale), fmt.Sprintf("stale-if-error=%d", stale))
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// writeCached writes the JSON response with the caching headers and its ETag
+// revalidation of an unchanged response gets 304 without the body
+func writeCached(w http.ResponseWriter, r *http.Request, res []byte, cacheControl string) {
+	sum := sha256.Sum256(res)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Authorization")
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(res)
+}
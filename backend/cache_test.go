@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicCacheControl(t *testing.T) {
+	config := NewConfig()
+	assert.Equal(t, "public, max-age=10, s-maxage=30, stale-while-revalidate=300, stale-if-error=300", publicCacheControl(config))
+
+	config.PublicCacheStale = 0
+	config.PublicCacheMaxAge = 0
+	assert.Equal(t, "public, max-age=0, s-maxage=30", publicCacheControl(config), "CDN only")
+
+	config.PublicCacheSharedMaxAge = 0
+	assert.Equal(t, "no-cache", publicCacheControl(config))
+}
+
+func TestHandlerRepository_PublicStatusCache(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+
+	status := func(etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/public/status", nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		hr.publicStatusHandler()(w, r)
+		return w
+	}
+
+	w := status("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "s-maxage=30")
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = status(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code, "revalidated by the CDN")
+	assert.Empty(t, w.Body.Bytes())
+
+	assert.Nil(t, s.AddMeasurement(21000, SourceHttp)) // two beers poured
+	w = status(etag)
+	assert.Equal(t, http.StatusOK, w.Code, "status changed")
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const calibrationHistoryLength = 50 // number of previous calibrations kept in the storage
+
+// CalibrationPoint is a raw reading of a known weight
+type CalibrationPoint struct {
+	Raw   float64 `json:"raw"`
+	Grams float64 `json:"grams"`
+}
+
+// Calibration converts raw HX711 counts into grams on the server
+// so recalibration never requires reflashing the firmware
+// grams = (raw - Offset) / Factor, or a piecewise-linear curve through Points
+// when at least two points are given (the cheap load cells are nonlinear at the high end)
+type Calibration struct {
+	Device    string             `json:"device,omitempty"` // load cell or device the calibration was measured on
+	Offset    float64            `json:"offset"`           // raw counts of the empty scale (tare)
+	Factor    float64            `json:"factor"`           // raw counts per gram
+	Points    []CalibrationPoint `json:"points,omitempty"` // curve sorted by raw counts, overrides offset and factor
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// Validate checks the calibration is usable
+// points are sorted by raw counts as a side effect
+func (c Calibration) Validate() error {
+	if len(c.Points) > 0 {
+		return c.validatePoints()
+	}
+
+	if c.Factor == 0 || math.IsNaN(c.Factor) || math.IsInf(c.Factor, 0) {
+		return fmt.Errorf("factor must be a non-zero number")
+	}
+	if math.IsNaN(c.Offset) || math.IsInf(c.Offset, 0) {
+		return fmt.Errorf("offset must be a number")
+	}
+
+	return nil
+}
+
+func (c Calibration) validatePoints() error {
+	if len(c.Points) < 2 {
+		return fmt.Errorf("curve needs at least two points")
+	}
+
+	for _, p := range c.Points {
+		if math.IsNaN(p.Raw) || math.IsInf(p.Raw, 0) || math.IsNaN(p.Grams) || math.IsInf(p.Grams, 0) {
+			return fmt.Errorf("points must be numbers")
+		}
+	}
+
+	sort.Slice(c.Points, func(i, j int) bool {
+		return c.Points[i].Raw < c.Points[j].Raw
+	})
+	for i := 1; i < len(c.Points); i++ {
+		if c.Points[i].Raw == c.Points[i-1].Raw {
+			return fmt.Errorf("points must have distinct raw values, %.0f is used twice", c.Points[i].Raw)
+		}
+	}
+
+	return nil
+}
+
+// Convert converts raw counts into grams
+// values outside the curve are extrapolated by its first or last segment
+func (c Calibration) Convert(raw float64) float64 {
+	if len(c.Points) < 2 {
+		return math.Round((raw-c.Offset)/c.Factor*10) / 10
+	}
+
+	// index of the first point above raw, clamped to the end segments
+	i := sort.Search(len(c.Points), func(i int) bool {
+		return c.Points[i].Raw > raw
+	})
+	i = min(max(i, 1), len(c.Points)-1)
+
+	a, b := c.Points[i-1], c.Points[i]
+	grams := a.Grams + (raw-a.Raw)*(b.Grams-a.Grams)/(b.Raw-a.Raw)
+	return math.Round(grams*10) / 10
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalibration_Convert(t *testing.T) {
+	c := Calibration{Offset: 8388608, Factor: 21.5}
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, 0.0, c.Convert(8388608))
+	assert.Equal(t, 20000.0, c.Convert(8818608))
+
+	assert.NotNil(t, Calibration{Offset: 100}.Validate(), "zero factor")
+}
+
+func TestCalibration_Curve(t *testing.T) {
+	c := Calibration{Points: []CalibrationPoint{
+		{Raw: 3000, Grams: 20000}, // unsorted on purpose
+		{Raw: 1000, Grams: 0},
+		{Raw: 2000, Grams: 10000},
+	}}
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, 1000.0, c.Points[0].Raw, "points are sorted")
+
+	assert.Equal(t, 0.0, c.Convert(1000))
+	assert.Equal(t, 5000.0, c.Convert(1500))
+	assert.Equal(t, 15000.0, c.Convert(2500))
+	assert.Equal(t, -5000.0, c.Convert(500), "extrapolated by the first segment")
+	assert.Equal(t, 25000.0, c.Convert(3500), "extrapolated by the last segment")
+
+	assert.NotNil(t, Calibration{Points: []CalibrationPoint{{Raw: 1, Grams: 1}}}.Validate(), "single point")
+	assert.NotNil(t, Calibration{Points: []CalibrationPoint{{Raw: 1, Grams: 1}, {Raw: 1, Grams: 2}}}.Validate(), "duplicate raw")
+}
+
+func TestScale_CalibrationHistory(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	assert.Nil(t, s.SetCalibration(Calibration{Offset: 0, Factor: 10}))
+	assert.Nil(t, s.SetCalibration(Calibration{Offset: 0, Factor: 20}))
+
+	history, err := s.GetCalibrationHistory()
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, 20.0, history[0].Factor, "newest first")
+}
+
+func TestScale_AddRawMeasurement(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	assert.NotNil(t, s.AddRawMeasurement(8818608, SourceHttp), "not calibrated")
+
+	assert.Nil(t, s.SetCalibration(Calibration{Offset: 8388608, Factor: 21.5}))
+	assert.Nil(t, s.AddRawMeasurement(8818608, SourceHttp))
+	assert.Equal(t, 20000.0, s.Weight)
+
+	calibration, raw, _ := s.GetCalibration()
+	assert.Equal(t, 21.5, calibration.Factor)
+	assert.Equal(t, 8818608.0, raw)
+
+	stored, err := s.store.GetCalibration()
+	assert.Nil(t, err)
+	assert.Equal(t, *calibration, stored)
+}
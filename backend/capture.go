@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CapturedRequest is a raw inbound device payload
+type CapturedRequest struct {
+	At   time.Time `json:"at"`
+	Body string    `json:"body"`
+}
+
+// Capture records raw device payloads into a JSON lines file
+// so a suspicious evening can be replayed later against a local instance
+type Capture struct {
+	mux  sync.Mutex
+	path string
+}
+
+func NewCapture(config *Config) *Capture {
+	return &Capture{
+		mux:  sync.Mutex{},
+		path: config.CapturePath,
+	}
+}
+
+// Enabled returns true if the capture path is configured
+func (c *Capture) Enabled() bool {
+	return c.path != ""
+}
+
+// Record appends the payload to the capture file
+func (c *Capture) Record(at time.Time, body string) error {
+	if !c.Enabled() {
+		return nil
+	}
+
+	line, err := json.Marshal(CapturedRequest{At: at, Body: body})
+	if err != nil {
+		return err
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	f, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open capture file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// ReadCapture parses the capture file
+func ReadCapture(r io.Reader) ([]CapturedRequest, error) {
+	requests := []CapturedRequest{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var req CapturedRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, scanner.Err()
+}
+
+// Replay sends captured requests to the push endpoint in the original order
+// speed scales the original delays between requests (2 = twice as fast), 0 sends them without delay
+func Replay(requests []CapturedRequest, url, token string, speed float64, out io.Writer) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for i, req := range requests {
+		if i > 0 && speed > 0 {
+			time.Sleep(time.Duration(float64(req.At.Sub(requests[i-1].At)) / speed))
+		}
+
+		httpReq, err := http.NewRequest(http.MethodPost, url, strings.NewReader(req.Body))
+		if err != nil {
+			return err
+		}
+		httpReq.Header.Set("Content-Type", "text/plain")
+		httpReq.Header.Set("Authorization", token)
+
+		res, err := client.Do(httpReq)
+		if err != nil {
+			return fmt.Errorf("request %d: %w", i+1, err)
+		}
+		_ = res.Body.Close()
+
+		_, _ = fmt.Fprintf(out, "%s %d %s\n", formatDate(req.At), res.StatusCode, req.Body)
+	}
+
+	return nil
+}
+
+// runReplayCommand implements `keg-scale replay [flags] <capture file>`
+func runReplayCommand(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	url := fs.String("url", "http://localhost:8080/api/scale/push", "push endpoint of the target instance")
+	token := fs.String("token", os.Getenv("AUTH_TOKEN"), "auth token of the target instance")
+	speed := fs.Float64("speed", 0, "replay speed relative to the original timing, 0 sends requests without delay")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: keg-scale replay [flags] <capture file>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	requests, err := ReadCapture(f)
+	if err != nil {
+		return fmt.Errorf("invalid capture file: %w", err)
+	}
+
+	return Replay(requests, *url, *token, *speed, os.Stdout)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapture_RecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	capture := NewCapture(&Config{CapturePath: path})
+
+	at := time.Date(2024, 6, 1, 22, 13, 0, 0, time.UTC)
+	assert.Nil(t, capture.Record(at, "Push|1|-70|12000"))
+	assert.Nil(t, capture.Record(at.Add(5*time.Second), "Push|2|-71|11500"))
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	requests, err := ReadCapture(f)
+	assert.Nil(t, err)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "Push|2|-71|11500", requests[1].Body)
+
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	assert.Nil(t, Replay(requests, server.URL, "secret", 0, &out))
+	assert.Equal(t, []string{"Push|1|-70|12000", "Push|2|-71|11500"}, received)
+}
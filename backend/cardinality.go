@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// cardinalityOverflow replaces label values of series over the limit
+const cardinalityOverflow = "overflow"
+
+// CardinalityGuard caps number of label combinations of every metric
+// new combinations over the limit are folded into a single overflow series,
+// so a bug (e.g. keg id in a label of a counter) cannot explode Prometheus
+type CardinalityGuard struct {
+	mux       sync.Mutex
+	limit     int
+	series    map[string]map[string]struct{} // metric => label values joined
+	offenders map[string]int                 // metric => number of folded observations
+	logger    *logrus.Logger
+}
+
+func NewCardinalityGuard(limit int, logger *logrus.Logger) *CardinalityGuard {
+	return &CardinalityGuard{
+		mux:       sync.Mutex{},
+		limit:     limit,
+		series:    map[string]map[string]struct{}{},
+		offenders: map[string]int{},
+		logger:    logger,
+	}
+}
+
+// Labels returns label values to be used for the metric
+// known combinations and new ones under the limit are returned unchanged
+func (g *CardinalityGuard) Labels(metric string, values ...string) []string {
+	if g == nil {
+		return values
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	key := strings.Join(values, "\x00")
+	known, found := g.series[metric]
+	if !found {
+		known = map[string]struct{}{}
+		g.series[metric] = known
+	}
+	if _, found := known[key]; found || len(known) < g.limit {
+		known[key] = struct{}{}
+		return values
+	}
+
+	if g.offenders[metric] == 0 && g.logger != nil {
+		g.logger.Errorf("Metric %s exceeded %d label combinations, new series are folded into %q (first offender: %v)", metric, g.limit, cardinalityOverflow, values)
+	}
+	g.offenders[metric]++
+
+	overflow := make([]string, len(values))
+	for i := range overflow {
+		overflow[i] = cardinalityOverflow
+	}
+	return overflow
+}
+
+// Reset forgets combinations of the metric (after the metric vector was reset)
+func (g *CardinalityGuard) Reset(metric string) {
+	if g == nil {
+		return
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	delete(g.series, metric)
+}
+
+// Offenders returns metrics which exceeded the limit and number of folded observations
+func (g *CardinalityGuard) Offenders() map[string]int {
+	offenders := map[string]int{}
+	if g == nil {
+		return offenders
+	}
+
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	for metric, count := range g.offenders {
+		offenders[metric] = count
+	}
+	return offenders
+}
+
+// SeriesInfo describes a registered metric and its series
+type SeriesInfo struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Count  int      `json:"count"`
+	Series []string `json:"series"` // label sets, e.g. {result="ok",token="web"}
+}
+
+// ListSeries returns all series currently exposed by the registry ordered by name
+func ListSeries(registry *prometheus.Registry) ([]SeriesInfo, error) {
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]SeriesInfo, 0, len(families))
+	for _, family := range families {
+		info := SeriesInfo{
+			Name:   family.GetName(),
+			Type:   strings.ToLower(family.GetType().String()),
+			Count:  len(family.GetMetric()),
+			Series: make([]string, 0, len(family.GetMetric())),
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"=\""+label.GetValue()+"\"")
+			}
+			info.Series = append(info.Series, "{"+strings.Join(labels, ",")+"}")
+		}
+		list = append(list, info)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	return list, nil
+}
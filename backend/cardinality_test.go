@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCardinalityGuard(t *testing.T) {
+	logger := logrus.New()
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+
+	g := NewCardinalityGuard(2, logger)
+	assert.Equal(t, []string{"a", "ok"}, g.Labels("requests", "a", "ok"))
+	assert.Equal(t, []string{"b", "ok"}, g.Labels("requests", "b", "ok"))
+	assert.Equal(t, []string{"overflow", "overflow"}, g.Labels("requests", "c", "ok"))
+	assert.Equal(t, []string{"a", "ok"}, g.Labels("requests", "a", "ok"), "known series is kept")
+	assert.Equal(t, []string{"c"}, g.Labels("other", "c"), "limit is per metric")
+
+	assert.Equal(t, map[string]int{"requests": 1}, g.Offenders())
+	assert.Contains(t, buf.String(), "requests exceeded 2")
+
+	g.Reset("requests")
+	assert.Equal(t, []string{"c", "ok"}, g.Labels("requests", "c", "ok"))
+}
+
+func TestListSeries(t *testing.T) {
+	m := NewMonitor()
+	m.publicRequests.WithLabelValues("web", "ok").Inc()
+
+	series, err := ListSeries(m.Registry)
+	assert.Nil(t, err)
+
+	found := false
+	for _, s := range series {
+		if s.Name == "scale_public_api_requests_total" {
+			found = true
+			assert.Equal(t, 1, s.Count)
+			assert.Equal(t, []string{`{result="ok",token="web"}`}, s.Series)
+		}
+	}
+	assert.True(t, found)
+}
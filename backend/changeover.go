@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// ChangeoverEvent is the payload of [ChangeoverEventType]
+// published when the tapped keg holds a different beer than the previous one
+type ChangeoverEvent struct {
+	KegId    string  `json:"keg_id"`
+	FromBeer string  `json:"from_beer"`
+	ToBeer   string  `json:"to_beer"`
+	Glass    float64 `json:"glass"` // grams, glass size of the new beer
+}
+
+// GrafanaAnnotation is an annotation in the format of Grafana JSON data sources
+type GrafanaAnnotation struct {
+	Time    int64    `json:"time"`              // unix milliseconds
+	TimeEnd int64    `json:"timeEnd,omitempty"` // unix milliseconds, set for regions
+	Title   string   `json:"title"`
+	Text    string   `json:"text"`
+	Tags    []string `json:"tags"`
+}
+
+// isChangeover returns true if the beer differs from the previous one
+// kegs without a beer (e.g. detected automatically) are not known to change anything
+func isChangeover(previous, beer string) bool {
+	previous = strings.ToLower(strings.TrimSpace(previous))
+	beer = strings.ToLower(strings.TrimSpace(beer))
+	return previous != "" && beer != "" && previous != beer
+}
+
+// previousKeg returns the keg tapped right before the given one
+func previousKeg(kegs []KegInfo, keg KegInfo) (KegInfo, bool) {
+	var previous KegInfo
+	found := false
+	for _, k := range kegs {
+		if k.Id == keg.Id || !k.TappedAt.Before(keg.TappedAt) {
+			continue
+		}
+		if !found || k.TappedAt.After(previous.TappedAt) {
+			previous = k
+			found = true
+		}
+	}
+
+	return previous, found
+}
+
+// Changeover returns the changeover to the keg, false if the beer did not change
+func Changeover(previous, keg KegInfo, config *Config) (ChangeoverEvent, bool) {
+	if !isChangeover(previous.Beer, keg.Beer) {
+		return ChangeoverEvent{}, false
+	}
+
+	return ChangeoverEvent{
+		KegId:    keg.Id,
+		FromBeer: previous.Beer,
+		ToBeer:   keg.Beer,
+		Glass:    config.GlassFor(keg.Beer),
+	}, true
+}
+
+// ChangeoverAnnotations returns annotations of changeovers of kegs tapped in [from, to)
+func ChangeoverAnnotations(kegs []KegInfo, from, to time.Time, config *Config) []GrafanaAnnotation {
+	annotations := []GrafanaAnnotation{}
+	for _, keg := range kegs {
+		if keg.TappedAt.Before(from) || !keg.TappedAt.Before(to) {
+			continue
+		}
+		previous, found := previousKeg(kegs, keg)
+		if !found {
+			continue
+		}
+		changeover, ok := Changeover(previous, keg, config)
+		if !ok {
+			continue
+		}
+
+		annotations = append(annotations, GrafanaAnnotation{
+			Time:  keg.TappedAt.UnixMilli(),
+			Title: "Changeover to " + changeover.ToBeer,
+			Text:  changeover.FromBeer + " → " + changeover.ToBeer,
+			Tags:  []string{"changeover", strings.ToLower(changeover.ToBeer)},
+		})
+	}
+
+	return annotations
+}
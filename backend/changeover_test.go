@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeoverAnnotations(t *testing.T) {
+	config := NewConfig()
+	start := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	kegs := []KegInfo{
+		NewKegInfo(50, "Pilsner", start, 60000),
+		NewKegInfo(30, "Pilsner", start.AddDate(0, 0, 3), 40000),
+		NewKegInfo(30, "", start.AddDate(0, 0, 5), 40000), // detected automatically, beer unknown
+		NewKegInfo(15, "Weizen", start.AddDate(0, 0, 7), 22000),
+		NewKegInfo(50, "Pilsner", start.AddDate(0, 0, 9), 60000),
+	}
+
+	annotations := ChangeoverAnnotations(kegs, start, start.AddDate(0, 0, 9), config)
+	assert.Equal(t, []GrafanaAnnotation{}, annotations, "nothing known to change, the last one is out of range")
+
+	// the keg with unknown beer is corrected
+	kegs[2].Beer = "Weizen"
+	annotations = ChangeoverAnnotations(kegs, start, start.AddDate(0, 0, 10), config)
+	assert.Len(t, annotations, 2)
+	assert.Equal(t, start.AddDate(0, 0, 5).UnixMilli(), annotations[0].Time)
+	assert.Equal(t, "Pilsner → Weizen", annotations[0].Text)
+	assert.Equal(t, []string{"changeover", "pilsner"}, annotations[1].Tags)
+}
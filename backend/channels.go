@@ -0,0 +1,81 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ChannelHealth describes deliveries of a single outgoing channel (mirror, Google Sheets, notifications)
+type ChannelHealth struct {
+	Channel     string    `json:"channel"`
+	Successes   int       `json:"successes"`
+	Failures    int       `json:"failures"`
+	LastSuccess time.Time `json:"last_success"` // zero if nothing was delivered yet
+	LastFailure time.Time `json:"last_failure"`
+	LastError   string    `json:"last_error"`
+}
+
+// DeliveryTracker records results of deliveries per channel
+// so a broken channel (expired token, changed url) is noticed before it's needed
+type DeliveryTracker struct {
+	mux      sync.Mutex
+	monitor  *Monitor
+	channels map[string]*ChannelHealth
+}
+
+func NewDeliveryTracker(monitor *Monitor) *DeliveryTracker {
+	return &DeliveryTracker{
+		mux:      sync.Mutex{},
+		monitor:  monitor,
+		channels: map[string]*ChannelHealth{},
+	}
+}
+
+// Track runs the delivery and records its result and latency
+func (dt *DeliveryTracker) Track(channel string, deliver func() error) error {
+	started := time.Now()
+	err := deliver()
+	latency := time.Since(started)
+
+	dt.mux.Lock()
+	defer dt.mux.Unlock()
+
+	health, found := dt.channels[channel]
+	if !found {
+		health = &ChannelHealth{Channel: channel}
+		dt.channels[channel] = health
+	}
+
+	m := dt.monitor
+	m.channelLatency.WithLabelValues(m.guard.Labels("scale_channel_delivery_seconds", channel)...).Observe(latency.Seconds())
+	if err != nil {
+		health.Failures++
+		health.LastFailure = started
+		health.LastError = err.Error()
+		m.channelDeliveries.WithLabelValues(m.guard.Labels("scale_channel_deliveries_total", channel, "failed")...).Inc()
+		return err
+	}
+
+	health.Successes++
+	health.LastSuccess = started
+	m.channelDeliveries.WithLabelValues(m.guard.Labels("scale_channel_deliveries_total", channel, "sent")...).Inc()
+	m.channelLastSuccess.WithLabelValues(m.guard.Labels("scale_channel_last_success", channel)...).Set(float64(started.Unix()))
+	return nil
+}
+
+// Health returns state of all channels which have been used, ordered by name
+func (dt *DeliveryTracker) Health() []ChannelHealth {
+	dt.mux.Lock()
+	defer dt.mux.Unlock()
+
+	channels := make([]ChannelHealth, 0, len(dt.channels))
+	for _, health := range dt.channels {
+		channels = append(channels, *health)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Channel < channels[j].Channel
+	})
+
+	return channels
+}
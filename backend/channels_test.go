@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryTracker(t *testing.T) {
+	tracker := NewMonitor().deliveries
+
+	assert.Nil(t, tracker.Track("telegram", func() error { return nil }))
+	err := tracker.Track("telegram", func() error { return fmt.Errorf("401 unauthorized") })
+	assert.NotNil(t, err)
+	assert.Nil(t, tracker.Track("mirror", func() error { return nil }))
+
+	health := tracker.Health()
+	assert.Len(t, health, 2)
+	assert.Equal(t, "mirror", health[0].Channel)
+	assert.Equal(t, "telegram", health[1].Channel)
+	assert.Equal(t, 1, health[1].Successes)
+	assert.Equal(t, 1, health[1].Failures)
+	assert.Equal(t, "401 unauthorized", health[1].LastError)
+	assert.False(t, health[1].LastSuccess.IsZero())
+}
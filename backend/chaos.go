@@ -0,0 +1,23 @@
+//go:build chaos
+
+package main
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// wrapChaos injects storage failures configured by CHAOS_ERROR_RATE and CHAOS_LATENCY
+// it's compiled only into test builds (go build -tags chaos), production binaries can't be broken by the environment
+func wrapChaos(store Storage, logger *logrus.Logger) Storage {
+	env := &configEnv{}
+	errorRate := env.getFloatEnvDefault("CHAOS_ERROR_RATE", 0)
+	latency := env.getDurationEnvDefault("CHAOS_LATENCY", 0)
+	if errorRate <= 0 && latency <= 0 {
+		return store
+	}
+
+	logger.Warnf("Injecting storage failures: %.0f %% of operations fail, %s latency", 100*errorRate, latency)
+	return NewChaosStore(store, errorRate, latency, time.Now().UnixNano())
+}
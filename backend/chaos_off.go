@@ -0,0 +1,10 @@
+//go:build !chaos
+
+package main
+
+import "github.com/sirupsen/logrus"
+
+// wrapChaos returns the storage unchanged, failures are injected only in builds with the chaos tag
+func wrapChaos(store Storage, _ *logrus.Logger) Storage {
+	return store
+}
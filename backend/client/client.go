@@ -0,0 +1,185 @@
+// Package client wraps the HTTP API of the scale server, so integrations and tools do not build requests by hand
+// reads are retried on network errors, 429 and 5xx responses with an exponential backoff
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client of a single server
+type Client struct {
+	baseUrl    string
+	token      string // sent in the Authorization header, empty sends none
+	httpClient *http.Client
+	retries    int           // additional attempts after the failed one
+	backoff    time.Duration // delay before the first retry, doubled for every next one
+}
+
+// Option configures the client
+type Option func(*Client)
+
+// WithToken authorizes requests by the admin password or an API token (read-only is enough for reads)
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHttpClient replaces the default HTTP client with a 10 s timeout
+func WithHttpClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets the number of retries and the delay before the first one, zero retries disables them
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = max(retries, 0)
+		c.backoff = backoff
+	}
+}
+
+// New creates the client of the server at the base url, e.g. https://pub.example.com
+func New(baseUrl string, options ...Option) *Client {
+	c := &Client{
+		baseUrl:    strings.TrimRight(baseUrl, "/"),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		retries:    3,
+		backoff:    500 * time.Millisecond,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// Error is a response of the server with an error status
+type Error struct {
+	StatusCode int
+	Message    string // body of the response
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server responded %d: %s", e.StatusCode, e.Message)
+}
+
+// retryable returns true for responses worth another attempt
+func (e *Error) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// Status returns the current state of the scale of the device, empty device is the default scale
+func (c *Client) Status(ctx context.Context, device string) (Status, error) {
+	query := url.Values{}
+	if device != "" {
+		query.Set("device", device)
+	}
+
+	var status Status
+	err := c.get(ctx, "/api/scale/status", query, &status)
+	return status, err
+}
+
+// Measurements returns measurements in [from, to), zero times use the defaults of the server (the last day)
+// positive resolution downsamples them to buckets, zero returns every measurement as its own bucket
+func (c *Client) Measurements(ctx context.Context, from, to time.Time, resolution time.Duration) (MeasurementHistory, error) {
+	query := rangeQuery(from, to)
+	if resolution > 0 {
+		query.Set("resolution", resolution.String())
+	}
+
+	var history MeasurementHistory
+	err := c.get(ctx, "/api/measurements", query, &history)
+	return history, err
+}
+
+// Kegs returns all kegs with their ratings, the newest first
+func (c *Client) Kegs(ctx context.Context) ([]Keg, error) {
+	var kegs []Keg
+	err := c.get(ctx, "/api/kegs", nil, &kegs)
+	return kegs, err
+}
+
+// Pours returns pours finished in [from, to), zero times use the defaults of the server (the last day)
+// people are attributed only for the admin token
+func (c *Client) Pours(ctx context.Context, from, to time.Time) ([]Pour, error) {
+	var pours []Pour
+	err := c.get(ctx, "/api/pours", rangeQuery(from, to), &pours)
+	return pours, err
+}
+
+// rangeQuery returns from and to parameters, zero times are left out
+func rangeQuery(from, to time.Time) url.Values {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+
+	return query
+}
+
+// get decodes the JSON response of the path, failed attempts are retried until ctx is done
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		err := c.do(ctx, path, query, out)
+		var apiErr *Error
+		if err == nil || attempt >= c.retries || (errors.As(err, &apiErr) && !apiErr.retryable()) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, the last attempt failed: %v", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// do sends a single request
+func (c *Client) do(ctx context.Context, path string, query url.Values, out any) error {
+	target := c.baseUrl + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/api/scale/status":
+			attempts++
+			if attempts < 3 {
+				http.Error(w, "Storage Unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"weight": 22000, "active_keg": 15, "keg_info": {"id": "k1", "beer": "Pilsner", "size": 15}}`)
+		case "/api/pours":
+			assert.Equal(t, "2024-05-04T18:00:00Z", r.URL.Query().Get("from"))
+			assert.Empty(t, r.URL.Query().Get("to"), "default of the server")
+			_, _ = fmt.Fprint(w, `[{"grams": 500, "glasses": 1, "keg_id": "k1"}]`)
+		default:
+			http.Error(w, "Unknown device", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/", WithToken("secret"), WithRetries(2, time.Millisecond))
+	ctx := context.Background()
+
+	status, err := c.Status(ctx, "tap2")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts, "retried twice")
+	assert.Equal(t, 22000.0, status.Weight)
+	assert.Equal(t, "Pilsner", status.KegInfo.Beer)
+
+	pours, err := c.Pours(ctx, time.Date(2024, 5, 4, 18, 0, 0, 0, time.UTC), time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, []Pour{{Grams: 500, Glasses: 1, KegId: "k1"}}, pours)
+
+	// client errors are not retried
+	_, err = c.Kegs(ctx)
+	var apiErr *Error
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, &Error{StatusCode: http.StatusNotFound, Message: "Unknown device"}, apiErr)
+
+	// retries give up
+	attempts = 0
+	_, err = New(server.URL, WithToken("secret"), WithRetries(1, time.Millisecond)).Status(ctx, "")
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.Equal(t, 2, attempts)
+}
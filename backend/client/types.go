@@ -0,0 +1,126 @@
+package client
+
+import "time"
+
+// Status is the state of the scale, see GET /api/scale/status
+type Status struct {
+	Weight        float64      `json:"weight"` // grams
+	WeightAt      time.Time    `json:"last_weight_at"`
+	ActiveKeg     int          `json:"active_keg"`         // liters, 0 if no keg is tapped
+	KegInfo       *KegInfo     `json:"keg_info,omitempty"` // nil if no keg is tapped
+	BeersLeft     int          `json:"beers_left"`
+	IsLow         bool         `json:"is_low"`
+	Warehouse     [5]int       `json:"warehouse"` // kegs in stock [10l, 15l, 20l, 30l, 50l]
+	Pub           Pub          `json:"pub"`
+	LastOk        time.Time    `json:"last_ok"`
+	Rssi          float64      `json:"rssi"`
+	Shadow        DeviceShadow `json:"shadow"`
+	CleaningUntil *time.Time   `json:"cleaning_until,omitempty"` // nil if the line is not being cleaned
+	PendingKeg    *PendingKeg  `json:"pending_keg,omitempty"`    // nil without a detected keg change
+	PubOverride   *PubOverride `json:"pub_override,omitempty"`   // nil if the pub is not forced open or closed
+	Degraded      bool         `json:"degraded"`
+	EmptyScale    bool         `json:"empty_scale"`
+	TareShift     bool         `json:"tare_shift"`
+	Activity      string       `json:"activity"` // idle, pouring, keg_change_in_progress or offline
+}
+
+// KegInfo is a tapped keg
+type KegInfo struct {
+	Id          string       `json:"id"`
+	Beer        string       `json:"beer"`
+	Size        int          `json:"size"` // liters
+	TappedAt    time.Time    `json:"tapped_at"`
+	FinishedAt  time.Time    `json:"finished_at"` // zero while the keg is on tap
+	LowAt       time.Time    `json:"low_at"`      // zero until the keg runs low
+	StartWeight float64      `json:"start_weight"`
+	EndWeight   float64      `json:"end_weight"`
+	Pours       int          `json:"pours"`
+	PouredGrams float64      `json:"poured_grams"`
+	Beers       float64      `json:"beers"`
+	LineGrams   float64      `json:"line_grams"`
+	Model       string       `json:"model,omitempty"`
+	EmptyWeight float64      `json:"empty_weight,omitempty"`
+	Untapped    *UntappedKeg `json:"untapped,omitempty"` // set while the keg is put aside to be tapped again
+	PausedHours float64      `json:"paused_hours,omitempty"`
+}
+
+// UntappedKeg is a partially full keg put aside
+type UntappedKeg struct {
+	At              time.Time `json:"at"`
+	Weight          float64   `json:"weight"`
+	RemainingLiters float64   `json:"remaining_liters"`
+}
+
+// Pub is the state of the pub
+type Pub struct {
+	IsOpen   bool      `json:"is_open"`
+	OpenedAt time.Time `json:"open_at"`
+	ClosedAt time.Time `json:"closed_at"`
+}
+
+// PubOverride is the state of the pub forced by the admin
+type PubOverride struct {
+	Open  bool      `json:"open"`
+	Until time.Time `json:"until"`
+}
+
+// PendingKeg is a detected keg change waiting for confirmation
+type PendingKeg struct {
+	Weight     float64   `json:"weight"`
+	DetectedAt time.Time `json:"detected_at"`
+	Guess      int       `json:"guess"`
+	Tapped     int       `json:"tapped"`
+	Deadline   time.Time `json:"deadline"`
+}
+
+// DeviceShadow is the desired and the reported configuration of the device
+type DeviceShadow struct {
+	Desired        map[string]string `json:"desired"`
+	Reported       map[string]string `json:"reported"`
+	DesiredAt      time.Time         `json:"desired_at"`
+	ReportedAt     time.Time         `json:"reported_at"`
+	PendingReports int               `json:"pending_reports"`
+}
+
+// MeasurementHistory is the response of GET /api/measurements
+type MeasurementHistory struct {
+	From       time.Time           `json:"from"`
+	To         time.Time           `json:"to"`
+	Resolution string              `json:"resolution"` // empty for raw measurements
+	Points     []MeasurementBucket `json:"points"`
+}
+
+// MeasurementBucket aggregates measurements of the resolution
+type MeasurementBucket struct {
+	Id    string    `json:"id,omitempty"` // id of the raw measurement, empty for buckets
+	At    time.Time `json:"at"`           // start of the bucket
+	Avg   float64   `json:"avg"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Count int       `json:"count"`
+}
+
+// Keg is a keg from the history with its ratings, see GET /api/kegs
+type Keg struct {
+	KegInfo
+	Ratings Ratings `json:"ratings"`
+}
+
+// Ratings summarizes thumbs of the guests
+type Ratings struct {
+	Up       int      `json:"up"`
+	Down     int      `json:"down"`
+	Score    *float64 `json:"score"` // percent of thumbs up, nil without ratings
+	Comments []string `json:"comments"`
+}
+
+// Pour is a detected pour, see GET /api/pours
+type Pour struct {
+	StartedAt time.Time `json:"started_at"`
+	At        time.Time `json:"at"` // end of the pour
+	Grams     float64   `json:"grams"`
+	Glasses   float64   `json:"glasses"`
+	Duration  float64   `json:"duration"` // seconds
+	KegId     string    `json:"keg_id"`
+	Person    string    `json:"person,omitempty"` // only for the admin token
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"backend/client"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClient_Contract fails when the types of the client package miss a field of the server response
+func TestClient_Contract(t *testing.T) {
+	strict := func(value any, out any) {
+		data, err := json.Marshal(value)
+		assert.Nil(t, err)
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		assert.Nil(t, decoder.Decode(out), "%T", value)
+	}
+
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	assert.Nil(t, s.SetCleaning(time.Hour))
+	s.SetPubOverride(true, time.Hour)
+	status := s.Status()
+	status.PendingKeg = &PendingKeg{Weight: 16000, Guess: 10}
+	status.KegInfo.Untapped = &UntappedKeg{Weight: 12000}
+	status.KegInfo.Model = "plzen-15"
+	strict(status, &client.Status{})
+
+	score := 100.0
+	strict([]BeerHistoryItem{{KegInfo: *status.KegInfo, Ratings: RatingSummary{Up: 1, Score: &score}}}, &[]client.Keg{})
+	strict([]Pour{{Grams: 500, KegId: "k1", Person: "p1"}}, &[]client.Pour{})
+	strict(MeasurementHistory{Points: []MeasurementBucket{{Avg: 22000}}}, &client.MeasurementHistory{})
+}
@@ -0,0 +1,36 @@
+package main
+
+import "time"
+
+// ClosedLossEvent is the payload of [ClosedLossEventType]
+// published once per closing when the keg lost more than [Config.ClosedLossLimit] while the pub was closed
+type ClosedLossEvent struct {
+	Grams    float64   `json:"grams"`     // lost since the pub closed
+	Weight   float64   `json:"weight"`    // current weight
+	ClosedAt time.Time `json:"closed_at"` // zero if the pub was not open since the start
+}
+
+// checkClosedLoss alerts the weight loss while the pub is closed - leak, theft or a sneaky self-service pour
+// the loss is measured from the highest weight since closing, so a keg tapped while closed is not a loss
+// caller has to hold the lock
+func (s *Scale) checkClosedLoss(weight float64) {
+	if s.Pub.IsOpen || s.config.ClosedLossLimit <= 0 {
+		return
+	}
+
+	// unknown after the restart or tapping a keg, or a heavier keg was put on the scale
+	if weight > s.closedWeight {
+		s.closedWeight = weight
+		return
+	}
+
+	loss := s.closedWeight - weight
+	if loss <= s.config.ClosedLossLimit || s.closedLossAlerted {
+		return
+	}
+
+	s.closedLossAlerted = true
+	s.monitor.closedLoss.WithLabelValues().Set(1)
+	s.logger.Errorf("Weight dropped by %.0f grams while the pub is closed", loss)
+	s.events.Publish(ClosedLossEventType, ClosedLossEvent{Grams: loss, Weight: weight, ClosedAt: s.Pub.ClosedAt})
+}
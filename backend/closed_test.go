@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScale_ClosedLoss(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	s.Ping()
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	closedLoss := func() []ClosedLossEvent {
+		var found []ClosedLossEvent
+		for len(events) > 0 {
+			if event := <-events; event.Type == ClosedLossEventType {
+				found = append(found, event.Data.(ClosedLossEvent))
+			}
+		}
+		return found
+	}
+
+	assert.Nil(t, s.AddMeasurement(21000, SourceHttp))
+	assert.Empty(t, closedLoss(), "the pub is open")
+
+	s.SetPubOverride(false, time.Hour)
+	assert.Nil(t, s.AddMeasurement(20800, SourceHttp))
+	assert.Empty(t, closedLoss(), "within the limit")
+
+	assert.Nil(t, s.AddMeasurement(20500, SourceHttp))
+	assert.Nil(t, s.AddMeasurement(20000, SourceHttp))
+	alerts := closedLoss()
+	assert.Len(t, alerts, 1, "once per closing")
+	assert.Equal(t, 500.0, alerts[0].Grams)
+	assert.Equal(t, 1.0, gaugeValue(t, s.monitor, "scale_closed_loss"))
+
+	s.SetPubOverride(false, 0)
+	s.Ping()
+	assert.Equal(t, 0.0, gaugeValue(t, s.monitor, "scale_closed_loss"))
+
+	// a keg tapped while closed is not a loss
+	s.SetPubOverride(false, time.Hour)
+	assert.Nil(t, s.AddMeasurement(21000, SourceHttp))
+	assert.Nil(t, s.AddMeasurement(20900, SourceHttp))
+	assert.Nil(t, s.SetActiveKeg(10, "Pilsner"))
+	assert.Nil(t, s.AddMeasurement(16000, SourceHttp))
+	assert.Nil(t, s.AddMeasurement(15900, SourceHttp))
+	assert.Empty(t, closedLoss())
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ClosingSoonEvent is the payload of [ClosingSoonEventType]
+// published once per opening when the pour rate faded late in the pub day, a gentle automated last call
+type ClosingSoonEvent struct {
+	PoursPerHour int       `json:"pours_per_hour"`
+	Threshold    int       `json:"threshold"` // [Config.ClosingSoonRate]
+	OpenedAt     time.Time `json:"opened_at"`
+}
+
+// closingSoonAt returns when the closing soon signal is allowed within the pub day of now
+// the hour before the start of the pub day belongs to the next calendar day (e.g. 1 am)
+func closingSoonAt(now time.Time, hour, dayStart int) time.Time {
+	start := pubDayStart(now, dayStart)
+	at := time.Date(start.Year(), start.Month(), start.Day(), hour, 0, 0, 0, getTz())
+	if hour < dayStart {
+		at = at.AddDate(0, 0, 1)
+	}
+
+	return at
+}
+
+// ClosingSoonWebhook posts closing soon events to [Config.ClosingSoonWebhook], e.g. to dim the lights
+type ClosingSoonWebhook struct {
+	config  *Config
+	scale   *Scale
+	monitor *Monitor
+	logger  *logrus.Logger
+	client  *http.Client
+}
+
+func NewClosingSoonWebhook(config *Config, scale *Scale, monitor *Monitor, logger *logrus.Logger) *ClosingSoonWebhook {
+	return &ClosingSoonWebhook{
+		config:  config,
+		scale:   scale,
+		monitor: monitor,
+		logger:  logger,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled returns true if the webhook is configured
+func (cw *ClosingSoonWebhook) Enabled() bool {
+	return cw.config.ClosingSoonWebhook != "" && cw.config.ClosingSoonHour >= 0
+}
+
+// Run posts closing soon events until ctx is done
+// it's supposed to run as a supervised worker
+func (cw *ClosingSoonWebhook) Run(ctx context.Context, heartbeat func()) {
+	events := cw.scale.events.Subscribe()
+	defer cw.scale.events.Unsubscribe(events)
+
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			cw.logger.Debug("Closing soon webhook stopped")
+			return
+		case <-tick.C:
+			heartbeat()
+		case event := <-events:
+			if event.Type == ClosingSoonEventType {
+				err := cw.monitor.deliveries.Track("closing_soon", func() error {
+					return cw.send(ctx, event)
+				})
+				if err != nil {
+					cw.logger.Warnf("Could not send closing soon event: %v", err)
+				}
+			}
+			heartbeat()
+		}
+	}
+}
+
+// send posts the whole event, so the receiver sees its type and schema version
+func (cw *ClosingSoonWebhook) send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if cw.config.DryRun {
+		cw.logger.Infof("Dry run, not sending closing soon event: %s", body)
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cw.config.ClosingSoonWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := cw.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
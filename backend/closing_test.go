@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClosingSoonAt(t *testing.T) {
+	evening := time.Date(2024, 5, 10, 23, 30, 0, 0, getTz())
+	assert.Equal(t, time.Date(2024, 5, 10, 22, 0, 0, 0, getTz()), closingSoonAt(evening, 22, 6))
+	assert.Equal(t, time.Date(2024, 5, 11, 1, 0, 0, 0, getTz()), closingSoonAt(evening, 1, 6), "after midnight")
+
+	night := time.Date(2024, 5, 11, 2, 0, 0, 0, getTz())
+	assert.Equal(t, time.Date(2024, 5, 11, 1, 0, 0, 0, getTz()), closingSoonAt(night, 1, 6), "the same pub day")
+}
+
+func TestScale_ClosingSoon(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	now := time.Now().In(getTz())
+	config := NewConfig()
+	config.PubDayStart = now.Hour()
+	config.ClosingSoonHour = now.Hour()
+	s := NewScale(config, NewMonitor(), &FakeStore{}, logger)
+	s.LastOk = now
+	s.Pub = Pub{IsOpen: true, OpenedAt: now.Add(-30 * time.Minute)}
+
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	s.Recheck()
+	assert.Len(t, events, 0, "the pub has just opened")
+
+	s.Pub.OpenedAt = now.Add(-2 * time.Hour)
+	s.Recheck()
+	s.Recheck()
+	assert.Len(t, events, 1, "once per opening")
+	event := <-events
+	assert.Equal(t, ClosingSoonEventType, event.Type)
+	assert.Equal(t, 3, event.Data.(ClosingSoonEvent).Threshold)
+
+	// send the event to the webhook
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+	config.ClosingSoonWebhook = server.URL
+	webhook := NewClosingSoonWebhook(config, s, s.monitor, logger)
+	assert.True(t, webhook.Enabled())
+	assert.Nil(t, webhook.send(context.Background(), event))
+	assert.Equal(t, ClosingSoonEventType, received.Type)
+}
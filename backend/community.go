@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// communityCacheTtl is how long comparisons fetched from the community server are reused
+const communityCacheTtl = 15 * time.Minute
+
+// CommunityStats is the anonymized aggregate shared with other pubs
+// it contains no measurements, pours or people, only rounded totals
+type CommunityStats struct {
+	Name   string  `json:"name,omitempty"` // empty for anonymous pubs
+	Week   string  `json:"week"`           // first pub day of the week, YYYY-MM-DD
+	Liters float64 `json:"liters_week"`    // liters consumed during the week, rounded to liters
+	Kegs   int     `json:"kegs_month"`     // kegs tapped during the last 30 days
+}
+
+// Community shares weekly stats with the community server and fetches stats of other pubs for comparison
+// it's opt-in, nothing is sent unless [Config.CommunityUrl] is set
+// Protocol: POST <url>/stats with CommunityStats, GET <url>/stats returns stats of all pubs,
+// both authorized by the bearer token of the pub
+type Community struct {
+	config  *Config
+	store   Storage
+	monitor *Monitor
+	logger  *logrus.Logger
+	client  *http.Client
+
+	mux      sync.Mutex
+	cache    []CommunityStats
+	cachedAt time.Time
+}
+
+func NewCommunity(config *Config, store Storage, monitor *Monitor, logger *logrus.Logger) *Community {
+	return &Community{
+		config:  config,
+		store:   store,
+		monitor: monitor,
+		logger:  logger,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled returns true if the pub opted in
+func (c *Community) Enabled() bool {
+	return c.config.CommunityUrl != ""
+}
+
+// Run shares stats of the last week every night at [Config.ExportHour]
+// it's supposed to run as a supervised worker
+func (c *Community) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	next := nextExportAt(time.Now(), c.config.ExportHour)
+	for {
+		select {
+		case <-ctx.Done():
+			c.logger.Debug("Community stopped")
+			return
+		case now := <-tick.C:
+			heartbeat()
+			if now.Before(next) {
+				continue
+			}
+
+			if err := c.Share(ctx, now); err != nil {
+				c.logger.Warnf("Could not share community stats: %v", err)
+			}
+			next = nextExportAt(now, c.config.ExportHour)
+		}
+	}
+}
+
+// Stats calculates the shared stats of the last seven finished pub days
+func (c *Community) Stats(now time.Time) (CommunityStats, error) {
+	to := pubDayStart(now, c.config.PubDayStart)
+	from := to.AddDate(0, 0, -7)
+
+	measurements, err := c.store.GetMeasurements(from, to)
+	if err != nil {
+		return CommunityStats{}, fmt.Errorf("could not load measurements: %w", err)
+	}
+	summary := CalcDailySummary(from, measurements, c.config.GlassSize)
+
+	kegs, err := c.store.GetKegs()
+	if err != nil {
+		return CommunityStats{}, fmt.Errorf("could not load kegs: %w", err)
+	}
+	tapped := 0
+	for _, keg := range kegs {
+		if !keg.TappedAt.Before(now.AddDate(0, 0, -30)) && !keg.TappedAt.After(now) {
+			tapped++
+		}
+	}
+
+	return CommunityStats{
+		Name:   c.config.CommunityName,
+		Week:   summary.Day,
+		Liters: math.Round(summary.Liters),
+		Kegs:   tapped,
+	}, nil
+}
+
+// Share sends stats of the last week to the community server
+func (c *Community) Share(ctx context.Context, now time.Time) error {
+	stats, err := c.Stats(now)
+	if err != nil {
+		return err
+	}
+
+	if c.config.DryRun {
+		c.logger.Infof("Dry run, not sharing community stats: %+v", stats)
+		return nil
+	}
+
+	return c.monitor.deliveries.Track("community", func() error {
+		body, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.config.CommunityToken)
+
+		res, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode >= 300 {
+			return fmt.Errorf("community server returned status %d", res.StatusCode)
+		}
+		return nil
+	})
+}
+
+// Comparison returns stats of all pubs sharing with the community, the busiest first
+func (c *Community) Comparison(ctx context.Context) ([]CommunityStats, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.cache != nil && time.Since(c.cachedAt) < communityCacheTtl {
+		return c.cache, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.CommunityToken)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("community server returned status %d", res.StatusCode)
+	}
+
+	var pubs []CommunityStats
+	if err := json.NewDecoder(res.Body).Decode(&pubs); err != nil {
+		return nil, fmt.Errorf("invalid response of the community server: %w", err)
+	}
+	sort.SliceStable(pubs, func(i, j int) bool {
+		return pubs[i].Liters > pubs[j].Liters
+	})
+
+	c.cache = pubs
+	c.cachedAt = time.Now()
+	return pubs, nil
+}
+
+// CommunityRank returns the position of the liters among the pubs, 1 is the busiest
+func CommunityRank(pubs []CommunityStats, liters float64) int {
+	rank := 1
+	for _, pub := range pubs {
+		if pub.Liters > liters {
+			rank++
+		}
+	}
+	return rank
+}
+
+func (c *Community) url() string {
+	return strings.TrimSuffix(c.config.CommunityUrl, "/") + "/stats"
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommunity(t *testing.T) {
+	var shared []CommunityStats
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/stats", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		if r.Method == http.MethodPost {
+			var stats CommunityStats
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&stats))
+			shared = append(shared, stats)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(append([]CommunityStats{{Week: "2024-05-06", Liters: 55, Kegs: 2}}, shared...))
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.CommunityUrl = server.URL + "/"
+	config.CommunityToken = "secret"
+	config.CommunityName = "U Kocoura"
+	store := &FakeStore{}
+	community := NewCommunity(config, store, NewMonitor(), logger)
+	assert.True(t, community.Enabled())
+
+	now := time.Date(2024, 5, 13, 12, 0, 0, 0, getTz())
+	from := pubDayStart(now, config.PubDayStart).AddDate(0, 0, -7)
+	for i, weight := range []float64{60000, 40300, 35000, 20000} {
+		assert.Nil(t, store.AddMeasurement(Measurement{Weight: weight, At: from.Add(time.Duration(i) * 24 * time.Hour)}))
+	}
+	assert.Nil(t, store.AddMeasurement(Measurement{Weight: 10000, At: now}), "current pub day is not finished")
+	assert.Nil(t, store.SaveKeg(NewKegInfo(50, "Pilsner", now.AddDate(0, 0, -3), 60000)))
+	assert.Nil(t, store.SaveKeg(NewKegInfo(30, "Weizen", now.AddDate(0, 0, -40), 40000)))
+
+	stats, err := community.Stats(now)
+	assert.Nil(t, err)
+	assert.Equal(t, CommunityStats{Name: "U Kocoura", Week: "2024-05-06", Liters: 40, Kegs: 1}, stats)
+
+	assert.Nil(t, community.Share(context.Background(), now))
+	assert.Len(t, shared, 1)
+
+	pubs, err := community.Comparison(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, pubs, 2)
+	assert.Equal(t, 55.0, pubs[0].Liters, "the busiest first")
+	assert.Equal(t, 2, CommunityRank(pubs, stats.Liters))
+	assert.Equal(t, 1, CommunityRank(pubs, 55), "tie keeps the rank")
+
+	_, err = community.Comparison(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requests, "comparison is cached")
+}
@@ -1,35 +1,431 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
+// redisPrefixPattern keeps the prefix readable in redis-cli and free of glob characters
+var redisPrefixPattern = regexp.MustCompile(`^[A-Za-z0-9_:-]{0,32}$`)
+
 type Config struct {
-	RedisAddr string
-	RedisDB   int
+	StorageDriver string // redis, sqlite, postgres or memory (state is lost on restart, for local development)
+	StorageDsn    string // data source of sqlite (file) and postgres (connection string) drivers
+	StorageKey    string // hex or base64 AES-256 key encrypting measurements stored in redis, empty stores them in plain
+	RedisAddr     string
+	RedisDB       int
+	RedisPrefix   string // prefix of all keys, so more instances (prod, staging) can share one Redis database
+
+	ScaleDevices []string // ids of additional scales (taps), messages of the default scale carry no id
+
+	Pubs       []string           // names of more pubs hosted by the backend, served under /api/{pub}/
+	PubConfigs map[string]*Config // configurations of the hosted pubs by the name, see [newPubConfig]
+	DefaultPub string             // name of the default pub, the pub label of its metrics when more pubs are hosted
+	Pub        string             // name of the pub of this configuration, empty for the default pub
+
+	invalidEnv []error // problems with environment variables, see [configEnv]
+
+	LogLevel  string // logrus level name
+	LogFormat string // json or text
+
+	DryRun bool // outgoing integrations (mirror, Google Sheets, notifications) only log what they would send
+
+	Simulate         bool          // a simulated scale feeds the default scale, for development and demos without the hardware
+	SimulateInterval time.Duration // interval of messages of the simulated scale
 
 	AuthToken string // used for communication with the scale
 	Password  string // shared admin password
 
+	ApiTokens map[string]ApiToken // named tokens with scopes - name => scope:token
+	ReadAuth  bool                // reads of the API require a read-only token, otherwise they are open
+
+	ScaleSecrets    map[string]string // HMAC secrets of scales by device id ("default" is the scale without id)
+	ScaleTokenAuth  bool              // scale messages are accepted with AuthToken too, disable after firmware migration to signatures
+	SignatureMaxAge time.Duration     // max difference of the signed timestamp from the server time
+
+	SourcePreference string        // transport (http, mqtt, grpc) preferred when the scale reports through more of them, empty takes the first copy
+	SourceFailover   time.Duration // other transports are used when the preferred one is silent for this time
+
 	FrontendPath string
+
+	ShadowMaxReports int // how many device reports we tolerate before desired config is considered not applied
+
+	ExportPath string // directory for daily Parquet exports, empty disables exports
+	ExportHour int    // local hour when the previous day is exported
+
+	PubDayStart int      // local hour when the pub day starts, statistics are aggregated by pub days
+	PubSchedule []string // weekly opening hours like "fri 18:00-02:00", the pub is open within them even without the scale
+
+	ClosingSoonHour    int    // local hour since which a faded pour rate signals closing soon, -1 disables the signal
+	ClosingSoonRate    int    // pours per hour below which the pub is closing soon
+	ClosingSoonWebhook string // closing soon events are posted here (lighting, display board), empty disables the webhook
+
+	OccupancyBusy   int // pours per 15 minutes from which the pub is busy
+	OccupancyPacked int // pours per 15 minutes from which the pub is packed
+
+	FirmwareVersion string // latest firmware of the scale, a release uploaded via the API beats it
+	FirmwareUrl     string // binary of the latest firmware
+	FirmwareSha256  string // hex checksum of the binary
+
+	PublicTokens    map[string]string // read-only public API tokens - name => token
+	PublicRateLimit int               // requests per minute per public token
+
+	PublicCacheMaxAge       time.Duration // browsers keep the public status for this long, see publicCacheControl
+	PublicCacheSharedMaxAge time.Duration // CDN keeps the public status for this long (s-maxage), both zero disable caching
+	PublicCacheStale        time.Duration // CDN serves the stale status while revalidating or when the server is down
+
+	GlassSize   float64            // grams of beer in a single glass
+	GlassPrice  float64            // price of a glass for tabs, 0 shows glasses only
+	BeerGlasses map[string]float64 // per-beer overrides of [GlassSize] - lowercase beer name => grams
+	PourMinRate float64            // grams per second, weight dropping faster is considered as pouring
+	LineVolume  float64            // grams of beer filling the line, the first pour of a keg is reduced by it
+
+	MaxPourDuration time.Duration // longer continuous pour raises runaway tap alert
+	ClosedLossLimit float64       // grams, bigger weight loss while the pub is closed raises an alert, 0 disables it
+	EmptyScaleDelay time.Duration // nothing on the scale for this long while the pub is open raises an alert, 0 disables it
+	TareShiftLimit  float64       // grams, lower negative weights are recorded as a shifted tare, smaller ones are noise of the load cell
+
+	CleaningTimeout time.Duration // default duration of line cleaning mode
+
+	MetricTTL time.Duration // device metrics are removed when no data arrives for this long
+
+	MirrorUrl   string // accepted scale messages are forwarded here (e.g. staging push endpoint), empty disables mirroring
+	MirrorToken string // auth token of the mirror instance
+
+	WebhookUrls     []string      // events are posted here as signed JSON (POS, signage), empty disables the webhooks
+	WebhookSecret   string        // signs the posted events, see [WebhookSignatureHeader]
+	WebhookEvents   []string      // event types posted to the webhooks
+	WebhookThrottle time.Duration // minimal interval of posted measurements (state_change events)
+	WebhookRetries  int           // retries of a failed delivery with exponential backoff
+
+	GuestLinkMaxTtl time.Duration // maximal validity of guest dashboard links
+
+	Locale     string // default locale of human-facing number formats, overridden by Accept-Language
+	Timezone   string // IANA zone of displayed times and pub days
+	DateFormat string // Go layout of displayed dates (dashboard, notifications, exports)
+	WeightUnit string // unit of displayed weights, see weightUnits
+
+	SheetsId          string // Google spreadsheet id for daily summaries, empty disables the integration
+	SheetsRange       string // sheet range rows are appended to
+	SheetsCredentials string // service account JSON key
+
+	IngestAllowlist []*net.IPNet // scale messages are accepted only from these networks, empty allows everyone
+	TrustForwarded  bool         // use the address appended to X-Forwarded-For by the reverse proxy as the client address
+
+	IngestRateLimit       int // scale messages per minute per client address, 0 disables the limit
+	IngestDeviceRateLimit int // scale messages per minute per device, 0 disables the limit
+	IngestMaxBody         int // max size of a scale message in bytes
+
+	IngestTlsPort     int    // port of the mTLS ingestion server, 0 disables it
+	IngestTlsCert     string // server certificate (PEM file)
+	IngestTlsKey      string // server private key (PEM file)
+	IngestTlsClientCa string // CA signing device certificates (PEM file), issued for the device id by CN or DNS name, "default" for the default scale
+
+	CapturePath string // raw device payloads are recorded here for debugging, empty disables capturing
+
+	KegAutoDetect     bool          // tap the keg recognized by its weight automatically, otherwise it waits for confirmation
+	KegGuessTolerance float64       // max difference in grams from a full keg weight to recognize the keg
+	KegChangeJump     float64       // min weight increase in grams between two measurements considered as a keg change
+	KegConfirmWindow  time.Duration // automatically tapped keg can be corrected within this window
+
+	MinWeight          float64 // lighter measurements in grams are ignored (empty platform, scale lifted)
+	MaxWeight          float64 // heavier measurements in grams are ignored (someone stands on the scale)
+	WeightFilter       string  // smoothing of measured weight (median, ema), empty keeps measured values
+	WeightFilterWindow int     // number of recent measurements the filter works with
+	WeightMaxDelta     float64 // max difference in grams from the recent average, further values are rejected as spikes, 0 disables
+	// a keg change is delayed by the window with the max delta, without it the ema smears the jump over more measurements
+
+	HolidayCalendar string            // public holidays of the country (cz) or none
+	Holidays        map[string]string // custom holidays - YYYY-MM-DD => name
+
+	RatingRateLimit int // beer ratings per hour per client address
+
+	MetricMaxSeries int // max label combinations of a single metric
+
+	MetricsPushUrl      string        // metrics are pushed here when the instance can't be scraped, empty disables pushing
+	MetricsPushMode     string        // remote_write (Prometheus, VictoriaMetrics, Mimir) or pushgateway
+	MetricsPushInterval time.Duration // interval of pushes
+	MetricsPushJob      string        // job label of pushed metrics
+	MetricsPushInstance string        // instance label of pushed metrics, empty omits the label
+	MetricsPushUsername string        // basic auth of the push endpoint, empty sends the password as a bearer token
+	MetricsPushPassword string
+
+	WalPath string // measurements are buffered here while the storage is unreachable, empty disables buffering
+
+	AlertmanagerToken string // bearer token of inbound Alertmanager webhooks, empty disables the webhook
+
+	SelfCheckHour     int           // local hour of the nightly self-check
+	SelfCheckWebhook  string        // failed self-check reports are posted here, empty disables the notification
+	RetentionDays     int           // measurements older than this are pruned and reported by the self-check, 0 keeps them forever
+	RetentionMaxItems int           // the oldest measurements over this count are pruned per scale, 0 keeps all of them
+	RetentionHour     int           // local hour of the nightly pruning, before the self-check by default
+	BackupMaxAge      time.Duration // the last Parquet export must not be older than this
+
+	MqttBroker   string // host:port of the MQTT broker scale messages are consumed from, empty disables MQTT
+	MqttTopic    string // topic with pipe-delimited scale messages
+	MqttClientId string
+	MqttUsername string
+	MqttPassword string
+
+	GrpcPort int  // port of the gRPC ingestion for gateways (scalepb.ScaleIngest), 0 disables it
+	GrpcTls  bool // serve gRPC over TLS with INGEST_TLS_CERT, gateways with a certificate signed by INGEST_TLS_CLIENT_CA need no token, it lists scales of the gateway
+
+	TapWindow time.Duration // pour has to start within this time after the card tap to be attributed
+
+	TelegramToken   string        // Telegram bot token, empty disables Telegram notifications
+	TelegramChatId  string        // chat the bot sends notifications to
+	SlackWebhook    string        // Slack incoming webhook, empty disables Slack notifications
+	NotifyBeersLeft int           // low keg is notified when beers left drop to this number
+	NotifyCooldown  time.Duration // pub open/closed and runaway tap are notified at most once per this duration
+	AlertRules      []AlertRule   // notifications of conditions over metrics of the scale, see [AlertRule]
+
+	BackfillPrometheusUrl string        // Prometheus the weight history is backfilled from when the storage is empty, empty disables backfill
+	BackfillQuery         string        // PromQL query returning the weight in grams
+	BackfillPeriod        time.Duration // how much history is backfilled
+	BackfillStep          time.Duration // resolution of backfilled measurements
+
+	CommunityUrl   string // community server anonymized weekly stats are shared with, empty disables sharing
+	CommunityToken string // token of the pub at the community server
+	CommunityName  string // name shown to other pubs in comparisons, empty shares anonymously
+}
+
+// configEnv reads the configuration from environment variables
+// problems (unparsable values, unreadable secrets) are collected and reported by [Config.Validate]
+// instead of being silently replaced by defaults
+type configEnv struct {
+	pub        string          // PUB_<NAME>_<KEY> variables of the hosted pub take precedence, empty for the default pub
+	invalid    []error         // problems with the variables
+	overridden map[string]bool // keys set for the hosted pub
+}
+
+// lookup returns the variable of the hosted pub, or the shared one
+func (e *configEnv) lookup(key string) (string, bool) {
+	if e.pub != "" {
+		if value, ok := lookupEnv(pubEnvKey(e.pub, key)); ok {
+			e.override(key)
+			return value, true
+		}
+	}
+
+	return lookupEnv(key)
+}
+
+// override records the key is set for the hosted pub
+func (e *configEnv) override(key string) {
+	if e.overridden == nil {
+		e.overridden = map[string]bool{}
+	}
+	e.overridden[key] = true
 }
 
 func NewConfig() *Config {
-	return &Config{
-		RedisAddr: getStringEnvDefault("REDIS_ADDR", "localhost:6379"),
-		RedisDB:   getIntEnvDefault("REDIS_DB", 0),
+	config := newConfig(&configEnv{})
+	config.PubConfigs = map[string]*Config{}
+	for _, pub := range config.Pubs {
+		config.PubConfigs[pub] = newPubConfig(pub)
+	}
+
+	return config
+}
+
+// newConfig reads the configuration by env, its problems are reported by [Config.Validate]
+func newConfig(env *configEnv) *Config {
+	secrets := secretProviders()
+
+	config := &Config{
+		StorageDriver: env.getStringEnvDefault("STORAGE_DRIVER", "redis"),
+		StorageDsn:    env.getSecretDefault(secrets, "STORAGE_DSN", "scale.db"),
+		StorageKey:    env.getSecretDefault(secrets, "STORAGE_KEY", ""),
+		RedisAddr:     env.getStringEnvDefault("REDIS_ADDR", "localhost:6379"),
+		RedisDB:       env.getIntEnvDefault("REDIS_DB", 0),
+		RedisPrefix:   env.getStringEnvDefault("REDIS_PREFIX", ""),
+
+		ScaleDevices: env.getListEnvDefault("SCALE_DEVICES", nil),
+
+		Pubs:       env.getListEnvDefault("PUBS", nil),
+		DefaultPub: env.getStringEnvDefault("DEFAULT_PUB", "default"),
+
+		LogLevel:  env.getStringEnvDefault("LOG_LEVEL", "info"),
+		LogFormat: env.getStringEnvDefault("LOG_FORMAT", "json"),
+
+		DryRun: env.getBoolEnvDefault("DRY_RUN", false),
+
+		Simulate:         env.getBoolEnvDefault("SIMULATE", false),
+		SimulateInterval: env.getDurationEnvDefault("SIMULATE_INTERVAL", 10*time.Second),
+
+		AuthToken: env.getSecretDefault(secrets, "AUTH_TOKEN", "test"),
+		Password:  env.getSecretDefault(secrets, "PASSWORD", "test"),
+
+		ApiTokens: parseApiTokens(env.getSecretMapDefault(secrets, "API_TOKENS", map[string]string{})),
+		ReadAuth:  env.getBoolEnvDefault("READ_AUTH", false),
+
+		ScaleSecrets:    env.getSecretMapDefault(secrets, "SCALE_SECRETS", map[string]string{}),
+		ScaleTokenAuth:  env.getBoolEnvDefault("SCALE_TOKEN_AUTH", true),
+		SignatureMaxAge: env.getDurationEnvDefault("SIGNATURE_MAX_AGE", 5*time.Minute),
+
+		SourcePreference: env.getStringEnvDefault("SOURCE_PREFERENCE", ""),
+		SourceFailover:   env.getDurationEnvDefault("SOURCE_FAILOVER", 2*time.Minute),
+
+		FrontendPath: env.getStringEnvDefault("FRONTEND_PATH", "./../frontend/build/"),
+
+		ShadowMaxReports: env.getIntEnvDefault("SHADOW_MAX_REPORTS", 3),
+
+		ExportPath: env.getStringEnvDefault("EXPORT_PATH", ""),
+		ExportHour: env.getIntEnvDefault("EXPORT_HOUR", 5),
+
+		PubDayStart: env.getIntEnvDefault("PUB_DAY_START", 6),
+		PubSchedule: env.getListEnvDefault("PUB_SCHEDULE", []string{}),
+
+		ClosingSoonHour:    env.getIntEnvDefault("CLOSING_SOON_HOUR", -1),
+		ClosingSoonRate:    env.getIntEnvDefault("CLOSING_SOON_RATE", 3),
+		ClosingSoonWebhook: env.getStringEnvDefault("CLOSING_SOON_WEBHOOK", ""),
+
+		OccupancyBusy:   env.getIntEnvDefault("OCCUPANCY_BUSY", 4),
+		OccupancyPacked: env.getIntEnvDefault("OCCUPANCY_PACKED", 10),
+
+		FirmwareVersion: env.getStringEnvDefault("FIRMWARE_VERSION", ""),
+		FirmwareUrl:     env.getStringEnvDefault("FIRMWARE_URL", ""),
+		FirmwareSha256:  strings.ToLower(env.getStringEnvDefault("FIRMWARE_SHA256", "")),
+
+		PublicTokens:    env.getSecretMapDefault(secrets, "PUBLIC_TOKENS", map[string]string{}),
+		PublicRateLimit: env.getIntEnvDefault("PUBLIC_RATE_LIMIT", 60),
+
+		PublicCacheMaxAge:       env.getDurationEnvDefault("PUBLIC_CACHE_MAX_AGE", 10*time.Second),
+		PublicCacheSharedMaxAge: env.getDurationEnvDefault("PUBLIC_CACHE_S_MAXAGE", 30*time.Second),
+		PublicCacheStale:        env.getDurationEnvDefault("PUBLIC_CACHE_STALE", 5*time.Minute),
+
+		GlassSize:   env.getFloatEnvDefault("GLASS_SIZE", 500),
+		GlassPrice:  env.getFloatEnvDefault("GLASS_PRICE", 0),
+		BeerGlasses: env.getFloatMapEnvDefault("BEER_GLASSES", map[string]float64{}),
+		PourMinRate: env.getFloatEnvDefault("POUR_MIN_RATE", 10),
+		LineVolume:  env.getFloatEnvDefault("LINE_VOLUME", 0),
+
+		MaxPourDuration: env.getDurationEnvDefault("MAX_POUR_DURATION", time.Minute),
+		ClosedLossLimit: env.getFloatEnvDefault("CLOSED_LOSS_LIMIT", 300),               // more than a small glass
+		EmptyScaleDelay: env.getDurationEnvDefault("EMPTY_SCALE_DELAY", 10*time.Minute), // longer than a keg change
+		TareShiftLimit:  env.getFloatEnvDefault("TARE_SHIFT_LIMIT", 50),
+
+		CleaningTimeout: env.getDurationEnvDefault("CLEANING_TIMEOUT", time.Hour),
+
+		MetricTTL: env.getDurationEnvDefault("METRIC_TTL", OkLimit),
+
+		MirrorUrl:   env.getStringEnvDefault("MIRROR_URL", ""),
+		MirrorToken: env.getSecretDefault(secrets, "MIRROR_TOKEN", ""),
+
+		WebhookUrls:     env.getListEnvDefault("WEBHOOK_URLS", nil),
+		WebhookSecret:   env.getSecretDefault(secrets, "WEBHOOK_SECRET", ""),
+		WebhookEvents:   env.getListEnvDefault("WEBHOOK_EVENTS", []string{StateChangeEventType, PourEventType, KegLowEventType, KegChangeEventType, PubOpenEventType, OfflineEventType}),
+		WebhookThrottle: env.getDurationEnvDefault("WEBHOOK_THROTTLE", time.Minute),
+		WebhookRetries:  env.getIntEnvDefault("WEBHOOK_RETRIES", 5),
+
+		GuestLinkMaxTtl: env.getDurationEnvDefault("GUEST_LINK_MAX_TTL", 24*time.Hour),
+
+		Locale:     env.getStringEnvDefault("LOCALE", "cs"),
+		Timezone:   env.getStringEnvDefault("TIMEZONE", "Europe/Prague"),
+		DateFormat: env.getStringEnvDefault("DATE_FORMAT", time.DateTime),
+		WeightUnit: env.getStringEnvDefault("WEIGHT_UNIT", "kg"),
+
+		SheetsId:          env.getStringEnvDefault("SHEETS_ID", ""),
+		SheetsRange:       env.getStringEnvDefault("SHEETS_RANGE", "Sheet1!A:D"),
+		SheetsCredentials: env.getSecretDefault(secrets, "SHEETS_CREDENTIALS", ""),
+
+		IngestAllowlist: env.getCidrListEnvDefault("INGEST_ALLOWLIST", nil),
+		TrustForwarded:  env.getBoolEnvDefault("TRUST_FORWARDED", false),
+
+		IngestRateLimit:       env.getIntEnvDefault("INGEST_RATE_LIMIT", 600),
+		IngestDeviceRateLimit: env.getIntEnvDefault("INGEST_DEVICE_RATE_LIMIT", 120),
+		IngestMaxBody:         env.getIntEnvDefault("INGEST_MAX_BODY", 1024),
+
+		IngestTlsPort:     env.getIntEnvDefault("INGEST_TLS_PORT", 0),
+		IngestTlsCert:     env.getStringEnvDefault("INGEST_TLS_CERT", ""),
+		IngestTlsKey:      env.getStringEnvDefault("INGEST_TLS_KEY", ""),
+		IngestTlsClientCa: env.getStringEnvDefault("INGEST_TLS_CLIENT_CA", ""),
+
+		CapturePath: env.getStringEnvDefault("CAPTURE_PATH", ""),
+
+		KegAutoDetect:     env.getBoolEnvDefault("KEG_AUTO_DETECT", true),
+		KegGuessTolerance: env.getFloatEnvDefault("KEG_GUESS_TOLERANCE", 2000),
+		KegChangeJump:     env.getFloatEnvDefault("KEG_CHANGE_JUMP", 5000), // the smallest keg holds 10 liters
+		KegConfirmWindow:  env.getDurationEnvDefault("KEG_CONFIRM_WINDOW", 30*time.Minute),
+
+		MinWeight:          env.getFloatEnvDefault("MIN_WEIGHT", 6000), // the lightest empty keg
+		MaxWeight:          env.getFloatEnvDefault("MAX_WEIGHT", 65000),
+		WeightFilter:       env.getStringEnvDefault("WEIGHT_FILTER", WeightFilterNone),
+		WeightFilterWindow: env.getIntEnvDefault("WEIGHT_FILTER_WINDOW", 5),
+		WeightMaxDelta:     env.getFloatEnvDefault("WEIGHT_MAX_DELTA", 0),
 
-		AuthToken: getStringEnvDefault("AUTH_TOKEN", "test"),
-		Password:  getStringEnvDefault("PASSWORD", "test"),
+		HolidayCalendar: env.getStringEnvDefault("HOLIDAY_CALENDAR", "cz"),
+		Holidays:        env.getMapEnvDefault("HOLIDAYS", map[string]string{}),
 
-		FrontendPath: getStringEnvDefault("FRONTEND_PATH", "./../frontend/build/"),
+		RatingRateLimit: env.getIntEnvDefault("RATING_RATE_LIMIT", 3),
+
+		MetricMaxSeries: env.getIntEnvDefault("METRIC_MAX_SERIES", 100),
+
+		MetricsPushUrl:      env.getStringEnvDefault("METRICS_PUSH_URL", ""),
+		MetricsPushMode:     env.getStringEnvDefault("METRICS_PUSH_MODE", MetricsPushRemoteWrite),
+		MetricsPushInterval: env.getDurationEnvDefault("METRICS_PUSH_INTERVAL", 30*time.Second),
+		MetricsPushJob:      env.getStringEnvDefault("METRICS_PUSH_JOB", "keg_scale"),
+		MetricsPushInstance: env.getStringEnvDefault("METRICS_PUSH_INSTANCE", ""),
+		MetricsPushUsername: env.getStringEnvDefault("METRICS_PUSH_USERNAME", ""),
+		MetricsPushPassword: env.getSecretDefault(secrets, "METRICS_PUSH_PASSWORD", ""),
+
+		WalPath: env.getStringEnvDefault("WAL_PATH", ""),
+
+		AlertmanagerToken: env.getSecretDefault(secrets, "ALERTMANAGER_TOKEN", ""),
+
+		SelfCheckHour:     env.getIntEnvDefault("SELFCHECK_HOUR", 4),
+		SelfCheckWebhook:  env.getStringEnvDefault("SELFCHECK_WEBHOOK", ""),
+		RetentionDays:     env.getIntEnvDefault("RETENTION_DAYS", 0),
+		RetentionMaxItems: env.getIntEnvDefault("RETENTION_MAX_ITEMS", 0),
+		RetentionHour:     env.getIntEnvDefault("RETENTION_HOUR", 3),
+		BackupMaxAge:      env.getDurationEnvDefault("BACKUP_MAX_AGE", 48*time.Hour),
+
+		MqttBroker:   env.getStringEnvDefault("MQTT_BROKER", ""),
+		MqttTopic:    env.getStringEnvDefault("MQTT_TOPIC", "scale/messages"),
+		MqttClientId: env.getStringEnvDefault("MQTT_CLIENT_ID", "keg-scale"),
+		MqttUsername: env.getStringEnvDefault("MQTT_USERNAME", ""),
+		MqttPassword: env.getSecretDefault(secrets, "MQTT_PASSWORD", ""),
+
+		GrpcPort: env.getIntEnvDefault("GRPC_PORT", 0),
+		GrpcTls:  env.getBoolEnvDefault("GRPC_TLS", false),
+
+		TapWindow: env.getDurationEnvDefault("TAP_WINDOW", time.Minute),
+
+		TelegramToken:   env.getSecretDefault(secrets, "TELEGRAM_TOKEN", ""),
+		TelegramChatId:  env.getStringEnvDefault("TELEGRAM_CHAT_ID", ""),
+		SlackWebhook:    env.getSecretDefault(secrets, "SLACK_WEBHOOK", ""),
+		NotifyBeersLeft: env.getIntEnvDefault("NOTIFY_BEERS_LEFT", 10),
+		NotifyCooldown:  env.getDurationEnvDefault("NOTIFY_COOLDOWN", 30*time.Minute),
+		AlertRules:      env.getAlertRulesDefault("ALERT_RULES", "ALERT_RULES_FILE"),
+
+		BackfillPrometheusUrl: env.getStringEnvDefault("BACKFILL_PROMETHEUS_URL", ""),
+		BackfillQuery:         env.getStringEnvDefault("BACKFILL_QUERY", "scale_weight"),
+		BackfillPeriod:        env.getDurationEnvDefault("BACKFILL_PERIOD", 7*24*time.Hour),
+		BackfillStep:          env.getDurationEnvDefault("BACKFILL_STEP", time.Minute),
+
+		CommunityUrl:   env.getStringEnvDefault("COMMUNITY_URL", ""),
+		CommunityToken: env.getSecretDefault(secrets, "COMMUNITY_TOKEN", ""),
+		CommunityName:  env.getStringEnvDefault("COMMUNITY_NAME", ""),
 	}
+	config.invalidEnv = env.invalid
+
+	return config
 }
 
-func getStringEnvDefault(key string, defaultValue string) string {
-	if value, ok := os.LookupEnv(key); ok {
+func (e *configEnv) getStringEnvDefault(key string, defaultValue string) string {
+	if value, ok := e.lookup(key); ok {
 		return value
 	}
 
@@ -37,13 +433,738 @@ func getStringEnvDefault(key string, defaultValue string) string {
 	return defaultValue
 }
 
-func getIntEnvDefault(key string, defaultValue int) int {
-	if value, ok := os.LookupEnv(key); ok {
+func (e *configEnv) getIntEnvDefault(key string, defaultValue int) int {
+	if value, ok := e.lookup(key); ok {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
+		e.invalid = append(e.invalid, fmt.Errorf("%s: invalid value %q", key, value))
+	}
+
+	fmt.Println(fmt.Sprintf("Using default value for %s", key))
+	return defaultValue
+}
+
+func (e *configEnv) getFloatEnvDefault(key string, defaultValue float64) float64 {
+	if value, ok := e.lookup(key); ok {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+		e.invalid = append(e.invalid, fmt.Errorf("%s: invalid value %q", key, value))
+	}
+
+	fmt.Println(fmt.Sprintf("Using default value for %s", key))
+	return defaultValue
+}
+
+// getDurationEnvDefault parses Go duration format (e.g. 5m, 30s)
+func (e *configEnv) getDurationEnvDefault(key string, defaultValue time.Duration) time.Duration {
+	if value, ok := e.lookup(key); ok {
+		if durationValue, err := time.ParseDuration(value); err == nil {
+			return durationValue
+		}
+		e.invalid = append(e.invalid, fmt.Errorf("%s: invalid value %q", key, value))
+	}
+
+	fmt.Println(fmt.Sprintf("Using default value for %s", key))
+	return defaultValue
+}
+
+func (e *configEnv) getBoolEnvDefault(key string, defaultValue bool) bool {
+	if value, ok := e.lookup(key); ok {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+		e.invalid = append(e.invalid, fmt.Errorf("%s: invalid value %q", key, value))
 	}
 
 	fmt.Println(fmt.Sprintf("Using default value for %s", key))
 	return defaultValue
 }
+
+// getListEnvDefault parses comma separated values, empty items are skipped
+func (e *configEnv) getListEnvDefault(key string, defaultValue []string) []string {
+	value, ok := e.lookup(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		fmt.Println(fmt.Sprintf("Using default value for %s", key))
+		return defaultValue
+	}
+
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// getCidrListEnvDefault parses comma separated networks (e.g. 10.0.0.0/8,192.0.2.1)
+// a single address is treated as a network of its own
+func (e *configEnv) getCidrListEnvDefault(key string, defaultValue []*net.IPNet) []*net.IPNet {
+	value, ok := e.lookup(key)
+	if !ok || strings.TrimSpace(value) == "" {
+		fmt.Println(fmt.Sprintf("Using default value for %s", key))
+		return defaultValue
+	}
+
+	networks := []*net.IPNet{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			e.invalid = append(e.invalid, fmt.Errorf("%s: invalid network %q", key, item))
+			return defaultValue
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// getMapEnvDefault parses key=value pairs separated by comma
+func (e *configEnv) getMapEnvDefault(key string, defaultValue map[string]string) map[string]string {
+	value, ok := e.lookup(key)
+	if !ok || value == "" {
+		fmt.Println(fmt.Sprintf("Using default value for %s", key))
+		return defaultValue
+	}
+
+	mapValue, err := parseKeyValues(value)
+	if err != nil {
+		e.invalid = append(e.invalid, fmt.Errorf("%s: invalid key=value list", key))
+		return defaultValue
+	}
+
+	return mapValue
+}
+
+// getFloatMapEnvDefault parses key=value pairs separated by comma with numeric values
+// keys are lowercased
+func (e *configEnv) getFloatMapEnvDefault(key string, defaultValue map[string]float64) map[string]float64 {
+	value, ok := e.lookup(key)
+	if !ok || value == "" {
+		fmt.Println(fmt.Sprintf("Using default value for %s", key))
+		return defaultValue
+	}
+
+	pairs, err := parseKeyValues(value)
+	if err != nil {
+		e.invalid = append(e.invalid, fmt.Errorf("%s: invalid key=value list", key))
+		return defaultValue
+	}
+
+	mapValue := make(map[string]float64, len(pairs))
+	for name, raw := range pairs {
+		floatValue, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			e.invalid = append(e.invalid, fmt.Errorf("%s: invalid value %q of %s", key, raw, name))
+			return defaultValue
+		}
+		mapValue[strings.ToLower(name)] = floatValue
+	}
+
+	return mapValue
+}
+
+// GlassFor returns grams of beer in a served glass of the given beer
+// brands with more foam have their own preset, others use [Config.GlassSize]
+func (c *Config) GlassFor(beer string) float64 {
+	if glass, found := c.BeerGlasses[strings.ToLower(strings.TrimSpace(beer))]; found {
+		return glass
+	}
+
+	return c.GlassSize
+}
+
+// getSecretDefault resolves a secret using the first provider which knows it
+// the value itself is never printed
+func (e *configEnv) getSecretDefault(providers []SecretProvider, key string, defaultValue string) string {
+	if e.pub != "" {
+		if value, found := e.lookupSecret(providers, pubEnvKey(e.pub, key)); found {
+			e.override(key)
+			return value
+		}
+	}
+	if value, found := e.lookupSecret(providers, key); found {
+		return value
+	}
+
+	fmt.Println(fmt.Sprintf("Using default value for %s", key))
+	return defaultValue
+}
+
+// lookupSecret returns the secret of the first provider holding it
+func (e *configEnv) lookupSecret(providers []SecretProvider, key string) (string, bool) {
+	for _, provider := range providers {
+		value, found, err := provider.Secret(key)
+		if err != nil {
+			e.invalid = append(e.invalid, fmt.Errorf("%s: %s secret provider failed: %w", key, provider.Name(), err))
+			continue
+		}
+		if found {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// getSecretMapDefault resolves a secret containing key=value pairs separated by comma
+func (e *configEnv) getSecretMapDefault(providers []SecretProvider, key string, defaultValue map[string]string) map[string]string {
+	raw := e.getSecretDefault(providers, key, "")
+	if raw == "" {
+		return defaultValue
+	}
+
+	mapValue, err := parseKeyValues(raw)
+	if err != nil {
+		e.invalid = append(e.invalid, fmt.Errorf("%s: invalid key=value list", key))
+		return defaultValue
+	}
+
+	return mapValue
+}
+
+// Validate checks the whole configuration and returns all problems at once
+// configurations of the hosted pubs are checked too, their problems are prefixed by the pub
+func (c *Config) Validate() error {
+	return errors.Join(c.problems()...)
+}
+
+// envKey returns the variable setting the key for the pub of the configuration
+func (c *Config) envKey(key string) string {
+	if c.Pub != "" {
+		return pubEnvKey(c.Pub, key)
+	}
+	return key
+}
+
+// problems returns all problems of the configuration
+func (c *Config) problems() []error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	errs = append(errs, c.invalidEnv...)
+
+	switch c.StorageDriver {
+	case "redis", "memory":
+	case "sqlite", "postgres":
+		if c.StorageDsn == "" {
+			add("%s: is required by the %s driver", c.envKey("STORAGE_DSN"), c.StorageDriver)
+		}
+	default:
+		add("STORAGE_DRIVER: %q is not supported, use redis, sqlite, postgres or memory", c.StorageDriver)
+	}
+	if c.StorageKey != "" {
+		if _, err := decodeStorageKey(c.StorageKey); err != nil {
+			add("STORAGE_KEY: %v", err)
+		}
+		if c.StorageDriver != "redis" {
+			add("STORAGE_KEY: measurements are encrypted only by redis storage")
+		}
+	}
+
+	devices := map[string]bool{}
+	for _, device := range c.ScaleDevices {
+		if !deviceIdPattern.MatchString(device) {
+			add("SCALE_DEVICES: %q is not a valid device id (lowercase letters, digits and dashes, starting with a letter)", device)
+		}
+		if devices[device] {
+			add("SCALE_DEVICES: %q is listed twice", device)
+		}
+		devices[device] = true
+	}
+	if len(c.ScaleDevices) > 0 && c.StorageDriver != "redis" && c.StorageDriver != "memory" {
+		add("SCALE_DEVICES: more scales are supported only by redis and memory storage")
+	}
+	pubs := map[string]bool{}
+	for _, pub := range c.Pubs {
+		if !deviceIdPattern.MatchString(pub) {
+			add("PUBS: %q is not a valid pub name (lowercase letters, digits and dashes, starting with a letter)", pub)
+		}
+		if pubs[pub] {
+			add("PUBS: %q is listed twice", pub)
+		}
+		pubs[pub] = true
+	}
+
+	if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+		add("LOG_LEVEL: %q is not a valid level", c.LogLevel)
+	}
+	if c.LogFormat != "json" && c.LogFormat != "text" {
+		add("LOG_FORMAT: %q is not supported, use json or text", c.LogFormat)
+	}
+
+	if _, _, err := net.SplitHostPort(c.RedisAddr); err != nil {
+		add("REDIS_ADDR: %q is not a host:port address", c.RedisAddr)
+	}
+	if c.RedisDB < 0 {
+		add("REDIS_DB: must not be negative")
+	}
+	if !redisPrefixPattern.MatchString(c.RedisPrefix) {
+		add("REDIS_PREFIX: %q may contain only letters, digits, dashes, underscores and colons", c.RedisPrefix)
+	}
+
+	if c.AuthToken == "" {
+		add("%s: is required", c.envKey("AUTH_TOKEN"))
+	}
+	if c.Password == "" {
+		add("%s: is required", c.envKey("PASSWORD"))
+	}
+	for device, secret := range c.ScaleSecrets {
+		if device != defaultDeviceSecret && !slices.Contains(c.ScaleDevices, device) {
+			add("SCALE_SECRETS: %q is not the default scale or listed in SCALE_DEVICES", device)
+		}
+		if len(secret) < 16 {
+			add("SCALE_SECRETS: secret of %q must have at least 16 characters", device)
+		}
+	}
+	if !c.ScaleTokenAuth && len(c.ScaleSecrets) == 0 && c.IngestTlsPort == 0 {
+		add("SCALE_TOKEN_AUTH: scale could not authenticate, set SCALE_SECRETS or INGEST_TLS_PORT")
+	}
+	if c.SignatureMaxAge <= 0 {
+		add("SIGNATURE_MAX_AGE: must be positive")
+	}
+	if c.SourcePreference != "" && c.SourcePreference != SourceHttp && c.SourcePreference != SourceMqtt && c.SourcePreference != SourceGrpc {
+		add("SOURCE_PREFERENCE: %q is not supported, use http, mqtt, grpc or leave it empty", c.SourcePreference)
+	}
+	if c.SourceFailover <= 0 {
+		add("SOURCE_FAILOVER: must be positive")
+	}
+	if c.Simulate && c.SimulateInterval <= 0 {
+		add("SIMULATE_INTERVAL: must be positive")
+	}
+
+	if c.ShadowMaxReports < 1 {
+		add("SHADOW_MAX_REPORTS: must be at least 1")
+	}
+	if c.ExportHour < 0 || c.ExportHour > 23 {
+		add("EXPORT_HOUR: must be between 0 and 23")
+	}
+	if c.PubDayStart < 0 || c.PubDayStart > 23 {
+		add("PUB_DAY_START: must be between 0 and 23")
+	}
+	if _, err := ParsePubSchedule(c.PubSchedule); err != nil {
+		add("PUB_SCHEDULE: %v", err)
+	}
+	if c.ClosingSoonHour < -1 || c.ClosingSoonHour > 23 {
+		add("CLOSING_SOON_HOUR: must be between 0 and 23, or -1 to disable")
+	}
+	if c.ClosingSoonRate < 1 {
+		add("CLOSING_SOON_RATE: must be at least 1")
+	}
+	if c.OccupancyBusy < 1 {
+		add("OCCUPANCY_BUSY: must be at least 1")
+	}
+	if c.OccupancyPacked <= c.OccupancyBusy {
+		add("OCCUPANCY_PACKED: must be more than OCCUPANCY_BUSY")
+	}
+	if c.ClosingSoonWebhook != "" {
+		if u, err := url.Parse(c.ClosingSoonWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			add("CLOSING_SOON_WEBHOOK: %q is not a http(s) url", c.ClosingSoonWebhook)
+		}
+		if c.ClosingSoonHour < 0 {
+			add("CLOSING_SOON_WEBHOOK: requires CLOSING_SOON_HOUR")
+		}
+	}
+	if c.FirmwareVersion != "" || c.FirmwareUrl != "" || c.FirmwareSha256 != "" {
+		release := FirmwareRelease{Version: c.FirmwareVersion, Url: c.FirmwareUrl, Sha256: c.FirmwareSha256}
+		if err := release.Validate(); err != nil {
+			add("FIRMWARE_VERSION, FIRMWARE_URL, FIRMWARE_SHA256: %v", err)
+		}
+	}
+
+	for name, token := range c.ApiTokens {
+		switch token.Scope {
+		case ScopeAdmin, ScopeDeviceIngest, ScopeReadOnly:
+		default:
+			add("API_TOKENS: token %s has unknown scope %q, use admin, device-ingest or read-only", name, token.Scope)
+		}
+		if token.Token == "" {
+			add("API_TOKENS: token %s is empty", name)
+		}
+		if token.Token == c.AuthToken || token.Token == c.Password {
+			add("API_TOKENS: token %s must differ from AUTH_TOKEN and PASSWORD", name)
+		}
+		for other, otherToken := range c.ApiTokens {
+			if other < name && otherToken.Token == token.Token {
+				add("API_TOKENS: tokens %s and %s are the same", other, name)
+			}
+		}
+	}
+
+	for name, token := range c.PublicTokens {
+		if token == "" {
+			add("PUBLIC_TOKENS: token %s is empty", name)
+		}
+		if token == c.AuthToken || token == c.Password {
+			add("PUBLIC_TOKENS: token %s must differ from AUTH_TOKEN and PASSWORD", name)
+		}
+	}
+	if c.PublicRateLimit < 1 {
+		add("PUBLIC_RATE_LIMIT: must be at least 1")
+	}
+	if c.PublicCacheMaxAge < 0 {
+		add("PUBLIC_CACHE_MAX_AGE: must not be negative")
+	}
+	if c.PublicCacheSharedMaxAge < 0 {
+		add("PUBLIC_CACHE_S_MAXAGE: must not be negative")
+	}
+	if c.PublicCacheStale < 0 {
+		add("PUBLIC_CACHE_STALE: must not be negative")
+	}
+	if c.IngestRateLimit < 0 {
+		add("INGEST_RATE_LIMIT: must not be negative")
+	}
+	if c.IngestDeviceRateLimit < 0 {
+		add("INGEST_DEVICE_RATE_LIMIT: must not be negative")
+	}
+	if c.IngestMaxBody < 64 {
+		add("INGEST_MAX_BODY: must be at least 64 bytes")
+	}
+
+	if c.GlassSize <= 0 {
+		add("GLASS_SIZE: must be positive")
+	}
+	if c.GlassPrice < 0 {
+		add("GLASS_PRICE: must not be negative")
+	}
+	for beer, glass := range c.BeerGlasses {
+		if glass <= 0 {
+			add("BEER_GLASSES: glass of %s must be positive", beer)
+		}
+	}
+	if c.PourMinRate <= 0 {
+		add("POUR_MIN_RATE: must be positive")
+	}
+	if c.LineVolume < 0 {
+		add("LINE_VOLUME: must not be negative")
+	}
+	if c.MaxPourDuration <= 0 {
+		add("MAX_POUR_DURATION: must be positive")
+	}
+	if c.ClosedLossLimit < 0 {
+		add("CLOSED_LOSS_LIMIT: must not be negative")
+	}
+	if c.EmptyScaleDelay < 0 {
+		add("EMPTY_SCALE_DELAY: must not be negative")
+	}
+	if c.TareShiftLimit < 0 {
+		add("TARE_SHIFT_LIMIT: must not be negative")
+	}
+	if c.CleaningTimeout <= 0 {
+		add("CLEANING_TIMEOUT: must be positive")
+	}
+	if c.MetricTTL <= 0 {
+		add("METRIC_TTL: must be positive")
+	}
+	if c.TapWindow <= 0 {
+		add("TAP_WINDOW: must be positive")
+	}
+
+	if c.MirrorUrl != "" {
+		if u, err := url.Parse(c.MirrorUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			add("MIRROR_URL: %q is not a http(s) url", c.MirrorUrl)
+		}
+	}
+
+	for _, webhook := range c.WebhookUrls {
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			add("WEBHOOK_URLS: %q is not a http(s) url", webhook)
+		}
+	}
+	if len(c.WebhookUrls) > 0 && c.WebhookSecret == "" {
+		add("WEBHOOK_SECRET: required by WEBHOOK_URLS, receivers verify the signature")
+	}
+	for _, event := range c.WebhookEvents {
+		if _, found := EventVersions[event]; !found {
+			add("WEBHOOK_EVENTS: unknown event type %q", event)
+		}
+	}
+	if c.WebhookThrottle < 0 {
+		add("WEBHOOK_THROTTLE: must not be negative")
+	}
+	if c.WebhookRetries < 0 {
+		add("WEBHOOK_RETRIES: must not be negative")
+	}
+
+	if c.CommunityUrl != "" {
+		if u, err := url.Parse(c.CommunityUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			add("COMMUNITY_URL: %q is not a http(s) url", c.CommunityUrl)
+		}
+		if c.CommunityToken == "" {
+			add("COMMUNITY_TOKEN: is required when COMMUNITY_URL is set")
+		}
+	}
+
+	if c.TelegramToken != "" && c.TelegramChatId == "" {
+		add("TELEGRAM_CHAT_ID: is required when TELEGRAM_TOKEN is set")
+	}
+	if c.SlackWebhook != "" {
+		if u, err := url.Parse(c.SlackWebhook); err != nil || u.Scheme != "https" {
+			add("SLACK_WEBHOOK: is not a https url")
+		}
+	}
+	if c.NotifyBeersLeft < 0 {
+		add("NOTIFY_BEERS_LEFT: must not be negative")
+	}
+	if c.NotifyCooldown < 0 {
+		add("NOTIFY_COOLDOWN: must not be negative")
+	}
+	names := map[string]bool{}
+	for _, rule := range c.AlertRules {
+		if err := rule.Validate(); err != nil {
+			add("ALERT_RULES: rule %q: %v", rule.Name, err)
+		}
+		if names[rule.Name] {
+			add("ALERT_RULES: rule %q is defined more than once", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+
+	if c.BackfillPrometheusUrl != "" {
+		if u, err := url.Parse(c.BackfillPrometheusUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			add("BACKFILL_PROMETHEUS_URL: %q is not a http(s) url", c.BackfillPrometheusUrl)
+		}
+		if c.BackfillQuery == "" {
+			add("BACKFILL_QUERY: is required when BACKFILL_PROMETHEUS_URL is set")
+		}
+		if c.BackfillPeriod <= 0 {
+			add("BACKFILL_PERIOD: must be positive")
+		}
+		if c.BackfillStep < time.Second {
+			add("BACKFILL_STEP: must be at least 1s")
+		}
+	}
+
+	if c.SelfCheckHour < 0 || c.SelfCheckHour > 23 {
+		add("SELFCHECK_HOUR: must be between 0 and 23")
+	}
+	if c.SelfCheckWebhook != "" {
+		if u, err := url.Parse(c.SelfCheckWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			add("SELFCHECK_WEBHOOK: %q is not a http(s) url", c.SelfCheckWebhook)
+		}
+	}
+	if c.RetentionDays < 0 {
+		add("RETENTION_DAYS: must not be negative")
+	}
+	if c.RetentionMaxItems < 0 {
+		add("RETENTION_MAX_ITEMS: must not be negative")
+	}
+	if c.RetentionHour < 0 || c.RetentionHour > 23 {
+		add("RETENTION_HOUR: must be between 0 and 23")
+	}
+	if c.BackupMaxAge <= 0 {
+		add("BACKUP_MAX_AGE: must be positive")
+	}
+
+	if c.MqttBroker != "" {
+		if _, _, err := net.SplitHostPort(c.MqttBroker); err != nil {
+			add("MQTT_BROKER: %q is not host:port", c.MqttBroker)
+		}
+		if c.MqttTopic == "" {
+			add("MQTT_TOPIC: is required when MQTT_BROKER is set")
+		}
+		if c.MqttClientId == "" {
+			add("MQTT_CLIENT_ID: is required when MQTT_BROKER is set")
+		}
+	}
+	if c.GrpcPort < 0 || c.GrpcPort > 65535 {
+		add("GRPC_PORT: must be between 0 and 65535")
+	}
+	if c.GrpcPort > 0 && (c.GrpcPort == 8080 || c.GrpcPort == c.IngestTlsPort) {
+		add("GRPC_PORT: %d is used by another server", c.GrpcPort)
+	}
+	if c.GrpcPort > 0 && !c.ScaleTokenAuth && (!c.GrpcTls || c.IngestTlsClientCa == "") {
+		add("GRPC_PORT: gateways could not authenticate without tokens, set GRPC_TLS and INGEST_TLS_CLIENT_CA")
+	}
+	if c.GrpcTls {
+		files := []struct{ key, path string }{
+			{"INGEST_TLS_CERT", c.IngestTlsCert},
+			{"INGEST_TLS_KEY", c.IngestTlsKey},
+		}
+		for _, file := range files {
+			if file.path == "" {
+				add("%s: is required when GRPC_TLS is set", file.key)
+			}
+		}
+	}
+
+	if c.GuestLinkMaxTtl <= 0 {
+		add("GUEST_LINK_MAX_TTL: must be positive")
+	}
+
+	if _, found := decimalSeparators[c.Locale]; !found {
+		add("LOCALE: %q is not supported", c.Locale)
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		add("TIMEZONE: %v", err)
+	}
+	if c.DateFormat == "" {
+		add("DATE_FORMAT: must not be empty")
+	}
+	if _, found := weightUnits[c.WeightUnit]; !found {
+		add("WEIGHT_UNIT: %q is not supported", c.WeightUnit)
+	}
+
+	if c.SheetsId != "" {
+		if _, _, err := ParseServiceAccount(c.SheetsCredentials); err != nil {
+			add("SHEETS_CREDENTIALS: %v", err)
+		}
+	}
+
+	if c.IngestTlsPort < 0 || c.IngestTlsPort > 65535 {
+		add("INGEST_TLS_PORT: must be between 0 and 65535")
+	}
+	if c.IngestTlsPort > 0 {
+		if c.IngestTlsPort == 8080 {
+			add("INGEST_TLS_PORT: 8080 is used by the main server")
+		}
+		files := []struct{ key, path string }{
+			{"INGEST_TLS_CERT", c.IngestTlsCert},
+			{"INGEST_TLS_KEY", c.IngestTlsKey},
+			{"INGEST_TLS_CLIENT_CA", c.IngestTlsClientCa},
+		}
+		for _, file := range files {
+			if file.path == "" {
+				add("%s: is required when INGEST_TLS_PORT is set", file.key)
+			} else if _, err := os.Stat(file.path); err != nil {
+				add("%s: %v", file.key, err)
+			}
+		}
+	}
+
+	if c.KegGuessTolerance <= 0 {
+		add("KEG_GUESS_TOLERANCE: must be positive")
+	}
+	if c.KegChangeJump <= 0 {
+		add("KEG_CHANGE_JUMP: must be positive")
+	}
+	if c.KegConfirmWindow <= 0 {
+		add("KEG_CONFIRM_WINDOW: must be positive")
+	}
+
+	if c.MinWeight < 0 {
+		add("MIN_WEIGHT: must not be negative")
+	}
+	if c.MaxWeight <= c.MinWeight {
+		add("MAX_WEIGHT: must be greater than MIN_WEIGHT")
+	}
+	if c.WeightFilter != WeightFilterNone && c.WeightFilter != WeightFilterMedian && c.WeightFilter != WeightFilterEma {
+		add("WEIGHT_FILTER: %q is not supported, use median, ema or leave it empty", c.WeightFilter)
+	}
+	if c.WeightFilterWindow < 1 || c.WeightFilterWindow > 60 {
+		add("WEIGHT_FILTER_WINDOW: must be between 1 and 60")
+	}
+	if c.WeightMaxDelta < 0 {
+		add("WEIGHT_MAX_DELTA: must not be negative")
+	}
+
+	if c.MetricMaxSeries < 1 {
+		add("METRIC_MAX_SERIES: must be at least 1")
+	}
+	if c.MetricsPushUrl != "" {
+		if u, err := url.Parse(c.MetricsPushUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			add("METRICS_PUSH_URL: %q is not a http(s) url", c.MetricsPushUrl)
+		}
+		if c.MetricsPushMode != MetricsPushRemoteWrite && c.MetricsPushMode != MetricsPushGateway {
+			add("METRICS_PUSH_MODE: %q is not supported, use %s or %s", c.MetricsPushMode, MetricsPushRemoteWrite, MetricsPushGateway)
+		}
+		if c.MetricsPushInterval < time.Second {
+			add("METRICS_PUSH_INTERVAL: must be at least 1s")
+		}
+		if c.MetricsPushJob == "" {
+			add("METRICS_PUSH_JOB: must not be empty")
+		}
+		if c.MetricsPushUsername != "" && c.MetricsPushPassword == "" {
+			add("METRICS_PUSH_PASSWORD: required by METRICS_PUSH_USERNAME")
+		}
+	}
+	if c.RatingRateLimit < 1 {
+		add("RATING_RATE_LIMIT: must be at least 1")
+	}
+	if c.HolidayCalendar != "cz" && c.HolidayCalendar != "none" {
+		add("HOLIDAY_CALENDAR: %q is not supported, use cz or none", c.HolidayCalendar)
+	}
+	for day := range c.Holidays {
+		if _, err := time.Parse(time.DateOnly, day); err != nil {
+			add("HOLIDAYS: %q is not a YYYY-MM-DD date", day)
+		}
+	}
+
+	errs = append(errs, validateKegCatalog(c.KegGuessTolerance)...)
+
+	errs = append(errs, c.pubProblems()...)
+
+	return errs
+}
+
+// pubProblems returns problems of the hosted pubs, a pub must not accept tokens of another one
+func (c *Config) pubProblems() []error {
+	if len(c.Pubs) == 0 {
+		return nil
+	}
+	var errs []error
+	if !deviceIdPattern.MatchString(c.DefaultPub) || slices.Contains(c.Pubs, c.DefaultPub) {
+		errs = append(errs, fmt.Errorf("DEFAULT_PUB: %q is not a valid pub name or is listed in PUBS", c.DefaultPub))
+	}
+
+	owners := map[string]string{c.AuthToken: "the default pub", c.Password: "the default pub"}
+	for _, pub := range c.Pubs {
+		config, found := c.PubConfigs[pub]
+		if !found {
+			continue
+		}
+		for _, err := range config.problems() {
+			errs = append(errs, fmt.Errorf("pub %s: %w", pub, err))
+		}
+		tokens := []struct{ key, value string }{{"AUTH_TOKEN", config.AuthToken}, {"PASSWORD", config.Password}}
+		for _, token := range tokens {
+			if token.value == "" {
+				continue
+			}
+			if owner, found := owners[token.value]; found {
+				errs = append(errs, fmt.Errorf("%s: must differ from the tokens of %s", pubEnvKey(pub, token.key), owner))
+			}
+			owners[token.value] = "the pub " + pub
+		}
+	}
+
+	return errs
+}
+
+// validateKegCatalog checks that keg sizes can be told apart by weight
+// and that every keg has its place in the warehouse
+func validateKegCatalog(tolerance float64) []error {
+	var errs []error
+	full := GetFullWeights()
+
+	sizes := make([]int, 0, len(full))
+	for keg := range full {
+		sizes = append(sizes, keg)
+	}
+	sort.Ints(sizes)
+
+	for i, keg := range sizes {
+		if _, err := GetWarehouseIndex(keg); err != nil {
+			errs = append(errs, fmt.Errorf("keg catalog: %dl keg has no warehouse slot", keg))
+		}
+		if i > 0 && math.Abs(full[keg]-full[sizes[i-1]]) < 2*tolerance {
+			errs = append(errs, fmt.Errorf("keg catalog: full %dl and %dl kegs are too close to be recognized", sizes[i-1], keg))
+		}
+	}
+
+	return errs
+}
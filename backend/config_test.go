@@ -0,0 +1,264 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_ValidateDefaults(t *testing.T) {
+	assert.Nil(t, NewConfig().Validate())
+}
+
+func TestConfig_ValidateReportsAllErrors(t *testing.T) {
+	t.Setenv("REDIS_ADDR", "localhost")
+	t.Setenv("AUTH_TOKEN", "")
+	t.Setenv("EXPORT_HOUR", "25")
+	t.Setenv("GLASS_SIZE", "half a liter")
+
+	err := NewConfig().Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "REDIS_ADDR")
+	assert.Contains(t, err.Error(), "AUTH_TOKEN")
+	assert.Contains(t, err.Error(), "EXPORT_HOUR")
+	assert.Contains(t, err.Error(), "GLASS_SIZE")
+}
+
+func TestConfig_RedisPrefix(t *testing.T) {
+	t.Setenv("REDIS_PREFIX", "staging:")
+	assert.Nil(t, NewConfig().Validate())
+
+	t.Setenv("REDIS_PREFIX", "prod*")
+	assert.ErrorContains(t, NewConfig().Validate(), "REDIS_PREFIX")
+}
+
+func TestConfig_WeightFilter(t *testing.T) {
+	t.Setenv("WEIGHT_FILTER", "median")
+	t.Setenv("WEIGHT_MAX_DELTA", "3000")
+	assert.Nil(t, NewConfig().Validate())
+
+	t.Setenv("MIN_WEIGHT", "70000")
+	assert.ErrorContains(t, NewConfig().Validate(), "MAX_WEIGHT")
+	t.Setenv("MIN_WEIGHT", "3000")
+
+	t.Setenv("WEIGHT_FILTER", "kalman")
+	assert.ErrorContains(t, NewConfig().Validate(), "WEIGHT_FILTER")
+
+	t.Setenv("WEIGHT_FILTER", "ema")
+	t.Setenv("WEIGHT_FILTER_WINDOW", "0")
+	assert.ErrorContains(t, NewConfig().Validate(), "WEIGHT_FILTER_WINDOW")
+}
+
+func TestConfig_SecretFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	assert.Nil(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+
+	t.Setenv("PASSWORD", "from-env")
+	t.Setenv("PASSWORD_FILE", path)
+
+	config := NewConfig()
+	assert.Equal(t, "from-file", config.Password)
+	assert.Nil(t, config.Validate())
+
+	t.Setenv("PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	assert.NotNil(t, NewConfig().Validate())
+}
+
+func TestConfig_IngestAllowlist(t *testing.T) {
+	t.Setenv("INGEST_ALLOWLIST", "192.0.2.10, 10.0.0.0/8")
+
+	config := NewConfig()
+	assert.Nil(t, config.Validate())
+	assert.Len(t, config.IngestAllowlist, 2)
+	assert.True(t, config.IngestAllowlist[0].Contains(net.ParseIP("192.0.2.10")))
+	assert.False(t, config.IngestAllowlist[0].Contains(net.ParseIP("192.0.2.11")))
+	assert.True(t, config.IngestAllowlist[1].Contains(net.ParseIP("10.1.2.3")))
+
+	t.Setenv("INGEST_ALLOWLIST", "10.0.0.0/33")
+	assert.NotNil(t, NewConfig().Validate())
+}
+
+func TestConfig_ScaleDevices(t *testing.T) {
+	t.Setenv("SCALE_DEVICES", "tap2, tap3")
+
+	config := NewConfig()
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, []string{"tap2", "tap3"}, config.ScaleDevices)
+
+	t.Setenv("SCALE_DEVICES", "tap2,tap2,2tap")
+	err := NewConfig().Validate()
+	assert.ErrorContains(t, err, "listed twice")
+	assert.ErrorContains(t, err, "not a valid device id")
+
+	t.Setenv("SCALE_DEVICES", "tap2")
+	t.Setenv("STORAGE_DRIVER", "sqlite")
+	assert.ErrorContains(t, NewConfig().Validate(), "only by redis and memory")
+}
+
+func TestConfig_ScaleSecrets(t *testing.T) {
+	t.Setenv("SCALE_DEVICES", "tap2")
+	t.Setenv("SCALE_SECRETS", "default=0123456789abcdef,tap2=fedcba9876543210")
+	t.Setenv("SCALE_TOKEN_AUTH", "false")
+	assert.Nil(t, NewConfig().Validate())
+
+	t.Setenv("SCALE_SECRETS", "tap3=short")
+	err := NewConfig().Validate()
+	assert.ErrorContains(t, err, "listed in SCALE_DEVICES")
+	assert.ErrorContains(t, err, "at least 16 characters")
+
+	t.Setenv("SCALE_SECRETS", "")
+	assert.ErrorContains(t, NewConfig().Validate(), "scale could not authenticate")
+
+	// gateways send no signatures
+	t.Setenv("SCALE_SECRETS", "default=0123456789abcdef")
+	t.Setenv("GRPC_PORT", "9090")
+	assert.ErrorContains(t, NewConfig().Validate(), "GRPC_PORT: gateways could not authenticate without tokens")
+	t.Setenv("GRPC_TLS", "true")
+	assert.ErrorContains(t, NewConfig().Validate(), "INGEST_TLS_CERT: is required when GRPC_TLS is set")
+}
+
+func TestConfig_GlassFor(t *testing.T) {
+	t.Setenv("BEER_GLASSES", "Weizen=450, ipa=480")
+
+	config := NewConfig()
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, 450.0, config.GlassFor("weizen"))
+	assert.Equal(t, 480.0, config.GlassFor(" IPA "))
+	assert.Equal(t, 500.0, config.GlassFor("Pilsner"))
+
+	t.Setenv("BEER_GLASSES", "ipa=half")
+	assert.NotNil(t, NewConfig().Validate())
+}
+
+func TestConfig_Profile(t *testing.T) {
+	assert.NotNil(t, UseProfile("production"))
+
+	assert.Nil(t, UseProfile("dev"))
+	defer func() { _ = UseProfile("") }()
+
+	t.Setenv("LOG_LEVEL", "warn") // environment overrides the profile
+
+	config := NewConfig()
+	assert.Equal(t, "memory", config.StorageDriver)
+	assert.Equal(t, "text", config.LogFormat)
+	assert.Equal(t, "warn", config.LogLevel)
+	assert.True(t, config.DryRun)
+	assert.Nil(t, config.Validate())
+
+	assert.Nil(t, UseProfile(""))
+	assert.Equal(t, "redis", NewConfig().StorageDriver)
+}
+
+func TestConfig_Community(t *testing.T) {
+	t.Setenv("COMMUNITY_URL", "https://community.example.com")
+	assert.ErrorContains(t, NewConfig().Validate(), "COMMUNITY_TOKEN")
+
+	t.Setenv("COMMUNITY_TOKEN", "secret")
+	assert.Nil(t, NewConfig().Validate())
+
+	t.Setenv("COMMUNITY_URL", "community.example.com")
+	assert.ErrorContains(t, NewConfig().Validate(), "COMMUNITY_URL")
+}
+
+func TestConfig_ClosingSoon(t *testing.T) {
+	t.Setenv("CLOSING_SOON_WEBHOOK", "https://lights.example.com/last-call")
+	assert.ErrorContains(t, NewConfig().Validate(), "CLOSING_SOON_HOUR")
+
+	t.Setenv("CLOSING_SOON_HOUR", "22")
+	assert.Nil(t, NewConfig().Validate())
+
+	t.Setenv("CLOSING_SOON_HOUR", "24")
+	assert.ErrorContains(t, NewConfig().Validate(), "CLOSING_SOON_HOUR")
+}
+
+func TestConfig_StorageKey(t *testing.T) {
+	t.Setenv("STORAGE_KEY", "abc")
+	assert.ErrorContains(t, NewConfig().Validate(), "STORAGE_KEY")
+
+	t.Setenv("STORAGE_KEY", testStorageKey)
+	assert.Nil(t, NewConfig().Validate())
+
+	t.Setenv("STORAGE_DRIVER", "sqlite")
+	assert.ErrorContains(t, NewConfig().Validate(), "STORAGE_KEY: measurements are encrypted only by redis storage")
+}
+
+func TestConfig_ApiTokens(t *testing.T) {
+	t.Setenv("API_TOKENS", "frontend=read-only:f1f2f3, tap=device-ingest:t1t2t3")
+	config := NewConfig()
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, ApiToken{Scope: ScopeReadOnly, Token: "f1f2f3"}, config.ApiTokens["frontend"])
+
+	t.Setenv("API_TOKENS", "frontend=reader:f1f2f3")
+	assert.ErrorContains(t, NewConfig().Validate(), "unknown scope")
+
+	t.Setenv("API_TOKENS", "frontend=read-only:")
+	assert.ErrorContains(t, NewConfig().Validate(), "token frontend is empty")
+
+	t.Setenv("API_TOKENS", "frontend=read-only:test")
+	assert.ErrorContains(t, NewConfig().Validate(), "must differ from AUTH_TOKEN and PASSWORD")
+
+	t.Setenv("API_TOKENS", "a=read-only:same,b=admin:same")
+	assert.ErrorContains(t, NewConfig().Validate(), "tokens a and b are the same")
+}
+
+func TestConfig_Firmware(t *testing.T) {
+	t.Setenv("FIRMWARE_VERSION", "1.2.0")
+	assert.ErrorContains(t, NewConfig().Validate(), "FIRMWARE_URL")
+
+	t.Setenv("FIRMWARE_URL", "https://example.com/scale-1.2.0.bin")
+	t.Setenv("FIRMWARE_SHA256", "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08")
+	assert.Nil(t, NewConfig().Validate(), "checksum is case insensitive")
+
+	t.Setenv("FIRMWARE_VERSION", "1.2")
+	assert.ErrorContains(t, NewConfig().Validate(), "FIRMWARE_VERSION")
+}
+
+func TestConfig_IngestLimits(t *testing.T) {
+	t.Setenv("INGEST_RATE_LIMIT", "0")
+	assert.Nil(t, NewConfig().Validate(), "0 disables the limit")
+
+	t.Setenv("INGEST_DEVICE_RATE_LIMIT", "-1")
+	assert.ErrorContains(t, NewConfig().Validate(), "INGEST_DEVICE_RATE_LIMIT")
+	t.Setenv("INGEST_DEVICE_RATE_LIMIT", "60")
+
+	t.Setenv("INGEST_MAX_BODY", "10")
+	assert.ErrorContains(t, NewConfig().Validate(), "INGEST_MAX_BODY")
+}
+
+func TestConfig_Display(t *testing.T) {
+	t.Setenv("TIMEZONE", "Mars/Olympus")
+	t.Setenv("WEIGHT_UNIT", "oz")
+	err := NewConfig().Validate()
+	assert.ErrorContains(t, err, "TIMEZONE")
+	assert.ErrorContains(t, err, "WEIGHT_UNIT")
+
+	t.Setenv("TIMEZONE", "Europe/London")
+	t.Setenv("WEIGHT_UNIT", "l")
+	t.Setenv("DATE_FORMAT", "02.01.2006 15:04")
+	config := NewConfig()
+	assert.Nil(t, config.Validate())
+
+	saved := display
+	defer func() { display = saved }()
+	setDisplay(config)
+	assert.Equal(t, "10.05.2024 21:30", formatDate(time.Date(2024, 5, 10, 20, 30, 0, 0, time.UTC)))
+	assert.Equal(t, "21:30", formatTime(time.Date(2024, 5, 10, 20, 30, 0, 0, time.UTC)))
+}
+
+func TestConfig_Webhooks(t *testing.T) {
+	t.Setenv("WEBHOOK_URLS", "https://pos.example.com/scale,ftp://signage")
+	t.Setenv("WEBHOOK_EVENTS", "pour,keg_empty")
+	err := NewConfig().Validate()
+	assert.ErrorContains(t, err, `WEBHOOK_URLS: "ftp://signage"`)
+	assert.ErrorContains(t, err, "WEBHOOK_SECRET")
+	assert.ErrorContains(t, err, `WEBHOOK_EVENTS: unknown event type "keg_empty"`)
+
+	t.Setenv("WEBHOOK_URLS", "https://pos.example.com/scale")
+	t.Setenv("WEBHOOK_EVENTS", "pour,keg_low")
+	t.Setenv("WEBHOOK_SECRET", "s3cret")
+	assert.Nil(t, NewConfig().Validate())
+}
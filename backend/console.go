@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Admin console is a WebSocket channel for a low-latency admin panel.
+// The client sends commands and receives an acknowledgement of each of them
+// together with all scale events.
+//
+//	-> {"id": "1", "command": "auth", "args": {"password": "..."}}
+//	<- {"type": "ack", "id": "1", "ok": true}
+//	-> {"id": "2", "command": "set_keg", "args": {"keg": 50, "beer": "Pilsner"}}
+//	<- {"type": "ack", "id": "2", "ok": true, "data": {...status...}}
+//	<- {"type": "event", "event": {...}}
+//
+// Browsers can't send the Authorization header with WebSocket, so the connection is authenticated
+// by the header or by the auth command which has to be sent within [consoleAuthTimeout].
+
+const consoleAuthTimeout = 10 * time.Second
+
+// ConsoleCommand is a command sent by the admin client
+type ConsoleCommand struct {
+	Id      string          `json:"id"` // echoed in the acknowledgement
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args"`
+}
+
+// ConsoleMessage is sent to the admin client
+type ConsoleMessage struct {
+	Type  string `json:"type"` // ack or event
+	Id    string `json:"id,omitempty"`
+	Ok    bool   `json:"ok,omitempty"`
+	Error string `json:"error,omitempty"`
+	Data  any    `json:"data,omitempty"`
+	Event *Event `json:"event,omitempty"`
+}
+
+// Console executes commands of a single admin connection
+type Console struct {
+	hr            *HandlerRepository
+	authenticated bool
+}
+
+// Execute runs the command and returns its acknowledgement
+func (c *Console) Execute(raw []byte) ConsoleMessage {
+	var cmd ConsoleCommand
+	if err := json.Unmarshal(raw, &cmd); err != nil {
+		return ConsoleMessage{Type: "ack", Error: "invalid command format"}
+	}
+
+	data, err := c.execute(cmd)
+	if err != nil {
+		return ConsoleMessage{Type: "ack", Id: cmd.Id, Error: err.Error()}
+	}
+
+	return ConsoleMessage{Type: "ack", Id: cmd.Id, Ok: true, Data: data}
+}
+
+func (c *Console) execute(cmd ConsoleCommand) (any, error) {
+	if cmd.Command == "auth" {
+		var args struct {
+			Password string `json:"password"`
+		}
+		if err := c.args(cmd, &args); err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare([]byte(args.Password), []byte(c.hr.config.Password)) != 1 {
+			return nil, fmt.Errorf("unauthorized")
+		}
+		c.authenticated = true
+		return nil, nil
+	}
+
+	if !c.authenticated {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	scale := c.hr.scale
+	switch cmd.Command {
+	case "status":
+		// nothing to do, status is returned
+	case "set_keg":
+		var args activeKegInput
+		if err := c.args(cmd, &args); err != nil {
+			return nil, err
+		}
+		if scale.IsDegraded() {
+			return nil, fmt.Errorf("storage unavailable")
+		}
+		if _, err := c.hr.setActiveKeg(args); err != nil {
+			return nil, err
+		}
+	case "pub":
+		var args struct {
+			Open     bool   `json:"open"`
+			Duration string `json:"duration"` // empty removes the override
+		}
+		if err := c.args(cmd, &args); err != nil {
+			return nil, err
+		}
+		var duration time.Duration
+		if args.Duration != "" {
+			parsed, err := time.ParseDuration(args.Duration)
+			if err != nil || parsed <= 0 || parsed > 7*24*time.Hour {
+				return nil, fmt.Errorf("invalid duration")
+			}
+			duration = parsed
+		}
+		scale.SetPubOverride(args.Open, duration)
+	case "recheck":
+		scale.checkStore()
+		scale.Recheck()
+	default:
+		return nil, fmt.Errorf("unknown command %q", cmd.Command)
+	}
+
+	return scale.Status(), nil
+}
+
+func (c *Console) args(cmd ConsoleCommand, v any) error {
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(cmd.Args, v); err != nil {
+		return fmt.Errorf("invalid args: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsole_Execute(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	s.config.Password = "secret"
+	c := &Console{hr: &HandlerRepository{scale: s, config: s.config, logger: s.logger}}
+
+	ack := c.Execute([]byte(`{"id": "1", "command": "status"}`))
+	assert.Equal(t, ConsoleMessage{Type: "ack", Id: "1", Error: "unauthorized"}, ack)
+	ack = c.Execute([]byte(`{"id": "2", "command": "auth", "args": {"password": "wrong"}}`))
+	assert.False(t, ack.Ok)
+	ack = c.Execute([]byte(`{"id": "3", "command": "auth", "args": {"password": "secret"}}`))
+	assert.True(t, ack.Ok)
+
+	ack = c.Execute([]byte(`{"id": "4", "command": "set_keg", "args": {"keg": 30, "beer": "Bernard"}}`))
+	assert.True(t, ack.Ok, ack.Error)
+	assert.Equal(t, 30, ack.Data.(ScaleStatus).ActiveKeg)
+	ack = c.Execute([]byte(`{"id": "5", "command": "set_keg", "args": {"keg": 40}}`))
+	assert.Equal(t, "Invalid keg size", ack.Error)
+
+	ack = c.Execute([]byte(`{"id": "6", "command": "pub", "args": {"open": false, "duration": "1h"}}`))
+	assert.True(t, ack.Ok, ack.Error)
+	assert.False(t, ack.Data.(ScaleStatus).Pub.IsOpen)
+	ack = c.Execute([]byte(`{"id": "7", "command": "pub", "args": {"duration": "forever"}}`))
+	assert.Equal(t, "invalid duration", ack.Error)
+
+	ack = c.Execute([]byte(`{"id": "8", "command": "recheck"}`))
+	assert.True(t, ack.Ok)
+	ack = c.Execute([]byte(`{"id": "9", "command": "reboot"}`))
+	assert.Equal(t, `unknown command "reboot"`, ack.Error)
+	ack = c.Execute([]byte(`not json`))
+	assert.Equal(t, "invalid command format", ack.Error)
+}
+
+// writeMaskedText sends a text frame as a browser does
+func writeMaskedText(t *testing.T, conn net.Conn, payload string) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | wsOpText, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	assert.Nil(t, err)
+}
+
+func TestAdminSocket(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	s.config.Password = "secret"
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+	server := httptest.NewServer(hr.requestLogger(http.HandlerFunc(hr.adminSocketHandler())))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte("GET /ws/admin HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+	assert.Nil(t, err)
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+
+	var message ConsoleMessage
+	writeMaskedText(t, conn, `{"id": "1", "command": "auth", "args": {"password": "secret"}}`)
+	assert.Nil(t, json.Unmarshal(readTextFrame(t, reader), &message))
+	assert.Equal(t, ConsoleMessage{Type: "ack", Id: "1", Ok: true}, message)
+
+	writeMaskedText(t, conn, `{"id": "2", "command": "pub", "args": {"open": true, "duration": "2h"}}`)
+	types := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		message = ConsoleMessage{}
+		assert.Nil(t, json.Unmarshal(readTextFrame(t, reader), &message))
+		types[message.Type] = true
+	}
+	assert.Equal(t, map[string]bool{"ack": true, "event": true}, types, "ack and pub_open event")
+}
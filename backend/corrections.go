@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var errMeasurementNotFound = errors.New("measurement not found")
+
+// MeasurementId identifies the measurement of the scale by its time in unix milliseconds,
+// the time is the key of measurements in every storage
+func MeasurementId(at time.Time) string {
+	return strconv.FormatInt(at.UnixMilli(), 10)
+}
+
+// parseMeasurementId returns the time of the measurement, see [MeasurementId]
+func parseMeasurementId(id string) (time.Time, error) {
+	millis, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || millis <= 0 {
+		return time.Time{}, fmt.Errorf("invalid measurement id %q", id)
+	}
+
+	return time.UnixMilli(millis), nil
+}
+
+// MeasurementCorrection describes the deleted or corrected measurement and what was recomputed
+type MeasurementCorrection struct {
+	Measurement  Measurement `json:"measurement"`   // the original measurement
+	Corrected    *float64    `json:"corrected"`     // grams, nil when the measurement was deleted
+	RemovedPours []Pour      `json:"removed_pours"` // pours detected from the measurement, they are subtracted from their keg
+	Current      bool        `json:"current"`       // the latest measurement was edited, the current weight and beers left were recomputed
+}
+
+// DeleteMeasurement deletes the measurement at the time, e.g. a cleaning bucket put on the scale
+func (s *Scale) DeleteMeasurement(at time.Time) (MeasurementCorrection, error) {
+	return s.editMeasurement(at, nil)
+}
+
+// CorrectMeasurement replaces the weight of the measurement at the time, the original weight is kept as raw
+func (s *Scale) CorrectMeasurement(at time.Time, weight float64) (MeasurementCorrection, error) {
+	return s.editMeasurement(at, &weight)
+}
+
+func (s *Scale) editMeasurement(at time.Time, weight *float64) (MeasurementCorrection, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	at = time.UnixMilli(at.UnixMilli())
+	measurements, err := s.store.GetMeasurements(at, at.Add(time.Millisecond))
+	if err != nil {
+		return MeasurementCorrection{}, fmt.Errorf("could not load measurement: %w", err)
+	}
+	if len(measurements) == 0 {
+		return MeasurementCorrection{}, errMeasurementNotFound
+	}
+	original := measurements[0]
+
+	if _, err := s.store.DeleteMeasurements(at, at.Add(time.Millisecond)); err != nil {
+		return MeasurementCorrection{}, fmt.Errorf("could not delete measurement: %w", err)
+	}
+	if weight != nil {
+		corrected := original
+		corrected.Weight = *weight
+		corrected.Source = SourceManual
+		if corrected.Raw == 0 {
+			corrected.Raw = original.Weight
+		}
+		if err := s.store.AddMeasurement(corrected); err != nil {
+			return MeasurementCorrection{}, fmt.Errorf("could not store corrected measurement: %w", err)
+		}
+	}
+
+	correction := MeasurementCorrection{Measurement: original, Corrected: weight, RemovedPours: []Pour{}}
+	if correction.RemovedPours, err = s.removePoursOf(at); err != nil {
+		return correction, err
+	}
+	if at.UnixMilli() == s.WeightAt.UnixMilli() {
+		correction.Current = true
+		if err := s.recomputeCurrent(at); err != nil {
+			return correction, err
+		}
+	}
+
+	s.logger.Infof("Measurement of %.0f g at %s edited, %d pours removed", original.Weight, formatDate(at), len(correction.RemovedPours))
+	return correction, nil
+}
+
+// removePoursOf deletes pours of the scale in progress at the time and subtracts them from their kegs
+// pours of other taps share the history, they are recognized by kegs of the scale
+// caller has to hold the lock
+func (s *Scale) removePoursOf(at time.Time) ([]Pour, error) {
+	pours, err := s.store.GetPours(at, at.Add(24*time.Hour))
+	if err != nil {
+		return nil, fmt.Errorf("could not load pours: %w", err)
+	}
+
+	removed := []Pour{}
+	for _, pour := range pours {
+		if pour.StartedAt.After(at) {
+			continue
+		}
+
+		keg := s.KegInfo
+		if pour.KegId != keg.Id {
+			if keg, err = s.store.GetKeg(pour.KegId); err != nil {
+				continue // keg of another tap
+			}
+		}
+		keg.Pours--
+		keg.PouredGrams -= pour.Grams
+		keg.Beers -= pour.Glasses
+
+		if err := s.store.DeletePour(pour); err != nil {
+			return removed, fmt.Errorf("could not delete pour: %w", err)
+		}
+		if keg.Id == s.KegInfo.Id {
+			s.KegInfo = keg
+			s.storeFailed(s.saveKegInfo(), "keg")
+		} else if err := s.store.SaveKeg(keg); err != nil {
+			return removed, fmt.Errorf("could not store keg: %w", err)
+		}
+		removed = append(removed, pour)
+	}
+
+	if len(removed) > 0 {
+		s.updateKegEta(time.Now())
+	}
+
+	return removed, nil
+}
+
+// recomputeCurrent takes the latest stored measurement up to the edited one as the current weight
+// beers left and low keg are derived from it again, the pour tracker starts from the new baseline
+// caller has to hold the lock
+func (s *Scale) recomputeCurrent(at time.Time) error {
+	measurements, err := s.store.GetMeasurements(at.Add(-24*time.Hour), at.Add(time.Millisecond))
+	if err != nil {
+		return fmt.Errorf("could not load measurements: %w", err)
+	}
+	if len(measurements) == 0 {
+		s.logger.Warnf("No measurement within a day before the deleted one, the current weight %.0f g is kept", s.Weight)
+		return nil
+	}
+	latest := measurements[len(measurements)-1]
+
+	s.Weight = latest.Weight
+	s.WeightAt = latest.At
+	s.storeFailed(s.store.SetWeight(s.Weight), "weight")
+	s.storeFailed(s.store.SetWeightAt(s.WeightAt), "weight_at")
+	s.pours.Reset()
+
+	tare, found := s.tare()
+	if found {
+		s.IsLow = IsKegLowFromTare(tare, s.Weight)
+	} else {
+		s.IsLow = IsKegLow(s.ActiveKeg, s.Weight)
+	}
+	s.storeFailed(s.store.SetIsLow(s.IsLow), "is_low")
+
+	s.KegInfo.EndWeight = s.Weight
+	s.BeersLeft = CalcBeersLeftFromTare(tare, s.Weight, s.config.GlassFor(s.KegInfo.Beer))
+	s.storeFailed(s.store.SetBeersLeft(s.BeersLeft), "beers_left")
+
+	s.monitor.weight.WithLabelValues().Set(s.Weight)
+	s.monitor.beersLeft.WithLabelValues().Set(float64(s.BeersLeft))
+	s.events.Publish(StateChangeEventType, StateChangeEvent{Reason: "measurement", Weight: s.Weight})
+
+	return nil
+}
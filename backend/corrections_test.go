@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScale_EditMeasurement(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	hr := &HandlerRepository{scale: s, config: s.config, monitor: s.monitor, logger: s.logger}
+	router := NewRouter(hr)
+	edit := func(method, id, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/measurements/"+id, strings.NewReader(body))
+		r.Header.Set("Authorization", "test")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	// a cleaning bucket put on the full keg and lifted looks like a huge pour
+	now := time.Now().Truncate(time.Second)
+	bucket := now.Add(-3 * time.Minute)
+	s.WeightAt = now.Add(-time.Hour)
+	_, _, err := s.AddBufferedMeasurements([]Measurement{
+		{Weight: 22000, At: now.Add(-4 * time.Minute)},
+		{Weight: 32000, At: bucket},
+		{Weight: 21800, At: now.Add(-2 * time.Minute)},
+		{Weight: 21800, At: now.Add(-time.Minute)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, s.KegInfo.Pours)
+
+	w := edit(http.MethodDelete, MeasurementId(bucket), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var correction MeasurementCorrection
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &correction))
+	assert.Equal(t, 32000.0, correction.Measurement.Weight)
+	assert.Nil(t, correction.Corrected)
+	assert.Len(t, correction.RemovedPours, 1)
+	assert.False(t, correction.Current)
+	assert.Equal(t, 0, s.KegInfo.Pours)
+	assert.Equal(t, 0.0, s.KegInfo.Beers)
+	pours, _ := s.store.GetPours(time.Unix(0, 0), now)
+	assert.Empty(t, pours)
+	assert.Equal(t, http.StatusNotFound, edit(http.MethodDelete, MeasurementId(bucket), "").Code)
+
+	// the latest measurement recomputes the current state
+	w = edit(http.MethodPatch, MeasurementId(now.Add(-time.Minute)), `{"weight": 17000}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 17000.0, s.Weight)
+	assert.Equal(t, 20, s.BeersLeft, "15 l keg with 10 kg of beer")
+	measurements, _ := s.store.GetMeasurements(now.Add(-time.Minute), now)
+	assert.Equal(t, Measurement{Weight: 17000, At: now.Add(-time.Minute), Source: SourceManual, Raw: 21800}, measurements[0])
+
+	assert.Equal(t, http.StatusOK, edit(http.MethodDelete, MeasurementId(now.Add(-time.Minute)), "").Code)
+	assert.Equal(t, 21800.0, s.Weight)
+	assert.Equal(t, now.Add(-2*time.Minute), s.WeightAt)
+
+	assert.Equal(t, http.StatusBadRequest, edit(http.MethodPatch, MeasurementId(now.Add(-2*time.Minute)), `{"weight": 900000}`).Code)
+	assert.Equal(t, http.StatusBadRequest, edit(http.MethodPatch, MeasurementId(now.Add(-2*time.Minute)), `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, edit(http.MethodDelete, "yesterday", "").Code)
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/measurements/"+MeasurementId(now.Add(-2*time.Minute)), nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
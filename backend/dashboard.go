@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// optional sections of the dashboard, ?include=keg,session,forecast,device
+// every widget of the frontend fetches exactly what it shows in one round trip
+const (
+	IncludeKeg      = "keg"
+	IncludeSession  = "session"
+	IncludeForecast = "forecast"
+	IncludeDevice   = "device"
+)
+
+// dashboardIncludes holds the requested sections
+type dashboardIncludes map[string]bool
+
+// parseDashboardIncludes parses comma separated sections, empty value includes none of them
+func parseDashboardIncludes(raw string) (dashboardIncludes, error) {
+	includes := dashboardIncludes{}
+	for _, section := range strings.Split(raw, ",") {
+		section = strings.TrimSpace(section)
+		switch section {
+		case "":
+		case IncludeKeg, IncludeSession, IncludeForecast, IncludeDevice:
+			includes[section] = true
+		default:
+			return nil, fmt.Errorf("unknown section %q", section)
+		}
+	}
+
+	return includes, nil
+}
+
+// DashboardSession is the current opening of the pub
+type DashboardSession struct {
+	IsOpen       bool      `json:"is_open"`
+	OpenedAt     time.Time `json:"opened_at"`
+	Tag          string    `json:"tag"`    // set by the admin, e.g. birthday
+	Liters       float64   `json:"liters"` // consumed since the pub opened, zero while closed
+	Beers        float64   `json:"beers"`
+	PoursPerHour int       `json:"pours_per_hour"`
+}
+
+// KegForecast estimates when the active keg runs out
+type KegForecast struct {
+	BeersLeft int        `json:"beers_left"`
+	HoursLeft *float64   `json:"hours_left"` // at the pour rate of the last hour, nil without pours
+	DaysLeft  *float64   `json:"days_left"`  // at the average consumption since the keg was tapped, nil if it's unknown yet
+	EmptyAt   *time.Time `json:"empty_at"`   // by [KegForecast.DaysLeft]
+}
+
+// DashboardDevice is the health of the scale itself
+type DashboardDevice struct {
+	Rssi     float64   `json:"rssi"`
+	LastOk   time.Time `json:"last_ok"`
+	Activity Activity  `json:"activity"`
+	Sensors
+	ShadowInSync bool              `json:"shadow_in_sync"`
+	ShadowDelta  map[string]string `json:"shadow_delta"` // desired config not applied by the device yet
+	Calibrated   bool              `json:"calibrated"`   // raw counts are converted by the server
+}
+
+// minForecastTime is the time on tap needed to estimate the average consumption
+const minForecastTime = time.Hour
+
+// CalcKegForecast estimates the rest of the keg
+// remaining is grams of beer left in the keg, negative if the empty weight of the keg is unknown
+func CalcKegForecast(keg KegInfo, weight, remaining float64, beersLeft, poursPerHour int, now time.Time) KegForecast {
+	forecast := KegForecast{BeersLeft: beersLeft}
+
+	if poursPerHour > 0 {
+		hours := math.Round(float64(beersLeft)/float64(poursPerHour)*10) / 10
+		forecast.HoursLeft = &hours
+	}
+
+	onTap := keg.OnTap(now)
+	consumed := keg.StartWeight - weight
+	if keg.TappedAt.IsZero() || onTap < minForecastTime || consumed <= 0 || remaining < 0 {
+		return forecast
+	}
+
+	perDay := consumed / onTap.Hours() * 24
+	days := math.Round(remaining/perDay*10) / 10
+	emptyAt := now.Add(time.Duration(remaining / perDay * 24 * float64(time.Hour)))
+	forecast.DaysLeft = &days
+	forecast.EmptyAt = &emptyAt
+
+	return forecast
+}
+
+// ActiveKegYield returns the yield of the active keg so far, nil if no keg is tapped
+func (s *Scale) ActiveKegYield() *KegYield {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.KegInfo.Id == "" {
+		return nil
+	}
+
+	yield := CalcKegYield(s.KegInfo, s.config.GlassFor(s.KegInfo.Beer), s.Weight, time.Now())
+	return &yield
+}
+
+// KegForecast returns the forecast of the active keg, nil if no keg is tapped
+func (s *Scale) KegForecast(now time.Time) *KegForecast {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.KegInfo.Id == "" {
+		return nil
+	}
+
+	remaining := -1.0
+	if tare, found := s.tare(); found {
+		remaining = math.Max(s.Weight-tare, 0)
+	}
+
+	forecast := CalcKegForecast(s.KegInfo, s.Weight, remaining, s.BeersLeft, s.pours.PoursPerHour(now), now)
+	return &forecast
+}
+
+// CurrentSession returns the current opening of the pub
+func (s *Scale) CurrentSession(now time.Time) (DashboardSession, error) {
+	s.mux.Lock()
+	session := DashboardSession{
+		IsOpen:       s.Pub.IsOpen,
+		OpenedAt:     s.Pub.OpenedAt,
+		PoursPerHour: s.pours.PoursPerHour(now),
+	}
+	glass := s.config.GlassFor(s.KegInfo.Beer)
+	s.mux.Unlock()
+
+	if !session.IsOpen {
+		return session, nil
+	}
+
+	measurements, err := s.store.GetMeasurements(session.OpenedAt, now)
+	if err != nil {
+		return session, fmt.Errorf("could not load measurements: %w", err)
+	}
+	summary := CalcDailySummary(session.OpenedAt, measurements, glass)
+	session.Liters, session.Beers = summary.Liters, summary.Beers
+
+	// the storage keeps milliseconds of the opening time
+	tags, err := s.store.GetSessionTags(session.OpenedAt.Add(-time.Second), session.OpenedAt.Add(time.Second))
+	if err != nil {
+		return session, fmt.Errorf("could not load session tags: %w", err)
+	}
+	if len(tags) > 0 {
+		session.Tag = tags[len(tags)-1].Tag
+	}
+
+	return session, nil
+}
+
+// Device returns the health of the scale
+func (s *Scale) Device(now time.Time) DashboardDevice {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return DashboardDevice{
+		Rssi:         s.Rssi,
+		LastOk:       s.LastOk,
+		Activity:     s.activity(now),
+		Sensors:      s.Sensors,
+		ShadowInSync: s.Shadow.InSync(),
+		ShadowDelta:  s.Shadow.Delta(),
+		Calibrated:   s.Calibration != nil,
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDashboardIncludes(t *testing.T) {
+	includes, err := parseDashboardIncludes("")
+	assert.Nil(t, err)
+	assert.Empty(t, includes)
+
+	includes, err = parseDashboardIncludes("keg, forecast,")
+	assert.Nil(t, err)
+	assert.Equal(t, dashboardIncludes{IncludeKeg: true, IncludeForecast: true}, includes)
+
+	_, err = parseDashboardIncludes("keg,weather")
+	assert.Error(t, err)
+}
+
+func TestCalcKegForecast(t *testing.T) {
+	now := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	keg := KegInfo{Size: 50, StartWeight: 60000, TappedAt: now.Add(-48 * time.Hour)}
+
+	// 20 kg consumed in two days, 30 kg left
+	forecast := CalcKegForecast(keg, 40000, 30000, 60, 12, now)
+	assert.Equal(t, 60, forecast.BeersLeft)
+	assert.Equal(t, 5.0, *forecast.HoursLeft)
+	assert.Equal(t, 3.0, *forecast.DaysLeft)
+	assert.Equal(t, now.Add(72*time.Hour), *forecast.EmptyAt)
+
+	forecast = CalcKegForecast(keg, 40000, -1, 60, 0, now)
+	assert.Nil(t, forecast.HoursLeft, "no pours in the last hour")
+	assert.Nil(t, forecast.DaysLeft, "unknown empty weight of the keg")
+	assert.Nil(t, forecast.EmptyAt)
+
+	keg.TappedAt = now.Add(-10 * time.Minute)
+	forecast = CalcKegForecast(keg, 59000, 49000, 98, 0, now)
+	assert.Nil(t, forecast.DaysLeft, "tapped just now")
+}
+
+func TestScaleDashboardHandler_Include(t *testing.T) {
+	s := CreateScaleWithMeasurements(22, 10)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+
+	get := func(query string) (int, map[string]json.RawMessage) {
+		w := httptest.NewRecorder()
+		hr.scaleDashboardHandler()(w, httptest.NewRequest(http.MethodGet, "/api/scale/dashboard"+query, nil))
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		var data map[string]json.RawMessage
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &data))
+		return w.Code, data
+	}
+
+	code, data := get("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, data, "keg")
+	assert.NotContains(t, data, "session")
+	assert.NotContains(t, data, "forecast")
+	assert.NotContains(t, data, "device")
+
+	code, data = get("?include=session,device")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, data, "keg")
+	assert.Contains(t, data, "session")
+	assert.Contains(t, data, "device")
+
+	var device DashboardDevice
+	assert.Nil(t, json.Unmarshal(data["device"], &device))
+	assert.Equal(t, s.Activity(), device.Activity)
+
+	s.mux.Lock()
+	assert.Nil(t, s.tapKeg(50, ""))
+	s.mux.Unlock()
+	code, data = get("?include=keg,forecast")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, data, "keg")
+	assert.Contains(t, data, "forecast")
+
+	code, _ = get("?include=everything")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// thresholds of the diagnostics, they are meant for people at the bar, not for alerting
+const (
+	diagnoseSlowStore = 500 * time.Millisecond // storage answering slower makes the pages slow
+	diagnoseClockSkew = 30 * time.Second       // device clock differing more stamps buffered measurements wrong
+	diagnoseWeakRssi  = -80.0                  // dBm, weaker signal drops messages
+)
+
+// FindingSeverity tells how urgent the finding is, the report takes the worst of them
+type FindingSeverity string
+
+const (
+	FindingOk       FindingSeverity = "ok"
+	FindingWarning  FindingSeverity = "warning"
+	FindingCritical FindingSeverity = "critical"
+)
+
+// findingRank orders the severities from the best to the worst
+var findingRank = map[FindingSeverity]int{FindingOk: 0, FindingWarning: 1, FindingCritical: 2}
+
+// DiagnoseFinding is the result of a single check in plain words with what to do about it
+type DiagnoseFinding struct {
+	Check    string          `json:"check"`
+	Severity FindingSeverity `json:"severity"`
+	Message  string          `json:"message"`
+	Action   string          `json:"action,omitempty"` // empty when nothing has to be done
+}
+
+// DiagnoseReport is the result of all checks, problems first
+type DiagnoseReport struct {
+	At       time.Time         `json:"at"`
+	Severity FindingSeverity   `json:"severity"`
+	Findings []DiagnoseFinding `json:"findings"`
+}
+
+// Text formats the report for reading on a phone, one finding per line followed by its action
+func (dr DiagnoseReport) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Diagnostics at %s: %s\n", dr.At.Format(time.DateTime), dr.Severity)
+	for _, finding := range dr.Findings {
+		fmt.Fprintf(&b, "[%s] %s: %s\n", strings.ToUpper(string(finding.Severity)), finding.Check, finding.Message)
+		if finding.Action != "" {
+			fmt.Fprintf(&b, "    -> %s\n", finding.Action)
+		}
+	}
+
+	return b.String()
+}
+
+// SetClockSkew records the difference of the device clock from the server clock
+// measured on signed messages, positive skew means the device is ahead
+func (s *Scale) SetClockSkew(skew time.Duration, at time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.clockSkew = skew
+	s.clockSkewAt = at
+}
+
+// ClockSkew returns the last measured skew of the device clock, false if no signed message arrived
+func (s *Scale) ClockSkew() (time.Duration, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.clockSkew, !s.clockSkewAt.IsZero()
+}
+
+// scaleTimestamp returns the sending time of the signed message
+func scaleTimestamp(r *http.Request) (time.Time, bool) {
+	unix, err := strconv.ParseInt(r.Header.Get(ScaleTimestampHeader), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(unix, 0), true
+}
+
+// diagnose runs the checks of the runbook, unlike [HandlerRepository.health] it explains
+// what is wrong and what to do, so the staff can fix the usual problems without a developer
+func (hr *HandlerRepository) diagnose(now time.Time) DiagnoseReport {
+	report := DiagnoseReport{At: now, Severity: FindingOk}
+	add := func(finding DiagnoseFinding) {
+		report.Findings = append(report.Findings, finding)
+		if findingRank[finding.Severity] > findingRank[report.Severity] {
+			report.Severity = finding.Severity
+		}
+	}
+
+	add(hr.diagnoseStore())
+	add(hr.diagnoseBuffer())
+
+	devices := []string{""}
+	if hr.scales != nil {
+		devices = hr.scales.Devices()
+	}
+	for _, device := range devices {
+		scale, _ := hr.scaleOf(device)
+		for _, finding := range diagnoseScale(scale, device, now, hr.config.SignatureMaxAge) {
+			add(finding)
+		}
+	}
+
+	for _, finding := range hr.diagnoseChannels() {
+		add(finding)
+	}
+
+	// the worst first, the order of checks is kept otherwise
+	findings := report.Findings
+	report.Findings = make([]DiagnoseFinding, 0, len(findings))
+	for rank := findingRank[FindingCritical]; rank >= 0; rank-- {
+		for _, finding := range findings {
+			if findingRank[finding.Severity] == rank {
+				report.Findings = append(report.Findings, finding)
+			}
+		}
+	}
+
+	return report
+}
+
+func (hr *HandlerRepository) diagnoseStore() DiagnoseFinding {
+	finding := DiagnoseFinding{Check: "storage", Severity: FindingOk}
+
+	started := time.Now()
+	err := hr.scale.store.Ping()
+	latency := time.Since(started)
+
+	switch {
+	case err != nil:
+		finding.Severity = FindingCritical
+		finding.Message = fmt.Sprintf("%s storage is unreachable: %v", hr.config.StorageDriver, err)
+		finding.Action = fmt.Sprintf("Check that the %s server is running and restart it, measurements are buffered meanwhile", hr.config.StorageDriver)
+	case latency > diagnoseSlowStore:
+		finding.Severity = FindingWarning
+		finding.Message = fmt.Sprintf("%s storage answers slowly (%s)", hr.config.StorageDriver, latency.Round(time.Millisecond))
+		finding.Action = "Check the load and the free disk space of the storage server"
+	default:
+		finding.Message = fmt.Sprintf("%s storage answers in %s", hr.config.StorageDriver, latency.Round(time.Millisecond))
+	}
+
+	return finding
+}
+
+func (hr *HandlerRepository) diagnoseBuffer() DiagnoseFinding {
+	finding := DiagnoseFinding{Check: "buffer", Severity: FindingOk, Message: "no writes are buffered"}
+
+	if hr.scale.IsDegraded() {
+		finding.Severity = FindingWarning
+		finding.Message = "storage is recovering from an outage, the state is kept in memory"
+		finding.Action = "Do not restart the server until the storage is back, the state would be lost"
+	}
+	if hr.wal == nil {
+		return finding
+	}
+
+	if pending := hr.wal.Pending(); pending > 0 {
+		finding.Severity = FindingWarning
+		finding.Message = fmt.Sprintf("%d writes are buffered in the write ahead log", pending)
+		finding.Action = "They are written when the storage is reachable again, fix the storage if they keep growing"
+	}
+
+	return finding
+}
+
+// diagnoseScale checks the last message, the signal and the clock of the device and the readings of the scale
+func diagnoseScale(scale *Scale, device string, now time.Time, signatureMaxAge time.Duration) []DiagnoseFinding {
+	name := "scale"
+	if device != "" {
+		name = "scale:" + device
+	}
+	status := scale.Status()
+
+	message := DiagnoseFinding{Check: name, Severity: FindingOk}
+	age := now.Sub(status.LastOk)
+	switch {
+	case age > OkLimit:
+		message.Severity = FindingWarning
+		message.Message = fmt.Sprintf("the last message arrived %s ago", age.Round(time.Second))
+		message.Action = "Check that the scale is powered and connected to the WiFi, restart it by unplugging it"
+		if status.Pub.IsOpen {
+			message.Severity = FindingCritical
+		}
+	case status.Rssi != 0 && status.Rssi < diagnoseWeakRssi:
+		message.Severity = FindingWarning
+		message.Message = fmt.Sprintf("the WiFi signal is weak (%.0f dBm)", status.Rssi)
+		message.Action = "Move the WiFi router or an extender closer to the scale"
+	default:
+		message.Message = fmt.Sprintf("the last message arrived %s ago", age.Round(time.Second))
+	}
+	findings := []DiagnoseFinding{message}
+
+	if skew, found := scale.ClockSkew(); found {
+		clock := DiagnoseFinding{Check: name + " clock", Severity: FindingOk, Message: fmt.Sprintf("the device clock differs by %s", skew.Round(time.Second))}
+		if skew.Abs() > diagnoseClockSkew {
+			clock.Severity = FindingWarning
+			clock.Action = "Check the time server (NTP) setting of the device and restart it"
+		}
+		if skew.Abs() > signatureMaxAge/2 {
+			clock.Severity = FindingCritical
+			clock.Message += fmt.Sprintf(", signed messages are rejected above %s", signatureMaxAge)
+		}
+		findings = append(findings, clock)
+	}
+
+	if status.TareShift {
+		findings = append(findings, DiagnoseFinding{
+			Check:    name + " readings",
+			Severity: FindingWarning,
+			Message:  "the scale measures negative weights, its tare shifted",
+			Action:   "Recalibrate the scale (POST /api/scale/tare-shift) or dismiss the shift if the platform was lifted",
+		})
+	}
+	if status.EmptyScale {
+		findings = append(findings, DiagnoseFinding{
+			Check:    name + " readings",
+			Severity: FindingWarning,
+			Message:  "nothing is on the scale while the pub is open",
+			Action:   "Put the keg back on the scale, check the cable of the load cell if it is there",
+		})
+	}
+
+	return findings
+}
+
+// diagnoseChannels reports outgoing channels (notifications, mirror, sheets) failing since their last delivery
+func (hr *HandlerRepository) diagnoseChannels() []DiagnoseFinding {
+	if hr.monitor == nil || hr.monitor.deliveries == nil {
+		return nil
+	}
+
+	findings := []DiagnoseFinding{}
+	for _, channel := range hr.monitor.deliveries.Health() {
+		finding := DiagnoseFinding{Check: "channel:" + channel.Channel, Severity: FindingOk}
+		if channel.LastFailure.After(channel.LastSuccess) {
+			finding.Severity = FindingWarning
+			finding.Message = fmt.Sprintf("the last delivery failed at %s: %s", channel.LastFailure.Format(time.DateTime), channel.LastError)
+			finding.Action = "Check the token and the url of the channel in the configuration, they may have expired"
+		} else {
+			finding.Message = fmt.Sprintf("the last delivery succeeded at %s", channel.LastSuccess.Format(time.DateTime))
+		}
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+// diagnoseHandler returns the findings of the runbook checks with suggested actions
+// ?format=text returns plain text readable on a phone
+func (hr *HandlerRepository) diagnoseHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		report := hr.diagnose(time.Now())
+		w.Header().Set("Cache-Control", "no-store")
+		if r.URL.Query().Get("format") == "text" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(report.Text()))
+			return
+		}
+
+		res, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
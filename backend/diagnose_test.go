@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerRepository_Diagnose(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	s.config.ScaleSecrets = map[string]string{"default": "0123456789abcdef"}
+	// the signed timestamp has whole seconds, so has the clock of the server
+	now := time.Now().Truncate(time.Second)
+	hr := &HandlerRepository{scale: s, config: s.config, monitor: s.monitor, logger: s.logger, now: func() time.Time { return now }}
+
+	report := hr.diagnose(now)
+	assert.Equal(t, FindingWarning, report.Severity, "the scale has not pinged")
+	assert.Equal(t, "scale", report.Findings[0].Check)
+	assert.NotEmpty(t, report.Findings[0].Action)
+
+	// the clock of the device is measured on signed messages
+	s.Ping()
+	body := "push|10|-70|22000"
+	assert.Nil(t, hr.authenticateDevice(signedRequest(body, "0123456789abcdef", now.Add(-3*time.Minute)), body, ""))
+	_ = s.monitor.deliveries.Track("telegram", func() error { return errors.New("401 Unauthorized") })
+
+	report = hr.diagnose(now)
+	assert.Equal(t, FindingCritical, report.Severity)
+	assert.Equal(t, []DiagnoseFinding{
+		{Check: "scale clock", Severity: FindingCritical, Message: "the device clock differs by -3m0s, signed messages are rejected above 5m0s", Action: "Check the time server (NTP) setting of the device and restart it"},
+		{Check: "channel:telegram", Severity: FindingWarning, Message: report.Findings[1].Message, Action: "Check the token and the url of the channel in the configuration, they may have expired"},
+	}, report.Findings[:2], "problems first")
+	assert.Contains(t, report.Findings[1].Message, "401 Unauthorized")
+	for _, finding := range report.Findings[2:] {
+		assert.Equal(t, FindingOk, finding.Severity, finding.Check)
+		assert.Empty(t, finding.Action, finding.Check)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/diagnose?format=text", nil)
+	w := httptest.NewRecorder()
+	hr.diagnoseHandler()(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r.Header.Set("Authorization", "test")
+	w = httptest.NewRecorder()
+	hr.diagnoseHandler()(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "Diagnostics at "))
+	assert.Contains(t, w.Body.String(), "[CRITICAL] scale clock: the device clock differs by -3m0s")
+	assert.Contains(t, w.Body.String(), "    -> Check the time server (NTP) setting of the device and restart it\n")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SettlementEventType marks a paid tab in the diff, it's not published to live subscribers
+const SettlementEventType = "settlement"
+
+// maxDiffRange limits the period of the diff, so a typo does not load the whole history
+const maxDiffRange = 31 * 24 * time.Hour
+
+// Diff is what happened between two points in time, staff use it to reconcile shifts
+type Diff struct {
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	Grams       float64     `json:"grams"` // weight drops, the same as in daily stats
+	Beers       float64     `json:"beers"`
+	Pours       int         `json:"pours"`
+	PouredGrams float64     `json:"poured_grams"`
+	Events      []DiffEvent `json:"events"`
+}
+
+// DiffEvent is a keg change, changeover of the beer, opening or closing of the pub or a paid tab
+type DiffEvent struct {
+	Type string    `json:"type"`
+	At   time.Time `json:"at"`
+	Data any       `json:"data"`
+}
+
+// GetDiff calculates consumption and lists events in [from, to)
+func GetDiff(store Storage, from, to time.Time, config *Config) (Diff, error) {
+	diff := Diff{From: from, To: to, Events: []DiffEvent{}}
+
+	measurements, err := store.GetMeasurements(from, to)
+	if err != nil {
+		return diff, fmt.Errorf("could not load measurements: %w", err)
+	}
+	for i := 1; i < len(measurements); i++ {
+		if drop := measurements[i-1].Weight - measurements[i].Weight; drop > 0 {
+			diff.Grams += drop
+		}
+	}
+	if config.GlassSize > 0 {
+		diff.Beers = diff.Grams / config.GlassSize
+	}
+
+	pours, err := store.GetPours(from, to)
+	if err != nil {
+		return diff, fmt.Errorf("could not load pours: %w", err)
+	}
+	diff.Pours = len(pours)
+	for _, pour := range pours {
+		diff.PouredGrams += pour.Grams
+	}
+
+	kegs, err := store.GetKegs()
+	if err != nil {
+		return diff, fmt.Errorf("could not load kegs: %w", err)
+	}
+	for _, keg := range kegs {
+		if !keg.TappedAt.Before(from) && keg.TappedAt.Before(to) {
+			diff.Events = append(diff.Events, DiffEvent{Type: KegChangeEventType, At: keg.TappedAt, Data: keg})
+			if previous, found := previousKeg(kegs, keg); found {
+				if changeover, ok := Changeover(previous, keg, config); ok {
+					diff.Events = append(diff.Events, DiffEvent{Type: ChangeoverEventType, At: keg.TappedAt, Data: changeover})
+				}
+			}
+		}
+	}
+
+	// sessions are stored by the opening, the one closed in the range may be opened a while before
+	sessions, err := store.GetPubSessions(from.Add(-7*24*time.Hour), to)
+	if err != nil {
+		return diff, fmt.Errorf("could not load pub sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if !session.OpenedAt.Before(from) {
+			diff.Events = append(diff.Events, DiffEvent{Type: PubOpenEventType, At: session.OpenedAt, Data: session})
+		}
+		if !session.ClosedAt.Before(from) && session.ClosedAt.Before(to) {
+			diff.Events = append(diff.Events, DiffEvent{Type: OfflineEventType, At: session.ClosedAt, Data: session})
+		}
+	}
+
+	settlements, err := store.GetSettlements(from, to)
+	if err != nil {
+		return diff, fmt.Errorf("could not load settlements: %w", err)
+	}
+	for _, settlement := range settlements {
+		diff.Events = append(diff.Events, DiffEvent{Type: SettlementEventType, At: settlement.At, Data: settlement})
+	}
+
+	sort.SliceStable(diff.Events, func(i, j int) bool {
+		return diff.Events[i].At.Before(diff.Events[j].At)
+	})
+
+	return diff, nil
+}
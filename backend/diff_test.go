@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDiff(t *testing.T) {
+	store := &FakeStore{}
+	from := time.Date(2024, 5, 4, 16, 0, 0, 0, time.UTC)
+	to := from.Add(7 * time.Hour)
+
+	assert.Nil(t, store.AddPubSession(PubSession{OpenedAt: from.Add(-time.Hour), ClosedAt: from.Add(2 * time.Hour)}))
+	assert.Nil(t, store.AddPubSession(PubSession{OpenedAt: from.Add(3 * time.Hour), ClosedAt: to.Add(time.Hour)}))
+	assert.Nil(t, store.SaveKeg(NewKegInfo(30, "Pilsner", from.Add(-48*time.Hour), 40000)))
+	keg := NewKegInfo(15, "Weizen", from.Add(4*time.Hour), 22000)
+	assert.Nil(t, store.SaveKeg(keg))
+	assert.Nil(t, store.AddSettlement(Settlement{PersonId: "honza", At: from.Add(5 * time.Hour), Glasses: 3, Amount: 135}))
+
+	for i, weight := range []float64{18000, 17500, 16500, 22000, 21000} {
+		assert.Nil(t, store.AddMeasurement(Measurement{Weight: weight, At: from.Add(time.Duration(i) * time.Hour)}))
+	}
+	assert.Nil(t, store.AddPour(Pour{At: from.Add(time.Hour), Grams: 480}))
+	assert.Nil(t, store.AddPour(Pour{At: to.Add(time.Minute), Grams: 500}))
+
+	config := NewConfig()
+	config.GlassSize = 500
+	diff, err := GetDiff(store, from, to, config)
+	assert.Nil(t, err)
+	assert.Equal(t, 2500.0, diff.Grams, "tapping of the keg is not consumption")
+	assert.Equal(t, 5.0, diff.Beers)
+	assert.Equal(t, 1, diff.Pours)
+	assert.Equal(t, 480.0, diff.PouredGrams)
+
+	types := []string{}
+	for _, event := range diff.Events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{OfflineEventType, PubOpenEventType, KegChangeEventType, ChangeoverEventType, SettlementEventType}, types)
+	assert.Equal(t, "Pilsner", diff.Events[3].Data.(ChangeoverEvent).FromBeer)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// measurementsMaxBuckets limits size of a single measurements query
+const measurementsMaxBuckets = 10000
+
+// MeasurementBucket aggregates measurements within a single time bucket
+type MeasurementBucket struct {
+	Id    string    `json:"id,omitempty"` // id of the raw measurement, see [MeasurementId], empty for buckets
+	At    time.Time `json:"at"`           // start of the bucket
+	Avg   float64   `json:"avg"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Count int       `json:"count"`
+}
+
+// Downsample aggregates measurements into buckets of the resolution aligned to from
+// buckets without measurements are omitted, so gaps (closed pub) stay visible in charts
+// zero resolution returns every measurement as its own bucket
+func Downsample(measurements []Measurement, from time.Time, resolution time.Duration) []MeasurementBucket {
+	buckets := []MeasurementBucket{}
+	for _, m := range measurements {
+		at := m.At
+		if resolution > 0 {
+			at = from.Add(m.At.Sub(from) / resolution * resolution)
+		}
+
+		last := len(buckets) - 1
+		if resolution == 0 {
+			buckets = append(buckets, MeasurementBucket{Id: MeasurementId(m.At), At: at, Avg: m.Weight, Min: m.Weight, Max: m.Weight, Count: 1})
+			continue
+		}
+		if last < 0 || !buckets[last].At.Equal(at) {
+			buckets = append(buckets, MeasurementBucket{At: at, Avg: m.Weight, Min: m.Weight, Max: m.Weight, Count: 1})
+			continue
+		}
+
+		b := &buckets[last]
+		b.Avg = (b.Avg*float64(b.Count) + m.Weight) / float64(b.Count+1)
+		b.Min = math.Min(b.Min, m.Weight)
+		b.Max = math.Max(b.Max, m.Weight)
+		b.Count++
+	}
+
+	return buckets
+}
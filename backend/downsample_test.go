@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownsample(t *testing.T) {
+	from := time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)
+	measurements := []Measurement{
+		{Weight: 20000, At: from.Add(1 * time.Minute)},
+		{Weight: 19000, At: from.Add(3 * time.Minute)},
+		{Weight: 18000, At: from.Add(4 * time.Minute)},
+		{Weight: 17500, At: from.Add(21 * time.Minute)}, // buckets in between are empty
+	}
+
+	buckets := Downsample(measurements, from, 5*time.Minute)
+	assert.Equal(t, []MeasurementBucket{
+		{At: from, Avg: 19000, Min: 18000, Max: 20000, Count: 3},
+		{At: from.Add(20 * time.Minute), Avg: 17500, Min: 17500, Max: 17500, Count: 1},
+	}, buckets)
+
+	raw := Downsample(measurements, from, 0)
+	assert.Len(t, raw, 4)
+	assert.Equal(t, measurements[1].At, raw[1].At)
+
+	assert.Empty(t, Downsample(nil, from, time.Minute))
+}
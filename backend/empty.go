@@ -0,0 +1,43 @@
+package main
+
+import "time"
+
+// EmptyScaleEvent is the payload of [EmptyScaleEventType]
+// published once when the scale measures less than the accepted minimum for [Config.EmptyScaleDelay] while the pub is open
+type EmptyScaleEvent struct {
+	Weight float64   `json:"weight"` // the last measured weight
+	Since  time.Time `json:"since"`  // the first measurement below the minimum
+}
+
+// checkEmptyScale alerts nothing on the scale while the pub is open - the keg was removed and not put back,
+// the platform is lifted or the load cell failed, such measurements are not processed otherwise
+// a keg change empties the scale for a while, so the state is raised after the delay only
+// caller has to hold the lock
+func (s *Scale) checkEmptyScale(weight float64, at time.Time) {
+	if !s.Pub.IsOpen || s.ActiveKeg == 0 || s.config.EmptyScaleDelay <= 0 || s.isCleaning() {
+		return
+	}
+
+	if s.emptySince.IsZero() {
+		s.emptySince = at
+	}
+	if s.EmptyScale || at.Sub(s.emptySince) < s.config.EmptyScaleDelay {
+		return
+	}
+
+	s.EmptyScale = true
+	s.monitor.emptyScale.WithLabelValues().Set(1)
+	s.logger.Errorf("Nothing is on the scale since %s, the weight is %.0f grams", s.emptySince.Format(time.TimeOnly), weight)
+	s.events.Publish(EmptyScaleEventType, EmptyScaleEvent{Weight: weight, Since: s.emptySince})
+}
+
+// clearEmptyScale resets the empty scale state, e.g. a keg is on the scale again or the pub closed
+// caller has to hold the lock
+func (s *Scale) clearEmptyScale() {
+	s.emptySince = time.Time{}
+	if s.EmptyScale {
+		s.EmptyScale = false
+		s.monitor.emptyScale.WithLabelValues().Set(0)
+		s.logger.Info("Weight is back on the scale")
+	}
+}
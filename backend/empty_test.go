@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScale_EmptyScale(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	s.Ping()
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	emptyScale := func() []EmptyScaleEvent {
+		var found []EmptyScaleEvent
+		for len(events) > 0 {
+			if event := <-events; event.Type == EmptyScaleEventType {
+				found = append(found, event.Data.(EmptyScaleEvent))
+			}
+		}
+		return found
+	}
+	measure := func(weight float64, at time.Time) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		assert.Nil(t, s.addMeasurement(weight, at, SourceHttp, Sensors{}))
+	}
+
+	start := time.Now()
+	measure(200, start)
+	measure(150, start.Add(5*time.Minute))
+	assert.Empty(t, emptyScale(), "keg is being changed")
+	assert.False(t, s.Status().EmptyScale)
+	assert.Equal(t, 22000.0, s.Weight, "invalid weights are not processed")
+
+	measure(100, start.Add(10*time.Minute))
+	measure(100, start.Add(11*time.Minute))
+	alerts := emptyScale()
+	assert.Len(t, alerts, 1, "once until the keg is back")
+	assert.Equal(t, EmptyScaleEvent{Weight: 100, Since: start}, alerts[0])
+	assert.True(t, s.Status().EmptyScale)
+	assert.Equal(t, 1.0, gaugeValue(t, s.monitor, "scale_empty"))
+
+	measure(21900, start.Add(12*time.Minute))
+	assert.False(t, s.Status().EmptyScale)
+	assert.Equal(t, 0.0, gaugeValue(t, s.monitor, "scale_empty"))
+
+	// the delay starts again
+	measure(100, start.Add(13*time.Minute))
+	measure(100, start.Add(20*time.Minute))
+	assert.Empty(t, emptyScale())
+
+	// nobody cares while the pub is closed
+	s.SetPubOverride(false, time.Hour)
+	measure(100, start.Add(30*time.Minute))
+	assert.Empty(t, emptyScale())
+	assert.False(t, s.Status().EmptyScale)
+}
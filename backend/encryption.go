@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedBlobPrefix marks encrypted values, values without it were stored before the encryption was enabled
+var encryptedBlobPrefix = []byte("enc:v1:")
+
+// BlobCipher encrypts values stored in the storage (encryption at rest)
+type BlobCipher interface {
+	Seal(plaintext []byte) []byte
+	Open(blob []byte) ([]byte, error)
+}
+
+// AesBlobCipher encrypts blobs by AES-256-GCM
+// the nonce is derived from the plaintext (HMAC-SHA256), so equal values give equal blobs
+// measurements are members of a Redis sorted set, a replayed measurement has to stay a single member
+// equality of the values is the only thing revealed by the deterministic nonce
+type AesBlobCipher struct {
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+// NewAesBlobCipher creates the cipher from a 32 bytes key encoded as hex or base64
+func NewAesBlobCipher(encodedKey string) (*AesBlobCipher, error) {
+	key, err := decodeStorageKey(encodedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// separate keys for the encryption and the nonce derivation
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("encryption"))
+	encryptionKey := mac.Sum(nil)
+	mac.Reset()
+	mac.Write([]byte("nonce"))
+	nonceKey := mac.Sum(nil)
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AesBlobCipher{aead: aead, nonceKey: nonceKey}, nil
+}
+
+func decodeStorageKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(encoded)
+	}
+	if err != nil {
+		return nil, errors.New("key is not hex or base64 encoded")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key has %d bytes, 32 are required", len(key))
+	}
+
+	return key, nil
+}
+
+// Seal returns the prefixed base64 of nonce and ciphertext, stored values stay printable
+func (c *AesBlobCipher) Seal(plaintext []byte) []byte {
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write(plaintext)
+	nonce := mac.Sum(nil)[:c.aead.NonceSize()]
+
+	sealed := c.aead.Seal(nonce, nonce, plaintext, nil)
+	blob := make([]byte, len(encryptedBlobPrefix)+base64.RawStdEncoding.EncodedLen(len(sealed)))
+	copy(blob, encryptedBlobPrefix)
+	base64.RawStdEncoding.Encode(blob[len(encryptedBlobPrefix):], sealed)
+
+	return blob
+}
+
+// Open decrypts the blob, blobs stored before the encryption was enabled are returned as they are
+func (c *AesBlobCipher) Open(blob []byte) ([]byte, error) {
+	encoded, found := bytes.CutPrefix(blob, encryptedBlobPrefix)
+	if !found {
+		return blob, nil
+	}
+
+	sealed := make([]byte, base64.RawStdEncoding.DecodedLen(len(encoded)))
+	n, err := base64.RawStdEncoding.Decode(sealed, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	sealed = sealed[:n]
+
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("invalid encrypted value: too short")
+	}
+
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, errors.New("could not decrypt value, is STORAGE_KEY right?")
+	}
+
+	return plaintext, nil
+}
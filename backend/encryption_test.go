@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStorageKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestAesBlobCipher(t *testing.T) {
+	c, err := NewAesBlobCipher(testStorageKey)
+	assert.Nil(t, err)
+
+	plaintext := []byte(`{"weight":20500,"at":"2024-05-10T20:00:00Z"}`)
+	blob := c.Seal(plaintext)
+	assert.True(t, bytes.HasPrefix(blob, encryptedBlobPrefix))
+	assert.NotContains(t, string(blob), "weight")
+	assert.Equal(t, blob, c.Seal(plaintext), "equal measurements stay a single member of the sorted set")
+	assert.NotEqual(t, blob, c.Seal([]byte(`{"weight":20501}`)))
+
+	opened, err := c.Open(blob)
+	assert.Nil(t, err)
+	assert.Equal(t, plaintext, opened)
+
+	opened, err = c.Open([]byte(`{"weight":1}`))
+	assert.Nil(t, err)
+	assert.Equal(t, `{"weight":1}`, string(opened), "stored before the encryption was enabled")
+
+	tampered := bytes.Clone(blob)
+	tampered[len(tampered)-1] ^= 1
+	_, err = c.Open(tampered)
+	assert.NotNil(t, err)
+
+	other, err := NewAesBlobCipher(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	assert.Nil(t, err)
+	_, err = other.Open(blob)
+	assert.ErrorContains(t, err, "STORAGE_KEY", "wrong key")
+
+	_, err = NewAesBlobCipher(strings.Repeat("ab", 16))
+	assert.ErrorContains(t, err, "32 are required")
+	_, err = NewAesBlobCipher("not a key")
+	assert.NotNil(t, err)
+}
+
+func TestOpenStorage_Encryption(t *testing.T) {
+	config := NewConfig()
+	store, err := openStorage(config, "redis", "")
+	assert.Nil(t, err)
+	assert.Nil(t, store.(*RedisStore).cipher, "plain by default")
+
+	config.StorageKey = testStorageKey
+	store, err = openStorage(config, "redis", "")
+	assert.Nil(t, err)
+	assert.NotNil(t, store.(*RedisStore).cipher)
+	assert.NotNil(t, store.(*RedisStore).ForDevice("tap2").(*RedisStore).cipher, "all scales are encrypted")
+
+	config.StorageKey = "abc"
+	_, err = openStorage(config, "redis", "")
+	assert.NotNil(t, err)
+}
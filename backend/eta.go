@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// etaWindow limits the consumption used to predict the empty keg to recent opening hours
+const etaWindow = 7 * 24 * time.Hour
+
+// minEtaOpenTime is the open time needed to estimate the consumption rate
+const minEtaOpenTime = 30 * time.Minute
+
+// OpenTime returns the time the pub was open in [from, to), sessions with zero closing time are still open
+func OpenTime(sessions []PubSession, from, to time.Time) time.Duration {
+	open := time.Duration(0)
+	for _, session := range sessions {
+		start, end := session.OpenedAt, session.ClosedAt
+		if start.Before(from) {
+			start = from
+		}
+		if end.IsZero() || end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			open += end.Sub(start)
+		}
+	}
+
+	return open
+}
+
+// CalcOpenHoursLeft estimates the hours of opening until the keg runs out
+// at the consumption rate of its pours while the pub was open in [from, to)
+// remaining is grams of beer left in the keg, nil if the rate is unknown yet
+func CalcOpenHoursLeft(kegId string, remaining float64, pours []Pour, sessions []PubSession, from, to time.Time) *float64 {
+	open := OpenTime(sessions, from, to)
+	if open < minEtaOpenTime {
+		return nil
+	}
+
+	poured := 0.0
+	for _, pour := range pours {
+		if pour.KegId == kegId && !pour.At.Before(from) && pour.At.Before(to) {
+			poured += pour.Grams
+		}
+	}
+	if poured <= 0 {
+		return nil
+	}
+
+	hours := math.Max(remaining, 0) / (poured / open.Hours())
+	return &hours
+}
+
+// KegEta predicts the time the active keg runs out, see [Scale.kegEta]
+func (s *Scale) KegEta(now time.Time) (*time.Time, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.kegEta(now)
+}
+
+// kegEta predicts the time the active keg runs out at the consumption rate of recent opening hours
+// only the time the pub is open counts, so it's nil while the pub is closed, also if no keg is tapped
+// or the rate is unknown yet
+// caller has to hold the lock
+func (s *Scale) kegEta(now time.Time) (*time.Time, error) {
+	tare, found := s.tare()
+	if s.KegInfo.Id == "" || !found || !s.Pub.IsOpen {
+		return nil, nil
+	}
+
+	from := s.KegInfo.TappedAt
+	if now.Sub(from) > etaWindow {
+		from = now.Add(-etaWindow)
+	}
+
+	pours, err := s.store.GetPours(from, now)
+	if err != nil {
+		return nil, fmt.Errorf("could not load pours: %w", err)
+	}
+	// a session opened the day before may reach into the window
+	sessions, err := s.store.GetPubSessions(from.Add(-24*time.Hour), now)
+	if err != nil {
+		return nil, fmt.Errorf("could not load pub sessions: %w", err)
+	}
+	sessions = append(sessions, PubSession{OpenedAt: s.Pub.OpenedAt})
+
+	hours := CalcOpenHoursLeft(s.KegInfo.Id, s.Weight-tare, pours, sessions, from, now)
+	if hours == nil {
+		return nil, nil
+	}
+
+	eta := now.Add(time.Duration(*hours * float64(time.Hour))).Truncate(time.Minute)
+	return &eta, nil
+}
+
+// KegEmptyAt returns the prediction of the empty keg refreshed by pours, nil if it's unknown
+// live views get it without loading the history on every measurement
+func (s *Scale) KegEmptyAt() *time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.kegEmptyAt
+}
+
+// updateKegEta refreshes the prediction of the empty keg and its gauge, zero if it's unknown
+// caller has to hold the lock
+func (s *Scale) updateKegEta(now time.Time) {
+	eta, err := s.kegEta(now)
+	if err != nil {
+		s.logger.Warnf("Could not predict the empty keg: %v", err)
+	}
+	s.setKegEta(eta)
+}
+
+// setKegEta sets the prediction of the empty keg and its gauge
+// caller has to hold the lock
+func (s *Scale) setKegEta(eta *time.Time) {
+	s.kegEmptyAt = eta
+
+	value := 0.0
+	if eta != nil {
+		value = float64(eta.Unix())
+	}
+	s.monitor.kegEmptyAt.WithLabelValues().Set(value)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcOpenHoursLeft(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(48 * time.Hour)
+	sessions := []PubSession{
+		{OpenedAt: from.Add(-2 * time.Hour), ClosedAt: from.Add(2 * time.Hour)}, // opened before the window
+		{OpenedAt: from.Add(18 * time.Hour), ClosedAt: from.Add(22 * time.Hour)},
+		{OpenedAt: from.Add(46 * time.Hour)}, // still open
+	}
+	assert.Equal(t, 8*time.Hour, OpenTime(sessions, from, to))
+
+	pours := []Pour{
+		{At: from.Add(time.Hour), Grams: 2000, KegId: "k1"},
+		{At: from.Add(19 * time.Hour), Grams: 5000, KegId: "k1"},
+		{At: from.Add(20 * time.Hour), Grams: 3000, KegId: "k0"}, // previous keg
+		{At: from.Add(47 * time.Hour), Grams: 1000, KegId: "k1"},
+	}
+	hours := CalcOpenHoursLeft("k1", 10000, pours, sessions, from, to)
+	assert.NotNil(t, hours)
+	assert.Equal(t, 10.0, *hours, "1 kg per open hour")
+
+	assert.Nil(t, CalcOpenHoursLeft("k2", 10000, pours, sessions, from, to), "nothing poured")
+	assert.Nil(t, CalcOpenHoursLeft("k1", 10000, pours, sessions[2:], from.Add(46*time.Hour), from.Add(46*time.Hour+10*time.Minute)), "open too short")
+}
+
+func TestScale_KegEta(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg, 15 kg of beer
+	now := time.Now()
+	s.KegInfo.TappedAt = now.Add(-72 * time.Hour)
+	store := s.store.(*FakeStore)
+	assert.Nil(t, store.AddPubSession(PubSession{OpenedAt: now.Add(-50 * time.Hour), ClosedAt: now.Add(-45 * time.Hour)}))
+	assert.Nil(t, store.AddPour(Pour{At: now.Add(-48 * time.Hour), Grams: 5000, KegId: s.KegInfo.Id}))
+	assert.Nil(t, s.KegEmptyAt(), "closed")
+
+	s.Ping() // opens the pub
+	eta := s.KegEmptyAt()
+	assert.NotNil(t, eta)
+	assert.WithinDuration(t, now.Add(15*time.Hour), *eta, 2*time.Minute, "1 kg per open hour")
+	assert.Equal(t, float64(eta.Unix()), gaugeValue(t, s.monitor, "scale_keg_empty_at"))
+
+	s.SetPubOverride(false, time.Hour)
+	s.Recheck()
+	assert.Nil(t, s.KegEmptyAt())
+	assert.Equal(t, 0.0, gaugeValue(t, s.monitor, "scale_keg_empty_at"))
+}
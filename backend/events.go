@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types, their payloads are described by JSON schemas in the schemas directory
+const (
+	PourProgressEventType  = "pour_progress"
+	PourEventType          = "pour"
+	KegChangeEventType     = "keg_change"
+	PubOpenEventType       = "pub_open"
+	OfflineEventType       = "offline"
+	RunawayTapEventType    = "runaway_tap"
+	ExternalAlertEventType = "external_alert"
+	StateChangeEventType   = "state_change"
+	KegButtonEventType     = "keg_button"
+	ChangeoverEventType    = "changeover"
+	ClosingSoonEventType   = "closing_soon"
+	ClosedLossEventType    = "closed_loss"
+	KegUntapEventType      = "keg_untap"
+	EmptyScaleEventType    = "empty_scale"
+	TareShiftEventType     = "tare_shift"
+	KegLowEventType        = "keg_low"
+	AlertRuleEventType     = "alert_rule"
+)
+
+// Event is a message published to live subscribers (SSE, WebSocket)
+type Event struct {
+	Type    string    `json:"type"`
+	Version int       `json:"version"` // schema version of the data
+	At      time.Time `json:"at"`
+	Data    any       `json:"data"`
+}
+
+// OfflineEvent is the payload of [OfflineEventType]
+type OfflineEvent struct {
+	LastOk time.Time `json:"last_ok"`
+}
+
+// StateChangeEvent is the payload of [StateChangeEventType]
+// published on every measurement and ping, so live views can refresh
+type StateChangeEvent struct {
+	Reason string  `json:"reason"` // measurement or ping
+	Weight float64 `json:"weight"`
+}
+
+// KegButtonEvent is the payload of [KegButtonEventType]
+// published when the "keg change now" button at the bar is pressed
+type KegButtonEvent struct {
+	Action     string      `json:"action"`      // confirmed, tapped or wizard
+	Keg        int         `json:"keg"`         // active keg after the press
+	PendingKeg *PendingKeg `json:"pending_keg"` // keg change the press was about, nil when none was detected
+}
+
+// Broadcaster fans out events to all subscribers
+// slow subscribers miss events instead of blocking the publisher
+type Broadcaster struct {
+	mux         sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		mux:         sync.Mutex{},
+		subscribers: map[chan Event]struct{}{},
+	}
+}
+
+// Subscribe returns a channel receiving all future events
+// the channel has to be released by Unsubscribe
+func (b *Broadcaster) Subscribe() chan Event {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	ch := make(chan Event, 16)
+	b.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (b *Broadcaster) Unsubscribe(ch chan Event) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if _, found := b.subscribers[ch]; found {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+func (b *Broadcaster) Publish(eventType string, data any) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	event := Event{Type: eventType, Version: EventVersions[eventType], At: time.Now(), Data: data}
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// subscriber is too slow, drop the event
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readStreamEvent reads a single Server-Sent Event and returns its name and data
+func readStreamEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	name, data := "", ""
+	for {
+		line, err := r.ReadString('\n')
+		assert.Nil(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+	server := httptest.NewServer(hr.requestLogger(http.HandlerFunc(hr.eventStreamHandler())))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/api/events")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// the handler subscribes after the headers are sent
+	assert.Eventually(t, func() bool {
+		s.events.mux.Lock()
+		defer s.events.mux.Unlock()
+		return len(s.events.subscribers) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	s.Ping() // opens the pub, the ping itself is left out of the stream
+	assert.Nil(t, s.AddMeasurement(19500, SourceHttp))
+
+	reader := bufio.NewReader(res.Body)
+	name, data := readStreamEvent(t, reader)
+	assert.Equal(t, PubOpenEventType, name)
+	assert.Contains(t, data, `"is_open":true`)
+
+	name, data = readStreamEvent(t, reader)
+	assert.Equal(t, StateChangeEventType, name)
+	var event struct {
+		Type    string           `json:"type"`
+		Version int              `json:"version"`
+		Data    StateChangeEvent `json:"data"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(data), &event))
+	assert.Equal(t, StateChangeEventType, event.Type)
+	assert.Equal(t, 1, event.Version)
+	assert.Equal(t, StateChangeEvent{Reason: "measurement", Weight: 19500}, event.Data)
+}
+
+func TestEventStream_UnknownDevice(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+
+	w := httptest.NewRecorder()
+	hr.eventStreamHandler()(w, httptest.NewRequest(http.MethodGet, "/api/events?device=tap9", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const manifestFile = "manifest.json"
+
+// ExportEntry describes a single exported file in the manifest
+type ExportEntry struct {
+	Day        string    `json:"day"` // YYYY-MM-DD in local timezone
+	File       string    `json:"file"`
+	Kind       string    `json:"kind"` // measurements or pours
+	Rows       int       `json:"rows"`
+	Size       int64     `json:"size"`
+	Sha256     string    `json:"sha256"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// Exporter writes daily Parquet exports of raw data
+// so analytics can run on files instead of the production store
+type Exporter struct {
+	mux    sync.Mutex
+	config *Config
+	store  Storage
+	logger *logrus.Logger
+}
+
+func NewExporter(config *Config, store Storage, logger *logrus.Logger) *Exporter {
+	return &Exporter{
+		mux:    sync.Mutex{},
+		config: config,
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Enabled returns true if the export path is configured
+func (e *Exporter) Enabled() bool {
+	return e.config.ExportPath != ""
+}
+
+// Run exports the last finished pub day every night at [Config.ExportHour]
+// missed days are not exported retroactively, use ExportDay for that
+// it's supposed to run as a supervised worker
+func (e *Exporter) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	next := nextExportAt(time.Now(), e.config.ExportHour)
+	for {
+		select {
+		case <-ctx.Done():
+			e.logger.Debug("Exporter stopped")
+			return
+		case now := <-tick.C:
+			heartbeat()
+			if !e.Enabled() || now.Before(next) {
+				continue
+			}
+
+			// the last finished pub day
+			day := pubDayStart(next, e.config.PubDayStart).AddDate(0, 0, -1)
+			if _, err := e.ExportDay(day); err != nil {
+				e.logger.Errorf("Could not export day %s: %v", day.Format(time.DateOnly), err)
+			}
+			next = nextExportAt(now, e.config.ExportHour)
+		}
+	}
+}
+
+// nextExportAt returns the next time after now at the given local hour
+func nextExportAt(now time.Time, hour int) time.Time {
+	now = now.In(getTz())
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, getTz())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
+// ExportDay exports measurements and pours of the given pub day into Parquet files
+// and records the files in the manifest
+func (e *Exporter) ExportDay(day time.Time) ([]ExportEntry, error) {
+	if !e.Enabled() {
+		return nil, fmt.Errorf("export path is not configured")
+	}
+
+	day = day.In(getTz())
+	from := time.Date(day.Year(), day.Month(), day.Day(), e.config.PubDayStart, 0, 0, 0, getTz())
+	to := from.AddDate(0, 0, 1)
+
+	measurements, err := e.exportMeasurements(from, to)
+	if err != nil {
+		return nil, err
+	}
+	pours, err := e.exportPours(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	e.logger.Infof("Exported %d measurements and %d pours of %s", measurements.Rows, pours.Rows, measurements.Day)
+	return []ExportEntry{measurements, pours}, nil
+}
+
+func (e *Exporter) exportMeasurements(from, to time.Time) (ExportEntry, error) {
+	// sessions started in the evening continue after midnight
+	sessionsFrom := from.Add(-sessionLookback)
+	history, err := e.store.GetMeasurements(sessionsFrom, to)
+	if err != nil {
+		return ExportEntry{}, fmt.Errorf("could not load measurements: %w", err)
+	}
+	tags, err := e.store.GetSessionTags(sessionsFrom.Add(-OkLimit), to)
+	if err != nil {
+		return ExportEntry{}, fmt.Errorf("could not load session tags: %w", err)
+	}
+	sessions := SplitSessions(history, tags, e.config.GlassSize)
+
+	var measurements []Measurement
+	for _, m := range history {
+		if !m.At.Before(from) {
+			measurements = append(measurements, m)
+		}
+	}
+
+	at := make([]int64, len(measurements))
+	weight := make([]float64, len(measurements))
+	sessionTag := make([]string, len(measurements))
+	source := make([]string, len(measurements))
+	raw := make([]float64, len(measurements))
+	for i, m := range measurements {
+		at[i] = m.At.UnixMilli()
+		weight[i] = m.Weight
+		sessionTag[i] = SessionTagAt(sessions, m.At)
+		source[i] = m.Source
+		raw[i] = m.Raw
+	}
+
+	return e.writeExport(from, "measurements", len(measurements), []ParquetColumn{
+		{Name: "at", Type: ParquetInt64, Timestamp: true, Values: at},
+		{Name: "weight", Type: ParquetDouble, Values: weight},
+		{Name: "session_tag", Type: ParquetByteArray, Values: sessionTag},
+		{Name: "source", Type: ParquetByteArray, Values: source},
+		{Name: "raw", Type: ParquetDouble, Values: raw},
+	})
+}
+
+func (e *Exporter) exportPours(from, to time.Time) (ExportEntry, error) {
+	pours, err := e.store.GetPours(from, to)
+	if err != nil {
+		return ExportEntry{}, fmt.Errorf("could not load pours: %w", err)
+	}
+
+	startedAt := make([]int64, len(pours))
+	at := make([]int64, len(pours))
+	grams := make([]float64, len(pours))
+	duration := make([]float64, len(pours))
+	kegId := make([]string, len(pours))
+	for i, p := range pours {
+		startedAt[i] = p.StartedAt.UnixMilli()
+		at[i] = p.At.UnixMilli()
+		grams[i] = p.Grams
+		duration[i] = p.Duration
+		kegId[i] = p.KegId
+	}
+
+	return e.writeExport(from, "pours", len(pours), []ParquetColumn{
+		{Name: "started_at", Type: ParquetInt64, Timestamp: true, Values: startedAt},
+		{Name: "at", Type: ParquetInt64, Timestamp: true, Values: at},
+		{Name: "grams", Type: ParquetDouble, Values: grams},
+		{Name: "duration", Type: ParquetDouble, Values: duration},
+		{Name: "keg_id", Type: ParquetByteArray, Values: kegId},
+	})
+}
+
+// writeExport writes the Parquet file <kind>-<day>.parquet and records it in the manifest
+func (e *Exporter) writeExport(from time.Time, kind string, rows int, columns []ParquetColumn) (ExportEntry, error) {
+	if err := os.MkdirAll(e.config.ExportPath, 0o755); err != nil {
+		return ExportEntry{}, fmt.Errorf("could not create export directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.parquet", kind, from.Format(time.DateOnly))
+	path := filepath.Join(e.config.ExportPath, name)
+	f, err := os.Create(path)
+	if err != nil {
+		return ExportEntry{}, fmt.Errorf("could not create export file: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if err := WriteParquet(io.MultiWriter(f, hash), columns); err != nil {
+		return ExportEntry{}, fmt.Errorf("could not write parquet: %w", err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return ExportEntry{}, err
+	}
+
+	entry := ExportEntry{
+		Day:        from.Format(time.DateOnly),
+		File:       name,
+		Kind:       kind,
+		Rows:       rows,
+		Size:       stat.Size(),
+		Sha256:     hex.EncodeToString(hash.Sum(nil)),
+		ExportedAt: time.Now(),
+	}
+
+	if err := e.addToManifest(entry); err != nil {
+		return ExportEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// Manifest returns all exported files ordered by day
+func (e *Exporter) Manifest() ([]ExportEntry, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	return e.readManifest()
+}
+
+func (e *Exporter) readManifest() ([]ExportEntry, error) {
+	entries := []ExportEntry{}
+	data, err := os.ReadFile(filepath.Join(e.config.ExportPath, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid manifest format: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (e *Exporter) addToManifest(entry ExportEntry) error {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	entries, err := e.readManifest()
+	if err != nil {
+		return err
+	}
+
+	// re-export replaces the previous entry
+	filtered := entries[:0]
+	for _, item := range entries {
+		if item.File != entry.File {
+			filtered = append(filtered, item)
+		}
+	}
+	filtered = append(filtered, entry)
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Day < filtered[j].Day
+	})
+
+	data, err := json.MarshalIndent(filtered, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write and rename, so readers never see half written manifest
+	tmp := filepath.Join(e.config.ExportPath, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	return os.Rename(tmp, filepath.Join(e.config.ExportPath, manifestFile))
+}
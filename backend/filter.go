@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// weight filter modes
+const (
+	WeightFilterNone   = ""
+	WeightFilterMedian = "median"
+	WeightFilterEma    = "ema"
+)
+
+// WeightFilter stabilizes the measured weight before it's used for pours, beers left and metrics
+// a single spike (someone leaned on the keg, the scale was bumped) is rejected when it's further
+// than maxDelta from the average of recent values, the remaining values are smoothed by the median
+// of the window or by the exponential moving average with the smoothing factor 2/(window+1).
+// A level lasting for the whole window is not a spike (keg change), the filter starts over from it.
+type WeightFilter struct {
+	mode     string
+	window   int
+	maxDelta float64
+
+	recent   []float64 // last accepted values, the newest last
+	current  float64   // last filtered value
+	rejected int       // consecutive values rejected as outliers
+}
+
+func NewWeightFilter(mode string, window int, maxDelta float64) *WeightFilter {
+	return &WeightFilter{
+		mode:     mode,
+		window:   max(window, 1),
+		maxDelta: maxDelta,
+		recent:   []float64{},
+	}
+}
+
+// Enabled returns true if the filter changes measured values
+func (f *WeightFilter) Enabled() bool {
+	return f.mode != WeightFilterNone || f.maxDelta > 0
+}
+
+// Apply returns the filtered weight
+// accepted is false for an outlier, the returned weight is the last filtered value then
+func (f *WeightFilter) Apply(weight float64) (filtered float64, accepted bool) {
+	if f.maxDelta > 0 && len(f.recent) > 0 && math.Abs(weight-average(f.recent)) > f.maxDelta {
+		f.rejected++
+		if f.rejected < f.window {
+			return f.current, false
+		}
+		// the new level holds, start over from it
+		f.recent = f.recent[:0]
+	}
+	f.rejected = 0
+
+	if len(f.recent) == f.window {
+		f.recent = f.recent[1:]
+	}
+	f.recent = append(f.recent, weight)
+
+	switch {
+	case f.mode == WeightFilterMedian:
+		f.current = median(f.recent)
+	case f.mode == WeightFilterEma && len(f.recent) > 1:
+		alpha := 2 / float64(f.window+1)
+		f.current = alpha*weight + (1-alpha)*f.current
+	default:
+		f.current = weight
+	}
+
+	return f.current, true
+}
+
+func average(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// applyAll feeds the weights to the filter and returns filtered values of the accepted ones
+func applyAll(f *WeightFilter, weights ...float64) []float64 {
+	filtered := []float64{}
+	for _, weight := range weights {
+		if value, accepted := f.Apply(weight); accepted {
+			filtered = append(filtered, value)
+		}
+	}
+	return filtered
+}
+
+func TestWeightFilter_Median(t *testing.T) {
+	f := NewWeightFilter(WeightFilterMedian, 3, 0)
+	assert.True(t, f.Enabled())
+	assert.Equal(t, []float64{20000, 20050, 20000, 20100, 19990}, applyAll(f, 20000, 20100, 19990, 26000, 19900))
+}
+
+func TestWeightFilter_Ema(t *testing.T) {
+	f := NewWeightFilter(WeightFilterEma, 3, 0) // smoothing factor 0.5
+	assert.Equal(t, []float64{20000, 19000, 18500}, applyAll(f, 20000, 18000, 18000))
+}
+
+func TestWeightFilter_MaxDelta(t *testing.T) {
+	f := NewWeightFilter(WeightFilterNone, 3, 2000)
+
+	filtered, accepted := f.Apply(20000)
+	assert.True(t, accepted)
+	assert.Equal(t, 20000.0, filtered)
+
+	filtered, accepted = f.Apply(35000) // someone leaned on the keg
+	assert.False(t, accepted)
+	assert.Equal(t, 20000.0, filtered)
+
+	assert.Equal(t, []float64{19500}, applyAll(f, 19500))
+
+	// a new keg holds its weight for the whole window
+	assert.Equal(t, []float64{35000, 34990}, applyAll(f, 35000, 35000, 35000, 34990))
+}
+
+func TestWeightFilter_Disabled(t *testing.T) {
+	assert.False(t, NewWeightFilter(WeightFilterNone, 5, 0).Enabled())
+}
+
+func TestScale_WeightFilter(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	s.filter = NewWeightFilter(WeightFilterMedian, 3, 3000)
+
+	for _, weight := range []float64{20000, 20010, 29000, 19990} {
+		assert.Nil(t, s.AddMeasurement(weight, SourceHttp))
+	}
+	assert.Equal(t, 20000.0, s.Weight)
+
+	stored, err := s.store.GetMeasurements(s.WeightAt.Add(-time.Minute), s.WeightAt.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Len(t, stored, 4, "the outlier is stored for debugging")
+	assert.Equal(t, 29000.0, stored[2].Raw)
+	assert.Equal(t, 20005.0, stored[2].Weight)
+	assert.Equal(t, 1.0, counterValue(t, s.monitor, "scale_weight_outliers_total"))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FirmwareUpdateHeader is set on responses to scale messages of outdated firmware, it holds the latest version
+const FirmwareUpdateHeader = "X-Firmware-Update"
+
+var firmwareSha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// FirmwareRelease is the latest firmware of the scale offered for the OTA update
+type FirmwareRelease struct {
+	Version     string    `json:"version"` // major.minor.patch, see FIRMWARE_VERSION of the firmware
+	Url         string    `json:"url"`     // binary to download
+	Sha256      string    `json:"sha256"`  // hex checksum of the binary
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Validate returns an error if the release could not be offered to the scale
+func (fr FirmwareRelease) Validate() error {
+	if !firmwareVersionPattern.MatchString(fr.Version) {
+		return fmt.Errorf("version %q is not in the format major.minor.patch", fr.Version)
+	}
+	if u, err := url.Parse(fr.Url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url %q is not a http(s) url", fr.Url)
+	}
+	if !firmwareSha256Pattern.MatchString(fr.Sha256) {
+		return fmt.Errorf("sha256 %q is not a hex checksum", fr.Sha256)
+	}
+
+	return nil
+}
+
+// compareVersions returns -1, 0 or 1 if the version a is older, equal or newer than b
+// both versions are expected to match firmwareVersionPattern
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// FirmwareRegistry holds the latest firmware release
+// the release uploaded by the admin beats the one configured by FIRMWARE_* variables
+type FirmwareRegistry struct {
+	mu      sync.RWMutex
+	store   Storage
+	release *FirmwareRelease // nil if no release is known
+}
+
+func NewFirmwareRegistry(config *Config, store Storage) *FirmwareRegistry {
+	fr := &FirmwareRegistry{store: store}
+
+	if release, err := store.GetFirmware(); err == nil {
+		fr.release = &release
+	} else if config.FirmwareVersion != "" {
+		fr.release = &FirmwareRelease{
+			Version: config.FirmwareVersion,
+			Url:     config.FirmwareUrl,
+			Sha256:  config.FirmwareSha256,
+		}
+	}
+
+	return fr
+}
+
+// Latest returns the latest release, false if none is known
+func (fr *FirmwareRegistry) Latest() (FirmwareRelease, bool) {
+	fr.mu.RLock()
+	defer fr.mu.RUnlock()
+
+	if fr.release == nil {
+		return FirmwareRelease{}, false
+	}
+
+	return *fr.release, true
+}
+
+// Publish validates and stores the release, it's offered to the scales right away
+// an older version is accepted as well, so a broken release can be rolled back
+func (fr *FirmwareRegistry) Publish(release FirmwareRelease, now time.Time) (FirmwareRelease, error) {
+	release.Sha256 = strings.ToLower(release.Sha256)
+	if err := release.Validate(); err != nil {
+		return FirmwareRelease{}, err
+	}
+	release.PublishedAt = now
+
+	if err := fr.store.SetFirmware(release); err != nil {
+		return FirmwareRelease{}, fmt.Errorf("could not store firmware: %w", err)
+	}
+
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.release = &release
+
+	return release, nil
+}
+
+// UpdateFor returns the latest version if the scale runs an older one
+// scales with the firmware not reporting its version are not hinted, they could not update anyway
+func (fr *FirmwareRegistry) UpdateFor(version string) (string, bool) {
+	latest, found := fr.Latest()
+	if !found || version == "" {
+		return "", false
+	}
+
+	if compareVersions(version, latest.Version) >= 0 {
+		return "", false
+	}
+
+	return latest.Version, true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const testFirmwareSha256 = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("1.2.3", "1.2.3"))
+	assert.Equal(t, -1, compareVersions("1.2.3", "1.10.0"), "numbers are not compared as strings")
+	assert.Equal(t, 1, compareVersions("2.0.0", "1.99.99"))
+	assert.Equal(t, -1, compareVersions("1.2.3", "1.2.4"))
+}
+
+func TestFirmwareRegistry(t *testing.T) {
+	config := NewConfig()
+	config.FirmwareVersion = "1.1.0"
+	config.FirmwareUrl = "https://example.com/scale-1.1.0.bin"
+	config.FirmwareSha256 = testFirmwareSha256
+
+	store := &FakeStore{}
+	registry := NewFirmwareRegistry(config, store)
+	latest, found := registry.Latest()
+	assert.True(t, found)
+	assert.Equal(t, "1.1.0", latest.Version, "configured release without an uploaded one")
+
+	_, outdated := registry.UpdateFor("")
+	assert.False(t, outdated, "the version is unknown")
+	_, outdated = registry.UpdateFor("1.1.0")
+	assert.False(t, outdated)
+	version, outdated := registry.UpdateFor("1.0.9")
+	assert.True(t, outdated)
+	assert.Equal(t, "1.1.0", version)
+
+	now := time.Now()
+	_, err := registry.Publish(FirmwareRelease{Version: "1.2", Url: "https://example.com/scale.bin", Sha256: testFirmwareSha256}, now)
+	assert.NotNil(t, err)
+	_, err = registry.Publish(FirmwareRelease{Version: "1.2.0", Url: "ftp://example.com/scale.bin", Sha256: testFirmwareSha256}, now)
+	assert.NotNil(t, err)
+	_, err = registry.Publish(FirmwareRelease{Version: "1.2.0", Url: "https://example.com/scale.bin", Sha256: "abc"}, now)
+	assert.NotNil(t, err)
+
+	published, err := registry.Publish(FirmwareRelease{Version: "1.2.0", Url: "https://example.com/scale-1.2.0.bin", Sha256: strings.ToUpper(testFirmwareSha256)}, now)
+	assert.Nil(t, err)
+	assert.Equal(t, testFirmwareSha256, published.Sha256)
+
+	// uploaded release beats the configured one after the restart
+	registry = NewFirmwareRegistry(config, store)
+	latest, _ = registry.Latest()
+	assert.Equal(t, "1.2.0", latest.Version)
+	assert.True(t, latest.PublishedAt.Equal(now))
+}
+
+func TestFirmwareHandler(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	monitor := NewMonitor()
+	hr := &HandlerRepository{
+		scale:    NewScale(config, monitor, &FakeStore{}, logger),
+		config:   config,
+		monitor:  monitor,
+		capture:  NewCapture(config),
+		mirror:   NewMirror(config, monitor, logger),
+		firmware: NewFirmwareRegistry(config, &FakeStore{}),
+		logger:   logger,
+	}
+
+	w := httptest.NewRecorder()
+	hr.firmwareHandler()(w, httptest.NewRequest(http.MethodGet, "/api/firmware", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	body := `{"version": "1.1.0", "url": "https://example.com/scale-1.1.0.bin", "sha256": "` + testFirmwareSha256 + `"}`
+	w = httptest.NewRecorder()
+	hr.firmwareHandler()(w, httptest.NewRequest(http.MethodPost, "/api/firmware", strings.NewReader(body)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/firmware", strings.NewReader(body))
+	r.Header.Set("Authorization", config.Password)
+	w = httptest.NewRecorder()
+	hr.firmwareHandler()(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	hr.firmwareHandler()(w, httptest.NewRequest(http.MethodGet, "/api/firmware", nil))
+	var release FirmwareRelease
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &release))
+	assert.Equal(t, "1.1.0", release.Version)
+	assert.Equal(t, "https://example.com/scale-1.1.0.bin", release.Url)
+
+	push := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/scale/push", strings.NewReader(body))
+		r.Header.Set("Authorization", config.AuthToken)
+		w := httptest.NewRecorder()
+		hr.scaleMessageHandler()(w, r)
+		return w
+	}
+
+	w = push("ping|1|-70||fw=1.0.0")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1.1.0", w.Header().Get(FirmwareUpdateHeader))
+	assert.Equal(t, "OK", w.Body.String())
+	assert.Empty(t, push("ping|2|-70||fw=1.1.0").Header().Get(FirmwareUpdateHeader))
+	assert.Empty(t, push("ping|3|-70|").Header().Get(FirmwareUpdateHeader), "old firmware does not report its version")
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"backend/scalepb"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// GrpcIngest serves [scalepb.ScaleIngestServer] for gateways aggregating more scales (e.g. LoRa)
+// messages are processed by the same pipeline as the HTTP and MQTT ones
+type GrpcIngest struct {
+	scalepb.UnimplementedScaleIngestServer
+	hr     *HandlerRepository
+	logger *logrus.Logger
+}
+
+func NewGrpcIngest(hr *HandlerRepository, logger *logrus.Logger) *GrpcIngest {
+	return &GrpcIngest{hr: hr, logger: logger}
+}
+
+// scaleMessageFromProto converts the protobuf message, it's validated by [ParseScaleMessage] later
+func scaleMessageFromProto(message *scalepb.ScaleMessage) ScaleMessage {
+	converted := ScaleMessage{
+		MessageType: message.GetType(),
+		Device:      message.GetDevice(),
+		MessageId:   message.GetMessageId(),
+		Rssi:        message.GetRssi(),
+		Value:       message.GetValue(),
+		Config:      message.GetConfig(),
+		Firmware:    message.GetFirmware(),
+	}
+	if message.Temperature != nil {
+		temperature := message.GetTemperature()
+		converted.Sensors.Temperature = &temperature
+	}
+	if message.Battery != nil {
+		battery := message.GetBattery()
+		converted.Sensors.Battery = &battery
+	}
+
+	return converted
+}
+
+// grpcCode maps HTTP status of [HandlerRepository.ingestMessage] to the gRPC code
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	}
+
+	return codes.Internal
+}
+
+// ingest processes a single live message
+func (gi *GrpcIngest) ingest(ctx context.Context, message *scalepb.ScaleMessage) error {
+	if err := gi.authorizeDevice(ctx, message.GetDevice()); err != nil {
+		return err
+	}
+	if gi.hr.deviceLimiter != nil && !gi.hr.deviceLimiter.Allow(message.GetDevice()) {
+		gi.hr.monitor.ingestRejected.WithLabelValues("device_rate_limit").Inc()
+		return status.Errorf(codes.ResourceExhausted, "device %q exceeded the rate limit", message.GetDevice())
+	}
+
+	if httpStatus, err := gi.hr.ingestMessage(FormatScaleMessage(scaleMessageFromProto(message)), SourceGrpc); err != nil {
+		return status.Error(grpcCode(httpStatus), err.Error())
+	}
+
+	return nil
+}
+
+// Push processes a single live message
+func (gi *GrpcIngest) Push(ctx context.Context, message *scalepb.ScaleMessage) (*scalepb.PushReply, error) {
+	if err := gi.ingest(ctx, message); err != nil {
+		return nil, err
+	}
+
+	return &scalepb.PushReply{}, nil
+}
+
+// Stream processes live messages until the gateway closes the stream
+// a rejected message does not break the stream, other scales of the gateway keep reporting
+func (gi *GrpcIngest) Stream(stream scalepb.ScaleIngest_StreamServer) error {
+	reply := &scalepb.StreamReply{}
+	for {
+		message, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(reply)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := gi.ingest(stream.Context(), message); err != nil {
+			gi.logger.Warnf("Scale message of the gRPC stream rejected: %v", err)
+			reply.Rejected++
+			continue
+		}
+		reply.Accepted++
+	}
+}
+
+// Batch stores messages buffered by the gateway while it was offline
+// unlike the HTTP batch the messages may come from more scales, each scale gets its own batch
+func (gi *GrpcIngest) Batch(stream scalepb.ScaleIngest_BatchServer) error {
+	batches := map[string][]BatchEntry{}
+	received := 0
+	for {
+		entry, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		received++
+		if received > maxBatchMessages {
+			return status.Errorf(codes.ResourceExhausted, "batch has more than %d messages", maxBatchMessages)
+		}
+
+		message, err := ParseScaleMessage(FormatScaleMessage(scaleMessageFromProto(entry.GetMessage())))
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "message %d: %v", received, err)
+		}
+		batches[message.Device] = append(batches[message.Device], BatchEntry{At: time.Unix(entry.GetAt(), 0), Message: message})
+	}
+
+	devices := make([]string, 0, len(batches))
+	for device := range batches {
+		if _, found := gi.hr.scaleOf(device); !found {
+			return status.Errorf(codes.NotFound, "unknown device %q", device)
+		}
+		if err := gi.authorizeDevice(stream.Context(), device); err != nil {
+			return err
+		}
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	reply := &scalepb.BatchReply{}
+	now := time.Now()
+	for _, device := range devices {
+		scale, _ := gi.hr.scaleOf(device)
+		result, err := ingestBatch(scale, batches[device], now)
+		if err != nil {
+			gi.logger.Errorf("Could not store buffered measurements of %q: %v", device, err)
+			return status.Error(codes.Internal, "could not store measurements")
+		}
+		reply.Stored += uint32(result.Stored)
+		reply.Processed += uint32(result.Processed)
+		reply.Skipped += uint32(result.Skipped)
+
+		gi.logger.WithFields(logrus.Fields{
+			"device":    device,
+			"stored":    result.Stored,
+			"processed": result.Processed,
+			"skipped":   result.Skipped,
+		}).Info("Scale batch received through gRPC")
+	}
+
+	return stream.SendAndClose(reply)
+}
+
+// grpcClientCert returns the client certificate verified by our CA, nil if the gateway has none
+func grpcClientCert(ctx context.Context) *x509.Certificate {
+	if p, found := peer.FromContext(ctx); found {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.VerifiedChains) > 0 {
+			return info.State.VerifiedChains[0][0]
+		}
+	}
+
+	return nil
+}
+
+// authorize applies the rules of [HandlerRepository.authenticateDevice] to the gateway:
+// a client certificate verified by our CA (GRPC_TLS), or the token of the scale or a device-ingest token
+// in the authorization metadata unless SCALE_TOKEN_AUTH is disabled, admin tokens are refused
+// the certificate is bound to scales like on HTTP, see [GrpcIngest.authorizeDevice]
+func (gi *GrpcIngest) authorize(ctx context.Context) error {
+	if grpcClientCert(ctx) != nil {
+		return nil
+	}
+
+	if !gi.hr.config.ScaleTokenAuth {
+		return status.Error(codes.Unauthenticated, "client certificate is required, tokens are disabled")
+	}
+	token := ""
+	if md, found := metadata.FromIncomingContext(ctx); found {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = values[0]
+		}
+	}
+	if !gi.hr.allowsDeviceToken(token) {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return nil
+}
+
+// authorizeDevice checks the client certificate of the gateway is issued for the device it forwards
+// the CA issues certificates of single scales too, the gateway lists all its scales as DNS names
+// gateways authenticated by the token forward any scale
+func (gi *GrpcIngest) authorizeDevice(ctx context.Context, device string) error {
+	if cert := grpcClientCert(ctx); cert != nil && !certificateOf(cert, device) {
+		return status.Errorf(codes.PermissionDenied, "client certificate %q is not issued for the device %q", cert.Subject.CommonName, device)
+	}
+
+	return nil
+}
+
+// grpcTlsConfig serves the certificate of the ingest server, client certificates are verified by INGEST_TLS_CLIENT_CA if set
+// gateways without a certificate authenticate by the token
+func grpcTlsConfig(config *Config) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.IngestTlsCert, config.IngestTlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if config.IngestTlsClientCa != "" {
+		pool, err := loadClientCa(config.IngestTlsClientCa)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// Server creates the gRPC server with the service and its authentication
+func (gi *GrpcIngest) Server(options ...grpc.ServerOption) *grpc.Server {
+	srv := grpc.NewServer(append([]grpc.ServerOption{
+		grpc.MaxRecvMsgSize(gi.hr.config.IngestMaxBody),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := gi.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := gi.authorize(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}, options...)...)
+	scalepb.RegisterScaleIngestServer(srv, gi)
+
+	return srv
+}
+
+// StartGrpcServer serves the gRPC ingestion on [Config.GrpcPort] until the context is cancelled
+func StartGrpcServer(ctx context.Context, ingest *GrpcIngest, config *Config, logger *logrus.Logger) error {
+	var options []grpc.ServerOption
+	if config.GrpcTls {
+		tlsConfig, err := grpcTlsConfig(config)
+		if err != nil {
+			return err
+		}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.GrpcPort))
+	if err != nil {
+		return fmt.Errorf("could not listen: %w", err)
+	}
+
+	srv := ingest.Server(options...)
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			srv.Stop() // streams of gateways would keep it running
+		}
+	}()
+
+	logger.Infof("gRPC server started on port %d", config.GrpcPort)
+	return srv.Serve(listener)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"backend/scalepb"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGrpcIngest(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ScaleDevices = []string{"tap2"}
+	config.Password = "admin"
+	monitor := NewMonitor()
+	store := &FakeStore{}
+
+	scales := NewScaleRegistry(NewScale(config, monitor, store, logger))
+	assert.Nil(t, scales.AddDevices(config, monitor, store, logger))
+	hr := &HandlerRepository{
+		scale:   scales.Default(),
+		scales:  scales,
+		config:  config,
+		monitor: monitor,
+		capture: NewCapture(config),
+		mirror:  NewMirror(config, monitor, logger),
+		logger:  logger,
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	srv := NewGrpcIngest(hr, logger).Server()
+	go func() { _ = srv.Serve(listener) }()
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	defer conn.Close()
+	client := scalepb.NewScaleIngestClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = client.Push(ctx, &scalepb.ScaleMessage{Type: PushMessageType, MessageId: 1, Rssi: -70, Value: 30000})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.Push(metadata.AppendToOutgoingContext(ctx, "authorization", config.Password), &scalepb.ScaleMessage{Type: PushMessageType, MessageId: 1, Rssi: -70, Value: 30000})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "admin token is not meant for devices")
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", config.AuthToken)
+	_, err = client.Push(ctx, &scalepb.ScaleMessage{Type: PushMessageType, MessageId: 1, Rssi: -70, Value: 30000, Temperature: proto.Float64(4.5)})
+	assert.Nil(t, err)
+	assert.Equal(t, 30000.0, hr.scale.Weight)
+	assert.Equal(t, 4.5, *hr.scale.Sensors.Temperature)
+	_, err = client.Push(ctx, &scalepb.ScaleMessage{Type: PushMessageType, Device: "tap3", MessageId: 1, Rssi: -70, Value: 30000})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// an invalid message does not break the stream of the gateway
+	stream, err := client.Stream(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&scalepb.ScaleMessage{Type: PushMessageType, MessageId: 2, Rssi: -70, Value: 29500}))
+	assert.Nil(t, stream.Send(&scalepb.ScaleMessage{Type: "weight", MessageId: 3, Rssi: -70, Value: 29000}))
+	assert.Nil(t, stream.Send(&scalepb.ScaleMessage{Type: PushMessageType, Device: "tap2", MessageId: 1, Rssi: -61, Value: 20000}))
+	assert.Nil(t, stream.Send(&scalepb.ScaleMessage{Type: ConfigMessageType, Device: "tap2", MessageId: 2, Rssi: -61, Config: map[string]string{"ping_interval": "60"}}))
+	reply, err := stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), reply.Accepted)
+	assert.Equal(t, uint64(1), reply.Rejected)
+
+	tap2, _ := scales.Get("tap2")
+	assert.Equal(t, 29500.0, hr.scale.Weight)
+	assert.Equal(t, 20000.0, tap2.Weight)
+	assert.Equal(t, map[string]string{"ping_interval": "60"}, tap2.Status().Shadow.Reported)
+
+	// buffered messages of more scales
+	now := time.Now()
+	hr.scale.WeightAt = now.Add(-time.Hour)
+	tap2.WeightAt = now.Add(-time.Hour)
+	batch, err := client.Batch(ctx)
+	assert.Nil(t, err)
+	for _, entry := range []*scalepb.BatchEntry{
+		{At: now.Add(-time.Minute).Unix(), Message: &scalepb.ScaleMessage{Type: PushMessageType, MessageId: 10, Rssi: -70, Value: 29400}},
+		{At: now.Add(-50 * time.Second).Unix(), Message: &scalepb.ScaleMessage{Type: PingMessageType, MessageId: 11, Rssi: -70}},
+		{At: now.Add(-40 * time.Second).Unix(), Message: &scalepb.ScaleMessage{Type: PushMessageType, Device: "tap2", MessageId: 10, Rssi: -61, Value: 19800}},
+	} {
+		assert.Nil(t, batch.Send(entry))
+	}
+	result, err := batch.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), result.Processed)
+	assert.Equal(t, uint32(1), result.Skipped)
+	assert.Equal(t, 29400.0, hr.scale.Weight)
+	assert.Equal(t, 19800.0, tap2.Weight)
+}
+
+func TestGrpcIngest_Tls(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.GrpcTls = true
+	config.Password = "admin"
+	ca := newTestCa(t)
+	ca.writeTlsFiles(t, config)
+	config.ScaleDevices = []string{"tap2", "tap3"}
+	s := NewScale(config, NewMonitor(), &FakeStore{}, logger)
+	scales := NewScaleRegistry(s)
+	assert.Nil(t, scales.AddDevices(config, s.monitor, s.store, logger))
+	hr := &HandlerRepository{scale: s, scales: scales, config: config, monitor: s.monitor, capture: NewCapture(config), mirror: NewMirror(config, s.monitor, logger), logger: logger}
+
+	tlsConfig, err := grpcTlsConfig(config)
+	assert.Nil(t, err)
+	listener := bufconn.Listen(1 << 20)
+	srv := NewGrpcIngest(hr, logger).Server(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	go func() { _ = srv.Serve(listener) }()
+	defer srv.Stop()
+
+	dial := func(certs []tls.Certificate, token string) (scalepb.ScaleIngestClient, context.Context, func()) {
+		conn, err := grpc.NewClient("passthrough:///localhost",
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+			grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: ca.pool(), Certificates: certs, ServerName: "localhost"})))
+		assert.Nil(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+		}
+		return scalepb.NewScaleIngestClient(conn), ctx, func() { cancel(); _ = conn.Close() }
+	}
+	id := uint64(0)
+	pushDevice := func(certs []tls.Certificate, token string, device string) error {
+		client, ctx, done := dial(certs, token)
+		defer done()
+		id++
+		_, err := client.Push(ctx, &scalepb.ScaleMessage{Type: PingMessageType, Device: device, MessageId: id, Rssi: -70})
+		return err
+	}
+	push := func(certs []tls.Certificate, token string) error {
+		return pushDevice(certs, token, "")
+	}
+	gateway := []tls.Certificate{ca.issue(t, "gateway", "default", "tap2")}
+	tap3 := []tls.Certificate{ca.issue(t, "tap3")}
+
+	assert.Nil(t, push(gateway, ""), "verified gateway needs no token")
+	assert.Nil(t, push(nil, config.AuthToken))
+	assert.Equal(t, codes.Unauthenticated, status.Code(push(nil, config.Password)))
+	assert.NotNil(t, push([]tls.Certificate{newTestCa(t).issue(t, "gateway")}, config.AuthToken), "certificate of another CA")
+
+	// certificates are bound to scales like on HTTP
+	assert.Nil(t, pushDevice(gateway, "", "tap2"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(pushDevice(gateway, "", "tap3")), "the gateway does not forward tap3")
+	assert.Nil(t, pushDevice(tap3, "", "tap3"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(pushDevice(tap3, "", "tap2")), "a single tap can't report for others")
+	assert.Equal(t, codes.PermissionDenied, status.Code(push(tap3, config.AuthToken)), "the token does not widen the certificate")
+
+	client, ctx, done := dial(tap3, "")
+	stream, err := client.Stream(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&scalepb.ScaleMessage{Type: PingMessageType, Device: "tap3", MessageId: 100, Rssi: -70}))
+	assert.Nil(t, stream.Send(&scalepb.ScaleMessage{Type: PingMessageType, Device: "tap2", MessageId: 100, Rssi: -70}))
+	reply, err := stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), reply.GetAccepted())
+	assert.Equal(t, uint64(1), reply.GetRejected())
+
+	batch, err := client.Batch(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, batch.Send(&scalepb.BatchEntry{At: time.Now().Unix(), Message: &scalepb.ScaleMessage{Type: PushMessageType, Device: "tap2", MessageId: 1, Rssi: -70, Value: 20000}}))
+	_, err = batch.CloseAndRecv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	done()
+
+	// only certificates are accepted when token auth is disabled
+	config.ScaleTokenAuth = false
+	assert.Equal(t, codes.Unauthenticated, status.Code(push(nil, config.AuthToken)))
+	assert.Nil(t, push(gateway, ""))
+}
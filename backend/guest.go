@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Guest links grant short-lived read access to the dashboard
+// without sharing the admin password or a permanent public token.
+// Token format: <expiration unix seconds>.<base64url HMAC-SHA256 of the expiration>
+// Tokens are signed by the admin password, so changing it revokes all links.
+
+const guestTokenPrefix = "guest:"
+
+// SignGuestToken creates a guest token valid until expiresAt
+func SignGuestToken(secret string, expiresAt time.Time) string {
+	exp := strconv.FormatInt(expiresAt.Unix(), 10)
+	return exp + "." + guestSignature(secret, exp)
+}
+
+// VerifyGuestToken checks the signature and expiration of the guest token
+// and returns its expiration
+func VerifyGuestToken(secret, token string, now time.Time) (time.Time, error) {
+	exp, sig, found := strings.Cut(token, ".")
+	if !found {
+		return time.Time{}, fmt.Errorf("invalid token format")
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(guestSignature(secret, exp))) {
+		return time.Time{}, fmt.Errorf("invalid token signature")
+	}
+
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid token expiration")
+	}
+
+	expiresAt := time.Unix(unix, 0)
+	if !now.Before(expiresAt) {
+		return time.Time{}, fmt.Errorf("token expired at %s", expiresAt.Format(time.RFC3339))
+	}
+
+	return expiresAt, nil
+}
+
+func guestSignature(secret, exp string) string {
+	mac := hmac.New(sha256.New, []byte(guestTokenPrefix+secret))
+	mac.Write([]byte(exp))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
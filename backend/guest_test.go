@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuestToken(t *testing.T) {
+	now := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	token := SignGuestToken("secret", now.Add(3*time.Hour))
+
+	expiresAt, err := VerifyGuestToken("secret", token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(3*time.Hour).Unix(), expiresAt.Unix())
+
+	_, err = VerifyGuestToken("secret", token, now.Add(3*time.Hour))
+	assert.Error(t, err, "expired token")
+
+	_, err = VerifyGuestToken("changed", token, now)
+	assert.Error(t, err, "password changed")
+
+	_, err = VerifyGuestToken("secret", "9999999999."+token[len("1717282800."):], now)
+	assert.Error(t, err, "tampered expiration")
+
+	_, err = VerifyGuestToken("secret", "garbage", now)
+	assert.Error(t, err)
+}
@@ -1,103 +1,3666 @@
 package main
 
 import (
+	"bytes"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/gorilla/mux"
 	"github.com/hako/durafmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"io"
 	"net/http"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type HandlerRepository struct {
-	scale   *Scale
-	config  *Config
-	monitor *Monitor
-	logger  *logrus.Logger
+	scale     *Scale         // default scale
+	scales    *ScaleRegistry // nil serves only the default scale
+	config    *Config
+	monitor   *Monitor
+	exporter  *Exporter
+	mirror    *Mirror
+	capture   *Capture
+	holidays  *HolidayCalendar
+	selfCheck *SelfChecker
+	retention *Retention
+	community *Community
+	wal       *WalStore         // nil when writes are not buffered
+	firmware  *FirmwareRegistry // nil offers no firmware
+	sequence  *MessageSequence  // nil accepts all messages
+	replays   *SignatureReplays // nil does not remember accepted signatures
+	sources   *SourcePolicy     // nil processes messages of all transports
+	pubs      *TenantRegistry   // pubs hosted next to the default one, nil without them
+	logger    *logrus.Logger
+
+	publicLimiter *RateLimiter
+	ratingLimiter *RateLimiter
+	ingestLimiter *RateLimiter // per client address, nil disables the limit
+	deviceLimiter *RateLimiter // per device, nil disables the limit
+
+	now func() time.Time // clock of the server, nil is time.Now
+}
+
+// clock returns the current time of the server, tests fix it by [HandlerRepository.now]
+func (hr *HandlerRepository) clock() time.Time {
+	if hr.now != nil {
+		return hr.now()
+	}
+	return time.Now()
+}
+
+func (hr *HandlerRepository) scaleStatusHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hr.log(r).Info("Scale status requested")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		if param := r.URL.Query().Get("at"); param != "" {
+			at, err := time.Parse(time.RFC3339, param)
+			if err != nil || at.After(time.Now()) {
+				http.Error(w, "Invalid at", http.StatusBadRequest)
+				return
+			}
+
+			status, err := scale.StatusAt(at)
+			if errors.Is(err, errNoHistory) {
+				http.Error(w, "No measurement before the time", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				hr.log(r).Errorf("Could not reconstruct status at %s: %v", at, err)
+				http.Error(w, "Could not reconstruct status", http.StatusInternalServerError)
+				return
+			}
+
+			res, err := json.Marshal(status)
+			if err != nil {
+				http.Error(w, "Could not marshal state to JSON", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(res)
+			return
+		}
+
+		data, err := scale.JsonState()
+
+		if err != nil {
+			http.Error(w, "Could not marshal state to JSON", http.StatusInternalServerError)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// scalesHandler lists scales of all taps, the default scale has an empty device id
+func (hr *HandlerRepository) scalesHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		type output struct {
+			Device    string    `json:"device"`
+			IsOk      bool      `json:"is_ok"`
+			ActiveKeg int       `json:"active_keg"`
+			BeersLeft int       `json:"beers_left"`
+			Weight    float64   `json:"weight"`
+			WeightAt  time.Time `json:"weight_at"`
+		}
+
+		devices := []string{""}
+		if hr.scales != nil {
+			devices = hr.scales.Devices()
+		}
+
+		scales := make([]output, 0, len(devices))
+		for _, device := range devices {
+			scale, _ := hr.scaleOf(device)
+			scales = append(scales, output{
+				Device:    device,
+				IsOk:      scale.IsOk(),
+				ActiveKeg: scale.ActiveKeg,
+				BeersLeft: scale.BeersLeft,
+				Weight:    scale.Weight,
+				WeightAt:  scale.WeightAt,
+			})
+		}
+
+		res, err := json.Marshal(scales)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+func (hr *HandlerRepository) scaleMessageHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := clientIp(r, hr.config.TrustForwarded)
+		if hr.ingestLimiter != nil && !hr.ingestLimiter.Allow(ip.String()) {
+			hr.rejectIngest(w, r, "rate_limit", fmt.Sprintf("client %s exceeded the rate limit", ip))
+			return
+		}
+
+		maxBody := int64(hr.config.IngestMaxBody)
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				hr.rejectIngest(w, r, "body_size", fmt.Sprintf("message is larger than %d bytes", maxBody))
+				return
+			}
+			http.Error(w, "Could not read post body", http.StatusInternalServerError)
+			return
+		}
+
+		if err := hr.authenticateScale(r, string(body)); err != nil {
+			hr.log(r).Warnf("Scale message rejected: %v", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if hr.replayedSignature(r) {
+			// the signed message was accepted already, a retry of the device only needs the acknowledgement
+			hr.monitor.messagesDropped.WithLabelValues(hr.monitor.guard.Labels("scale_messages_dropped_total", "replay")...).Inc()
+			hr.log(r).Infof("Dropped replayed scale message: %s", body)
+		} else {
+			// limited after the authentication, so nobody can exhaust the limit of somebody else's device
+			if hr.deviceLimiter != nil {
+				message, _ := ParseScaleMessage(string(body))
+				if !hr.deviceLimiter.Allow(message.Device) {
+					hr.rejectIngest(w, r, "device_rate_limit", fmt.Sprintf("device %q exceeded the rate limit", message.Device))
+					return
+				}
+			}
+
+			if status, err := hr.ingestMessage(string(body), SourceHttp); err != nil {
+				http.Error(w, err.Error(), status)
+				return
+			}
+		}
+
+		// the firmware checks only the status code, the hint is in the header so the body stays the same
+		message, _ := ParseScaleMessage(string(body))
+		if hr.firmware != nil {
+			if latest, outdated := hr.firmware.UpdateFor(message.Firmware); outdated {
+				w.Header().Set(FirmwareUpdateHeader, latest)
+			}
+		}
+
+		// newer firmware asks for the acknowledgement, older one keeps getting the plain OK
+		if !strings.Contains(r.Header.Get("Accept"), "application/json") {
+			_, _ = w.Write([]byte("OK"))
+			return
+		}
+
+		res, err := json.Marshal(hr.scaleAck(message.Device, time.Now()))
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// ScaleAck acknowledges messages of the scale, delivery is at-least-once:
+// the device retries messages after the acknowledged id on reconnect, duplicates are dropped by [MessageSequence]
+// and it corrects the drift of its clock by the server time
+type ScaleAck struct {
+	Device       string     `json:"device"`         // empty for the default scale
+	MessageId    uint64     `json:"message_id"`     // last accepted message, 0 if the device never sent any
+	AcceptedAt   *time.Time `json:"accepted_at"`    // arrival of the last accepted message, nil if none
+	ServerTime   time.Time  `json:"server_time"`    // time of the response
+	ServerUnixMs int64      `json:"server_unix_ms"` // the same as server_time, the firmware does not parse dates
+}
+
+// scaleAck returns the acknowledgement of the device at now
+func (hr *HandlerRepository) scaleAck(device string, now time.Time) ScaleAck {
+	ack := ScaleAck{Device: device, ServerTime: now, ServerUnixMs: now.UnixMilli()}
+	if hr.sequence != nil {
+		if id, at, found := hr.sequence.LastAccepted(device); found {
+			ack.MessageId = id
+			ack.AcceptedAt = &at
+		}
+	}
+
+	return ack
+}
+
+// scaleLastAckHandler returns the acknowledgement of the last accepted message of the device
+// the device calls it after a reconnect to know which buffered messages have to be resent
+func (hr *HandlerRepository) scaleLastAckHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// signed requests sign the empty body
+		device := r.URL.Query().Get("device")
+		if err := hr.authenticateDevice(r, "", device); err != nil {
+			hr.log(r).Warnf("Last ack request rejected: %v", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if _, found := hr.scaleOf(device); !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		res, err := json.Marshal(hr.scaleAck(device, time.Now()))
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// buffered measurements are accepted within this window
+const (
+	maxBatchAge  = 7 * 24 * time.Hour
+	maxBatchSkew = time.Minute // device clock may be slightly ahead
+)
+
+// BatchResult is the response of the batch endpoint
+type BatchResult struct {
+	Stored    int `json:"stored"`    // older than the current weight, added to the history only
+	Processed int `json:"processed"` // newer than the current weight, processed like live measurements
+	Skipped   int `json:"skipped"`   // out of the time window or weight range, pings and config reports
+}
+
+// scaleBatchHandler accepts messages buffered by the device while it was offline
+// measured values are inserted to the history at their device-side time, see [ParseScaleBatch] for the format
+func (hr *HandlerRepository) scaleBatchHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ip := clientIp(r, hr.config.TrustForwarded)
+		if hr.ingestLimiter != nil && !hr.ingestLimiter.Allow(ip.String()) {
+			hr.rejectIngest(w, r, "rate_limit", fmt.Sprintf("client %s exceeded the rate limit", ip))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				hr.rejectIngest(w, r, "body_size", fmt.Sprintf("batch is larger than %d bytes", maxBatchBody))
+				return
+			}
+			http.Error(w, "Could not read post body", http.StatusInternalServerError)
+			return
+		}
+
+		entries, err := ParseScaleBatch(body, strings.HasPrefix(r.Header.Get("Content-Type"), "application/json"))
+		if err != nil {
+			hr.log(r).Warnf("Could not parse scale batch: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		device := entries[0].Message.Device
+
+		if err := hr.authenticateDevice(r, string(body), device); err != nil {
+			hr.log(r).Warnf("Scale batch rejected: %v", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scale, found := hr.scaleOf(device)
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		result, err := ingestBatch(scale, entries, time.Now())
+		if err != nil {
+			hr.log(r).Errorf("Could not store buffered measurements: %v", err)
+			http.Error(w, "Could not store measurements", http.StatusInternalServerError)
+			return
+		}
+
+		hr.log(r).WithFields(logrus.Fields{
+			"device":    device,
+			"stored":    result.Stored,
+			"processed": result.Processed,
+			"skipped":   result.Skipped,
+		}).Info("Scale batch received")
+
+		res, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// ingestBatch adds buffered messages of a single scale to the history at their device-side time
+// regardless of the transport (HTTP, gRPC)
+func ingestBatch(scale *Scale, entries []BatchEntry, now time.Time) (BatchResult, error) {
+	calibration, _, _ := scale.GetCalibration()
+	measurements := make([]Measurement, 0, len(entries))
+	skipped := 0
+	for _, entry := range entries {
+		message := entry.Message
+		if entry.At.Before(now.Add(-maxBatchAge)) || entry.At.After(now.Add(maxBatchSkew)) {
+			skipped++
+			continue
+		}
+
+		switch {
+		case message.MessageType == PushMessageType:
+			measurements = append(measurements, Measurement{Weight: message.Value, At: entry.At, Source: SourceBatch, Sensors: message.Sensors})
+		case message.MessageType == RawMessageType && calibration != nil:
+			measurements = append(measurements, Measurement{Weight: calibration.Convert(message.Value), At: entry.At, Source: SourceBatch, Sensors: message.Sensors})
+		default:
+			// pings and config reports are outdated, raw values can't be converted without calibration
+			skipped++
+		}
+	}
+
+	stored, processed, err := scale.AddBufferedMeasurements(measurements)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	skipped += len(measurements) - stored - processed
+
+	return BatchResult{Stored: stored, Processed: processed, Skipped: skipped}, nil
+}
+
+// rejectIngest refuses the scale message over a limit with 429 or 413
+func (hr *HandlerRepository) rejectIngest(w http.ResponseWriter, r *http.Request, reason string, detail string) {
+	hr.monitor.ingestRejected.WithLabelValues(reason).Inc()
+	hr.log(r).Warnf("Scale message rejected: %s", detail)
+
+	if reason == "body_size" {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.Header().Set("Retry-After", "60")
+	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+}
+
+// authenticateScale checks the message comes from the scale
+// signed messages are verified by the secret of the device, the device connected to the mTLS port
+// is already authenticated by its certificate, the shared token is accepted only during migration
+func (hr *HandlerRepository) authenticateScale(r *http.Request, body string) error {
+	// unparsable message is rejected later, the default secret is used for it
+	message, _ := ParseScaleMessage(body)
+	return hr.authenticateDevice(r, body, message.Device)
+}
+
+// authenticateDevice checks the body was sent by the scale of the device
+// a verified client certificate has to be issued for the device, a scale can't report for another one
+func (hr *HandlerRepository) authenticateDevice(r *http.Request, body string, device string) error {
+	if cert := verifiedClientCert(r); cert != nil {
+		if !certificateOf(cert, device) {
+			return fmt.Errorf("client certificate %q is not issued for the device %q", cert.Subject.CommonName, device)
+		}
+		return nil
+	}
+
+	if r.Header.Get(ScaleSignatureHeader) != "" {
+		now := hr.clock()
+		if err := VerifyScaleSignature(r, body, device, hr.config.ScaleSecrets, hr.config.SignatureMaxAge, now); err != nil {
+			return err
+		}
+		// the signed timestamp is the clock of the device
+		if at, ok := scaleTimestamp(r); ok {
+			if scale, found := hr.scaleOf(device); found {
+				scale.SetClockSkew(at.Sub(now), now)
+			}
+		}
+		return nil
+	}
+
+	if !hr.config.ScaleTokenAuth {
+		return errMissingSignature
+	}
+	if !hr.allowsDeviceToken(r.Header.Get("Authorization")) {
+		return errors.New("invalid token")
+	}
+
+	return nil
+}
+
+// replayedSignature returns true if the signed message was accepted already
+// a replayed lower message id would pass [MessageSequence] as a restart of the device
+func (hr *HandlerRepository) replayedSignature(r *http.Request) bool {
+	signature := r.Header.Get(ScaleSignatureHeader)
+	at, ok := scaleTimestamp(r)
+	if hr.replays == nil || signature == "" || !ok {
+		return false
+	}
+
+	return !hr.replays.Accept(signature, at.Add(hr.config.SignatureMaxAge), hr.clock())
+}
+
+// allowsDeviceToken returns true for the token of the scale and device-ingest tokens
+// admin tokens are not meant for devices
+func (hr *HandlerRepository) allowsDeviceToken(auth string) bool {
+	scope, _ := hr.config.TokenScope(auth)
+	return auth == hr.config.AuthToken || scope == ScopeDeviceIngest
+}
+
+// scaleOf returns the scale of the device, empty id is the default scale
+func (hr *HandlerRepository) scaleOf(device string) (*Scale, bool) {
+	if device == "" {
+		return hr.scale, true
+	}
+	if hr.scales == nil {
+		return nil, false
+	}
+
+	return hr.scales.Get(device)
+}
+
+// registryHandler exports ids, secrets and calibrations of all scales (GET)
+// or imports them from an export of another instance (POST)
+func (hr *HandlerRepository) registryHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scales := hr.scales
+		if scales == nil {
+			scales = NewScaleRegistry(hr.scale)
+		}
+
+		var res []byte
+		var err error
+
+		switch r.Method {
+		case http.MethodGet:
+			res, err = json.Marshal(scales.Export(hr.config.ScaleSecrets))
+		case http.MethodPost:
+			var data RegistryExport
+			if derr := json.NewDecoder(r.Body).Decode(&data); derr != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			result, ierr := scales.Import(data, hr.config)
+			if ierr != nil {
+				hr.log(r).Warnf("Could not import scale registry: %v", ierr)
+				http.Error(w, fmt.Sprintf("Could not import registry: %v", ierr), http.StatusBadRequest)
+				return
+			}
+			res, err = json.Marshal(result)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// ingestMessage processes a single pipe-delimited scale message regardless of the transport (HTTP, MQTT)
+// it returns HTTP status describing the failure together with the error
+func (hr *HandlerRepository) ingestMessage(body string, source string) (int, error) {
+	if err := hr.capture.Record(time.Now(), body); err != nil {
+		hr.logger.Warnf("Could not capture scale message: %v", err)
+	}
+
+	message, err := ParseScaleMessage(body)
+	if err != nil {
+		hr.logger.Warnf("Could not parse scale message: %s because %v", body, err)
+		return http.StatusBadRequest, err
+	}
+
+	scale, found := hr.scaleOf(message.Device)
+	if !found {
+		hr.logger.Warnf("Scale message from unknown device: %s", body)
+		return http.StatusNotFound, fmt.Errorf("unknown device %q", message.Device)
+	}
+
+	if hr.sources != nil && !hr.sources.Allow(message.Device, source, time.Now()) {
+		// the preferred transport delivers the same data
+		hr.monitor.messagesDropped.WithLabelValues(hr.monitor.guard.Labels("scale_messages_dropped_total", "source")...).Inc()
+		hr.logger.Debugf("Dropped scale message received through %s: %s", source, body)
+		return http.StatusOK, nil
+	}
+
+	if hr.sequence != nil {
+		err = hr.sequence.Accept(message.Device, source, message.MessageId, body, time.Now())
+		var duplicate *DuplicateMessageError
+		if errors.As(err, &duplicate) {
+			// already processed, the device only has to stop retrying
+			hr.monitor.messagesDropped.WithLabelValues(hr.monitor.guard.Labels("scale_messages_dropped_total", "duplicate")...).Inc()
+			hr.monitor.duplicateLag.WithLabelValues(hr.monitor.guard.Labels("scale_duplicate_lag_seconds", source)...).Observe(duplicate.Lag.Seconds())
+			hr.logger.Infof("Dropped duplicate scale message received through %s (%v): %s", source, duplicate, body)
+			return http.StatusOK, nil
+		}
+		if errors.Is(err, errStaleMessage) {
+			hr.monitor.messagesDropped.WithLabelValues(hr.monitor.guard.Labels("scale_messages_dropped_total", "stale")...).Inc()
+			hr.logger.Warnf("Dropped stale scale message: %s", body)
+			return http.StatusConflict, err
+		}
+		if cursor, found := hr.sequence.Cursor(message.Device); found {
+			scale.SetLastMessage(cursor)
+		}
+	}
+
+	scale.Ping()
+	scale.SetRssi(message.Rssi)
+	scale.SetSensors(message.Sensors)
+
+	if message.MessageType == PushMessageType {
+		err = scale.AddMeasurement(message.Value, source)
+		if err != nil {
+			hr.logger.Warnf("Could not create measurement: %v", err)
+			return http.StatusInternalServerError, err
+		}
+
+		hr.logger.WithFields(logrus.Fields{
+			"message_id": message.MessageId,
+			"device":     message.Device,
+		}).Infof("Scale new value: %0.2f", message.Value)
+	}
+
+	if message.MessageType == RawMessageType {
+		err = scale.AddRawMeasurement(message.Value, source)
+		if err != nil {
+			hr.logger.Warnf("Could not create measurement: %v", err)
+			return http.StatusConflict, err
+		}
+
+		hr.logger.WithFields(logrus.Fields{
+			"message_id": message.MessageId,
+			"device":     message.Device,
+		}).Infof("Scale new raw value: %0.0f", message.Value)
+	}
+
+	if message.MessageType == ConfigMessageType {
+		if err = scale.ReportConfig(message.Config); err != nil {
+			hr.logger.Warnf("Could not store reported config: %v", err)
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	hr.mirror.Forward(body)
+	return http.StatusOK, nil
+}
+
+// metricsHandler returns HTTP handler for metrics endpoint
+func (hr *HandlerRepository) metricsHandler() http.Handler {
+	return promhttp.HandlerFor(
+		hr.gatherer(),
+		promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+			Registry:          prometheus.WrapRegistererWith(hr.monitor.labels, hr.monitor.Registry),
+		},
+	)
+}
+
+// gatherer gathers metrics of all scales, the default pub gathers also metrics of the hosted pubs
+func (hr *HandlerRepository) gatherer() prometheus.Gatherer {
+	if hr.scales == nil {
+		return hr.monitor.Registry
+	}
+	if hr.pubs != nil {
+		return prometheus.Gatherers{hr.scales.Gatherer(), hr.pubs.Gatherer()}
+	}
+
+	return hr.scales.Gatherer()
+}
+
+// publicMetricsHandler returns HTTP handler exposing only non-sensitive metrics
+// so a community status page can scrape it without seeing the infrastructure
+func (hr *HandlerRepository) publicMetricsHandler() http.Handler {
+	return promhttp.HandlerFor(
+		publicGatherer(hr.gatherer()),
+		promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		},
+	)
+}
+
+// activeKegHandler taps a new keg (POST) or untaps the partially full active keg (DELETE)
+// the untapped keg is tapped again by [HandlerRepository.retapKegHandler]
+func (hr *HandlerRepository) activeKegHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			hr.untapKeg(w, r)
+			return
+		}
+
+		var data activeKegInput
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		if status, err := hr.setActiveKeg(data); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(getOkJson())
+	}
+}
+
+type activeKegInput struct {
+	Keg    int    `json:"keg"`    // size in liters, optional with the model
+	Beer   string `json:"beer"`   // optional name of the beer
+	Model  string `json:"model"`  // optional keg from the catalog
+	Device string `json:"device"` // optional scale of the tap, the default scale if empty
+}
+
+// setActiveKeg taps the keg given by its size or the catalog entry
+// it returns HTTP status and the error message for the client
+func (hr *HandlerRepository) setActiveKeg(data activeKegInput) (int, error) {
+	scale, found := hr.scaleOf(data.Device)
+	if !found {
+		return http.StatusNotFound, errors.New("Unknown device")
+	}
+
+	if data.Model != "" {
+		models, err := hr.scale.store.GetKegModels()
+		if err != nil {
+			return http.StatusInternalServerError, errors.New("Could not load keg models")
+		}
+		model, err := findKegModel(models, data.Model)
+		if err != nil || (data.Keg != 0 && model.Size != data.Keg) {
+			return http.StatusBadRequest, errors.New("Unknown keg model for the keg size")
+		}
+
+		if err = scale.TapKegModel(data.Model, data.Beer); err != nil {
+			hr.logger.Warnf("Could not tap keg model: %v", err)
+			return http.StatusInternalServerError, errors.New("Could not set active keg")
+		}
+		return http.StatusOK, nil
+	}
+
+	switch data.Keg {
+	case 10, 15, 20, 30, 50:
+		// all is well
+	default:
+		return http.StatusBadRequest, errors.New("Invalid keg size")
+	}
+
+	if err := scale.SetActiveKeg(data.Keg, data.Beer); err != nil {
+		return http.StatusInternalServerError, errors.New("Could not set active keg")
+	}
+	return http.StatusOK, nil
+}
+
+// tapHandler receives card taps from the NFC/RFID reader at the tap
+// the next pour is attributed to the holder of the card
+func (hr *HandlerRepository) tapHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeDeviceIngest) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type input struct {
+			Token string `json:"token"` // card UID
+		}
+
+		var data input
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Token == "" {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		person, err := hr.scale.Tap(data.Token, time.Now())
+		if errors.Is(err, errUnknownTapToken) {
+			http.Error(w, "Unknown token", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			hr.log(r).Warnf("Could not process tap: %v", err)
+			http.Error(w, "Could not process tap", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(map[string]string{"name": person.Name}) // greeting on the reader display
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// peopleHandler manages holders of tap tokens, token hashes are never returned
+// POST registers a person, PUT changes the name or the public flag and DELETE removes the person given by id
+func (hr *HandlerRepository) peopleHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type input struct {
+			Name   string `json:"name"`
+			Token  string `json:"token"`
+			Public bool   `json:"public"`
+		}
+
+		people, err := hr.scale.store.GetPeople()
+		if err != nil {
+			http.Error(w, "Could not load people", http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			var data input
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+			person, err := NewPerson(data.Name, data.Token, data.Public, time.Now())
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid person: %v", err), http.StatusBadRequest)
+				return
+			}
+			if _, found := findPersonByToken(people, data.Token); found {
+				http.Error(w, "Token is already registered", http.StatusConflict)
+				return
+			}
+			if err := hr.scale.store.SavePerson(person); err != nil {
+				hr.log(r).Warnf("Could not store person: %v", err)
+				http.Error(w, "Could not store person", http.StatusInternalServerError)
+				return
+			}
+		case http.MethodPut:
+			var data input
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+			person, found := findPerson(people, r.URL.Query().Get("id"))
+			if !found {
+				http.Error(w, "Person not found", http.StatusNotFound)
+				return
+			}
+			if data.Name = strings.TrimSpace(data.Name); data.Name != "" {
+				person.Name = data.Name
+			}
+			person.Public = data.Public
+			if err := hr.scale.store.SavePerson(person); err != nil {
+				hr.log(r).Warnf("Could not store person: %v", err)
+				http.Error(w, "Could not store person", http.StatusInternalServerError)
+				return
+			}
+		case http.MethodDelete:
+			if err := hr.scale.store.DeletePerson(r.URL.Query().Get("id")); err != nil {
+				http.Error(w, "Person not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		if r.Method != http.MethodGet {
+			if people, err = hr.scale.store.GetPeople(); err != nil {
+				http.Error(w, "Could not load people", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		views := make([]PersonView, 0, len(people))
+		for _, p := range people {
+			views = append(views, p.View())
+		}
+
+		res, err := json.Marshal(views)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// peopleStatsHandler returns pours per person of the last days
+// only people who opted in are listed without the admin password
+func (hr *HandlerRepository) peopleStatsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		days := 30
+		if raw := r.URL.Query().Get("days"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 366 {
+				http.Error(w, "Invalid days", http.StatusBadRequest)
+				return
+			}
+			days = parsed
+		}
+
+		people, err := hr.scale.store.GetPeople()
+		if err != nil {
+			http.Error(w, "Could not load people", http.StatusInternalServerError)
+			return
+		}
+		now := time.Now()
+		pours, err := hr.scale.store.GetPours(now.AddDate(0, 0, -days), now)
+		if err != nil {
+			http.Error(w, "Could not load pours", http.StatusInternalServerError)
+			return
+		}
+
+		all := hr.config.Allows(r.Header.Get("Authorization"), ScopeAdmin)
+		res, err := json.Marshal(CalcPeopleStats(people, pours, all))
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// tabsHandler returns open tabs of the current pub day
+func (hr *HandlerRepository) tabsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		hr.writeTabs(w, time.Now())
+	}
+}
+
+// tabsSettleHandler records payment of the tab of the person given by person_id
+// without person_id all open tabs are settled (clearing the board at the end of the night)
+func (hr *HandlerRepository) tabsSettleHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type input struct {
+			PersonId string `json:"person_id"`
+		}
+
+		var data input
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		tabs, err := GetTabs(hr.scale.store, hr.config, pubDayStart(now, hr.config.PubDayStart), now)
+		if err != nil {
+			hr.log(r).Errorf("Could not load tabs: %v", err)
+			http.Error(w, "Could not load tabs", http.StatusInternalServerError)
+			return
+		}
+
+		settled := 0
+		for _, tab := range tabs {
+			if data.PersonId != "" && tab.PersonId != data.PersonId {
+				continue
+			}
+			if err := hr.scale.store.AddSettlement(tab.Settle(now)); err != nil {
+				hr.log(r).Warnf("Could not store settlement: %v", err)
+				http.Error(w, "Could not store settlement", http.StatusInternalServerError)
+				return
+			}
+			settled++
+		}
+		if data.PersonId != "" && settled == 0 {
+			http.Error(w, "No open tab of the person", http.StatusNotFound)
+			return
+		}
+
+		hr.writeTabs(w, now.Add(time.Millisecond)) // settlements are exclusive of [from, to)
+	}
+}
+
+func (hr *HandlerRepository) writeTabs(w http.ResponseWriter, now time.Time) {
+	tabs, err := GetTabs(hr.scale.store, hr.config, pubDayStart(now, hr.config.PubDayStart), now)
+	if err != nil {
+		hr.logger.Errorf("Could not load tabs: %v", err)
+		http.Error(w, "Could not load tabs", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(tabs)
+	if err != nil {
+		http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(res)
+}
+
+// kegModelsHandler manages the catalog of kegs (size, empty weight, brewery, beer)
+// GET is public, POST adds or replaces a model and DELETE removes the one given by id
+func (hr *HandlerRepository) kegModelsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			auth := r.Header.Get("Authorization")
+			if !hr.config.Allows(auth, ScopeAdmin) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			var model KegModel
+			if err := json.NewDecoder(r.Body).Decode(&model); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+			if err := model.Validate(); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid keg model: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := hr.scale.store.SaveKegModel(model); err != nil {
+				hr.log(r).Warnf("Could not store keg model: %v", err)
+				http.Error(w, "Could not store keg model", http.StatusInternalServerError)
+				return
+			}
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "Missing id", http.StatusBadRequest)
+				return
+			}
+			if err := hr.scale.store.DeleteKegModel(id); err != nil {
+				http.Error(w, "Keg model not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		models, err := hr.scale.store.GetKegModels()
+		if err != nil {
+			http.Error(w, "Could not load keg models", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(models)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// taplistHandler returns beers on all taps with the live state of their kegs for the website of the pub (GET)
+// the admin announces the beer on the tap of the device (POST) or removes the announcement (DELETE)
+func (hr *HandlerRepository) taplistHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			auth := r.Header.Get("Authorization")
+			if !hr.config.Allows(auth, ScopeAdmin) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+			if !found {
+				http.Error(w, "Unknown device", http.StatusNotFound)
+				return
+			}
+
+			var beer *TapBeer
+			if r.Method == http.MethodPost {
+				beer = &TapBeer{}
+				if err := json.NewDecoder(r.Body).Decode(beer); err != nil {
+					http.Error(w, "Could not read post body", http.StatusBadRequest)
+					return
+				}
+				if err := beer.Validate(); err != nil {
+					http.Error(w, fmt.Sprintf("Invalid beer: %v", err), http.StatusBadRequest)
+					return
+				}
+				beer.UpdatedAt = time.Now()
+			}
+
+			if err := scale.SetTapBeer(beer); err != nil {
+				hr.log(r).Warnf("Could not store tap beer: %v", err)
+				http.Error(w, "Could not store tap beer", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		devices := []string{""}
+		if hr.scales != nil {
+			devices = hr.scales.Devices()
+		}
+
+		taplist := make([]TapListEntry, 0, len(devices))
+		for _, device := range devices {
+			scale, _ := hr.scaleOf(device)
+			entry := scale.TapListEntry()
+			entry.Device = device
+			taplist = append(taplist, entry)
+		}
+
+		res, err := json.Marshal(taplist)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+func (hr *HandlerRepository) scaleDashboardHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		includes, err := parseDashboardIncludes(r.URL.Query().Get("include"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid include: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		data, err := hr.dashboard(scale, r, includes)
+		if err != nil {
+			hr.log(r).Errorf("Could not build dashboard: %v", err)
+			http.Error(w, "Could not build dashboard", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(data)
+
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+type dashboardWarehouseItem struct {
+	Keg    int `json:"keg"`
+	Amount int `json:"amount"`
+}
+
+type dashboardPub struct {
+	IsOpen   bool   `json:"is_open"`
+	OpenedAt string `json:"opened_at"`
+	ClosedAt string `json:"closed_at"`
+}
+
+// Dashboard is the payload of the dashboard endpoint and WebSocket updates
+type Dashboard struct {
+	IsOk               bool                     `json:"is_ok"`
+	BeersLeft          int                      `json:"beers_left"`
+	LastWeight         float64                  `json:"last_weight"`
+	LastWeightFormated string                   `json:"last_weight_formated"`
+	WeightUnit         string                   `json:"weight_unit"` // unit of the formatted weight
+	LastAt             string                   `json:"last_at"`
+	LastAtDuration     string                   `json:"last_at_duration"`
+	Rssi               float64                  `json:"rssi"`
+	Temperature        *float64                 `json:"temperature"` // °C, nil without the sensor
+	Battery            *float64                 `json:"battery"`     // volts, nil without the battery
+	LastUpdate         string                   `json:"last_update"`
+	LastUpdateDuration string                   `json:"last_update_duration"`
+	Pub                dashboardPub             `json:"pub"`
+	ActiveKeg          int                      `json:"active_keg"`
+	IsLow              bool                     `json:"is_low"`
+	Warehouse          []dashboardWarehouseItem `json:"warehouse"`
+	Cleaning           bool                     `json:"cleaning"`
+	PoursPerHour       int                      `json:"pours_per_hour"`
+	Occupancy          Occupancy                `json:"occupancy"` // how busy the pub is by pours of the scale
+	PendingKeg         *PendingKeg              `json:"pending_keg"`
+	Degraded           bool                     `json:"degraded"`
+	Activity           Activity                 `json:"activity"`
+	Alerts             []ExternalAlert          `json:"alerts"`
+	KegEmptyAt         *time.Time               `json:"keg_empty_at"` // predicted by recent opening hours, nil if unknown or the pub is closed
+
+	// optional sections, see parseDashboardIncludes
+	Keg      *KegYield         `json:"keg,omitempty"` // nil also if no keg is tapped
+	Session  *DashboardSession `json:"session,omitempty"`
+	Forecast *KegForecast      `json:"forecast,omitempty"` // nil also if no keg is tapped
+	Device   *DashboardDevice  `json:"device,omitempty"`
+}
+
+// dashboard builds the dashboard payload of the scale localized for the request
+// with the included optional sections
+func (hr *HandlerRepository) dashboard(scale *Scale, r *http.Request, includes dashboardIncludes) (Dashboard, error) {
+	scale.Recheck()
+
+	locale := resolveLocale(r.Header.Get("Accept-Language"), hr.config.Locale)
+	units, err := durationUnits(locale)
+	if err != nil {
+		return Dashboard{}, err
+	}
+
+	warehouse := []dashboardWarehouseItem{
+		{Keg: 10, Amount: scale.Warehouse[0]},
+		{Keg: 15, Amount: scale.Warehouse[1]},
+		{Keg: 20, Amount: scale.Warehouse[2]},
+		{Keg: 30, Amount: scale.Warehouse[3]},
+		{Keg: 50, Amount: scale.Warehouse[4]},
+	}
+
+	sensors := scale.GetSensors()
+	dashboard := Dashboard{
+		IsOk:               scale.IsOk(),
+		BeersLeft:          scale.BeersLeft,
+		LastWeight:         scale.Weight,
+		LastWeightFormated: formatWeight(scale.Weight, locale),
+		WeightUnit:         display.weightUnit,
+		LastAt:             formatDate(scale.WeightAt),
+		LastAtDuration:     durafmt.Parse(time.Since(scale.WeightAt).Round(time.Second)).LimitFirstN(2).Format(units),
+		Rssi:               scale.Rssi,
+		Temperature:        sensors.Temperature,
+		Battery:            sensors.Battery,
+		LastUpdate:         formatDate(scale.LastOk),
+		LastUpdateDuration: durafmt.Parse(time.Since(scale.LastOk).Round(time.Second)).LimitFirstN(2).Format(units),
+		Pub: dashboardPub{
+			IsOpen:   scale.Pub.IsOpen,
+			OpenedAt: formatTime(scale.Pub.OpenedAt),
+			ClosedAt: formatTime(scale.Pub.ClosedAt),
+		},
+		ActiveKeg:    scale.ActiveKeg,
+		IsLow:        scale.IsLow,
+		Warehouse:    warehouse,
+		Cleaning:     time.Now().Before(scale.CleaningUntil),
+		PoursPerHour: scale.PoursPerHour(),
+		Occupancy:    scale.Occupancy(),
+		PendingKeg:   scale.GetPendingKeg(),
+		Degraded:     scale.IsDegraded(),
+		Activity:     scale.Activity(),
+		Alerts:       scale.ActiveAlerts(),
+		KegEmptyAt:   scale.KegEmptyAt(),
+	}
+
+	now := time.Now()
+	if includes[IncludeKeg] {
+		dashboard.Keg = scale.ActiveKegYield()
+	}
+	if includes[IncludeSession] {
+		session, err := scale.CurrentSession(now)
+		if err != nil {
+			return Dashboard{}, err
+		}
+		dashboard.Session = &session
+	}
+	if includes[IncludeForecast] {
+		dashboard.Forecast = scale.KegForecast(now)
+	}
+	if includes[IncludeDevice] {
+		device := scale.Device(now)
+		dashboard.Device = &device
+	}
+
+	return dashboard, nil
+}
+
+// dashboardSocketHandler pushes the dashboard payload whenever the scale state changes
+// so the frontend shows weight changes in real time without polling
+func (hr *HandlerRepository) dashboardSocketHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		includes, err := parseDashboardIncludes(r.URL.Query().Get("include"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid include: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		events := hr.scale.events.Subscribe()
+		defer hr.scale.events.Unsubscribe(events)
+
+		ws, err := UpgradeWebSocket(w, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Bad Request: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer ws.Close()
+
+		push := func() bool {
+			data, err := hr.dashboard(hr.scale, r, includes)
+			if err != nil {
+				hr.log(r).Warnf("Could not build dashboard: %v", err)
+				return true
+			}
+			res, err := json.Marshal(data)
+			if err != nil {
+				hr.log(r).Warnf("Could not marshal dashboard: %v", err)
+				return true
+			}
+			return ws.WriteText(res) == nil
+		}
+
+		if !push() {
+			return
+		}
+
+		keepAlive := time.NewTicker(30 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-ws.Closed():
+				return
+			case <-keepAlive.C:
+				if ws.Ping() != nil {
+					return
+				}
+			case event := <-events:
+				if event.Type == PourProgressEventType {
+					continue // state change follows every measurement
+				}
+				if !push() {
+					return
+				}
+			}
+		}
+	}
+}
+
+// adminSocketHandler is the admin console, it executes commands and streams all events
+// see [Console] for the protocol
+func (hr *HandlerRepository) adminSocketHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		events := hr.scale.events.Subscribe()
+		defer hr.scale.events.Unsubscribe(events)
+
+		ws, err := UpgradeWebSocket(w, r)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Bad Request: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer ws.Close()
+
+		console := &Console{hr: hr, authenticated: hr.config.Allows(r.Header.Get("Authorization"), ScopeAdmin)}
+		send := func(message ConsoleMessage) bool {
+			res, err := json.Marshal(message)
+			if err != nil {
+				hr.log(r).Warnf("Could not marshal console message: %v", err)
+				return true
+			}
+			return ws.WriteText(res) == nil
+		}
+
+		authTimeout := time.NewTimer(consoleAuthTimeout)
+		defer authTimeout.Stop()
+		keepAlive := time.NewTicker(30 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-ws.Closed():
+				return
+			case <-authTimeout.C:
+				if !console.authenticated {
+					return
+				}
+			case <-keepAlive.C:
+				if ws.Ping() != nil {
+					return
+				}
+			case raw := <-ws.Messages():
+				if !send(console.Execute(raw)) {
+					return
+				}
+			case event := <-events:
+				if !console.authenticated {
+					continue
+				}
+				if !send(ConsoleMessage{Type: "event", Event: &event}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (hr *HandlerRepository) scaleWarehouseHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type input struct {
+			Keg int    `json:"keg"`
+			Way string `json:"way"` // up or down
+		}
+
+		var data input
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		if strings.ToLower(data.Way) == "up" {
+			if err := hr.scale.IncreaseWarehouse(data.Keg); err != nil {
+				http.Error(w, "Could not increase warehouse", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if strings.ToLower(data.Way) == "down" {
+			if err := hr.scale.DecreaseWarehouse(data.Keg); err != nil {
+				http.Error(w, "Could not increase warehouse", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(getOkJson())
+	}
+}
+
+// scaleShadowHandler returns device shadow (GET) for the device and admin
+// or sets desired device configuration (POST) for the admin
+func (hr *HandlerRepository) scaleShadowHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+
+		switch r.Method {
+		case http.MethodGet:
+			if !hr.config.Allows(auth, ScopeDeviceIngest) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		case http.MethodPost:
+			if !hr.config.Allows(auth, ScopeAdmin) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			type input struct {
+				Desired map[string]string `json:"desired"`
+			}
+
+			var data input
+			err := json.NewDecoder(r.Body).Decode(&data)
+			if err != nil || data.Desired == nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			if err = hr.scale.SetDesiredConfig(data.Desired); err != nil {
+				http.Error(w, "Could not set desired config", http.StatusInternalServerError)
+				return
+			}
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		type output struct {
+			DeviceShadow
+			Delta  map[string]string `json:"delta"`
+			InSync bool              `json:"in_sync"`
+		}
+
+		shadow := hr.scale.GetShadow()
+		res, err := json.Marshal(output{
+			DeviceShadow: shadow,
+			Delta:        shadow.Delta(),
+			InSync:       shadow.InSync(),
+		})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// exportsHandler returns the manifest of exported files (GET)
+// or exports a given day on demand (POST)
+func (hr *HandlerRepository) exportsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !hr.exporter.Enabled() {
+			http.Error(w, "Export is disabled", http.StatusNotFound)
+			return
+		}
+
+		var res []byte
+		var err error
+
+		switch r.Method {
+		case http.MethodGet:
+			manifest, merr := hr.exporter.Manifest()
+			if merr != nil {
+				http.Error(w, "Could not read manifest", http.StatusInternalServerError)
+				return
+			}
+			res, err = json.Marshal(manifest)
+		case http.MethodPost:
+			type input struct {
+				Day string `json:"day"` // YYYY-MM-DD
+			}
+
+			var data input
+			if derr := json.NewDecoder(r.Body).Decode(&data); derr != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			day, perr := time.ParseInLocation(time.DateOnly, data.Day, getTz())
+			if perr != nil {
+				http.Error(w, "Invalid day", http.StatusBadRequest)
+				return
+			}
+
+			entries, eerr := hr.exporter.ExportDay(day)
+			if eerr != nil {
+				hr.log(r).Errorf("Could not export day: %v", eerr)
+				http.Error(w, "Could not export day", http.StatusInternalServerError)
+				return
+			}
+			res, err = json.Marshal(entries)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// exportFileHandler serves a single exported file
+func (hr *HandlerRepository) exportFileHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		manifest, err := hr.exporter.Manifest()
+		if err != nil {
+			http.Error(w, "Could not read manifest", http.StatusInternalServerError)
+			return
+		}
+
+		// only files listed in the manifest can be downloaded
+		name := mux.Vars(r)["file"]
+		for _, entry := range manifest {
+			if entry.File == name {
+				w.Header().Set("Content-Type", "application/vnd.apache.parquet")
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+				http.ServeFile(w, r, filepath.Join(hr.config.ExportPath, name))
+				return
+			}
+		}
+
+		http.Error(w, "Not Found", http.StatusNotFound)
+	}
+}
+
+// backupHandler streams a complete dump of all scales as a gzipped archive (POST)
+// since (YYYY-MM-DD) limits the history, all of it by default, the archive is loaded by `keg-scale restore`
+func (hr *HandlerRepository) backupHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		now := time.Now()
+		since := now.AddDate(-10, 0, 0)
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			parsed, err := time.ParseInLocation(time.DateOnly, raw, getTz())
+			if err != nil {
+				http.Error(w, "Invalid since, use YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			since = parsed
+		}
+
+		if err := hr.scale.store.Ping(); err != nil {
+			http.Error(w, "Storage Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		// the status is sent with the first record, a failure later leaves the archive without its trailer
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "keg-scale-backup-"+now.Format(time.DateOnly)+".jsonl.gz"))
+		devices := map[string]Storage{}
+		if hr.scales != nil {
+			for _, device := range hr.scales.Devices() {
+				if scale, _ := hr.scales.Get(device); device != "" {
+					devices[device] = scale.store
+				}
+			}
+		}
+		report, err := WriteBackup(hr.scale.store, devices, since, now, w)
+		if err != nil {
+			hr.logger.Errorf("Backup failed: %v", err)
+			return
+		}
+		hr.logger.Infof("Backup of %d records written", countRecords(report))
+	}
+}
+
+// publicAuth protects read-only public API
+// token is accepted in Authorization header or in token query parameter (for embedding)
+// every token is rate limited separately
+func (hr *HandlerRepository) publicAuth(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+
+		name := ""
+		for tokenName, value := range hr.config.PublicTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(value)) == 1 {
+				name = tokenName
+				break
+			}
+		}
+
+		if name == "" {
+			hr.monitor.publicRequests.WithLabelValues(hr.monitor.guard.Labels("scale_public_api_requests_total", "unknown", "unauthorized")...).Inc()
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !hr.publicLimiter.Allow(name) {
+			hr.monitor.publicRequests.WithLabelValues(hr.monitor.guard.Labels("scale_public_api_requests_total", name, "rate_limited")...).Inc()
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+
+		hr.monitor.publicRequests.WithLabelValues(hr.monitor.guard.Labels("scale_public_api_requests_total", name, "ok")...).Inc()
+		handler(w, r)
+	}
+}
+
+// publicStatusHandler returns the tap status for third parties
+func (hr *HandlerRepository) publicStatusHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		hr.scale.Recheck()
+
+		type output struct {
+			IsOk      bool   `json:"is_ok"`
+			PubIsOpen bool   `json:"pub_is_open"`
+			ActiveKeg int    `json:"active_keg"`
+			BeersLeft int    `json:"beers_left"`
+			IsLow     bool   `json:"is_low"`
+			LastAt    string `json:"last_at"`
+		}
+
+		ok := hr.scale.IsOk()
+
+		hr.scale.mux.Lock()
+		data := output{
+			IsOk:      ok,
+			PubIsOpen: hr.scale.Pub.IsOpen,
+			ActiveKeg: hr.scale.ActiveKeg,
+			BeersLeft: hr.scale.BeersLeft,
+			IsLow:     hr.scale.IsLow,
+			LastAt:    formatDate(hr.scale.WeightAt),
+		}
+		hr.scale.mux.Unlock()
+
+		res, err := json.Marshal(data)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		writeCached(w, r, res, publicCacheControl(hr.config))
+	}
+}
+
+// pourStreamHandler streams pour progress as Server-Sent Events
+// so the bar display can animate the pour in real time
+func (hr *HandlerRepository) pourStreamHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		events := hr.scale.events.Subscribe()
+		defer hr.scale.events.Unsubscribe(events)
+
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case event := <-events:
+				if event.Type != PourProgressEventType {
+					continue
+				}
+
+				data, err := json.Marshal(event.Data)
+				if err != nil {
+					hr.log(r).Warnf("Could not marshal event: %v", err)
+					continue
+				}
+
+				_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// eventStreamHandler streams measurements, keg changes and opening and closing of the pub
+// as Server-Sent Events, so simple pages and shell scripts can follow the scale without polling
+// data of every message is the whole event including its schema version
+func (hr *HandlerRepository) eventStreamHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		events := scale.events.Subscribe()
+		defer scale.events.Unsubscribe(events)
+
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				_, _ = fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case event, open := <-events:
+				if !open {
+					return
+				}
+				if !isStreamedEvent(event) {
+					continue
+				}
+
+				data, err := json.Marshal(event)
+				if err != nil {
+					hr.log(r).Warnf("Could not marshal event: %v", err)
+					continue
+				}
+
+				_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// isStreamedEvent tells whether the event belongs to the /api/events stream
+// pings are left out, they change nothing but the time of the last contact
+func isStreamedEvent(event Event) bool {
+	switch event.Type {
+	case KegChangeEventType, KegUntapEventType, ChangeoverEventType, PubOpenEventType, OfflineEventType, KegButtonEventType,
+		ClosingSoonEventType:
+		return true
+	case StateChangeEventType:
+		change, ok := event.Data.(StateChangeEvent)
+		return ok && change.Reason == "measurement"
+	}
+
+	return false
+}
+
+// openApiHandler returns the OpenAPI specification of the documented routes of the router
+func (hr *HandlerRepository) openApiHandler(router *mux.Router) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		spec, err := BuildOpenApi(router)
+		if err != nil {
+			hr.log(r).Errorf("Could not build OpenAPI specification: %v", err)
+			http.Error(w, "Could not build OpenAPI specification", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(spec)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// eventSchemasHandler lists JSON schemas of all published events
+func (hr *HandlerRepository) eventSchemasHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		entries, err := ListSchemas()
+		if err != nil {
+			http.Error(w, "Could not list schemas", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(entries)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// eventSchemaHandler returns a single JSON schema
+func (hr *HandlerRepository) eventSchemaHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		schema, err := GetSchema(mux.Vars(r)["file"])
+		if err != nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/schema+json")
+		_, _ = w.Write(schema)
+	}
+}
+
+// cleaningHandler starts or stops line cleaning mode
+func (hr *HandlerRepository) cleaningHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type input struct {
+			Enabled  bool   `json:"enabled"`
+			Duration string `json:"duration"` // optional, e.g. 30m, defaults to CLEANING_TIMEOUT
+		}
+
+		var data input
+		err := json.NewDecoder(r.Body).Decode(&data)
+		if err != nil {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		duration := time.Duration(0)
+		if data.Enabled {
+			duration = hr.config.CleaningTimeout
+			if data.Duration != "" {
+				duration, err = time.ParseDuration(data.Duration)
+				if err != nil || duration <= 0 {
+					http.Error(w, "Invalid duration", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		if err = hr.scale.SetCleaning(duration); err != nil {
+			http.Error(w, "Could not set cleaning mode", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(getOkJson())
+	}
+}
+
+// kegButtonHandler is pressed by the "keg change now" button at the bar
+// it confirms the detected keg change or asks the display to open the tap wizard
+func (hr *HandlerRepository) kegButtonHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		event, err := scale.PressKegButton()
+		if err != nil {
+			hr.log(r).Warnf("Could not handle keg button: %v", err)
+			http.Error(w, "Could not tap keg", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(event)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// defaultPubOverride is how long the pub is forced open or closed when no duration is given, the rest of the night
+const defaultPubOverride = 12 * time.Hour
+
+// pubOverrideHandler forces the pub open or closed regardless of the scale and opening hours
+// POST takes an optional duration, DELETE returns the pub to the schedule and the scale
+func (hr *HandlerRepository) pubOverrideHandler(open bool) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		duration := time.Duration(0)
+		if r.Method == http.MethodPost {
+			type input struct {
+				Duration string `json:"duration"` // optional, e.g. 2h, defaults to 12 hours
+			}
+
+			var data input
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil && err != io.EOF {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			duration = defaultPubOverride
+			if data.Duration != "" {
+				parsed, err := time.ParseDuration(data.Duration)
+				if err != nil || parsed <= 0 || parsed > 7*24*time.Hour {
+					http.Error(w, "Invalid duration", http.StatusBadRequest)
+					return
+				}
+				duration = parsed
+			}
+		}
+
+		scale.SetPubOverride(open, duration)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(getOkJson())
+	}
+}
+
+// measurementsHandler deletes the measurement history, whole or in the range given by from and to (RFC 3339)
+// POST adds a manually entered weight, e.g. read from a kitchen scale while the device is broken
+func (hr *HandlerRepository) measurementsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			type input struct {
+				Weight float64 `json:"weight"`
+			}
+
+			var data input
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+			if lowest, highest := hr.scale.AcceptedWeights(); data.Weight < lowest || data.Weight > highest {
+				http.Error(w, "Invalid weight", http.StatusBadRequest)
+				return
+			}
+
+			if err := hr.scale.AddMeasurement(data.Weight, SourceManual); err != nil {
+				http.Error(w, "Could not add measurement", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(getOkJson())
+			return
+		}
+
+		from := time.Unix(0, 0)
+		if param := r.URL.Query().Get("from"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				http.Error(w, "Invalid from", http.StatusBadRequest)
+				return
+			}
+			from = t
+		}
+
+		to := time.Now().Add(24 * time.Hour) // measurements can't be in the future
+		if param := r.URL.Query().Get("to"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil || !t.After(from) {
+				http.Error(w, "Invalid to", http.StatusBadRequest)
+				return
+			}
+			to = t
+		}
+
+		deleted, err := hr.scale.ClearMeasurements(from, to)
+		if err != nil {
+			http.Error(w, "Could not delete measurements", http.StatusInternalServerError)
+			return
+		}
+
+		type output struct {
+			Deleted int `json:"deleted"`
+		}
+
+		res, err := json.Marshal(output{Deleted: deleted})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// alertmanagerHandler receives Alertmanager webhook notifications
+// configure webhook_config with authorization credentials set to [Config.AlertmanagerToken]
+func (hr *HandlerRepository) alertmanagerHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if hr.config.AlertmanagerToken == "" {
+			http.Error(w, "Alertmanager webhook is disabled", http.StatusNotFound)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if auth != "Bearer "+hr.config.AlertmanagerToken {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var data AlertmanagerWebhook
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		hr.scale.ReceiveAlerts(data)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(getOkJson())
+	}
+}
+
+// sessionTagHandler labels the current pub session (quiz night, private party, ...)
+func (hr *HandlerRepository) sessionTagHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type input struct {
+			Tag string `json:"tag"` // empty removes the tag
+		}
+
+		var data input
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		tag := strings.TrimSpace(data.Tag)
+		if len(tag) > sessionTagMaxLength {
+			http.Error(w, fmt.Sprintf("Tag is longer than %d characters", sessionTagMaxLength), http.StatusBadRequest)
+			return
+		}
+
+		if !hr.scale.Pub.IsOpen {
+			http.Error(w, "The pub is closed", http.StatusConflict)
+			return
+		}
+
+		sessionTag, err := hr.scale.TagSession(tag)
+		if err != nil {
+			http.Error(w, "Could not tag session", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(sessionTag)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// sessionStatsHandler returns sessions of the last days grouped by tag
+func (hr *HandlerRepository) sessionStatsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		days := 30
+		if raw := r.URL.Query().Get("days"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 366 {
+				http.Error(w, "Invalid days", http.StatusBadRequest)
+				return
+			}
+			days = parsed
+		}
+
+		stats, err := GetSessionStats(hr.scale.store, days, hr.config.GlassSize, hr.config.PubDayStart, time.Now())
+		if err != nil {
+			hr.log(r).Errorf("Could not calculate session stats: %v", err)
+			http.Error(w, "Could not calculate stats", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(stats)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// occupancyStatsHandler returns how busy the pub was per session in quarters of an hour (28 days by default)
+// the weekday parameter keeps sessions of a single pub day, so Friday crowds can be compared week over week
+func (hr *HandlerRepository) occupancyStatsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		days := 28
+		if raw := r.URL.Query().Get("days"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 366 {
+				http.Error(w, "Invalid days", http.StatusBadRequest)
+				return
+			}
+			days = parsed
+		}
+		weekday, err := parseWeekday(r.URL.Query().Get("weekday"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid weekday: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		history, err := GetOccupancyHistory(hr.scale, days, weekday, time.Now())
+		if err != nil {
+			hr.log(r).Errorf("Could not calculate occupancy: %v", err)
+			http.Error(w, "Could not calculate stats", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(history)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// dailyStatsHandler returns consumption per pub day of the last days (30 by default)
+func (hr *HandlerRepository) dailyStatsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		days := 30
+		if raw := r.URL.Query().Get("days"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 366 {
+				http.Error(w, "Invalid days", http.StatusBadRequest)
+				return
+			}
+			days = parsed
+		}
+
+		stats, err := GetDailyStats(hr.scale.store, hr.holidays, days, hr.config.GlassSize, hr.config.PubDayStart, time.Now())
+		if err != nil {
+			hr.log(r).Errorf("Could not calculate daily stats: %v", err)
+			http.Error(w, "Could not calculate stats", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(stats)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// trendsHandler returns keg lifetime and consumption of the last months (24 by default) and their years
+// changes are calculated against the same month a year before, so seasons are compared with seasons
+func (hr *HandlerRepository) trendsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		months := 24
+		if raw := r.URL.Query().Get("months"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > maxTrendMonths {
+				http.Error(w, "Invalid months", http.StatusBadRequest)
+				return
+			}
+			months = parsed
+		}
+
+		trends, err := GetTrends(hr.scale.store, months, hr.config.PubDayStart, time.Now())
+		if err != nil {
+			hr.log(r).Errorf("Could not calculate trends: %v", err)
+			http.Error(w, "Could not calculate trends", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(trends)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// firmwareHandler returns the latest firmware release for the OTA update (GET)
+// or publishes a new one (POST), e.g. from the CI building the firmware
+func (hr *HandlerRepository) firmwareHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var release FirmwareRelease
+
+		switch r.Method {
+		case http.MethodGet:
+			latest, found := hr.firmware.Latest()
+			if !found {
+				http.Error(w, "No firmware released", http.StatusNotFound)
+				return
+			}
+			release = latest
+		case http.MethodPost:
+			auth := r.Header.Get("Authorization")
+			if !hr.config.Allows(auth, ScopeAdmin) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var data FirmwareRelease
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			published, err := hr.firmware.Publish(data, time.Now())
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid firmware: %v", err), http.StatusBadRequest)
+				return
+			}
+			hr.log(r).Infof("Firmware %s published", published.Version)
+			release = published
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		res, err := json.Marshal(release)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// communityHandler compares the last week of the pub with other pubs sharing their stats
+func (hr *HandlerRepository) communityHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if hr.community == nil || !hr.community.Enabled() {
+			http.Error(w, "Community sharing is disabled", http.StatusNotFound)
+			return
+		}
+
+		own, err := hr.community.Stats(time.Now())
+		if err != nil {
+			hr.log(r).Errorf("Could not calculate community stats: %v", err)
+			http.Error(w, "Could not calculate stats", http.StatusInternalServerError)
+			return
+		}
+
+		pubs, err := hr.community.Comparison(r.Context())
+		if err != nil {
+			hr.log(r).Warnf("Could not fetch community stats: %v", err)
+			http.Error(w, "Community server is unavailable", http.StatusBadGateway)
+			return
+		}
+
+		type output struct {
+			Own  CommunityStats   `json:"own"`
+			Pubs []CommunityStats `json:"pubs"` // the busiest first
+			Rank int              `json:"rank"` // position of the pub by liters, 1 is the busiest
+		}
+
+		res, err := json.Marshal(output{
+			Own:  own,
+			Pubs: pubs,
+			Rank: CommunityRank(pubs, own.Liters),
+		})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// diffHandler returns consumption and events between from and to (RFC 3339), so staff can reconcile shifts
+func (hr *HandlerRepository) diffHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		from, err := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+
+		to := time.Now()
+		if param := r.URL.Query().Get("to"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				http.Error(w, "Invalid to", http.StatusBadRequest)
+				return
+			}
+			to = t
+		}
+
+		if !from.Before(to) || to.Sub(from) > maxDiffRange {
+			http.Error(w, "Invalid range", http.StatusBadRequest)
+			return
+		}
+
+		diff, err := GetDiff(hr.scale.store, from, to, hr.config)
+		if err != nil {
+			hr.log(r).Errorf("Could not calculate diff: %v", err)
+			http.Error(w, "Could not calculate diff", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(diff)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// annotationsHandler returns keg changes, low kegs, changeovers of the beer and pub sessions
+// as annotations for Grafana JSON data sources, so the weight charts get markers instead of mystery cliffs
+// GET takes from and to (RFC 3339, the last 30 days by default) and kinds separated by comma,
+// POST takes the annotation query of the data source, the query of the annotation selects the kinds
+func (hr *HandlerRepository) annotationsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var from, to time.Time
+		var rawKinds string
+		if r.Method == http.MethodPost {
+			var query GrafanaAnnotationQuery
+			if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+				http.Error(w, "Invalid query", http.StatusBadRequest)
+				return
+			}
+			from, to, rawKinds = query.Range.From, query.Range.To, query.Annotation.Query
+		} else {
+			to = time.Now()
+			if param := r.URL.Query().Get("to"); param != "" {
+				t, err := time.Parse(time.RFC3339, param)
+				if err != nil {
+					http.Error(w, "Invalid to", http.StatusBadRequest)
+					return
+				}
+				to = t
+			}
+
+			from = to.AddDate(0, 0, -30)
+			if param := r.URL.Query().Get("from"); param != "" {
+				t, err := time.Parse(time.RFC3339, param)
+				if err != nil {
+					http.Error(w, "Invalid from", http.StatusBadRequest)
+					return
+				}
+				from = t
+			}
+			rawKinds = r.URL.Query().Get("kinds")
+		}
+
+		if !from.Before(to) || to.Sub(from) > maxAnnotationsRange {
+			http.Error(w, "Invalid range", http.StatusBadRequest)
+			return
+		}
+
+		kinds, err := parseAnnotationKinds(rawKinds)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid kinds: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		annotations, err := hr.scale.Annotations(kinds, from, to)
+		if err != nil {
+			hr.log(r).Errorf("Could not load annotations: %v", err)
+			http.Error(w, "Could not load annotations", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(annotations)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// spreadsheetHandler streams measurements (and pours with pours=true) in the range given by from and to (RFC 3339)
+// as a CSV or XLSX download, to defaults to now
+func (hr *HandlerRepository) spreadsheetHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = SpreadsheetCsv
+		}
+		if format != SpreadsheetCsv && format != SpreadsheetXlsx {
+			http.Error(w, "Invalid format", http.StatusBadRequest)
+			return
+		}
+
+		from, err := time.Parse(time.RFC3339, r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+
+		to := time.Now()
+		if param := r.URL.Query().Get("to"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				http.Error(w, "Invalid to", http.StatusBadRequest)
+				return
+			}
+			to = t
+		}
+
+		if !from.Before(to) || to.Sub(from) > maxSpreadsheetRange {
+			http.Error(w, "Invalid range", http.StatusBadRequest)
+			return
+		}
+
+		pours := r.URL.Query().Get("pours") == "true"
+
+		w.Header().Set("Content-Type", SpreadsheetContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", SpreadsheetFilename(from, to, format)))
+
+		// the response is already streaming, a failure can only cut it short
+		if err := WriteSpreadsheet(w, hr.scale.store, from, to, format, pours); err != nil {
+			hr.log(r).Errorf("Could not export measurements: %v", err)
+		}
+	}
+}
+
+// poursHandler returns detected pours in the range given by from and to (RFC 3339), the last day by default
+func (hr *HandlerRepository) poursHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		to := time.Now()
+		if param := r.URL.Query().Get("to"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				http.Error(w, "Invalid to", http.StatusBadRequest)
+				return
+			}
+			to = t
+		}
+
+		from := to.Add(-24 * time.Hour)
+		if param := r.URL.Query().Get("from"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil || !t.Before(to) {
+				http.Error(w, "Invalid from", http.StatusBadRequest)
+				return
+			}
+			from = t
+		}
+
+		pours, err := hr.scale.store.GetPours(from, to)
+		if err != nil {
+			http.Error(w, "Could not load pours", http.StatusInternalServerError)
+			return
+		}
+		if pours == nil {
+			pours = []Pour{}
+		}
+		if !hr.config.Allows(r.Header.Get("Authorization"), ScopeAdmin) {
+			// attribution to people is private
+			for i := range pours {
+				pours[i].Person = ""
+			}
+		}
+
+		res, err := json.Marshal(pours)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// MeasurementHistory is the response of the measurement history query
+type MeasurementHistory struct {
+	From       time.Time           `json:"from"`
+	To         time.Time           `json:"to"`
+	Resolution string              `json:"resolution"` // empty for raw measurements
+	Points     []MeasurementBucket `json:"points"`
+}
+
+// measurementsQueryHandler returns measurement history in the range given by from and to (RFC 3339, the last day by default)
+// optional resolution (e.g. 5m) downsamples measurements to avg/min/max per bucket for charting
+func (hr *HandlerRepository) measurementsQueryHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		to := time.Now()
+		if param := r.URL.Query().Get("to"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				http.Error(w, "Invalid to", http.StatusBadRequest)
+				return
+			}
+			to = t
+		}
+
+		from := to.Add(-24 * time.Hour)
+		if param := r.URL.Query().Get("from"); param != "" {
+			t, err := time.Parse(time.RFC3339, param)
+			if err != nil || !t.Before(to) {
+				http.Error(w, "Invalid from", http.StatusBadRequest)
+				return
+			}
+			from = t
+		}
+
+		var resolution time.Duration
+		if param := r.URL.Query().Get("resolution"); param != "" {
+			d, err := time.ParseDuration(param)
+			if err != nil || d < time.Second {
+				http.Error(w, "Invalid resolution, use a duration of at least 1s", http.StatusBadRequest)
+				return
+			}
+			resolution = d
+		}
+		if resolution > 0 && to.Sub(from)/resolution > measurementsMaxBuckets {
+			http.Error(w, fmt.Sprintf("Too many buckets, the range must not exceed %d resolutions", measurementsMaxBuckets), http.StatusBadRequest)
+			return
+		}
+
+		measurements, err := hr.scale.store.GetMeasurements(from, to)
+		if err != nil {
+			http.Error(w, "Could not load measurements", http.StatusInternalServerError)
+			return
+		}
+
+		data := MeasurementHistory{
+			From:   from,
+			To:     to,
+			Points: Downsample(measurements, from, resolution),
+		}
+		if resolution > 0 {
+			data.Resolution = resolution.String()
+		}
+
+		res, err := json.Marshal(data)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// measurementHandler deletes (DELETE) or corrects (PATCH {"weight": grams}) a bad measurement of the default scale,
+// e.g. a cleaning bucket put on the scale, pours detected from it are removed and the current state is recomputed
+// the id is listed by GET /api/measurements without resolution
+func (hr *HandlerRepository) measurementHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete && r.Method != http.MethodPatch {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		at, err := parseMeasurementId(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid measurement id", http.StatusBadRequest)
+			return
+		}
+
+		var correction MeasurementCorrection
+		if r.Method == http.MethodPatch {
+			type input struct {
+				Weight *float64 `json:"weight"`
+			}
+
+			var data input
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Weight == nil {
+				http.Error(w, "Could not read patch body", http.StatusBadRequest)
+				return
+			}
+			if lowest, highest := hr.scale.AcceptedWeights(); *data.Weight < lowest || *data.Weight > highest {
+				http.Error(w, "Invalid weight", http.StatusBadRequest)
+				return
+			}
+			correction, err = hr.scale.CorrectMeasurement(at, *data.Weight)
+		} else {
+			correction, err = hr.scale.DeleteMeasurement(at)
+		}
+		if errors.Is(err, errMeasurementNotFound) {
+			http.Error(w, "Measurement not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			hr.log(r).Errorf("Could not edit measurement: %v", err)
+			http.Error(w, "Could not edit measurement", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(correction)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// calibrationHandler returns or replaces conversion of raw counts sent by the device
+// GET includes the last raw value, so the admin can read tare and a known weight
+func (hr *HandlerRepository) calibrationHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			var data Calibration
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+			if err := data.Validate(); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid calibration: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := scale.SetCalibration(data); err != nil {
+				http.Error(w, "Could not set calibration", http.StatusInternalServerError)
+				return
+			}
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		type output struct {
+			Calibration *Calibration `json:"calibration"`
+			LastRaw     float64      `json:"last_raw"`
+			LastRawAt   string       `json:"last_raw_at"`
+		}
+
+		calibration, raw, rawAt := scale.GetCalibration()
+		res, err := json.Marshal(output{
+			Calibration: calibration,
+			LastRaw:     raw,
+			LastRawAt:   formatDate(rawAt),
+		})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// tareShiftHandler returns the active and resolved tare shifts of the scale (GET),
+// recalibrates it by the suggested calibration (POST) or dismisses the shift (DELETE)
+func (hr *HandlerRepository) tareShiftHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		var err error
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			err = scale.ApplyTareShift()
+		case http.MethodDelete:
+			err = scale.DismissTareShift(time.Now())
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		switch {
+		case errors.Is(err, errNoTareShift):
+			http.Error(w, "No tare shift", http.StatusNotFound)
+			return
+		case errors.Is(err, errNotServerCalibrated):
+			http.Error(w, "Scale is not calibrated by the server, tare the device instead", http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "Could not recalibrate the scale", http.StatusInternalServerError)
+			return
+		}
+
+		type output struct {
+			Active  *TareShift  `json:"active"`
+			History []TareShift `json:"history"`
+		}
+
+		active, history := scale.TareShifts()
+		res, err := json.Marshal(output{Active: active, History: history})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// calibrationHistoryHandler returns previous calibrations, newest first
+func (hr *HandlerRepository) calibrationHistoryHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		history, err := scale.GetCalibrationHistory()
+		if err != nil {
+			http.Error(w, "Could not get calibration history", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(history)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// calibrationPreviewHandler converts the raw value without storing anything
+// GET uses the current calibration (?raw=), POST a candidate calibration from the body
+func (hr *HandlerRepository) calibrationPreviewHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		type input struct {
+			Calibration Calibration `json:"calibration"`
+			Raw         float64     `json:"raw"`
+		}
+
+		var data input
+		switch r.Method {
+		case http.MethodGet:
+			raw, err := strconv.ParseFloat(r.URL.Query().Get("raw"), 64)
+			if err != nil {
+				http.Error(w, "Invalid raw value", http.StatusBadRequest)
+				return
+			}
+			calibration, _, _ := scale.GetCalibration()
+			if calibration == nil {
+				http.Error(w, "Scale is not calibrated", http.StatusConflict)
+				return
+			}
+			data = input{Calibration: *calibration, Raw: raw}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+			if err := data.Calibration.Validate(); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid calibration: %v", err), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		type output struct {
+			Raw   float64 `json:"raw"`
+			Grams float64 `json:"grams"`
+		}
+
+		res, err := json.Marshal(output{
+			Raw:   data.Raw,
+			Grams: data.Calibration.Convert(data.Raw),
+		})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// adminInfoHandler returns operational info for the admin
+// e.g. health of outgoing channels, so broken tokens are noticed before they are needed
+func (hr *HandlerRepository) adminInfoHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type output struct {
+			Degraded bool            `json:"degraded"`
+			Channels []ChannelHealth `json:"channels"`
+		}
+
+		res, err := json.Marshal(output{
+			Degraded: hr.scale.IsDegraded(),
+			Channels: hr.monitor.deliveries.Health(),
+		})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// selfCheckHandler returns the report of the last nightly self-check
+// POST runs the self-check immediately
+func (hr *HandlerRepository) selfCheckHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var report *SelfCheckReport
+		switch r.Method {
+		case http.MethodGet:
+			report = hr.selfCheck.Last()
+			if report == nil {
+				http.Error(w, "Self-check has not run yet", http.StatusNotFound)
+				return
+			}
+		case http.MethodPost:
+			checked := hr.selfCheck.Check(time.Now())
+			report = &checked
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		res, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// retentionHandler returns the report of the last pruning of measurements (GET) or prunes them now (POST)
+func (hr *HandlerRepository) retentionHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var report *RetentionReport
+		switch r.Method {
+		case http.MethodGet:
+			report = hr.retention.Last()
+			if report == nil {
+				http.Error(w, "Retention has not run yet", http.StatusNotFound)
+				return
+			}
+		case http.MethodPost:
+			if !hr.retention.Enabled() {
+				http.Error(w, "Retention is disabled, set RETENTION_DAYS or RETENTION_MAX_ITEMS", http.StatusConflict)
+				return
+			}
+			pruned, err := hr.retention.Prune(time.Now())
+			if err != nil {
+				hr.log(r).Errorf("Could not prune measurements: %v", err)
+				http.Error(w, "Could not prune measurements", http.StatusInternalServerError)
+				return
+			}
+			report = &pruned
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		res, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// kegsCompareHandler compares yield of two kegs
+// e.g. to evaluate whether a new coupler or gas pressure improved the yield
+func (hr *HandlerRepository) kegsCompareHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		a, err := hr.scale.GetKegYield(r.URL.Query().Get("a"))
+		if err != nil {
+			http.Error(w, "Keg a not found", http.StatusNotFound)
+			return
+		}
+
+		b, err := hr.scale.GetKegYield(r.URL.Query().Get("b"))
+		if err != nil {
+			http.Error(w, "Keg b not found", http.StatusNotFound)
+			return
+		}
+
+		type output struct {
+			A          KegYield `json:"a"`
+			B          KegYield `json:"b"`
+			SameBeer   bool     `json:"same_beer"`
+			YieldDelta float64  `json:"yield_delta"` // b - a in percentage points
+			WasteDelta float64  `json:"waste_delta"` // b - a in grams
+		}
+
+		res, err := json.Marshal(output{
+			A:          a,
+			B:          b,
+			SameBeer:   a.Keg.Beer != "" && strings.EqualFold(a.Keg.Beer, b.Keg.Beer),
+			YieldDelta: b.Yield - a.Yield,
+			WasteDelta: b.WasteGrams - a.WasteGrams,
+		})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// guestLinkHandler creates a short-lived link to the dashboard
+// e.g. to share tonight's stats in the group chat
+func (hr *HandlerRepository) guestLinkHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		auth := r.Header.Get("Authorization")
+		if !hr.config.Allows(auth, ScopeAdmin) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		type input struct {
+			Ttl string `json:"ttl"` // optional, e.g. 6h, defaults to GUEST_LINK_MAX_TTL
+		}
+
+		var data input
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil && err != io.EOF {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
+		}
+
+		ttl := hr.config.GuestLinkMaxTtl
+		if data.Ttl != "" {
+			parsed, err := time.ParseDuration(data.Ttl)
+			if err != nil || parsed <= 0 || parsed > hr.config.GuestLinkMaxTtl {
+				http.Error(w, fmt.Sprintf("Invalid ttl, maximum is %s", hr.config.GuestLinkMaxTtl), http.StatusBadRequest)
+				return
+			}
+			ttl = parsed
+		}
+
+		type output struct {
+			Token     string `json:"token"`
+			Url       string `json:"url"`
+			ExpiresAt string `json:"expires_at"`
+		}
+
+		expiresAt := time.Now().Add(ttl)
+		token := SignGuestToken(hr.config.Password, expiresAt)
+		res, err := json.Marshal(output{
+			Token:     token,
+			Url:       "/api/guest/dashboard?guest=" + token,
+			ExpiresAt: formatDate(expiresAt),
+		})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// guestAuth protects read-only endpoints shared by guest links
+// token is accepted in guest query parameter
+func (hr *HandlerRepository) guestAuth(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expiresAt, err := VerifyGuestToken(hr.config.Password, r.URL.Query().Get("guest"), time.Now())
+		if err != nil {
+			http.Error(w, "Link is invalid or expired", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("X-Guest-Expires-At", expiresAt.Format(time.RFC3339))
+		handler(w, r)
+	}
 }
 
-func (hr *HandlerRepository) scaleStatusHandler() func(http.ResponseWriter, *http.Request) {
+// ingestAllowlist accepts scale messages only from allowed networks
+// the scale is always connected from the pub's static IP
+func (hr *HandlerRepository) ingestAllowlist(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(hr.config.IngestAllowlist) == 0 {
+			handler(w, r)
+			return
+		}
+
+		ip := clientIp(r, hr.config.TrustForwarded)
+		for _, network := range hr.config.IngestAllowlist {
+			if ip != nil && network.Contains(ip) {
+				handler(w, r)
+				return
+			}
+		}
+
+		hr.monitor.ingestRejected.WithLabelValues("allowlist").Inc()
+		hr.log(r).Warnf("Rejected scale message from %s", ip)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	}
+}
+
+// requireStore refuses changes while the storage is unavailable
+// reads are served from memory, writes would be lost on restart
+func (hr *HandlerRepository) requireStore(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && hr.scale.IsDegraded() {
+			http.Error(w, "Storage Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// pendingKegHandler returns the detected keg change waiting for confirmation
+// POST corrects the keg (or taps the unrecognized one), DELETE confirms or dismisses the detection
+func (hr *HandlerRepository) pendingKegHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		hr.logger.Info("Scale status requested")
+		switch r.Method {
+		case http.MethodGet:
+			type output struct {
+				NeedsConfirmation bool        `json:"needs_confirmation"`
+				PendingKeg        *PendingKeg `json:"pending_keg"`
+			}
+
+			pending := hr.scale.GetPendingKeg()
+			res, err := json.Marshal(output{
+				NeedsConfirmation: pending != nil,
+				PendingKeg:        pending,
+			})
+			if err != nil {
+				http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(res)
+		case http.MethodPost:
+			auth := r.Header.Get("Authorization")
+			if !hr.config.Allows(auth, ScopeAdmin) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			type input struct {
+				Keg  int    `json:"keg"`
+				Beer string `json:"beer"` // optional name of the beer
+			}
+
+			var data input
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				http.Error(w, "Could not read post body", http.StatusBadRequest)
+				return
+			}
+
+			if _, err := GetWarehouseIndex(data.Keg); err != nil {
+				http.Error(w, "Invalid keg size", http.StatusBadRequest)
+				return
+			}
+
+			if hr.scale.GetPendingKeg() == nil {
+				http.Error(w, "No keg change is waiting for confirmation", http.StatusConflict)
+				return
+			}
+
+			if err := hr.scale.CorrectPendingKeg(data.Keg, data.Beer); err != nil {
+				hr.log(r).Warnf("Could not correct pending keg: %v", err)
+				http.Error(w, "Could not correct keg", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(getOkJson())
+		case http.MethodDelete:
+			auth := r.Header.Get("Authorization")
+			if !hr.config.Allows(auth, ScopeAdmin) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			hr.scale.DismissPendingKeg()
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(getOkJson())
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// untapKeg puts the partially full active keg of the scale given by device aside
+func (hr *HandlerRepository) untapKeg(w http.ResponseWriter, r *http.Request) {
+	scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+	if !found {
+		http.Error(w, "Unknown device", http.StatusNotFound)
+		return
+	}
+
+	keg, err := scale.UntapKeg(time.Now())
+	if errors.Is(err, errNoActiveKeg) {
+		http.Error(w, "No keg is tapped", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		hr.log(r).Errorf("Could not untap keg: %v", err)
+		http.Error(w, "Could not untap keg", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := json.Marshal(keg)
+	if err != nil {
+		http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(res)
+}
+
+// untappedKegsHandler returns partially full kegs waiting to be tapped again
+func (hr *HandlerRepository) untappedKegsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		data, err := hr.scale.JsonState()
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		kegs, err := scale.UntappedKegs()
+		if err != nil {
+			hr.log(r).Errorf("Could not load untapped kegs: %v", err)
+			http.Error(w, "Could not load kegs", http.StatusInternalServerError)
+			return
+		}
 
+		res, err := json.Marshal(kegs)
 		if err != nil {
-			http.Error(w, "Could not marshal state to JSON", http.StatusInternalServerError)
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		_, _ = w.Write(data)
+		_, _ = w.Write(res)
 	}
 }
 
-func (hr *HandlerRepository) scaleMessageHandler() func(http.ResponseWriter, *http.Request) {
+// kegHistoryHandler returns lifecycle records of kegs of the scale given by device, the newest first
+// ?state= returns only kegs on tap, untapped or finished
+func (hr *HandlerRepository) kegHistoryHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		kegs, err := scale.KegLifecycles(r.URL.Query().Get("state"), time.Now())
+		if errors.Is(err, errUnknownKegState) {
+			http.Error(w, "Invalid state, use on_tap, untapped or finished", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			hr.log(r).Errorf("Could not load keg history: %v", err)
+			http.Error(w, "Could not load kegs", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := json.Marshal(kegs)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
 
+// retapKegHandler taps the untapped keg again on the scale given by device, its statistics are resumed
+func (hr *HandlerRepository) retapKegHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
 		auth := r.Header.Get("Authorization")
-		if auth != hr.config.AuthToken {
+		if !hr.config.Allows(auth, ScopeAdmin) {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		body, err := io.ReadAll(r.Body)
+		scale, found := hr.scaleOf(r.URL.Query().Get("device"))
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		keg, err := scale.RetapKeg(mux.Vars(r)["id"], time.Now())
+		if errors.Is(err, errUnknownKeg) {
+			http.Error(w, "Keg not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, errKegNotUntapped) {
+			http.Error(w, "Keg is not untapped", http.StatusConflict)
+			return
+		}
 		if err != nil {
-			http.Error(w, "Could not read post body", http.StatusInternalServerError)
+			hr.log(r).Errorf("Could not tap keg again: %v", err)
+			http.Error(w, "Could not tap keg again", http.StatusInternalServerError)
 			return
 		}
 
-		message, err := ParseScaleMessage(string(body))
+		res, err := json.Marshal(keg)
 		if err != nil {
-			hr.logger.Warnf("Could not parse scale message: %s because %v", string(body), err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
 			return
 		}
 
-		hr.scale.Ping()
-		hr.scale.SetRssi(message.Rssi)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// kegArchiveHandler returns the complete lifecycle of a single keg as JSON document
+func (hr *HandlerRepository) kegArchiveHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-		if message.MessageType == PushMessageType {
-			err = hr.scale.AddMeasurement(message.Value)
-			if err != nil {
-				hr.logger.Warnf("Could not create measurement: %v", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+		id := mux.Vars(r)["id"]
+		archive, err := hr.scale.GetKegArchive(id)
+		if err != nil {
+			http.Error(w, "Keg not found", http.StatusNotFound)
+			return
+		}
 
-			hr.logger.WithFields(logrus.Fields{
-				"message_id": message.MessageId,
-			}).Infof("Scale new value: %0.2f", message.Value)
+		res, err := json.Marshal(archive)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
 		}
 
-		_, _ = w.Write([]byte("OK"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=keg-%s.json", id))
+		_, _ = w.Write(res)
 	}
 }
 
-// metricsHandler returns HTTP handler for metrics endpoint
-func (hr *HandlerRepository) metricsHandler() http.Handler {
-	return promhttp.HandlerFor(
-		hr.monitor.Registry,
-		promhttp.HandlerOpts{
-			EnableOpenMetrics: true,
-			Registry:          hr.monitor.Registry,
-		},
-	)
+// kegReportHandler returns HTML feedback report of the keg for the brewery
+func (hr *HandlerRepository) kegReportHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		archive, err := hr.scale.GetKegArchive(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Keg not found", http.StatusNotFound)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := WriteKegReport(&buf, archive); err != nil {
+			hr.log(r).Errorf("Could not render keg report: %v", err)
+			http.Error(w, "Could not render report", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.URL.Query().Has("download") {
+			w.Header().Set("Content-Disposition", "attachment; filename="+reportFileName(archive.Keg))
+		}
+		_, _ = w.Write(buf.Bytes())
+	}
 }
 
-func (hr *HandlerRepository) activeKegHandler() func(http.ResponseWriter, *http.Request) {
+// weatherHandler accepts outdoor temperature from a weather webhook
+// body: {"temperature": 28.5, "at": "2024-07-01T18:00:00Z"} - at is optional
+func (hr *HandlerRepository) weatherHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
@@ -105,109 +3668,161 @@ func (hr *HandlerRepository) activeKegHandler() func(http.ResponseWriter, *http.
 		}
 
 		auth := r.Header.Get("Authorization")
-		if auth != hr.config.Password {
+		if !hr.config.Allows(auth, ScopeDeviceIngest) {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
 		type input struct {
-			Keg int `json:"keg"`
+			Temperature *float64  `json:"temperature"`
+			At          time.Time `json:"at"`
 		}
 
 		var data input
-		err := json.NewDecoder(r.Body).Decode(&data)
-		if err != nil {
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Temperature == nil {
 			http.Error(w, "Could not read post body", http.StatusBadRequest)
 			return
 		}
+		if data.At.IsZero() {
+			data.At = time.Now()
+		}
+
+		if err := hr.scale.store.AddWeather(WeatherSample{Temperature: *data.Temperature, At: data.At}); err != nil {
+			hr.log(r).Warnf("Could not store weather: %v", err)
+			http.Error(w, "Could not store weather", http.StatusInternalServerError)
+			return
+		}
 
-		switch data.Keg {
-		case 10, 15, 20, 30, 50:
-			// all is well
-		default:
-			http.Error(w, "Invalid keg size", http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(getOkJson())
+	}
+}
+
+// weatherStatsHandler returns daily consumption and temperature with their correlation
+func (hr *HandlerRepository) weatherStatsHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		days := 30
+		if raw := r.URL.Query().Get("days"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1 || parsed > 366 {
+				http.Error(w, "Invalid days", http.StatusBadRequest)
+				return
+			}
+			days = parsed
+		}
+
+		stats, err := GetWeatherStats(hr.scale.store, hr.holidays, days, hr.config.GlassSize, hr.config.PubDayStart, time.Now())
+		if err != nil {
+			hr.log(r).Errorf("Could not calculate weather stats: %v", err)
+			http.Error(w, "Could not calculate stats", http.StatusInternalServerError)
 			return
 		}
 
-		if err = hr.scale.SetActiveKeg(data.Keg); err != nil {
-			http.Error(w, "Could not set active keg", http.StatusInternalServerError)
+		res, err := json.Marshal(stats)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		_, _ = w.Write(getOkJson())
+		_, _ = w.Write(res)
 	}
 }
 
-const localizationUnits = "r:r,t:t,d:d,h:h,m:m,s:s,ms:ms,microsecond"
+// holidaysHandler returns holidays of the year (current year by default)
+func (hr *HandlerRepository) holidaysHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		year := time.Now().In(getTz()).Year()
+		if raw := r.URL.Query().Get("year"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed < 1900 || parsed > 2200 {
+				http.Error(w, "Invalid year", http.StatusBadRequest)
+				return
+			}
+			year = parsed
+		}
 
-func (hr *HandlerRepository) scaleDashboardHandler() func(http.ResponseWriter, *http.Request) {
+		res, err := json.Marshal(hr.holidays.Year(year))
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(res)
+	}
+}
+
+// ratingHandler lets patrons rate the beer on tap
+// it's public, so every client address is rate limited
+func (hr *HandlerRepository) ratingHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		hr.scale.Recheck()
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-		type warehouseItem struct {
-			Keg    int `json:"keg"`
-			Amount int `json:"amount"`
+		type input struct {
+			Up      *bool  `json:"up"`
+			Comment string `json:"comment"` // optional
 		}
 
-		type pubOutput struct {
-			IsOpen   bool   `json:"is_open"`
-			OpenedAt string `json:"opened_at"`
-			ClosedAt string `json:"closed_at"`
+		var data input
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&data); err != nil || data.Up == nil {
+			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			return
 		}
 
-		type output struct {
-			IsOk               bool            `json:"is_ok"`
-			BeersLeft          int             `json:"beers_left"`
-			LastWeight         float64         `json:"last_weight"`
-			LastWeightFormated string          `json:"last_weight_formated"`
-			LastAt             string          `json:"last_at"`
-			LastAtDuration     string          `json:"last_at_duration"`
-			Rssi               float64         `json:"rssi"`
-			LastUpdate         string          `json:"last_update"`
-			LastUpdateDuration string          `json:"last_update_duration"`
-			Pub                pubOutput       `json:"pub"`
-			ActiveKeg          int             `json:"active_keg"`
-			IsLow              bool            `json:"is_low"`
-			Warehouse          []warehouseItem `json:"warehouse"`
+		comment := strings.TrimSpace(data.Comment)
+		if len([]rune(comment)) > ratingCommentMaxLength {
+			http.Error(w, fmt.Sprintf("Comment is longer than %d characters", ratingCommentMaxLength), http.StatusBadRequest)
+			return
 		}
 
-		units, err := durafmt.DefaultUnitsCoder.Decode(localizationUnits)
-		if err != nil {
-			http.Error(w, "Could not decode units", http.StatusInternalServerError)
+		ip := clientIp(r, hr.config.TrustForwarded)
+		if !hr.ratingLimiter.Allow(ip.String()) {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 			return
 		}
 
-		warehouse := []warehouseItem{
-			{Keg: 10, Amount: hr.scale.Warehouse[0]},
-			{Keg: 15, Amount: hr.scale.Warehouse[1]},
-			{Keg: 20, Amount: hr.scale.Warehouse[2]},
-			{Keg: 30, Amount: hr.scale.Warehouse[3]},
-			{Keg: 50, Amount: hr.scale.Warehouse[4]},
+		if _, err := hr.scale.RateActiveKeg(*data.Up, comment); err != nil {
+			hr.log(r).Warnf("Could not store rating: %v", err)
+			http.Error(w, "Could not store rating", http.StatusConflict)
+			return
 		}
 
-		data := output{
-			IsOk:               hr.scale.IsOk(),
-			BeersLeft:          hr.scale.BeersLeft,
-			LastWeight:         hr.scale.Weight,
-			LastWeightFormated: fmt.Sprintf("%.2f", hr.scale.Weight/1000),
-			LastAt:             formatDate(hr.scale.WeightAt),
-			LastAtDuration:     durafmt.Parse(time.Since(hr.scale.WeightAt).Round(time.Second)).LimitFirstN(2).Format(units),
-			Rssi:               hr.scale.Rssi,
-			LastUpdate:         formatDate(hr.scale.LastOk),
-			LastUpdateDuration: durafmt.Parse(time.Since(hr.scale.LastOk).Round(time.Second)).LimitFirstN(2).Format(units),
-			Pub: pubOutput{
-				IsOpen:   hr.scale.Pub.IsOpen,
-				OpenedAt: formatTime(hr.scale.Pub.OpenedAt),
-				ClosedAt: formatTime(hr.scale.Pub.ClosedAt),
-			},
-			ActiveKeg: hr.scale.ActiveKeg,
-			IsLow:     hr.scale.IsLow,
-			Warehouse: warehouse,
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(getOkJson())
+	}
+}
+
+// beerHistoryHandler returns all kegs with their ratings, the newest first
+func (hr *HandlerRepository) beerHistoryHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
 		}
 
-		res, err := json.Marshal(data)
+		history, err := hr.scale.GetBeerHistory()
+		if err != nil {
+			hr.log(r).Errorf("Could not load beer history: %v", err)
+			http.Error(w, "Could not load beer history", http.StatusInternalServerError)
+			return
+		}
 
+		res, err := json.Marshal(history)
 		if err != nil {
 			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
 			return
@@ -218,46 +3833,43 @@ func (hr *HandlerRepository) scaleDashboardHandler() func(http.ResponseWriter, *
 	}
 }
 
-func (hr *HandlerRepository) scaleWarehouseHandler() func(http.ResponseWriter, *http.Request) {
+// metricSeriesHandler lists currently registered metric series and metrics over the cardinality limit
+func (hr *HandlerRepository) metricSeriesHandler() func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		if r.Method != http.MethodGet {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
 		auth := r.Header.Get("Authorization")
-		if auth != hr.config.Password {
+		if !hr.config.Allows(auth, ScopeAdmin) {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		type input struct {
-			Keg int    `json:"keg"`
-			Way string `json:"way"` // up or down
-		}
-
-		var data input
-		err := json.NewDecoder(r.Body).Decode(&data)
+		series, err := ListSeries(hr.monitor.Registry)
 		if err != nil {
-			http.Error(w, "Could not read post body", http.StatusBadRequest)
+			http.Error(w, "Could not gather metrics", http.StatusInternalServerError)
 			return
 		}
 
-		if strings.ToLower(data.Way) == "up" {
-			if err := hr.scale.IncreaseWarehouse(data.Keg); err != nil {
-				http.Error(w, "Could not increase warehouse", http.StatusInternalServerError)
-				return
-			}
+		type output struct {
+			Limit     int            `json:"limit"`
+			Offenders map[string]int `json:"offenders"` // metric => observations folded into the overflow series
+			Metrics   []SeriesInfo   `json:"metrics"`
 		}
 
-		if strings.ToLower(data.Way) == "down" {
-			if err := hr.scale.DecreaseWarehouse(data.Keg); err != nil {
-				http.Error(w, "Could not increase warehouse", http.StatusInternalServerError)
-				return
-			}
+		res, err := json.Marshal(output{
+			Limit:     hr.config.MetricMaxSeries,
+			Offenders: hr.monitor.guard.Offenders(),
+			Metrics:   series,
+		})
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		_, _ = w.Write(getOkJson())
+		_, _ = w.Write(res)
 	}
 }
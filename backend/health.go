@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HealthStatus is the state of a component, the report takes the worst of them
+type HealthStatus string
+
+const (
+	HealthOk       HealthStatus = "ok"
+	HealthDegraded HealthStatus = "degraded"
+	HealthDown     HealthStatus = "down"
+)
+
+// healthRank orders the statuses from the best to the worst
+var healthRank = map[HealthStatus]int{HealthOk: 0, HealthDegraded: 1, HealthDown: 2}
+
+// HealthComponent is the state of a single dependency
+type HealthComponent struct {
+	Name     string       `json:"name"`
+	Status   HealthStatus `json:"status"`
+	Critical bool         `json:"critical"` // the server is not ready while the component is down
+	Message  string       `json:"message,omitempty"`
+}
+
+// HealthReport is the state of the server and its dependencies
+type HealthReport struct {
+	Status     HealthStatus      `json:"status"`
+	Ready      bool              `json:"ready"` // no critical component is down
+	At         time.Time         `json:"at"`
+	Components []HealthComponent `json:"components"`
+}
+
+// health probes the storage and reports whether the scales delivered data within [OkLimit]
+// offline scales are not critical, the server serves the history and the pub may be just closed
+// neither is the unreachable storage when the write-ahead log or degraded mode keeps the writes,
+// restarting the server would lose the state held in memory
+func (hr *HandlerRepository) health(now time.Time) HealthReport {
+	report := HealthReport{Status: HealthOk, Ready: true, At: now}
+	add := func(component HealthComponent) {
+		report.Components = append(report.Components, component)
+		if healthRank[component.Status] > healthRank[report.Status] {
+			report.Status = component.Status
+		}
+		if component.Critical && component.Status == HealthDown {
+			report.Ready = false
+		}
+	}
+
+	storage := HealthComponent{Name: "storage", Status: HealthOk, Critical: true}
+	if err := hr.scale.store.Ping(); err != nil {
+		storage.Status = HealthDown
+		storage.Message = fmt.Sprintf("%s storage is unreachable: %v", hr.config.StorageDriver, err)
+		switch {
+		case hr.wal != nil:
+			storage.Status, storage.Critical = HealthDegraded, false
+			storage.Message += fmt.Sprintf(", %d writes are kept by the write-ahead log", hr.wal.Pending())
+		case hr.scale.IsDegraded():
+			storage.Status, storage.Critical = HealthDegraded, false
+			storage.Message += ", the state is kept in memory"
+		}
+	} else if hr.scale.IsDegraded() {
+		storage.Status = HealthDegraded
+		storage.Message = "recovering from an outage, the state is kept in memory"
+	}
+	add(storage)
+
+	devices := []string{""}
+	if hr.scales != nil {
+		devices = hr.scales.Devices()
+	}
+	for _, device := range devices {
+		scale, _ := hr.scaleOf(device)
+		component := HealthComponent{Name: "scale", Status: HealthOk}
+		if device != "" {
+			component.Name = "scale:" + device
+		}
+		if !scale.IsOk() {
+			component.Status = HealthDegraded
+			component.Message = fmt.Sprintf("no data within %s", OkLimit)
+		}
+		add(component)
+	}
+
+	return report
+}
+
+// healthHandler serves the health report, notReady is the HTTP status when the server is not ready
+// liveness probes get 200 as long as the server responds, so an outage of the storage does not restart it
+func (hr *HandlerRepository) healthHandler(notReady int) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := hr.health(time.Now())
+		res, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, "Could not marshal data to JSON", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !report.Ready {
+			w.WriteHeader(notReady)
+		}
+		_, _ = w.Write(res)
+	}
+}
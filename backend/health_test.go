@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerRepository_Health(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	store := &failingStore{}
+	s := NewScale(NewConfig(), NewMonitor(), store, logger)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: logger}
+
+	probe := func(path string, notReady int) (int, HealthReport) {
+		w := httptest.NewRecorder()
+		hr.healthHandler(notReady)(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var report HealthReport
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	// no data from the scale yet, e.g. the pub is closed
+	code, report := probe("/readyz", http.StatusServiceUnavailable)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, report.Ready)
+	assert.Equal(t, HealthDegraded, report.Status)
+	assert.Len(t, report.Components, 2)
+	assert.Equal(t, HealthComponent{Name: "storage", Status: HealthOk, Critical: true}, report.Components[0])
+	assert.Equal(t, "scale", report.Components[1].Name)
+	assert.Equal(t, HealthDegraded, report.Components[1].Status)
+
+	s.Ping()
+	_, report = probe("/readyz", http.StatusServiceUnavailable)
+	assert.Equal(t, HealthOk, report.Status)
+	assert.Equal(t, HealthOk, report.Components[1].Status)
+
+	// storage is down, liveness keeps passing
+	store.down = true
+	code, report = probe("/readyz", http.StatusServiceUnavailable)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, report.Ready)
+	assert.Equal(t, HealthDown, report.Status)
+	assert.Contains(t, report.Components[0].Message, "connection refused")
+
+	code, report = probe("/healthz", http.StatusOK)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, report.Ready)
+
+	w := httptest.NewRecorder()
+	hr.healthHandler(http.StatusOK)(w, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestHandlerRepository_HealthStorageOutage(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	store := &failingStore{down: true}
+	s := NewScale(NewConfig(), NewMonitor(), store, logger)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: logger}
+	ready := func() (int, HealthComponent) {
+		w := httptest.NewRecorder()
+		hr.healthHandler(http.StatusServiceUnavailable)(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report HealthReport
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report.Components[0]
+	}
+
+	code, storage := ready()
+	assert.Equal(t, http.StatusServiceUnavailable, code, "nothing keeps the writes")
+	assert.True(t, storage.Critical)
+
+	// the scale keeps its state in memory
+	assert.Nil(t, s.AddMeasurement(20000, SourceHttp))
+	assert.True(t, s.IsDegraded())
+	code, storage = ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, HealthDegraded, storage.Status)
+	assert.False(t, storage.Critical)
+	assert.Contains(t, storage.Message, "the state is kept in memory")
+
+	// writes are buffered by the write-ahead log
+	s = NewScale(s.config, NewMonitor(), store, logger)
+	hr.scale = s
+	hr.wal = NewWalStore(store, filepath.Join(t.TempDir(), "wal.jsonl"), NewMonitor(), logger)
+	assert.Nil(t, hr.wal.AddMeasurement(Measurement{Weight: 20000, At: time.Now()}))
+	code, storage = ready()
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, storage.Critical)
+	assert.Contains(t, storage.Message, "1 writes are kept by the write-ahead log")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Holiday is a day when the pub behaves differently than on a regular day of the week
+type Holiday struct {
+	Day  string `json:"day"` // YYYY-MM-DD
+	Name string `json:"name"`
+}
+
+// HolidayCalendar knows public holidays and custom days (local feasts, private events)
+// so schedules and forecasts do not treat them as anomalies
+type HolidayCalendar struct {
+	country string            // cz or none
+	extra   map[string]string // YYYY-MM-DD => name
+}
+
+func NewHolidayCalendar(config *Config) *HolidayCalendar {
+	return &HolidayCalendar{
+		country: config.HolidayCalendar,
+		extra:   config.Holidays,
+	}
+}
+
+// Holiday returns name of the holiday if the local day of t is a holiday
+func (hc *HolidayCalendar) Holiday(t time.Time) (string, bool) {
+	day := t.In(getTz()).Format(time.DateOnly)
+	if name, found := hc.extra[day]; found {
+		return name, true
+	}
+
+	for _, h := range publicHolidays(hc.country, t.In(getTz()).Year()) {
+		if h.Day == day {
+			return h.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// IsHoliday returns true if the local day of t is a holiday
+func (hc *HolidayCalendar) IsHoliday(t time.Time) bool {
+	_, found := hc.Holiday(t)
+	return found
+}
+
+// Year returns all holidays of the year ordered by date
+func (hc *HolidayCalendar) Year(year int) []Holiday {
+	holidays := publicHolidays(hc.country, year)
+	prefix := fmt.Sprintf("%04d-", year)
+	for day, name := range hc.extra {
+		if len(day) == len(time.DateOnly) && day[:5] == prefix {
+			holidays = append(holidays, Holiday{Day: day, Name: name})
+		}
+	}
+
+	sort.SliceStable(holidays, func(i, j int) bool {
+		return holidays[i].Day < holidays[j].Day
+	})
+
+	return holidays
+}
+
+// publicHolidays returns public holidays of the country
+func publicHolidays(country string, year int) []Holiday {
+	if country != "cz" {
+		return []Holiday{}
+	}
+
+	date := func(month time.Month, day int) string {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+	}
+	easter := easterSunday(year)
+
+	return []Holiday{
+		{Day: date(time.January, 1), Name: "Den obnovy samostatného českého státu"},
+		{Day: easter.AddDate(0, 0, -2).Format(time.DateOnly), Name: "Velký pátek"},
+		{Day: easter.AddDate(0, 0, 1).Format(time.DateOnly), Name: "Velikonoční pondělí"},
+		{Day: date(time.May, 1), Name: "Svátek práce"},
+		{Day: date(time.May, 8), Name: "Den vítězství"},
+		{Day: date(time.July, 5), Name: "Den slovanských věrozvěstů Cyrila a Metoděje"},
+		{Day: date(time.July, 6), Name: "Den upálení mistra Jana Husa"},
+		{Day: date(time.September, 28), Name: "Den české státnosti"},
+		{Day: date(time.October, 28), Name: "Den vzniku samostatného československého státu"},
+		{Day: date(time.November, 17), Name: "Den boje za svobodu a demokracii"},
+		{Day: date(time.December, 24), Name: "Štědrý den"},
+		{Day: date(time.December, 25), Name: "1. svátek vánoční"},
+		{Day: date(time.December, 26), Name: "2. svátek vánoční"},
+	}
+}
+
+// easterSunday calculates Easter Sunday of the Gregorian calendar (anonymous Gregorian algorithm)
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEasterSunday(t *testing.T) {
+	assert.Equal(t, "2024-03-31", easterSunday(2024).Format(time.DateOnly))
+	assert.Equal(t, "2025-04-20", easterSunday(2025).Format(time.DateOnly))
+	assert.Equal(t, "2026-04-05", easterSunday(2026).Format(time.DateOnly))
+}
+
+func TestHolidayCalendar(t *testing.T) {
+	hc := NewHolidayCalendar(&Config{
+		HolidayCalendar: "cz",
+		Holidays:        map[string]string{"2024-08-17": "Pouť"},
+	})
+
+	name, found := hc.Holiday(time.Date(2024, 4, 1, 20, 0, 0, 0, getTz()))
+	assert.True(t, found)
+	assert.Equal(t, "Velikonoční pondělí", name)
+
+	assert.True(t, hc.IsHoliday(time.Date(2024, 8, 17, 22, 0, 0, 0, getTz())))
+	assert.True(t, hc.IsHoliday(time.Date(2024, 12, 24, 23, 30, 0, 0, getTz())))
+	assert.False(t, hc.IsHoliday(time.Date(2024, 12, 27, 20, 0, 0, 0, getTz())))
+
+	year := hc.Year(2024)
+	assert.Len(t, year, 14)
+	assert.Equal(t, "2024-08-17", year[7].Day)
+
+	assert.False(t, NewHolidayCalendar(&Config{HolidayCalendar: "none"}).IsHoliday(time.Date(2024, 12, 24, 20, 0, 0, 0, getTz())))
+}
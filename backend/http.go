@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -23,11 +31,9 @@ func NewRouter(hr *HandlerRepository) *mux.Router {
 
 	router.Use(func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-
 			w.Header().Set("Access-Control-Allow-Origin", "*")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Request-Id, Authorization, accept, origin, Cache-Control, X-Requested-With")
 			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 			if r.Method == "OPTIONS" {
@@ -35,36 +41,183 @@ func NewRouter(hr *HandlerRepository) *mux.Router {
 				return
 			}
 
-			lrw := NewLoggingResponseWriter(w)
-			handler.ServeHTTP(lrw, r)
-			d := time.Since(start)
-
-			hr.logger.WithFields(logrus.Fields{
-				"status":     lrw.statusCode,
-				"method":     r.Method,
-				"path":       r.URL.Path,
-				"remoteAddr": r.RemoteAddr,
-				"durationMs": d.Milliseconds(),
-				"duration":   d.String(),
-			}).Info("Request")
+			handler.ServeHTTP(w, r)
 		})
 	})
+	router.Use(hr.requestLogger)
+	router.Use(hr.readAuth)
 
+	router.HandleFunc("/healthz", hr.healthHandler(http.StatusOK))
+	router.HandleFunc("/readyz", hr.healthHandler(http.StatusServiceUnavailable))
 	router.Handle("/metrics", hr.metricsHandler())
-	router.HandleFunc("/api/scale/push", hr.scaleMessageHandler())
+	router.Handle("/metrics/public", hr.publicMetricsHandler())
+	router.HandleFunc("/api/metrics/series", hr.metricSeriesHandler())
+	router.HandleFunc("/api/admin/info", hr.adminInfoHandler())
+	router.HandleFunc("/api/admin/selfcheck", hr.selfCheckHandler())
+	router.HandleFunc("/api/admin/retention", hr.retentionHandler())
+	router.HandleFunc("/api/admin/diagnose", hr.diagnoseHandler())
+	router.HandleFunc("/api/scale/push", hr.ingestAllowlist(hr.scaleMessageHandler()))
+	router.HandleFunc("/api/scale/batch", hr.ingestAllowlist(hr.requireStore(hr.scaleBatchHandler())))
+	router.HandleFunc("/api/scale/last-ack", hr.ingestAllowlist(hr.scaleLastAckHandler()))
+	router.HandleFunc("/api/scales", hr.scalesHandler())
+	router.HandleFunc("/api/scales/registry", hr.requireStore(hr.registryHandler()))
 	router.HandleFunc("/api/scale/status", hr.scaleStatusHandler())
 	router.HandleFunc("/api/scale/dashboard", hr.scaleDashboardHandler())
-	router.HandleFunc("/api/scale/warehouse", hr.scaleWarehouseHandler())
+	router.HandleFunc("/api/scale/warehouse", hr.requireStore(hr.scaleWarehouseHandler()))
+	router.HandleFunc("/api/scale/measurements", hr.requireStore(hr.measurementsHandler()))
+	router.HandleFunc("/api/scale/calibration", hr.requireStore(hr.calibrationHandler()))
+	router.HandleFunc("/api/scale/calibration/history", hr.calibrationHistoryHandler())
+	router.HandleFunc("/api/scale/calibration/preview", hr.calibrationPreviewHandler())
+	router.HandleFunc("/api/scale/tare-shift", hr.requireStore(hr.tareShiftHandler()))
+	router.HandleFunc("/api/scale/shadow", hr.requireStore(hr.scaleShadowHandler()))
+	router.HandleFunc("/api/firmware", hr.requireStore(hr.firmwareHandler()))
+	router.HandleFunc("/api/scale/pour/stream", hr.pourStreamHandler())
+	router.HandleFunc("/ws", hr.dashboardSocketHandler())
+	router.HandleFunc("/ws/admin", hr.adminSocketHandler())
+
+	router.HandleFunc("/api/events", hr.eventStreamHandler())
+	router.HandleFunc("/api/events/schemas", hr.eventSchemasHandler())
+	router.HandleFunc("/api/events/schemas/{file}", hr.eventSchemaHandler())
+	router.HandleFunc("/api/openapi.json", hr.openApiHandler(router))
+
+	router.HandleFunc("/api/public/status", hr.publicAuth(hr.publicStatusHandler()))
+	router.HandleFunc("/api/public/rating", hr.requireStore(hr.ratingHandler()))
+	router.HandleFunc("/api/taplist", hr.requireStore(hr.taplistHandler()))
+
+	router.HandleFunc("/api/guest/links", hr.guestLinkHandler())
+	router.HandleFunc("/api/guest/dashboard", hr.guestAuth(hr.scaleDashboardHandler()))
+
+	router.HandleFunc("/api/exports", hr.exportsHandler())
+	router.HandleFunc("/api/exports/{file}", hr.exportFileHandler())
+	router.HandleFunc("/api/export", hr.spreadsheetHandler())
+	router.HandleFunc("/api/backup", hr.requireStore(hr.backupHandler()))
+
+	router.HandleFunc("/api/pours", hr.poursHandler())
+	router.HandleFunc("/api/measurements", hr.measurementsQueryHandler())
+	router.HandleFunc("/api/measurements/{id}", hr.requireStore(hr.measurementHandler()))
+
+	router.HandleFunc("/api/kegs", hr.beerHistoryHandler())
+	router.HandleFunc("/api/kegs/compare", hr.kegsCompareHandler())
+	router.HandleFunc("/api/kegs/pending", hr.requireStore(hr.pendingKegHandler()))
+	router.HandleFunc("/api/kegs/button", hr.requireStore(hr.kegButtonHandler()))
+	router.HandleFunc("/api/kegs/models", hr.requireStore(hr.kegModelsHandler()))
+	router.HandleFunc("/api/kegs/untapped", hr.untappedKegsHandler())
+	router.HandleFunc("/api/kegs/history", hr.kegHistoryHandler())
+	router.HandleFunc("/api/kegs/{id}/retap", hr.requireStore(hr.retapKegHandler()))
+	router.HandleFunc("/api/kegs/{id}/archive", hr.kegArchiveHandler())
+	router.HandleFunc("/api/kegs/{id}/report", hr.kegReportHandler())
+
+	router.HandleFunc("/api/alerts/alertmanager", hr.alertmanagerHandler())
 
-	router.HandleFunc("/api/pub/active_keg", hr.activeKegHandler())
+	router.HandleFunc("/api/holidays", hr.holidaysHandler())
+	router.HandleFunc("/api/weather", hr.requireStore(hr.weatherHandler()))
+	router.HandleFunc("/api/stats/weather", hr.weatherStatsHandler())
+	router.HandleFunc("/api/stats/sessions", hr.sessionStatsHandler())
+	router.HandleFunc("/api/stats/occupancy", hr.occupancyStatsHandler())
+	router.HandleFunc("/api/stats/daily", hr.dailyStatsHandler())
+	router.HandleFunc("/api/stats/trends", hr.trendsHandler())
+	router.HandleFunc("/api/stats/diff", hr.diffHandler())
+	router.HandleFunc("/api/stats/annotations", hr.annotationsHandler())
+	router.HandleFunc("/api/stats/community", hr.communityHandler())
 
-	// frontend
+	router.HandleFunc("/api/pub/active_keg", hr.requireStore(hr.activeKegHandler()))
+	router.HandleFunc("/api/pub/cleaning", hr.requireStore(hr.cleaningHandler()))
+	router.HandleFunc("/api/pub/open", hr.requireStore(hr.pubOverrideHandler(true)))
+	router.HandleFunc("/api/pub/close", hr.requireStore(hr.pubOverrideHandler(false)))
+	router.HandleFunc("/api/pub/session", hr.requireStore(hr.sessionTagHandler()))
+	router.HandleFunc("/api/pub/tap", hr.tapHandler())
+
+	router.HandleFunc("/api/people", hr.requireStore(hr.peopleHandler()))
+	router.HandleFunc("/api/people/stats", hr.peopleStatsHandler())
+	router.HandleFunc("/api/tabs", hr.tabsHandler())
+	router.HandleFunc("/api/tabs/settle", hr.requireStore(hr.tabsSettleHandler()))
+
+	router.HandleFunc("/status", hr.statusPageHandler())
+
+	// frontend, the status page is served instead when it's not deployed
 	dir := hr.config.FrontendPath
+	if _, err := os.Stat(path.Join(dir, "index.html")); err != nil {
+		router.HandleFunc("/", hr.statusPageHandler())
+	}
 	router.PathPrefix("/").Handler(http.StripPrefix("/", reactRedirect(http.FileServer(http.Dir(dir)), dir)))
 
 	return router
 }
 
+// NewIngestRouter creates a router for the mTLS ingestion port
+// only the scale endpoints are exposed there
+func NewIngestRouter(hr *HandlerRepository) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(hr.requestLogger)
+	router.HandleFunc("/api/scale/push", hr.ingestAllowlist(hr.scaleMessageHandler()))
+	router.HandleFunc("/api/scale/batch", hr.ingestAllowlist(hr.requireStore(hr.scaleBatchHandler())))
+	router.HandleFunc("/api/scale/last-ack", hr.ingestAllowlist(hr.scaleLastAckHandler()))
+
+	return router
+}
+
+// requestIdHeader carries the id of the request, an id sent by a proxy is kept
+const requestIdHeader = "X-Request-Id"
+
+type requestIdKey struct{}
+
+// requestLogger is a middleware logging every request with its status and duration
+// every request gets an id, it's returned in the response header and attached to log lines of handlers
+func (hr *HandlerRepository) requestLogger(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIdHeader)
+		if !requestIdPattern.MatchString(id) {
+			id = newRequestId()
+		}
+		w.Header().Set(requestIdHeader, id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIdKey{}, id))
+
+		lrw := NewLoggingResponseWriter(w)
+		handler.ServeHTTP(lrw, r)
+		d := time.Since(start)
+
+		// route template keeps the cardinality low, e.g. /api/kegs/{id}/report
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		if hr.monitor != nil {
+			labels := hr.monitor.guard.Labels("scale_http_request_duration_seconds", route, r.Method, strconv.Itoa(lrw.statusCode))
+			hr.monitor.httpDuration.WithLabelValues(labels...).Observe(d.Seconds())
+		}
+
+		hr.log(r).WithFields(logrus.Fields{
+			"status":     lrw.statusCode,
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"route":      route,
+			"remoteAddr": r.RemoteAddr,
+			"durationMs": d.Milliseconds(),
+			"duration":   d.String(),
+		}).Info("Request")
+	})
+}
+
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func newRequestId() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// log returns the logger with the id of the request
+func (hr *HandlerRepository) log(r *http.Request) *logrus.Entry {
+	if id, ok := r.Context().Value(requestIdKey{}).(string); ok {
+		return hr.logger.WithField("request_id", id)
+	}
+	return logrus.NewEntry(hr.logger)
+}
+
 // reactRedirect is a middleware that redirects all requests to the React app (index.html)
 // it checks if the requested file exists and if not it redirects to index.html
 func reactRedirect(server http.Handler, dir string) http.Handler {
@@ -88,10 +241,11 @@ func reactRedirect(server http.Handler, dir string) http.Handler {
 
 // StartServer starts HTTP server
 // It listens for SIGINT and SIGTERM signals and gracefully stops the server
-func StartServer(router *mux.Router, port int, mainCancel context.CancelFunc) {
+// it returns after the server has stopped, so the caller can flush the state
+func StartServer(handler http.Handler, port int, mainCancel context.CancelFunc) {
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: router,
+		Handler: handler,
 	}
 
 	done := make(chan os.Signal, 1)
@@ -109,18 +263,66 @@ func StartServer(router *mux.Router, port int, mainCancel context.CancelFunc) {
 	log.Printf("Server Stopped")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer func() {
-		// extra handling here
-		cancel()
-	}()
+	defer cancel()
 
+	// in-flight requests are given the timeout, the state is flushed by the caller anyway
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server Shutdown Failed:%+v", err)
+		log.Printf("Server Shutdown Failed:%+v", err)
+		return
 	}
 
 	log.Printf("Server Exited Properly")
 }
 
+// StartIngestServer starts HTTPS server requiring client certificates signed by the configured CA
+// the device authenticates by its certificate, so no bearer token has to be stored in the firmware
+// It stops when ctx is done
+func StartIngestServer(ctx context.Context, router *mux.Router, config *Config, logger *logrus.Logger) error {
+	pool, err := loadClientCa(config.IngestTlsClientCa)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", config.IngestTlsPort),
+		Handler: router,
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	logger.Infof("Ingest server started on port %d", config.IngestTlsPort)
+	err = srv.ListenAndServeTLS(config.IngestTlsCert, config.IngestTlsKey)
+	if err != nil && err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// loadClientCa reads the CA signing certificates of devices and gateways
+func loadClientCa(path string) (*x509.CertPool, error) {
+	ca, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("client CA contains no certificates")
+	}
+
+	return pool, nil
+}
+
 type loggingResponseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -134,3 +336,20 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.statusCode = code
 	lrw.ResponseWriter.WriteHeader(code)
 }
+
+// Flush implements http.Flusher, so streaming handlers work behind the logging middleware
+func (lrw *loggingResponseWriter) Flush() {
+	if flusher, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, so WebSocket upgrade works behind the logging middleware
+func (lrw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := lrw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	lrw.statusCode = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	monitor := NewMonitor()
+	hr := &HandlerRepository{monitor: monitor, logger: logger}
+
+	router := mux.NewRouter()
+	router.Use(hr.requestLogger)
+	router.HandleFunc("/api/kegs/{id}/report", func(w http.ResponseWriter, r *http.Request) {
+		hr.log(r).Warn("Keg not found")
+		http.Error(w, "Keg not found", http.StatusNotFound)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/kegs/20240501-180000/report", nil))
+	id := w.Header().Get(requestIdHeader)
+	assert.Len(t, id, 16)
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte(`"request_id":"`+id+`"`)), "handler log line and access log")
+	assert.Contains(t, buf.String(), `"route":"/api/kegs/{id}/report"`)
+
+	// id assigned by a proxy is kept, invalid one is replaced
+	req := httptest.NewRequest(http.MethodGet, "/api/kegs/1/report", nil)
+	req.Header.Set(requestIdHeader, "edge-42")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "edge-42", w.Header().Get(requestIdHeader))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/kegs/1/report", nil)
+	req.Header.Set(requestIdHeader, "<script>")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.NotEqual(t, "<script>", w.Header().Get(requestIdHeader))
+
+	families, err := monitor.Registry.Gather()
+	assert.Nil(t, err)
+	found := false
+	for _, family := range families {
+		if family.GetName() != "scale_http_request_duration_seconds" {
+			continue
+		}
+		found = true
+		assert.Len(t, family.GetMetric(), 1, "one series per route")
+		assert.Equal(t, uint64(3), family.GetMetric()[0].GetHistogram().GetSampleCount())
+	}
+	assert.True(t, found)
+}
+
+// testCa issues certificates of servers and devices for TLS tests
+type testCa struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCa(t *testing.T) *testCa {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "keg-scale test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return &testCa{cert: cert, key: key}
+}
+
+// issue signs the certificate valid for localhost, the common name is the identity of the client
+func (ca *testCa) issue(t *testing.T, commonName string, dnsNames ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     append([]string{"localhost"}, dnsNames...),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.Nil(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (ca *testCa) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// writeTlsFiles stores the CA and the server certificate as PEM files of [Config.IngestTlsClientCa], IngestTlsCert and IngestTlsKey
+func (ca *testCa) writeTlsFiles(t *testing.T, config *Config) {
+	dir := t.TempDir()
+	server := ca.issue(t, "keg-scale")
+	key, err := x509.MarshalECPrivateKey(server.PrivateKey.(*ecdsa.PrivateKey))
+	assert.Nil(t, err)
+
+	config.IngestTlsClientCa = filepath.Join(dir, "ca.pem")
+	config.IngestTlsCert = filepath.Join(dir, "cert.pem")
+	config.IngestTlsKey = filepath.Join(dir, "key.pem")
+	assert.Nil(t, os.WriteFile(config.IngestTlsClientCa, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600))
+	assert.Nil(t, os.WriteFile(config.IngestTlsCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate[0]}), 0600))
+	assert.Nil(t, os.WriteFile(config.IngestTlsKey, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600))
+}
+
+func TestStartIngestServer(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ScaleDevices = []string{"tap2"}
+	ca := newTestCa(t)
+	ca.writeTlsFiles(t, config)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	config.IngestTlsPort = listener.Addr().(*net.TCPAddr).Port
+	assert.Nil(t, listener.Close())
+
+	store := &FakeStore{}
+	scales := NewScaleRegistry(NewScale(config, NewMonitor(), store, logger))
+	assert.Nil(t, scales.AddDevices(config, NewMonitor(), store, logger))
+	hr := &HandlerRepository{scale: scales.Default(), scales: scales, config: config, monitor: scales.Default().monitor, capture: NewCapture(config), mirror: NewMirror(config, scales.Default().monitor, logger), logger: logger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = StartIngestServer(ctx, NewIngestRouter(hr), config, logger) }()
+
+	push := func(certs []tls.Certificate, body, auth string) (int, error) {
+		client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: ca.pool(), Certificates: certs},
+		}}
+		r, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("https://localhost:%d/api/scale/push", config.IngestTlsPort), strings.NewReader(body))
+		r.Header.Set("Authorization", auth)
+		res, err := client.Do(r)
+		if err != nil {
+			return 0, err
+		}
+		defer res.Body.Close()
+		return res.StatusCode, nil
+	}
+	assert.Eventually(t, func() bool {
+		_, err := push(nil, "", "")
+		return err != nil && !strings.Contains(err.Error(), "connection refused")
+	}, 5*time.Second, 10*time.Millisecond, "server is listening")
+
+	// the certificate replaces the token, but only for its own device
+	def := []tls.Certificate{ca.issue(t, "default")}
+	code, err := push(def, "push|1|-70|20000", "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	code, err = push(def, "push|tap2|1|-61|20500", config.AuthToken)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, code, "the scale can't report for another one")
+	code, err = push([]tls.Certificate{ca.issue(t, "tap2.pub.example", "tap2")}, "push|tap2|1|-61|20500", "")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, code, "device id in the DNS name")
+	tap2, _ := scales.Get("tap2")
+	assert.Equal(t, 20500.0, tap2.Weight)
+
+	// client certificate is required
+	_, err = push(nil, "push|2|-70|19900", config.AuthToken)
+	assert.NotNil(t, err)
+	_, err = push([]tls.Certificate{newTestCa(t).issue(t, "default")}, "push|2|-70|19900", config.AuthToken)
+	assert.NotNil(t, err, "certificate of another CA")
+}
+
+func TestHandlerRepository_AuthenticateDeviceTls(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	hr := &HandlerRepository{scale: s, config: s.config, monitor: s.monitor, capture: NewCapture(s.config), mirror: NewMirror(s.config, s.monitor, s.logger), logger: s.logger}
+	ca := newTestCa(t)
+	srv := httptest.NewUnstartedServer(NewIngestRouter(hr))
+	srv.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: ca.pool()}
+	srv.StartTLS()
+	defer srv.Close()
+
+	push := func(certs []tls.Certificate, auth string) int {
+		transport := srv.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		r, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/scale/push", strings.NewReader("push|1|-70|20000"))
+		r.Header.Set("Authorization", auth)
+		res, err := (&http.Client{Transport: transport}).Do(r)
+		assert.Nil(t, err)
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, push([]tls.Certificate{ca.issue(t, "default")}, ""), "verified client")
+	assert.Equal(t, http.StatusUnauthorized, push(nil, ""), "unverified client needs the token")
+	assert.Equal(t, http.StatusOK, push(nil, s.config.AuthToken))
+}
+
+func TestHandlerRepository_IngestAllowlist(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	_, pub, err := net.ParseCIDR("203.0.113.0/24")
+	assert.Nil(t, err)
+	s.config.IngestAllowlist = []*net.IPNet{pub}
+	hr := &HandlerRepository{scale: s, config: s.config, monitor: s.monitor, logger: s.logger}
+	handler := hr.ingestAllowlist(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	push := func(remoteAddr string, forwarded ...string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/scale/push", nil)
+		r.RemoteAddr = remoteAddr
+		for _, value := range forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, push("203.0.113.7:4321"))
+	assert.Equal(t, http.StatusForbidden, push("198.51.100.1:4321"))
+	assert.Equal(t, http.StatusForbidden, push("10.0.0.2:4321", "203.0.113.7"), "the proxy is not trusted")
+
+	// behind the reverse proxy at 10.0.0.2, it appends the address of its client
+	s.config.TrustForwarded = true
+	assert.Equal(t, http.StatusOK, push("10.0.0.2:4321", "203.0.113.7"))
+	assert.Equal(t, http.StatusForbidden, push("10.0.0.2:4321", "203.0.113.7, 198.51.100.1"), "spoofed by the client")
+	assert.Equal(t, http.StatusForbidden, push("10.0.0.2:4321", "203.0.113.7", "198.51.100.1"), "spoofed in another header")
+	assert.Equal(t, http.StatusOK, push("10.0.0.2:4321", "198.51.100.1, 203.0.113.7"))
+	assert.Equal(t, http.StatusForbidden, push("10.0.0.2:4321", "not an address"))
+}
@@ -3,10 +3,104 @@ package main
 import (
 	"fmt"
 	"math"
+	"time"
 )
 
 type KegWeights map[int]float64
 
+// KegInfo describes a tapped keg during its life on the scale
+type KegInfo struct {
+	Id         string    `json:"id"`
+	Beer       string    `json:"beer"`
+	Size       int       `json:"size"` // liters
+	TappedAt   time.Time `json:"tapped_at"`
+	FinishedAt time.Time `json:"finished_at"` // zero while the keg is on tap
+	LowAt      time.Time `json:"low_at"`      // zero until the keg runs low
+
+	StartWeight float64 `json:"start_weight"` // grams, weight when the keg was tapped
+	EndWeight   float64 `json:"end_weight"`   // grams, last weight before the keg was replaced
+
+	Pours       int     `json:"pours"`        // number of detected pours
+	PouredGrams float64 `json:"poured_grams"` // sum of detected pours
+	Beers       float64 `json:"beers"`        // sum of detected pours in glasses of the beer at the time of the pour
+	LineGrams   float64 `json:"line_grams"`   // beer filling the line on the first pour, it's not served
+
+	Model       string  `json:"model,omitempty"`        // id of the keg model from the lookup table
+	EmptyWeight float64 `json:"empty_weight,omitempty"` // grams, measured weight of the model, zero uses the default of the size
+
+	Untapped    *UntappedKeg `json:"untapped,omitempty"`     // set while the partially full keg is put aside to be tapped again
+	PausedHours float64      `json:"paused_hours,omitempty"` // time the keg was untapped, it does not count as time on tap
+}
+
+// OnTap returns time the keg was on tap until the given time, the time it was untapped is excluded
+func (k KegInfo) OnTap(until time.Time) time.Duration {
+	return until.Sub(k.TappedAt) - time.Duration(k.PausedHours*float64(time.Hour))
+}
+
+// NewKegInfo creates info about a keg tapped at the given time
+// id is derived from the tapping time, so it's readable and unique for a single scale
+func NewKegInfo(size int, beer string, tappedAt time.Time, weight float64) KegInfo {
+	return KegInfo{
+		Id:          tappedAt.In(getTz()).Format("20060102-150405"),
+		Beer:        beer,
+		Size:        size,
+		TappedAt:    tappedAt,
+		StartWeight: weight,
+	}
+}
+
+// KegYield describes how much beer we got from the keg
+type KegYield struct {
+	Keg              KegInfo `json:"keg"`
+	TheoreticalBeers float64 `json:"theoretical_beers"` // keg size in glasses
+	ObtainedBeers    float64 `json:"obtained_beers"`    // detected pours in glasses
+	Yield            float64 `json:"yield"`             // obtained / theoretical in percent
+	ConsumedGrams    float64 `json:"consumed_grams"`    // weight lost while on tap
+	LineGrams        float64 `json:"line_grams"`        // beer filling the line after the keg was tapped
+	WasteGrams       float64 `json:"waste_grams"`       // weight lost outside of detected pours and line filling (foam, spills)
+	DurationHours    float64 `json:"duration_hours"`    // time on tap
+}
+
+// CalcKegYield computes yield statistics of the keg
+// active keg (without FinishedAt) is evaluated against current weight and time,
+// untapped keg against its weight and time when it was untapped
+func CalcKegYield(keg KegInfo, glass float64, currentWeight float64, now time.Time) KegYield {
+	startWeight := keg.StartWeight
+	if startWeight == 0 {
+		startWeight = GetFullWeights()[keg.Size]
+	}
+
+	endWeight := keg.EndWeight
+	finishedAt := keg.FinishedAt
+	if keg.Untapped != nil {
+		endWeight = keg.Untapped.Weight
+		finishedAt = keg.Untapped.At
+	} else if finishedAt.IsZero() {
+		endWeight = currentWeight
+		finishedAt = now
+	}
+
+	theoretical := float64(keg.Size) * 1000 / glass
+	obtained := keg.PouredGrams / glass
+	consumed := math.Max(startWeight-endWeight, 0)
+
+	yield := 0.0
+	if theoretical > 0 {
+		yield = math.Round(obtained/theoretical*1000) / 10
+	}
+
+	return KegYield{
+		Keg:              keg,
+		TheoreticalBeers: math.Round(theoretical*10) / 10,
+		ObtainedBeers:    math.Round(obtained*10) / 10,
+		Yield:            yield,
+		ConsumedGrams:    consumed,
+		LineGrams:        keg.LineGrams,
+		WasteGrams:       math.Max(consumed-keg.PouredGrams-keg.LineGrams, 0),
+		DurationHours:    math.Round(keg.OnTap(finishedAt).Hours()*10) / 10,
+	}
+}
+
 // GetEmptyWeights returns a map of keg sizes and their empty weights in grams
 func GetEmptyWeights() KegWeights {
 	return KegWeights{
@@ -29,18 +123,19 @@ func GetFullWeights() KegWeights {
 	return w
 }
 
-// CalcBeersLeft calculates the number of beers left in a keg based on its size and current weight
-func CalcBeersLeft(keg int, weight float64) int {
-	kegWeight, found := GetEmptyWeights()[keg]
-	if !found {
-		kegWeight = 0
-	}
+// CalcBeersLeft calculates the number of beers left in a keg based on its size, current weight
+// and grams of beer in a served glass
+func CalcBeersLeft(keg int, weight float64, glass float64) int {
+	return CalcBeersLeftFromTare(GetEmptyWeights()[keg], weight, glass)
+}
 
+// CalcBeersLeftFromTare calculates the number of beers left in a keg of the given empty weight
+func CalcBeersLeftFromTare(kegWeight float64, weight float64, glass float64) int {
 	if kegWeight/1000 > weight/1000 {
 		return 0
 	}
 
-	return int(math.Floor((weight/1000 - kegWeight/1000) * 2))
+	return int(math.Floor((weight - kegWeight) / glass))
 }
 
 func IsKegLow(keg int, weight float64) bool {
@@ -53,17 +148,39 @@ func IsKegLow(keg int, weight float64) bool {
 		return true // unknown keg - islow for a new one
 	}
 
+	return IsKegLowFromTare(kegWeight, weight)
+}
+
+// IsKegLowFromTare checks the weight is close to the empty keg of the given weight
+func IsKegLowFromTare(kegWeight float64, weight float64) bool {
 	return math.Abs(weight-kegWeight) < 2500 // we are 2500 grams close to the empty keg
 }
 
-func GuessNewKegSize(weight float64) (int, error) {
-	kegs := GetFullWeights()
-	delta := 2000.0
-	for keg, fullWeight := range kegs {
-		if math.Abs(weight-fullWeight) < delta {
-			return keg, nil
+// GuessNewKegSize returns the keg size with the closest full weight within tolerance (grams)
+func GuessNewKegSize(weight float64, tolerance float64) (int, error) {
+	best, bestDiff := 0, tolerance
+	for keg, fullWeight := range GetFullWeights() {
+		if diff := math.Abs(weight - fullWeight); diff < bestDiff {
+			best, bestDiff = keg, diff
 		}
 	}
 
-	return 0, fmt.Errorf("could not guess keg size based on weight: %f", weight)
+	if best == 0 {
+		return 0, fmt.Errorf("could not guess keg size based on weight: %f", weight)
+	}
+
+	return best, nil
+}
+
+// PendingKeg is a detected keg change waiting for confirmation
+// automatically tapped keg can be corrected until the deadline, then it's final
+// keg which could not be recognized waits until somebody sets it
+type PendingKeg struct {
+	Weight     float64   `json:"weight"`
+	DetectedAt time.Time `json:"detected_at"`
+	Guess      int       `json:"guess"`    // best matching keg size, 0 if none is within tolerance
+	Tapped     int       `json:"tapped"`   // keg size tapped automatically, 0 if nothing was tapped
+	Deadline   time.Time `json:"deadline"` // automatically tapped keg is finalized after this time
+
+	fromWarehouse bool // tapped keg was taken from the warehouse
 }
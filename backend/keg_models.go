@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var kegModelIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// KegModel is a catalog entry of a keg of a brewery with its measured empty weight
+// kegs of the same size differ by several hundred grams, which is a beer or two
+type KegModel struct {
+	Id          string  `json:"id"`   // slug, e.g. plzen-50-steel
+	Name        string  `json:"name"` // human readable description
+	Size        int     `json:"size"` // liters
+	EmptyWeight float64 `json:"empty_weight"`
+	Brewery     string  `json:"brewery"`
+	Beer        string  `json:"beer"` // default beer when the keg is tapped
+}
+
+// Validate checks the model is usable for remaining volume computation
+func (m KegModel) Validate() error {
+	if !kegModelIdPattern.MatchString(m.Id) {
+		return fmt.Errorf("id must be lowercase letters, digits and dashes (at most 50)")
+	}
+	if _, err := GetWarehouseIndex(m.Size); err != nil {
+		return fmt.Errorf("unsupported keg size %d", m.Size)
+	}
+	if m.EmptyWeight < 1000 || m.EmptyWeight > 20000 {
+		return fmt.Errorf("empty weight must be between 1000 and 20000 grams")
+	}
+	if len(m.Name) > 100 || len(m.Brewery) > 100 || len(m.Beer) > 100 {
+		return fmt.Errorf("name, brewery and beer must have at most 100 characters")
+	}
+
+	return nil
+}
+
+// sortKegModels orders models by id
+func sortKegModels(models []KegModel) {
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Id < models[j].Id
+	})
+}
+
+// findKegModel returns the model with the id
+func findKegModel(models []KegModel, id string) (KegModel, error) {
+	for _, m := range models {
+		if m.Id == id {
+			return m, nil
+		}
+	}
+
+	return KegModel{}, fmt.Errorf("keg model %s not found", id)
+}
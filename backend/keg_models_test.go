@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKegModel_Validate(t *testing.T) {
+	assert.Nil(t, KegModel{Id: "plzen-50-steel", Size: 50, EmptyWeight: 12850}.Validate())
+	assert.NotNil(t, KegModel{Id: "Plzen 50", Size: 50, EmptyWeight: 12850}.Validate())
+	assert.NotNil(t, KegModel{Id: "plzen-40", Size: 40, EmptyWeight: 12850}.Validate())
+	assert.NotNil(t, KegModel{Id: "plzen-50", Size: 50, EmptyWeight: 128.5}.Validate())
+}
+
+func TestScale_SetKegModel(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	assert.Nil(t, s.AddMeasurement(9000, SourceHttp))
+	assert.Equal(t, CalcBeersLeft(15, 9000, 500), s.BeersLeft)
+
+	assert.Nil(t, s.store.SaveKegModel(KegModel{Id: "heavy-15", Size: 15, EmptyWeight: 8000}))
+	assert.Nil(t, s.store.SaveKegModel(KegModel{Id: "steel-50", Size: 50, EmptyWeight: 12000}))
+	models, err := s.store.GetKegModels()
+	assert.Nil(t, err)
+	assert.Equal(t, "heavy-15", models[0].Id)
+
+	assert.NotNil(t, s.SetKegModel("steel-50")) // size mismatch
+	assert.NotNil(t, s.SetKegModel("unknown"))
+
+	assert.Nil(t, s.SetKegModel("heavy-15"))
+	assert.Equal(t, "heavy-15", s.KegInfo.Model)
+	assert.Equal(t, CalcBeersLeftFromTare(8000, 9000, 500), s.BeersLeft)
+	assert.Less(t, s.BeersLeft, CalcBeersLeft(15, 9000, 500))
+
+	// measured tare is kept for further measurements
+	assert.Nil(t, s.AddMeasurement(8900, SourceHttp))
+	assert.Equal(t, CalcBeersLeftFromTare(8000, 8900, 500), s.BeersLeft)
+
+	assert.Nil(t, s.SetKegModel(""))
+	assert.Equal(t, CalcBeersLeft(15, 8900, 500), s.BeersLeft)
+
+	assert.Nil(t, s.store.DeleteKegModel("heavy-15"))
+	assert.NotNil(t, s.store.DeleteKegModel("heavy-15"))
+}
+
+func TestScale_TapKegModel(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	assert.Nil(t, s.store.SaveKegModel(KegModel{Id: "bernard-30", Size: 30, EmptyWeight: 9000, Brewery: "Bernard", Beer: "Bernard 11"}))
+
+	assert.NotNil(t, s.TapKegModel("unknown", ""))
+
+	assert.Nil(t, s.AddMeasurement(40000, SourceHttp))
+	assert.Nil(t, s.TapKegModel("bernard-30", ""))
+	assert.Equal(t, 30, s.ActiveKeg)
+	assert.Equal(t, "Bernard 11", s.KegInfo.Beer)
+	assert.Equal(t, "bernard-30", s.KegInfo.Model)
+	assert.Equal(t, CalcBeersLeftFromTare(9000, 40000, 500), s.BeersLeft)
+
+	assert.Nil(t, s.TapKegModel("bernard-30", "Bernard 12"))
+	assert.Equal(t, "Bernard 12", s.KegInfo.Beer)
+
+	// tapping by size only forgets the catalog entry
+	assert.Nil(t, s.SetActiveKeg(30, "Bernard 11"))
+	assert.Empty(t, s.KegInfo.Model)
+}
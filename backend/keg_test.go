@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestCalcBeersLeft(t *testing.T) {
@@ -27,9 +28,12 @@ func TestCalcBeersLeft(t *testing.T) {
 	}
 
 	for _, tc := range testcases {
-		beers := CalcBeersLeft(tc.keg, tc.weight)
+		beers := CalcBeersLeft(tc.keg, tc.weight, 500)
 		assert.Equal(t, tc.beers, beers, "Expected beers to be %d, got %d", tc.beers, beers)
 	}
+
+	// beer with more foam is served with less liquid
+	assert.Equal(t, 4, CalcBeersLeft(10, 7500, 350))
 }
 
 func TestIsKegLow(t *testing.T) {
@@ -67,8 +71,45 @@ func TestGuessNewKegSize(t *testing.T) {
 	}
 
 	for _, tc := range testcases {
-		keg, err := GuessNewKegSize(tc.weight)
+		keg, err := GuessNewKegSize(tc.weight, 2000)
 		assert.Nil(t, err)
 		assert.Equal(t, tc.keg, keg, "Expected keg to be %d, got %d", tc.keg, keg)
 	}
+
+	_, err := GuessNewKegSize(16500, 200)
+	assert.NotNil(t, err, "outside of tolerance")
+}
+
+func TestCalcKegYield(t *testing.T) {
+	tapped := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	keg := KegInfo{
+		Id:          "a",
+		Size:        10,
+		TappedAt:    tapped,
+		FinishedAt:  tapped.Add(48 * time.Hour),
+		StartWeight: 16000,
+		EndWeight:   6500,
+		Pours:       18,
+		PouredGrams: 9000,
+	}
+
+	y := CalcKegYield(keg, 500, 0, time.Now())
+	assert.Equal(t, 20.0, y.TheoreticalBeers)
+	assert.Equal(t, 18.0, y.ObtainedBeers)
+	assert.Equal(t, 90.0, y.Yield)
+	assert.Equal(t, 9500.0, y.ConsumedGrams)
+	assert.Equal(t, 500.0, y.WasteGrams)
+	assert.Equal(t, 48.0, y.DurationHours)
+
+	// beer filling the line is not a waste
+	keg.LineGrams = 200
+	y = CalcKegYield(keg, 500, 0, time.Now())
+	assert.Equal(t, 300.0, y.WasteGrams)
+	keg.LineGrams = 0
+
+	// active keg uses current weight
+	keg.FinishedAt = time.Time{}
+	y = CalcKegYield(keg, 500, 10000, tapped.Add(time.Hour))
+	assert.Equal(t, 6000.0, y.ConsumedGrams)
+	assert.Equal(t, 1.0, y.DurationHours)
 }
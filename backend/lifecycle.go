@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// states of the keg in its lifecycle
+const (
+	KegOnTap    = "on_tap"
+	KegUntapped = "untapped" // put aside partially full, see [Scale.UntapKeg]
+	KegFinished = "finished"
+)
+
+var errUnknownKegState = errors.New("unknown keg state")
+
+// KegLifecycle is the record of a single keg from tapping to finishing
+// the keg itself is stored by [Storage.SaveKeg] on every change, the active one is referenced by [KegInfo.Id]
+type KegLifecycle struct {
+	KegInfo
+	State      string  `json:"state"`
+	Liters     float64 `json:"liters"`       // poured from the keg so far
+	HoursOnTap float64 `json:"hours_on_tap"` // until finished or now, untapped time is excluded
+}
+
+// kegState returns the state of the stored keg, activeId is the keg on tap
+func kegState(keg KegInfo, activeId string) string {
+	switch {
+	case keg.Id == activeId:
+		return KegOnTap
+	case keg.Untapped != nil && keg.FinishedAt.IsZero():
+		return KegUntapped
+	}
+
+	// kegs replaced before finishing was recorded have no finishing time
+	return KegFinished
+}
+
+// NewKegLifecycle describes the keg at the given time
+func NewKegLifecycle(keg KegInfo, state string, now time.Time) KegLifecycle {
+	until := now
+	switch {
+	case !keg.FinishedAt.IsZero():
+		until = keg.FinishedAt
+	case keg.Untapped != nil:
+		until = keg.Untapped.At
+	}
+
+	return KegLifecycle{
+		KegInfo:    keg,
+		State:      state,
+		Liters:     math.Round(keg.PouredGrams/100) / 10,
+		HoursOnTap: math.Round(math.Max(keg.OnTap(until).Hours(), 0)*10) / 10,
+	}
+}
+
+// KegLifecycles returns lifecycle records of all kegs newest first, only the given state if it's not empty
+// the active keg is taken from memory, its stored record may lag behind the last pour
+func (s *Scale) KegLifecycles(state string, now time.Time) ([]KegLifecycle, error) {
+	if state != "" && state != KegOnTap && state != KegUntapped && state != KegFinished {
+		return nil, fmt.Errorf("%w %q", errUnknownKegState, state)
+	}
+
+	kegs, err := s.store.GetKegs()
+	if err != nil {
+		return nil, fmt.Errorf("could not load kegs: %w", err)
+	}
+
+	s.mux.Lock()
+	active := s.KegInfo
+	s.mux.Unlock()
+
+	lifecycles := []KegLifecycle{}
+	for i := len(kegs) - 1; i >= 0; i-- {
+		keg := kegs[i]
+		if active.Id != "" && keg.Id == active.Id {
+			keg = active
+		}
+
+		current := kegState(keg, active.Id)
+		if state != "" && current != state {
+			continue
+		}
+		lifecycles = append(lifecycles, NewKegLifecycle(keg, current, now))
+	}
+
+	return lifecycles, nil
+}
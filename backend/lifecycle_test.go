@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScale_KegLifecycles(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	now := time.Now()
+
+	finished := NewKegInfo(50, "Lager", now.Add(-72*time.Hour), 62000)
+	finished.FinishedAt = now.Add(-48 * time.Hour)
+	untapped := NewKegInfo(15, "Pilsner", now.Add(-24*time.Hour), 21000)
+	untapped.PouredGrams = 1500
+	untapped.Untapped = &UntappedKeg{At: now.Add(-23 * time.Hour)}
+	assert.Nil(t, s.store.SaveKeg(finished))
+	assert.Nil(t, s.store.SaveKeg(untapped))
+
+	assert.Nil(t, s.SetActiveKeg(30, "Ale"))
+	s.finishPour(PourProgress{Grams: 500, StartedAt: now})
+
+	kegs, err := s.KegLifecycles("", now.Add(2*time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, kegs, 3)
+	assert.Equal(t, s.KegInfo.Id, kegs[0].Id, "newest first")
+	assert.Equal(t, KegOnTap, kegs[0].State)
+	assert.Equal(t, "Ale", kegs[0].Beer)
+	assert.Equal(t, 0.5, kegs[0].Liters)
+	assert.Equal(t, KegUntapped, kegs[1].State)
+	assert.Equal(t, 1.5, kegs[1].Liters)
+	assert.Equal(t, 1.0, kegs[1].HoursOnTap, "until untapped")
+	assert.Equal(t, KegFinished, kegs[2].State)
+	assert.Equal(t, 24.0, kegs[2].HoursOnTap, "until finished")
+
+	kegs, err = s.KegLifecycles(KegUntapped, now)
+	assert.Nil(t, err)
+	assert.Len(t, kegs, 1)
+	assert.Equal(t, "Pilsner", kegs[0].Beer)
+
+	_, err = s.KegLifecycles("empty", now)
+	assert.ErrorIs(t, err, errUnknownKegState)
+}
+
+func TestNewKegLifecycle(t *testing.T) {
+	tapped := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	keg := NewKegInfo(30, "Ale", tapped, 60000)
+	keg.PouredGrams = 25000
+	keg.PausedHours = 24
+
+	keg.FinishedAt = tapped.Add(72 * time.Hour)
+	lifecycle := NewKegLifecycle(keg, KegFinished, tapped.Add(1000*time.Hour))
+	assert.Equal(t, 25.0, lifecycle.Liters)
+	assert.Equal(t, 48.0, lifecycle.HoursOnTap, "until finished, untapped time is excluded")
+
+	keg.FinishedAt = time.Time{}
+	lifecycle = NewKegLifecycle(keg, KegOnTap, tapped.Add(30*time.Hour))
+	assert.Equal(t, 6.0, lifecycle.HoursOnTap)
+}
+
+func TestHandlerRepository_KegHistory(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	assert.Nil(t, s.SetActiveKeg(15, "Pilsner"))
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+
+	w := httptest.NewRecorder()
+	hr.kegHistoryHandler()(w, httptest.NewRequest(http.MethodGet, "/api/kegs/history", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var kegs []map[string]any
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &kegs))
+	assert.Len(t, kegs, 1)
+	assert.Equal(t, "on_tap", kegs[0]["state"])
+	assert.Equal(t, "Pilsner", kegs[0]["beer"])
+
+	w = httptest.NewRecorder()
+	hr.kegHistoryHandler()(w, httptest.NewRequest(http.MethodGet, "/api/kegs/history?state=finished", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+
+	w = httptest.NewRecorder()
+	hr.kegHistoryHandler()(w, httptest.NewRequest(http.MethodGet, "/api/kegs/history?state=empty", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoadTestOptions describes synthetic traffic of the load test
+type LoadTestOptions struct {
+	Url         string
+	Token       string // sent in the Authorization header, empty sends none
+	Secret      string // signs messages by [SignScaleMessage], empty sends them unsigned
+	Device      string // device id of the scale, empty is the default scale
+	Rate        float64
+	Duration    time.Duration
+	Concurrency int
+}
+
+// LoadTestReport summarizes the load test
+type LoadTestReport struct {
+	Sent     int
+	Failed   int         // transport errors and non-2xx responses
+	Statuses map[int]int // responses by HTTP status, transport errors are not included
+	Elapsed  time.Duration
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// ErrorRate returns the share of failed requests
+func (r LoadTestReport) ErrorRate() float64 {
+	if r.Sent == 0 {
+		return 0
+	}
+
+	return float64(r.Failed) / float64(r.Sent)
+}
+
+// Print writes a human-readable summary of the report
+func (r LoadTestReport) Print(out io.Writer) {
+	rate := 0.0
+	if r.Elapsed > 0 {
+		rate = float64(r.Sent) / r.Elapsed.Seconds()
+	}
+
+	statuses := make([]int, 0, len(r.Statuses))
+	for status := range r.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	counts := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		counts = append(counts, fmt.Sprintf("%d: %d", status, r.Statuses[status]))
+	}
+
+	_, _ = fmt.Fprintf(out, "requests:  %d in %s (%.1f/s)\n", r.Sent, r.Elapsed.Round(time.Millisecond), rate)
+	_, _ = fmt.Fprintf(out, "errors:    %d (%.2f %%)\n", r.Failed, 100*r.ErrorRate())
+	_, _ = fmt.Fprintf(out, "statuses:  %s\n", strings.Join(counts, ", "))
+	_, _ = fmt.Fprintf(out, "latency:   p50 %s, p90 %s, p99 %s, max %s\n", r.P50, r.P90, r.P99, r.Max)
+}
+
+// LoadTest sends synthetic scale messages to the push endpoint at the given rate until the duration elapses
+// the weight stays around 20 kg, so the target does not detect pours or keg changes
+// requests are not queued when all workers are busy, the achieved rate is lower then
+func LoadTest(ctx context.Context, opts LoadTestOptions) LoadTestReport {
+	ctx, cancel := context.WithTimeout(ctx, opts.Duration)
+	defer cancel()
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	jobs := make(chan int)
+
+	mux := sync.Mutex{}
+	report := LoadTestReport{Statuses: map[int]int{}}
+	latencies := []time.Duration{}
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				start := time.Now()
+				status, err := sendLoadTestMessage(client, opts, start, i)
+				d := time.Since(start)
+
+				mux.Lock()
+				report.Sent++
+				latencies = append(latencies, d)
+				if err != nil {
+					report.Failed++
+				} else {
+					report.Statuses[status]++
+					if status < 200 || status > 299 {
+						report.Failed++
+					}
+				}
+				mux.Unlock()
+			}
+		}()
+	}
+
+	started := time.Now()
+	tick := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+	defer tick.Stop()
+loop:
+	for i := 0; ; i++ {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-tick.C:
+		}
+
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	report.Elapsed = time.Since(started)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.P50 = percentile(latencies, 0.5)
+	report.P90 = percentile(latencies, 0.9)
+	report.P99 = percentile(latencies, 0.99)
+	report.Max = percentile(latencies, 1)
+
+	return report
+}
+
+// sendLoadTestMessage posts the i-th synthetic message and returns the HTTP status
+func sendLoadTestMessage(client *http.Client, opts LoadTestOptions, at time.Time, i int) (int, error) {
+	// ids are seconds since the start like on the device, weights differ so messages of the same second are not duplicates
+	chunks := []string{"push"}
+	if opts.Device != "" {
+		chunks = append(chunks, opts.Device)
+	}
+	chunks = append(chunks, strconv.Itoa(1+int(at.Sub(loadTestBoot).Seconds())), "-60", fmt.Sprintf("%.1f", 20000+float64(i%50)))
+	body := strings.Join(chunks, "|")
+
+	req, err := http.NewRequest(http.MethodPost, opts.Url, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if opts.Token != "" {
+		req.Header.Set("Authorization", opts.Token)
+	}
+	if opts.Secret != "" {
+		req.Header.Set(ScaleTimestampHeader, strconv.FormatInt(at.Unix(), 10))
+		req.Header.Set(ScaleSignatureHeader, SignScaleMessage(opts.Secret, at, body))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	return res.StatusCode, nil
+}
+
+// loadTestBoot is the "boot" of the synthetic device, message ids are counted from it
+var loadTestBoot = time.Now()
+
+// percentile returns the nearest-rank percentile of sorted durations, zero for no durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// runLoadTestCommand implements `keg-scale loadtest [flags]`
+func runLoadTestCommand(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	opts := LoadTestOptions{}
+	fs.StringVar(&opts.Url, "url", "http://localhost:8080/api/scale/push", "push endpoint of the target instance")
+	fs.StringVar(&opts.Token, "token", os.Getenv("AUTH_TOKEN"), "auth token of the target instance")
+	fs.StringVar(&opts.Secret, "secret", "", "signing secret of the scale (SCALE_SECRETS), messages are unsigned without it")
+	fs.StringVar(&opts.Device, "device", "", "device id of the scale (SCALE_DEVICES), empty is the default scale")
+	fs.Float64Var(&opts.Rate, "rate", 10, "messages per second")
+	fs.DurationVar(&opts.Duration, "duration", 30*time.Second, "duration of the test")
+	fs.IntVar(&opts.Concurrency, "concurrency", 4, "number of requests in flight")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if opts.Rate <= 0 || opts.Duration <= 0 || opts.Concurrency < 1 {
+		return fmt.Errorf("rate, duration and concurrency have to be positive")
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Sending %.1f messages/s to %s for %s, use a test instance, the data is stored\n", opts.Rate, opts.Url, opts.Duration)
+	report := LoadTest(context.Background(), opts)
+	report.Print(os.Stdout)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTest(t *testing.T) {
+	mux := sync.Mutex{}
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Nil(t, VerifyScaleSignature(r, string(body), "tap2", map[string]string{"tap2": "0123456789abcdef"}, time.Minute, time.Now()))
+
+		mux.Lock()
+		defer mux.Unlock()
+		bodies = append(bodies, string(body))
+		if len(bodies)%2 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	report := LoadTest(context.Background(), LoadTestOptions{
+		Url:         server.URL,
+		Secret:      "0123456789abcdef",
+		Device:      "tap2",
+		Rate:        100,
+		Duration:    300 * time.Millisecond,
+		Concurrency: 2,
+	})
+
+	assert.Greater(t, report.Sent, 5)
+	assert.Equal(t, len(bodies), report.Sent)
+	assert.Equal(t, report.Sent/2, report.Failed)
+	assert.Equal(t, report.Sent, report.Statuses[http.StatusOK]+report.Statuses[http.StatusServiceUnavailable])
+	assert.LessOrEqual(t, report.P50, report.P99)
+	assert.True(t, strings.HasPrefix(bodies[0], "push|tap2|"))
+
+	message, err := ParseScaleMessage(bodies[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "tap2", message.Device)
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	assert.Equal(t, time.Duration(5), percentile(sorted, 0.5))
+	assert.Equal(t, time.Duration(10), percentile(sorted, 0.99))
+	assert.Equal(t, time.Duration(1), percentile(sorted, 0))
+	assert.Equal(t, time.Duration(0), percentile(nil, 0.5))
+}
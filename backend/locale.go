@@ -0,0 +1,143 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hako/durafmt"
+)
+
+// decimalSeparators maps supported languages to their decimal separator
+var decimalSeparators = map[string]string{
+	"cs": ",",
+	"sk": ",",
+	"de": ",",
+	"pl": ",",
+	"fr": ",",
+	"es": ",",
+	"it": ",",
+	"hu": ",",
+	"en": ".",
+}
+
+// localizationUnits are abbreviated durafmt units (year, week, day, hour, minute, second, millisecond, microsecond)
+// languages without their own units use the english ones
+var localizationUnits = map[string]string{
+	"cs": "r:r,t:t,d:d,h:h,m:m,s:s,ms:ms,microsecond",
+	"sk": "r:r,t:t,d:d,h:h,m:m,s:s,ms:ms,microsecond",
+	"de": "J:J,W:W,T:T,h:h,m:m,s:s,ms:ms,microsecond",
+	"en": "y:y,w:w,d:d,h:h,m:m,s:s,ms:ms,microsecond",
+}
+
+// weightUnit converts grams measured by the scale to a displayed unit
+type weightUnit struct {
+	grams    float64 // grams in one unit
+	decimals int
+}
+
+// weightUnits are the supported units of displayed weights
+// liters are the liters of beer, its density is close enough to water for the bar
+var weightUnits = map[string]weightUnit{
+	"kg": {grams: 1000, decimals: 2},
+	"l":  {grams: 1000, decimals: 2},
+	"g":  {grams: 1, decimals: 0},
+}
+
+// display holds the formats of human-facing output shared by the dashboard, notifications and exports
+// it's set from the configuration by [setDisplay] at startup, tests use the defaults
+var display = struct {
+	location   *time.Location
+	dateFormat string
+	weightUnit string
+	locale     string
+}{
+	location:   loadLocation("Europe/Prague"),
+	dateFormat: time.DateTime,
+	weightUnit: "kg",
+	locale:     "cs",
+}
+
+// loadLocation returns the time zone, UTC if it is unknown (e.g. missing tzdata)
+func loadLocation(name string) *time.Location {
+	tz, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+
+	return tz
+}
+
+// setDisplay applies the display options of the validated configuration
+func setDisplay(config *Config) {
+	display.location = loadLocation(config.Timezone)
+	display.dateFormat = config.DateFormat
+	display.weightUnit = config.WeightUnit
+	display.locale = config.Locale
+}
+
+// resolveLocale picks the preferred supported language from the Accept-Language header
+// e.g. "cs-CZ,cs;q=0.9,en;q=0.8" => cs
+// falls back to def when the header is missing or contains no supported language
+func resolveLocale(acceptLanguage string, def string) string {
+	type lang struct {
+		tag string
+		q   float64
+	}
+
+	langs := []lang{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if tag == "" {
+			continue
+		}
+
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		langs = append(langs, lang{tag: tag, q: q})
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+
+	for _, l := range langs {
+		if _, found := decimalSeparators[l.tag]; found && l.q > 0 {
+			return l.tag
+		}
+	}
+
+	return def
+}
+
+// formatDecimal formats number with fixed decimals and locale decimal separator
+func formatDecimal(value float64, decimals int, locale string) string {
+	formatted := strconv.FormatFloat(value, 'f', decimals, 64)
+	if sep, found := decimalSeparators[locale]; found && sep != "." {
+		formatted = strings.Replace(formatted, ".", sep, 1)
+	}
+
+	return formatted
+}
+
+// formatWeight formats grams in the displayed unit and locale, without the unit itself
+func formatWeight(grams float64, locale string) string {
+	unit := weightUnits[display.weightUnit]
+	return formatDecimal(grams/unit.grams, unit.decimals, locale)
+}
+
+// durationUnits returns the abbreviated units of formatted durations in the locale
+func durationUnits(locale string) (durafmt.Units, error) {
+	units, found := localizationUnits[locale]
+	if !found {
+		units = localizationUnits["en"]
+	}
+
+	return durafmt.DefaultUnitsCoder.Decode(units)
+}
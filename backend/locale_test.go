@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hako/durafmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveLocale(t *testing.T) {
+	cases := []struct {
+		header   string
+		expected string
+	}{
+		{"", "cs"},
+		{"en-US,en;q=0.9", "en"},
+		{"cs-CZ,cs;q=0.9,en;q=0.8", "cs"},
+		{"ja,en;q=0.5", "en"},
+		{"en;q=0.3,de;q=0.7", "de"},
+		{"ja", "cs"},
+		{"en;q=0", "cs"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, resolveLocale(c.header, "cs"), c.header)
+	}
+}
+
+func TestFormatDecimal(t *testing.T) {
+	assert.Equal(t, "12,35", formatDecimal(12.345, 2, "cs"))
+	assert.Equal(t, "12.35", formatDecimal(12.345, 2, "en"))
+	assert.Equal(t, "-0.50", formatDecimal(-0.5, 2, "unknown"))
+	assert.Equal(t, "3", formatDecimal(3.2, 0, "cs"))
+}
+
+func TestFormatWeight(t *testing.T) {
+	assert.Equal(t, "12,35", formatWeight(12345, "cs"))
+
+	saved := display
+	defer func() { display = saved }()
+	display.weightUnit = "g"
+	assert.Equal(t, "12345", formatWeight(12345.4, "en"))
+	display.weightUnit = "l"
+	assert.Equal(t, "0.50", formatWeight(500, "en"))
+}
+
+func TestDurationUnits(t *testing.T) {
+	cs, err := durationUnits("cs")
+	assert.Nil(t, err)
+	assert.Equal(t, "1 h 30 m", durafmt.Parse(90*time.Minute).Format(cs))
+
+	en, err := durationUnits("fr")
+	assert.Nil(t, err)
+	assert.Equal(t, "2 w 1 d", durafmt.Parse(15*24*time.Hour).Format(en), "english units are the fallback")
+}
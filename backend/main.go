@@ -2,39 +2,141 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 	"os"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		commands := map[string]func([]string) error{
+			"replay":        runReplayCommand,
+			"loadtest":      runLoadTestCommand,
+			"registry":      runRegistryCommand,
+			"migrate-store": runMigrateStoreCommand,
+			"restore":       runRestoreCommand,
+		}
+		if command, found := commands[os.Args[1]]; found {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	profile := flag.String("profile", os.Getenv("PROFILE"), "configuration profile (dev, staging, pub)")
+	flag.Parse()
+
 	// for development purposes
 	// we don't care about errors here
 	_ = godotenv.Load(".env")
+	if err := UseProfile(*profile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 	config := NewConfig()
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+	setDisplay(config)
 
 	c := context.Background()
 	ctx, cancel := context.WithCancel(c)
 
-	logger := createLogger()
+	logger := createLogger(config)
 	monitor := NewMonitor()
+	monitor.GuardCardinality(config.MetricMaxSeries, logger)
+	if len(config.Pubs) > 0 {
+		// all series carry the pub label when more pubs are hosted, single pub deployments keep them unlabeled
+		monitor = monitor.ForPub(config.DefaultPub)
+	}
+
+	supervisor := NewSupervisor(monitor, logger)
+	tenant, err := StartTenant(ctx, config, monitor, supervisor, logger)
+	if err != nil {
+		logger.Errorf("Could not start the pub: %v", err)
+		os.Exit(1)
+	}
+	hr := tenant.hr
+
+	// more pubs share the process, each has its own configuration, storage, scales and metrics labeled by the pub
+	// their configurations are already validated with the default one
+	pubs := NewTenantRegistry()
+	for _, name := range config.Pubs {
+		hosted, err := StartTenant(ctx, config.PubConfigs[name], monitor.ForPub(name), supervisor, logger)
+		if err != nil {
+			logger.Errorf("Could not start the pub %s: %v", name, err)
+			os.Exit(1)
+		}
+		pubs.Add(hosted)
+		logger.Infof("Pub %s is served under /api/%s/", name, name)
+	}
+	if len(config.Pubs) > 0 {
+		hr.pubs = pubs
+	}
+
+	metricsPusher := NewMetricsPusher(config, hr.gatherer(), monitor, logger)
+	if metricsPusher.Enabled() {
+		supervisor.Go(ctx, "metrics_push", max(5*time.Minute, 2*config.MetricsPushInterval), metricsPusher.Run)
+	}
+	go supervisor.Run(ctx)
 
-	store := NewRedisStore(config)
+	// the device transports listen on their own ports, they feed the default pub only
+	if config.GrpcPort > 0 {
+		go func() {
+			if err := StartGrpcServer(ctx, NewGrpcIngest(hr, logger), config, logger); err != nil {
+				logger.Errorf("gRPC server failed: %v", err)
+			}
+		}()
+	}
 
-	scale := NewScale(monitor, store, logger, ctx)
-	StartServer(NewRouter(&HandlerRepository{
-		scale:   scale,
-		config:  config,
-		monitor: monitor,
-		logger:  logger,
-	}), 8080, cancel)
+	if config.IngestTlsPort > 0 {
+		go func() {
+			if err := StartIngestServer(ctx, NewIngestRouter(hr), config, logger); err != nil {
+				logger.Errorf("Ingest server failed: %v", err)
+			}
+		}()
+	}
+
+	router := NewRouter(hr)
+	if err := pubs.CheckRoutes(router); err != nil {
+		logger.Errorf("Invalid PUBS: %v", err)
+		os.Exit(1)
+	}
+	StartServer(pubs.Handler(router), 8080, cancel)
+
+	// workers are stopped by the cancelled context, wait for them before the final flush
+	// so nothing writes to the storage behind our back
+	if err := supervisor.Wait(shutdownTimeout); err != nil {
+		logger.Warnf("Shutdown: %v", err)
+	}
+	tenant.Flush()
+	for _, name := range pubs.Names() {
+		hosted, _ := pubs.Get(name)
+		hosted.Flush()
+	}
+	logger.Info("Shutdown complete")
 }
 
-func createLogger() *logrus.Logger {
+// shutdownTimeout is how long background workers are given to stop
+const shutdownTimeout = 10 * time.Second
+
+func createLogger(config *Config) *logrus.Logger {
 	logger := logrus.New()
 	logger.SetOutput(os.Stdout)
 	logger.SetFormatter(&logrus.JSONFormatter{})
-	logger.SetLevel(logrus.InfoLevel)
+	if config.LogFormat == "text" {
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	}
+
+	// level is already validated
+	level, _ := logrus.ParseLevel(config.LogLevel)
+	logger.SetLevel(level)
 
 	return logger
 }
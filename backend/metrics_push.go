@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// modes of [Config.MetricsPushMode]
+const (
+	MetricsPushRemoteWrite = "remote_write" // Prometheus remote write 1.0, accepted by Prometheus, VictoriaMetrics and Mimir
+	MetricsPushGateway     = "pushgateway"  // Prometheus Pushgateway, the group is replaced on every push
+)
+
+// MetricsPusher pushes metrics of all scales to the central monitoring
+// for pubs behind NAT, where the /metrics endpoint can't be scraped
+type MetricsPusher struct {
+	config   *Config
+	gatherer prometheus.Gatherer
+	monitor  *Monitor
+	logger   *logrus.Logger
+	client   *http.Client
+}
+
+func NewMetricsPusher(config *Config, gatherer prometheus.Gatherer, monitor *Monitor, logger *logrus.Logger) *MetricsPusher {
+	return &MetricsPusher{
+		config:   config,
+		gatherer: gatherer,
+		monitor:  monitor,
+		logger:   logger,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled returns true if the push url is configured
+func (mp *MetricsPusher) Enabled() bool {
+	return mp.config.MetricsPushUrl != ""
+}
+
+// Run pushes metrics every [Config.MetricsPushInterval]
+// it's supposed to run as a supervised worker
+func (mp *MetricsPusher) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(mp.config.MetricsPushInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			mp.logger.Debug("Metrics pusher stopped")
+			return
+		case now := <-tick.C:
+			heartbeat()
+			err := mp.monitor.deliveries.Track(mp.channel(), func() error {
+				return mp.Push(ctx, now)
+			})
+			if err != nil {
+				mp.logger.Warnf("Could not push metrics to %s: %v", mp.channel(), err)
+			}
+		}
+	}
+}
+
+// Push sends the current metrics, samples without own timestamp get the given time
+func (mp *MetricsPusher) Push(ctx context.Context, now time.Time) error {
+	if mp.config.MetricsPushMode == MetricsPushGateway {
+		return mp.pushGateway(ctx)
+	}
+
+	return mp.remoteWrite(ctx, now)
+}
+
+// pushGateway replaces the group of the job (and instance) at the Pushgateway
+func (mp *MetricsPusher) pushGateway(ctx context.Context) error {
+	if mp.config.DryRun {
+		mp.logger.Infof("Dry run, not pushing metrics to %s", mp.channel())
+		return nil
+	}
+
+	pusher := push.New(mp.config.MetricsPushUrl, mp.config.MetricsPushJob).Gatherer(mp.gatherer).Client(mp.client)
+	if mp.config.MetricsPushInstance != "" {
+		pusher = pusher.Grouping("instance", mp.config.MetricsPushInstance)
+	}
+	if mp.config.MetricsPushUsername != "" {
+		pusher = pusher.BasicAuth(mp.config.MetricsPushUsername, mp.config.MetricsPushPassword)
+	} else if mp.config.MetricsPushPassword != "" {
+		pusher = pusher.Header(http.Header{"Authorization": {"Bearer " + mp.config.MetricsPushPassword}})
+	}
+
+	return pusher.PushContext(ctx)
+}
+
+// remoteWrite posts all samples as a snappy compressed protobuf WriteRequest
+func (mp *MetricsPusher) remoteWrite(ctx context.Context, now time.Time) error {
+	families, err := mp.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("could not gather metrics: %w", err)
+	}
+
+	extra := [][2]string{{"job", mp.config.MetricsPushJob}}
+	if mp.config.MetricsPushInstance != "" {
+		extra = append(extra, [2]string{"instance", mp.config.MetricsPushInstance})
+	}
+	series := remoteWriteSeries(families, extra, now)
+
+	if mp.config.DryRun {
+		mp.logger.Infof("Dry run, not pushing %d series to %s", len(series), mp.channel())
+		return nil
+	}
+
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mp.config.MetricsPushUrl, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if mp.config.MetricsPushUsername != "" {
+		req.SetBasicAuth(mp.config.MetricsPushUsername, mp.config.MetricsPushPassword)
+	} else if mp.config.MetricsPushPassword != "" {
+		req.Header.Set("Authorization", "Bearer "+mp.config.MetricsPushPassword)
+	}
+
+	res, err := mp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 256))
+		return fmt.Errorf("remote write returned status %d: %s", res.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// channel names the push endpoint in logs and delivery health without the path, it may contain a token
+func (mp *MetricsPusher) channel() string {
+	u, err := url.Parse(mp.config.MetricsPushUrl)
+	if err != nil {
+		return "metrics_push"
+	}
+
+	return "metrics_push:" + u.Host
+}
+
+// remoteSeries is a single sample of remote write, labels are sorted by name
+type remoteSeries struct {
+	labels    [][2]string
+	value     float64
+	timestamp int64 // unix milliseconds
+}
+
+// remoteWriteSeries flattens metric families like the text exposition does,
+// summaries and histograms are split to quantiles or buckets, _sum and _count
+func remoteWriteSeries(families []*dto.MetricFamily, extra [][2]string, now time.Time) []remoteSeries {
+	series := []remoteSeries{}
+	for _, family := range families {
+		name := family.GetName()
+		for _, metric := range family.GetMetric() {
+			timestamp := now.UnixMilli()
+			if metric.TimestampMs != nil {
+				timestamp = metric.GetTimestampMs()
+			}
+			add := func(suffix string, value float64, label ...string) {
+				labels := append([][2]string{{"__name__", name + suffix}}, extra...)
+				for _, pair := range metric.GetLabel() {
+					labels = append(labels, [2]string{pair.GetName(), pair.GetValue()})
+				}
+				if len(label) == 2 {
+					labels = append(labels, [2]string{label[0], label[1]})
+				}
+				slices.SortFunc(labels, func(a, b [2]string) int { return strings.Compare(a[0], b[0]) })
+				series = append(series, remoteSeries{labels: labels, value: value, timestamp: timestamp})
+			}
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				add("", metric.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add("", metric.GetGauge().GetValue())
+			case dto.MetricType_SUMMARY:
+				summary := metric.GetSummary()
+				for _, quantile := range summary.GetQuantile() {
+					add("", quantile.GetValue(), "quantile", strconv.FormatFloat(quantile.GetQuantile(), 'g', -1, 64))
+				}
+				add("_sum", summary.GetSampleSum())
+				add("_count", float64(summary.GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				for _, bucket := range histogram.GetBucket() {
+					if !math.IsInf(bucket.GetUpperBound(), 1) {
+						add("_bucket", float64(bucket.GetCumulativeCount()), "le", strconv.FormatFloat(bucket.GetUpperBound(), 'g', -1, 64))
+					}
+				}
+				add("_bucket", float64(histogram.GetSampleCount()), "le", "+Inf")
+				add("_sum", histogram.GetSampleSum())
+				add("_count", float64(histogram.GetSampleCount()))
+			default:
+				add("", metric.GetUntyped().GetValue())
+			}
+		}
+	}
+
+	return series
+}
+
+// encodeWriteRequest marshals prometheus.WriteRequest of remote write 1.0 without depending on its generated types
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []remoteSeries) []byte {
+	request := []byte{}
+	for _, s := range series {
+		timeSeries := []byte{}
+		for _, label := range s.labels {
+			pair := protowire.AppendTag(nil, 1, protowire.BytesType)
+			pair = protowire.AppendString(pair, label[0])
+			pair = protowire.AppendTag(pair, 2, protowire.BytesType)
+			pair = protowire.AppendString(pair, label[1])
+			timeSeries = protowire.AppendTag(timeSeries, 1, protowire.BytesType)
+			timeSeries = protowire.AppendBytes(timeSeries, pair)
+		}
+
+		sample := protowire.AppendTag(nil, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(s.timestamp))
+		timeSeries = protowire.AppendTag(timeSeries, 2, protowire.BytesType)
+		timeSeries = protowire.AppendBytes(timeSeries, sample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, timeSeries)
+	}
+
+	return request
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest returns samples of the remote write request as "name{label="value",...}" => value@timestamp
+func decodeWriteRequest(t *testing.T, body []byte) map[string]string {
+	fields := func(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			assert.True(t, n > 0)
+			b = b[n:]
+			m := protowire.ConsumeFieldValue(num, typ, b)
+			assert.True(t, m > 0)
+			fn(num, typ, b[:m])
+			b = b[m:]
+		}
+	}
+
+	samples := map[string]string{}
+	fields(body, func(_ protowire.Number, _ protowire.Type, value []byte) {
+		series, _ := protowire.ConsumeBytes(value)
+		labels := []string{}
+		sample := ""
+		fields(series, func(num protowire.Number, _ protowire.Type, value []byte) {
+			message, _ := protowire.ConsumeBytes(value)
+			if num == 1 {
+				pair := [2]string{}
+				fields(message, func(num protowire.Number, _ protowire.Type, value []byte) {
+					pair[num-1], _ = protowire.ConsumeString(value)
+				})
+				labels = append(labels, fmt.Sprintf("%s=%q", pair[0], pair[1]))
+				return
+			}
+			fields(message, func(num protowire.Number, _ protowire.Type, value []byte) {
+				if num == 1 {
+					bits, _ := protowire.ConsumeFixed64(value)
+					sample += fmt.Sprint(math.Float64frombits(bits))
+				} else {
+					timestamp, _ := protowire.ConsumeVarint(value)
+					sample += fmt.Sprintf("@%d", timestamp)
+				}
+			})
+		})
+		samples["{"+strings.Join(labels, ",")+"}"] = sample
+	})
+
+	return samples
+}
+
+func TestMetricsPusher_RemoteWrite(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	weight := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "scale_weight"}, []string{"tap"})
+	weight.WithLabelValues("1").Set(22500)
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "scale_latency_seconds", Buckets: []float64{1, 5}})
+	latency.Observe(3)
+	registry.MustRegister(weight, latency)
+
+	var received map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		decoded, err := snappy.Decode(nil, body)
+		assert.Nil(t, err)
+		received = decodeWriteRequest(t, decoded)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.MetricsPushUrl = srv.URL + "/api/v1/write"
+	config.MetricsPushInstance = "u-kocoura"
+	mp := NewMetricsPusher(config, registry, NewMonitor(), logger)
+	assert.True(t, mp.Enabled())
+	now := time.UnixMilli(1700000000000)
+
+	err := mp.Push(context.Background(), now)
+	assert.ErrorContains(t, err, "remote write returned status 401: Unauthorized")
+
+	config.MetricsPushPassword = "s3cret"
+	assert.Nil(t, mp.Push(context.Background(), now))
+	assert.Equal(t, map[string]string{
+		`{__name__="scale_weight",instance="u-kocoura",job="keg_scale",tap="1"}`:                   "22500@1700000000000",
+		`{__name__="scale_latency_seconds_bucket",instance="u-kocoura",job="keg_scale",le="1"}`:    "0@1700000000000",
+		`{__name__="scale_latency_seconds_bucket",instance="u-kocoura",job="keg_scale",le="5"}`:    "1@1700000000000",
+		`{__name__="scale_latency_seconds_bucket",instance="u-kocoura",job="keg_scale",le="+Inf"}`: "1@1700000000000",
+		`{__name__="scale_latency_seconds_sum",instance="u-kocoura",job="keg_scale"}`:              "3@1700000000000",
+		`{__name__="scale_latency_seconds_count",instance="u-kocoura",job="keg_scale"}`:            "1@1700000000000",
+	}, received)
+}
+
+func TestMetricsPusher_Pushgateway(t *testing.T) {
+	var path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "pub:s3cret", user+":"+password)
+		path = r.URL.Path
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	s := CreateScaleWithMeasurements(22)
+	config := NewConfig()
+	config.MetricsPushUrl = srv.URL
+	config.MetricsPushMode = MetricsPushGateway
+	config.MetricsPushInstance = "u-kocoura"
+	config.MetricsPushUsername = "pub"
+	config.MetricsPushPassword = "s3cret"
+	mp := NewMetricsPusher(config, NewScaleRegistry(s).Gatherer(), s.monitor, logger)
+
+	assert.Nil(t, mp.Push(context.Background(), time.Now()))
+	assert.Equal(t, "/metrics/job/keg_scale/instance/u-kocoura", path)
+	assert.Contains(t, body, "scale_weight")
+
+	config.DryRun = true
+	path = ""
+	assert.Nil(t, mp.Push(context.Background(), time.Now()))
+	assert.Empty(t, path, "dry run does not push")
+}
+
+func TestConfig_MetricsPush(t *testing.T) {
+	t.Setenv("METRICS_PUSH_URL", "victoria:8428")
+	t.Setenv("METRICS_PUSH_MODE", "graphite")
+	t.Setenv("METRICS_PUSH_INTERVAL", "100ms")
+	t.Setenv("METRICS_PUSH_USERNAME", "pub")
+	err := NewConfig().Validate()
+	assert.ErrorContains(t, err, `METRICS_PUSH_URL: "victoria:8428"`)
+	assert.ErrorContains(t, err, `METRICS_PUSH_MODE: "graphite" is not supported`)
+	assert.ErrorContains(t, err, "METRICS_PUSH_INTERVAL")
+	assert.ErrorContains(t, err, "METRICS_PUSH_PASSWORD")
+
+	t.Setenv("METRICS_PUSH_URL", "https://victoria.example.com/api/v1/write")
+	t.Setenv("METRICS_PUSH_MODE", "remote_write")
+	t.Setenv("METRICS_PUSH_INTERVAL", "30s")
+	t.Setenv("METRICS_PUSH_PASSWORD", "s3cret")
+	assert.Nil(t, NewConfig().Validate())
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+// migrateChunk is the time range copied at once, so the whole history is never held in memory
+const migrateChunk = 7 * 24 * time.Hour
+
+// MigrateReport summarizes copied data per kind
+type MigrateReport struct {
+	Counts map[string]int
+}
+
+// openStorage opens the storage of the driver, empty dsn falls back to the configuration
+// for redis the dsn is the address of the server
+func openStorage(config *Config, driver, dsn string) (Storage, error) {
+	switch driver {
+	case "memory":
+		return &FakeStore{}, nil
+	case "sqlite", "postgres":
+		if dsn == "" {
+			dsn = config.StorageDsn
+		}
+		return NewSqlStore(driver, dsn)
+	case "redis":
+		redisConfig := *config
+		if dsn != "" {
+			redisConfig.RedisAddr = dsn
+		}
+		store := NewRedisStore(&redisConfig)
+		if config.StorageKey != "" {
+			cipher, err := NewAesBlobCipher(config.StorageKey)
+			if err != nil {
+				return nil, fmt.Errorf("invalid STORAGE_KEY: %w", err)
+			}
+			store.cipher = cipher
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// MigrateStore copies all data of the default scale from src to dst
+// history in [since, now) is streamed in chunks and counts of every chunk are verified in dst
+// progress is written to out
+func MigrateStore(src, dst Storage, since, now time.Time, force bool, out io.Writer) (MigrateReport, error) {
+	report := MigrateReport{Counts: map[string]int{}}
+
+	if err := src.Ping(); err != nil {
+		return report, fmt.Errorf("source is not reachable: %w", err)
+	}
+	if err := dst.Ping(); err != nil {
+		return report, fmt.Errorf("destination is not reachable: %w", err)
+	}
+
+	if !force {
+		if err := checkEmptyStore(dst, since, now); err != nil {
+			return report, err
+		}
+	}
+
+	if err := migrateState(src, dst, report); err != nil {
+		return report, err
+	}
+	if err := migrateCollections(src, dst, report); err != nil {
+		return report, err
+	}
+
+	total := now.Sub(since)
+	for from := since; from.Before(now); from = from.Add(migrateChunk) {
+		to := from.Add(migrateChunk)
+		if to.After(now) {
+			to = now
+		}
+		if err := migrateRange(src, dst, from, to, report); err != nil {
+			return report, fmt.Errorf("could not migrate %s - %s: %w", from.Format(time.DateOnly), to.Format(time.DateOnly), err)
+		}
+		fmt.Fprintf(out, "%5.1f%% %s: %d measurements, %d pours\n",
+			100*float64(to.Sub(since))/float64(total), from.Format(time.DateOnly), report.Counts["measurements"], report.Counts["pours"])
+	}
+
+	return report, nil
+}
+
+// checkEmptyStore returns an error if the destination already holds kegs or measurements in [since, now)
+func checkEmptyStore(dst Storage, since, now time.Time) error {
+	kegs, err := dst.GetKegs()
+	if err != nil {
+		return fmt.Errorf("could not check destination: %w", err)
+	}
+	measurements, err := dst.CountMeasurements(since, now)
+	if err != nil {
+		return fmt.Errorf("could not check destination: %w", err)
+	}
+	if len(kegs) > 0 || measurements > 0 {
+		return fmt.Errorf("destination is not empty, use -force to merge into it")
+	}
+	return nil
+}
+
+// migrateState copies current values of the scale, missing values are skipped
+func migrateState(src, dst Storage, report MigrateReport) error {
+	copyValue := func(name string, get func() error, set func() error) error {
+		if get() != nil {
+			return nil // not stored in the source
+		}
+		if err := set(); err != nil {
+			return fmt.Errorf("could not migrate %s: %w", name, err)
+		}
+		report.Counts["state"]++
+		return nil
+	}
+
+	var weight float64
+	var weightAt, cleaningUntil time.Time
+	var activeKeg, beersLeft int
+	var kegInfo KegInfo
+	var isLow bool
+	var warehouse [5]int
+	var shadow DeviceShadow
+	var tapBeer TapBeer
+	var snapshot ScaleSnapshot
+	var firmware FirmwareRelease
+	var err error
+
+	steps := []struct {
+		name string
+		get  func() error
+		set  func() error
+	}{
+		{"weight", func() error { weight, err = src.GetWeight(); return err }, func() error { return dst.SetWeight(weight) }},
+		{"weight at", func() error { weightAt, err = src.GetWeightAt(); return err }, func() error { return dst.SetWeightAt(weightAt) }},
+		{"active keg", func() error { activeKeg, err = src.GetActiveKeg(); return err }, func() error { return dst.SetActiveKeg(activeKeg) }},
+		{"keg info", func() error { kegInfo, err = src.GetKegInfo(); return err }, func() error { return dst.SetKegInfo(kegInfo) }},
+		{"beers left", func() error { beersLeft, err = src.GetBeersLeft(); return err }, func() error { return dst.SetBeersLeft(beersLeft) }},
+		{"is low", func() error { isLow, err = src.GetIsLow(); return err }, func() error { return dst.SetIsLow(isLow) }},
+		{"warehouse", func() error { warehouse, err = src.GetWarehouse(); return err }, func() error { return dst.SetWarehouse(warehouse) }},
+		{"cleaning", func() error { cleaningUntil, err = src.GetCleaningUntil(); return err }, func() error { return dst.SetCleaningUntil(cleaningUntil) }},
+		{"shadow", func() error { shadow, err = src.GetShadow(); return err }, func() error { return dst.SetShadow(shadow) }},
+		{"tap beer", func() error { tapBeer, err = src.GetTapBeer(); return err }, func() error { return dst.SetTapBeer(tapBeer) }},
+		{"snapshot", func() error { snapshot, err = src.GetSnapshot(); return err }, func() error { return dst.SetSnapshot(snapshot) }},
+		{"firmware", func() error { firmware, err = src.GetFirmware(); return err }, func() error { return dst.SetFirmware(firmware) }},
+	}
+	for _, step := range steps {
+		if err := copyValue(step.name, step.get, step.set); err != nil {
+			return err
+		}
+	}
+
+	// the history is replayed oldest first, the last one becomes the current calibration
+	history, err := src.GetCalibrationHistory()
+	if err != nil {
+		return fmt.Errorf("could not load calibration history: %w", err)
+	}
+	if current, err := src.GetCalibration(); err == nil && len(history) == 0 {
+		history = []Calibration{current}
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if err := dst.SetCalibration(history[i]); err != nil {
+			return fmt.Errorf("could not migrate calibration: %w", err)
+		}
+		report.Counts["calibrations"]++
+	}
+
+	return nil
+}
+
+// migrateCollections copies kegs with their ratings, people and keg models
+func migrateCollections(src, dst Storage, report MigrateReport) error {
+	kegs, err := src.GetKegs()
+	if err != nil {
+		return fmt.Errorf("could not load kegs: %w", err)
+	}
+	for _, keg := range kegs {
+		if err := dst.SaveKeg(keg); err != nil {
+			return fmt.Errorf("could not migrate keg %s: %w", keg.Id, err)
+		}
+		report.Counts["kegs"]++
+
+		ratings, err := src.GetRatings(keg.Id)
+		if err != nil {
+			return fmt.Errorf("could not load ratings of keg %s: %w", keg.Id, err)
+		}
+		for _, rating := range ratings {
+			if err := dst.AddRating(rating); err != nil {
+				return fmt.Errorf("could not migrate rating: %w", err)
+			}
+			report.Counts["ratings"]++
+		}
+	}
+
+	people, err := src.GetPeople()
+	if err != nil {
+		return fmt.Errorf("could not load people: %w", err)
+	}
+	for _, person := range people {
+		if err := dst.SavePerson(person); err != nil {
+			return fmt.Errorf("could not migrate person %s: %w", person.Id, err)
+		}
+		report.Counts["people"]++
+	}
+
+	models, err := src.GetKegModels()
+	if err != nil {
+		return fmt.Errorf("could not load keg models: %w", err)
+	}
+	for _, model := range models {
+		if err := dst.SaveKegModel(model); err != nil {
+			return fmt.Errorf("could not migrate keg model %s: %w", model.Id, err)
+		}
+		report.Counts["keg models"]++
+	}
+
+	return nil
+}
+
+// migrateRange copies the history in [from, to) and verifies the destination holds the same number of records
+func migrateRange(src, dst Storage, from, to time.Time, report MigrateReport) error {
+	measurements, err := src.GetMeasurements(from, to)
+	if err != nil {
+		return err
+	}
+	for _, m := range measurements {
+		if err := dst.AddMeasurement(m); err != nil {
+			return err
+		}
+	}
+	copied, err := dst.CountMeasurements(from, to)
+	if err != nil {
+		return err
+	}
+	if copied < len(measurements) {
+		return fmt.Errorf("verification failed, %d of %d measurements stored", copied, len(measurements))
+	}
+	report.Counts["measurements"] += len(measurements)
+
+	pours, err := src.GetPours(from, to)
+	if err != nil {
+		return err
+	}
+	if err := migrateRecords(pours, dst.AddPour, dst.GetPours, from, to, "pours", report); err != nil {
+		return err
+	}
+
+	weather, err := src.GetWeather(from, to)
+	if err != nil {
+		return err
+	}
+	if err := migrateRecords(weather, dst.AddWeather, dst.GetWeather, from, to, "weather samples", report); err != nil {
+		return err
+	}
+
+	settlements, err := src.GetSettlements(from, to)
+	if err != nil {
+		return err
+	}
+	if err := migrateRecords(settlements, dst.AddSettlement, dst.GetSettlements, from, to, "settlements", report); err != nil {
+		return err
+	}
+
+	sessions, err := src.GetPubSessions(from, to)
+	if err != nil {
+		return err
+	}
+	if err := migrateRecords(sessions, dst.AddPubSession, dst.GetPubSessions, from, to, "pub sessions", report); err != nil {
+		return err
+	}
+
+	tags, err := src.GetSessionTags(from, to)
+	if err != nil {
+		return err
+	}
+	return migrateRecords(tags, dst.SetSessionTag, dst.GetSessionTags, from, to, "session tags", report)
+}
+
+// migrateRecords adds the records to the destination and verifies they can be read back
+func migrateRecords[T any](records []T, add func(T) error, get func(from, to time.Time) ([]T, error), from, to time.Time, name string, report MigrateReport) error {
+	for _, record := range records {
+		if err := add(record); err != nil {
+			return err
+		}
+	}
+
+	stored, err := get(from, to)
+	if err != nil {
+		return err
+	}
+	if len(stored) < len(records) {
+		return fmt.Errorf("verification failed, %d of %d %s stored", len(stored), len(records), name)
+	}
+	report.Counts[name] += len(records)
+	return nil
+}
+
+// runMigrateStoreCommand implements `keg-scale migrate-store --from redis --to sqlite [flags]`
+// connection details not given by flags are taken from the environment like on the server
+func runMigrateStoreCommand(args []string) error {
+	fs := flag.NewFlagSet("migrate-store", flag.ContinueOnError)
+	from := fs.String("from", "", "source storage driver (redis, sqlite, postgres)")
+	fromDsn := fs.String("from-dsn", "", "source sqlite file, postgres connection string or redis address")
+	to := fs.String("to", "", "destination storage driver (redis, sqlite, postgres)")
+	toDsn := fs.String("to-dsn", "", "destination sqlite file, postgres connection string or redis address")
+	since := fs.String("since", "", "oldest day of the migrated history (YYYY-MM-DD), 10 years back by default")
+	force := fs.Bool("force", false, "merge into a destination which already holds data")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" || *from == "memory" || *to == "memory" {
+		return fmt.Errorf("usage: keg-scale migrate-store -from redis|sqlite|postgres -to redis|sqlite|postgres [flags]")
+	}
+	if *from == *to && *fromDsn == *toDsn {
+		return fmt.Errorf("source and destination are the same storage")
+	}
+
+	now := time.Now()
+	start := now.AddDate(-10, 0, 0)
+	if *since != "" {
+		parsed, err := time.ParseInLocation(time.DateOnly, *since, getTz())
+		if err != nil {
+			return fmt.Errorf("invalid -since: %w", err)
+		}
+		start = parsed
+	}
+
+	config := NewConfig()
+	src, err := openStorage(config, *from, *fromDsn)
+	if err != nil {
+		return fmt.Errorf("could not open source: %w", err)
+	}
+	dst, err := openStorage(config, *to, *toDsn)
+	if err != nil {
+		return fmt.Errorf("could not open destination: %w", err)
+	}
+
+	report, err := MigrateStore(src, dst, start, now, *force, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(report.Counts))
+	for name := range report.Counts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Printf("%s: %d\n", name, report.Counts[name])
+	}
+	return nil
+}
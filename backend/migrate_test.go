@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateStore(t *testing.T) {
+	now := time.Date(2024, 5, 13, 12, 0, 0, 0, getTz())
+	since := now.AddDate(0, 0, -30)
+
+	src := &FakeStore{}
+	keg := NewKegInfo(50, "Pilsner", now.AddDate(0, 0, -20), 60000)
+	assert.Nil(t, src.SetKegInfo(keg))
+	assert.Nil(t, src.SaveKeg(keg))
+	assert.Nil(t, src.AddRating(Rating{KegId: keg.Id, Up: true, At: now.AddDate(0, 0, -1)}))
+	assert.Nil(t, src.SetBeersLeft(42))
+	assert.Nil(t, src.SetCalibration(Calibration{Offset: 1, Factor: 20}))
+	assert.Nil(t, src.SetCalibration(Calibration{Offset: 2, Factor: 21}))
+	assert.Nil(t, src.SavePerson(Person{Id: "p1", Name: "Pepa"}))
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, src.AddMeasurement(Measurement{Weight: 60000 - float64(i)*100, At: since.Add(time.Duration(i) * 6 * time.Hour)}))
+	}
+	assert.Nil(t, src.AddMeasurement(Measurement{Weight: 1, At: since.Add(-time.Hour)}), "older than -since")
+	assert.Nil(t, src.AddPour(Pour{KegId: keg.Id, At: now.AddDate(0, 0, -2)}))
+
+	dst := newSqliteStore(t, filepath.Join(t.TempDir(), "scale.db"))
+	var progress bytes.Buffer
+	report, err := MigrateStore(src, dst, since, now, false, &progress)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, report.Counts["measurements"])
+	assert.Equal(t, 1, report.Counts["pours"])
+	assert.Equal(t, 1, report.Counts["ratings"])
+	assert.Equal(t, 2, report.Counts["calibrations"])
+	assert.Contains(t, progress.String(), "100.0%")
+
+	count, err := dst.CountMeasurements(since.Add(-24*time.Hour), now)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, count)
+	beersLeft, err := dst.GetBeersLeft()
+	assert.Nil(t, err)
+	assert.Equal(t, 42, beersLeft)
+	calibration, err := dst.GetCalibration()
+	assert.Nil(t, err)
+	assert.Equal(t, 21.0, calibration.Factor, "the newest calibration is current")
+	history, err := dst.GetCalibrationHistory()
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	people, err := dst.GetPeople()
+	assert.Nil(t, err)
+	assert.Len(t, people, 1)
+
+	// destination holds data now
+	_, err = MigrateStore(src, dst, since, now, false, &progress)
+	assert.NotNil(t, err)
+}
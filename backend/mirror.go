@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mirror asynchronously forwards accepted scale messages to a secondary instance (e.g. staging)
+// so algorithm changes can be tested against live traffic
+// messages are dropped when the secondary is too slow, the primary is never blocked
+type Mirror struct {
+	config  *Config
+	monitor *Monitor
+	logger  *logrus.Logger
+	queue   chan string
+	client  *http.Client
+}
+
+func NewMirror(config *Config, monitor *Monitor, logger *logrus.Logger) *Mirror {
+	return &Mirror{
+		config:  config,
+		monitor: monitor,
+		logger:  logger,
+		queue:   make(chan string, 100),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Enabled returns true if the mirror url is configured
+func (m *Mirror) Enabled() bool {
+	return m.config.MirrorUrl != ""
+}
+
+// Forward enqueues the raw scale message
+func (m *Mirror) Forward(message string) {
+	if !m.Enabled() {
+		return
+	}
+
+	select {
+	case m.queue <- message:
+	default:
+		m.monitor.mirrorMessages.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Run sends queued messages until ctx is done
+// it's supposed to run as a supervised worker
+func (m *Mirror) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.logger.Debug("Mirror stopped")
+			return
+		case <-tick.C:
+			heartbeat()
+		case message := <-m.queue:
+			err := m.monitor.deliveries.Track("mirror", func() error {
+				return m.send(ctx, message)
+			})
+			if err != nil {
+				m.monitor.mirrorMessages.WithLabelValues("failed").Inc()
+				m.logger.Warnf("Could not mirror scale message: %v", err)
+			} else {
+				m.monitor.mirrorMessages.WithLabelValues("sent").Inc()
+			}
+			heartbeat()
+		}
+	}
+}
+
+func (m *Mirror) send(ctx context.Context, message string) error {
+	if m.config.DryRun {
+		m.logger.Infof("Dry run, not mirroring scale message: %s", message)
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.MirrorUrl, strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", m.config.MirrorToken)
+
+	res, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("mirror returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
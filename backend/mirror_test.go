@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirror(t *testing.T) {
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "staging" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- string(body)
+	}))
+	defer srv.Close()
+
+	s := CreateScaleWithMeasurements(22)
+	s.config.MirrorUrl = srv.URL + "/api/scale/push"
+	s.config.MirrorToken = "staging"
+	mirror := NewMirror(s.config, s.monitor, s.logger)
+	hr := &HandlerRepository{
+		scale:    s,
+		config:   s.config,
+		monitor:  s.monitor,
+		capture:  NewCapture(s.config),
+		mirror:   mirror,
+		sequence: NewMessageSequence(),
+		logger:   s.logger,
+	}
+	router := NewRouter(hr)
+	push := func(auth, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/scale/push", strings.NewReader(body))
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// the primary answers before anything is mirrored
+	assert.Equal(t, http.StatusOK, push("test", "push|42|-70|21800"))
+	assert.Equal(t, http.StatusUnauthorized, push("wrong", "push|43|-70|21700"))
+	assert.Equal(t, http.StatusOK, push("test", "push|42|-70|21800"), "acknowledged retry")
+	assert.Len(t, mirror.queue, 1, "only accepted messages are mirrored")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		mirror.Run(ctx, func() {})
+		close(done)
+	}()
+	select {
+	case message := <-received:
+		assert.Equal(t, "push|42|-70|21800", message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not mirrored")
+	}
+	cancel()
+	<-done
+	assert.Equal(t, 1.0, counterValue(t, s.monitor, "scale_mirror_messages_total"))
+
+	// a slow secondary never blocks the primary
+	mirror = NewMirror(s.config, s.monitor, s.logger)
+	for i := 0; i < cap(mirror.queue)+5; i++ {
+		mirror.Forward("ping|1|-70|")
+	}
+	assert.Len(t, mirror.queue, cap(mirror.queue))
+}
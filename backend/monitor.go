@@ -1,25 +1,105 @@
 package main
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
 
 // Monitor represents a Prometheus monitor
 // It contains Prometheus registry and all available metrics
 type Monitor struct {
 	Registry *prometheus.Registry
+	labels   prometheus.Labels // constant labels of all series, e.g. the device
 
 	weight        *prometheus.GaugeVec
 	activeKeg     *prometheus.GaugeVec
 	beersLeft     *prometheus.GaugeVec
 	scaleWifiRssi *prometheus.GaugeVec
+	temperature   *prometheus.GaugeVec
+	battery       *prometheus.GaugeVec
 	lastPing      *prometheus.GaugeVec
 	pubIsOpen     *prometheus.GaugeVec
+	shadowDrift   *prometheus.GaugeVec
+
+	publicRequests *prometheus.CounterVec
+
+	pourSize *prometheus.HistogramVec
+	pours    *prometheus.CounterVec
+	beers    *prometheus.CounterVec
+	kegInfo  *prometheus.GaugeVec
+
+	workerRestarts  *prometheus.CounterVec
+	workerHeartbeat *prometheus.GaugeVec
+
+	mirrorMessages *prometheus.CounterVec
+	webhookEvents  *prometheus.CounterVec
+
+	runawayTap *prometheus.GaugeVec
+	closedLoss *prometheus.GaugeVec
+	emptyScale *prometheus.GaugeVec
+	tareShift  *prometheus.GaugeVec
+	cleaning   *prometheus.GaugeVec
+
+	ingestRejected  *prometheus.CounterVec
+	messagesDropped *prometheus.CounterVec
+	duplicateLag    *prometheus.HistogramVec
+	measurements    *prometheus.CounterVec
+	sourceWeight    *prometheus.GaugeVec
+	weightOutliers  *prometheus.CounterVec
+
+	poursPerHour *prometheus.GaugeVec
+	pours15m     *prometheus.GaugeVec
+	kegEmptyAt   *prometheus.GaugeVec
+	walPending   *prometheus.GaugeVec
+	degraded     *prometheus.GaugeVec
+
+	channelDeliveries  *prometheus.CounterVec
+	channelLatency     *prometheus.HistogramVec
+	channelLastSuccess *prometheus.GaugeVec
+
+	selfCheckFailed    *prometheus.GaugeVec
+	measurementsPruned *prometheus.CounterVec
+
+	httpDuration *prometheus.HistogramVec
+
+	guard      *CardinalityGuard // nil disables the guard
+	deliveries *DeliveryTracker
 }
 
 // NewMonitor creates a new Monitor
 func NewMonitor() *Monitor {
-	reg := prometheus.NewRegistry()
+	return newMonitor(nil)
+}
+
+// ForDevice creates Monitor of an additional scale with its own registry
+// all its series carry the device label, the cardinality guard is shared
+func (m *Monitor) ForDevice(device string) *Monitor {
+	labels := prometheus.Labels{"device": device}
+	for name, value := range m.labels {
+		labels[name] = value
+	}
+	monitor := newMonitor(labels)
+	monitor.guard = m.guard
+	return monitor
+}
+
+// ForPub creates Monitor of a hosted pub with its own registry
+// all its series (and series of its additional scales) carry the pub label, the cardinality guard is shared
+func (m *Monitor) ForPub(pub string) *Monitor {
+	monitor := newMonitor(prometheus.Labels{"pub": pub})
+	monitor.guard = m.guard
+	return monitor
+}
+
+func newMonitor(labels prometheus.Labels) *Monitor {
+	registry := prometheus.NewRegistry()
+	reg := prometheus.WrapRegistererWith(labels, registry)
 	monitor := &Monitor{
-		Registry: reg,
+		Registry: registry,
+		labels:   labels,
 
 		weight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_weight",
@@ -41,6 +121,16 @@ func NewMonitor() *Monitor {
 			Help: "Current WiFi RSSI",
 		}, []string{}),
 
+		temperature: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_temperature_celsius",
+			Help: "Temperature measured by the scale",
+		}, []string{}),
+
+		battery: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_battery_volts",
+			Help: "Battery voltage of the scale",
+		}, []string{}),
+
 		lastPing: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scale_last_ping",
 			Help: "Last update time",
@@ -50,14 +140,277 @@ func NewMonitor() *Monitor {
 			Name: "scale_pub_open",
 			Help: "Is the pub open/closed",
 		}, []string{}),
+
+		shadowDrift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_shadow_drift",
+			Help: "Device has not applied desired configuration within allowed number of reports",
+		}, []string{}),
+
+		publicRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_public_api_requests_total",
+			Help: "Number of public API requests per token and result",
+		}, []string{"token", "result"}),
+
+		pourSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scale_pour_size_grams",
+			Help:    "Size of detected pours in grams",
+			Buckets: []float64{100, 200, 300, 400, 450, 500, 550, 600, 750, 1000},
+		}, []string{}),
+
+		pours: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_pours_total",
+			Help: "Number of detected pours",
+		}, []string{}),
+
+		beers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_beers_poured_total",
+			Help: "Number of beers (glasses of the tapped beer) poured from the keg, it survives restarts",
+		}, []string{"keg_id"}),
+
+		kegInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_keg_info",
+			Help: "Info about the tapped keg, value is always 1",
+		}, []string{"keg_id", "beer", "size"}),
+
+		workerRestarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_worker_restarts_total",
+			Help: "Number of background worker restarts by the supervisor",
+		}, []string{"worker"}),
+
+		workerHeartbeat: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_worker_last_heartbeat",
+			Help: "Last heartbeat time of the background worker",
+		}, []string{"worker"}),
+
+		mirrorMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_mirror_messages_total",
+			Help: "Number of scale messages forwarded to the mirror by result",
+		}, []string{"result"}),
+
+		webhookEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_webhook_events_total",
+			Help: "Number of events posted to the webhooks by result",
+		}, []string{"result"}),
+
+		runawayTap: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_runaway_tap",
+			Help: "Weight is decreasing continuously for too long (stuck tap, burst line)",
+		}, []string{}),
+
+		closedLoss: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_closed_loss",
+			Help: "Keg lost weight while the pub is closed (leak, theft, self-service pour)",
+		}, []string{}),
+
+		emptyScale: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_empty",
+			Help: "Nothing is on the scale while the pub is open (keg removed, platform lifted)",
+		}, []string{}),
+
+		tareShift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_tare_shift",
+			Help: "Scale measures negative weights, the load cell needs recalibration",
+		}, []string{}),
+
+		cleaning: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_cleaning",
+			Help: "Line cleaning is in progress, statistics are suspended",
+		}, []string{}),
+
+		ingestRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_ingest_rejected_total",
+			Help: "Number of scale messages rejected by the IP allowlist, rate limits or size limit",
+		}, []string{"reason"}),
+
+		messagesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_messages_dropped_total",
+			Help: "Number of scale messages dropped as duplicate, stale (retries on flaky WiFi) or replayed signed message",
+		}, []string{"reason"}),
+
+		duplicateLag: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scale_duplicate_lag_seconds",
+			Help:    "How late copies of already processed messages arrive through the transport, the slower transport has higher values",
+			Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60},
+		}, []string{"source"}),
+
+		measurements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_measurements_total",
+			Help: "Number of accepted measurements by the ingestion path (http, mqtt, manual)",
+		}, []string{"source"}),
+
+		sourceWeight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_source_weight",
+			Help: "Last weight in grams received through the ingestion path, paths should agree",
+		}, []string{"source"}),
+
+		weightOutliers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_weight_outliers_total",
+			Help: "Number of measurements rejected by the weight filter as spikes (someone leaned on the keg)",
+		}, []string{}),
+
+		poursPerHour: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_pours_per_hour",
+			Help: "Number of pours within the last hour",
+		}, []string{}),
+
+		pours15m: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_pours_15m",
+			Help: "Number of pours within the last 15 minutes, a rough occupancy of the pub",
+		}, []string{}),
+
+		kegEmptyAt: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_keg_empty_at",
+			Help: "Predicted time the keg runs out as unix timestamp by the consumption of recent opening hours, 0 if unknown or the pub is closed",
+		}, []string{}),
+
+		walPending: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_wal_pending",
+			Help: "Number of writes buffered in the write ahead log while the storage is unreachable",
+		}, []string{}),
+
+		degraded: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_degraded",
+			Help: "Storage is unavailable and the state is served from memory",
+		}, []string{}),
+
+		channelDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_channel_deliveries_total",
+			Help: "Number of deliveries of outgoing channels by result",
+		}, []string{"channel", "result"}),
+
+		channelLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scale_channel_delivery_seconds",
+			Help:    "Latency of deliveries of outgoing channels",
+			Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"channel"}),
+
+		channelLastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_channel_last_success",
+			Help: "Time of the last successful delivery of the outgoing channel",
+		}, []string{"channel"}),
+
+		selfCheckFailed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scale_selfcheck_failed",
+			Help: "Number of failed checks of the last nightly self-check",
+		}, []string{}),
+
+		measurementsPruned: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scale_measurements_pruned_total",
+			Help: "Number of measurements deleted by the retention",
+		}, []string{}),
+
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scale_http_request_duration_seconds",
+			Help:    "Latency of HTTP handlers by route template, method and status code",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+		}, []string{"route", "method", "code"}),
 	}
+	monitor.deliveries = NewDeliveryTracker(monitor)
 
 	reg.MustRegister(monitor.weight)
 	reg.MustRegister(monitor.activeKeg)
 	reg.MustRegister(monitor.beersLeft)
 	reg.MustRegister(monitor.scaleWifiRssi)
+	reg.MustRegister(monitor.temperature)
+	reg.MustRegister(monitor.battery)
 	reg.MustRegister(monitor.lastPing)
 	reg.MustRegister(monitor.pubIsOpen)
+	reg.MustRegister(monitor.shadowDrift)
+	reg.MustRegister(monitor.publicRequests)
+	reg.MustRegister(monitor.pourSize)
+	reg.MustRegister(monitor.pours)
+	reg.MustRegister(monitor.beers)
+	reg.MustRegister(monitor.kegInfo)
+	reg.MustRegister(monitor.workerRestarts)
+	reg.MustRegister(monitor.workerHeartbeat)
+	reg.MustRegister(monitor.mirrorMessages)
+	reg.MustRegister(monitor.webhookEvents)
+	reg.MustRegister(monitor.runawayTap)
+	reg.MustRegister(monitor.closedLoss)
+	reg.MustRegister(monitor.emptyScale)
+	reg.MustRegister(monitor.tareShift)
+	reg.MustRegister(monitor.cleaning)
+	reg.MustRegister(monitor.ingestRejected)
+	reg.MustRegister(monitor.messagesDropped)
+	reg.MustRegister(monitor.duplicateLag)
+	reg.MustRegister(monitor.measurements)
+	reg.MustRegister(monitor.sourceWeight)
+	reg.MustRegister(monitor.weightOutliers)
+	reg.MustRegister(monitor.poursPerHour)
+	reg.MustRegister(monitor.pours15m)
+	reg.MustRegister(monitor.kegEmptyAt)
+	reg.MustRegister(monitor.walPending)
+	reg.MustRegister(monitor.degraded)
+	reg.MustRegister(monitor.channelDeliveries)
+	reg.MustRegister(monitor.channelLatency)
+	reg.MustRegister(monitor.channelLastSuccess)
+	reg.MustRegister(monitor.selfCheckFailed)
+	reg.MustRegister(monitor.measurementsPruned)
+	reg.MustRegister(monitor.httpDuration)
 
 	return monitor
 }
+
+// publicMetrics are series safe to share with anyone (e.g. community status page)
+// infrastructure metrics (RSSI, workers, channels) are available only on the private endpoint
+var publicMetrics = map[string]bool{
+	"scale_pub_open":   true,
+	"scale_beers_left": true,
+}
+
+// PublicGatherer gathers only [publicMetrics] from the registry
+func (m *Monitor) PublicGatherer() prometheus.Gatherer {
+	return publicGatherer(m.Registry)
+}
+
+// publicGatherer gathers only [publicMetrics] from the gatherer
+func publicGatherer(gatherer prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := gatherer.Gather()
+		public := make([]*dto.MetricFamily, 0, len(publicMetrics))
+		for _, family := range families {
+			if publicMetrics[family.GetName()] {
+				public = append(public, family)
+			}
+		}
+
+		return public, err
+	})
+}
+
+// GuardCardinality caps number of label combinations of every labeled metric
+func (m *Monitor) GuardCardinality(limit int, logger *logrus.Logger) {
+	m.guard = NewCardinalityGuard(limit, logger)
+}
+
+// ExpireDeviceMetrics removes series fed by the device
+// so Prometheus reflects missing data instead of frozen last values
+func (m *Monitor) ExpireDeviceMetrics() {
+	m.weight.Reset()
+	m.beersLeft.Reset()
+	m.scaleWifiRssi.Reset()
+	m.temperature.Reset()
+	m.battery.Reset()
+	m.sourceWeight.Reset()
+	m.guard.Reset("scale_source_weight")
+}
+
+// AddBeers increases the counter of beers poured from the keg
+// zero exposes the series of a freshly tapped keg, the whole count restores it after restart
+func (m *Monitor) AddBeers(kegId string, beers float64) {
+	m.beers.WithLabelValues(m.guard.Labels("scale_beers_poured_total", kegId)...).Add(beers)
+}
+
+// RemoveKeg removes series of the untapped keg, the beer counter is restored when the keg is tapped again
+func (m *Monitor) RemoveKeg(kegId string) {
+	m.kegInfo.Reset()
+	m.guard.Reset("scale_keg_info")
+	m.beers.DeleteLabelValues(kegId)
+}
+
+// SetKegInfo replaces the info series with the currently tapped keg
+func (m *Monitor) SetKegInfo(info KegInfo) {
+	m.kegInfo.Reset()
+	m.guard.Reset("scale_keg_info")
+	m.kegInfo.WithLabelValues(m.guard.Labels("scale_keg_info", info.Id, info.Beer, strconv.Itoa(info.Size))...).Set(1)
+}
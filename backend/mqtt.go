@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minimal MQTT 3.1.1 subscriber, enough to receive scale messages published by the firmware
+// messages are subscribed with QoS 1, so the broker redelivers them after reconnect
+
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttPuback     = 0x40
+	mqttSubscribe  = 0x82 // reserved flags of SUBSCRIBE are 0010
+	mqttSuback     = 0x90
+	mqttPingreq    = 0xC0
+	mqttPingresp   = 0xD0
+	mqttDisconnect = 0xE0
+
+	mqttKeepAlive      = 60 * time.Second
+	mqttReconnectDelay = 5 * time.Second
+	mqttMaxPacket      = 64 * 1024 // scale messages are tiny, bigger packets mean a broken stream
+)
+
+// MqttSubscriber consumes scale messages from the MQTT broker
+// it runs alongside the HTTP push endpoint and feeds the same pipeline
+type MqttSubscriber struct {
+	config *Config
+	ingest func(message string) error
+	logger *logrus.Logger
+
+	mux  sync.Mutex // guards writes to the connection
+	conn net.Conn
+}
+
+func NewMqttSubscriber(config *Config, ingest func(message string) error, logger *logrus.Logger) *MqttSubscriber {
+	return &MqttSubscriber{
+		config: config,
+		ingest: ingest,
+		logger: logger,
+	}
+}
+
+// Enabled returns true if the broker is configured
+func (m *MqttSubscriber) Enabled() bool {
+	return m.config.MqttBroker != ""
+}
+
+// Run keeps the subscription alive and reconnects when the broker goes away
+// it's supposed to run as a supervised worker
+func (m *MqttSubscriber) Run(ctx context.Context, heartbeat func()) {
+	for {
+		heartbeat()
+		if err := m.session(ctx, heartbeat); err != nil && ctx.Err() == nil {
+			m.logger.Warnf("MQTT session failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			m.logger.Debug("MQTT subscriber stopped")
+			return
+		case <-time.After(mqttReconnectDelay):
+		}
+	}
+}
+
+// session connects, subscribes and processes messages until the connection fails
+func (m *MqttSubscriber) session(ctx context.Context, heartbeat func()) error {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", m.config.MqttBroker)
+	if err != nil {
+		return fmt.Errorf("could not connect to broker: %w", err)
+	}
+	m.mux.Lock()
+	m.conn = conn
+	m.mux.Unlock()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = m.write(mqttDisconnect, nil)
+		case <-done:
+		}
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	if err := m.handshake(reader); err != nil {
+		return err
+	}
+	m.logger.Infof("MQTT subscribed to %s at %s", m.config.MqttTopic, m.config.MqttBroker)
+
+	go m.keepAlive(done)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(mqttKeepAlive * 3 / 2))
+		packetType, body, err := readMqttPacket(reader)
+		if err != nil {
+			return err
+		}
+		heartbeat()
+
+		switch packetType & 0xF0 {
+		case mqttPublish:
+			if err := m.handlePublish(packetType, body); err != nil {
+				return err
+			}
+		case mqttPingresp:
+		default:
+			m.logger.Debugf("MQTT ignoring packet 0x%02x", packetType)
+		}
+	}
+}
+
+func (m *MqttSubscriber) handshake(reader *bufio.Reader) error {
+	if err := m.write(mqttConnect, m.connectPacket()); err != nil {
+		return err
+	}
+	packetType, body, err := readMqttPacket(reader)
+	if err != nil {
+		return fmt.Errorf("could not read CONNACK: %w", err)
+	}
+	if packetType != mqttConnack || len(body) != 2 {
+		return fmt.Errorf("unexpected packet 0x%02x instead of CONNACK", packetType)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("broker refused connection with code %d", body[1])
+	}
+
+	subscribe := binary.BigEndian.AppendUint16(nil, 1)
+	subscribe = appendMqttString(subscribe, m.config.MqttTopic)
+	subscribe = append(subscribe, 1) // QoS 1
+	if err := m.write(mqttSubscribe, subscribe); err != nil {
+		return err
+	}
+	packetType, body, err = readMqttPacket(reader)
+	if err != nil {
+		return fmt.Errorf("could not read SUBACK: %w", err)
+	}
+	if packetType != mqttSuback || len(body) != 3 {
+		return fmt.Errorf("unexpected packet 0x%02x instead of SUBACK", packetType)
+	}
+	if body[2] == 0x80 {
+		return fmt.Errorf("broker refused subscription to %s", m.config.MqttTopic)
+	}
+
+	return nil
+}
+
+func (m *MqttSubscriber) connectPacket() []byte {
+	flags := byte(0) // persistent session, QoS 1 messages are kept while we are offline
+	if m.config.MqttUsername != "" {
+		flags |= 0x80
+	}
+	if m.config.MqttPassword != "" {
+		flags |= 0x40
+	}
+
+	packet := appendMqttString(nil, "MQTT")
+	packet = append(packet, 4, flags) // protocol level 3.1.1
+	packet = binary.BigEndian.AppendUint16(packet, uint16(mqttKeepAlive.Seconds()))
+	packet = appendMqttString(packet, m.config.MqttClientId)
+	if m.config.MqttUsername != "" {
+		packet = appendMqttString(packet, m.config.MqttUsername)
+	}
+	if m.config.MqttPassword != "" {
+		packet = appendMqttString(packet, m.config.MqttPassword)
+	}
+
+	return packet
+}
+
+func (m *MqttSubscriber) handlePublish(packetType byte, body []byte) error {
+	if len(body) < 2 {
+		return fmt.Errorf("malformed PUBLISH")
+	}
+	topicLength := int(binary.BigEndian.Uint16(body))
+	offset := 2 + topicLength
+
+	qos := (packetType >> 1) & 0x03
+	var packetId []byte
+	if qos > 0 {
+		if len(body) < offset+2 {
+			return fmt.Errorf("malformed PUBLISH")
+		}
+		packetId = body[offset : offset+2]
+		offset += 2
+	}
+	if len(body) < offset {
+		return fmt.Errorf("malformed PUBLISH")
+	}
+
+	// invalid messages are acknowledged too, redelivery would not fix them
+	if err := m.ingest(string(body[offset:])); err != nil {
+		m.logger.Warnf("Could not process MQTT message: %v", err)
+	}
+
+	if qos > 0 {
+		return m.write(mqttPuback, packetId)
+	}
+	return nil
+}
+
+func (m *MqttSubscriber) keepAlive(done chan struct{}) {
+	tick := time.NewTicker(mqttKeepAlive / 2)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+			if err := m.write(mqttPingreq, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (m *MqttSubscriber) write(packetType byte, body []byte) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	packet := append([]byte{packetType}, encodeMqttLength(len(body))...)
+	_ = m.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := m.conn.Write(append(packet, body...)); err != nil {
+		return fmt.Errorf("could not write MQTT packet: %w", err)
+	}
+	return nil
+}
+
+func appendMqttString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// encodeMqttLength encodes the remaining length as variable byte integer
+func encodeMqttLength(length int) []byte {
+	var encoded []byte
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		encoded = append(encoded, digit)
+		if length == 0 {
+			return encoded
+		}
+	}
+}
+
+func readMqttPacket(r *bufio.Reader) (byte, []byte, error) {
+	packetType, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7F) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	if length > mqttMaxPacket {
+		return 0, nil, fmt.Errorf("packet too big: %d bytes", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+
+	return packetType, body, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeMqttLength(t *testing.T) {
+	assert.Equal(t, []byte{0}, encodeMqttLength(0))
+	assert.Equal(t, []byte{127}, encodeMqttLength(127))
+	assert.Equal(t, []byte{0x80, 0x01}, encodeMqttLength(128))
+	assert.Equal(t, []byte{0xFF, 0x7F}, encodeMqttLength(16383))
+}
+
+// fakeBroker accepts a single subscriber and publishes the given payloads with QoS 1
+func fakeBroker(t *testing.T, payloads []string) (string, chan []byte) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	acks := make(chan []byte, len(payloads))
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		write := func(packetType byte, body []byte) {
+			_, _ = conn.Write(append(append([]byte{packetType}, encodeMqttLength(len(body))...), body...))
+		}
+
+		packetType, body, err := readMqttPacket(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, byte(mqttConnect), packetType)
+		assert.Equal(t, "MQTT", string(body[2:6]))
+		write(mqttConnack, []byte{0, 0})
+
+		packetType, body, err = readMqttPacket(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, byte(mqttSubscribe), packetType)
+		assert.Equal(t, "scale/messages", string(body[4:len(body)-1]))
+		write(mqttSuback, []byte{body[0], body[1], 1})
+
+		for i, payload := range payloads {
+			publish := appendMqttString(nil, "scale/messages")
+			publish = binary.BigEndian.AppendUint16(publish, uint16(i+1))
+			write(mqttPublish|0x02, append(publish, payload...))
+
+			packetType, body, err = readMqttPacket(reader)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, byte(mqttPuback), packetType)
+			acks <- body
+		}
+
+		// wait for disconnect
+		_, _, _ = readMqttPacket(reader)
+	}()
+
+	return listener.Addr().String(), acks
+}
+
+func TestMqttSubscriber(t *testing.T) {
+	addr, acks := fakeBroker(t, []string{"ping|1|-70|", "push|2|-70|20000", "garbage"})
+
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.MqttBroker = addr
+
+	received := make(chan string, 3)
+	mqtt := NewMqttSubscriber(config, func(message string) error {
+		received <- message
+		return nil
+	}, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mqtt.Run(ctx, func() {})
+
+	for i, expected := range []string{"ping|1|-70|", "push|2|-70|20000", "garbage"} {
+		select {
+		case message := <-received:
+			assert.Equal(t, expected, message)
+		case <-time.After(5 * time.Second):
+			t.Fatal("message was not received")
+		}
+		assert.Equal(t, []byte{0, byte(i + 1)}, <-acks)
+	}
+}
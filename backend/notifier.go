@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NotifyChannel delivers text notifications (Telegram chat, Slack channel)
+type NotifyChannel interface {
+	Name() string
+	Send(ctx context.Context, text string) error
+}
+
+// TelegramChannel sends messages by the Telegram bot to a single chat
+type TelegramChannel struct {
+	apiUrl string // https://api.telegram.org/bot<token>
+	chatId string
+	client *http.Client
+}
+
+func NewTelegramChannel(token, chatId string) *TelegramChannel {
+	return &TelegramChannel{
+		apiUrl: "https://api.telegram.org/bot" + token,
+		chatId: chatId,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *TelegramChannel) Name() string {
+	return "telegram"
+}
+
+func (c *TelegramChannel) Send(ctx context.Context, text string) error {
+	return postNotification(ctx, c.client, c.apiUrl+"/sendMessage", map[string]string{"chat_id": c.chatId, "text": text})
+}
+
+// SlackChannel sends messages to the Slack incoming webhook
+type SlackChannel struct {
+	webhook string
+	client  *http.Client
+}
+
+func NewSlackChannel(webhook string) *SlackChannel {
+	return &SlackChannel{
+		webhook: webhook,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (c *SlackChannel) Name() string {
+	return "slack"
+}
+
+func (c *SlackChannel) Send(ctx context.Context, text string) error {
+	return postNotification(ctx, c.client, c.webhook, map[string]string{"text": text})
+}
+
+func postNotification(ctx context.Context, client *http.Client, endpoint string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("notification returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// Notifier sends notifications about the keg and the pub to the configured channels
+// - beers left dropped under [Config.NotifyBeersLeft] and the keg ran empty, once per keg
+// - pub opened and closed with open tabs of the night, runaway tap, loss while closed, at most once per [Config.NotifyCooldown]
+// - conditions of [Config.AlertRules] to the channels of the rule
+// scale state is reported every few seconds, sent notifications are remembered to avoid spamming
+type Notifier struct {
+	config   *Config
+	scale    *Scale
+	monitor  *Monitor
+	logger   *logrus.Logger
+	channels []NotifyChannel
+	sent     map[string]time.Time // notification key => last delivery
+}
+
+func NewNotifier(config *Config, scale *Scale, monitor *Monitor, logger *logrus.Logger) *Notifier {
+	var channels []NotifyChannel
+	if config.TelegramToken != "" {
+		channels = append(channels, NewTelegramChannel(config.TelegramToken, config.TelegramChatId))
+	}
+	if config.SlackWebhook != "" {
+		channels = append(channels, NewSlackChannel(config.SlackWebhook))
+	}
+
+	return &Notifier{
+		config:   config,
+		scale:    scale,
+		monitor:  monitor,
+		logger:   logger,
+		channels: channels,
+		sent:     map[string]time.Time{},
+	}
+}
+
+// Enabled returns true if any channel is configured
+func (n *Notifier) Enabled() bool {
+	return len(n.channels) > 0
+}
+
+// Run sends notifications for scale events until ctx is done
+// it's supposed to run as a supervised worker
+func (n *Notifier) Run(ctx context.Context, heartbeat func()) {
+	events := n.scale.events.Subscribe()
+	defer n.scale.events.Unsubscribe(events)
+
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			n.logger.Debug("Notifier stopped")
+			return
+		case <-tick.C:
+			heartbeat()
+		case event := <-events:
+			n.Handle(ctx, event)
+			heartbeat()
+		}
+	}
+}
+
+// Handle sends notifications triggered by the event
+func (n *Notifier) Handle(ctx context.Context, event Event) {
+	switch event.Type {
+	case PubOpenEventType:
+		n.notifyCooldown(ctx, "pub_open", event.At, "🍺 The pub is open")
+	case OfflineEventType:
+		n.notifyCooldown(ctx, "pub_closed", event.At, "🌙 The pub is closed")
+		if data, ok := event.Data.(OfflineEvent); ok {
+			n.summarizeTabs(ctx, data.LastOk, event.At)
+		}
+	case RunawayTapEventType:
+		n.notifyCooldown(ctx, "runaway_tap", event.At, "⚠️ Beer has been flowing for too long, is the tap left open?")
+	case ClosedLossEventType:
+		if data, ok := event.Data.(ClosedLossEvent); ok {
+			n.notifyCooldown(ctx, "closed_loss", event.At, fmt.Sprintf("🚨 %s %s of beer disappeared while the pub is closed, is there a leak?", formatWeight(data.Grams, display.locale), display.weightUnit))
+		}
+	case EmptyScaleEventType:
+		n.notifyCooldown(ctx, "empty_scale", event.At, "⚖️ Nothing is on the scale while the pub is open, was the keg removed?")
+	case TareShiftEventType:
+		if data, ok := event.Data.(TareShift); ok {
+			n.notifyCooldown(ctx, "tare_shift", event.At, fmt.Sprintf("⚖️ The scale measures %s %s, its tare shifted and it needs recalibration", formatWeight(data.Weight, display.locale), display.weightUnit))
+		}
+	case AlertRuleEventType:
+		// the rule engine applies the cooldown of the rule
+		if data, ok := event.Data.(AlertRuleEvent); ok {
+			n.notifyChannels(ctx, "rule:"+data.Rule, event.At, data.Message, data.Channels)
+		}
+	case StateChangeEventType:
+		if data, ok := event.Data.(StateChangeEvent); ok && data.Reason == "measurement" {
+			n.checkKeg(ctx, n.scale.Status(), event.At)
+		}
+	}
+}
+
+// checkKeg notifies about the low and the empty keg once per keg
+func (n *Notifier) checkKeg(ctx context.Context, status ScaleStatus, now time.Time) {
+	if status.KegInfo == nil || status.CleaningUntil != nil {
+		return
+	}
+	keg := status.KegInfo
+
+	if status.BeersLeft <= 0 {
+		n.notifyOnce(ctx, "empty:"+keg.Id, now, fmt.Sprintf("🛢️ The %dl keg of %s is empty", keg.Size, beerName(keg.Beer)))
+		return
+	}
+	if status.BeersLeft <= n.config.NotifyBeersLeft {
+		text := fmt.Sprintf("⏳ Only %d beers of %s are left", status.BeersLeft, beerName(keg.Beer))
+		if eta, err := n.scale.KegEta(now); err == nil && eta != nil {
+			text += fmt.Sprintf(", the keg runs out at about %s", formatTime(*eta))
+		}
+		n.notifyOnce(ctx, "low:"+keg.Id, now, text)
+	}
+}
+
+// summarizeTabs sends tabs left open when the pub closed
+// the pub day is given by the last message of the scale, the pub closes a few minutes later
+func (n *Notifier) summarizeTabs(ctx context.Context, lastOk, now time.Time) {
+	tabs, err := GetTabs(n.scale.store, n.config, pubDayStart(lastOk, n.config.PubDayStart), now)
+	if err != nil {
+		n.logger.Warnf("Could not load tabs: %v", err)
+		return
+	}
+	if len(tabs) == 0 {
+		return
+	}
+
+	n.notifyCooldown(ctx, "tabs", now, FormatTabsSummary(tabs, n.config.GlassPrice))
+}
+
+func beerName(beer string) string {
+	if beer == "" {
+		return "beer"
+	}
+	return beer
+}
+
+// notifyOnce sends the notification if the key has never been notified
+func (n *Notifier) notifyOnce(ctx context.Context, key string, now time.Time, text string) {
+	if _, found := n.sent[key]; found {
+		return
+	}
+	n.notify(ctx, key, now, text)
+}
+
+// notifyCooldown sends the notification if the key was not notified within the cooldown
+// so a flapping connection of the scale does not open and close the pub every minute
+func (n *Notifier) notifyCooldown(ctx context.Context, key string, now time.Time, text string) {
+	if last, found := n.sent[key]; found && now.Sub(last) < n.config.NotifyCooldown {
+		return
+	}
+	n.notify(ctx, key, now, text)
+}
+
+// notify delivers the text to all channels
+// failed deliveries are not retried, the notification is outdated soon
+func (n *Notifier) notify(ctx context.Context, key string, now time.Time, text string) {
+	n.notifyChannels(ctx, key, now, text, nil)
+}
+
+// notifyChannels delivers the text to the named channels, all of them if names are empty
+func (n *Notifier) notifyChannels(ctx context.Context, key string, now time.Time, text string, names []string) {
+	n.sent[key] = now
+
+	for _, channel := range n.channels {
+		if len(names) > 0 && !slices.Contains(names, channel.Name()) {
+			continue
+		}
+		err := n.monitor.deliveries.Track(channel.Name(), func() error {
+			if n.config.DryRun {
+				n.logger.Infof("Dry run, not sending %s notification: %s", channel.Name(), text)
+				return nil
+			}
+			return channel.Send(ctx, text)
+		})
+		if err != nil {
+			n.logger.Warnf("Could not send %s notification %s: %v", channel.Name(), key, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier(t *testing.T) {
+	var mux sync.Mutex
+	var telegram, slack []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+
+		mux.Lock()
+		defer mux.Unlock()
+		switch r.URL.Path {
+		case "/bottoken/sendMessage":
+			assert.Equal(t, "42", payload["chat_id"])
+			telegram = append(telegram, payload["text"])
+		case "/slack":
+			slack = append(slack, payload["text"])
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	s.config.NotifyBeersLeft = 10
+	s.config.NotifyCooldown = time.Hour
+
+	telegramChannel := NewTelegramChannel("token", "42")
+	telegramChannel.apiUrl = srv.URL + "/bottoken"
+	slackChannel := NewSlackChannel(srv.URL + "/slack")
+	n := NewNotifier(s.config, s, s.monitor, logrus.New())
+	n.channels = []NotifyChannel{telegramChannel, slackChannel}
+
+	ctx := context.Background()
+	now := time.Now()
+	measurement := Event{Type: StateChangeEventType, At: now, Data: StateChangeEvent{Reason: "measurement"}}
+
+	n.Handle(ctx, measurement) // full keg
+	n.Handle(ctx, Event{Type: PubOpenEventType, At: now})
+	n.Handle(ctx, Event{Type: OfflineEventType, At: now.Add(time.Minute)})
+	n.Handle(ctx, Event{Type: PubOpenEventType, At: now.Add(2 * time.Minute)}) // flapping connection
+
+	assert.Nil(t, s.AddMeasurement(9500, SourceHttp))
+	n.Handle(ctx, measurement)
+	n.Handle(ctx, measurement) // still low, already notified
+	assert.Nil(t, s.AddMeasurement(7000, SourceHttp))
+	n.Handle(ctx, measurement)
+	n.Handle(ctx, Event{Type: StateChangeEventType, At: now, Data: StateChangeEvent{Reason: "ping"}})
+	n.Handle(ctx, Event{Type: ClosedLossEventType, At: now, Data: ClosedLossEvent{Grams: 1500, Weight: 5500}})
+
+	mux.Lock()
+	defer mux.Unlock()
+	assert.Equal(t, telegram, slack)
+	assert.Len(t, telegram, 5)
+	assert.Equal(t, "🍺 The pub is open", telegram[0])
+	assert.Equal(t, "🌙 The pub is closed", telegram[1])
+	assert.Contains(t, telegram[2], "beers of")
+	assert.Contains(t, telegram[3], "is empty")
+	assert.Equal(t, "🚨 1,50 kg of beer disappeared while the pub is closed, is there a leak?", telegram[4])
+
+	health := s.monitor.deliveries.Health()
+	assert.Len(t, health, 2)
+	assert.Equal(t, 5, health[0].Successes)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// occupancyWindow is the sliding window of pours the occupancy is estimated from
+const occupancyWindow = 15 * time.Minute
+
+// rough occupancy of the pub by the pour frequency, see [Config.OccupancyBusy] and [Config.OccupancyPacked]
+const (
+	OccupancyClosed = "closed"
+	OccupancyEmpty  = "empty" // open, nobody is drinking
+	OccupancyQuiet  = "quiet"
+	OccupancyBusy   = "busy"
+	OccupancyPacked = "packed"
+)
+
+// Occupancy is how busy the pub is right now
+type Occupancy struct {
+	Level string `json:"level"`
+	Pours int    `json:"pours"` // finished within the last 15 minutes
+}
+
+// OccupancyLevel returns the level of pours within [occupancyWindow]
+func OccupancyLevel(pours int, open bool, config *Config) string {
+	switch {
+	case !open:
+		return OccupancyClosed
+	case pours >= config.OccupancyPacked:
+		return OccupancyPacked
+	case pours >= config.OccupancyBusy:
+		return OccupancyBusy
+	case pours > 0:
+		return OccupancyQuiet
+	default:
+		return OccupancyEmpty
+	}
+}
+
+// occupancy returns the occupancy by pours of the scale, caller has to hold the lock
+func (s *Scale) occupancy(now time.Time) Occupancy {
+	pours := s.pours.PoursWithin(now, occupancyWindow)
+	return Occupancy{Level: OccupancyLevel(pours, s.Pub.IsOpen, s.config), Pours: pours}
+}
+
+// Occupancy returns how busy the pub is by recent pours of the scale
+func (s *Scale) Occupancy() Occupancy {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.occupancy(time.Now())
+}
+
+// OccupancyBucket is the number of pours within a quarter of an hour of the session
+type OccupancyBucket struct {
+	At    time.Time `json:"at"` // start of the quarter
+	Pours int       `json:"pours"`
+	Level string    `json:"level"`
+}
+
+// OccupancySession is the occupancy history of a single opening of the pub
+type OccupancySession struct {
+	OpenedAt time.Time         `json:"opened_at"`
+	ClosedAt time.Time         `json:"closed_at"` // now for the running session
+	Weekday  string            `json:"weekday"`   // of the pub day, a Friday night after midnight is still Friday
+	Pours    int               `json:"pours"`
+	Peak     int               `json:"peak"`    // the most pours within a quarter of an hour
+	PeakAt   *time.Time        `json:"peak_at"` // start of the busiest quarter, nil without pours
+	Average  float64           `json:"average"` // pours per quarter of an hour
+	Buckets  []OccupancyBucket `json:"buckets"`
+}
+
+// CalcOccupancySessions splits pours of the pub sessions to quarters of an hour
+// quarters are aligned to the clock, so sessions of different days can be compared quarter by quarter
+func CalcOccupancySessions(sessions []PubSession, pours []Pour, config *Config) []OccupancySession {
+	result := make([]OccupancySession, 0, len(sessions))
+	for _, session := range sessions {
+		occupancy := OccupancySession{
+			OpenedAt: session.OpenedAt,
+			ClosedAt: session.ClosedAt,
+			Weekday:  strings.ToLower(pubDayStart(session.OpenedAt, config.PubDayStart).Weekday().String()),
+			Buckets:  []OccupancyBucket{},
+		}
+
+		index := map[time.Time]int{}
+		for at := session.OpenedAt.Truncate(occupancyWindow); at.Before(session.ClosedAt); at = at.Add(occupancyWindow) {
+			index[at] = len(occupancy.Buckets)
+			occupancy.Buckets = append(occupancy.Buckets, OccupancyBucket{At: at})
+		}
+		for _, pour := range pours {
+			if i, found := index[pour.At.Truncate(occupancyWindow)]; found && !pour.At.Before(session.OpenedAt) && !pour.At.After(session.ClosedAt) {
+				occupancy.Buckets[i].Pours++
+				occupancy.Pours++
+			}
+		}
+
+		for i, bucket := range occupancy.Buckets {
+			occupancy.Buckets[i].Level = OccupancyLevel(bucket.Pours, true, config)
+			if bucket.Pours > occupancy.Peak {
+				occupancy.Peak = bucket.Pours
+				occupancy.PeakAt = &occupancy.Buckets[i].At
+			}
+		}
+		if len(occupancy.Buckets) > 0 {
+			occupancy.Average = math.Round(float64(occupancy.Pours)/float64(len(occupancy.Buckets))*10) / 10
+		}
+		result = append(result, occupancy)
+	}
+
+	return result
+}
+
+// GetOccupancyHistory returns occupancy of pub sessions of the last days, the running one included
+// weekday filters sessions of a single pub day (friday), empty returns all of them
+func GetOccupancyHistory(s *Scale, days int, weekday string, now time.Time) ([]OccupancySession, error) {
+	from := pubDayStart(now, s.config.PubDayStart).AddDate(0, 0, -days+1)
+
+	sessions, err := s.store.GetPubSessions(from, now)
+	if err != nil {
+		return nil, fmt.Errorf("could not load pub sessions: %w", err)
+	}
+	s.mux.Lock()
+	if s.Pub.IsOpen {
+		sessions = append(sessions, PubSession{OpenedAt: s.Pub.OpenedAt, ClosedAt: now})
+	}
+	s.mux.Unlock()
+
+	pours, err := s.store.GetPours(from, now)
+	if err != nil {
+		return nil, fmt.Errorf("could not load pours: %w", err)
+	}
+
+	history := []OccupancySession{}
+	for _, session := range CalcOccupancySessions(sessions, pours, s.config) {
+		if weekday == "" || session.Weekday == weekday {
+			history = append(history, session)
+		}
+	}
+
+	return history, nil
+}
+
+// parseWeekday returns the lowercase english name of the day, empty for empty input
+func parseWeekday(raw string) (string, error) {
+	raw = strings.ToLower(strings.TrimSpace(raw))
+	if raw == "" {
+		return "", nil
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if name := strings.ToLower(day.String()); name == raw {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown weekday %q", raw)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOccupancyLevel(t *testing.T) {
+	config := NewConfig()
+	assert.Equal(t, OccupancyClosed, OccupancyLevel(12, false, config))
+	assert.Equal(t, OccupancyEmpty, OccupancyLevel(0, true, config))
+	assert.Equal(t, OccupancyQuiet, OccupancyLevel(3, true, config))
+	assert.Equal(t, OccupancyBusy, OccupancyLevel(4, true, config))
+	assert.Equal(t, OccupancyPacked, OccupancyLevel(10, true, config))
+}
+
+func TestScale_Occupancy(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	now := time.Now()
+	s.Pub.IsOpen = true
+	s.pours.finishedAt = []time.Time{now.Add(-40 * time.Minute), now.Add(-10 * time.Minute), now.Add(-5 * time.Minute), now.Add(-4 * time.Minute), now.Add(-time.Minute)}
+
+	assert.Equal(t, Occupancy{Level: OccupancyBusy, Pours: 4}, s.Occupancy())
+	assert.Equal(t, 5, s.PoursPerHour())
+}
+
+func TestCalcOccupancySessions(t *testing.T) {
+	config := NewConfig()
+	config.PubDayStart = 6
+	friday := time.Date(2024, 5, 3, 18, 5, 0, 0, getTz())
+	pours := []Pour{}
+	for _, minutes := range []int{5, 15, 20, 23, 35, 105, 170} {
+		pours = append(pours, Pour{At: friday.Add(time.Duration(minutes) * time.Minute)})
+	}
+	sessions := []PubSession{
+		{OpenedAt: friday, ClosedAt: friday.Add(2 * time.Hour)},
+		{OpenedAt: friday.Add(7 * time.Hour), ClosedAt: friday.Add(8 * time.Hour)}, // 01:05 on Saturday
+	}
+
+	occupancy := CalcOccupancySessions(sessions, pours, config)
+	assert.Len(t, occupancy, 2)
+	first := occupancy[0]
+	assert.Equal(t, "friday", first.Weekday)
+	assert.Len(t, first.Buckets, 9, "18:00 to 20:00")
+	assert.True(t, first.Buckets[0].At.Equal(time.Date(2024, 5, 3, 18, 0, 0, 0, getTz())))
+	assert.Equal(t, []int{1, 3, 1, 0, 0, 0, 0, 1, 0}, func() []int {
+		pours := []int{}
+		for _, bucket := range first.Buckets {
+			pours = append(pours, bucket.Pours)
+		}
+		return pours
+	}())
+	assert.Equal(t, 6, first.Pours, "the pour after closing is not counted")
+	assert.Equal(t, 3, first.Peak)
+	assert.True(t, first.PeakAt.Equal(time.Date(2024, 5, 3, 18, 15, 0, 0, getTz())))
+	assert.Equal(t, 0.7, first.Average)
+	assert.Equal(t, OccupancyQuiet, first.Buckets[1].Level)
+
+	assert.Equal(t, "friday", occupancy[1].Weekday, "after midnight it's still the Friday night")
+	assert.Nil(t, occupancy[1].PeakAt)
+}
+
+func TestHandlerRepository_OccupancyStats(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	hr := &HandlerRepository{scale: s, config: s.config, monitor: s.monitor, logger: s.logger}
+	now := time.Now()
+	for day := 1; day <= 14; day++ {
+		opened := now.AddDate(0, 0, -day).Add(-time.Hour)
+		assert.Nil(t, s.store.AddPubSession(PubSession{OpenedAt: opened, ClosedAt: opened.Add(time.Hour)}))
+	}
+	weekday := pubDayStart(now.AddDate(0, 0, -7).Add(-time.Hour), s.config.PubDayStart).Weekday().String()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		hr.occupancyStatsHandler()(w, httptest.NewRequest(http.MethodGet, "/api/stats/occupancy?"+query, nil))
+		return w
+	}
+
+	w := get("days=28&weekday=" + weekday)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var history []OccupancySession
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 2, "the same day of the last two weeks")
+
+	assert.Equal(t, http.StatusBadRequest, get("weekday=funday").Code)
+	assert.Equal(t, http.StatusBadRequest, get("days=0").Code)
+}
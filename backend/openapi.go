@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OpenApiVersion is the version of the documented API, bump it when a documented payload changes incompatibly
+const OpenApiVersion = "1.0.0"
+
+// ApiParam is a query parameter of the operation
+type ApiParam struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// ApiOperation documents a single method of the route
+// Request and Response are sample values, their schemas are generated from the Go types,
+// so the specification follows the payloads the handlers actually marshal
+type ApiOperation struct {
+	Summary     string
+	Auth        bool // requires the admin password in the Authorization header
+	DeviceAuth  bool // signed by the device, see VerifyScaleSignature
+	Query       []ApiParam
+	Request     any    // nil without a JSON body
+	RequestText string // description of a text/plain body, e.g. the scale message
+	Response    any    // nil for a plain text response
+}
+
+var deviceParam = ApiParam{Name: "device", Description: "id of the scale, empty is the default scale"}
+
+// apiDocs documents the routes used by the frontend and the firmware, path => method => operation
+// every path has to be registered in the router, it's checked by tests
+var apiDocs = map[string]map[string]ApiOperation{
+	"/api/scale/push": {
+		http.MethodPost: {
+			Summary:     "Scale message sent by the device",
+			DeviceAuth:  true,
+			RequestText: "message in the format of the firmware, see ParseScaleMessage",
+		},
+	},
+	"/api/scale/batch": {
+		http.MethodPost: {
+			Summary:     "Messages buffered by the device while it was offline",
+			DeviceAuth:  true,
+			RequestText: "lines `<unix ms>|<message>`, or JSON [{\"at\": ..., \"message\": ...}] with Content-Type application/json",
+			Response:    BatchResult{},
+		},
+	},
+	"/api/firmware": {
+		http.MethodGet: {
+			Summary:  "Latest firmware of the scale for the OTA update, the push response has the X-Firmware-Update header if the scale runs an older one",
+			Response: FirmwareRelease{},
+		},
+		http.MethodPost: {
+			Summary:  "Publish the latest firmware",
+			Auth:     true,
+			Request:  FirmwareRelease{},
+			Response: FirmwareRelease{},
+		},
+	},
+	"/api/scale/status": {
+		http.MethodGet: {
+			Summary: "Raw state of the scale",
+			Query: []ApiParam{
+				deviceParam,
+				{Name: "at", Description: "RFC 3339 time, the state is reconstructed from the history"},
+			},
+			Response: ScaleStatus{},
+		},
+	},
+	"/api/scale/dashboard": {
+		http.MethodGet: {
+			Summary: "State of the scale formatted for the dashboard, localized by Accept-Language",
+			Query: []ApiParam{
+				deviceParam,
+				{Name: "include", Description: "optional sections separated by comma: keg, session, forecast, device"},
+			},
+			Response: Dashboard{},
+		},
+	},
+	"/api/scale/measurements": {
+		http.MethodPost: {
+			Summary: "Add a manual measurement",
+			Auth:    true,
+			Request: struct {
+				Weight float64 `json:"weight"` // grams
+			}{},
+			Response: map[string]string{},
+		},
+	},
+	"/api/measurements": {
+		http.MethodGet: {
+			Summary: "Measurement history, optionally downsampled",
+			Query: []ApiParam{
+				{Name: "from", Description: "RFC 3339, a day before to by default"},
+				{Name: "to", Description: "RFC 3339, now by default"},
+				{Name: "resolution", Description: "bucket duration, e.g. 5m, raw measurements without it"},
+			},
+			Response: MeasurementHistory{},
+		},
+	},
+	"/api/kegs": {
+		http.MethodGet: {
+			Summary:  "All kegs with their ratings, the newest first",
+			Response: []BeerHistoryItem{},
+		},
+	},
+	"/api/kegs/{id}/archive": {
+		http.MethodGet: {
+			Summary:  "Everything known about the keg",
+			Response: KegArchive{},
+		},
+	},
+}
+
+// BuildOpenApi returns the OpenAPI 3.1 specification of the documented routes of the router
+func BuildOpenApi(router *mux.Router) (map[string]any, error) {
+	registered := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if path, err := route.GetPathTemplate(); err == nil {
+			registered[path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	generator := &schemaGenerator{components: map[string]any{}}
+	paths := map[string]any{}
+	for path, methods := range apiDocs {
+		if !registered[path] {
+			return nil, fmt.Errorf("documented path %s is not registered", path)
+		}
+
+		item := map[string]any{}
+		for method, op := range methods {
+			item[strings.ToLower(method)] = generator.operation(path, op)
+		}
+		paths[path] = item
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":   "Keg scale API",
+			"version": OpenApiVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": generator.components,
+			"securitySchemes": map[string]any{
+				"password":  map[string]any{"type": "apiKey", "in": "header", "name": "Authorization"},
+				"signature": map[string]any{"type": "apiKey", "in": "header", "name": ScaleSignatureHeader},
+				"token":     map[string]any{"type": "apiKey", "in": "header", "name": "Authorization"},
+			},
+		},
+	}, nil
+}
+
+// schemaGenerator converts Go types to JSON schemas, named structs are shared as components
+type schemaGenerator struct {
+	components map[string]any
+}
+
+func (g *schemaGenerator) operation(path string, op ApiOperation) map[string]any {
+	operation := map[string]any{"summary": op.Summary}
+
+	params := []any{}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params = append(params, map[string]any{
+				"name": strings.Trim(segment, "{}"), "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+	}
+	for _, param := range op.Query {
+		params = append(params, map[string]any{
+			"name": param.Name, "in": "query", "required": param.Required, "description": param.Description, "schema": map[string]any{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		operation["parameters"] = params
+	}
+
+	if op.Auth {
+		operation["security"] = []any{map[string]any{"password": []string{}}}
+	}
+	if op.DeviceAuth {
+		// the token is accepted only with SCALE_TOKEN_AUTH, a client certificate of the ingest port works too
+		operation["security"] = []any{map[string]any{"signature": []string{}}, map[string]any{"token": []string{}}}
+	}
+
+	if op.Request != nil {
+		operation["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(op.Request))}},
+		}
+	} else if op.RequestText != "" {
+		operation["requestBody"] = map[string]any{
+			"required":    true,
+			"description": op.RequestText,
+			"content":     map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}},
+		}
+	}
+
+	response := map[string]any{"description": "OK"}
+	if op.Response != nil {
+		response["content"] = map[string]any{"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(op.Response))}}
+	} else {
+		response["content"] = map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}}
+	}
+	operation["responses"] = map[string]any{"200": response}
+
+	return operation
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the JSON schema of values of the type marshaled by encoding/json
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return map[string]any{"anyOf": []any{g.schema(t.Elem()), map[string]any{"type": "null"}}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": []string{"array", "null"}, "items": g.schema(t.Elem())}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, found := g.components[t.Name()]; !found {
+			g.components[t.Name()] = map[string]any{} // placeholder for recursive types
+			g.components[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{} // any value
+	}
+}
+
+// object returns the schema of the struct, embedded structs are flattened like by encoding/json
+func (g *schemaGenerator) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				collect(field.Type)
+				continue
+			}
+			if !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			properties[name] = g.schema(field.Type)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	collect(t)
+
+	sort.Strings(required)
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
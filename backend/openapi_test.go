@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenApi(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	hr := &HandlerRepository{scale: s, config: s.config, monitor: s.monitor, logger: s.logger}
+
+	w := httptest.NewRecorder()
+	NewRouter(hr).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var spec struct {
+		OpenApi    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any `json:"properties"`
+				Required   []string                  `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, "3.1.0", spec.OpenApi)
+	assert.Len(t, spec.Paths, len(apiDocs), "every documented route is registered")
+	assert.Contains(t, spec.Paths["/api/scale/dashboard"], "get")
+	assert.Contains(t, spec.Paths["/api/scale/push"]["post"], "security")
+
+	status := spec.Components.Schemas["ScaleStatus"]
+	assert.Equal(t, "date-time", status.Properties["last_weight_at"]["format"])
+	assert.Contains(t, status.Required, "active_keg")
+
+	// embedded keg info is flattened like by encoding/json
+	keg := spec.Components.Schemas["BeerHistoryItem"]
+	assert.Contains(t, keg.Properties, "tapped_at")
+	assert.Contains(t, keg.Properties, "ratings")
+	assert.NotContains(t, keg.Required, "model", "omitempty is optional")
+}
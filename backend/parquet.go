@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Minimal Parquet writer
+// It supports only flat schemas with required columns, a single row group,
+// PLAIN encoding and no compression, which is all we need for exports.
+// Specification: https://github.com/apache/parquet-format
+
+const parquetMagic = "PAR1"
+
+// ParquetType is a physical type of the column
+type ParquetType int32
+
+const (
+	ParquetInt64     ParquetType = 2
+	ParquetDouble    ParquetType = 5
+	ParquetByteArray ParquetType = 6
+)
+
+// converted (logical) types
+const (
+	parquetConvertedNone            = -1
+	parquetConvertedUtf8            = 0
+	parquetConvertedTimestampMillis = 9
+)
+
+// ParquetColumn is a single column of the file
+// Values has to be []int64, []float64 or []string depending on the Type
+type ParquetColumn struct {
+	Name      string
+	Type      ParquetType
+	Timestamp bool // int64 column contains unix milliseconds
+	Values    any
+}
+
+func (c ParquetColumn) len() int {
+	switch v := c.Values.(type) {
+	case []int64:
+		return len(v)
+	case []float64:
+		return len(v)
+	case []string:
+		return len(v)
+	}
+
+	return 0
+}
+
+func (c ParquetColumn) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	switch v := c.Values.(type) {
+	case []int64:
+		if c.Type != ParquetInt64 {
+			return nil, fmt.Errorf("column %s: int64 values for non int64 column", c.Name)
+		}
+		for _, x := range v {
+			_ = binary.Write(&buf, binary.LittleEndian, x)
+		}
+	case []float64:
+		if c.Type != ParquetDouble {
+			return nil, fmt.Errorf("column %s: float64 values for non double column", c.Name)
+		}
+		for _, x := range v {
+			_ = binary.Write(&buf, binary.LittleEndian, math.Float64bits(x))
+		}
+	case []string:
+		if c.Type != ParquetByteArray {
+			return nil, fmt.Errorf("column %s: string values for non byte array column", c.Name)
+		}
+		for _, x := range v {
+			_ = binary.Write(&buf, binary.LittleEndian, uint32(len(x)))
+			buf.WriteString(x)
+		}
+	default:
+		return nil, fmt.Errorf("column %s: unsupported values type %T", c.Name, c.Values)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c ParquetColumn) convertedType() int32 {
+	if c.Type == ParquetInt64 && c.Timestamp {
+		return parquetConvertedTimestampMillis
+	}
+	if c.Type == ParquetByteArray {
+		return parquetConvertedUtf8
+	}
+
+	return parquetConvertedNone
+}
+
+// WriteParquet writes columns as a single row group Parquet file
+// All columns must have the same number of values
+func WriteParquet(w io.Writer, columns []ParquetColumn) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("no columns to write")
+	}
+
+	rows := columns[0].len()
+	for _, c := range columns {
+		if c.len() != rows {
+			return fmt.Errorf("column %s has %d values, expected %d", c.Name, c.len(), rows)
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString(parquetMagic)
+
+	type chunk struct {
+		offset int64
+		size   int64
+	}
+	chunks := make([]chunk, 0, len(columns))
+	var totalSize int64
+
+	for _, c := range columns {
+		data, err := c.encode()
+		if err != nil {
+			return err
+		}
+
+		// page header
+		header := &thriftWriter{}
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.beginStruct(5) // data page header
+		header.i32(1, int32(rows))
+		header.i32(2, 0) // PLAIN
+		header.i32(3, 3) // RLE
+		header.i32(4, 3) // RLE
+		header.endStruct()
+		header.stop()
+
+		offset := int64(file.Len())
+		file.Write(header.Bytes())
+		file.Write(data)
+
+		size := int64(file.Len()) - offset
+		chunks = append(chunks, chunk{offset: offset, size: size})
+		totalSize += size
+	}
+
+	// file metadata
+	meta := &thriftWriter{}
+	meta.i32(1, 1) // version
+
+	meta.listBegin(2, thriftStruct, len(columns)+1) // schema
+	meta.structElemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.structElemEnd()
+	for _, c := range columns {
+		meta.structElemBegin()
+		meta.i32(1, int32(c.Type))
+		meta.i32(3, 0) // REQUIRED
+		meta.binary(4, c.Name)
+		if ct := c.convertedType(); ct != parquetConvertedNone {
+			meta.i32(6, ct)
+		}
+		meta.structElemEnd()
+	}
+
+	meta.i64(3, int64(rows))
+
+	meta.listBegin(4, thriftStruct, 1) // row groups
+	meta.structElemBegin()
+	meta.listBegin(1, thriftStruct, len(columns))
+	for i, c := range columns {
+		meta.structElemBegin()
+		meta.i64(2, chunks[i].offset)
+		meta.beginStruct(3) // column metadata
+		meta.i32(1, int32(c.Type))
+		meta.listI32(2, []int32{0})
+		meta.listBinary(3, []string{c.Name})
+		meta.i32(4, 0) // UNCOMPRESSED
+		meta.i64(5, int64(rows))
+		meta.i64(6, chunks[i].size)
+		meta.i64(7, chunks[i].size)
+		meta.i64(9, chunks[i].offset)
+		meta.endStruct()
+		meta.structElemEnd()
+	}
+	meta.i64(2, totalSize)
+	meta.i64(3, int64(rows))
+	meta.structElemEnd()
+
+	meta.binary(6, "keg-scale")
+	meta.stop()
+
+	file.Write(meta.Bytes())
+	_ = binary.Write(&file, binary.LittleEndian, uint32(len(meta.Bytes())))
+	file.WriteString(parquetMagic)
+
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter implements subset of the Thrift compact protocol used by Parquet metadata
+type thriftWriter struct {
+	bytes.Buffer
+	lastField []int16
+	field     int16
+}
+
+func (t *thriftWriter) varint(x uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], x)
+	t.Write(b[:n])
+}
+
+func (t *thriftWriter) zigzag(x int64) {
+	t.varint(uint64((x << 1) ^ (x >> 63)))
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	delta := id - t.field
+	if delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	t.field = id
+}
+
+func (t *thriftWriter) i32(id int16, x int32) {
+	t.fieldHeader(id, thriftI32)
+	t.zigzag(int64(x))
+}
+
+func (t *thriftWriter) i64(id int16, x int64) {
+	t.fieldHeader(id, thriftI64)
+	t.zigzag(x)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.varint(uint64(len(s)))
+	t.WriteString(s)
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.fieldHeader(id, thriftList)
+	if size < 15 {
+		t.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.WriteByte(0xf0 | elemType)
+		t.varint(uint64(size))
+	}
+}
+
+func (t *thriftWriter) listI32(id int16, values []int32) {
+	t.listBegin(id, thriftI32, len(values))
+	for _, x := range values {
+		t.zigzag(int64(x))
+	}
+}
+
+func (t *thriftWriter) listBinary(id int16, values []string) {
+	t.listBegin(id, thriftBinary, len(values))
+	for _, s := range values {
+		t.varint(uint64(len(s)))
+		t.WriteString(s)
+	}
+}
+
+// beginStruct starts a struct field
+func (t *thriftWriter) beginStruct(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.structElemBegin()
+}
+
+func (t *thriftWriter) endStruct() {
+	t.structElemEnd()
+}
+
+// structElemBegin starts a struct without field header (list element)
+func (t *thriftWriter) structElemBegin() {
+	t.lastField = append(t.lastField, t.field)
+	t.field = 0
+}
+
+func (t *thriftWriter) structElemEnd() {
+	t.stop()
+	t.field = t.lastField[len(t.lastField)-1]
+	t.lastField = t.lastField[:len(t.lastField)-1]
+}
+
+func (t *thriftWriter) stop() {
+	t.WriteByte(0)
+}
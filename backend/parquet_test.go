@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteParquet(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteParquet(&buf, []ParquetColumn{
+		{Name: "at", Type: ParquetInt64, Timestamp: true, Values: []int64{1, 2, 3}},
+		{Name: "weight", Type: ParquetDouble, Values: []float64{1.5, 2.5, 3.5}},
+		{Name: "kind", Type: ParquetByteArray, Values: []string{"a", "b", "c"}},
+	})
+	assert.Nil(t, err)
+
+	data := buf.Bytes()
+	assert.Equal(t, parquetMagic, string(data[:4]))
+	assert.Equal(t, parquetMagic, string(data[len(data)-4:]))
+
+	footer := binary.LittleEndian.Uint32(data[len(data)-8 : len(data)-4])
+	assert.Less(t, int(footer), len(data)-12)
+}
+
+// thriftFields is a decoded struct of the Thrift compact protocol by field ids
+type thriftFields map[int16]any
+
+// thriftReader decodes the Thrift compact protocol independently of [thriftWriter]
+// i32 and i64 are decoded to int32 and int64, so assertions check the wire types too
+type thriftReader struct {
+	t    *testing.T
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) varint() uint64 {
+	x, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.t.Fatalf("invalid varint at %d", r.pos)
+	}
+	r.pos += n
+	return x
+}
+
+func (r *thriftReader) zigzag() int64 {
+	x := r.varint()
+	return int64(x>>1) ^ -int64(x&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32:
+		return int32(r.zigzag())
+	case thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		size := int(r.varint())
+		s := string(r.data[r.pos : r.pos+size])
+		r.pos += size
+		return s
+	case thriftList:
+		header := r.data[r.pos]
+		r.pos++
+		size, elemType := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.varint())
+		}
+		values := make([]any, size)
+		for i := range values {
+			values[i] = r.value(elemType)
+		}
+		return values
+	case thriftStruct:
+		return r.readStruct()
+	}
+
+	r.t.Fatalf("unsupported thrift type %d at %d", typ, r.pos)
+	return nil
+}
+
+func (r *thriftReader) readStruct() thriftFields {
+	s := thriftFields{}
+	field := int16(0)
+	for {
+		header := r.data[r.pos]
+		r.pos++
+		if header == 0 {
+			return s
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			field += delta
+		} else {
+			field = int16(r.zigzag())
+		}
+		s[field] = r.value(header & 0x0f)
+	}
+}
+
+// the footer is decoded by the field ids of parquet.thrift, a wrong id or type makes the file unreadable by other tools
+func TestWriteParquet_Metadata(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteParquet(&buf, []ParquetColumn{
+		{Name: "at", Type: ParquetInt64, Timestamp: true, Values: []int64{1, 2, 3}},
+		{Name: "weight", Type: ParquetDouble, Values: []float64{1.5, 2.5, 3.5}},
+		{Name: "kind", Type: ParquetByteArray, Values: []string{"a", "bc", ""}},
+	})
+	assert.Nil(t, err)
+	data := buf.Bytes()
+	footer := int(binary.LittleEndian.Uint32(data[len(data)-8 : len(data)-4]))
+	reader := &thriftReader{t: t, data: data, pos: len(data) - 8 - footer}
+
+	meta := reader.readStruct() // FileMetaData
+	assert.Equal(t, len(data)-8, reader.pos, "the footer length covers the whole metadata")
+	assert.Equal(t, int32(1), meta[1], "version")
+	assert.Equal(t, int64(3), meta[3], "num_rows")
+	assert.Equal(t, "keg-scale", meta[6], "created_by")
+
+	schema := meta[2].([]any)
+	assert.Len(t, schema, 4)
+	assert.Equal(t, thriftFields{4: "schema", 5: int32(3)}, schema[0], "root with num_children")
+	assert.Equal(t, thriftFields{1: int32(ParquetInt64), 3: int32(0), 4: "at", 6: int32(parquetConvertedTimestampMillis)}, schema[1])
+	assert.Equal(t, thriftFields{1: int32(ParquetDouble), 3: int32(0), 4: "weight"}, schema[2])
+	assert.Equal(t, thriftFields{1: int32(ParquetByteArray), 3: int32(0), 4: "kind", 6: int32(parquetConvertedUtf8)}, schema[3])
+
+	rowGroups := meta[4].([]any)
+	assert.Len(t, rowGroups, 1)
+	rowGroup := rowGroups[0].(thriftFields)
+	assert.Equal(t, int64(3), rowGroup[3], "num_rows")
+
+	expected := []struct {
+		name   string
+		typ    ParquetType
+		values []byte
+	}{
+		{"at", ParquetInt64, binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, 1), 2), 3)},
+		{"weight", ParquetDouble, binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(binary.LittleEndian.AppendUint64(nil, math.Float64bits(1.5)), math.Float64bits(2.5)), math.Float64bits(3.5))},
+		{"kind", ParquetByteArray, []byte("\x01\x00\x00\x00a\x02\x00\x00\x00bc\x00\x00\x00\x00")},
+	}
+	columns := rowGroup[1].([]any)
+	assert.Len(t, columns, len(expected))
+	totalSize := int64(0)
+	for i, column := range columns {
+		chunk := column.(thriftFields)
+		columnMeta := chunk[3].(thriftFields)
+		assert.Equal(t, int32(expected[i].typ), columnMeta[1], "type")
+		assert.Equal(t, []any{int32(0)}, columnMeta[2], "PLAIN encoding")
+		assert.Equal(t, []any{expected[i].name}, columnMeta[3], "path_in_schema")
+		assert.Equal(t, int32(0), columnMeta[4], "UNCOMPRESSED")
+		assert.Equal(t, int64(3), columnMeta[5], "num_values")
+		assert.Equal(t, chunk[2], columnMeta[9], "file_offset is the data page")
+
+		// the data page starts at the offset and the chunk ends with its values
+		offset := columnMeta[9].(int64)
+		size := columnMeta[7].(int64)
+		assert.Equal(t, size, columnMeta[6])
+		page := &thriftReader{t: t, data: data, pos: int(offset)}
+		header := page.readStruct() // PageHeader
+		assert.Equal(t, int32(0), header[1], "DATA_PAGE")
+		assert.Equal(t, int32(len(expected[i].values)), header[2])
+		assert.Equal(t, int32(len(expected[i].values)), header[3])
+		assert.Equal(t, thriftFields{1: int32(3), 2: int32(0), 3: int32(3), 4: int32(3)}, header[5])
+		assert.Equal(t, expected[i].values, data[page.pos:offset+size], expected[i].name)
+		totalSize += size
+	}
+	assert.Equal(t, totalSize, rowGroup[2], "total_byte_size")
+}
+
+func TestWriteParquet_InvalidColumns(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteParquet(&buf, []ParquetColumn{
+		{Name: "at", Type: ParquetInt64, Values: []int64{1, 2, 3}},
+		{Name: "weight", Type: ParquetDouble, Values: []float64{1.5}},
+	})
+	assert.NotNil(t, err)
+
+	err = WriteParquet(&buf, []ParquetColumn{
+		{Name: "weight", Type: ParquetInt64, Values: []float64{1.5}},
+	})
+	assert.NotNil(t, err)
+}
@@ -1,25 +1,62 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	PingMessageType = "ping"
-	PushMessageType = "push"
+	PingMessageType   = "ping"
+	PushMessageType   = "push"
+	ConfigMessageType = "config"
+	RawMessageType    = "raw" // value contains raw HX711 counts converted by the server
 )
 
+// firmwareVersionPattern is a semantic version without pre-release and build parts
+var firmwareVersionPattern = regexp.MustCompile(`^\d{1,4}\.\d{1,4}\.\d{1,4}$`)
+
+// accepted sensor readings, a disconnected DS18B20 reads -127 °C
+const (
+	minTemperature = -55.0
+	maxTemperature = 125.0
+	maxBattery     = 30.0
+)
+
+// deviceIdPattern starts with a letter, so the device id can't be mistaken for the numeric message id
+var deviceIdPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// limits of a batch of buffered messages
+const (
+	maxBatchMessages = 5000
+	maxBatchBody     = 256 << 10
+)
+
+// BatchEntry is a message buffered by the device while it was offline
+type BatchEntry struct {
+	At      time.Time // when the device measured the value
+	Message ScaleMessage
+}
+
 type ScaleMessage struct {
 	MessageType string
+	Device      string // id of the scale, empty for the default one (single-scale firmware)
 	MessageId   uint64 // arduino counter
 	Rssi        float64
 	Value       float64
+	Config      map[string]string // reported device configuration - only in config message
+	Firmware    string            // firmware version of the device, empty if not reported
+	Sensors     Sensors           // temperature and battery of the newer hardware
 }
 
 // ParseScaleMessage parses a message from the scale
 // String format: messageType|messageId|rssi|value
+// or messageType|device|messageId|rssi|value when more scales are connected
+// Config message carries key=value pairs separated by comma in the value field
+// optional fields follow the value: |fw=version|t=celsius|bat=volts, in any order
 func ParseScaleMessage(message string) (ScaleMessage, error) {
 	chunks := strings.Split(message, "|")
 	if len(chunks) < 4 {
@@ -27,10 +64,20 @@ func ParseScaleMessage(message string) (ScaleMessage, error) {
 	}
 
 	messageType := chunks[0]
-	if messageType != PingMessageType && messageType != PushMessageType {
+	if messageType != PingMessageType && messageType != PushMessageType && messageType != ConfigMessageType && messageType != RawMessageType {
 		return ScaleMessage{}, fmt.Errorf("invalid request type")
 	}
 
+	// message id is a number, anything else at its place is the device id
+	device := ""
+	if _, err := strconv.ParseUint(chunks[1], 10, 64); err != nil && len(chunks) >= 5 {
+		device = chunks[1]
+		if !deviceIdPattern.MatchString(device) {
+			return ScaleMessage{}, fmt.Errorf("invalid device id")
+		}
+		chunks = append(chunks[:1], chunks[2:]...)
+	}
+
 	requestId, err := strconv.ParseUint(chunks[1], 10, 64)
 	if err != nil {
 		return ScaleMessage{}, fmt.Errorf("could not parse request id")
@@ -42,19 +89,139 @@ func ParseScaleMessage(message string) (ScaleMessage, error) {
 		return ScaleMessage{}, fmt.Errorf("could not parse rssi")
 	}
 
-	// value is only in push message
+	// value is only in push and raw messages
 	value := 0.0
-	if messageType == PushMessageType {
+	if messageType == PushMessageType || messageType == RawMessageType {
 		value, err = strconv.ParseFloat(chunks[3], 64)
 		if err != nil {
 			return ScaleMessage{}, fmt.Errorf("could not parse value")
 		}
 	}
 
+	// config is only in config message
+	var config map[string]string
+	if messageType == ConfigMessageType {
+		config, err = ParseReportedConfig(chunks[3])
+		if err != nil {
+			return ScaleMessage{}, fmt.Errorf("could not parse config")
+		}
+	}
+
+	// fields after the value were ignored by older servers, so the firmware can add them
+	// unknown fields are ignored as well, so older servers keep working with newer firmware
+	firmware := ""
+	var sensors Sensors
+	for _, field := range chunks[min(len(chunks), 4):] {
+		key, raw, _ := strings.Cut(field, "=")
+		switch key {
+		case "fw":
+			if !firmwareVersionPattern.MatchString(raw) {
+				return ScaleMessage{}, fmt.Errorf("invalid firmware version")
+			}
+			firmware = raw
+		case "t":
+			// a broken sensor must not drop the weight, the reading is just missing
+			if temperature, err := strconv.ParseFloat(raw, 64); err == nil && temperature >= minTemperature && temperature <= maxTemperature {
+				sensors.Temperature = &temperature
+			}
+		case "bat":
+			if battery, err := strconv.ParseFloat(raw, 64); err == nil && battery > 0 && battery <= maxBattery {
+				sensors.Battery = &battery
+			}
+		}
+	}
+
 	return ScaleMessage{
 		MessageId:   requestId,
 		MessageType: messageType,
+		Device:      device,
 		Rssi:        rssi,
 		Value:       value,
+		Config:      config,
+		Firmware:    firmware,
+		Sensors:     sensors,
 	}, nil
 }
+
+// FormatScaleMessage formats the message in the pipe-delimited format parsed by [ParseScaleMessage]
+// messages of other transports (gRPC) are formatted, so they are captured, mirrored and deduplicated the same way
+func FormatScaleMessage(message ScaleMessage) string {
+	chunks := []string{message.MessageType}
+	if message.Device != "" {
+		chunks = append(chunks, message.Device)
+	}
+	chunks = append(chunks, strconv.FormatUint(message.MessageId, 10), strconv.FormatFloat(message.Rssi, 'f', -1, 64))
+
+	switch message.MessageType {
+	case PushMessageType, RawMessageType:
+		chunks = append(chunks, strconv.FormatFloat(message.Value, 'f', -1, 64))
+	case ConfigMessageType:
+		chunks = append(chunks, FormatConfig(message.Config))
+	default:
+		chunks = append(chunks, "")
+	}
+
+	if message.Firmware != "" {
+		chunks = append(chunks, "fw="+message.Firmware)
+	}
+	if message.Sensors.Temperature != nil {
+		chunks = append(chunks, "t="+strconv.FormatFloat(*message.Sensors.Temperature, 'f', -1, 64))
+	}
+	if message.Sensors.Battery != nil {
+		chunks = append(chunks, "bat="+strconv.FormatFloat(*message.Sensors.Battery, 'f', -1, 64))
+	}
+
+	return strings.Join(chunks, "|")
+}
+
+// ParseScaleBatch parses messages buffered by the device
+// Text format is one message per line prefixed by its unix timestamp: timestamp|messageType|messageId|rssi|value
+// JSON format is an array of {"at": timestamp, "message": "messageType|messageId|rssi|value"}
+// all messages have to come from the same device
+func ParseScaleBatch(body []byte, isJson bool) ([]BatchEntry, error) {
+	type line struct {
+		At      int64  `json:"at"`
+		Message string `json:"message"`
+	}
+
+	var lines []line
+	if isJson {
+		if err := json.Unmarshal(body, &lines); err != nil {
+			return nil, fmt.Errorf("invalid JSON batch: %w", err)
+		}
+	} else {
+		for i, raw := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+			raw = strings.TrimSpace(raw)
+			if raw == "" {
+				continue
+			}
+			timestamp, message, found := strings.Cut(raw, "|")
+			at, err := strconv.ParseInt(timestamp, 10, 64)
+			if !found || err != nil {
+				return nil, fmt.Errorf("line %d: could not parse timestamp", i+1)
+			}
+			lines = append(lines, line{At: at, Message: message})
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("batch is empty")
+	}
+	if len(lines) > maxBatchMessages {
+		return nil, fmt.Errorf("batch has more than %d messages", maxBatchMessages)
+	}
+
+	entries := make([]BatchEntry, 0, len(lines))
+	for i, l := range lines {
+		message, err := ParseScaleMessage(l.Message)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		if len(entries) > 0 && message.Device != entries[0].Message.Device {
+			return nil, fmt.Errorf("message %d: batch contains messages of more devices", i+1)
+		}
+		entries = append(entries, BatchEntry{At: time.Unix(l.At, 0), Message: message})
+	}
+
+	return entries, nil
+}
@@ -1,6 +1,12 @@
 package main
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestScale_ParseScaleMessage(t *testing.T) {
 	type testcases struct {
@@ -9,11 +15,19 @@ func TestScale_ParseScaleMessage(t *testing.T) {
 	}
 
 	tests := []testcases{
-		{"push|2887417|-74.7|1923.23", ScaleMessage{"push", 2887417, -74.7, 1923.23}},
-		{"push|2887417|-74.7|1923.23|", ScaleMessage{"push", 2887417, -74.7, 1923.23}}, // extra pipe
-		{"ping|2887417|-74.7|", ScaleMessage{"ping", 2887417, -74.7, 0}},
-		{"ping|2887417|-74.7||", ScaleMessage{"ping", 2887417, -74.7, 0}},   // extra pipe
-		{"push|471|-74.7|-47.25", ScaleMessage{"push", 471, -74.7, -47.25}}, // negative value
+		{"push|2887417|-74.7|1923.23", ScaleMessage{MessageType: "push", MessageId: 2887417, Rssi: -74.7, Value: 1923.23}},
+		{"push|2887417|-74.7|1923.23|", ScaleMessage{MessageType: "push", MessageId: 2887417, Rssi: -74.7, Value: 1923.23}}, // extra pipe
+		{"ping|2887417|-74.7|", ScaleMessage{MessageType: "ping", MessageId: 2887417, Rssi: -74.7, Value: 0}},
+		{"ping|2887417|-74.7||", ScaleMessage{MessageType: "ping", MessageId: 2887417, Rssi: -74.7, Value: 0}},   // extra pipe
+		{"push|471|-74.7|-47.25", ScaleMessage{MessageType: "push", MessageId: 471, Rssi: -74.7, Value: -47.25}}, // negative value
+		{"raw|472|-74.7|8818608", ScaleMessage{MessageType: "raw", MessageId: 472, Rssi: -74.7, Value: 8818608}}, // raw counts
+		{"push|tap2|473|-61|20500", ScaleMessage{MessageType: "push", Device: "tap2", MessageId: 473, Rssi: -61, Value: 20500}},
+		{"ping|tap2|474|-61|", ScaleMessage{MessageType: "ping", Device: "tap2", MessageId: 474, Rssi: -61}},
+		{"push|475|-61|20500|fw=1.4.0", ScaleMessage{MessageType: "push", MessageId: 475, Rssi: -61, Value: 20500, Firmware: "1.4.0"}},
+		{"ping|tap2|476|-61||fw=1.4.0", ScaleMessage{MessageType: "ping", Device: "tap2", MessageId: 476, Rssi: -61, Firmware: "1.4.0"}},
+		{"push|477|-61|20500|t=4.5|bat=3.71|fw=1.5.0", ScaleMessage{MessageType: "push", MessageId: 477, Rssi: -61, Value: 20500, Firmware: "1.5.0", Sensors: sensors(4.5, 3.71)}},
+		{"push|tap2|478|-61|20500|bat=3.71", ScaleMessage{MessageType: "push", Device: "tap2", MessageId: 478, Rssi: -61, Value: 20500, Sensors: Sensors{Battery: sensors(0, 3.71).Battery}}},
+		{"push|479|-61|20500|t=-127|bat=abc|led=on", ScaleMessage{MessageType: "push", MessageId: 479, Rssi: -61, Value: 20500}}, // disconnected sensor, unknown field
 	}
 
 	for _, test := range tests {
@@ -28,6 +42,10 @@ func TestScale_ParseScaleMessage(t *testing.T) {
 				t.Errorf("Expected MessageId to be %d, got %d", test.parsed.MessageId, parsed.MessageId)
 			}
 
+			if test.parsed.Device != parsed.Device {
+				t.Errorf("Expected Device to be %s, got %s", test.parsed.Device, parsed.Device)
+			}
+
 			if test.parsed.MessageType != parsed.MessageType {
 				t.Errorf("Expected MessageType to be %s, got %s", test.parsed.MessageType, parsed.MessageType)
 			}
@@ -39,6 +57,101 @@ func TestScale_ParseScaleMessage(t *testing.T) {
 			if test.parsed.Value != parsed.Value {
 				t.Errorf("Expected Value to be %f, got %f", test.parsed.Value, parsed.Value)
 			}
+
+			if test.parsed.Firmware != parsed.Firmware {
+				t.Errorf("Expected Firmware to be %s, got %s", test.parsed.Firmware, parsed.Firmware)
+			}
+
+			if formatReading(test.parsed.Sensors.Temperature) != formatReading(parsed.Sensors.Temperature) {
+				t.Errorf("Expected Temperature to be %s, got %s", formatReading(test.parsed.Sensors.Temperature), formatReading(parsed.Sensors.Temperature))
+			}
+
+			if formatReading(test.parsed.Sensors.Battery) != formatReading(parsed.Sensors.Battery) {
+				t.Errorf("Expected Battery to be %s, got %s", formatReading(test.parsed.Sensors.Battery), formatReading(parsed.Sensors.Battery))
+			}
 		})
 	}
 }
+
+func sensors(temperature, battery float64) Sensors {
+	return Sensors{Temperature: &temperature, Battery: &battery}
+}
+
+// formatReading formats an optional sensor reading for comparison
+func formatReading(reading *float64) string {
+	if reading == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%.2f", *reading)
+}
+
+func TestFormatScaleMessage(t *testing.T) {
+	for _, message := range []ScaleMessage{
+		{MessageType: "push", MessageId: 471, Rssi: -74.7, Value: -47.25},
+		{MessageType: "ping", Device: "tap2", MessageId: 476, Rssi: -61, Firmware: "1.4.0"},
+		{MessageType: "raw", MessageId: 472, Rssi: -74.7, Value: 8818608},
+		{MessageType: "push", Device: "tap2", MessageId: 477, Rssi: -61, Value: 20500, Firmware: "1.5.0", Sensors: sensors(4.5, 3.71)},
+		{MessageType: "config", MessageId: 12, Rssi: -70.5, Config: map[string]string{"ping_interval": "60", "read_interval": "5"}},
+	} {
+		formatted := FormatScaleMessage(message)
+		parsed, err := ParseScaleMessage(formatted)
+		assert.Nil(t, err, formatted)
+		assert.Equal(t, message, parsed, formatted)
+	}
+
+	assert.Equal(t, "push|tap2|477|-61|20500|fw=1.5.0|t=4.5|bat=3.71", FormatScaleMessage(ScaleMessage{
+		MessageType: "push", Device: "tap2", MessageId: 477, Rssi: -61, Value: 20500, Firmware: "1.5.0", Sensors: sensors(4.5, 3.71),
+	}))
+}
+
+func TestScale_ParseScaleMessageConfig(t *testing.T) {
+	parsed, err := ParseScaleMessage("config|12|-70.5|ping_interval=60, read_interval=5")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if parsed.MessageType != ConfigMessageType {
+		t.Errorf("Expected MessageType to be %s, got %s", ConfigMessageType, parsed.MessageType)
+	}
+
+	if len(parsed.Config) != 2 || parsed.Config["ping_interval"] != "60" || parsed.Config["read_interval"] != "5" {
+		t.Errorf("Unexpected config: %v", parsed.Config)
+	}
+
+	if _, err := ParseScaleMessage("config|12|-70.5|ping_interval"); err == nil {
+		t.Errorf("Expected error for invalid config pair")
+	}
+}
+
+func TestScale_ParseScaleMessageInvalidDevice(t *testing.T) {
+	for _, raw := range []string{"push|Tap 2|473|-61|20500", "push|tap2|-61|20500", "push|2tap|473|-61|20500", "push|473|-61|20500|fw=1.4"} {
+		if _, err := ParseScaleMessage(raw); err == nil {
+			t.Errorf("Expected error for %s", raw)
+		}
+	}
+}
+
+func TestScale_ParseScaleBatch(t *testing.T) {
+	text := "1714600000|push|tap2|1230|-74|40500\n\n1714600005|ping|tap2|1231|-74|\n"
+	entries, err := ParseScaleBatch([]byte(text), false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(entries) != 2 || entries[0].Message.Value != 40500 || entries[1].Message.MessageType != PingMessageType {
+		t.Errorf("Unexpected entries: %v", entries)
+	}
+	if !entries[0].At.Equal(time.Unix(1714600000, 0)) || entries[0].Message.Device != "tap2" {
+		t.Errorf("Unexpected first entry: %v", entries[0])
+	}
+
+	entries, err = ParseScaleBatch([]byte(`[{"at": 1714600000, "message": "push|1230|-74|40500"}]`), true)
+	if err != nil || len(entries) != 1 || entries[0].Message.Device != "" {
+		t.Errorf("Unexpected JSON batch: %v, %v", entries, err)
+	}
+
+	for _, raw := range []string{"", "push|1230|-74|40500", "1714600000|push|1230|-74|40500\n1714600005|push|tap2|1231|-74|40000", "1714600000|push|x|-74|40500"} {
+		if _, err := ParseScaleBatch([]byte(raw), false); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+}
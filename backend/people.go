@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// People identify themselves by tapping their NFC/RFID card at the reader next to the tap,
+// the next pour is attributed to them. Privacy:
+//   - card tokens are never stored, only their SHA-256 hash
+//   - pours refer to a random person id, deleting the person unlinks all their pours
+//   - statistics are public only for people who opted in, the rest requires the admin password
+
+// Person is a registered holder of a tap token
+type Person struct {
+	Id        string    `json:"id"` // random, it does not reveal the token
+	Name      string    `json:"name"`
+	TokenHash string    `json:"token_hash"`
+	Public    bool      `json:"public"` // opted in to public statistics
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PersonView is the person without the token hash for API responses
+type PersonView struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Public    bool      `json:"public"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// View hides the token hash
+func (p Person) View() PersonView {
+	return PersonView{Id: p.Id, Name: p.Name, Public: p.Public, CreatedAt: p.CreatedAt}
+}
+
+// NewPerson registers the holder of the token
+func NewPerson(name, token string, public bool, now time.Time) (Person, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 50 {
+		return Person{}, fmt.Errorf("name must have 1 to 50 characters")
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return Person{}, fmt.Errorf("missing token")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Person{}, fmt.Errorf("could not generate id: %w", err)
+	}
+
+	return Person{
+		Id:        hex.EncodeToString(id),
+		Name:      name,
+		TokenHash: HashTapToken(token),
+		Public:    public,
+		CreatedAt: now,
+	}, nil
+}
+
+// HashTapToken returns the stored form of the card token
+// readers differ in letter case of the hex UID
+func HashTapToken(token string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(token))))
+	return hex.EncodeToString(hash[:])
+}
+
+// findPersonByToken returns the holder of the token
+func findPersonByToken(people []Person, token string) (Person, bool) {
+	hash := HashTapToken(token)
+	for _, p := range people {
+		if p.TokenHash == hash {
+			return p, true
+		}
+	}
+
+	return Person{}, false
+}
+
+// findPerson returns the person with the id
+func findPerson(people []Person, id string) (Person, bool) {
+	for _, p := range people {
+		if p.Id == id {
+			return p, true
+		}
+	}
+
+	return Person{}, false
+}
+
+// sortPeople orders people by name
+func sortPeople(people []Person) {
+	sort.Slice(people, func(i, j int) bool {
+		if people[i].Name != people[j].Name {
+			return people[i].Name < people[j].Name
+		}
+		return people[i].Id < people[j].Id
+	})
+}
+
+// TapAttribution is the card tap waiting for the next pour
+type TapAttribution struct {
+	PersonId string
+	At       time.Time
+}
+
+// tapEarlyTolerance accepts a pour detected slightly before the tap was reported
+// the reader and the scale report independently
+const tapEarlyTolerance = 5 * time.Second
+
+// Matches checks the pour started within the window after the tap
+func (t TapAttribution) Matches(startedAt time.Time, window time.Duration) bool {
+	return !startedAt.Before(t.At.Add(-tapEarlyTolerance)) && !startedAt.After(t.At.Add(window))
+}
+
+// PersonStats is the tab of a single person
+type PersonStats struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	Pours   int       `json:"pours"`
+	Glasses float64   `json:"glasses"`
+	Grams   float64   `json:"grams"`
+	LastAt  time.Time `json:"last_at"`
+}
+
+// CalcPeopleStats sums attributed pours per person ordered by glasses
+// pours of unknown (deleted) people are skipped, only public people are included unless all is set
+func CalcPeopleStats(people []Person, pours []Pour, all bool) []PersonStats {
+	byId := map[string]*PersonStats{}
+	for _, p := range people {
+		if all || p.Public {
+			byId[p.Id] = &PersonStats{Id: p.Id, Name: p.Name}
+		}
+	}
+
+	for _, pour := range pours {
+		stats, found := byId[pour.Person]
+		if !found {
+			continue
+		}
+		stats.Pours++
+		stats.Glasses += pour.Glasses
+		stats.Grams += pour.Grams
+		if pour.At.After(stats.LastAt) {
+			stats.LastAt = pour.At
+		}
+	}
+
+	res := make([]PersonStats, 0, len(byId))
+	for _, stats := range byId {
+		stats.Glasses = math.Round(stats.Glasses*100) / 100
+		res = append(res, *stats)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Glasses != res[j].Glasses {
+			return res[i].Glasses > res[j].Glasses
+		}
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNewPerson(t *testing.T) {
+	p, err := NewPerson(" Honza ", "04A1B2C3", true, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, "Honza", p.Name)
+	assert.Len(t, p.Id, 16)
+	assert.NotContains(t, p.TokenHash, "04a1b2c3")
+	assert.Equal(t, HashTapToken("04a1b2c3"), p.TokenHash, "letter case of the UID does not matter")
+
+	_, err = NewPerson("", "04A1B2C3", true, time.Now())
+	assert.NotNil(t, err)
+	_, err = NewPerson("Honza", " ", true, time.Now())
+	assert.NotNil(t, err)
+}
+
+func TestCalcPeopleStats(t *testing.T) {
+	now := time.Now()
+	people := []Person{
+		{Id: "a", Name: "Anna", Public: true},
+		{Id: "b", Name: "Bob"},
+	}
+	pours := []Pour{
+		{At: now.Add(-time.Hour), Glasses: 1, Grams: 500, Person: "a"},
+		{At: now, Glasses: 0.5, Grams: 250, Person: "a"},
+		{At: now, Glasses: 2, Grams: 1000, Person: "b"},
+		{At: now, Glasses: 1, Grams: 500, Person: "deleted"},
+		{At: now, Glasses: 1, Grams: 500},
+	}
+
+	stats := CalcPeopleStats(people, pours, false)
+	assert.Equal(t, []PersonStats{{Id: "a", Name: "Anna", Pours: 2, Glasses: 1.5, Grams: 750, LastAt: now}}, stats)
+
+	stats = CalcPeopleStats(people, pours, true)
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "Bob", stats[0].Name)
+}
+
+func TestScale_TapAttribution(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	person, err := NewPerson("Honza", "04a1b2c3", false, time.Now())
+	assert.Nil(t, err)
+	assert.Nil(t, s.store.SavePerson(person))
+
+	_, err = s.Tap("ffffffff", time.Now())
+	assert.ErrorIs(t, err, errUnknownTapToken)
+
+	tapped := time.Now()
+	_, err = s.Tap("04A1B2C3", tapped)
+	assert.Nil(t, err)
+	s.finishPour(PourProgress{StartedAt: tapped.Add(2 * time.Second), Grams: 250, Duration: 5})
+	// the tap is consumed by the first pour
+	s.finishPour(PourProgress{StartedAt: tapped.Add(10 * time.Second), Grams: 250, Duration: 5})
+
+	// pour starting after the window is not attributed
+	_, err = s.Tap("04a1b2c3", tapped)
+	assert.Nil(t, err)
+	s.finishPour(PourProgress{StartedAt: tapped.Add(s.config.TapWindow + time.Second), Grams: 250, Duration: 5})
+
+	pours, err := s.store.GetPours(tapped.Add(-time.Minute), tapped.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, pours, 3)
+	assert.Equal(t, person.Id, pours[0].Person)
+	assert.Empty(t, pours[1].Person)
+	assert.Empty(t, pours[2].Person)
+}
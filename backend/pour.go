@@ -0,0 +1,203 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// minimal weight drop between two measurements considered as pouring (noise filter)
+const pourMinDrop = 20.0
+
+// sliding window of the pours per hour indicator
+const pourRateWindow = time.Hour
+
+// PourProgress describes the pour in progress
+type PourProgress struct {
+	Active    bool      `json:"active"`
+	StartedAt time.Time `json:"started_at"`
+	Grams     float64   `json:"grams"`    // poured so far
+	Percent   float64   `json:"percent"`  // percent of a glass
+	Rate      float64   `json:"rate"`     // grams per second between last two measurements
+	Duration  float64   `json:"duration"` // seconds since the pour started
+	Runaway   bool      `json:"runaway"`  // pour lasts longer than allowed (stuck tap, burst line)
+}
+
+// Pour is a finished pour stored in the history
+type Pour struct {
+	StartedAt time.Time `json:"started_at"`
+	At        time.Time `json:"at"` // end of the pour
+	Grams     float64   `json:"grams"`
+	Glasses   float64   `json:"glasses"`  // grams divided by the glass of the tapped beer
+	Duration  float64   `json:"duration"` // seconds
+	KegId     string    `json:"keg_id"`
+	Person    string    `json:"person,omitempty"` // id of the person who tapped their card before the pour
+}
+
+// NewPour creates the history record of the finished pour
+func NewPour(progress PourProgress, glass float64, kegId string) Pour {
+	return Pour{
+		StartedAt: progress.StartedAt,
+		At:        progress.StartedAt.Add(time.Duration(progress.Duration * float64(time.Second))),
+		Grams:     progress.Grams,
+		Glasses:   math.Round(progress.Grams/glass*100) / 100,
+		Duration:  progress.Duration,
+		KegId:     kegId,
+	}
+}
+
+// PourTracker follows the weight derivative and recognizes pours in progress
+// the pour is active while the weight keeps dropping faster than [minRate]
+type PourTracker struct {
+	glass       float64       // grams of beer in a glass
+	minRate     float64       // grams per second
+	maxDuration time.Duration // longer pour is a runaway
+
+	last     Measurement
+	hasLast  bool
+	progress PourProgress
+
+	finishedAt []time.Time // end times of pours within [pourRateWindow]
+}
+
+func NewPourTracker(glass, minRate float64, maxDuration time.Duration) *PourTracker {
+	return &PourTracker{
+		glass:       glass,
+		minRate:     minRate,
+		maxDuration: maxDuration,
+	}
+}
+
+// Add processes a new measurement
+// it returns the current progress and finished pour (if the pour has just ended)
+func (pt *PourTracker) Add(m Measurement) (PourProgress, *PourProgress) {
+	if !pt.hasLast {
+		pt.last = m
+		pt.hasLast = true
+		return pt.progress, nil
+	}
+
+	dt := m.At.Sub(pt.last.At).Seconds()
+	drop := pt.last.Weight - m.Weight
+	rate := 0.0
+	if dt > 0 {
+		rate = drop / dt
+	}
+
+	var finished *PourProgress
+	if drop >= pourMinDrop && rate >= pt.minRate {
+		if !pt.progress.Active {
+			pt.progress = PourProgress{
+				Active:    true,
+				StartedAt: pt.last.At,
+			}
+		}
+		pt.progress.Grams += drop
+		pt.progress.Percent = math.Round(pt.progress.Grams/pt.glass*1000) / 10
+		pt.progress.Rate = rate
+		pt.progress.Duration = m.At.Sub(pt.progress.StartedAt).Seconds()
+		pt.progress.Runaway = pt.progress.Runaway || m.At.Sub(pt.progress.StartedAt) > pt.maxDuration
+	} else {
+		finished = pt.finish()
+	}
+
+	pt.last = m
+	return pt.progress, finished
+}
+
+// SetGlass changes grams of beer in a glass used for the pour percent
+func (pt *PourTracker) SetGlass(glass float64) {
+	pt.glass = glass
+}
+
+// Expire finishes the active pour if no measurement came within [idle]
+// the device sends values only when they change, so silence means the pour is over
+func (pt *PourTracker) Expire(now time.Time, idle time.Duration) *PourProgress {
+	if pt.progress.Active && now.Sub(pt.last.At) > idle {
+		return pt.finish()
+	}
+
+	return nil
+}
+
+// Reset forgets the last measurement and the pour in progress
+// the next measurement becomes a new baseline
+func (pt *PourTracker) Reset() {
+	pt.hasLast = false
+	pt.progress = PourProgress{}
+}
+
+// PoursWithin returns number of pours finished within the window, it can't be longer than [pourRateWindow]
+func (pt *PourTracker) PoursWithin(now time.Time, window time.Duration) int {
+	pours := 0
+	for _, at := range pt.finishedAt {
+		if now.Sub(at) < window {
+			pours++
+		}
+	}
+
+	return pours
+}
+
+// PoursPerHour returns number of pours finished within the last [pourRateWindow]
+func (pt *PourTracker) PoursPerHour(now time.Time) int {
+	keep := pt.finishedAt[:0]
+	for _, at := range pt.finishedAt {
+		if now.Sub(at) < pourRateWindow {
+			keep = append(keep, at)
+		}
+	}
+	pt.finishedAt = keep
+
+	return len(pt.finishedAt)
+}
+
+// NextChange returns when Expire or PoursPerHour change the state without a new measurement
+// zero time means nothing is going to change
+func (pt *PourTracker) NextChange(idle time.Duration) time.Time {
+	next := time.Time{}
+	if pt.progress.Active {
+		next = pt.last.At.Add(idle)
+	}
+
+	// pours are finished in order, the oldest one leaves the window first
+	if len(pt.finishedAt) > 0 {
+		out := pt.finishedAt[0].Add(pourRateWindow)
+		if next.IsZero() || out.Before(next) {
+			next = out
+		}
+	}
+
+	return next
+}
+
+// LeavesWindow returns when the oldest pour within the window leaves it, so [PoursWithin] changes
+// zero time means no pour is within the window
+func (pt *PourTracker) LeavesWindow(now time.Time, window time.Duration) time.Time {
+	for _, at := range pt.finishedAt {
+		if now.Sub(at) < window {
+			return at.Add(window)
+		}
+	}
+
+	return time.Time{}
+}
+
+// Progress returns the current pour progress
+func (pt *PourTracker) Progress() PourProgress {
+	return pt.progress
+}
+
+func (pt *PourTracker) finish() *PourProgress {
+	if !pt.progress.Active {
+		return nil
+	}
+
+	finished := pt.progress
+	finished.Active = false
+	finished.Rate = 0
+	pt.progress = PourProgress{}
+
+	end := finished.StartedAt.Add(time.Duration(finished.Duration * float64(time.Second)))
+	pt.finishedAt = append(pt.finishedAt, end)
+	return &finished
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPourTracker_Add(t *testing.T) {
+	start := time.Now()
+	pt := NewPourTracker(500, 10, time.Minute)
+
+	at := func(seconds int, weight float64) Measurement {
+		return Measurement{Weight: weight, At: start.Add(time.Duration(seconds) * time.Second)}
+	}
+
+	progress, finished := pt.Add(at(0, 20000))
+	assert.False(t, progress.Active)
+	assert.Nil(t, finished)
+
+	progress, finished = pt.Add(at(5, 19750))
+	assert.True(t, progress.Active)
+	assert.Equal(t, 250.0, progress.Grams)
+	assert.Equal(t, 50.0, progress.Percent)
+	assert.Nil(t, finished)
+
+	progress, finished = pt.Add(at(10, 19500))
+	assert.True(t, progress.Active)
+	assert.Equal(t, 500.0, progress.Grams)
+	assert.Equal(t, 100.0, progress.Percent)
+	assert.Nil(t, finished)
+
+	progress, finished = pt.Add(at(60, 19495)) // small slow change - pour is over
+	assert.False(t, progress.Active)
+	assert.NotNil(t, finished)
+	assert.Equal(t, 500.0, finished.Grams)
+}
+
+func TestPourTracker_Expire(t *testing.T) {
+	start := time.Now()
+	pt := NewPourTracker(500, 10, time.Minute)
+
+	pt.Add(Measurement{Weight: 20000, At: start})
+	pt.Add(Measurement{Weight: 19700, At: start.Add(5 * time.Second)})
+
+	assert.Nil(t, pt.Expire(start.Add(10*time.Second), 15*time.Second))
+
+	finished := pt.Expire(start.Add(30*time.Second), 15*time.Second)
+	assert.NotNil(t, finished)
+	assert.Equal(t, 300.0, finished.Grams)
+	assert.False(t, pt.Progress().Active)
+}
+
+func TestPourTracker_Runaway(t *testing.T) {
+	start := time.Now()
+	pt := NewPourTracker(500, 10, 30*time.Second)
+
+	weight := 20000.0
+	pt.Add(Measurement{Weight: weight, At: start})
+	for i := 1; i <= 6; i++ {
+		weight -= 300
+		progress, _ := pt.Add(Measurement{Weight: weight, At: start.Add(time.Duration(i*5) * time.Second)})
+		assert.False(t, progress.Runaway) // exactly 30 seconds is still fine
+	}
+
+	progress, _ := pt.Add(Measurement{Weight: weight - 300, At: start.Add(35 * time.Second)})
+	assert.True(t, progress.Runaway)
+	assert.Equal(t, 35.0, progress.Duration)
+}
+
+func TestPourTracker_PoursPerHour(t *testing.T) {
+	start := time.Now()
+	pt := NewPourTracker(500, 10, time.Minute)
+
+	weight := 20000.0
+	pour := func(minute int) {
+		at := start.Add(time.Duration(minute) * time.Minute)
+		pt.Add(Measurement{Weight: weight, At: at})
+		weight -= 500
+		pt.Add(Measurement{Weight: weight, At: at.Add(10 * time.Second)})
+		pt.Add(Measurement{Weight: weight, At: at.Add(20 * time.Second)})
+	}
+
+	pour(0)
+	pour(30)
+	pour(50)
+	assert.Equal(t, 3, pt.PoursPerHour(start.Add(55*time.Minute)))
+	assert.Equal(t, 2, pt.PoursPerHour(start.Add(70*time.Minute)))
+	assert.Equal(t, 0, pt.PoursPerHour(start.Add(3*time.Hour)))
+}
+
+func TestPourTracker_NextChange(t *testing.T) {
+	start := time.Now()
+	pt := NewPourTracker(500, 10, time.Minute)
+	assert.True(t, pt.NextChange(10*time.Second).IsZero())
+
+	pt.Add(Measurement{Weight: 20000, At: start})
+	pt.Add(Measurement{Weight: 19750, At: start.Add(5 * time.Second)})
+	assert.Equal(t, start.Add(15*time.Second), pt.NextChange(10*time.Second), "active pour expires")
+
+	pt.Expire(start.Add(time.Minute), 10*time.Second)
+	assert.Equal(t, start.Add(5*time.Second).Add(pourRateWindow), pt.NextChange(10*time.Second), "pour leaves the window")
+
+	assert.Equal(t, start.Add(5*time.Second).Add(15*time.Minute), pt.LeavesWindow(start.Add(time.Minute), 15*time.Minute))
+	assert.True(t, pt.LeavesWindow(start.Add(20*time.Minute), 15*time.Minute).IsZero(), "the pour already left")
+}
+
+func TestScale_StoresPours(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	started := time.Now().Add(-time.Minute)
+
+	s.finishPour(PourProgress{StartedAt: started, Grams: 250, Duration: 5})
+	pours, err := s.store.GetPours(started, time.Now())
+	assert.Nil(t, err)
+	assert.Len(t, pours, 1)
+	assert.Equal(t, 0.5, pours[0].Glasses)
+	assert.Equal(t, started.Add(5*time.Second), pours[0].At)
+	assert.Equal(t, s.KegInfo.Id, pours[0].KegId)
+}
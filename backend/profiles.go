@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// profiles are named sets of defaults baked into the binary
+// they replace long lists of environment variables when running locally
+// environment variables still take precedence over the selected profile
+var profiles = map[string]map[string]string{
+	"dev": {
+		"STORAGE_DRIVER":  "memory",
+		"LOG_LEVEL":       "debug",
+		"LOG_FORMAT":      "text",
+		"DRY_RUN":         "true",
+		"KEG_AUTO_DETECT": "false",
+		"METRIC_TTL":      "1m",
+		"FRONTEND_PATH":   "./../frontend/build/",
+	},
+	"staging": {
+		"STORAGE_DRIVER": "redis",
+		"REDIS_DB":       "1",
+		"LOG_LEVEL":      "debug",
+		"LOG_FORMAT":     "json",
+		"DRY_RUN":        "true",
+	},
+	"pub": {
+		"STORAGE_DRIVER": "redis",
+		"LOG_LEVEL":      "info",
+		"LOG_FORMAT":     "json",
+		"DRY_RUN":        "false",
+	},
+}
+
+// activeProfile holds defaults of the selected profile, nil if no profile is selected
+var activeProfile map[string]string
+
+// UseProfile selects the profile used by [NewConfig], empty name clears the selection
+func UseProfile(name string) error {
+	if name == "" {
+		activeProfile = nil
+		return nil
+	}
+
+	profile, found := profiles[name]
+	if !found {
+		return fmt.Errorf("unknown profile %q, available profiles: %s", name, strings.Join(profileNames(), ", "))
+	}
+
+	activeProfile = profile
+	return nil
+}
+
+// profileNames returns sorted names of available profiles
+func profileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupEnv returns the environment variable or the default of the active profile
+func lookupEnv(key string) (string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+
+	value, ok := activeProfile[key]
+	return value, ok
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket rate limiter keyed by an arbitrary string (token, IP, ...)
+// Each key gets [limit] requests per [per] duration with bursts up to [limit]
+// Buckets idle for [per] are full again, they are swept so keys of unauthenticated clients don't pile up
+type RateLimiter struct {
+	mux     sync.Mutex
+	limit   float64
+	per     time.Duration
+	buckets map[string]*bucket
+	sweptAt time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(limit int, per time.Duration) *RateLimiter {
+	return &RateLimiter{
+		mux:     sync.Mutex{},
+		limit:   float64(limit),
+		per:     per,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+// Allow consumes one token for the key and returns false if the bucket is empty
+func (rl *RateLimiter) Allow(key string) bool {
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+
+	now := rl.now()
+	if now.Sub(rl.sweptAt) >= rl.per {
+		rl.sweep(now)
+	}
+
+	b, found := rl.buckets[key]
+	if !found {
+		b = &bucket{tokens: rl.limit, last: now}
+		rl.buckets[key] = b
+	}
+
+	// refill tokens based on elapsed time
+	elapsed := now.Sub(b.last)
+	b.tokens += elapsed.Seconds() / rl.per.Seconds() * rl.limit
+	if b.tokens > rl.limit {
+		b.tokens = rl.limit
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// sweep removes buckets which refilled completely, a new bucket of the key is the same
+// caller has to hold the lock
+func (rl *RateLimiter) sweep(now time.Time) {
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) >= rl.per {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.sweptAt = now
+}
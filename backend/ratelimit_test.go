@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	now := time.Now()
+	rl := NewRateLimiter(3, time.Minute)
+	rl.now = func() time.Time { return now }
+
+	assert.True(t, rl.Allow("a"))
+	assert.True(t, rl.Allow("a"))
+	assert.True(t, rl.Allow("a"))
+	assert.False(t, rl.Allow("a"))
+	assert.True(t, rl.Allow("b")) // keys are independent
+
+	now = now.Add(20 * time.Second) // one token refilled
+	assert.True(t, rl.Allow("a"))
+	assert.False(t, rl.Allow("a"))
+
+	now = now.Add(time.Hour) // never more than limit
+	assert.True(t, rl.Allow("a"))
+	assert.True(t, rl.Allow("a"))
+	assert.True(t, rl.Allow("a"))
+	assert.False(t, rl.Allow("a"))
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	now := time.Now()
+	rl := NewRateLimiter(3, time.Minute)
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < 1000; i++ {
+		rl.Allow(fmt.Sprintf("10.0.%d.%d", i/256, i%256)) // every request from another address
+	}
+	assert.Len(t, rl.buckets, 1000)
+
+	now = now.Add(30 * time.Second)
+	assert.True(t, rl.Allow("192.168.0.1"))
+	assert.Len(t, rl.buckets, 1001, "swept once per period")
+
+	now = now.Add(40 * time.Second)
+	assert.True(t, rl.Allow("192.168.0.2"))
+	assert.Len(t, rl.buckets, 2, "idle buckets are full again")
+	assert.True(t, rl.Allow("10.0.0.0"))
+	assert.True(t, rl.Allow("10.0.0.0"))
+	assert.True(t, rl.Allow("10.0.0.0"))
+	assert.False(t, rl.Allow("10.0.0.0"), "a swept key starts with a full bucket")
+}
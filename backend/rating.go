@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// max length of the rating comment in characters
+const ratingCommentMaxLength = 280
+
+// Rating is a patron's opinion on the beer on tap
+type Rating struct {
+	KegId   string    `json:"keg_id"`
+	Up      bool      `json:"up"` // thumbs up or down
+	Comment string    `json:"comment,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// RatingSummary aggregates ratings of a single keg
+type RatingSummary struct {
+	Up       int      `json:"up"`
+	Down     int      `json:"down"`
+	Score    *float64 `json:"score"` // percent of thumbs up, nil without ratings
+	Comments []string `json:"comments"`
+}
+
+// SummarizeRatings aggregates ratings ordered by time
+func SummarizeRatings(ratings []Rating) RatingSummary {
+	summary := RatingSummary{Comments: []string{}}
+	for _, r := range ratings {
+		if r.Up {
+			summary.Up++
+		} else {
+			summary.Down++
+		}
+		if r.Comment != "" {
+			summary.Comments = append(summary.Comments, r.Comment)
+		}
+	}
+
+	if total := summary.Up + summary.Down; total > 0 {
+		score := math.Round(float64(summary.Up)/float64(total)*1000) / 10
+		summary.Score = &score
+	}
+
+	return summary
+}
+
+// BeerHistoryItem is a keg from the history together with its ratings
+type BeerHistoryItem struct {
+	KegInfo
+	Ratings RatingSummary `json:"ratings"`
+}
+
+// RateActiveKeg stores rating of the beer currently on tap
+func (s *Scale) RateActiveKeg(up bool, comment string) (Rating, error) {
+	s.mux.Lock()
+	kegId := s.KegInfo.Id
+	s.mux.Unlock()
+
+	if kegId == "" {
+		return Rating{}, fmt.Errorf("no keg is on tap")
+	}
+
+	rating := Rating{KegId: kegId, Up: up, Comment: comment, At: time.Now()}
+	return rating, s.store.AddRating(rating)
+}
+
+// GetBeerHistory returns all kegs with their ratings, the newest first
+func (s *Scale) GetBeerHistory() ([]BeerHistoryItem, error) {
+	kegs, err := s.store.GetKegs()
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]BeerHistoryItem, 0, len(kegs))
+	for i := len(kegs) - 1; i >= 0; i-- {
+		ratings, err := s.store.GetRatings(kegs[i].Id)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, BeerHistoryItem{KegInfo: kegs[i], Ratings: SummarizeRatings(ratings)})
+	}
+
+	return history, nil
+}
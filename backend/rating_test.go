@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeRatings(t *testing.T) {
+	summary := SummarizeRatings([]Rating{
+		{Up: true, Comment: "Výborné"},
+		{Up: true},
+		{Up: false, Comment: "Too warm"},
+	})
+
+	assert.Equal(t, 2, summary.Up)
+	assert.Equal(t, 1, summary.Down)
+	assert.Equal(t, 66.7, *summary.Score)
+	assert.Equal(t, []string{"Výborné", "Too warm"}, summary.Comments)
+
+	assert.Nil(t, SummarizeRatings(nil).Score)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RegistryVersion is the format version of the exported scale registry
+const RegistryVersion = 1
+
+// RegistryEntry describes a single scale for provisioning on another instance
+type RegistryEntry struct {
+	Device      string       `json:"device"`           // empty is the default scale
+	Secret      string       `json:"secret,omitempty"` // HMAC secret from SCALE_SECRETS
+	Calibration *Calibration `json:"calibration,omitempty"`
+}
+
+// RegistryExport is the exported scale registry
+type RegistryExport struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Scales     []RegistryEntry `json:"scales"`
+}
+
+// RegistryImport is the result of the import
+// devices and secrets come from the configuration, so the instance can't add them at runtime,
+// Env holds values of SCALE_DEVICES and SCALE_SECRETS covering the imported scales instead
+type RegistryImport struct {
+	Imported []string          `json:"imported"` // devices whose calibration was applied
+	Missing  []string          `json:"missing"`  // devices not configured on this instance
+	Env      map[string]string `json:"env,omitempty"`
+}
+
+// Export returns ids, secrets and calibrations of all scales
+func (sr *ScaleRegistry) Export(secrets map[string]string) RegistryExport {
+	export := RegistryExport{
+		Version:    RegistryVersion,
+		ExportedAt: time.Now(),
+		Scales:     []RegistryEntry{},
+	}
+
+	for _, device := range sr.Devices() {
+		scale, _ := sr.Get(device)
+		calibration, _, _ := scale.GetCalibration()
+		export.Scales = append(export.Scales, RegistryEntry{
+			Device:      device,
+			Secret:      secrets[secretKey(device)],
+			Calibration: calibration,
+		})
+	}
+
+	return export
+}
+
+// Import applies calibrations of the exported scales configured on this instance
+// the whole export is validated first, so an invalid entry changes nothing
+func (sr *ScaleRegistry) Import(export RegistryExport, config *Config) (RegistryImport, error) {
+	if export.Version != RegistryVersion {
+		return RegistryImport{}, fmt.Errorf("unsupported version %d", export.Version)
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range export.Scales {
+		if entry.Device != "" && !deviceIdPattern.MatchString(entry.Device) {
+			return RegistryImport{}, fmt.Errorf("invalid device id %q", entry.Device)
+		}
+		if seen[entry.Device] {
+			return RegistryImport{}, fmt.Errorf("device %q is listed twice", entry.Device)
+		}
+		seen[entry.Device] = true
+
+		if entry.Calibration != nil {
+			if err := entry.Calibration.Validate(); err != nil {
+				return RegistryImport{}, fmt.Errorf("invalid calibration of %q: %w", entry.Device, err)
+			}
+		}
+	}
+
+	result := RegistryImport{Imported: []string{}, Missing: []string{}}
+	devices := slices.Clone(config.ScaleDevices)
+	secrets := maps.Clone(config.ScaleSecrets)
+	if secrets == nil {
+		secrets = map[string]string{}
+	}
+	for _, entry := range export.Scales {
+		if entry.Secret != "" {
+			secrets[secretKey(entry.Device)] = entry.Secret
+		}
+
+		scale, found := sr.Get(entry.Device)
+		if !found {
+			result.Missing = append(result.Missing, entry.Device)
+			devices = append(devices, entry.Device)
+			continue
+		}
+
+		if entry.Calibration != nil {
+			if err := scale.SetCalibration(*entry.Calibration); err != nil {
+				return result, fmt.Errorf("could not import calibration of %q: %w", entry.Device, err)
+			}
+			result.Imported = append(result.Imported, entry.Device)
+		}
+	}
+
+	if len(result.Missing) > 0 || !maps.Equal(secrets, config.ScaleSecrets) {
+		result.Env = map[string]string{
+			"SCALE_DEVICES": strings.Join(devices, ","),
+			"SCALE_SECRETS": formatKeyValues(secrets),
+		}
+	}
+
+	return result, nil
+}
+
+// secretKey returns the key of the device in SCALE_SECRETS
+func secretKey(device string) string {
+	if device == "" {
+		return defaultDeviceSecret
+	}
+	return device
+}
+
+// runRegistryCommand implements `keg-scale registry export|import [flags]`
+// export prints the registry of the instance, import sends the file (or stdin) to another one
+func runRegistryCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "export" && args[0] != "import") {
+		return fmt.Errorf("usage: registry export|import [flags] [file]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("registry "+action, flag.ContinueOnError)
+	url := fs.String("url", "http://localhost:8080/api/scales/registry", "registry endpoint of the instance")
+	password := fs.String("password", os.Getenv("PASSWORD"), "admin password of the instance")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var req *http.Request
+	var err error
+	if action == "export" {
+		req, err = http.NewRequest(http.MethodGet, *url, nil)
+	} else {
+		input := io.Reader(os.Stdin)
+		if fs.NArg() > 0 {
+			data, rerr := os.ReadFile(fs.Arg(0))
+			if rerr != nil {
+				return rerr
+			}
+			input = bytes.NewReader(data)
+		}
+		req, err = http.NewRequest(http.MethodPost, *url, input)
+		if req != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", *password)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return err
+	}
+	out.WriteString("\n")
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func createRegistry(t *testing.T, devices ...string) (*ScaleRegistry, *Config) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ScaleDevices = devices
+	monitor := NewMonitor()
+	store := &FakeStore{}
+
+	scales := NewScaleRegistry(NewScale(config, monitor, store, logger))
+	assert.Nil(t, scales.AddDevices(config, monitor, store, logger))
+	return scales, config
+}
+
+func TestScaleRegistry_ExportImport(t *testing.T) {
+	source, sourceConfig := createRegistry(t, "tap2", "tap3")
+	sourceConfig.ScaleSecrets = map[string]string{"default": "0123456789abcdef", "tap2": "fedcba9876543210"}
+	tap2, _ := source.Get("tap2")
+	assert.Nil(t, tap2.SetCalibration(Calibration{Offset: 8388608, Factor: 21.5}))
+
+	export := source.Export(sourceConfig.ScaleSecrets)
+	assert.Equal(t, RegistryVersion, export.Version)
+	assert.Len(t, export.Scales, 3)
+	assert.Equal(t, "0123456789abcdef", export.Scales[0].Secret)
+	assert.Nil(t, export.Scales[0].Calibration)
+	assert.Equal(t, 21.5, export.Scales[1].Calibration.Factor)
+	assert.Empty(t, export.Scales[2].Secret)
+
+	// round trip through JSON like between two instances
+	data, err := json.Marshal(export)
+	assert.Nil(t, err)
+	var received RegistryExport
+	assert.Nil(t, json.Unmarshal(data, &received))
+
+	target, targetConfig := createRegistry(t, "tap2")
+	result, err := target.Import(received, targetConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tap2"}, result.Imported)
+	assert.Equal(t, []string{"tap3"}, result.Missing)
+	assert.Equal(t, "tap2,tap3", result.Env["SCALE_DEVICES"])
+	assert.Equal(t, "default=0123456789abcdef,tap2=fedcba9876543210", result.Env["SCALE_SECRETS"])
+
+	targetTap2, _ := target.Get("tap2")
+	calibration, _, _ := targetTap2.GetCalibration()
+	assert.Equal(t, 8388608.0, calibration.Offset)
+}
+
+func TestScaleRegistry_ImportInvalid(t *testing.T) {
+	scales, config := createRegistry(t, "tap2")
+	tap2, _ := scales.Get("tap2")
+
+	_, err := scales.Import(RegistryExport{Version: 2}, config)
+	assert.NotNil(t, err)
+
+	_, err = scales.Import(RegistryExport{Version: RegistryVersion, Scales: []RegistryEntry{
+		{Device: "tap2", Calibration: &Calibration{Offset: 1, Factor: 2}},
+		{Device: "", Calibration: &Calibration{Offset: 1}}, // no factor
+	}}, config)
+	assert.NotNil(t, err)
+	calibration, _, _ := tap2.GetCalibration()
+	assert.Nil(t, calibration, "nothing is applied")
+
+	_, err = scales.Import(RegistryExport{Version: RegistryVersion, Scales: []RegistryEntry{{Device: "Tap 2"}}}, config)
+	assert.NotNil(t, err)
+
+	result, err := scales.Import(RegistryExport{Version: RegistryVersion, Scales: []RegistryEntry{{Device: "tap2"}}}, config)
+	assert.Nil(t, err)
+	assert.Nil(t, result.Env, "nothing to provision")
+}
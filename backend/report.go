@@ -0,0 +1,46 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io"
+	"time"
+)
+
+// keg under this yield (percent) is highlighted in the report
+const reportLowYield = 85.0
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var reportTemplate = template.Must(template.New("keg_report.html").Funcs(template.FuncMap{
+	"date": formatDate,
+	"weight": func(grams float64) string {
+		return formatWeight(grams, display.locale) + " " + display.weightUnit
+	},
+}).ParseFS(templateFiles, "templates/keg_report.html"))
+
+// kegReport is the data of the brewery feedback report
+type kegReport struct {
+	KegArchive
+	UnderDelivered bool
+	AveragePour    float64
+}
+
+// WriteKegReport renders the HTML feedback report for the brewery
+func WriteKegReport(w io.Writer, archive KegArchive) error {
+	report := kegReport{
+		KegArchive:     archive,
+		UnderDelivered: archive.Yield.Yield < reportLowYield,
+	}
+	if archive.Keg.Pours > 0 {
+		report.AveragePour = archive.Keg.PouredGrams / float64(archive.Keg.Pours)
+	}
+
+	return reportTemplate.Execute(w, report)
+}
+
+// reportFileName returns name of the downloaded report
+func reportFileName(keg KegInfo) string {
+	return "keg-report-" + keg.TappedAt.In(getTz()).Format(time.DateOnly) + "-" + keg.Id + ".html"
+}
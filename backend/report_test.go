@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteKegReport(t *testing.T) {
+	tapped := time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)
+	keg := NewKegInfo(15, "Pilsner <b>", tapped, 22000)
+	keg.Pours = 20
+	keg.PouredGrams = 10000
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteKegReport(&buf, KegArchive{
+		Keg:   keg,
+		Yield: CalcKegYield(keg, 500, 10000, tapped.Add(48*time.Hour)),
+	}))
+
+	html := buf.String()
+	assert.Contains(t, html, "Pilsner &lt;b&gt;")
+	assert.Contains(t, html, "66.7 %")
+	assert.Contains(t, html, `class="low"`)
+	assert.Contains(t, html, "0,50 kg")
+}
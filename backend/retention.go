@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetentionReport is the result of pruning the measurement history
+type RetentionReport struct {
+	At      time.Time      `json:"at"`
+	Deleted map[string]int `json:"deleted"` // device => deleted measurements, the default scale has an empty id
+}
+
+// Retention prunes measurements of all scales older than [Config.RetentionDays]
+// and the oldest ones over [Config.RetentionMaxItems], pours, kegs and sessions are kept forever
+type Retention struct {
+	mux     sync.Mutex
+	config  *Config
+	scales  *ScaleRegistry
+	monitor *Monitor
+	logger  *logrus.Logger
+	last    *RetentionReport
+}
+
+func NewRetention(config *Config, scales *ScaleRegistry, monitor *Monitor, logger *logrus.Logger) *Retention {
+	return &Retention{
+		mux:     sync.Mutex{},
+		config:  config,
+		scales:  scales,
+		monitor: monitor,
+		logger:  logger,
+	}
+}
+
+// Enabled returns true if any retention limit is configured
+func (rt *Retention) Enabled() bool {
+	return rt.config.RetentionDays > 0 || rt.config.RetentionMaxItems > 0
+}
+
+// Run prunes the history every night at [Config.RetentionHour]
+// it's supposed to run as a supervised worker
+func (rt *Retention) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	next := nextExportAt(time.Now(), rt.config.RetentionHour)
+	for {
+		select {
+		case <-ctx.Done():
+			rt.logger.Debug("Retention stopped")
+			return
+		case now := <-tick.C:
+			heartbeat()
+			if now.Before(next) {
+				continue
+			}
+
+			if _, err := rt.Prune(now); err != nil {
+				rt.logger.Errorf("Could not prune measurements: %v", err)
+			}
+			next = nextExportAt(now, rt.config.RetentionHour)
+		}
+	}
+}
+
+// Last returns the report of the last pruning, nil if it has not run yet
+func (rt *Retention) Last() *RetentionReport {
+	rt.mux.Lock()
+	defer rt.mux.Unlock()
+
+	return rt.last
+}
+
+// Prune deletes measurements over the limits from the storage of every scale
+// a failing scale does not stop pruning of the others, the report contains what was deleted
+func (rt *Retention) Prune(now time.Time) (RetentionReport, error) {
+	report := RetentionReport{At: now, Deleted: map[string]int{}}
+	var errs []error
+
+	for _, device := range rt.scales.Devices() {
+		scale, _ := rt.scales.Get(device)
+		deleted, err := rt.prune(scale.store, now)
+		report.Deleted[device] = deleted
+		rt.monitor.measurementsPruned.WithLabelValues().Add(float64(deleted))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("scale %q: %w", device, err))
+		}
+		if deleted > 0 {
+			rt.logger.Infof("Pruned %d measurements of scale %q", deleted, device)
+		}
+	}
+
+	rt.mux.Lock()
+	rt.last = &report
+	rt.mux.Unlock()
+
+	return report, errors.Join(errs...)
+}
+
+// prune applies the limits to a single storage
+func (rt *Retention) prune(store Storage, now time.Time) (int, error) {
+	deleted := 0
+
+	if rt.config.RetentionDays > 0 {
+		old, err := store.DeleteMeasurements(time.Unix(0, 0), now.AddDate(0, 0, -rt.config.RetentionDays))
+		deleted += old
+		if err != nil {
+			return deleted, fmt.Errorf("could not delete old measurements: %w", err)
+		}
+	}
+
+	if rt.config.RetentionMaxItems > 0 {
+		over, err := store.TrimMeasurements(rt.config.RetentionMaxItems)
+		deleted += over
+		if err != nil {
+			return deleted, fmt.Errorf("could not trim measurements: %w", err)
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetention_Prune(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ScaleDevices = []string{"tap2"}
+	monitor := NewMonitor()
+	store := &FakeStore{}
+	scales := NewScaleRegistry(NewScale(config, monitor, store, logger))
+	assert.Nil(t, scales.AddDevices(config, monitor, store, logger))
+	retention := NewRetention(config, scales, monitor, logger)
+	assert.False(t, retention.Enabled())
+
+	now := time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC)
+	tap2, _ := scales.Get("tap2")
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, store.AddMeasurement(Measurement{Weight: 20000, At: now.AddDate(0, 0, -40+i)}))
+		assert.Nil(t, tap2.store.AddMeasurement(Measurement{Weight: 20000, At: now.Add(-time.Duration(i) * time.Hour)}))
+	}
+
+	config.RetentionDays = 38
+	config.RetentionMaxItems = 2
+	assert.True(t, retention.Enabled())
+	report, err := retention.Prune(now)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{"": 3, "tap2": 3}, report.Deleted, "older than 38 days on the default scale, over the limit on tap2")
+	assert.Equal(t, &report, retention.Last())
+	assert.Equal(t, 6.0, counterValue(t, monitor, "scale_measurements_pruned_total"))
+
+	left, _ := tap2.store.GetMeasurements(now.Add(-24*time.Hour), now.Add(time.Hour))
+	assert.Len(t, left, 2)
+	assert.Equal(t, now.Add(-time.Hour), left[0].At, "the newest ones are kept")
+
+	hr := &HandlerRepository{config: config, retention: retention, logger: logger}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/admin/retention", nil)
+	hr.retentionHandler()(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r.Header.Set("Authorization", "test")
+	w = httptest.NewRecorder()
+	hr.retentionHandler()(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var pruned RetentionReport
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &pruned))
+	assert.Equal(t, map[string]int{"": 2, "tap2": 2}, pruned.Deleted, "all of them are older than 38 days now")
+}
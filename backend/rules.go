@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// metrics of the scale the alert rules are evaluated on
+const (
+	RuleMetricBeersLeft    = "beers_left"
+	RuleMetricWeight       = "weight"         // grams
+	RuleMetricRssi         = "rssi"           // dBm
+	RuleMetricTemperature  = "temperature"    // °C, unknown without the sensor
+	RuleMetricBattery      = "battery"        // volts, unknown without the battery
+	RuleMetricDataAge      = "data_age"       // seconds since the last message, the threshold may be a duration (10m)
+	RuleMetricPoursPerHour = "pours_per_hour" // pours within the last hour
+)
+
+var (
+	ruleMetrics   = []string{RuleMetricBeersLeft, RuleMetricWeight, RuleMetricRssi, RuleMetricTemperature, RuleMetricBattery, RuleMetricDataAge, RuleMetricPoursPerHour}
+	ruleOperators = []string{"<=", ">=", "==", "!=", "<", ">"} // longer first, so <= is not parsed as <
+	ruleChannels  = []string{"telegram", "slack"}
+
+	errInvalidRule = errors.New("invalid alert rule")
+)
+
+// AlertRule notifies when the condition over a metric of the scale holds, see [Config.AlertRules]
+//
+//	[{"name": "low beer", "condition": "beers_left < 10", "channels": ["telegram"], "cooldown": "2h"},
+//	 {"name": "no data", "condition": "data_age > 10m", "open_only": true}]
+type AlertRule struct {
+	Name      string   `json:"name"`
+	Condition string   `json:"condition"`                  // "<metric> <operator> <threshold>", e.g. rssi < -85
+	Channels  []string `json:"channels"`                   // notification channels, empty notifies all of them
+	Cooldown  string   `json:"cooldown"`                   // minimal interval of repeated notifications while the condition holds, NOTIFY_COOLDOWN by default
+	OpenOnly  bool     `json:"open_only" yaml:"open_only"` // evaluated only while the pub is open
+	Message   string   `json:"message"`                    // custom notification, {value} is replaced by the current value
+}
+
+// ruleCondition is the parsed condition of the rule
+type ruleCondition struct {
+	metric    string
+	operator  string
+	threshold float64
+}
+
+// ParseRuleCondition parses "<metric> <operator> <threshold>"
+func ParseRuleCondition(condition string) (ruleCondition, error) {
+	for _, operator := range ruleOperators {
+		metric, raw, found := strings.Cut(condition, operator)
+		if !found {
+			continue
+		}
+		metric, raw = strings.TrimSpace(metric), strings.TrimSpace(raw)
+
+		if !slices.Contains(ruleMetrics, metric) {
+			return ruleCondition{}, fmt.Errorf("%w: unknown metric %q, use one of %s", errInvalidRule, metric, strings.Join(ruleMetrics, ", "))
+		}
+		threshold, err := strconv.ParseFloat(raw, 64)
+		if err != nil && metric == RuleMetricDataAge {
+			var age time.Duration
+			age, err = time.ParseDuration(raw)
+			threshold = age.Seconds()
+		}
+		if err != nil {
+			return ruleCondition{}, fmt.Errorf("%w: threshold %q is not a number", errInvalidRule, raw)
+		}
+
+		return ruleCondition{metric: metric, operator: operator, threshold: threshold}, nil
+	}
+
+	return ruleCondition{}, fmt.Errorf("%w: condition %q has no operator, use one of %s", errInvalidRule, condition, strings.Join(ruleOperators, " "))
+}
+
+// holds returns true if the value satisfies the condition
+func (c ruleCondition) holds(value float64) bool {
+	switch c.operator {
+	case "<":
+		return value < c.threshold
+	case "<=":
+		return value <= c.threshold
+	case ">":
+		return value > c.threshold
+	case ">=":
+		return value >= c.threshold
+	case "==":
+		return value == c.threshold
+	default:
+		return value != c.threshold
+	}
+}
+
+// Validate checks the rule can be evaluated
+func (r AlertRule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("%w: name is required", errInvalidRule)
+	}
+	if _, err := ParseRuleCondition(r.Condition); err != nil {
+		return err
+	}
+	for _, channel := range r.Channels {
+		if !slices.Contains(ruleChannels, channel) {
+			return fmt.Errorf("%w: unknown channel %q, use one of %s", errInvalidRule, channel, strings.Join(ruleChannels, ", "))
+		}
+	}
+	if r.Cooldown != "" {
+		if cooldown, err := time.ParseDuration(r.Cooldown); err != nil || cooldown < 0 {
+			return fmt.Errorf("%w: cooldown %q is not a duration", errInvalidRule, r.Cooldown)
+		}
+	}
+
+	return nil
+}
+
+// ParseAlertRules parses the JSON array of rules, or the YAML list with the same fields
+func ParseAlertRules(data []byte, yamlFormat bool) ([]AlertRule, error) {
+	rules := []AlertRule{}
+	var err error
+	if yamlFormat {
+		err = yaml.Unmarshal(data, &rules)
+	} else {
+		err = json.Unmarshal(data, &rules)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// getAlertRulesDefault reads the rules from the file (JSON, or YAML by its extension) or the inline JSON variable
+func (e *configEnv) getAlertRulesDefault(key, fileKey string) []AlertRule {
+	data, yamlFormat := []byte(nil), false
+	if path, ok := e.lookup(fileKey); ok && path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			e.invalid = append(e.invalid, fmt.Errorf("%s: %v", fileKey, err))
+			return nil
+		}
+		yamlFormat = filepath.Ext(path) == ".yaml" || filepath.Ext(path) == ".yml"
+		key = fileKey
+	} else if value, ok := e.lookup(key); ok && strings.TrimSpace(value) != "" {
+		data = []byte(value)
+	} else {
+		fmt.Println(fmt.Sprintf("Using default value for %s", key))
+		return nil
+	}
+
+	rules, err := ParseAlertRules(data, yamlFormat)
+	if err != nil {
+		e.invalid = append(e.invalid, fmt.Errorf("%s: invalid rules: %v", key, err))
+		return nil
+	}
+
+	return rules
+}
+
+// AlertRuleEvent is the payload of [AlertRuleEventType]
+// published when the rule starts to hold and again after its cooldown while it still holds
+type AlertRuleEvent struct {
+	Rule      string   `json:"rule"`
+	Condition string   `json:"condition"`
+	Value     float64  `json:"value"`
+	Channels  []string `json:"channels"` // empty notifies all channels
+	Message   string   `json:"message"`
+}
+
+// RuleEngine evaluates [Config.AlertRules] over the state of a single scale
+type RuleEngine struct {
+	mux        sync.Mutex
+	rules      []AlertRule
+	conditions []ruleCondition
+	cooldowns  []time.Duration
+	notified   map[string]time.Time // rule => last notification while it holds, missing if it does not hold
+}
+
+func NewRuleEngine(config *Config) *RuleEngine {
+	engine := &RuleEngine{mux: sync.Mutex{}, notified: map[string]time.Time{}}
+	for _, rule := range config.AlertRules {
+		condition, err := ParseRuleCondition(rule.Condition)
+		if err != nil {
+			continue // already validated
+		}
+		cooldown := config.NotifyCooldown
+		if rule.Cooldown != "" {
+			cooldown, _ = time.ParseDuration(rule.Cooldown)
+		}
+
+		engine.rules = append(engine.rules, rule)
+		engine.conditions = append(engine.conditions, condition)
+		engine.cooldowns = append(engine.cooldowns, cooldown)
+	}
+
+	return engine
+}
+
+// Evaluate returns events of rules which are due to notify, values of unknown metrics are missing
+func (re *RuleEngine) Evaluate(values map[string]float64, open bool, now time.Time) []AlertRuleEvent {
+	re.mux.Lock()
+	defer re.mux.Unlock()
+
+	events := []AlertRuleEvent{}
+	for i, rule := range re.rules {
+		condition := re.conditions[i]
+		value, known := values[condition.metric]
+		if !known || (rule.OpenOnly && !open) || !condition.holds(value) {
+			delete(re.notified, rule.Name)
+			continue
+		}
+		if last, found := re.notified[rule.Name]; found && now.Sub(last) < re.cooldowns[i] {
+			continue
+		}
+		re.notified[rule.Name] = now
+
+		events = append(events, AlertRuleEvent{
+			Rule:      rule.Name,
+			Condition: rule.Condition,
+			Value:     value,
+			Channels:  rule.Channels,
+			Message:   ruleMessage(rule, condition, value),
+		})
+	}
+
+	return events
+}
+
+// NextChange returns when a data age rule starts to hold without new messages
+// zero if there is no such rule or all of them already hold, the recheck would spin on a deadline in the past
+func (re *RuleEngine) NextChange(lastOk, now time.Time) time.Time {
+	re.mux.Lock()
+	defer re.mux.Unlock()
+
+	next := time.Time{}
+	for _, condition := range re.conditions {
+		if condition.metric != RuleMetricDataAge || (condition.operator != ">" && condition.operator != ">=") {
+			continue
+		}
+		at := lastOk.Add(time.Duration(condition.threshold * float64(time.Second)))
+		if !at.After(now) {
+			continue
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+
+	return next
+}
+
+// ruleMessage returns the notification text of the rule
+func ruleMessage(rule AlertRule, condition ruleCondition, value float64) string {
+	formatted := strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64)
+	if condition.metric == RuleMetricDataAge {
+		formatted = (time.Duration(value) * time.Second).String()
+	}
+	if rule.Message != "" {
+		return strings.ReplaceAll(rule.Message, "{value}", formatted)
+	}
+
+	return fmt.Sprintf("🔔 %s: %s is %s (%s)", rule.Name, condition.metric, formatted, rule.Condition)
+}
+
+// ruleValues returns the current values of rule metrics, caller has to hold the lock
+func (s *Scale) ruleValues(now time.Time) map[string]float64 {
+	values := map[string]float64{
+		RuleMetricWeight:       s.Weight,
+		RuleMetricPoursPerHour: float64(s.pours.PoursPerHour(now)),
+	}
+	if s.ActiveKeg > 0 {
+		values[RuleMetricBeersLeft] = float64(s.BeersLeft)
+	}
+	if s.Rssi != 0 {
+		values[RuleMetricRssi] = s.Rssi
+	}
+	if s.Sensors.Temperature != nil {
+		values[RuleMetricTemperature] = *s.Sensors.Temperature
+	}
+	if s.Sensors.Battery != nil {
+		values[RuleMetricBattery] = *s.Sensors.Battery
+	}
+	values[RuleMetricDataAge] = math.Floor(now.Sub(s.LastOk).Seconds())
+
+	return values
+}
+
+// checkRules publishes events of alert rules due to notify, caller has to hold the lock
+func (s *Scale) checkRules(now time.Time) {
+	for _, event := range s.rules.Evaluate(s.ruleValues(now), s.Pub.IsOpen, now) {
+		s.logger.Infof("Alert rule %s holds: %s", event.Rule, event.Message)
+		s.events.Publish(AlertRuleEventType, event)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRuleCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		expected  ruleCondition
+		err       string
+	}{
+		{"beers_left < 10", ruleCondition{RuleMetricBeersLeft, "<", 10}, ""},
+		{"rssi<=-85", ruleCondition{RuleMetricRssi, "<=", -85}, ""},
+		{"temperature > 12.5", ruleCondition{RuleMetricTemperature, ">", 12.5}, ""},
+		{"data_age > 10m", ruleCondition{RuleMetricDataAge, ">", 600}, ""},
+		{"data_age >= 90", ruleCondition{RuleMetricDataAge, ">=", 90}, ""},
+		{"humidity > 80", ruleCondition{}, `unknown metric "humidity"`},
+		{"beers_left < 10m", ruleCondition{}, `threshold "10m" is not a number`},
+		{"beers_left 10", ruleCondition{}, "has no operator"},
+	}
+
+	for _, test := range tests {
+		condition, err := ParseRuleCondition(test.condition)
+		if test.err != "" {
+			assert.ErrorIs(t, err, errInvalidRule, test.condition)
+			assert.ErrorContains(t, err, test.err, test.condition)
+			continue
+		}
+		assert.Nil(t, err, test.condition)
+		assert.Equal(t, test.expected, condition, test.condition)
+	}
+}
+
+func TestRuleEngine(t *testing.T) {
+	config := NewConfig()
+	config.NotifyCooldown = time.Hour
+	config.AlertRules = []AlertRule{
+		{Name: "weak wifi", Condition: "rssi < -85", Cooldown: "10m"},
+		{Name: "no data", Condition: "data_age > 10m", OpenOnly: true, Message: "No data for {value}"},
+		{Name: "warm beer", Condition: "temperature > 12", Channels: []string{"slack"}},
+	}
+	engine := NewRuleEngine(config)
+	now := time.Now()
+
+	events := engine.Evaluate(map[string]float64{RuleMetricRssi: -90, RuleMetricDataAge: 900}, true, now)
+	assert.Equal(t, []AlertRuleEvent{
+		{Rule: "weak wifi", Condition: "rssi < -85", Value: -90, Message: "🔔 weak wifi: rssi is -90 (rssi < -85)"},
+		{Rule: "no data", Condition: "data_age > 10m", Value: 900, Message: "No data for 15m0s"},
+	}, events, "unknown temperature is not evaluated")
+
+	events = engine.Evaluate(map[string]float64{RuleMetricRssi: -91, RuleMetricDataAge: 960, RuleMetricTemperature: 13}, false, now.Add(5*time.Minute))
+	assert.Len(t, events, 1, "weak wifi within the cooldown, no data only while open")
+	assert.Equal(t, []string{"slack"}, events[0].Channels)
+
+	events = engine.Evaluate(map[string]float64{RuleMetricRssi: -92, RuleMetricTemperature: 13}, true, now.Add(11*time.Minute))
+	assert.Len(t, events, 1, "weak wifi after its cooldown, warm beer within the default cooldown")
+	assert.Equal(t, "weak wifi", events[0].Rule)
+
+	// the rule stopped to hold and holds again
+	assert.Empty(t, engine.Evaluate(map[string]float64{RuleMetricRssi: -60}, true, now.Add(12*time.Minute)))
+	assert.Len(t, engine.Evaluate(map[string]float64{RuleMetricRssi: -95}, true, now.Add(13*time.Minute)), 1)
+
+	lastOk := now.Add(-time.Minute)
+	assert.Equal(t, lastOk.Add(10*time.Minute), engine.NextChange(lastOk, now))
+	assert.True(t, engine.NextChange(now.Add(-time.Hour), now).IsZero(), "the rule already holds")
+}
+
+func TestScale_CheckRules(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	s.config.AlertRules = []AlertRule{{Name: "last beers", Condition: "beers_left < 100", Channels: []string{"telegram"}}}
+	s.rules = NewRuleEngine(s.config)
+	s.ActiveKeg = 15
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	s.Recheck()
+	var event Event
+	for event.Type != AlertRuleEventType {
+		select {
+		case event = <-events:
+		case <-time.After(time.Second):
+			t.Fatal("alert rule event not published")
+		}
+	}
+	rule := event.Data.(AlertRuleEvent)
+	assert.Equal(t, "last beers", rule.Rule)
+	assert.Equal(t, float64(s.BeersLeft), rule.Value)
+
+	// delivered only to the channels of the rule
+	telegram, slack := &fakeNotifyChannel{name: "telegram"}, &fakeNotifyChannel{name: "slack"}
+	n := NewNotifier(s.config, s, s.monitor, logrus.New())
+	n.channels = []NotifyChannel{telegram, slack}
+	n.Handle(context.Background(), event)
+	assert.Equal(t, []string{rule.Message}, telegram.sent)
+	assert.Empty(t, slack.sent)
+}
+
+func TestConfig_AlertRules(t *testing.T) {
+	t.Setenv("ALERT_RULES", `[{"name": "low", "condition": "beers_left < 10", "channels": ["sms"]}, {"name": "low", "condition": "rssi < -85", "cooldown": "soon"}]`)
+	err := NewConfig().Validate()
+	assert.ErrorContains(t, err, `ALERT_RULES: rule "low": invalid alert rule: unknown channel "sms"`)
+	assert.ErrorContains(t, err, `cooldown "soon" is not a duration`)
+	assert.ErrorContains(t, err, `rule "low" is defined more than once`)
+
+	t.Setenv("ALERT_RULES", `{"name": "low"}`)
+	assert.ErrorContains(t, NewConfig().Validate(), "ALERT_RULES: invalid rules")
+
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte("- name: no data\n  condition: data_age > 10m\n  open_only: true\n  channels: [telegram]\n"), 0o600))
+	t.Setenv("ALERT_RULES_FILE", file)
+	config := NewConfig()
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, []AlertRule{{Name: "no data", Condition: "data_age > 10m", OpenOnly: true, Channels: []string{"telegram"}}}, config.AlertRules)
+}
+
+type fakeNotifyChannel struct {
+	name string
+	sent []string
+}
+
+func (c *fakeNotifyChannel) Name() string {
+	return c.name
+}
+
+func (c *fakeNotifyChannel) Send(_ context.Context, text string) error {
+	c.sent = append(c.sent, text)
+	return nil
+}
@@ -3,27 +3,53 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"math"
+	"sort"
 	"sync"
 	"time"
 )
 
 const OkLimit = 5 * time.Minute
 
+// recheckMaxSleep limits how long the recheck worker sleeps, so it still heartbeats when idle
+const recheckMaxSleep = 5 * time.Minute
+
+// storeRetry is the interval of storage checks in degraded mode
+const storeRetry = 15 * time.Second
+
+// PourIdle is the time without new measurement after which the pour is considered finished
+const PourIdle = 15 * time.Second
+
 type Pub struct {
 	IsOpen   bool      `json:"is_open"`
 	OpenedAt time.Time `json:"open_at"`
 	ClosedAt time.Time `json:"closed_at"`
 }
 
+// PubOverride forces the pub open or closed regardless of the scale connection
+type PubOverride struct {
+	Open  bool      `json:"open"`
+	Until time.Time `json:"until"`
+}
+
+// PubSession is a finished opening of the pub
+type PubSession struct {
+	OpenedAt time.Time `json:"opened_at"`
+	ClosedAt time.Time `json:"closed_at"`
+}
+
 type Scale struct {
 	mux     sync.Mutex
+	config  *Config
 	monitor *Monitor
 
 	Weight    float64   `json:"weight"` // current scale value
 	WeightAt  time.Time `json:"last_weight_at"`
 	ActiveKeg int       `json:"active_keg"` // int value of the active keg in liters
+	KegInfo   KegInfo   `json:"keg_info"`   // info about the tapped keg
 	BeersLeft int       `json:"beers_left"` // how many beers are left in the keg
 	IsLow     bool      `json:"is_low"`     // is the keg low and needs to be replaced soon
 	Warehouse [5]int    `json:"warehouse"`  // warehouse of kegs [10l, 15l, 20l, 30l, 50l]
@@ -33,14 +59,70 @@ type Scale struct {
 	LastOk time.Time `json:"last_ok"`
 	Rssi   float64   `json:"rssi"`
 
+	Sensors Sensors `json:"-"` // the last readings, attached to live measurements
+
+	Shadow DeviceShadow `json:"shadow"`
+
+	CleaningUntil time.Time `json:"cleaning_until"` // line cleaning in progress until this time
+
+	PendingKeg *PendingKeg `json:"pending_keg"` // keg change waiting for confirmation
+
+	PubOverride *PubOverride `json:"pub_override"` // admin forced state of the pub, nil if not forced
+
+	Degraded bool `json:"degraded"` // storage is unavailable, state is kept only in memory
+
+	EmptyScale bool `json:"empty_scale"` // nothing is on the scale while the pub is open, see [Scale.checkEmptyScale]
+
+	TareShift *TareShift `json:"tare_shift"` // the scale measures negative weights, nil if it does not, see [Scale.recordTareShift]
+
+	Calibration *Calibration `json:"calibration"` // conversion of raw counts, nil if the scale was not calibrated
+	TapBeer     *TapBeer     `json:"tap_beer"`    // announced by the admin for the taplist, nil if not set
+	LastRaw     float64      `json:"last_raw"`    // last raw counts sent by the device
+	LastRawAt   time.Time    `json:"last_raw_at"`
+
+	pours  *PourTracker
+	filter *WeightFilter
+	events *Broadcaster
+	wake   chan struct{} // re-arms the recheck timer
+	alerts *AlertBoard   // alerts raised outside the scale
+	rules  *RuleEngine   // alert rules of the configuration
+
+	recheckedAt    time.Time // when the last full recheck ran, wakes never postpone the next one
+	storeCheckedAt time.Time // when the storage was checked in degraded mode the last time
+
+	schedule PubSchedule // opening hours keeping the pub open without the scale
+
+	metricsExpired bool           // device metrics were removed because of missing data
+	runawayAlerted bool           // runaway tap alert was raised for the current pour
+	closingSoon    bool           // closing soon was signaled for the current opening of the pub
+	lastMessage    *MessageCursor // last accepted message of the device, nil if none was stored
+
+	closedWeight      float64 // the highest weight since the pub closed
+	closedLossAlerted bool    // weight loss was alerted for the current closing of the pub
+
+	emptySince time.Time // the first measurement below the minimum, zero if the last one was valid
+
+	tareShifts []TareShift // resolved tare shifts, newest first
+
+	clockSkew   time.Duration // device clock minus server clock, see [Scale.SetClockSkew]
+	clockSkewAt time.Time     // zero until a signed message arrives
+
+	snapshotAt time.Time // when the runtime state was stored the last time
+
+	kegEmptyAt *time.Time // predicted empty keg, see [Scale.updateKegEta]
+
+	tap *TapAttribution // card tap waiting for the next pour
+
 	store  Storage
 	logger *logrus.Logger
-	ctx    context.Context
 }
 
-func NewScale(monitor *Monitor, store Storage, logger *logrus.Logger, ctx context.Context) *Scale {
+func NewScale(config *Config, monitor *Monitor, store Storage, logger *logrus.Logger) *Scale {
+	schedule, _ := ParsePubSchedule(config.PubSchedule) // already validated
+
 	s := &Scale{
 		mux:     sync.Mutex{},
+		config:  config,
 		monitor: monitor,
 
 		Weight:    0,
@@ -58,29 +140,109 @@ func NewScale(monitor *Monitor, store Storage, logger *logrus.Logger, ctx contex
 
 		LastOk: time.Now().Add(-9999 * time.Hour),
 
+		Shadow: NewDeviceShadow(),
+
+		CleaningUntil: time.Unix(0, 0),
+
+		pours:  NewPourTracker(config.GlassSize, config.PourMinRate, config.MaxPourDuration),
+		filter: NewWeightFilter(config.WeightFilter, config.WeightFilterWindow, config.WeightMaxDelta),
+		events: NewBroadcaster(),
+		wake:   make(chan struct{}, 1),
+		alerts: NewAlertBoard(),
+		rules:  NewRuleEngine(config),
+
+		schedule: schedule,
+
 		store:  store,
 		logger: logger,
-		ctx:    ctx,
 	}
 
 	s.loadDataFromStore()
 
-	// periodically call recheck
-	go func(s *Scale) {
-		tick := time.NewTicker(15 * time.Second)
-		defer tick.Stop()
-		for {
-			select {
-			case <-s.ctx.Done():
-				s.logger.Debug("Scale recheck stopped")
-				return
-			case <-tick.C:
-				s.Recheck()
-			}
+	return s
+}
+
+// RunRecheck calls recheck whenever some time based state is due until ctx is done
+// the timer is armed at the nearest deadline and re-armed on every change of the scale
+// it's supposed to run as a supervised worker
+func (s *Scale) RunRecheck(ctx context.Context, heartbeat func()) {
+	for {
+		timer := time.NewTimer(s.nextRecheck(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.logger.Debug("Scale recheck stopped")
+			return
+		case <-s.wake:
+			timer.Stop()
+			s.mux.Lock()
+			s.checkRules(time.Now()) // rules over measured values don't wait for the timer
+			s.mux.Unlock()
+		case <-timer.C:
+			s.checkStore()
+			s.Recheck()
 		}
-	}(s)
+		heartbeat()
+	}
+}
 
-	return s
+// nextRecheck returns how long to wait until the nearest time based change of the state
+// all deadlines are absolute, so frequent wakes (e.g. pings) only move the recheck earlier
+func (s *Scale) nextRecheck(now time.Time) time.Duration {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	next := s.recheckedAt.Add(recheckMaxSleep)
+	earlier := func(at time.Time) {
+		if !at.IsZero() && at.Before(next) {
+			next = at
+		}
+	}
+
+	if s.Pub.IsOpen {
+		earlier(s.LastOk.Add(OkLimit))
+	}
+	if !s.metricsExpired {
+		earlier(s.LastOk.Add(s.config.MetricTTL))
+	}
+	if s.isCleaning() {
+		earlier(s.CleaningUntil)
+	}
+	if s.PubOverride != nil {
+		earlier(s.PubOverride.Until)
+	}
+	earlier(s.schedule.NextChange(now))
+	earlier(s.rules.NextChange(s.LastOk, now))
+	earlier(s.pours.NextChange(PourIdle))
+	earlier(s.pours.LeavesWindow(now, occupancyWindow))
+	earlier(s.snapshotAt.Add(snapshotInterval))
+	if s.Pub.IsOpen && !s.closingSoon && s.config.ClosingSoonHour >= 0 {
+		// a faded rate is covered by pours leaving the window, only the start of the signal is armed
+		at := closingSoonAt(now, s.config.ClosingSoonHour, s.config.PubDayStart)
+		if opened := s.Pub.OpenedAt.Add(pourRateWindow); opened.After(at) {
+			at = opened
+		}
+		if at.After(now) {
+			earlier(at)
+		}
+	}
+	if s.PendingKeg != nil && s.PendingKeg.Tapped != 0 {
+		earlier(s.PendingKeg.Deadline)
+	}
+	if s.Degraded {
+		earlier(s.storeCheckedAt.Add(storeRetry))
+	}
+
+	// conditions are strict inequalities, fire just after the deadline
+	return max(next.Sub(now)+time.Millisecond, 0)
+}
+
+// wakeRecheck re-arms the recheck timer after the state has changed
+func (s *Scale) wakeRecheck() {
+	select {
+	case s.wake <- struct{}{}:
+	default: // already scheduled
+	}
 }
 
 func (s *Scale) loadDataFromStore() {
@@ -101,6 +263,16 @@ func (s *Scale) loadDataFromStore() {
 		s.monitor.activeKeg.WithLabelValues().Set(float64(activeKeg))
 	}
 
+	kegInfo, err := s.store.GetKegInfo()
+	if err == nil {
+		s.KegInfo = kegInfo
+		s.monitor.SetKegInfo(kegInfo)
+		if kegInfo.Id != "" {
+			s.monitor.AddBeers(kegInfo.Id, kegInfo.Beers)
+		}
+		s.pours.SetGlass(s.config.GlassFor(kegInfo.Beer))
+	}
+
 	beersLeft, err := s.store.GetBeersLeft()
 	if err == nil {
 		s.BeersLeft = beersLeft
@@ -116,68 +288,198 @@ func (s *Scale) loadDataFromStore() {
 	if err == nil {
 		s.Warehouse = warehouse
 	}
+
+	cleaningUntil, err := s.store.GetCleaningUntil()
+	if err == nil {
+		s.CleaningUntil = cleaningUntil
+	}
+
+	shadow, err := s.store.GetShadow()
+	if err == nil {
+		s.Shadow = shadow
+		s.updateShadowDrift()
+	}
+
+	calibration, err := s.store.GetCalibration()
+	if err == nil {
+		s.Calibration = &calibration
+	}
+
+	tapBeer, err := s.store.GetTapBeer()
+	if err == nil && tapBeer.Name != "" {
+		s.TapBeer = &tapBeer
+	}
+
+	snapshot, err := s.store.GetSnapshot()
+	if err == nil {
+		s.restoreSnapshot(snapshot)
+	}
+}
+
+// AddMeasurement processes the new weight, source is the ingestion path which produced it
+func (s *Scale) AddMeasurement(weight float64, source string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.addMeasurement(weight, time.Now(), source, s.Sensors)
 }
 
-func (s *Scale) AddMeasurement(weight float64) error {
-	if weight < 6000 || weight > 65000 {
+// AddBufferedMeasurements processes measurements buffered by the device while it was offline
+// measurements older than the current weight are only stored to the history,
+// newer ones are processed in time order like live measurements (pours, keg change, beers left)
+// it returns the number of stored and processed measurements, out of range weights are skipped
+func (s *Scale) AddBufferedMeasurements(measurements []Measurement) (int, int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	sort.SliceStable(measurements, func(i, j int) bool {
+		return measurements[i].At.Before(measurements[j].At)
+	})
+
+	stored, processed := 0, 0
+	lowest, highest := s.acceptedWeights()
+	for _, m := range measurements {
+		if m.Weight < lowest || m.Weight > highest {
+			continue
+		}
+
+		if m.At.After(s.WeightAt) {
+			if err := s.addMeasurement(m.Weight, m.At, m.Source, m.Sensors); err != nil {
+				return stored, processed, err
+			}
+			processed++
+			continue
+		}
+
+		if err := s.store.AddMeasurement(m); err != nil {
+			return stored, processed, fmt.Errorf("could not store measurement: %w", err)
+		}
+		stored++
+	}
+
+	return stored, processed, nil
+}
+
+// addMeasurement processes the weight measured at the given time
+// caller has to hold the lock
+func (s *Scale) addMeasurement(weight float64, at time.Time, source string, sensors Sensors) error {
+	if lowest, highest := s.acceptedWeights(); weight < lowest || weight > highest {
 		s.logger.Infof("Invalid weight: %f", weight)
+		if weight < -s.config.TareShiftLimit {
+			s.recordTareShift(weight, at)
+		}
+		if weight < lowest {
+			s.checkEmptyScale(weight, at)
+		}
 		return nil
 	}
+	s.clearEmptyScale()
 
-	s.mux.Lock()
-	defer s.mux.Unlock()
+	defer s.wakeRecheck()
+	defer func() {
+		s.events.Publish(StateChangeEventType, StateChangeEvent{Reason: "measurement", Weight: s.Weight})
+	}()
 
+	s.monitor.measurements.WithLabelValues(s.monitor.guard.Labels("scale_measurements_total", source)...).Inc()
+	s.monitor.sourceWeight.WithLabelValues(s.monitor.guard.Labels("scale_source_weight", source)...).Set(weight)
+
+	// the raw value is stored along the filtered one for debugging
+	measurement := Measurement{Weight: weight, At: at, Source: source, Sensors: sensors}
+	if s.filter.Enabled() {
+		filtered, accepted := s.filter.Apply(weight)
+		measurement.Weight, measurement.Raw = filtered, weight
+		if !accepted {
+			s.logger.Infof("Weight %.0f rejected as an outlier, filtered weight is %.0f", weight, filtered)
+			s.monitor.weightOutliers.WithLabelValues().Inc()
+			s.storeFailed(s.store.AddMeasurement(measurement), "measurement")
+			return nil
+		}
+		weight = filtered
+	}
+
+	previousWeight := s.Weight
 	s.Weight = weight
-	s.WeightAt = time.Now()
-	if serr := s.store.SetWeight(weight); serr != nil {
-		return fmt.Errorf("could not store weight: %w", serr)
+	s.WeightAt = measurement.At
+	// measurements are processed in memory even when the storage is down
+	s.storeFailed(s.store.SetWeight(weight), "weight")
+	s.storeFailed(s.store.SetWeightAt(s.WeightAt), "weight_at")
+	s.storeFailed(s.store.AddMeasurement(measurement), "measurement")
+
+	// weight changes during line cleaning are not pours and do not change beers left
+	if s.isCleaning() {
+		s.pours.Reset()
+		s.monitor.weight.WithLabelValues().Set(s.Weight)
+		return nil
+	}
+
+	progress, finished := s.pours.Add(measurement)
+	if finished != nil {
+		s.finishPour(*finished)
+	}
+	if progress.Active {
+		s.events.Publish(PourProgressEventType, progress)
 	}
-	if serr := s.store.SetWeightAt(s.WeightAt); serr != nil {
-		return fmt.Errorf("could not store weight_at: %w", serr)
+	if progress.Runaway && !s.runawayAlerted {
+		s.runawayAlerted = true
+		s.monitor.runawayTap.WithLabelValues().Set(1)
+		s.logger.Errorf("Runaway tap: weight is decreasing for %.0f seconds, %.0f grams lost", progress.Duration, progress.Grams)
+		s.events.Publish(RunawayTapEventType, progress)
 	}
 
+	s.checkClosedLoss(weight)
+
 	// check if keg is low
 	if !s.IsLow {
-		s.IsLow = IsKegLow(s.ActiveKeg, weight)
-		if serr := s.store.SetIsLow(s.IsLow); serr != nil {
-			return fmt.Errorf("could not store is_low: %w", serr)
+		if tare, found := s.tare(); found {
+			s.IsLow = IsKegLowFromTare(tare, weight)
+		} else {
+			s.IsLow = IsKegLow(s.ActiveKeg, weight)
+		}
+		s.storeFailed(s.store.SetIsLow(s.IsLow), "is_low")
+
+		if s.IsLow && s.KegInfo.Id != "" {
+			s.KegInfo.LowAt = at
+			s.storeFailed(s.saveKegInfo(), "keg")
+			s.events.Publish(KegLowEventType, s.KegInfo)
 		}
 	}
 
-	// we expect a new keg
-	if s.ActiveKeg == 0 || s.IsLow {
-		keg, err := GuessNewKegSize(weight)
-		if err == nil {
-			s.ActiveKeg = keg
-			if serr := s.store.SetActiveKeg(keg); serr != nil {
-				return fmt.Errorf("could not store active_keg: %w", serr)
-			}
+	// we expect a new keg or the weight jumped up - keg was replaced
+	// a smaller jump is just noise or a hand on the keg
+	jumped := previousWeight > 0 && weight-previousWeight >= s.config.KegChangeJump
+	if s.ActiveKeg == 0 || s.IsLow || jumped {
+		keg, err := GuessNewKegSize(weight, s.config.KegGuessTolerance)
+		if err == nil && s.config.KegAutoDetect {
+			s.storeFailed(s.tapKeg(keg, ""), "keg")
 
 			s.IsLow = false
-			if serr := s.store.SetIsLow(false); serr != nil {
-				return fmt.Errorf("could not store is_low: %w", serr)
-			}
+			s.storeFailed(s.store.SetIsLow(false), "is_low")
 
 			// remove keg from warehouse
-			index, err := GetWarehouseIndex(keg)
-			if err != nil {
-				return err
-			}
-			if s.Warehouse[index] > 0 {
-				s.Warehouse[index]--
-				if serr := s.store.SetWarehouse(s.Warehouse); serr != nil {
-					return fmt.Errorf("could not update store warehouse: %w", serr)
-				}
-			} else {
-				s.logger.Warnf("Keg %d is not available in the warehouse", keg)
+			taken, err := s.takeFromWarehouse(keg)
+			s.storeFailed(err, "warehouse")
+
+			// automation occasionally misfires, admin can correct the keg for a while
+			s.PendingKeg = &PendingKeg{
+				Weight:        weight,
+				DetectedAt:    s.WeightAt,
+				Guess:         keg,
+				Tapped:        keg,
+				Deadline:      s.WeightAt.Add(s.config.KegConfirmWindow),
+				fromWarehouse: taken,
 			}
+		} else if (err == nil || jumped) && s.PendingKeg == nil {
+			// unknown weight or auto detection is disabled - the keg has to be confirmed
+			s.PendingKeg = &PendingKeg{Weight: weight, DetectedAt: s.WeightAt, Guess: keg}
+			s.logger.Warnf("Keg change detected at %.0f grams, waiting for confirmation", weight)
 		}
 	}
 
-	s.BeersLeft = CalcBeersLeft(s.ActiveKeg, weight)
-	if serr := s.store.SetBeersLeft(s.BeersLeft); serr != nil {
-		return fmt.Errorf("could not store beers_left: %w", serr)
-	}
+	s.KegInfo.EndWeight = weight
+
+	tare, _ := s.tare()
+	s.BeersLeft = CalcBeersLeftFromTare(tare, weight, s.config.GlassFor(s.KegInfo.Beer))
+	s.storeFailed(s.store.SetBeersLeft(s.BeersLeft), "beers_left")
 
 	s.monitor.weight.WithLabelValues().Set(s.Weight)
 	s.monitor.beersLeft.WithLabelValues().Set(float64(s.BeersLeft))
@@ -186,11 +488,89 @@ func (s *Scale) AddMeasurement(weight float64) error {
 	return nil
 }
 
-func (s *Scale) JsonState() ([]byte, error) {
+// storeFailed switches the scale into degraded mode when a storage write failed
+// the state is kept in memory and the storage is rechecked periodically
+// caller has to hold the lock
+func (s *Scale) storeFailed(err error, what string) {
+	if err == nil {
+		return
+	}
+
+	if !s.Degraded {
+		s.logger.Errorf("Storage is unavailable, running in degraded mode: could not store %s: %v", what, err)
+	}
+	s.Degraded = true
+	s.monitor.degraded.WithLabelValues().Set(1)
+	s.wakeRecheck()
+}
+
+// checkStore leaves degraded mode when the storage is reachable again
+// current in-memory state is written back, so the storage is consistent after recovery
+func (s *Scale) checkStore() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.Degraded {
+		return
+	}
+	s.storeCheckedAt = time.Now()
+	if s.store.Ping() != nil {
+		return
+	}
+
+	errs := []error{
+		s.store.SetWeight(s.Weight),
+		s.store.SetWeightAt(s.WeightAt),
+		s.store.SetActiveKeg(s.ActiveKeg),
+		s.store.SetBeersLeft(s.BeersLeft),
+		s.store.SetIsLow(s.IsLow),
+		s.store.SetWarehouse(s.Warehouse),
+		s.store.SetKegInfo(s.KegInfo),
+	}
+	if err := errors.Join(errs...); err != nil {
+		s.logger.Warnf("Storage is reachable but the state could not be restored: %v", err)
+		return
+	}
+
+	s.Degraded = false
+	s.monitor.degraded.WithLabelValues().Set(0)
+	s.logger.Info("Storage recovered, leaving degraded mode")
+}
+
+// Flush finishes the pour in progress and writes the in-memory state to the storage
+// it's called on shutdown, after the background workers have stopped,
+// so the last measurements are not lost on deploy
+func (s *Scale) Flush() error {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
-	return json.Marshal(s)
+	if finished := s.pours.finish(); finished != nil {
+		s.finishPour(*finished)
+	}
+
+	return errors.Join(
+		s.store.SetWeight(s.Weight),
+		s.store.SetWeightAt(s.WeightAt),
+		s.store.SetActiveKeg(s.ActiveKeg),
+		s.store.SetBeersLeft(s.BeersLeft),
+		s.store.SetIsLow(s.IsLow),
+		s.store.SetWarehouse(s.Warehouse),
+		s.store.SetCleaningUntil(s.CleaningUntil),
+		s.saveKegInfo(),
+		s.saveSnapshot(time.Now()),
+	)
+}
+
+// IsDegraded returns true if the storage is unavailable and the state lives only in memory
+func (s *Scale) IsDegraded() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.Degraded
+}
+
+func (s *Scale) JsonState() ([]byte, error) {
+	return json.Marshal(s.Status())
 }
 
 func (s *Scale) Ping() {
@@ -198,18 +578,90 @@ func (s *Scale) Ping() {
 
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	defer s.wakeRecheck()
 
-	if !s.Pub.IsOpen {
-		s.monitor.pubIsOpen.WithLabelValues().Set(1)
-		s.Pub.IsOpen = true
-		s.Pub.OpenedAt = time.Now()
+	if !s.Pub.IsOpen && !s.isPubForced(false) {
+		s.openPub()
+	}
+
+	// device is back, restore metrics from the last known state
+	if s.metricsExpired {
+		s.monitor.weight.WithLabelValues().Set(s.Weight)
+		s.monitor.beersLeft.WithLabelValues().Set(float64(s.BeersLeft))
+		s.metricsExpired = false
 	}
 
 	s.LastOk = time.Now()
+	s.events.Publish(StateChangeEventType, StateChangeEvent{Reason: "ping", Weight: s.Weight})
+}
+
+// openPub opens the pub
+// caller has to hold the lock
+func (s *Scale) openPub() {
+	s.monitor.pubIsOpen.WithLabelValues().Set(1)
+	s.Pub.IsOpen = true
+	s.Pub.OpenedAt = time.Now()
+	s.closingSoon = false
+	s.closedLossAlerted = false
+	s.monitor.closedLoss.WithLabelValues().Set(0)
+	s.updateKegEta(s.Pub.OpenedAt)
+	s.events.Publish(PubOpenEventType, s.Pub)
+}
+
+// closePub closes the pub and stores the finished session
+// caller has to hold the lock
+func (s *Scale) closePub(closedAt time.Time) {
+	s.monitor.pubIsOpen.WithLabelValues().Set(0)
+	s.Pub.IsOpen = false
+	s.Pub.ClosedAt = closedAt
+	s.closedWeight = s.Weight
+	s.clearEmptyScale()
+	s.setKegEta(nil)
+	s.events.Publish(OfflineEventType, OfflineEvent{LastOk: s.LastOk})
+	if !s.Pub.OpenedAt.IsZero() {
+		s.storeFailed(s.store.AddPubSession(PubSession{OpenedAt: s.Pub.OpenedAt, ClosedAt: s.Pub.ClosedAt}), "pub_session")
+	}
+}
+
+// isPubForced returns true if the pub is forced to the given state
+// caller has to hold the lock
+func (s *Scale) isPubForced(open bool) bool {
+	return s.PubOverride != nil && s.PubOverride.Open == open && time.Now().Before(s.PubOverride.Until)
+}
+
+// SetPubOverride forces the pub open or closed for the duration, zero duration removes the override
+// e.g. the pub is open while the scale is being repaired, or closed for a private party
+func (s *Scale) SetPubOverride(open bool, duration time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	defer s.wakeRecheck()
+
+	if duration <= 0 {
+		s.PubOverride = nil
+		s.logger.Info("Pub override removed")
+		return
+	}
+
+	s.PubOverride = &PubOverride{Open: open, Until: time.Now().Add(duration)}
+	if open && !s.Pub.IsOpen {
+		s.openPub()
+	}
+	if !open && s.Pub.IsOpen {
+		s.closePub(time.Now())
+	}
+	s.logger.Infof("Pub forced open=%t until %s", open, formatDate(s.PubOverride.Until))
 }
 
 // Recheck checks various conditions and states
-// - sets the scale to not open after [OkLimit] minutes
+// - sets the scale to not open after [OkLimit] minutes unless the pub is forced open or within opening hours
+// - opens the pub within opening hours of [Config.PubSchedule] unless it's forced closed
+// - removes expired pub override
+// - removes device metrics after [Config.MetricTTL] without data
+// - finishes pour in progress after [PourIdle]
+// - updates cleaning mode metric
+// - finalizes automatically tapped keg after [Config.KegConfirmWindow]
+// - signals closing soon when pours faded after [Config.ClosingSoonHour]
+// - stores the runtime state every [snapshotInterval]
 // it should be called everytime we want to get some calculations
 // to recalculate the state of the scale
 func (s *Scale) Recheck() {
@@ -218,12 +670,165 @@ func (s *Scale) Recheck() {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
+	s.recheckedAt = time.Now()
+
+	// forced state of the pub expired
+	if s.PubOverride != nil && !time.Now().Before(s.PubOverride.Until) {
+		s.logger.Info("Pub override expired")
+		s.PubOverride = nil
+	}
+
+	// precedence of the state of the pub: admin override, opening hours, scale connection
+	scheduled := s.schedule.IsOpen(time.Now())
+	if scheduled && !s.Pub.IsOpen && !s.isPubForced(false) {
+		s.openPub()
+	}
+
 	// we haven't received any data for [OkLimit] minutes and pub is open
-	if !ok && s.Pub.IsOpen {
-		s.monitor.pubIsOpen.WithLabelValues().Set(0)
-		s.Pub.IsOpen = false
-		s.Pub.ClosedAt = time.Now().Add(-1 * OkLimit)
+	if !ok && s.Pub.IsOpen && !s.isPubForced(true) && !scheduled {
+		closedAt := time.Now().Add(-1 * OkLimit)
+		if s.schedule.IsOpen(closedAt) {
+			closedAt = time.Now() // the opening hours just ended
+		}
+		s.closePub(closedAt)
+	}
+
+	// device metrics would report frozen values, remove them
+	if !s.metricsExpired && time.Since(s.LastOk) > s.config.MetricTTL {
+		s.monitor.ExpireDeviceMetrics()
+		s.metricsExpired = true
+	}
+
+	// cleaning mode expires on its own
+	if s.isCleaning() {
+		s.monitor.cleaning.WithLabelValues().Set(1)
+	} else {
+		s.monitor.cleaning.WithLabelValues().Set(0)
+	}
+
+	// no new measurement for [PourIdle] means the pour is over
+	if finished := s.pours.Expire(time.Now(), PourIdle); finished != nil {
+		s.finishPour(*finished)
+	}
+
+	// automatically tapped keg was not corrected in time
+	if s.PendingKeg != nil && s.PendingKeg.Tapped != 0 && time.Now().After(s.PendingKeg.Deadline) {
+		s.logger.Infof("Automatically tapped %dl keg finalized", s.PendingKeg.Tapped)
+		s.PendingKeg = nil
+	}
+
+	// old pours fall out of the window even without new ones
+	s.monitor.poursPerHour.WithLabelValues().Set(float64(s.pours.PoursPerHour(time.Now())))
+	s.monitor.pours15m.WithLabelValues().Set(float64(s.pours.PoursWithin(time.Now(), occupancyWindow)))
+
+	// the last call, once per opening
+	if s.Pub.IsOpen && !s.closingSoon && s.isClosingSoon(time.Now()) {
+		s.closingSoon = true
+		event := ClosingSoonEvent{PoursPerHour: s.pours.PoursPerHour(time.Now()), Threshold: s.config.ClosingSoonRate, OpenedAt: s.Pub.OpenedAt}
+		s.logger.Infof("Pub is closing soon, %d pours in the last hour", event.PoursPerHour)
+		s.events.Publish(ClosingSoonEventType, event)
+	}
+
+	s.checkRules(time.Now())
+
+	if time.Since(s.snapshotAt) >= snapshotInterval {
+		s.storeFailed(s.saveSnapshot(time.Now()), "snapshot")
+	}
+}
+
+// isClosingSoon returns true if the pour rate fell below [Config.ClosingSoonRate] after [Config.ClosingSoonHour]
+// the pub has to be open for the whole rate window, so the rate is not low just because it just opened
+// caller has to hold the lock
+func (s *Scale) isClosingSoon(now time.Time) bool {
+	if s.config.ClosingSoonHour < 0 {
+		return false
+	}
+	if now.Before(closingSoonAt(now, s.config.ClosingSoonHour, s.config.PubDayStart)) {
+		return false
+	}
+	if now.Sub(s.Pub.OpenedAt) < pourRateWindow {
+		return false
+	}
+
+	return s.pours.PoursPerHour(now) < s.config.ClosingSoonRate
+}
+
+// finishPour records the finished pour
+func (s *Scale) finishPour(pour PourProgress) {
+	if s.runawayAlerted {
+		s.runawayAlerted = false
+		s.monitor.runawayTap.WithLabelValues().Set(0)
+	}
+
+	// the first pour after tapping fills the line, that beer is not served
+	if s.KegInfo.Pours == 0 && s.KegInfo.LineGrams == 0 && s.config.LineVolume > 0 {
+		line := math.Min(pour.Grams, s.config.LineVolume)
+		s.KegInfo.LineGrams = line
+		pour.Grams -= line
+		pour.Percent = math.Round(pour.Grams/s.config.GlassFor(s.KegInfo.Beer)*1000) / 10
+	}
+
+	if pour.Grams < pourMinDrop {
+		// the whole pour only filled the line
+		if err := s.saveKegInfo(); err != nil {
+			s.logger.Warnf("Could not store pour statistics: %v", err)
+		}
+		return
+	}
+
+	record := NewPour(pour, s.config.GlassFor(s.KegInfo.Beer), s.KegInfo.Id)
+	s.KegInfo.Pours++
+	s.KegInfo.PouredGrams += pour.Grams
+	s.KegInfo.Beers += record.Glasses
+	if err := s.saveKegInfo(); err != nil {
+		s.logger.Warnf("Could not store pour statistics: %v", err)
 	}
+	if s.tap != nil && s.tap.Matches(pour.StartedAt, s.config.TapWindow) {
+		record.Person = s.tap.PersonId
+	}
+	s.tap = nil
+	s.storeFailed(s.store.AddPour(record), "pour")
+
+	s.monitor.pourSize.WithLabelValues().Observe(pour.Grams)
+	s.monitor.pours.WithLabelValues().Inc()
+	s.monitor.AddBeers(s.KegInfo.Id, record.Glasses)
+	s.monitor.poursPerHour.WithLabelValues().Set(float64(s.pours.PoursPerHour(time.Now())))
+	s.monitor.pours15m.WithLabelValues().Set(float64(s.pours.PoursWithin(time.Now(), occupancyWindow)))
+	s.updateKegEta(time.Now())
+	s.events.Publish(PourProgressEventType, pour)
+	s.events.Publish(PourEventType, pour)
+}
+
+// errUnknownTapToken is returned for cards not registered to anybody
+var errUnknownTapToken = errors.New("unknown tap token")
+
+// Tap attributes the next pour to the holder of the card
+// another tap before the pour replaces the previous one
+func (s *Scale) Tap(token string, at time.Time) (Person, error) {
+	people, err := s.store.GetPeople()
+	if err != nil {
+		return Person{}, fmt.Errorf("could not load people: %w", err)
+	}
+	person, found := findPersonByToken(people, token)
+	if !found {
+		return Person{}, errUnknownTapToken
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.tap = &TapAttribution{PersonId: person.Id, At: at}
+	s.logger.Infof("Next pour is attributed to %s", person.Id)
+	return person, nil
+}
+
+// PoursPerHour returns number of pours within the last hour
+// busyness indicator for staffing decisions
+func (s *Scale) PoursPerHour() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.pours.PoursPerHour(time.Now())
 }
 
 // IsOk returns true if the scale is ok based on the last update time
@@ -244,8 +849,178 @@ func (s *Scale) SetRssi(rssi float64) {
 	s.Rssi = rssi
 }
 
+// SetSensors sets readings of the optional sensors reported with the message
+// a missing reading removes the metric, so a disconnected sensor does not report a frozen value
+func (s *Scale) SetSensors(sensors Sensors) {
+	if sensors.Temperature != nil {
+		s.monitor.temperature.WithLabelValues().Set(*sensors.Temperature)
+	} else {
+		s.monitor.temperature.Reset()
+	}
+	if sensors.Battery != nil {
+		s.monitor.battery.WithLabelValues().Set(*sensors.Battery)
+	} else {
+		s.monitor.battery.Reset()
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.Sensors = sensors
+}
+
+// GetSensors returns the last readings of the optional sensors
+func (s *Scale) GetSensors() Sensors {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.Sensors
+}
+
 // SetActiveKeg sets the current active keg
-func (s *Scale) SetActiveKeg(keg int) error {
+func (s *Scale) SetActiveKeg(keg int, beer string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.IsLow = false
+	if err := s.store.SetIsLow(false); err != nil {
+		return err
+	}
+
+	return s.tapKeg(keg, beer)
+}
+
+// tapKeg sets a new active keg and its info
+// caller has to hold the lock
+func (s *Scale) tapKeg(keg int, beer string) error {
+	previous := s.KegInfo
+	if err := s.finishKeg(time.Now()); err != nil {
+		return err
+	}
+
+	s.ActiveKeg = keg
+	if err := s.store.SetActiveKeg(keg); err != nil {
+		return fmt.Errorf("could not store active_keg: %w", err)
+	}
+
+	s.PendingKeg = nil
+	s.closedWeight = 0 // a lighter keg tapped while closed is not a loss
+	s.KegInfo = NewKegInfo(keg, beer, time.Now(), s.Weight)
+	s.pours.SetGlass(s.config.GlassFor(beer))
+	if err := s.saveKegInfo(); err != nil {
+		return err
+	}
+	s.monitor.SetKegInfo(s.KegInfo)
+	s.monitor.AddBeers(s.KegInfo.Id, 0)
+	s.setKegEta(nil)
+	s.events.Publish(KegChangeEventType, s.KegInfo)
+	s.publishChangeover(previous)
+
+	return nil
+}
+
+// finishKeg moves the active keg into the history of finished kegs
+// caller has to hold the lock
+func (s *Scale) finishKeg(now time.Time) error {
+	if s.KegInfo.Id == "" {
+		return nil
+	}
+
+	s.KegInfo.FinishedAt = now
+	if err := s.store.SaveKeg(s.KegInfo); err != nil {
+		return fmt.Errorf("could not store finished keg: %w", err)
+	}
+
+	return nil
+}
+
+// publishChangeover publishes the changeover if the active keg holds a different beer than the previous one
+// the glass size of the beer is already applied to pours by the caller
+// caller has to hold the lock
+func (s *Scale) publishChangeover(previous KegInfo) {
+	changeover, ok := Changeover(previous, s.KegInfo, s.config)
+	if !ok {
+		return
+	}
+
+	s.logger.Infof("Beer changed from %s to %s, glass is %.0f g", changeover.FromBeer, changeover.ToBeer, changeover.Glass)
+	s.events.Publish(ChangeoverEventType, changeover)
+}
+
+// AcceptedWeights returns the range of valid measurements in grams
+func (s *Scale) AcceptedWeights() (float64, float64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.acceptedWeights()
+}
+
+// acceptedWeights returns the range of valid measurements in grams
+// the configured range is widened to fit the active keg, so a small keg or a light platform
+// is not rejected, it's never narrowed, any keg has to be accepted when the keg is replaced
+// caller has to hold the lock
+func (s *Scale) acceptedWeights() (float64, float64) {
+	lowest, highest := s.config.MinWeight, s.config.MaxWeight
+
+	if tare, found := s.tare(); found {
+		lowest = min(lowest, tare-s.config.KegGuessTolerance)
+		highest = max(highest, tare+float64(s.ActiveKeg)*1000+s.config.KegGuessTolerance)
+	}
+
+	return max(lowest, 0), highest
+}
+
+// tare returns empty weight of the active keg
+// measured weight of its model takes precedence over the default of the size
+// caller has to hold the lock
+func (s *Scale) tare() (float64, bool) {
+	if s.KegInfo.EmptyWeight > 0 && s.KegInfo.Size == s.ActiveKeg {
+		return s.KegInfo.EmptyWeight, true
+	}
+
+	weight, found := GetEmptyWeights()[s.ActiveKeg]
+	return weight, found
+}
+
+// SetKegModel assigns the model from the lookup table to the active keg, empty id removes it
+// beers left are recomputed with the measured empty weight of the model
+func (s *Scale) SetKegModel(id string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	model := KegModel{Size: s.ActiveKeg}
+	if id != "" {
+		models, err := s.store.GetKegModels()
+		if err != nil {
+			return fmt.Errorf("could not load keg models: %w", err)
+		}
+		model, err = findKegModel(models, id)
+		if err != nil {
+			return err
+		}
+		if model.Size != s.ActiveKeg {
+			return fmt.Errorf("keg model %s is %dl, but %dl keg is tapped", id, model.Size, s.ActiveKeg)
+		}
+	}
+
+	return s.applyKegModel(model)
+}
+
+// TapKegModel taps a new keg from the catalog, its size and tare are given by the model
+// empty beer uses the beer of the model
+func (s *Scale) TapKegModel(id string, beer string) error {
+	models, err := s.store.GetKegModels()
+	if err != nil {
+		return fmt.Errorf("could not load keg models: %w", err)
+	}
+	model, err := findKegModel(models, id)
+	if err != nil {
+		return err
+	}
+	if beer == "" {
+		beer = model.Beer
+	}
+
 	s.mux.Lock()
 	defer s.mux.Unlock()
 
@@ -253,9 +1028,206 @@ func (s *Scale) SetActiveKeg(keg int) error {
 	if err := s.store.SetIsLow(false); err != nil {
 		return err
 	}
+	if err := s.tapKeg(model.Size, beer); err != nil {
+		return err
+	}
+
+	return s.applyKegModel(model)
+}
+
+// applyKegModel sets tare of the active keg and recomputes beers left
+// caller has to hold the lock
+func (s *Scale) applyKegModel(model KegModel) error {
+	s.KegInfo.Model = model.Id
+	s.KegInfo.EmptyWeight = model.EmptyWeight
+	if err := s.saveKegInfo(); err != nil {
+		return err
+	}
+
+	tare, _ := s.tare()
+	s.BeersLeft = CalcBeersLeftFromTare(tare, s.Weight, s.config.GlassFor(s.KegInfo.Beer))
+	if err := s.store.SetBeersLeft(s.BeersLeft); err != nil {
+		return fmt.Errorf("could not store beers_left: %w", err)
+	}
+	s.monitor.beersLeft.WithLabelValues().Set(float64(s.BeersLeft))
+
+	s.logger.Infof("Keg model of the active keg set to %q", model.Id)
+	return nil
+}
+
+// GetPendingKeg returns keg change waiting for confirmation or nil
+func (s *Scale) GetPendingKeg() *PendingKeg {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.PendingKeg
+}
+
+// DismissPendingKeg forgets the detected keg change (e.g. somebody just put a crate on the scale)
+// automatically tapped keg is confirmed as it is
+func (s *Scale) DismissPendingKeg() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.PendingKeg = nil
+}
+
+// CorrectPendingKeg replaces the automatically tapped keg with the given one
+// the keg keeps its identity and statistics, only size and beer are changed
+// keg which was not tapped automatically is just tapped
+func (s *Scale) CorrectPendingKeg(keg int, beer string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	pending := s.PendingKeg
+	if pending == nil {
+		return fmt.Errorf("no keg change is waiting for confirmation")
+	}
+	if pending.Tapped == 0 {
+		return s.tapKeg(keg, beer)
+	}
+
+	if err := s.returnPendingToWarehouse(); err != nil {
+		return err
+	}
+	if _, err := s.takeFromWarehouse(keg); err != nil {
+		return err
+	}
 
 	s.ActiveKeg = keg
-	return s.store.SetActiveKeg(keg)
+	if err := s.store.SetActiveKeg(keg); err != nil {
+		return fmt.Errorf("could not store active_keg: %w", err)
+	}
+
+	if s.KegInfo.Size != keg {
+		// the model was given for the wrong size
+		s.KegInfo.Model = ""
+		s.KegInfo.EmptyWeight = 0
+	}
+	s.KegInfo.Size = keg
+	s.KegInfo.Beer = beer
+	s.pours.SetGlass(s.config.GlassFor(beer))
+	if err := s.saveKegInfo(); err != nil {
+		return err
+	}
+
+	tare, _ := s.tare()
+	s.BeersLeft = CalcBeersLeftFromTare(tare, s.Weight, s.config.GlassFor(beer))
+	if err := s.store.SetBeersLeft(s.BeersLeft); err != nil {
+		return fmt.Errorf("could not store beers_left: %w", err)
+	}
+
+	s.monitor.SetKegInfo(s.KegInfo)
+	s.monitor.activeKeg.WithLabelValues().Set(float64(keg))
+	s.monitor.beersLeft.WithLabelValues().Set(float64(s.BeersLeft))
+	s.events.Publish(KegChangeEventType, s.KegInfo)
+	// the automatically tapped keg had no beer, the changeover is known only now
+	if kegs, err := s.store.GetKegs(); err == nil {
+		if previous, found := previousKeg(kegs, s.KegInfo); found {
+			s.publishChangeover(previous)
+		}
+	}
+
+	s.PendingKeg = nil
+	s.logger.Infof("Automatically tapped %dl keg corrected to %dl", pending.Tapped, keg)
+	return nil
+}
+
+// actions of the keg button
+const (
+	KegButtonConfirmed = "confirmed" // automatically tapped keg is confirmed
+	KegButtonTapped    = "tapped"    // keg recognized by its weight is tapped
+	KegButtonWizard    = "wizard"    // keg is not known, the display has to ask for it
+)
+
+// PressKegButton handles the "keg change now" button at the bar
+// the pending keg change is confirmed when its keg is known, otherwise the display is asked to open the tap wizard
+func (s *Scale) PressKegButton() (KegButtonEvent, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	pending := s.PendingKeg
+	event := KegButtonEvent{Action: KegButtonWizard, PendingKeg: pending}
+
+	switch {
+	case pending != nil && pending.Tapped != 0:
+		s.PendingKeg = nil
+		event.Action = KegButtonConfirmed
+		s.logger.Infof("Automatically tapped %dl keg confirmed by the button", pending.Tapped)
+	case pending != nil && pending.Guess != 0:
+		s.IsLow = false
+		if err := s.store.SetIsLow(false); err != nil {
+			return event, err
+		}
+		if err := s.tapKeg(pending.Guess, ""); err != nil {
+			return event, err
+		}
+		if _, err := s.takeFromWarehouse(pending.Guess); err != nil {
+			return event, err
+		}
+		event.Action = KegButtonTapped
+		s.logger.Infof("Detected %dl keg tapped by the button", pending.Guess)
+	}
+
+	event.Keg = s.ActiveKeg
+	s.events.Publish(KegButtonEventType, event)
+
+	return event, nil
+}
+
+// takeFromWarehouse removes the keg from the warehouse
+// it returns false if the keg was not available there
+// caller has to hold the lock
+func (s *Scale) takeFromWarehouse(keg int) (bool, error) {
+	index, err := GetWarehouseIndex(keg)
+	if err != nil {
+		return false, err
+	}
+
+	if s.Warehouse[index] == 0 {
+		s.logger.Warnf("Keg %d is not available in the warehouse", keg)
+		return false, nil
+	}
+
+	s.Warehouse[index]--
+	if err := s.store.SetWarehouse(s.Warehouse); err != nil {
+		return false, fmt.Errorf("could not update store warehouse: %w", err)
+	}
+
+	return true, nil
+}
+
+// returnPendingToWarehouse returns the misdetected keg taken from the warehouse by the automation
+// caller has to hold the lock
+func (s *Scale) returnPendingToWarehouse() error {
+	pending := s.PendingKeg
+	if pending == nil || !pending.fromWarehouse {
+		return nil
+	}
+
+	index, err := GetWarehouseIndex(pending.Tapped)
+	if err != nil {
+		return err
+	}
+	s.Warehouse[index]++
+	if err := s.store.SetWarehouse(s.Warehouse); err != nil {
+		return fmt.Errorf("could not update store warehouse: %w", err)
+	}
+
+	return nil
+}
+
+// saveKegInfo stores the active keg and its history record
+// caller has to hold the lock
+func (s *Scale) saveKegInfo() error {
+	if err := s.store.SetKegInfo(s.KegInfo); err != nil {
+		return fmt.Errorf("could not store keg_info: %w", err)
+	}
+	if err := s.store.SaveKeg(s.KegInfo); err != nil {
+		return fmt.Errorf("could not store keg: %w", err)
+	}
+
+	return nil
 }
 
 func (s *Scale) IncreaseWarehouse(keg int) error {
@@ -287,3 +1259,203 @@ func (s *Scale) DecreaseWarehouse(keg int) error {
 
 	return nil
 }
+
+// SetDesiredConfig replaces desired configuration of the device
+func (s *Scale) SetDesiredConfig(desired map[string]string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.Shadow.Desired = desired
+	s.Shadow.DesiredAt = time.Now()
+	s.Shadow.PendingReports = 0
+	s.updateShadowDrift()
+
+	return s.store.SetShadow(s.Shadow)
+}
+
+// AddRawMeasurement converts raw counts with the stored calibration and adds the measurement
+func (s *Scale) AddRawMeasurement(raw float64, source string) error {
+	s.mux.Lock()
+	s.LastRaw = raw
+	s.LastRawAt = time.Now()
+	calibration := s.Calibration
+	s.mux.Unlock()
+
+	if calibration == nil {
+		return fmt.Errorf("scale is not calibrated, raw value %.0f can't be converted", raw)
+	}
+
+	return s.AddMeasurement(calibration.Convert(raw), source)
+}
+
+// SetCalibration replaces the conversion of raw counts
+func (s *Scale) SetCalibration(calibration Calibration) error {
+	if err := calibration.Validate(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	calibration.UpdatedAt = time.Now()
+	if err := s.store.SetCalibration(calibration); err != nil {
+		return fmt.Errorf("could not store calibration: %w", err)
+	}
+
+	s.Calibration = &calibration
+	s.resolveTareShift(TareShiftRecalibrated, calibration.UpdatedAt)
+	if len(calibration.Points) > 0 {
+		s.logger.Infof("Scale calibrated: curve with %d points", len(calibration.Points))
+	} else {
+		s.logger.Infof("Scale calibrated: offset %.0f, factor %.4f", calibration.Offset, calibration.Factor)
+	}
+	return nil
+}
+
+// GetCalibrationHistory returns previous calibrations, newest first
+func (s *Scale) GetCalibrationHistory() ([]Calibration, error) {
+	return s.store.GetCalibrationHistory()
+}
+
+// GetCalibration returns the current calibration (nil if there is none) and the last raw value
+func (s *Scale) GetCalibration() (*Calibration, float64, time.Time) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.Calibration, s.LastRaw, s.LastRawAt
+}
+
+// ReportConfig stores configuration reported by the device
+// and checks whether the desired configuration has been applied
+func (s *Scale) ReportConfig(reported map[string]string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.Shadow.Reported = reported
+	s.Shadow.ReportedAt = time.Now()
+	if s.Shadow.InSync() {
+		s.Shadow.PendingReports = 0
+	} else {
+		s.Shadow.PendingReports++
+		s.logger.Warnf("Device has not applied desired config yet: %s", FormatConfig(s.Shadow.Delta()))
+	}
+	s.updateShadowDrift()
+
+	return s.store.SetShadow(s.Shadow)
+}
+
+// GetShadow returns a copy of the current device shadow
+func (s *Scale) GetShadow() DeviceShadow {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.Shadow
+}
+
+// updateShadowDrift sets drift metric
+// device drifts if it has not applied desired config within [Config.ShadowMaxReports] reports
+func (s *Scale) updateShadowDrift() {
+	drift := 0.0
+	if s.Shadow.PendingReports >= s.config.ShadowMaxReports {
+		drift = 1
+	}
+	s.monitor.shadowDrift.WithLabelValues().Set(drift)
+}
+
+// SetCleaning starts line cleaning for the given duration or stops it (zero duration)
+// weight changes during cleaning are excluded from pours and beers left
+func (s *Scale) SetCleaning(duration time.Duration) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	defer s.wakeRecheck()
+
+	if duration > 0 {
+		s.CleaningUntil = time.Now().Add(duration)
+		s.monitor.cleaning.WithLabelValues().Set(1)
+		s.logger.Infof("Line cleaning started until %s", formatDate(s.CleaningUntil))
+	} else {
+		s.CleaningUntil = time.Unix(0, 0)
+		s.monitor.cleaning.WithLabelValues().Set(0)
+		s.logger.Info("Line cleaning stopped")
+	}
+
+	s.pours.Reset()
+	return s.store.SetCleaningUntil(s.CleaningUntil)
+}
+
+// isCleaning returns true if line cleaning is in progress
+// caller has to hold the lock
+func (s *Scale) isCleaning() bool {
+	return time.Now().Before(s.CleaningUntil)
+}
+
+// ReceiveAlerts merges external alerts into the event stream
+func (s *Scale) ReceiveAlerts(webhook AlertmanagerWebhook) {
+	for _, alert := range s.alerts.Apply(webhook) {
+		if alert.Firing {
+			s.logger.Warnf("External alert %s is firing: %s", alert.Name, alert.Summary)
+		} else {
+			s.logger.Infof("External alert %s is resolved", alert.Name)
+		}
+		s.events.Publish(ExternalAlertEventType, alert)
+	}
+}
+
+// ActiveAlerts returns firing external alerts
+func (s *Scale) ActiveAlerts() []ExternalAlert {
+	return s.alerts.Active()
+}
+
+// TagSession labels the current pub session, empty tag removes the label
+func (s *Scale) TagSession(tag string) (SessionTag, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.Pub.IsOpen {
+		return SessionTag{}, fmt.Errorf("the pub is closed, there is no session to tag")
+	}
+
+	sessionTag := SessionTag{OpenedAt: s.Pub.OpenedAt, Tag: tag}
+	if err := s.store.SetSessionTag(sessionTag); err != nil {
+		return SessionTag{}, fmt.Errorf("could not store session tag: %w", err)
+	}
+
+	return sessionTag, nil
+}
+
+// ClearMeasurements deletes the measurement history in [from, to)
+// used after test sessions or calibration experiments polluted the data
+// the pour in progress is forgotten when the latest measurement is deleted
+func (s *Scale) ClearMeasurements(from, to time.Time) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	deleted, err := s.store.DeleteMeasurements(from, to)
+	if err != nil {
+		return 0, fmt.Errorf("could not delete measurements: %w", err)
+	}
+
+	if !s.WeightAt.Before(from) && s.WeightAt.Before(to) {
+		s.pours.Reset()
+	}
+
+	s.logger.Infof("Deleted %d measurements between %s and %s", deleted, formatDate(from), formatDate(to))
+	return deleted, nil
+}
+
+// GetKegYield returns yield statistics of the active or a historical keg
+func (s *Scale) GetKegYield(id string) (KegYield, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	keg := s.KegInfo
+	if id != keg.Id || id == "" {
+		var err error
+		keg, err = s.store.GetKeg(id)
+		if err != nil {
+			return KegYield{}, err
+		}
+	}
+
+	return CalcKegYield(keg, s.config.GlassFor(keg.Beer), s.Weight, time.Now()), nil
+}
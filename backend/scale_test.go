@@ -6,6 +6,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestScale_AddMeasurement(t *testing.T) {
@@ -17,9 +18,593 @@ func CreateScaleWithMeasurements(weights ...float64) *Scale {
 	logger := logrus.New()
 	var buf bytes.Buffer
 	logger.SetOutput(&buf)
-	s := NewScale(NewMonitor(), &FakeStore{}, logger, context.Background())
+	s := NewScale(NewConfig(), NewMonitor(), &FakeStore{}, logger)
 	for _, weight := range weights {
-		_ = s.AddMeasurement(weight * 1000)
+		_ = s.AddMeasurement(weight*1000, SourceHttp)
 	}
 	return s
 }
+
+func TestScale_WeightBounds(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	s.config.MinWeight = 3000 // lighter platform
+
+	assert.Nil(t, s.AddMeasurement(4500, SourceHttp))
+	assert.Equal(t, 4500.0, s.Weight)
+	assert.Nil(t, s.AddMeasurement(2500, SourceHttp))
+	assert.Nil(t, s.AddMeasurement(70000, SourceHttp))
+	assert.Equal(t, 4500.0, s.Weight, "out of bounds")
+}
+
+func TestScale_AcceptedWeights(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	lowest, highest := s.AcceptedWeights()
+	assert.Equal(t, 6000.0, lowest, "no keg, configured range")
+	assert.Equal(t, 65000.0, highest)
+
+	assert.Nil(t, s.AddMeasurement(16000, SourceHttp)) // full 10l keg
+	assert.Equal(t, 10, s.ActiveKeg)
+	lowest, _ = s.AcceptedWeights()
+	assert.Equal(t, 4000.0, lowest, "empty 10l keg minus the tolerance")
+	assert.Nil(t, s.AddMeasurement(5500, SourceHttp))
+	assert.Equal(t, 5500.0, s.Weight)
+
+	s.KegInfo.EmptyWeight = 3200 // measured keg model on a lighter platform
+	lowest, _ = s.AcceptedWeights()
+	assert.Equal(t, 1200.0, lowest)
+}
+
+func TestScale_CleaningSuspendsBeersLeft(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	beers := s.BeersLeft
+
+	assert.Nil(t, s.SetCleaning(time.Hour))
+	assert.Nil(t, s.AddMeasurement(16000, SourceHttp))
+	assert.Equal(t, 16000.0, s.Weight)
+	assert.Equal(t, beers, s.BeersLeft)
+
+	assert.Nil(t, s.SetCleaning(0))
+	assert.Nil(t, s.AddMeasurement(16000, SourceHttp))
+	assert.Less(t, s.BeersLeft, beers)
+}
+
+func TestScale_KegChangeInference(t *testing.T) {
+	s := CreateScaleWithMeasurements(22, 10) // 15l keg tapped and partially consumed
+	assert.Equal(t, 15, s.ActiveKeg)
+
+	// replaced by a full 10l keg
+	assert.Nil(t, s.AddMeasurement(16000, SourceHttp))
+	assert.Equal(t, 10, s.ActiveKeg)
+	assert.NotNil(t, s.PendingKeg)
+	assert.Equal(t, 10, s.PendingKeg.Tapped)
+	s.DismissPendingKeg()
+
+	// unknown weight jump needs confirmation
+	assert.Nil(t, s.AddMeasurement(40000, SourceHttp))
+	assert.Equal(t, 10, s.ActiveKeg)
+	assert.NotNil(t, s.PendingKeg)
+	assert.Equal(t, 0, s.PendingKeg.Guess)
+
+	assert.Nil(t, s.SetActiveKeg(30, "Pilsner"))
+	assert.Nil(t, s.PendingKeg)
+}
+
+func TestScale_CorrectPendingKeg(t *testing.T) {
+	s := CreateScaleWithMeasurements(10, 16) // 10l keg recognized automatically
+	assert.Equal(t, 10, s.ActiveKeg)
+	assert.NotNil(t, s.PendingKeg)
+	id := s.KegInfo.Id
+
+	assert.Equal(t, [5]int{0, 2, 3, 4, 5}, s.Warehouse)
+	assert.Nil(t, s.CorrectPendingKeg(15, "Weizen"))
+	assert.Nil(t, s.PendingKeg)
+	assert.Equal(t, 15, s.ActiveKeg)
+	assert.Equal(t, id, s.KegInfo.Id)
+	assert.Equal(t, "Weizen", s.KegInfo.Beer)
+	assert.Equal(t, [5]int{1, 1, 3, 4, 5}, s.Warehouse)
+
+	assert.NotNil(t, s.CorrectPendingKeg(20, ""), "nothing to correct")
+}
+
+func TestScale_AddBufferedMeasurements(t *testing.T) {
+	s := CreateScaleWithMeasurements(30)
+	last := s.WeightAt
+
+	stored, processed, err := s.AddBufferedMeasurements([]Measurement{
+		{Weight: 29000, At: last.Add(20 * time.Second), Source: SourceBatch},
+		{Weight: 31000, At: last.Add(-time.Minute), Source: SourceBatch},
+		{Weight: 29500, At: last.Add(10 * time.Second), Source: SourceBatch},
+		{Weight: 90000, At: last.Add(30 * time.Second), Source: SourceBatch},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stored, "older than the current weight")
+	assert.Equal(t, 2, processed)
+	assert.Equal(t, 29000.0, s.Weight, "the latest buffered weight")
+	assert.Equal(t, last.Add(20*time.Second), s.WeightAt)
+
+	history, err := s.store.GetMeasurements(last.Add(-time.Hour), last.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, history, 4)
+	assert.Equal(t, 31000.0, history[0].Weight, "history is ordered by time")
+}
+
+func TestScale_PressKegButton(t *testing.T) {
+	s := CreateScaleWithMeasurements(10, 16) // 10l keg recognized automatically
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	event, err := s.PressKegButton()
+	assert.Nil(t, err)
+	assert.Equal(t, KegButtonConfirmed, event.Action)
+	assert.Equal(t, 10, event.Keg)
+	assert.Nil(t, s.PendingKeg)
+	published := <-events
+	assert.Equal(t, KegButtonEventType, published.Type)
+
+	event, err = s.PressKegButton()
+	assert.Nil(t, err)
+	assert.Equal(t, KegButtonWizard, event.Action, "nothing detected")
+	assert.Nil(t, event.PendingKeg)
+
+	// the keg was recognized, but auto detection is off
+	s.config.KegAutoDetect = false
+	assert.Nil(t, s.AddMeasurement(22000, SourceHttp))
+	assert.Equal(t, 15, s.PendingKeg.Guess)
+	event, err = s.PressKegButton()
+	assert.Nil(t, err)
+	assert.Equal(t, KegButtonTapped, event.Action)
+	assert.Equal(t, 15, s.ActiveKeg)
+	assert.Equal(t, 15, event.Keg)
+	assert.Nil(t, s.PendingKeg)
+}
+
+func TestScale_Changeover(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.BeerGlasses = map[string]float64{"weizen": 400}
+	s := NewScale(config, NewMonitor(), &FakeStore{}, logger)
+	assert.Nil(t, s.SetActiveKeg(30, "Pilsner"))
+
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	assert.Nil(t, s.SetActiveKeg(30, "pilsner "))
+	assert.Equal(t, KegChangeEventType, (<-events).Type)
+	assert.Len(t, events, 0, "the same beer")
+
+	assert.Nil(t, s.SetActiveKeg(50, "Weizen"))
+	assert.Equal(t, KegChangeEventType, (<-events).Type)
+	event := <-events
+	assert.Equal(t, ChangeoverEventType, event.Type)
+	assert.Equal(t, ChangeoverEvent{KegId: s.KegInfo.Id, FromBeer: "pilsner ", ToBeer: "Weizen", Glass: 400}, event.Data)
+}
+
+func TestScale_Snapshot(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	store := &FakeStore{}
+	s := NewScale(NewConfig(), NewMonitor(), store, logger)
+	s.Ping()
+	s.SetRssi(-61)
+	assert.True(t, s.Pub.IsOpen)
+	assert.Nil(t, s.Flush())
+
+	// redeploy
+	restarted := NewScale(NewConfig(), NewMonitor(), store, logger)
+	assert.True(t, restarted.Pub.IsOpen)
+	assert.Equal(t, s.Pub.OpenedAt.Unix(), restarted.Pub.OpenedAt.Unix())
+	assert.Equal(t, -61.0, restarted.Rssi)
+	restarted.Recheck()
+	assert.True(t, restarted.Pub.IsOpen, "the device is still ok")
+
+	// the backend was down for a while
+	store.snapshot.LastOk = time.Now().Add(-2 * OkLimit)
+	restarted = NewScale(NewConfig(), NewMonitor(), store, logger)
+	restarted.Recheck()
+	assert.False(t, restarted.Pub.IsOpen)
+	sessions, err := store.GetPubSessions(s.Pub.OpenedAt.Add(-time.Minute), time.Now())
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1, "the opening is finished")
+}
+
+func TestScale_Activity(t *testing.T) {
+	s := CreateScaleWithMeasurements(22, 10)
+	s.DismissPendingKeg() // the first keg was detected automatically
+	s.pours.Reset()
+	now := time.Now()
+	assert.Equal(t, ActivityOffline, s.activity(now), "the scale did not ping yet")
+
+	s.Ping()
+	assert.Equal(t, ActivityIdle, s.activity(now))
+
+	s.pours.Add(Measurement{Weight: 10000, At: now})
+	s.pours.Add(Measurement{Weight: 9750, At: now.Add(5 * time.Second)})
+	assert.Equal(t, ActivityPouring, s.activity(now))
+
+	// replaced by a full 10l keg
+	assert.Nil(t, s.AddMeasurement(16000, SourceHttp))
+	assert.Equal(t, ActivityKegChange, s.activity(now))
+	s.DismissPendingKeg()
+	assert.Equal(t, ActivityIdle, s.Status().Activity)
+	assert.Equal(t, ActivityOffline, s.activity(now.Add(2*OkLimit)))
+}
+
+func TestScale_DegradedMode(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	store := &failingStore{down: true}
+	s := NewScale(NewConfig(), NewMonitor(), store, logger)
+
+	assert.Nil(t, s.AddMeasurement(20000, SourceMqtt))
+	assert.Equal(t, 20000.0, s.Weight)
+	assert.True(t, s.IsDegraded())
+
+	s.checkStore()
+	assert.True(t, s.IsDegraded(), "storage is still down")
+
+	store.down = false
+	s.checkStore()
+	assert.False(t, s.IsDegraded())
+}
+
+func TestScale_NextRecheck(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	now := time.Now()
+	assert.Equal(t, time.Duration(0), s.nextRecheck(now), "device metrics are due to expire")
+
+	s.Recheck()
+	assert.InDelta(t, snapshotInterval, s.nextRecheck(time.Now()), float64(time.Second), "nothing is going on but the snapshot")
+
+	s.snapshotAt = time.Now().Add(time.Hour)
+	assert.InDelta(t, recheckMaxSleep, s.nextRecheck(time.Now()), float64(time.Second), "full recheck")
+
+	s.Ping()
+	assert.InDelta(t, OkLimit, s.nextRecheck(time.Now()), float64(time.Second), "pub closes without data")
+
+	assert.Nil(t, s.SetCleaning(time.Minute))
+	assert.InDelta(t, time.Minute, s.nextRecheck(time.Now()), float64(time.Second), "cleaning ends")
+}
+
+func TestScale_RunRecheckPings(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	s.Recheck()
+	s.mux.Lock()
+	started := time.Now()
+	s.recheckedAt = started.Add(-recheckMaxSleep + 100*time.Millisecond) // the full recheck is due soon
+	s.mux.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	go func() {
+		for ctx.Err() == nil {
+			s.Ping() // the device keeps reporting
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	s.RunRecheck(ctx, func() {})
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	assert.True(t, s.recheckedAt.After(started), "pings don't postpone the recheck")
+}
+
+func TestScale_NextRecheckClosingSoon(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	s.config.ClosingSoonHour = 22
+	s.Ping()
+	now := time.Date(2024, 5, 17, 20, 0, 0, 0, getTz())
+	s.Pub.OpenedAt = now.Add(-3 * time.Hour)
+	s.LastOk = now.Add(48 * time.Hour) // other deadlines are far away
+	s.recheckedAt = now.Add(48 * time.Hour)
+	s.snapshotAt = now.Add(48 * time.Hour)
+	assert.Equal(t, 2*time.Hour+time.Millisecond, s.nextRecheck(now), "closing soon starts")
+
+	s.Pub.OpenedAt = now.Add(105 * time.Minute)
+	assert.Equal(t, 45*time.Minute+time.Millisecond, s.nextRecheck(now.Add(2*time.Hour)), "the pub has to be open for the whole rate window")
+
+	s.pours.finishedAt = append(s.pours.finishedAt, now.Add(-10*time.Minute))
+	assert.Equal(t, 5*time.Minute+time.Millisecond, s.nextRecheck(now), "the pour leaves the occupancy window")
+}
+
+func TestScale_RunRecheckStaleData(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	s.config.AlertRules = []AlertRule{{Name: "no data", Condition: "data_age > 10m"}}
+	s.rules = NewRuleEngine(s.config)
+	s.Recheck()
+	s.mux.Lock()
+	s.LastOk = time.Now().Add(-time.Hour) // the scale is silent over the night
+	s.mux.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	iterations := 0
+	s.RunRecheck(ctx, func() { iterations++ })
+	assert.LessOrEqual(t, iterations, 2, "the recheck sleeps instead of spinning on the past deadline")
+}
+
+func TestScale_ClearMeasurements(t *testing.T) {
+	s := CreateScaleWithMeasurements(20, 19.5, 19)
+	now := time.Now()
+
+	deleted, err := s.ClearMeasurements(now.Add(-time.Hour), now.Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, deleted)
+
+	deleted, err = s.ClearMeasurements(time.Unix(0, 0), now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, deleted)
+
+	left, err := s.store.GetMeasurements(time.Unix(0, 0), now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Empty(t, left)
+}
+
+func TestScale_LineVolume(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	s.config.LineVolume = 150
+
+	s.finishPour(PourProgress{Grams: 100})
+	assert.Equal(t, 0, s.KegInfo.Pours, "the pour only filled the line")
+	assert.Equal(t, 100.0, s.KegInfo.LineGrams)
+
+	s.finishPour(PourProgress{Grams: 500})
+	assert.Equal(t, 1, s.KegInfo.Pours)
+	assert.Equal(t, 500.0, s.KegInfo.PouredGrams, "the line is filled already")
+
+	s.KegInfo = KegInfo{}
+	s.finishPour(PourProgress{Grams: 500})
+	assert.Equal(t, 150.0, s.KegInfo.LineGrams)
+	assert.Equal(t, 350.0, s.KegInfo.PouredGrams)
+}
+
+func TestScale_KegChangeJump(t *testing.T) {
+	s := CreateScaleWithMeasurements(22, 10)
+	s.config.KegChangeJump = 8000
+	s.DismissPendingKeg()
+
+	assert.Nil(t, s.AddMeasurement(16000, SourceHttp)) // 6 kg is not enough
+	assert.Equal(t, 15, s.ActiveKeg)
+	assert.Nil(t, s.PendingKeg)
+
+	assert.Nil(t, s.AddMeasurement(10000, SourceHttp))
+	assert.Nil(t, s.AddMeasurement(22200, SourceHttp)) // full 15l keg
+	assert.Equal(t, 15, s.ActiveKeg)
+	assert.NotNil(t, s.PendingKeg)
+	assert.Equal(t, 15, s.PendingKeg.Tapped)
+}
+
+// gaugeValue returns value of the gauge without labels from the registry
+func gaugeValue(t *testing.T, m *Monitor, name string) float64 {
+	families, err := m.Registry.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
+
+// counterValue returns value of the counter without labels from the registry
+func counterValue(t *testing.T, m *Monitor, name string) float64 {
+	families, err := m.Registry.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
+
+// seriesCount returns number of series of the metric in the registry
+func seriesCount(t *testing.T, m *Monitor, name string) int {
+	families, err := m.Registry.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return len(family.GetMetric())
+		}
+	}
+
+	return 0
+}
+
+func TestScale_MetricExpiry(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	s.config.MetricTTL = time.Minute
+	s.Ping()
+	s.SetSensors(sensors(4.5, 3.71))
+	weight := gaugeValue(t, s.monitor, "scale_weight")
+
+	s.Recheck()
+	assert.Equal(t, weight, gaugeValue(t, s.monitor, "scale_weight"), "fresh data are kept")
+
+	s.LastOk = time.Now().Add(-2 * time.Minute)
+	s.Recheck()
+	for _, name := range []string{"scale_weight", "scale_beers_left", "scale_temperature_celsius", "scale_battery_volts"} {
+		assert.Equal(t, 0, seriesCount(t, s.monitor, name), name)
+	}
+	assert.Equal(t, 1, seriesCount(t, s.monitor, "scale_keg_info"), "keg is still tapped")
+
+	// the device is back
+	s.Ping()
+	assert.Equal(t, weight, gaugeValue(t, s.monitor, "scale_weight"))
+	assert.Equal(t, float64(s.BeersLeft), gaugeValue(t, s.monitor, "scale_beers_left"))
+	s.Recheck()
+	assert.Equal(t, weight, gaugeValue(t, s.monitor, "scale_weight"))
+}
+
+func TestScale_KegInfoMetric(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	assert.Nil(t, s.SetActiveKeg(30, "Pilsner"))
+
+	families, err := s.monitor.Registry.Gather()
+	assert.Nil(t, err)
+	labels := map[string]string{}
+	for _, family := range families {
+		if family.GetName() == "scale_keg_info" {
+			assert.Len(t, family.GetMetric(), 1)
+			assert.Equal(t, 1.0, family.GetMetric()[0].GetGauge().GetValue())
+			for _, label := range family.GetMetric()[0].GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+		}
+	}
+	assert.Equal(t, map[string]string{"keg_id": s.KegInfo.Id, "beer": "Pilsner", "size": "30"}, labels)
+
+	// the next keg replaces the series
+	assert.Nil(t, s.SetActiveKeg(50, "Kozel"))
+	assert.Equal(t, 1, seriesCount(t, s.monitor, "scale_keg_info"))
+
+	_, err = s.UntapKeg(time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, seriesCount(t, s.monitor, "scale_keg_info"), "nothing is tapped")
+}
+
+func TestScale_BeersLeftGauge(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	assert.Equal(t, 15, s.ActiveKeg)
+	assert.Equal(t, float64(s.BeersLeft), gaugeValue(t, s.monitor, "scale_beers_left"))
+
+	assert.Nil(t, s.AddMeasurement(17000, SourceHttp))
+	assert.Equal(t, CalcBeersLeft(15, 17000, 500), s.BeersLeft)
+	assert.Equal(t, float64(s.BeersLeft), gaugeValue(t, s.monitor, "scale_beers_left"))
+}
+
+func TestScale_Sensors(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	s.SetSensors(sensors(4.5, 3.71))
+	assert.Equal(t, 4.5, gaugeValue(t, s.monitor, "scale_temperature_celsius"))
+	assert.Equal(t, 3.71, gaugeValue(t, s.monitor, "scale_battery_volts"))
+
+	assert.Nil(t, s.AddMeasurement(21500, SourceHttp))
+	measurements, err := s.store.GetMeasurements(time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	last := measurements[len(measurements)-1]
+	assert.Equal(t, 4.5, *last.Temperature, "readings are stored along the weight")
+	assert.Equal(t, 3.71, *last.Battery)
+
+	// the sensor was disconnected
+	s.SetSensors(Sensors{})
+	families, err := s.monitor.Registry.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		assert.NotEqual(t, "scale_temperature_celsius", family.GetName())
+	}
+	assert.Nil(t, s.GetSensors().Battery)
+}
+
+func TestMonitor_PublicGatherer(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	s.Ping()
+	s.SetRssi(-70)
+
+	families, err := s.monitor.PublicGatherer().Gather()
+	assert.Nil(t, err)
+
+	names := []string{}
+	for _, family := range families {
+		names = append(names, family.GetName())
+	}
+	assert.ElementsMatch(t, []string{"scale_beers_left", "scale_pub_open"}, names)
+}
+
+func TestScale_PubOverride(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	s.Ping()
+	assert.True(t, s.Pub.IsOpen)
+
+	s.SetPubOverride(false, time.Hour)
+	assert.False(t, s.Pub.IsOpen)
+	s.Ping()
+	assert.False(t, s.Pub.IsOpen, "forced closed")
+	s.SetPubOverride(false, 30*time.Second)
+	assert.LessOrEqual(t, s.nextRecheck(time.Now()), 31*time.Second, "recheck at the end of the override")
+
+	s.SetPubOverride(true, time.Hour)
+	assert.True(t, s.Pub.IsOpen)
+	s.LastOk = time.Now().Add(-2 * OkLimit)
+	s.Recheck()
+	assert.True(t, s.Pub.IsOpen, "forced open without the scale")
+
+	s.PubOverride.Until = time.Now().Add(-time.Second)
+	s.Recheck()
+	assert.Nil(t, s.PubOverride)
+	assert.False(t, s.Pub.IsOpen)
+}
+
+func TestScale_Flush(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	start := time.Now().Add(-time.Minute)
+
+	s.pours.Add(Measurement{Weight: 22000, At: start})
+	s.pours.Add(Measurement{Weight: 21750, At: start.Add(5 * time.Second)})
+	assert.True(t, s.pours.Progress().Active)
+
+	assert.Nil(t, s.Flush())
+	assert.False(t, s.pours.Progress().Active, "pour in progress is finished")
+
+	pours, err := s.store.GetPours(start, time.Now())
+	assert.Nil(t, err)
+	assert.Len(t, pours, 1)
+	assert.Equal(t, 1, s.KegInfo.Pours)
+
+	info, err := s.store.GetKegInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, s.KegInfo, info)
+}
+
+func TestScale_BeersPouredCounter(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	s.finishPour(PourProgress{Grams: 500, StartedAt: time.Now()})
+	s.finishPour(PourProgress{Grams: 250, StartedAt: time.Now()})
+
+	families, err := s.monitor.Registry.Gather()
+	assert.Nil(t, err)
+	found := 0
+	for _, family := range families {
+		switch family.GetName() {
+		case "scale_pour_size_grams":
+			histogram := family.GetMetric()[0].GetHistogram()
+			assert.Equal(t, uint64(2), histogram.GetSampleCount())
+			assert.Equal(t, 750.0, histogram.GetSampleSum())
+			for _, bucket := range histogram.GetBucket() {
+				switch bucket.GetUpperBound() {
+				case 200:
+					assert.Equal(t, uint64(0), bucket.GetCumulativeCount())
+				case 300, 450:
+					assert.Equal(t, uint64(1), bucket.GetCumulativeCount(), "the small pour")
+				case 500, 1000:
+					assert.Equal(t, uint64(2), bucket.GetCumulativeCount())
+				}
+			}
+			found++
+		case "scale_beers_poured_total":
+			assert.Len(t, family.GetMetric(), 1)
+			assert.Equal(t, "keg_id", family.GetMetric()[0].GetLabel()[0].GetName())
+			assert.Equal(t, s.KegInfo.Id, family.GetMetric()[0].GetLabel()[0].GetValue())
+			assert.Equal(t, 1.5, family.GetMetric()[0].GetCounter().GetValue())
+			found++
+		}
+	}
+	assert.Equal(t, 2, found)
+	assert.Equal(t, 1.5, s.KegInfo.Beers)
+
+	// restart
+	restarted := NewScale(s.config, NewMonitor(), s.store, s.logger)
+	families, err = restarted.monitor.Registry.Gather()
+	assert.Nil(t, err)
+	for _, family := range families {
+		if family.GetName() == "scale_beers_poured_total" {
+			assert.Equal(t, 1.5, family.GetMetric()[0].GetCounter().GetValue(), "survives restart")
+			found++
+		}
+	}
+	assert.Equal(t, 3, found)
+}
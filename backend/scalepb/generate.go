@@ -0,0 +1,4 @@
+// Package scalepb holds the protobuf messages and the gRPC service of the scale ingestion
+package scalepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ingest.proto
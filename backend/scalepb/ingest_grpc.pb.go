@@ -0,0 +1,197 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ingest.proto
+
+// Ingestion of scale messages for gateways aggregating more scales (e.g. LoRa),
+// the messages feed the same pipeline as the HTTP and MQTT transports
+
+package scalepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ScaleIngest_Push_FullMethodName   = "/scale.v1.ScaleIngest/Push"
+	ScaleIngest_Stream_FullMethodName = "/scale.v1.ScaleIngest/Stream"
+	ScaleIngest_Batch_FullMethodName  = "/scale.v1.ScaleIngest/Batch"
+)
+
+// ScaleIngestClient is the client API for ScaleIngest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ScaleIngest authenticates by the device-ingest token in the authorization metadata
+type ScaleIngestClient interface {
+	// Push processes a single live message
+	Push(ctx context.Context, in *ScaleMessage, opts ...grpc.CallOption) (*PushReply, error)
+	// Stream processes live messages of any scales until the gateway closes the stream
+	Stream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ScaleMessage, StreamReply], error)
+	// Batch stores messages buffered by the gateway while it was offline, they may come from more scales
+	Batch(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BatchEntry, BatchReply], error)
+}
+
+type scaleIngestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewScaleIngestClient(cc grpc.ClientConnInterface) ScaleIngestClient {
+	return &scaleIngestClient{cc}
+}
+
+func (c *scaleIngestClient) Push(ctx context.Context, in *ScaleMessage, opts ...grpc.CallOption) (*PushReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PushReply)
+	err := c.cc.Invoke(ctx, ScaleIngest_Push_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *scaleIngestClient) Stream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[ScaleMessage, StreamReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ScaleIngest_ServiceDesc.Streams[0], ScaleIngest_Stream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ScaleMessage, StreamReply]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ScaleIngest_StreamClient = grpc.ClientStreamingClient[ScaleMessage, StreamReply]
+
+func (c *scaleIngestClient) Batch(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BatchEntry, BatchReply], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ScaleIngest_ServiceDesc.Streams[1], ScaleIngest_Batch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BatchEntry, BatchReply]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ScaleIngest_BatchClient = grpc.ClientStreamingClient[BatchEntry, BatchReply]
+
+// ScaleIngestServer is the server API for ScaleIngest service.
+// All implementations must embed UnimplementedScaleIngestServer
+// for forward compatibility.
+//
+// ScaleIngest authenticates by the device-ingest token in the authorization metadata
+type ScaleIngestServer interface {
+	// Push processes a single live message
+	Push(context.Context, *ScaleMessage) (*PushReply, error)
+	// Stream processes live messages of any scales until the gateway closes the stream
+	Stream(grpc.ClientStreamingServer[ScaleMessage, StreamReply]) error
+	// Batch stores messages buffered by the gateway while it was offline, they may come from more scales
+	Batch(grpc.ClientStreamingServer[BatchEntry, BatchReply]) error
+	mustEmbedUnimplementedScaleIngestServer()
+}
+
+// UnimplementedScaleIngestServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedScaleIngestServer struct{}
+
+func (UnimplementedScaleIngestServer) Push(context.Context, *ScaleMessage) (*PushReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Push not implemented")
+}
+func (UnimplementedScaleIngestServer) Stream(grpc.ClientStreamingServer[ScaleMessage, StreamReply]) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedScaleIngestServer) Batch(grpc.ClientStreamingServer[BatchEntry, BatchReply]) error {
+	return status.Errorf(codes.Unimplemented, "method Batch not implemented")
+}
+func (UnimplementedScaleIngestServer) mustEmbedUnimplementedScaleIngestServer() {}
+func (UnimplementedScaleIngestServer) testEmbeddedByValue()                     {}
+
+// UnsafeScaleIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ScaleIngestServer will
+// result in compilation errors.
+type UnsafeScaleIngestServer interface {
+	mustEmbedUnimplementedScaleIngestServer()
+}
+
+func RegisterScaleIngestServer(s grpc.ServiceRegistrar, srv ScaleIngestServer) {
+	// If the following call pancis, it indicates UnimplementedScaleIngestServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ScaleIngest_ServiceDesc, srv)
+}
+
+func _ScaleIngest_Push_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScaleMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ScaleIngestServer).Push(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ScaleIngest_Push_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ScaleIngestServer).Push(ctx, req.(*ScaleMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ScaleIngest_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ScaleIngestServer).Stream(&grpc.GenericServerStream[ScaleMessage, StreamReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ScaleIngest_StreamServer = grpc.ClientStreamingServer[ScaleMessage, StreamReply]
+
+func _ScaleIngest_Batch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ScaleIngestServer).Batch(&grpc.GenericServerStream[BatchEntry, BatchReply]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ScaleIngest_BatchServer = grpc.ClientStreamingServer[BatchEntry, BatchReply]
+
+// ScaleIngest_ServiceDesc is the grpc.ServiceDesc for ScaleIngest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ScaleIngest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "scale.v1.ScaleIngest",
+	HandlerType: (*ScaleIngestServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Push",
+			Handler:    _ScaleIngest_Push_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _ScaleIngest_Stream_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Batch",
+			Handler:       _ScaleIngest_Batch_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ingest.proto",
+}
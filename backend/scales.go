@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// ScaleRegistry holds scales of all taps keyed by the device id
+// the default scale has an empty id, so messages of single-scale firmware keep working
+type ScaleRegistry struct {
+	scales map[string]*Scale
+}
+
+// NewScaleRegistry creates the registry with the default scale
+func NewScaleRegistry(scale *Scale) *ScaleRegistry {
+	return &ScaleRegistry{
+		scales: map[string]*Scale{"": scale},
+	}
+}
+
+// AddDevices creates scales of [Config.ScaleDevices]
+// every scale has its own Prometheus registry (series labeled by the device) and storage keys
+func (sr *ScaleRegistry) AddDevices(config *Config, monitor *Monitor, store Storage, logger *logrus.Logger) error {
+	if len(config.ScaleDevices) == 0 {
+		return nil
+	}
+
+	deviceStore, ok := store.(DeviceStorage)
+	if !ok {
+		return fmt.Errorf("storage does not support more scales")
+	}
+
+	for _, device := range config.ScaleDevices {
+		sr.scales[device] = NewScale(config, monitor.ForDevice(device), deviceStore.ForDevice(device), logger)
+		logger.Infof("Scale %s registered", device)
+	}
+
+	return nil
+}
+
+// Get returns scale of the device, empty id is the default scale
+func (sr *ScaleRegistry) Get(device string) (*Scale, bool) {
+	scale, found := sr.scales[device]
+	return scale, found
+}
+
+// Default returns the scale of devices sending messages without id
+func (sr *ScaleRegistry) Default() *Scale {
+	return sr.scales[""]
+}
+
+// Devices returns ids of all scales ordered, the default scale (empty id) first
+func (sr *ScaleRegistry) Devices() []string {
+	devices := make([]string, 0, len(sr.scales))
+	for device := range sr.scales {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+
+	return devices
+}
+
+// Gatherer gathers metrics of all scales
+// series of the default scale have no device label for backward compatibility
+func (sr *ScaleRegistry) Gatherer() prometheus.Gatherer {
+	gatherers := prometheus.Gatherers{}
+	for _, device := range sr.Devices() {
+		gatherers = append(gatherers, sr.scales[device].monitor.Registry)
+	}
+
+	return gatherers
+}
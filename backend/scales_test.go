@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScaleRegistry(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ScaleDevices = []string{"tap2"}
+	monitor := NewMonitor()
+	store := &FakeStore{}
+
+	scales := NewScaleRegistry(NewScale(config, monitor, store, logger))
+	assert.Nil(t, scales.AddDevices(config, monitor, store, logger))
+	assert.Equal(t, []string{"", "tap2"}, scales.Devices())
+
+	hr := &HandlerRepository{
+		scale:   scales.Default(),
+		scales:  scales,
+		config:  config,
+		monitor: monitor,
+		capture: NewCapture(config),
+		mirror:  NewMirror(config, monitor, logger),
+		logger:  logger,
+	}
+
+	// single-scale firmware keeps working
+	status, err := hr.ingestMessage("push|10|-70|30000", SourceHttp)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	status, err = hr.ingestMessage("push|tap2|10|-61|20000", SourceHttp)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = hr.ingestMessage("push|tap3|10|-61|20000", SourceHttp)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	tap2, found := scales.Get("tap2")
+	assert.True(t, found)
+	assert.Equal(t, 30000.0, scales.Default().Weight)
+	assert.Equal(t, 20000.0, tap2.Weight)
+
+	// kegs are per scale, the catalog is shared
+	assert.Nil(t, store.SaveKegModel(KegModel{Id: "steel-30", Name: "Steel", Size: 30, EmptyWeight: 9000}))
+	status, err = hr.setActiveKeg(activeKegInput{Model: "steel-30", Device: "tap2"})
+	assert.Nil(t, err, status)
+	assert.Equal(t, 30, tap2.ActiveKeg)
+	assert.NotEqual(t, 30, scales.Default().ActiveKeg)
+
+	// calibration is per scale
+	req := httptest.NewRequest(http.MethodPost, "/api/scale/calibration?device=tap2", strings.NewReader(`{"offset": 8388608, "factor": 21.5}`))
+	req.Header.Set("Authorization", config.Password)
+	w := httptest.NewRecorder()
+	hr.calibrationHandler()(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	calibration, _, _ := tap2.GetCalibration()
+	assert.NotNil(t, calibration)
+	calibration, _, _ = scales.Default().GetCalibration()
+	assert.Nil(t, calibration)
+
+	// pours of all taps are on the same tab
+	tap2.finishPour(PourProgress{StartedAt: time.Now().Add(-time.Minute), Grams: 500, Duration: 5})
+	pours, err := store.GetPours(time.Now().Add(-time.Hour), time.Now())
+	assert.Nil(t, err)
+	assert.Len(t, pours, 1)
+
+	families, err := scales.Gatherer().Gather()
+	assert.Nil(t, err)
+	weights := []string{}
+	for _, family := range families {
+		if family.GetName() != "scale_weight" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := []string{}
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			weights = append(weights, strings.Join(labels, ","))
+		}
+	}
+	assert.ElementsMatch(t, []string{"", "device=tap2"}, weights)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScheduleWindow is a weekly opening of the pub in the local timezone
+// minutes are counted from the midnight starting the day, the end may be on the next day
+type ScheduleWindow struct {
+	Day   time.Weekday
+	Start int // minutes
+	End   int // minutes, greater than Start
+}
+
+// PubSchedule holds weekly opening hours of the pub
+// the pub is open within a window even when the scale is off (lost power during opening hours),
+// outside of windows the scale decides, an admin override beats both
+type PubSchedule []ScheduleWindow
+
+var scheduleDays = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
+
+// ParsePubSchedule parses windows like "fri 18:00-02:00", the end before the start is on the next day
+func ParsePubSchedule(windows []string) (PubSchedule, error) {
+	schedule := PubSchedule{}
+	for _, window := range windows {
+		var day, from, to string
+		if fields := strings.Fields(window); len(fields) == 2 {
+			day = strings.ToLower(fields[0])
+			from, to, _ = strings.Cut(fields[1], "-")
+		}
+
+		weekday, found := scheduleDays[day]
+		if !found {
+			return nil, fmt.Errorf("%q is not a window like \"fri 18:00-02:00\"", window)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", window, err)
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", window, err)
+		}
+		if end <= start {
+			end += 24 * 60
+		}
+
+		schedule = append(schedule, ScheduleWindow{Day: weekday, Start: start, End: end})
+	}
+
+	return schedule, nil
+}
+
+// parseClock returns minutes since midnight of HH:MM
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time HH:MM", clock)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsOpen returns true if the time falls into a window
+func (ps PubSchedule) IsOpen(t time.Time) bool {
+	for _, window := range ps {
+		// the window may start on the previous day
+		for offset := -1; offset <= 0; offset++ {
+			start, end := window.at(t, offset)
+			if !start.IsZero() && !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// NextChange returns the nearest start or end of a window after the time, zero without windows
+func (ps PubSchedule) NextChange(t time.Time) time.Time {
+	next := time.Time{}
+	for _, window := range ps {
+		for offset := -1; offset <= 7; offset++ {
+			start, end := window.at(t, offset)
+			for _, change := range []time.Time{start, end} {
+				if !change.IsZero() && change.After(t) && (next.IsZero() || change.Before(next)) {
+					next = change
+				}
+			}
+		}
+	}
+
+	return next
+}
+
+// at returns start and end of the window on the day moved by offset from the day of t
+// zero times if the window is not on that day
+func (w ScheduleWindow) at(t time.Time, offset int) (time.Time, time.Time) {
+	local := t.In(getTz())
+	day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, getTz())
+	if day.Weekday() != w.Day {
+		return time.Time{}, time.Time{}
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, w.Start, 0, 0, getTz())
+	end := time.Date(day.Year(), day.Month(), day.Day(), 0, w.End, 0, 0, getTz())
+	return start, end
+}
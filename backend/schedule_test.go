@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSchedule(t *testing.T) {
+	schedule, err := ParsePubSchedule([]string{"fri 18:00-02:00", "Sun 15:00-22:00"})
+	assert.Nil(t, err)
+
+	friday := time.Date(2024, 5, 3, 0, 0, 0, 0, getTz())
+	assert.False(t, schedule.IsOpen(friday.Add(17*time.Hour)))
+	assert.True(t, schedule.IsOpen(friday.Add(18*time.Hour)))
+	assert.True(t, schedule.IsOpen(friday.Add(25*time.Hour)), "after midnight on saturday")
+	assert.False(t, schedule.IsOpen(friday.Add(26*time.Hour)))
+	assert.True(t, schedule.IsOpen(friday.AddDate(0, 0, 2).Add(21*time.Hour)))
+
+	assert.Equal(t, friday.Add(18*time.Hour), schedule.NextChange(friday.Add(12*time.Hour)))
+	assert.Equal(t, friday.Add(26*time.Hour), schedule.NextChange(friday.Add(20*time.Hour)))
+	assert.Equal(t, friday.AddDate(0, 0, 2).Add(15*time.Hour), schedule.NextChange(friday.Add(26*time.Hour)))
+
+	assert.True(t, PubSchedule{}.NextChange(friday).IsZero())
+
+	for _, invalid := range []string{"friday 18:00-02:00", "fri 18:00", "fri 25:00-02:00", "fri"} {
+		_, err = ParsePubSchedule([]string{invalid})
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestScale_PubSchedule(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	start := time.Now().In(getTz()).Add(-time.Hour) // the window starts on the previous day around midnight
+	window := start.Weekday().String()[:3] + " " + start.Format("15:04") + "-" + start.Add(2*time.Hour).Format("15:04")
+	s.schedule, _ = ParsePubSchedule([]string{window})
+
+	s.Recheck()
+	assert.True(t, s.Pub.IsOpen, "opening hours without the scale")
+
+	s.SetPubOverride(false, time.Hour)
+	s.Recheck()
+	assert.False(t, s.Pub.IsOpen, "override beats opening hours")
+
+	s.SetPubOverride(false, 0)
+	s.Recheck()
+	assert.True(t, s.Pub.IsOpen)
+	assert.LessOrEqual(t, s.nextRecheck(time.Now()), time.Hour+time.Second, "recheck at the end of opening hours")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+// EventVersions holds the current schema version of every published event type
+// bump the version and add a new schema file when the payload changes incompatibly
+var EventVersions = map[string]int{
+	PourProgressEventType:  1,
+	PourEventType:          1,
+	KegChangeEventType:     1,
+	PubOpenEventType:       1,
+	OfflineEventType:       1,
+	RunawayTapEventType:    1,
+	ExternalAlertEventType: 1,
+	StateChangeEventType:   1,
+	KegButtonEventType:     1,
+	ChangeoverEventType:    1,
+	ClosingSoonEventType:   1,
+	ClosedLossEventType:    1,
+	KegUntapEventType:      1,
+	EmptyScaleEventType:    1,
+	TareShiftEventType:     1,
+	KegLowEventType:        1,
+	AlertRuleEventType:     1,
+}
+
+// SchemaEntry describes a single schema file
+type SchemaEntry struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	Current bool   `json:"current"`
+	File    string `json:"file"`
+}
+
+// ListSchemas returns all available schemas, including the old versions
+func ListSchemas() ([]SchemaEntry, error) {
+	files, err := fs.Glob(schemaFiles, "schemas/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]SchemaEntry, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "schemas/")
+
+		// file name format: type.vVersion.json
+		eventType, rawVersion, found := strings.Cut(strings.TrimSuffix(name, ".json"), ".v")
+		version, err := strconv.Atoi(rawVersion)
+		if !found || err != nil {
+			return nil, fmt.Errorf("invalid schema file name %s", name)
+		}
+
+		entries = append(entries, SchemaEntry{
+			Type:    eventType,
+			Version: version,
+			Current: EventVersions[eventType] == version || eventType == "event",
+			File:    name,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Type == entries[j].Type {
+			return entries[i].Version < entries[j].Version
+		}
+		return entries[i].Type < entries[j].Type
+	})
+
+	return entries, nil
+}
+
+// GetSchema returns content of the schema file
+func GetSchema(name string) ([]byte, error) {
+	if strings.Contains(name, "/") {
+		return nil, fs.ErrNotExist
+	}
+
+	return schemaFiles.ReadFile("schemas/" + name)
+}
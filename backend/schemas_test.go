@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// every published event type has to have a valid schema of its current version
+func TestSchemas_CurrentVersionsExist(t *testing.T) {
+	for eventType, version := range EventVersions {
+		data, err := GetSchema(fmt.Sprintf("%s.v%d.json", eventType, version))
+		assert.Nil(t, err, "missing schema for %s v%d", eventType, version)
+		assert.True(t, json.Valid(data), "invalid schema for %s v%d", eventType, version)
+	}
+
+	entries, err := ListSchemas()
+	assert.Nil(t, err)
+	assert.Len(t, entries, len(EventVersions)+1) // + envelope
+}
+
+// the envelope accepts exactly the published event types
+func TestSchemas_EnvelopeTypes(t *testing.T) {
+	data, err := GetSchema("event.v1.json")
+	assert.Nil(t, err)
+	var envelope struct {
+		Properties struct {
+			Type struct {
+				Enum []string `json:"enum"`
+			} `json:"type"`
+		} `json:"properties"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &envelope))
+
+	types := make([]string, 0, len(EventVersions))
+	for eventType := range EventVersions {
+		types = append(types, eventType)
+	}
+	assert.ElementsMatch(t, types, envelope.Properties.Type.Enum)
+}
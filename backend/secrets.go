@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider resolves secrets (tokens, passwords, API keys) by their config key
+// found is false when the provider does not know the secret
+type SecretProvider interface {
+	Name() string
+	Secret(key string) (value string, found bool, err error)
+}
+
+// secretProviders returns providers in order of precedence
+// [KEY]_FILE wins over Vault which wins over plain environment variable
+func secretProviders() []SecretProvider {
+	providers := []SecretProvider{&FileSecretProvider{}}
+	if addr, ok := os.LookupEnv("VAULT_ADDR"); ok {
+		providers = append(providers, NewVaultSecretProvider(addr, os.Getenv("VAULT_PATH")))
+	}
+	providers = append(providers, &EnvSecretProvider{})
+
+	return providers
+}
+
+// EnvSecretProvider reads secrets directly from environment variables
+type EnvSecretProvider struct{}
+
+func (p *EnvSecretProvider) Name() string {
+	return "env"
+}
+
+func (p *EnvSecretProvider) Secret(key string) (string, bool, error) {
+	value, found := os.LookupEnv(key)
+	return value, found, nil
+}
+
+// FileSecretProvider reads secrets from a file referenced by [KEY]_FILE variable
+// e.g. AUTH_TOKEN_FILE=/run/secrets/auth_token (docker/kubernetes secrets)
+type FileSecretProvider struct{}
+
+func (p *FileSecretProvider) Name() string {
+	return "file"
+}
+
+func (p *FileSecretProvider) Secret(key string) (string, bool, error) {
+	path, found := os.LookupEnv(key + "_FILE")
+	if !found {
+		return "", false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("could not read secret file: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// VaultSecretProvider reads secrets from HashiCorp Vault KV v2 engine
+// all secrets are stored in a single path (VAULT_PATH, e.g. secret/data/keg-scale)
+// and the token is read from VAULT_TOKEN or VAULT_TOKEN_FILE
+type VaultSecretProvider struct {
+	addr string
+	path string
+
+	once    sync.Once
+	secrets map[string]string
+	err     error
+}
+
+func NewVaultSecretProvider(addr, path string) *VaultSecretProvider {
+	if path == "" {
+		path = "secret/data/keg-scale"
+	}
+
+	return &VaultSecretProvider{
+		addr: strings.TrimSuffix(addr, "/"),
+		path: strings.Trim(path, "/"),
+	}
+}
+
+func (p *VaultSecretProvider) Name() string {
+	return "vault"
+}
+
+func (p *VaultSecretProvider) Secret(key string) (string, bool, error) {
+	p.once.Do(func() {
+		p.secrets, p.err = p.fetch()
+	})
+
+	if p.err != nil {
+		return "", false, p.err
+	}
+
+	value, found := p.secrets[key]
+	return value, found, nil
+}
+
+func (p *VaultSecretProvider) fetch() (map[string]string, error) {
+	token, _, err := (&FileSecretProvider{}).Secret("VAULT_TOKEN")
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.addr+"/v1/"+p.path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach vault: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d", res.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	return body.Data.Data, nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// clockMinYear is the earliest year the server clock can sanely report
+const clockMinYear = 2024
+
+// SelfCheckResult is the result of a single check
+type SelfCheckResult struct {
+	Name    string `json:"name"`
+	Ok      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// SelfCheckReport is the result of the whole self-check
+type SelfCheckReport struct {
+	At     time.Time         `json:"at"`
+	Ok     bool              `json:"ok"`
+	Checks []SelfCheckResult `json:"checks"`
+}
+
+// SelfChecker verifies every night that the things nobody looks at daily still work
+// (storage, clock, retention, metrics, backups), so problems are found before data is lost
+type SelfChecker struct {
+	mux      sync.Mutex
+	config   *Config
+	store    Storage
+	monitor  *Monitor
+	exporter *Exporter
+	logger   *logrus.Logger
+	client   *http.Client
+	last     *SelfCheckReport
+}
+
+func NewSelfChecker(config *Config, store Storage, monitor *Monitor, exporter *Exporter, logger *logrus.Logger) *SelfChecker {
+	return &SelfChecker{
+		mux:      sync.Mutex{},
+		config:   config,
+		store:    store,
+		monitor:  monitor,
+		exporter: exporter,
+		logger:   logger,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run performs the self-check every night at [Config.SelfCheckHour]
+// it's supposed to run as a supervised worker
+func (sc *SelfChecker) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	next := nextExportAt(time.Now(), sc.config.SelfCheckHour)
+	for {
+		select {
+		case <-ctx.Done():
+			sc.logger.Debug("Self-check stopped")
+			return
+		case now := <-tick.C:
+			heartbeat()
+			if now.Before(next) {
+				continue
+			}
+
+			report := sc.Check(now)
+			if !report.Ok {
+				sc.notify(ctx, report)
+			}
+			next = nextExportAt(now, sc.config.SelfCheckHour)
+		}
+	}
+}
+
+// Last returns the report of the last self-check, nil if it has not run yet
+func (sc *SelfChecker) Last() *SelfCheckReport {
+	sc.mux.Lock()
+	defer sc.mux.Unlock()
+
+	return sc.last
+}
+
+// Check runs all checks and stores the report
+func (sc *SelfChecker) Check(now time.Time) SelfCheckReport {
+	report := SelfCheckReport{At: now, Ok: true}
+	failed := 0
+	add := func(name string, message string, err error) {
+		result := SelfCheckResult{Name: name, Ok: err == nil, Message: message}
+		if err != nil {
+			result.Message = err.Error()
+			report.Ok = false
+			failed++
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	message, err := sc.checkStorage()
+	add("storage", message, err)
+	message, err = sc.checkClock(now)
+	add("clock", message, err)
+	message, err = sc.checkRetention(now)
+	add("retention", message, err)
+	message, err = sc.checkMetrics()
+	add("metrics", message, err)
+	message, err = sc.checkBackup(now)
+	add("backup", message, err)
+
+	sc.monitor.selfCheckFailed.WithLabelValues().Set(float64(failed))
+	if report.Ok {
+		sc.logger.Info("Self-check passed")
+	} else {
+		sc.logger.Warnf("Self-check failed: %d of %d checks failed", failed, len(report.Checks))
+	}
+
+	sc.mux.Lock()
+	sc.last = &report
+	sc.mux.Unlock()
+
+	return report
+}
+
+func (sc *SelfChecker) checkStorage() (string, error) {
+	if err := sc.store.Ping(); err != nil {
+		return "", fmt.Errorf("storage is unreachable: %w", err)
+	}
+	return "storage is reachable", nil
+}
+
+func (sc *SelfChecker) checkClock(now time.Time) (string, error) {
+	if now.Year() < clockMinYear {
+		return "", fmt.Errorf("clock reports year %d", now.Year())
+	}
+
+	// measurements are stamped by the server, newer ones mean the clock went backwards
+	future, err := sc.store.CountMeasurements(now.Add(time.Minute), now.AddDate(100, 0, 0))
+	if err != nil {
+		return "", fmt.Errorf("could not count measurements: %w", err)
+	}
+	if future > 0 {
+		return "", fmt.Errorf("%d measurements are newer than the clock, it went backwards", future)
+	}
+
+	return fmt.Sprintf("clock reports %s", now.Format(time.RFC3339)), nil
+}
+
+func (sc *SelfChecker) checkRetention(now time.Time) (string, error) {
+	if sc.config.RetentionDays == 0 {
+		return "retention is disabled", nil
+	}
+
+	limit := now.AddDate(0, 0, -sc.config.RetentionDays)
+	old, err := sc.store.CountMeasurements(time.Unix(0, 0), limit)
+	if err != nil {
+		return "", fmt.Errorf("could not count measurements: %w", err)
+	}
+	if old > 0 {
+		return "", fmt.Errorf("%d measurements are older than %d days", old, sc.config.RetentionDays)
+	}
+
+	return fmt.Sprintf("no measurements are older than %d days", sc.config.RetentionDays), nil
+}
+
+func (sc *SelfChecker) checkMetrics() (string, error) {
+	// gathering validates the registry (duplicate series, inconsistent labels)
+	if _, err := sc.monitor.Registry.Gather(); err != nil {
+		return "", fmt.Errorf("metric registry is inconsistent: %w", err)
+	}
+	return "metric registry is consistent", nil
+}
+
+func (sc *SelfChecker) checkBackup(now time.Time) (string, error) {
+	if !sc.exporter.Enabled() {
+		return "exports are disabled", nil
+	}
+
+	manifest, err := sc.exporter.Manifest()
+	if err != nil {
+		return "", fmt.Errorf("could not read export manifest: %w", err)
+	}
+
+	var last time.Time
+	for _, entry := range manifest {
+		if entry.ExportedAt.After(last) {
+			last = entry.ExportedAt
+		}
+	}
+	if last.IsZero() {
+		return "", fmt.Errorf("nothing has been exported yet")
+	}
+	if age := now.Sub(last); age > sc.config.BackupMaxAge {
+		return "", fmt.Errorf("last backup is %s old", age.Round(time.Minute))
+	}
+
+	return fmt.Sprintf("last backup at %s", last.Format(time.RFC3339)), nil
+}
+
+// notify posts the failed report to the configured webhook
+func (sc *SelfChecker) notify(ctx context.Context, report SelfCheckReport) {
+	if sc.config.SelfCheckWebhook == "" {
+		return
+	}
+
+	err := sc.monitor.deliveries.Track("selfcheck", func() error {
+		return sc.send(ctx, report)
+	})
+	if err != nil {
+		sc.logger.Warnf("Could not send self-check report: %v", err)
+	}
+}
+
+func (sc *SelfChecker) send(ctx context.Context, report SelfCheckReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	if sc.config.DryRun {
+		sc.logger.Infof("Dry run, not sending self-check report: %s", body)
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sc.config.SelfCheckWebhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := sc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func findCheck(report SelfCheckReport, name string) SelfCheckResult {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return SelfCheckResult{}
+}
+
+func TestSelfChecker_Check(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ExportPath = t.TempDir()
+	config.RetentionDays = 30
+	store := &failingStore{}
+	monitor := NewMonitor()
+	sc := NewSelfChecker(config, store, monitor, NewExporter(config, store, logger), logger)
+	assert.Nil(t, sc.Last())
+
+	now := time.Now()
+	manifest, _ := json.Marshal([]ExportEntry{{Day: "2024-06-01", ExportedAt: now.Add(-time.Hour)}})
+	assert.Nil(t, os.WriteFile(filepath.Join(config.ExportPath, manifestFile), manifest, 0644))
+
+	report := sc.Check(now)
+	assert.True(t, report.Ok)
+	assert.Len(t, report.Checks, 5)
+	assert.Equal(t, report, *sc.Last())
+
+	// old data, clock went backwards and storage is down
+	_ = store.AddMeasurement(Measurement{Weight: 20000, At: now.AddDate(0, 0, -40)})
+	_ = store.AddMeasurement(Measurement{Weight: 20000, At: now.Add(time.Hour)})
+	store.down = true
+
+	report = sc.Check(now.Add(72 * time.Hour))
+	assert.False(t, report.Ok)
+	for _, name := range []string{"storage", "retention", "backup"} {
+		assert.False(t, findCheck(report, name).Ok, name)
+	}
+	assert.True(t, findCheck(report, "metrics").Ok)
+	assert.Equal(t, 3.0, gaugeValue(t, monitor, "scale_selfcheck_failed"))
+
+	report = sc.Check(now)
+	assert.False(t, findCheck(report, "clock").Ok)
+}
+
+func TestSelfChecker_Notify(t *testing.T) {
+	received := make(chan SelfCheckReport, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var report SelfCheckReport
+		assert.Nil(t, json.Unmarshal(body, &report))
+		received <- report
+	}))
+	defer server.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.SelfCheckWebhook = server.URL
+	monitor := NewMonitor()
+	sc := NewSelfChecker(config, &FakeStore{}, monitor, NewExporter(config, &FakeStore{}, logger), logger)
+
+	sc.notify(context.Background(), SelfCheckReport{Ok: false, Checks: []SelfCheckResult{{Name: "storage"}}})
+	report := <-received
+	assert.Equal(t, "storage", report.Checks[0].Name)
+	assert.Equal(t, 1, monitor.deliveries.Health()[0].Successes)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errDuplicateMessage = errors.New("duplicate message")
+	errStaleMessage     = errors.New("stale message")
+)
+
+// DuplicateMessageError describes the copy of an already processed message
+// the copy may come through the same transport (retry) or another one (HTTP and MQTT)
+type DuplicateMessageError struct {
+	FirstSource string        // transport which delivered the message first
+	Lag         time.Duration // how late the copy arrived after the first one
+}
+
+func (e *DuplicateMessageError) Error() string {
+	return fmt.Sprintf("duplicate message, first received through %s %s earlier", e.FirstSource, e.Lag)
+}
+
+func (e *DuplicateMessageError) Is(target error) bool {
+	return target == errDuplicateMessage
+}
+
+// messageBootTolerance is the max delay of a retried message
+// lower message id with the boot of the device moved by more than this is a restart, not a stale message
+const messageBootTolerance = time.Minute
+
+// MessageSequence drops duplicate and out-of-order scale messages
+// the scale retries POSTs on flaky WiFi, so the same message may arrive more than once or late.
+// Message id is seconds since the boot of the device (millis()/1000), so it's not unique:
+// more messages are sent within a second and it restarts on reboot and on millis() rollover after 49.7 days.
+//   - the same message with the current id is a duplicate
+//   - lower id is stale, unless the boot time implied by the id (arrival - id) moved,
+//     that means the device restarted or its counter rolled over
+//
+// Every scale has its own counter, so the sequence is tracked per device.
+// Transports are not distinguished, the first copy of the message wins regardless where it came from.
+type MessageSequence struct {
+	mux     sync.Mutex
+	devices map[string]*messageCursor
+}
+
+type messageCursor struct {
+	lastId   uint64
+	lastAt   time.Time                 // arrival of the last accepted message
+	lastBoot time.Time                 // arrival of the last accepted message minus its id
+	seen     map[string]messageArrival // messages accepted with the last id
+}
+
+type messageArrival struct {
+	source string
+	at     time.Time
+}
+
+// MessageCursor is the stored form of the last accepted message of the device, see [ScaleSnapshot]
+// the acknowledgement survives a restart of the backend, so the device does not resend what was processed already
+type MessageCursor struct {
+	Id   uint64            `json:"id"`
+	At   time.Time         `json:"at"`   // arrival of the last accepted message
+	Boot time.Time         `json:"boot"` // arrival minus the id
+	Seen map[string]string `json:"seen"` // sources of the messages accepted with the id by their body
+}
+
+func NewMessageSequence() *MessageSequence {
+	return &MessageSequence{
+		mux:     sync.Mutex{},
+		devices: map[string]*messageCursor{},
+	}
+}
+
+// restoreSequence creates the sequence continuing from the cursors stored by the scales
+func restoreSequence(scales *ScaleRegistry) *MessageSequence {
+	ms := NewMessageSequence()
+	for _, device := range scales.Devices() {
+		scale, _ := scales.Get(device)
+		if cursor, found := scale.LastMessage(); found {
+			ms.Restore(device, cursor)
+		}
+	}
+
+	return ms
+}
+
+// Accept checks the message of the device arrived at now through the source can be processed and records it
+// it returns [DuplicateMessageError] or errStaleMessage otherwise
+func (ms *MessageSequence) Accept(device string, source string, id uint64, body string, now time.Time) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	cursor, found := ms.devices[device]
+	if !found {
+		cursor = &messageCursor{}
+		ms.devices[device] = cursor
+	}
+
+	body = strings.TrimSpace(body)
+	boot := now.Add(-time.Duration(id) * time.Second)
+
+	switch {
+	case cursor.lastBoot.IsZero() || id > cursor.lastId:
+		// first message or the next one
+	case id == cursor.lastId:
+		if first, found := cursor.seen[body]; found {
+			return &DuplicateMessageError{FirstSource: first.source, Lag: now.Sub(first.at)}
+		}
+		cursor.seen[body] = messageArrival{source: source, at: now}
+		cursor.lastAt = now
+		return nil
+	case boot.Sub(cursor.lastBoot) <= messageBootTolerance:
+		return errStaleMessage
+	}
+
+	// new id, restart of the device or rollover of its counter
+	cursor.lastId = id
+	cursor.lastAt = now
+	cursor.lastBoot = boot
+	cursor.seen = map[string]messageArrival{body: {source: source, at: now}}
+	return nil
+}
+
+// LastAccepted returns id and arrival of the last accepted message of the device
+// found is false if the device never sent any message, the cursor survives restarts, see [restoreSequence]
+func (ms *MessageSequence) LastAccepted(device string) (id uint64, at time.Time, found bool) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	cursor, found := ms.devices[device]
+	if !found {
+		return 0, time.Time{}, false
+	}
+
+	return cursor.lastId, cursor.lastAt, true
+}
+
+// Cursor returns the last accepted message of the device to be stored
+func (ms *MessageSequence) Cursor(device string) (MessageCursor, bool) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	cursor, found := ms.devices[device]
+	if !found {
+		return MessageCursor{}, false
+	}
+
+	seen := make(map[string]string, len(cursor.seen))
+	for body, arrival := range cursor.seen {
+		seen[body] = arrival.source
+	}
+	return MessageCursor{Id: cursor.lastId, At: cursor.lastAt, Boot: cursor.lastBoot, Seen: seen}, true
+}
+
+// Restore continues the sequence of the device from the stored cursor
+// messages accepted since the start of the backend win
+func (ms *MessageSequence) Restore(device string, stored MessageCursor) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	if _, found := ms.devices[device]; found {
+		return
+	}
+
+	seen := make(map[string]messageArrival, len(stored.Seen))
+	for body, source := range stored.Seen {
+		seen[body] = messageArrival{source: source, at: stored.At}
+	}
+	ms.devices[device] = &messageCursor{lastId: stored.Id, lastAt: stored.At, lastBoot: stored.Boot, seen: seen}
+}
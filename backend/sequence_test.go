@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageSequence(t *testing.T) {
+	ms := NewMessageSequence()
+	now := time.Now()
+
+	assert.Nil(t, ms.Accept("", SourceHttp, 100, "push|100|-70|20000", now))
+	assert.ErrorIs(t, ms.Accept("", SourceHttp, 100, "push|100|-70|20000", now.Add(time.Second)), errDuplicateMessage)
+	assert.Nil(t, ms.Accept("", SourceHttp, 100, "ping|100|-70|", now), "more messages within a second")
+
+	assert.Nil(t, ms.Accept("", SourceHttp, 110, "push|110|-70|19500", now.Add(10*time.Second)))
+	assert.ErrorIs(t, ms.Accept("", SourceHttp, 105, "push|105|-70|19700", now.Add(12*time.Second)), errStaleMessage, "late retry")
+	assert.ErrorIs(t, ms.Accept("", SourceHttp, 100, "push|100|-70|20000", now.Add(15*time.Second)), errStaleMessage)
+
+	// device restarted, the id starts from zero again
+	assert.Nil(t, ms.Accept("", SourceHttp, 3, "ping|3|-72|", now.Add(5*time.Minute)))
+	assert.Nil(t, ms.Accept("", SourceHttp, 8, "push|8|-72|19000", now.Add(5*time.Minute+5*time.Second)))
+
+	// millis() rollover after 49.7 days
+	ms = NewMessageSequence()
+	assert.Nil(t, ms.Accept("", SourceHttp, 4294960, "push|4294960|-70|20000", now))
+	assert.Nil(t, ms.Accept("", SourceHttp, 2, "push|2|-70|19900", now.Add(9*time.Second)))
+
+	// every scale has its own counter
+	assert.Nil(t, ms.Accept("tap2", SourceHttp, 5, "push|tap2|5|-61|20500", now.Add(10*time.Second)))
+	assert.ErrorIs(t, ms.Accept("tap2", SourceHttp, 5, "push|tap2|5|-61|20500", now.Add(11*time.Second)), errDuplicateMessage)
+}
+
+func TestMessageSequence_AcrossSources(t *testing.T) {
+	ms := NewMessageSequence()
+	now := time.Now()
+
+	assert.Nil(t, ms.Accept("", SourceMqtt, 100, "push|100|-70|20000", now))
+	err := ms.Accept("", SourceHttp, 100, "push|100|-70|20000\n", now.Add(2*time.Second))
+	assert.ErrorIs(t, err, errDuplicateMessage, "the same message through HTTP")
+
+	var duplicate *DuplicateMessageError
+	assert.ErrorAs(t, err, &duplicate)
+	assert.Equal(t, SourceMqtt, duplicate.FirstSource)
+	assert.Equal(t, 2*time.Second, duplicate.Lag)
+}
+
+func TestHandlerRepository_ScaleAck(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	hr := &HandlerRepository{
+		scale:    s,
+		config:   s.config,
+		monitor:  s.monitor,
+		capture:  NewCapture(s.config),
+		mirror:   NewMirror(s.config, s.monitor, s.logger),
+		sequence: NewMessageSequence(),
+		logger:   s.logger,
+	}
+	router := NewRouter(hr)
+	send := func(method, url, body string, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Authorization", "test")
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	lastAck := func() ScaleAck {
+		w := send(http.MethodGet, "/api/scale/last-ack", "", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var ack ScaleAck
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &ack))
+		return ack
+	}
+
+	ack := lastAck()
+	assert.Equal(t, uint64(0), ack.MessageId, "nothing accepted since the start")
+	assert.Nil(t, ack.AcceptedAt)
+	assert.InDelta(t, time.Now().UnixMilli(), ack.ServerUnixMs, 1000)
+
+	assert.Equal(t, "OK", send(http.MethodPost, "/api/scale/push", "ping|41|-70|", "").Body.String(), "old firmware")
+
+	w := send(http.MethodPost, "/api/scale/push", "push|42|-70|21800", "application/json")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &ack))
+	assert.Equal(t, uint64(42), ack.MessageId)
+	assert.NotNil(t, ack.AcceptedAt)
+
+	// the retry after a lost response is acknowledged again, not processed twice
+	w = send(http.MethodPost, "/api/scale/push", "push|42|-70|21800", "application/json")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"message_id":42`)
+	assert.Equal(t, uint64(42), lastAck().MessageId)
+
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/api/scale/last-ack?device=tap9", "", "").Code)
+	r := httptest.NewRequest(http.MethodGet, "/api/scale/last-ack", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestHandlerRepository_ScaleAckRestart(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	newHandler := func(s *Scale) http.Handler {
+		hr := &HandlerRepository{
+			scale:    s,
+			scales:   NewScaleRegistry(s),
+			config:   s.config,
+			monitor:  s.monitor,
+			capture:  NewCapture(s.config),
+			mirror:   NewMirror(s.config, s.monitor, s.logger),
+			sequence: restoreSequence(NewScaleRegistry(s)),
+			logger:   s.logger,
+		}
+		return NewRouter(hr)
+	}
+	send := func(handler http.Handler, method, url, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		r.Header.Set("Authorization", "test")
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send(newHandler(s), http.MethodPost, "/api/scale/push", "push|42|-70|21800").Code)
+
+	// redeploy, the acknowledgement is restored from the snapshot of the scale
+	restarted := NewScale(s.config, NewMonitor(), s.store, s.logger)
+	handler := newHandler(restarted)
+	var ack ScaleAck
+	assert.Nil(t, json.Unmarshal(send(handler, http.MethodGet, "/api/scale/last-ack", "").Body.Bytes(), &ack))
+	assert.Equal(t, uint64(42), ack.MessageId)
+	assert.NotNil(t, ack.AcceptedAt)
+
+	// the device did not get the response before the restart and retries
+	assert.Equal(t, http.StatusOK, send(handler, http.MethodPost, "/api/scale/push", "push|42|-70|21800").Code)
+	assert.Equal(t, 1.0, counterValue(t, restarted.monitor, "scale_messages_dropped_total"), "not processed twice")
+	assert.Equal(t, http.StatusConflict, send(handler, http.MethodPost, "/api/scale/push", "push|30|-70|21900").Code, "stale")
+}
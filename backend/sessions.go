@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// max length of the session tag
+const sessionTagMaxLength = 50
+
+// sessionLookback is how far back a session may start to still be running at the period start
+const sessionLookback = 12 * time.Hour
+
+// SessionTag labels a pub session (quiz night, private party, ...)
+// the session is identified by the time the pub was opened
+type SessionTag struct {
+	OpenedAt time.Time `json:"opened_at"`
+	Tag      string    `json:"tag"`
+}
+
+// Session is a continuous period of scale activity
+type Session struct {
+	OpenedAt time.Time `json:"opened_at"` // first measurement
+	ClosedAt time.Time `json:"closed_at"` // last measurement
+	Tag      string    `json:"tag"`
+	Liters   float64   `json:"liters"`
+	Beers    float64   `json:"beers"`
+
+	BusiestHour *int `json:"busiest_hour,omitempty"` // hour (local timezone) with the most consumption
+}
+
+// SessionGroup aggregates sessions with the same tag
+type SessionGroup struct {
+	Tag       string  `json:"tag"` // empty for untagged sessions
+	Sessions  int     `json:"sessions"`
+	Liters    float64 `json:"liters"`
+	AvgLiters float64 `json:"avg_liters"` // per session
+}
+
+// SessionStats contains sessions within the period and their groups by tag
+type SessionStats struct {
+	Sessions []Session      `json:"sessions"`
+	Groups   []SessionGroup `json:"groups"`
+	Busiest  *Session       `json:"busiest,omitempty"` // session with the most liters, the night that drank the most
+}
+
+// SplitSessions splits measurements ordered by time into sessions
+// a gap longer than [OkLimit] closes the pub, the same rule as [CalcDailySummary]
+// the pub is opened by the first ping, so the tag may precede the first measurement by [OkLimit]
+func SplitSessions(measurements []Measurement, tags []SessionTag, glass float64) []Session {
+	sessions := []Session{}
+	consumed := 0.0
+	byHour := map[int]float64{}
+	closeSession := func() {
+		last := &sessions[len(sessions)-1]
+		last.Liters = math.Round(consumed) / 1000
+		if glass > 0 {
+			last.Beers = math.Round(consumed/glass*10) / 10
+		}
+		last.BusiestHour = busiestHour(byHour)
+		for _, tag := range tags {
+			if !tag.OpenedAt.Before(last.OpenedAt.Add(-OkLimit)) && !tag.OpenedAt.After(last.ClosedAt) {
+				last.Tag = tag.Tag
+			}
+		}
+		consumed = 0
+		byHour = map[int]float64{}
+	}
+
+	for i, m := range measurements {
+		if i == 0 || m.At.Sub(measurements[i-1].At) > OkLimit {
+			if i > 0 {
+				closeSession()
+			}
+			sessions = append(sessions, Session{OpenedAt: m.At})
+		} else if drop := measurements[i-1].Weight - m.Weight; drop > 0 {
+			consumed += drop
+			byHour[m.At.In(getTz()).Hour()] += drop
+		}
+		sessions[len(sessions)-1].ClosedAt = m.At
+	}
+	if len(sessions) > 0 {
+		closeSession()
+	}
+
+	return sessions
+}
+
+// SessionTagAt returns tag of the session running at the time, empty if there is none
+func SessionTagAt(sessions []Session, at time.Time) string {
+	for _, session := range sessions {
+		if !at.Before(session.OpenedAt) && !at.After(session.ClosedAt) {
+			return session.Tag
+		}
+	}
+
+	return ""
+}
+
+// GroupSessions aggregates sessions by their tag ordered by the tag
+func GroupSessions(sessions []Session) []SessionGroup {
+	byTag := map[string]*SessionGroup{}
+	for _, session := range sessions {
+		group, found := byTag[session.Tag]
+		if !found {
+			group = &SessionGroup{Tag: session.Tag}
+			byTag[session.Tag] = group
+		}
+		group.Sessions++
+		group.Liters += session.Liters
+	}
+
+	groups := make([]SessionGroup, 0, len(byTag))
+	for _, group := range byTag {
+		group.Liters = math.Round(group.Liters*100) / 100
+		group.AvgLiters = math.Round(group.Liters/float64(group.Sessions)*100) / 100
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Tag < groups[j].Tag
+	})
+
+	return groups
+}
+
+// GetSessionStats returns sessions of the last days grouped by tag
+func GetSessionStats(store Storage, days int, glass float64, dayStart int, now time.Time) (SessionStats, error) {
+	from := pubDayStart(now, dayStart).AddDate(0, 0, -days+1)
+
+	measurements, err := store.GetMeasurements(from, now)
+	if err != nil {
+		return SessionStats{}, fmt.Errorf("could not load measurements: %w", err)
+	}
+	tags, err := store.GetSessionTags(from.Add(-OkLimit), now)
+	if err != nil {
+		return SessionStats{}, fmt.Errorf("could not load session tags: %w", err)
+	}
+
+	sessions := SplitSessions(measurements, tags, glass)
+	stats := SessionStats{Sessions: sessions, Groups: GroupSessions(sessions)}
+	for i, session := range sessions {
+		if session.Liters > 0 && (stats.Busiest == nil || session.Liters > stats.Busiest.Liters) {
+			stats.Busiest = &sessions[i]
+		}
+	}
+
+	return stats, nil
+}
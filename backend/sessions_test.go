@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitSessions(t *testing.T) {
+	friday := time.Date(2024, 5, 3, 18, 0, 0, 0, time.UTC)
+	saturday := friday.Add(24 * time.Hour)
+	measurements := []Measurement{
+		{Weight: 20000, At: friday},
+		{Weight: 19500, At: friday.Add(time.Minute)},
+		{Weight: 19000, At: friday.Add(2 * time.Minute)},
+		{Weight: 19000, At: saturday},
+		{Weight: 18500, At: saturday.Add(time.Minute)},
+	}
+	tags := []SessionTag{{OpenedAt: friday.Add(-time.Minute), Tag: "quiz night"}}
+
+	sessions := SplitSessions(measurements, tags, 500)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "quiz night", sessions[0].Tag)
+	assert.Equal(t, 1.0, sessions[0].Liters)
+	assert.Equal(t, 2.0, sessions[0].Beers)
+	assert.Equal(t, friday.In(getTz()).Hour(), *sessions[0].BusiestHour)
+	assert.Equal(t, "", sessions[1].Tag)
+	assert.Equal(t, 0.5, sessions[1].Liters)
+
+	assert.Equal(t, "quiz night", SessionTagAt(sessions, friday.Add(time.Minute)))
+	assert.Equal(t, "", SessionTagAt(sessions, friday.Add(time.Hour)))
+
+	groups := GroupSessions(sessions)
+	assert.Equal(t, []SessionGroup{
+		{Tag: "", Sessions: 1, Liters: 0.5, AvgLiters: 0.5},
+		{Tag: "quiz night", Sessions: 1, Liters: 1, AvgLiters: 1},
+	}, groups)
+}
+
+func TestScale_TagSession(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	_, err := s.TagSession("private party")
+	assert.NotNil(t, err, "pub is closed")
+
+	s.Ping()
+	tag, err := s.TagSession("private party")
+	assert.Nil(t, err)
+	assert.Equal(t, s.Pub.OpenedAt, tag.OpenedAt)
+
+	tags, err := s.store.GetSessionTags(tag.OpenedAt, tag.OpenedAt.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Equal(t, []SessionTag{tag}, tags)
+
+	_, err = s.TagSession("")
+	assert.Nil(t, err)
+	tags, err = s.store.GetSessionTags(tag.OpenedAt, tag.OpenedAt.Add(time.Second))
+	assert.Nil(t, err)
+	assert.Empty(t, tags)
+}
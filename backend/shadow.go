@@ -0,0 +1,71 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// DeviceShadow represents configuration of the scale device
+// Desired state is set by the admin, reported state is sent by the device itself
+// The device is supposed to apply desired configuration and report it back
+type DeviceShadow struct {
+	Desired    map[string]string `json:"desired"`
+	Reported   map[string]string `json:"reported"`
+	DesiredAt  time.Time         `json:"desired_at"`
+	ReportedAt time.Time         `json:"reported_at"`
+
+	// PendingReports counts reports received since the desired state was changed
+	// and the device still has not applied it
+	PendingReports int `json:"pending_reports"`
+}
+
+// NewDeviceShadow creates an empty shadow
+func NewDeviceShadow() DeviceShadow {
+	return DeviceShadow{
+		Desired:    map[string]string{},
+		Reported:   map[string]string{},
+		DesiredAt:  time.Unix(0, 0),
+		ReportedAt: time.Unix(0, 0),
+	}
+}
+
+// Delta returns desired keys which are not reported with the same value
+func (ds DeviceShadow) Delta() map[string]string {
+	delta := map[string]string{}
+	for key, value := range ds.Desired {
+		if reported, found := ds.Reported[key]; !found || reported != value {
+			delta[key] = value
+		}
+	}
+
+	return delta
+}
+
+// InSync returns true if the device applied the whole desired state
+func (ds DeviceShadow) InSync() bool {
+	return len(ds.Delta()) == 0
+}
+
+// ParseReportedConfig parses device configuration from the scale message
+// String format: key=value,key=value
+func ParseReportedConfig(raw string) (map[string]string, error) {
+	return parseKeyValues(raw)
+}
+
+// FormatConfig formats configuration in the same format the device reports it
+// keys are sorted, so the output is stable
+func FormatConfig(config map[string]string) string {
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+config[key])
+	}
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sheetsScope    = "https://www.googleapis.com/auth/spreadsheets"
+	sheetsApiUrl   = "https://sheets.googleapis.com/v4/spreadsheets"
+	googleTokenUrl = "https://oauth2.googleapis.com/token"
+)
+
+// ServiceAccount is the relevant subset of the Google service account key file
+type ServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenUri    string `json:"token_uri"`
+}
+
+// ParseServiceAccount parses the JSON key file downloaded from Google Cloud console
+func ParseServiceAccount(raw string) (ServiceAccount, *rsa.PrivateKey, error) {
+	var sa ServiceAccount
+	if err := json.Unmarshal([]byte(raw), &sa); err != nil {
+		return sa, nil, fmt.Errorf("invalid service account json: %w", err)
+	}
+	if sa.ClientEmail == "" {
+		return sa, nil, fmt.Errorf("service account has no client_email")
+	}
+	if sa.TokenUri == "" {
+		sa.TokenUri = googleTokenUrl
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return sa, nil, fmt.Errorf("service account private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return sa, nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return sa, nil, fmt.Errorf("service account private key is not RSA")
+	}
+
+	return sa, rsaKey, nil
+}
+
+// Sheets appends daily summary rows to a Google Sheet
+// the sheet has to be shared with the service account email
+type Sheets struct {
+	config  *Config
+	store   Storage
+	monitor *Monitor
+	logger  *logrus.Logger
+	client  *http.Client
+
+	account ServiceAccount
+	key     *rsa.PrivateKey
+	token   string
+	expires time.Time
+}
+
+func NewSheets(config *Config, store Storage, monitor *Monitor, logger *logrus.Logger) *Sheets {
+	return &Sheets{
+		config:  config,
+		store:   store,
+		monitor: monitor,
+		logger:  logger,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Enabled returns true if the spreadsheet and credentials are configured
+func (s *Sheets) Enabled() bool {
+	return s.config.SheetsId != "" && s.config.SheetsCredentials != ""
+}
+
+// Run appends the last finished pub day every night at [Config.ExportHour]
+// it's supposed to run as a supervised worker
+func (s *Sheets) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	next := nextExportAt(time.Now(), s.config.ExportHour)
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("Sheets stopped")
+			return
+		case now := <-tick.C:
+			heartbeat()
+			if !s.Enabled() {
+				continue
+			}
+			next = s.appendDue(ctx, now, next)
+		}
+	}
+}
+
+// appendDue appends the pub day finished before next once it's due and returns when the following day is due
+// a failed append keeps next, so the row is retried on the next tick and days missed during an outage are caught up one by one
+func (s *Sheets) appendDue(ctx context.Context, now, next time.Time) time.Time {
+	if now.Before(next) {
+		return next
+	}
+
+	// the last finished pub day
+	day := pubDayStart(next, s.config.PubDayStart).AddDate(0, 0, -1)
+	if _, err := s.AppendDay(ctx, day); err != nil {
+		s.logger.Errorf("Could not append day %s to Google Sheets, retrying: %v", day.Format(time.DateOnly), err)
+		return next
+	}
+
+	return nextExportAt(next, s.config.ExportHour)
+}
+
+// AppendDay calculates summary of the given local day and appends it as a new row
+func (s *Sheets) AppendDay(ctx context.Context, day time.Time) (DailySummary, error) {
+	day = day.In(getTz())
+	from := time.Date(day.Year(), day.Month(), day.Day(), s.config.PubDayStart, 0, 0, 0, getTz())
+	to := from.AddDate(0, 0, 1)
+
+	measurements, err := s.store.GetMeasurements(from, to)
+	if err != nil {
+		return DailySummary{}, fmt.Errorf("could not load measurements: %w", err)
+	}
+
+	summary := CalcDailySummary(from, measurements, s.config.GlassSize)
+	row := []any{
+		summary.Day,
+		fmt.Sprintf("%.2f", summary.Liters),
+		fmt.Sprintf("%.1f", summary.Beers),
+		summary.Sessions,
+	}
+
+	err = s.monitor.deliveries.Track("sheets", func() error {
+		return s.append(ctx, row)
+	})
+	if err != nil {
+		return DailySummary{}, err
+	}
+
+	s.logger.Infof("Appended summary of %s to Google Sheets", summary.Day)
+	return summary, nil
+}
+
+func (s *Sheets) append(ctx context.Context, row []any) error {
+	if s.config.DryRun {
+		s.logger.Infof("Dry run, not appending row to Google Sheets: %v", row)
+		return nil
+	}
+
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{"values": [][]any{row}})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/values/%s:append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS",
+		sheetsApiUrl, url.PathEscape(s.config.SheetsId), url.PathEscape(s.config.SheetsRange))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("sheets api returned status %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// accessToken exchanges a signed JWT for an OAuth access token
+// the token is cached until shortly before its expiration
+func (s *Sheets) accessToken(ctx context.Context) (string, error) {
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	if s.key == nil {
+		account, key, err := ParseServiceAccount(s.config.SheetsCredentials)
+		if err != nil {
+			return "", err
+		}
+		s.account, s.key = account, key
+	}
+
+	assertion, err := signServiceAccountJwt(s.account, s.key, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.account.TokenUri, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return "", fmt.Errorf("token endpoint returned status %d", res.StatusCode)
+	}
+
+	var data struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+
+	s.token = data.AccessToken
+	s.expires = time.Now().Add(time.Duration(data.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
+
+// signServiceAccountJwt creates RS256 signed JWT assertion for the token endpoint
+func signServiceAccountJwt(account ServiceAccount, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   account.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   account.TokenUri,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("could not sign jwt: %w", err)
+	}
+
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
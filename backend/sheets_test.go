@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSheets_AppendDue(t *testing.T) {
+	logger := logrus.New()
+	var logs bytes.Buffer
+	logger.SetOutput(&logs)
+	config := NewConfig()
+	config.SheetsId = "sheet"
+	config.SheetsCredentials = "{}" // the access token can't be obtained
+	sheets := NewSheets(config, &FakeStore{}, NewMonitor(), logger)
+	ctx := context.Background()
+
+	next := time.Date(2024, 5, 14, config.ExportHour, 0, 0, 0, getTz())
+	assert.Equal(t, next, sheets.appendDue(ctx, next.Add(-time.Minute), next), "not due yet")
+	assert.Equal(t, next, sheets.appendDue(ctx, next.Add(time.Minute), next), "failed append is retried")
+	assert.Contains(t, logs.String(), "Could not append day 2024-05-12", "the pub day of the 13th lasts until the morning")
+
+	// recovered two days later, the missed days are appended one by one
+	config.DryRun = true
+	now := next.AddDate(0, 0, 2).Add(time.Minute)
+	next = sheets.appendDue(ctx, now, next)
+	assert.Equal(t, time.Date(2024, 5, 15, config.ExportHour, 0, 0, 0, getTz()), next)
+	assert.Contains(t, logs.String(), "Appended summary of 2024-05-12")
+	next = sheets.appendDue(ctx, now, next)
+	next = sheets.appendDue(ctx, now, next)
+	assert.Equal(t, time.Date(2024, 5, 17, config.ExportHour, 0, 0, 0, getTz()), next)
+	assert.Contains(t, logs.String(), "Appended summary of 2024-05-14")
+	assert.Equal(t, next, sheets.appendDue(ctx, now, next), "caught up")
+}
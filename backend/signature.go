@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scale messages can be signed by HMAC-SHA256 with the secret of the device instead of sending the shared token.
+// The signature covers the timestamp and the body, so neither can be changed and an old message can't be replayed
+// after [Config.SignatureMaxAge]. A replay within that window is recognized by [SignatureReplays],
+// [MessageSequence] alone would take a replayed lower message id for a restart of the device.
+const (
+	ScaleTimestampHeader = "X-Scale-Timestamp" // unix seconds of sending the message
+	ScaleSignatureHeader = "X-Scale-Signature" // hex encoded HMAC-SHA256 of "timestamp\nbody"
+
+	// defaultDeviceSecret is the key of the secret of the default scale (messages without device id)
+	defaultDeviceSecret = "default"
+)
+
+var (
+	errMissingSignature = errors.New("missing signature")
+	errInvalidSignature = errors.New("invalid signature")
+	errExpiredSignature = errors.New("signature expired")
+)
+
+// SignatureReplays remembers signatures accepted until they expire, so a captured message can't be sent again
+// the set stays small, only verified signatures within [Config.SignatureMaxAge] are kept
+type SignatureReplays struct {
+	mux  sync.Mutex
+	seen map[string]time.Time // signature and its expiration
+}
+
+func NewSignatureReplays() *SignatureReplays {
+	return &SignatureReplays{
+		mux:  sync.Mutex{},
+		seen: map[string]time.Time{},
+	}
+}
+
+// Accept records the signature valid until expires
+// it returns false if the signature was accepted already
+func (sr *SignatureReplays) Accept(signature string, expires time.Time, now time.Time) bool {
+	sr.mux.Lock()
+	defer sr.mux.Unlock()
+
+	for seen, until := range sr.seen {
+		if now.After(until) {
+			delete(sr.seen, seen)
+		}
+	}
+
+	signature = strings.ToLower(signature)
+	if _, found := sr.seen[signature]; found {
+		return false
+	}
+	sr.seen[signature] = expires
+	return true
+}
+
+// SignScaleMessage returns hex encoded signature of the body sent at the time
+func SignScaleMessage(secret string, at time.Time, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(at.Unix(), 10) + "\n" + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyScaleSignature checks the signed request of the device
+// the timestamp may differ from now by maxAge in both directions, clock of the device is not exact
+func VerifyScaleSignature(r *http.Request, body string, device string, secrets map[string]string, maxAge time.Duration, now time.Time) error {
+	timestamp := r.Header.Get(ScaleTimestampHeader)
+	signature := r.Header.Get(ScaleSignatureHeader)
+	if timestamp == "" || signature == "" {
+		return errMissingSignature
+	}
+
+	if device == "" {
+		device = defaultDeviceSecret
+	}
+	secret, found := secrets[device]
+	if !found {
+		return errInvalidSignature
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidSignature
+	}
+	at := time.Unix(unix, 0)
+
+	expected := SignScaleMessage(secret, at, body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return errInvalidSignature
+	}
+
+	if now.Sub(at).Abs() > maxAge {
+		return errExpiredSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func signedRequest(body string, secret string, at time.Time) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/scale/push", strings.NewReader(body))
+	r.Header.Set(ScaleTimestampHeader, strconv.FormatInt(at.Unix(), 10))
+	r.Header.Set(ScaleSignatureHeader, SignScaleMessage(secret, at, body))
+	return r
+}
+
+func TestVerifyScaleSignature(t *testing.T) {
+	secrets := map[string]string{"default": "0123456789abcdef", "tap2": "fedcba9876543210"}
+	now := time.Now()
+	body := "push|10|-70|30000"
+
+	assert.Nil(t, VerifyScaleSignature(signedRequest(body, "0123456789abcdef", now), body, "", secrets, time.Minute, now))
+	assert.Nil(t, VerifyScaleSignature(signedRequest(body, "0123456789abcdef", now), body, "", secrets, time.Minute, now.Add(-30*time.Second)), "clock of the device is ahead")
+
+	r := signedRequest(body, "0123456789abcdef", now)
+	assert.ErrorIs(t, VerifyScaleSignature(r, "push|10|-70|60000", "", secrets, time.Minute, now), errInvalidSignature, "body was changed")
+	r.Header.Set(ScaleTimestampHeader, strconv.FormatInt(now.Add(time.Second).Unix(), 10))
+	assert.ErrorIs(t, VerifyScaleSignature(r, body, "", secrets, time.Minute, now), errInvalidSignature, "timestamp was changed")
+
+	assert.ErrorIs(t, VerifyScaleSignature(signedRequest(body, "0123456789abcdef", now), body, "tap2", secrets, time.Minute, now), errInvalidSignature, "secret of another device")
+	assert.ErrorIs(t, VerifyScaleSignature(signedRequest(body, "0123456789abcdef", now), body, "tap3", secrets, time.Minute, now), errInvalidSignature, "unknown device")
+	assert.ErrorIs(t, VerifyScaleSignature(signedRequest(body, "0123456789abcdef", now.Add(-2*time.Minute)), body, "", secrets, time.Minute, now), errExpiredSignature, "replayed")
+	assert.ErrorIs(t, VerifyScaleSignature(httptest.NewRequest(http.MethodPost, "/", nil), body, "", secrets, time.Minute, now), errMissingSignature)
+}
+
+func TestScaleMessageHandler_Authentication(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ScaleSecrets = map[string]string{"default": "0123456789abcdef"}
+	monitor := NewMonitor()
+	hr := &HandlerRepository{
+		scale:   NewScale(config, monitor, &FakeStore{}, logger),
+		config:  config,
+		monitor: monitor,
+		capture: NewCapture(config),
+		mirror:  NewMirror(config, monitor, logger),
+		logger:  logger,
+	}
+	handler := hr.scaleMessageHandler()
+	push := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	token := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/scale/push", strings.NewReader(body))
+		r.Header.Set("Authorization", config.AuthToken)
+		return r
+	}
+
+	assert.Equal(t, http.StatusOK, push(signedRequest("push|10|-70|30000", "0123456789abcdef", time.Now())))
+	assert.Equal(t, http.StatusUnauthorized, push(signedRequest("push|11|-70|30000", "wrong-secret-0000", time.Now())))
+	assert.Equal(t, http.StatusOK, push(token("push|12|-70|30000")), "token is accepted during migration")
+
+	config.Password = "admin-password"
+	config.ApiTokens = map[string]ApiToken{"scale": {Scope: ScopeDeviceIngest, Token: "device-token"}}
+	scoped := func(body, auth string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/scale/push", strings.NewReader(body))
+		r.Header.Set("Authorization", auth)
+		return r
+	}
+	assert.Equal(t, http.StatusOK, push(scoped("push|15|-70|30000", "device-token")))
+	assert.Equal(t, http.StatusUnauthorized, push(scoped("push|16|-70|30000", "admin-password")), "admin is not a device")
+
+	config.ScaleTokenAuth = false
+	assert.Equal(t, http.StatusUnauthorized, push(token("push|13|-70|30000")))
+	assert.Equal(t, http.StatusOK, push(signedRequest("push|14|-70|29500", "0123456789abcdef", time.Now())))
+	assert.Equal(t, 29500.0, hr.scale.Weight)
+}
+
+func TestScaleMessageHandler_Replay(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ScaleSecrets = map[string]string{"default": "0123456789abcdef"}
+	config.ScaleTokenAuth = false
+	monitor := NewMonitor()
+	hr := &HandlerRepository{
+		scale:    NewScale(config, monitor, &FakeStore{}, logger),
+		config:   config,
+		monitor:  monitor,
+		capture:  NewCapture(config),
+		mirror:   NewMirror(config, monitor, logger),
+		sequence: NewMessageSequence(),
+		replays:  NewSignatureReplays(),
+		logger:   logger,
+	}
+	handler := hr.scaleMessageHandler()
+	push := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	sentAt := time.Now().Add(-2 * time.Minute)
+	assert.Equal(t, http.StatusOK, push(signedRequest("push|100|-70|30000", "0123456789abcdef", sentAt)))
+	assert.Equal(t, http.StatusOK, push(signedRequest("push|220|-70|29500", "0123456789abcdef", time.Now())))
+
+	// the lower id implies the device booted 2 minutes later, the sequence alone would take it for a restart
+	assert.Equal(t, http.StatusOK, push(signedRequest("push|100|-70|30000", "0123456789abcdef", sentAt)), "acknowledged, not processed")
+	assert.Equal(t, 29500.0, hr.scale.Weight)
+	id, _, _ := hr.sequence.LastAccepted("")
+	assert.Equal(t, uint64(220), id, "the cursor is not reset")
+	metric := &dto.Metric{}
+	assert.Nil(t, monitor.messagesDropped.WithLabelValues("replay").Write(metric))
+	assert.Equal(t, 1.0, metric.GetCounter().GetValue())
+}
+
+func TestSignatureReplays(t *testing.T) {
+	replays := NewSignatureReplays()
+	now := time.Now()
+	assert.True(t, replays.Accept("ABCD", now.Add(time.Minute), now))
+	assert.False(t, replays.Accept("abcd", now.Add(time.Minute), now.Add(30*time.Second)))
+	assert.True(t, replays.Accept("ef01", now.Add(time.Minute), now))
+
+	// expired signatures are rejected by the verification, they don't have to be kept
+	assert.True(t, replays.Accept("abcd", now.Add(3*time.Minute), now.Add(2*time.Minute)))
+	assert.Len(t, replays.seen, 1)
+}
+
+func TestScaleBatchHandler(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.ScaleSecrets = map[string]string{"default": "0123456789abcdef"}
+	monitor := NewMonitor()
+	hr := &HandlerRepository{
+		scale:   NewScale(config, monitor, &FakeStore{}, logger),
+		config:  config,
+		monitor: monitor,
+		logger:  logger,
+	}
+	handler := hr.scaleBatchHandler()
+
+	now := time.Now()
+	hr.scale.WeightAt = now.Add(-time.Hour) // WiFi dropped
+	body := fmt.Sprintf("%d|push|1|-70|30000\n%d|ping|2|-70|\n%d|push|3|-70|29500\n%d|push|4|-70|29000",
+		now.Add(-time.Minute).Unix(), now.Add(-50*time.Second).Unix(), now.Add(-40*time.Second).Unix(), now.Add(-30*24*time.Hour).Unix())
+	w := httptest.NewRecorder()
+	handler(w, signedRequest(body, "0123456789abcdef", now))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"stored": 0, "processed": 2, "skipped": 2}`, w.Body.String())
+	assert.Equal(t, 29500.0, hr.scale.Weight)
+
+	w = httptest.NewRecorder()
+	handler(w, signedRequest(body, "wrong-secret-0000", now))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	handler(w, signedRequest("push|1|-70|30000", "0123456789abcdef", now))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "timestamps are required")
+}
+
+func TestScaleMessageHandler_Limits(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	monitor := NewMonitor()
+	hr := &HandlerRepository{
+		scale:         NewScale(config, monitor, &FakeStore{}, logger),
+		config:        config,
+		monitor:       monitor,
+		capture:       NewCapture(config),
+		mirror:        NewMirror(config, monitor, logger),
+		logger:        logger,
+		ingestLimiter: NewRateLimiter(3, time.Minute),
+		deviceLimiter: NewRateLimiter(1, time.Minute),
+	}
+	handler := hr.scaleMessageHandler()
+	push := func(body string, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/scale/push", strings.NewReader(body))
+		r.Header.Set("Authorization", config.AuthToken)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, push("push|1|-70|"+strings.Repeat("9", config.IngestMaxBody), "10.0.0.1:1234").Code)
+
+	assert.Equal(t, http.StatusOK, push("push|2|-70|30000", "10.0.0.1:1234").Code)
+	w := push("push|3|-70|30000", "10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the device is over its limit")
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusTooManyRequests, push("push|4|-70|30000", "10.0.0.1:1234").Code, "the address is over its limit")
+	assert.Equal(t, http.StatusTooManyRequests, push("push|5|-70|30000", "10.0.0.2:1234").Code, "the device is limited from any address")
+
+	rejected := func(reason string) float64 {
+		metric := &dto.Metric{}
+		assert.Nil(t, monitor.ingestRejected.WithLabelValues(reason).Write(metric))
+		return metric.GetCounter().GetValue()
+	}
+	assert.Equal(t, 1.0, rejected("body_size"))
+	assert.Equal(t, 1.0, rejected("rate_limit"))
+	assert.Equal(t, 2.0, rejected("device_rate_limit"))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// behaviour of the simulated scale, chances are per message
+const (
+	simulatorPourChance    = 0.3
+	simulatorOfflineChance = 0.005
+	simulatorMaxOffline    = 10 * time.Minute // longer than OkLimit, so the dashboard shows the scale offline
+	simulatorSwapMessages  = 6                // messages of the empty platform while the keg is replaced
+	simulatorRssi          = -65.0            // dBm, mean signal of the WiFi
+	simulatorNoise         = 15.0             // grams, noise of the load cell
+)
+
+// Simulator is a scale living inside the backend, it sends push messages to the normal pipeline
+// the keg is drained by pours, replaced by a full one when it runs empty and the WiFi drops sometimes
+// it's meant for development and demos of the frontend and alerting without the hardware, see [Config.Simulate]
+type Simulator struct {
+	config *Config
+	ingest func(message string) error
+	rand   *rand.Rand
+	logger *logrus.Logger
+
+	boot         time.Time
+	keg          int     // liters, size of the keg on the scale
+	weight       float64 // grams on the scale without noise
+	swapping     int     // remaining messages of the empty platform
+	offlineUntil time.Time
+}
+
+func NewSimulator(config *Config, ingest func(message string) error, seed int64, logger *logrus.Logger) *Simulator {
+	keg := 30
+	return &Simulator{
+		config: config,
+		ingest: ingest,
+		rand:   rand.New(rand.NewSource(seed)),
+		logger: logger,
+		keg:    keg,
+		weight: GetFullWeights()[keg],
+	}
+}
+
+// Enabled returns true if the simulated scale is configured
+func (sim *Simulator) Enabled() bool {
+	return sim.config.Simulate
+}
+
+// Next returns the message the scale sends at the given time, empty while it is offline
+func (sim *Simulator) Next(now time.Time) string {
+	if sim.boot.IsZero() {
+		sim.boot = now
+	}
+	if now.Before(sim.offlineUntil) {
+		return ""
+	}
+	if sim.rand.Float64() < simulatorOfflineChance {
+		sim.offlineUntil = now.Add(time.Minute + time.Duration(sim.rand.Int63n(int64(simulatorMaxOffline-time.Minute))))
+		sim.logger.Debugf("Simulated scale is offline until %s", formatTime(sim.offlineUntil))
+		return ""
+	}
+
+	switch {
+	case sim.swapping > 0:
+		sim.swapping--
+		if sim.swapping == 0 {
+			sizes := []int{15, 20, 30, 50}
+			sim.keg = sizes[sim.rand.Intn(len(sizes))]
+			sim.weight = GetFullWeights()[sim.keg]
+			sim.logger.Debugf("Simulated scale has a new %d l keg", sim.keg)
+		}
+	case sim.weight-GetEmptyWeights()[sim.keg] < sim.config.GlassSize:
+		// the empty keg is lifted from the platform
+		sim.swapping = simulatorSwapMessages
+		sim.weight = 0
+	case sim.rand.Float64() < simulatorPourChance:
+		sim.weight -= sim.config.GlassSize * (0.9 + 0.2*sim.rand.Float64())
+	}
+
+	weight := sim.weight
+	if weight > 0 {
+		weight = math.Round(weight + sim.rand.NormFloat64()*simulatorNoise)
+	}
+	rssi := math.Round(simulatorRssi + sim.rand.NormFloat64()*5)
+
+	// ids are seconds since the boot like on the device
+	return fmt.Sprintf("%s|%d|%.0f|%.0f", PushMessageType, 1+int(now.Sub(sim.boot).Seconds()), rssi, weight)
+}
+
+// Run sends a message every [Config.SimulateInterval]
+// it's supposed to run as a supervised worker
+func (sim *Simulator) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(sim.config.SimulateInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			sim.logger.Debug("Simulator stopped")
+			return
+		case now := <-tick.C:
+			heartbeat()
+			message := sim.Next(now)
+			if message == "" {
+				continue
+			}
+			if err := sim.ingest(message); err != nil {
+				sim.logger.Warnf("Simulated scale message %s rejected: %v", message, err)
+			}
+		}
+	}
+}
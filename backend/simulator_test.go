@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulator(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.Simulate = true
+	s := CreateScaleWithMeasurements()
+	hr := &HandlerRepository{scale: s, config: config, monitor: s.monitor, capture: NewCapture(config), mirror: NewMirror(config, s.monitor, logger), logger: logger}
+
+	sim := NewSimulator(config, func(message string) error {
+		_, err := hr.ingestMessage(message, SourceSimulator)
+		return err
+	}, 42, logger)
+	assert.True(t, sim.Enabled())
+
+	start := time.Now().Add(-72 * time.Hour)
+	offline, swaps, pours := 0, 0, 0
+	last := ScaleMessage{}
+	for i := 0; i < 20000; i++ {
+		message := sim.Next(start.Add(time.Duration(i) * config.SimulateInterval))
+		if message == "" {
+			offline++
+			continue
+		}
+
+		parsed, err := ParseScaleMessage(message)
+		assert.Nil(t, err, message)
+		assert.InDelta(t, -65, parsed.Rssi, 30)
+		switch {
+		case parsed.Value == 0 && last.Value > 0:
+			swaps++
+		case parsed.Value < last.Value-300:
+			pours++
+		}
+		assert.LessOrEqual(t, parsed.Value, 60200.0, "a full 50 l keg at most")
+		last = parsed
+	}
+	assert.Greater(t, offline, 0)
+	assert.Greater(t, swaps, 3, "kegs are replaced when empty")
+	assert.Greater(t, pours, 500)
+
+	// messages pass the pipeline of the real scale
+	now := time.Now()
+	message := sim.Next(now)
+	for message == "" {
+		now = now.Add(config.SimulateInterval)
+		message = sim.Next(now)
+	}
+	assert.Nil(t, sim.ingest(message))
+	parsed, _ := ParseScaleMessage(message)
+	assert.Equal(t, parsed.Value, s.Weight)
+}
@@ -0,0 +1,72 @@
+package main
+
+import "time"
+
+// snapshotInterval is how often the runtime state of the scale is stored by the recheck
+const snapshotInterval = time.Minute
+
+// ScaleSnapshot is the runtime state of the scale which is not stored on change
+// it's restored on start, so a redeploy during opening hours does not close the pub
+type ScaleSnapshot struct {
+	Pub         Pub            `json:"pub"`
+	LastOk      time.Time      `json:"last_ok"`
+	Rssi        float64        `json:"rssi"`
+	PubOverride *PubOverride   `json:"pub_override,omitempty"`
+	ClosingSoon bool           `json:"closing_soon"`           // closing soon was already signaled for the opening
+	LastMessage *MessageCursor `json:"last_message,omitempty"` // last accepted message of the device, see [MessageSequence.Restore]
+	SavedAt     time.Time      `json:"saved_at"`
+}
+
+// saveSnapshot stores the runtime state
+// caller has to hold the lock
+func (s *Scale) saveSnapshot(now time.Time) error {
+	s.snapshotAt = now
+	return s.store.SetSnapshot(ScaleSnapshot{
+		Pub:         s.Pub,
+		LastOk:      s.LastOk,
+		Rssi:        s.Rssi,
+		PubOverride: s.PubOverride,
+		ClosingSoon: s.closingSoon,
+		LastMessage: s.lastMessage,
+		SavedAt:     now,
+	})
+}
+
+// restoreSnapshot applies the stored runtime state
+// the pub stays open only if the device is still ok, otherwise the next recheck closes it
+func (s *Scale) restoreSnapshot(snapshot ScaleSnapshot) {
+	s.Pub = snapshot.Pub
+	s.LastOk = snapshot.LastOk
+	s.Rssi = snapshot.Rssi
+	s.closingSoon = snapshot.ClosingSoon
+	s.lastMessage = snapshot.LastMessage
+	if snapshot.PubOverride != nil && time.Now().Before(snapshot.PubOverride.Until) {
+		s.PubOverride = snapshot.PubOverride
+	}
+
+	if s.Pub.IsOpen {
+		s.monitor.pubIsOpen.WithLabelValues().Set(1)
+	}
+	s.monitor.scaleWifiRssi.WithLabelValues().Set(s.Rssi)
+}
+
+// SetLastMessage records the last accepted message of the device and stores the snapshot right away,
+// so the message is not processed twice when the device retries it after a restart of the backend
+func (s *Scale) SetLastMessage(cursor MessageCursor) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.lastMessage = &cursor
+	s.storeFailed(s.saveSnapshot(time.Now()), "snapshot")
+}
+
+// LastMessage returns the last accepted message of the device, found is false if it was never stored
+func (s *Scale) LastMessage() (MessageCursor, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.lastMessage == nil {
+		return MessageCursor{}, false
+	}
+	return *s.lastMessage, true
+}
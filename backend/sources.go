@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// SourcePolicy decides which transport feeds the pipeline when the device reports through more of them
+// (e.g. HTTP with retries and MQTT). Copies of the same message are dropped by [MessageSequence] already,
+// so without preference the first copy wins, that is the lowest-latency transport.
+// With a preferred source, messages of other transports are processed only when the preferred one is silent
+// for the failover time, so a lagging transport can't interleave older values with the preferred one.
+type SourcePolicy struct {
+	mux       sync.Mutex
+	preferred string        // empty processes every transport
+	failover  time.Duration // silence of the preferred source after which other sources are used
+	lastSeen  map[string]time.Time
+}
+
+func NewSourcePolicy(preferred string, failover time.Duration) *SourcePolicy {
+	return &SourcePolicy{
+		mux:       sync.Mutex{},
+		preferred: preferred,
+		failover:  failover,
+		lastSeen:  map[string]time.Time{},
+	}
+}
+
+// Allow records the message of the device received through the source at now
+// and reports whether it should be processed
+func (sp *SourcePolicy) Allow(device string, source string, now time.Time) bool {
+	sp.mux.Lock()
+	defer sp.mux.Unlock()
+
+	sp.lastSeen[device+"|"+source] = now
+	if sp.preferred == "" || source == sp.preferred {
+		return true
+	}
+
+	last, found := sp.lastSeen[device+"|"+sp.preferred]
+	return !found || now.Sub(last) > sp.failover
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSourcePolicy(t *testing.T) {
+	now := time.Now()
+
+	sp := NewSourcePolicy("", time.Minute)
+	assert.True(t, sp.Allow("", SourceHttp, now))
+	assert.True(t, sp.Allow("", SourceMqtt, now), "without preference all transports are processed")
+
+	sp = NewSourcePolicy(SourceMqtt, time.Minute)
+	assert.True(t, sp.Allow("", SourceHttp, now), "preferred transport was not seen yet")
+	assert.True(t, sp.Allow("", SourceMqtt, now.Add(time.Second)))
+	assert.False(t, sp.Allow("", SourceHttp, now.Add(2*time.Second)))
+	assert.True(t, sp.Allow("tap2", SourceHttp, now.Add(2*time.Second)), "devices are independent")
+
+	// MQTT broker is down
+	assert.True(t, sp.Allow("", SourceHttp, now.Add(2*time.Minute)))
+	assert.True(t, sp.Allow("", SourceMqtt, now.Add(3*time.Minute)))
+	assert.False(t, sp.Allow("", SourceHttp, now.Add(3*time.Minute+time.Second)))
+}
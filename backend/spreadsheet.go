@@ -0,0 +1,355 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// export formats of the measurement history
+const (
+	SpreadsheetCsv  = "csv"
+	SpreadsheetXlsx = "xlsx"
+)
+
+// maxSpreadsheetRange limits a single export, the history is read day by day
+// so the limit is about the size of the download rather than memory
+const maxSpreadsheetRange = 366 * 24 * time.Hour
+
+// SpreadsheetContentType returns the MIME type of the format
+func SpreadsheetContentType(format string) string {
+	if format == SpreadsheetXlsx {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// SpreadsheetFilename returns the name of the downloaded file
+func SpreadsheetFilename(from, to time.Time, format string) string {
+	const layout = "20060102-150405"
+	return fmt.Sprintf("measurements-%s-%s.%s", from.In(getTz()).Format(layout), to.In(getTz()).Format(layout), format)
+}
+
+// WriteSpreadsheet writes measurements in [from, to) and optionally pours into w
+// CSV is a single table with the type of the row in the first column,
+// XLSX has measurements and pours on separate sheets
+// The history is read from the store a day at a time, so long ranges are streamed
+func WriteSpreadsheet(w io.Writer, store Storage, from, to time.Time, format string, pours bool) error {
+	switch format {
+	case SpreadsheetCsv:
+		return writeCsv(w, store, from, to, pours)
+	case SpreadsheetXlsx:
+		return writeXlsx(w, store, from, to, pours)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+var (
+	measurementColumns = []string{"at", "weight", "raw", "source"}
+	pourColumns        = []string{"started_at", "at", "grams", "glasses", "duration", "keg_id", "person"}
+)
+
+func measurementRow(m Measurement) []any {
+	return []any{m.At, m.Weight, m.Raw, m.Source}
+}
+
+func pourRow(p Pour) []any {
+	return []any{p.StartedAt, p.At, p.Grams, p.Glasses, p.Duration, p.KegId, p.Person}
+}
+
+// forEachDay calls fn with consecutive chunks of [from, to) at most a day long
+func forEachDay(from, to time.Time, fn func(from, to time.Time) error) error {
+	for start := from; start.Before(to); start = start.Add(24 * time.Hour) {
+		end := start.Add(24 * time.Hour)
+		if end.After(to) {
+			end = to
+		}
+		if err := fn(start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCsv(w io.Writer, store Storage, from, to time.Time, pours bool) error {
+	out := csv.NewWriter(w)
+	header := []string{"type", "at", "weight", "raw", "source", "started_at", "grams", "glasses", "duration", "keg_id", "person"}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	err := forEachDay(from, to, func(from, to time.Time) error {
+		measurements, err := store.GetMeasurements(from, to)
+		if err != nil {
+			return fmt.Errorf("could not get measurements: %w", err)
+		}
+		var records []Pour
+		if pours {
+			records, err = store.GetPours(from, to)
+			if err != nil {
+				return fmt.Errorf("could not get pours: %w", err)
+			}
+		}
+
+		// both are ordered by time, merge them
+		i, j := 0, 0
+		for i < len(measurements) || j < len(records) {
+			var row []any
+			if j >= len(records) || (i < len(measurements) && !records[j].At.Before(measurements[i].At)) {
+				m := measurements[i]
+				row = []any{"measurement", m.At, m.Weight, m.Raw, m.Source, "", "", "", "", "", ""}
+				i++
+			} else {
+				p := records[j]
+				row = []any{"pour", p.At, "", "", "", p.StartedAt, p.Grams, p.Glasses, p.Duration, p.KegId, p.Person}
+				j++
+			}
+			if err := out.Write(csvCells(row)); err != nil {
+				return err
+			}
+		}
+
+		out.Flush()
+		return out.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func csvCells(row []any) []string {
+	cells := make([]string, len(row))
+	for i, cell := range row {
+		switch v := cell.(type) {
+		case time.Time:
+			cells[i] = formatDate(v)
+		case float64:
+			cells[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case string:
+			cells[i] = v
+		default:
+			cells[i] = fmt.Sprint(v)
+		}
+	}
+	return cells
+}
+
+// Minimal XLSX (Office Open XML) writer
+// Worksheets use inline strings, so no shared string table or styles are needed
+// and rows can be streamed straight into the zip archive.
+// Specification: ECMA-376 Part 1, SpreadsheetML
+
+func writeXlsx(w io.Writer, store Storage, from, to time.Time, pours bool) error {
+	sheets := []string{"Measurements"}
+	if pours {
+		sheets = append(sheets, "Pours")
+	}
+
+	book, err := NewXlsxWriter(w, sheets)
+	if err != nil {
+		return err
+	}
+
+	if err := book.NextSheet(measurementColumns); err != nil {
+		return err
+	}
+	err = forEachDay(from, to, func(from, to time.Time) error {
+		measurements, err := store.GetMeasurements(from, to)
+		if err != nil {
+			return fmt.Errorf("could not get measurements: %w", err)
+		}
+		for _, m := range measurements {
+			if err := book.Row(measurementRow(m)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if pours {
+		if err := book.NextSheet(pourColumns); err != nil {
+			return err
+		}
+		err = forEachDay(from, to, func(from, to time.Time) error {
+			records, err := store.GetPours(from, to)
+			if err != nil {
+				return fmt.Errorf("could not get pours: %w", err)
+			}
+			for _, p := range records {
+				if err := book.Row(pourRow(p)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return book.Close()
+}
+
+// XlsxWriter streams a workbook, sheets are written one after another in the order given to NewXlsxWriter
+type XlsxWriter struct {
+	zip    *zip.Writer
+	sheets []string
+	sheet  io.Writer // current sheet, nil before the first NextSheet
+	index  int
+	row    int
+}
+
+const xlsxMain = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+const xlsxRelationships = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+// NewXlsxWriter writes the workbook structure, the content of the sheets follows
+func NewXlsxWriter(w io.Writer, sheets []string) (*XlsxWriter, error) {
+	x := &XlsxWriter{zip: zip.NewWriter(w), sheets: sheets}
+
+	types := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`
+	for i := range sheets {
+		types += fmt.Sprintf(`<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	types += `</Types>`
+
+	rels := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="` + xlsxRelationships + `/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	workbook := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<workbook xmlns="` + xlsxMain + `" xmlns:r="` + xlsxRelationships + `"><sheets>`
+	bookRels := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` +
+		`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`
+	for i, name := range sheets {
+		workbook += fmt.Sprintf(`<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+		bookRels += fmt.Sprintf(`<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, xlsxRelationships, i+1)
+	}
+	workbook += `</sheets></workbook>`
+	bookRels += `</Relationships>`
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", types},
+		{"_rels/.rels", rels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", bookRels},
+	}
+	for _, part := range parts {
+		f, err := x.zip.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	return x, nil
+}
+
+// NextSheet finishes the current sheet and starts the next one with the header row
+func (x *XlsxWriter) NextSheet(columns []string) error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	if x.index >= len(x.sheets) {
+		return fmt.Errorf("workbook has only %d sheets", len(x.sheets))
+	}
+	x.index++
+
+	f, err := x.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", x.index))
+	if err != nil {
+		return err
+	}
+	x.sheet = f
+	x.row = 0
+
+	if _, err := io.WriteString(f, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><worksheet xmlns="`+xlsxMain+`"><sheetData>`); err != nil {
+		return err
+	}
+
+	header := make([]any, len(columns))
+	for i, c := range columns {
+		header[i] = c
+	}
+	return x.Row(header)
+}
+
+// Row appends a row to the current sheet
+// numbers are written as numeric cells, times in the local format of formatDate and the rest as strings
+func (x *XlsxWriter) Row(cells []any) error {
+	if x.sheet == nil {
+		return fmt.Errorf("no sheet started")
+	}
+	x.row++
+
+	row := fmt.Sprintf(`<row r="%d">`, x.row)
+	for i, cell := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(x.row)
+		switch v := cell.(type) {
+		case float64:
+			row += fmt.Sprintf(`<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+		case int:
+			row += fmt.Sprintf(`<c r="%s"><v>%d</v></c>`, ref, v)
+		case time.Time:
+			row += fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, formatDate(v))
+		default:
+			s := fmt.Sprint(v)
+			if s == "" {
+				continue
+			}
+			row += fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(s))
+		}
+	}
+	row += `</row>`
+
+	_, err := io.WriteString(x.sheet, row)
+	return err
+}
+
+// Close finishes the last sheet and the archive
+func (x *XlsxWriter) Close() error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+func (x *XlsxWriter) endSheet() error {
+	if x.sheet == nil {
+		return nil
+	}
+	_, err := io.WriteString(x.sheet, `</sheetData></worksheet>`)
+	x.sheet = nil
+	return err
+}
+
+// xlsxColumn returns the letter reference of the zero based column (A, B, ..., Z, AA, ...)
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
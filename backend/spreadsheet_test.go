@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func spreadsheetStore(t *testing.T, from time.Time) *FakeStore {
+	store := &FakeStore{}
+	assert.Nil(t, store.AddMeasurement(Measurement{Weight: 30000, At: from.Add(time.Hour), Source: SourceHttp}))
+	assert.Nil(t, store.AddMeasurement(Measurement{Weight: 29500, At: from.Add(26 * time.Hour), Source: SourceManual}))
+	assert.Nil(t, store.AddPour(Pour{StartedAt: from.Add(2 * time.Hour), At: from.Add(2*time.Hour + 5*time.Second), Grams: 480, Glasses: 0.96, Duration: 5, KegId: "k1", Person: "<Honza & co>"}))
+	return store
+}
+
+func TestWriteSpreadsheet_Csv(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	store := spreadsheetStore(t, from)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSpreadsheet(&buf, store, from, from.Add(48*time.Hour), SpreadsheetCsv, true))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, rows, 4)
+	assert.Equal(t, "type", rows[0][0])
+	assert.Equal(t, []string{"measurement", "pour", "measurement"}, []string{rows[1][0], rows[2][0], rows[3][0]}, "merged by time across days")
+	assert.Equal(t, "30000", rows[1][2])
+	assert.Equal(t, formatDate(from.Add(time.Hour)), rows[1][1])
+	assert.Equal(t, "480", rows[2][6])
+	assert.Equal(t, "<Honza & co>", rows[2][10])
+
+	buf.Reset()
+	assert.Nil(t, WriteSpreadsheet(&buf, store, from, from.Add(48*time.Hour), SpreadsheetCsv, false))
+	rows, err = csv.NewReader(&buf).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, rows, 3, "pours only on request")
+}
+
+func TestWriteSpreadsheet_Xlsx(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	store := spreadsheetStore(t, from)
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSpreadsheet(&buf, store, from, from.Add(48*time.Hour), SpreadsheetXlsx, true))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		assert.Nil(t, err)
+		data, err := io.ReadAll(r)
+		assert.Nil(t, err)
+		files[f.Name] = data
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		assert.Contains(t, files, name)
+	}
+
+	type sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+
+	var measurements sheet
+	assert.Nil(t, xml.Unmarshal(files["xl/worksheets/sheet1.xml"], &measurements))
+	assert.Len(t, measurements.Rows, 3)
+	assert.Equal(t, "at", measurements.Rows[0].Cells[0].Inline)
+	assert.Equal(t, "B2", measurements.Rows[1].Cells[1].Ref)
+	assert.Equal(t, "30000", measurements.Rows[1].Cells[1].Value)
+
+	var pours sheet
+	assert.Nil(t, xml.Unmarshal(files["xl/worksheets/sheet2.xml"], &pours))
+	assert.Len(t, pours.Rows, 2)
+	assert.Equal(t, "<Honza & co>", pours.Rows[1].Cells[6].Inline)
+}
+
+func TestXlsxColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "AZ", xlsxColumn(51))
+	assert.Equal(t, "BA", xlsxColumn(52))
+}
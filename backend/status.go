@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ScaleStatus is the public contract of the scale status endpoint
+// it's decoupled from the internal Scale struct, so the JSON shape changes only intentionally
+// field names are snake_case, internals with no value are omitted
+type ScaleStatus struct {
+	Weight        float64      `json:"weight"`
+	WeightAt      time.Time    `json:"last_weight_at"`
+	ActiveKeg     int          `json:"active_keg"`
+	KegInfo       *KegInfo     `json:"keg_info,omitempty"` // nil if no keg is tapped
+	BeersLeft     int          `json:"beers_left"`
+	IsLow         bool         `json:"is_low"`
+	Warehouse     [5]int       `json:"warehouse"`
+	Pub           Pub          `json:"pub"`
+	LastOk        time.Time    `json:"last_ok"`
+	Rssi          float64      `json:"rssi"`
+	Shadow        DeviceShadow `json:"shadow"`
+	CleaningUntil *time.Time   `json:"cleaning_until,omitempty"` // nil if the line is not being cleaned
+	PendingKeg    *PendingKeg  `json:"pending_keg,omitempty"`
+	PubOverride   *PubOverride `json:"pub_override,omitempty"` // nil if the pub is not forced open or closed
+	Degraded      bool         `json:"degraded"`
+	EmptyScale    bool         `json:"empty_scale"` // nothing is on the scale while the pub is open
+	TareShift     bool         `json:"tare_shift"`  // the scale measures negative weights and needs recalibration
+	Activity      Activity     `json:"activity"`
+}
+
+// Status returns the current state of the scale
+func (s *Scale) Status() ScaleStatus {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	status := ScaleStatus{
+		Weight:      s.Weight,
+		WeightAt:    s.WeightAt,
+		ActiveKeg:   s.ActiveKeg,
+		BeersLeft:   s.BeersLeft,
+		IsLow:       s.IsLow,
+		Warehouse:   s.Warehouse,
+		Pub:         s.Pub,
+		LastOk:      s.LastOk,
+		Rssi:        s.Rssi,
+		Shadow:      s.Shadow,
+		PendingKeg:  s.PendingKeg,
+		PubOverride: s.PubOverride,
+		Degraded:    s.Degraded,
+		EmptyScale:  s.EmptyScale,
+		TareShift:   s.TareShift != nil,
+		Activity:    s.activity(time.Now()),
+	}
+
+	if s.KegInfo.Id != "" {
+		info := s.KegInfo
+		status.KegInfo = &info
+	}
+
+	if s.isCleaning() {
+		until := s.CleaningUntil
+		status.CleaningUntil = &until
+	}
+
+	return status
+}
+
+// errNoHistory is returned when no measurement is stored before the requested time
+var errNoHistory = errors.New("no measurement before the time")
+
+// statusLookback are windows searched for the last measurement before the requested time
+// the short ones come first, so a busy evening does not load a week of measurements
+var statusLookback = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour}
+
+// HistoricStatus is the state of the scale reconstructed from stored data
+// only the state kept in the history is included, the rest of ScaleStatus is not stored over time
+type HistoricStatus struct {
+	At        time.Time `json:"at"`
+	Weight    float64   `json:"weight"`
+	WeightAt  time.Time `json:"last_weight_at"`
+	ActiveKeg int       `json:"active_keg"`
+	KegInfo   *KegInfo  `json:"keg_info,omitempty"` // nil if no keg was tapped
+	BeersLeft int       `json:"beers_left"`
+	IsLow     bool      `json:"is_low"`
+	Pub       Pub       `json:"pub"`
+}
+
+// StatusAt reconstructs the state of the scale at the past moment
+// from the last measurement before it, the keg on tap and stored pub sessions
+func (s *Scale) StatusAt(at time.Time) (HistoricStatus, error) {
+	status := HistoricStatus{At: at}
+
+	var last *Measurement
+	for _, lookback := range statusLookback {
+		measurements, err := s.store.GetMeasurements(at.Add(-lookback), at.Add(time.Nanosecond))
+		if err != nil {
+			return status, fmt.Errorf("could not load measurements: %w", err)
+		}
+		if len(measurements) > 0 {
+			last = &measurements[len(measurements)-1]
+			break
+		}
+	}
+	if last == nil {
+		return status, errNoHistory
+	}
+	status.Weight = last.Weight
+	status.WeightAt = last.At
+
+	kegs, err := s.store.GetKegs()
+	if err != nil {
+		return status, fmt.Errorf("could not load kegs: %w", err)
+	}
+	for i := len(kegs) - 1; i >= 0; i-- {
+		keg := kegs[i]
+		if keg.TappedAt.After(at) {
+			continue
+		}
+		untapped := keg.Untapped != nil && !keg.Untapped.At.After(at)
+		if (keg.FinishedAt.IsZero() && !untapped) || keg.FinishedAt.After(at) {
+			status.KegInfo = &keg
+		}
+		break
+	}
+
+	status.IsLow = true // no keg is tapped, the same as IsKegLow
+	if status.KegInfo != nil {
+		status.ActiveKeg = status.KegInfo.Size
+		tare, found := GetEmptyWeights()[status.ActiveKeg]
+		if status.KegInfo.EmptyWeight > 0 {
+			tare, found = status.KegInfo.EmptyWeight, true
+		}
+		if found {
+			status.BeersLeft = CalcBeersLeftFromTare(tare, status.Weight, s.config.GlassFor(status.KegInfo.Beer))
+			status.IsLow = IsKegLowFromTare(tare, status.Weight)
+		}
+	}
+
+	sessions, err := s.store.GetPubSessions(at.Add(-statusLookback[len(statusLookback)-1]), at.Add(time.Nanosecond))
+	if err != nil {
+		return status, fmt.Errorf("could not load pub sessions: %w", err)
+	}
+	for _, session := range sessions {
+		if session.ClosedAt.After(at) {
+			status.Pub = Pub{IsOpen: true, OpenedAt: session.OpenedAt}
+		} else {
+			status.Pub = Pub{OpenedAt: session.OpenedAt, ClosedAt: session.ClosedAt}
+		}
+	}
+
+	// the current session is stored only when the pub closes
+	s.mux.Lock()
+	if s.Pub.IsOpen && !s.Pub.OpenedAt.After(at) {
+		status.Pub = Pub{IsOpen: true, OpenedAt: s.Pub.OpenedAt}
+	}
+	s.mux.Unlock()
+
+	return status, nil
+}
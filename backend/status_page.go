@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+)
+
+// statusPageRefresh is the reload interval of the status page in seconds
+const statusPageRefresh = 10
+
+var statusPageTemplate = template.Must(template.ParseFS(templateFiles, "templates/status.html"))
+
+// statusPage is the data of the status page, the dashboard rendered on the server
+type statusPage struct {
+	Dashboard
+	Device  string
+	Lang    string
+	Refresh int
+}
+
+// statusPageHandler renders a read-only status page of the scale for screens without the frontend (Raspberry Pi at the bar)
+// the page reloads itself, the token parameter is kept in the url, so it works with READ_AUTH as well
+func (hr *HandlerRepository) statusPageHandler() func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if hr.config.ReadAuth && !hr.config.Allows(r.URL.Query().Get("token"), ScopeReadOnly) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		device := r.URL.Query().Get("device")
+		scale, found := hr.scaleOf(device)
+		if !found {
+			http.Error(w, "Unknown device", http.StatusNotFound)
+			return
+		}
+
+		dashboard, err := hr.dashboard(scale, r, dashboardIncludes{})
+		if err != nil {
+			hr.log(r).Errorf("Could not build dashboard: %v", err)
+			http.Error(w, "Could not build dashboard", http.StatusInternalServerError)
+			return
+		}
+
+		page := statusPage{
+			Dashboard: dashboard,
+			Device:    device,
+			Lang:      resolveLocale(r.Header.Get("Accept-Language"), hr.config.Locale),
+			Refresh:   statusPageRefresh,
+		}
+		var buf bytes.Buffer
+		if err := statusPageTemplate.Execute(&buf, page); err != nil {
+			hr.log(r).Errorf("Could not render status page: %v", err)
+			http.Error(w, "Could not render status page", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(buf.Bytes())
+	}
+}
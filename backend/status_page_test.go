@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerRepository_StatusPage(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	s.config.FrontendPath = t.TempDir() + "/"
+	hr := &HandlerRepository{scale: s, config: s.config, monitor: s.monitor, logger: s.logger}
+	get := func(router http.Handler, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	// the frontend is not deployed
+	router := NewRouter(hr)
+	w := get(router, "/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `<meta http-equiv="refresh" content="10">`)
+	assert.Contains(t, w.Body.String(), "<tr><th>Weight</th><td>"+formatWeight(s.Weight, s.config.Locale)+" kg</td></tr>")
+	assert.Contains(t, w.Body.String(), "dBm")
+	assert.Equal(t, http.StatusNotFound, get(router, "/status?device=unknown").Code)
+
+	s.config.ReadAuth = true
+	assert.Equal(t, http.StatusUnauthorized, get(router, "/status").Code)
+	assert.Equal(t, http.StatusOK, get(router, "/status?token=test").Code)
+
+	// the deployed frontend keeps the root, the status page stays available
+	assert.Nil(t, os.WriteFile(filepath.Join(s.config.FrontendPath, "index.html"), []byte("<div id=root></div>"), 0o644))
+	router = NewRouter(hr)
+	assert.Equal(t, "<div id=root></div>", get(router, "/").Body.String())
+	assert.Contains(t, get(router, "/status?token=test").Body.String(), "Beers left")
+}
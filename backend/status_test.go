@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jsonKeys returns sorted keys of the JSON object
+func jsonKeys(t *testing.T, data []byte) []string {
+	var object map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal(data, &object))
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestScaleStatus_Contract fails when the public JSON shape changes
+// update the expected keys only when the change is intentional
+func TestScaleStatus_Contract(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+
+	data, err := s.JsonState()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"active_keg", "activity", "beers_left", "degraded", "empty_scale", "is_low", "last_ok", "last_weight_at",
+		"pub", "rssi", "shadow", "tare_shift", "warehouse", "weight",
+	}, jsonKeys(t, data), "empty internals are omitted")
+
+	assert.Nil(t, s.SetActiveKeg(10, "Pilsner"))
+	assert.Nil(t, s.SetCleaning(time.Hour))
+
+	data, err = s.JsonState()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"active_keg", "activity", "beers_left", "cleaning_until", "degraded", "empty_scale", "is_low", "keg_info",
+		"last_ok", "last_weight_at", "pub", "rssi", "shadow", "tare_shift", "warehouse", "weight",
+	}, jsonKeys(t, data))
+
+	var status map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal(data, &status))
+	assert.Equal(t, []string{"closed_at", "is_open", "open_at"}, jsonKeys(t, status["pub"]))
+	assert.Equal(t, []string{"desired", "desired_at", "pending_reports", "reported", "reported_at"}, jsonKeys(t, status["shadow"]))
+	assert.Equal(t, []string{
+		"beer", "beers", "end_weight", "finished_at", "id", "line_grams", "low_at", "poured_grams", "pours", "size", "start_weight",
+		"tapped_at",
+	}, jsonKeys(t, status["keg_info"]))
+}
+
+func TestScale_StatusAt(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	closing := time.Date(2024, 5, 4, 23, 0, 0, 0, time.UTC)
+
+	_, err := s.StatusAt(closing)
+	assert.ErrorIs(t, err, errNoHistory)
+
+	previous := NewKegInfo(50, "Pilsner", closing.Add(-10*24*time.Hour), 62000)
+	previous.FinishedAt = closing.Add(-2 * time.Hour)
+	assert.Nil(t, s.store.SaveKeg(previous))
+	assert.Nil(t, s.store.SaveKeg(NewKegInfo(15, "Weizen", previous.FinishedAt, 22000)))
+	assert.Nil(t, s.store.AddPubSession(PubSession{OpenedAt: closing.Add(-5 * time.Hour), ClosedAt: closing}))
+	assert.Nil(t, s.store.AddMeasurement(Measurement{Weight: 11500, At: closing.Add(-3 * time.Hour)}))
+	assert.Nil(t, s.store.AddMeasurement(Measurement{Weight: 17000, At: closing.Add(-10 * time.Minute)}))
+	assert.Nil(t, s.store.AddMeasurement(Measurement{Weight: 16000, At: closing.Add(time.Hour)}))
+
+	status, err := s.StatusAt(closing.Add(-time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 17000.0, status.Weight)
+	assert.Equal(t, 15, status.ActiveKeg)
+	assert.Equal(t, "Weizen", status.KegInfo.Beer)
+	assert.Equal(t, CalcBeersLeft(15, 17000, 500), status.BeersLeft)
+	assert.True(t, status.Pub.IsOpen)
+
+	status, err = s.StatusAt(closing.Add(-150 * time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 11500.0, status.Weight, "the last measurement is more than an hour old")
+	assert.Equal(t, 50, status.ActiveKeg)
+	assert.True(t, status.IsLow)
+
+	status, err = s.StatusAt(closing.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.False(t, status.Pub.IsOpen)
+	assert.Equal(t, closing, status.Pub.ClosedAt)
+}
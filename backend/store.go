@@ -1,8 +1,52 @@
 package main
 
-import "time"
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound is returned by getters of values which were never stored
+var ErrNotFound = errors.New("not found")
+
+// isNotFound returns true if the value was never stored, Redis reports it by redis.Nil
+// other errors (unreachable storage, corrupted value) mean the value exists but could not be read
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, redis.Nil)
+}
+
+// Measurement is a single accepted weight value
+type Measurement struct {
+	Weight float64   `json:"weight"`
+	At     time.Time `json:"at"`
+	Source string    `json:"source,omitempty"` // ingestion path which produced the value, empty for old measurements
+	Raw    float64   `json:"raw,omitempty"`    // weight before filtering, zero when the weight filter is disabled
+	Sensors
+}
+
+// Sensors are optional readings of the scale besides the weight
+// nil if not reported, older hardware has no sensors
+type Sensors struct {
+	Temperature *float64 `json:"temperature,omitempty"` // °C
+	Battery     *float64 `json:"battery,omitempty"`     // volts
+}
+
+// sources of measurements
+const (
+	SourceHttp      = "http"
+	SourceMqtt      = "mqtt"
+	SourceGrpc      = "grpc" // gateway aggregating more scales
+	SourceManual    = "manual"
+	SourceBackfill  = "backfill"
+	SourceBatch     = "batch"     // buffered by the device while it was offline
+	SourceSimulator = "simulator" // simulated scale of development, see [Simulator]
+)
 
 type Storage interface {
+	Ping() error // check the storage is reachable
+
 	SetWeight(weight float64) error // set weight
 	GetWeight() (float64, error)    // get weight
 
@@ -12,6 +56,24 @@ type Storage interface {
 	SetActiveKeg(weight int) error // set active keg
 	GetActiveKeg() (int, error)    // get active keg
 
+	SetKegInfo(info KegInfo) error // set info about the active keg
+	GetKegInfo() (KegInfo, error)  // get info about the active keg
+
+	SaveKeg(info KegInfo) error        // store keg into the history of kegs
+	GetKeg(id string) (KegInfo, error) // get keg from the history
+	GetKegs() ([]KegInfo, error)       // get all kegs from the history ordered by tapping time
+
+	SavePerson(p Person) error    // add or replace person holding a tap token
+	GetPeople() ([]Person, error) // get all people ordered by name
+	DeletePerson(id string) error // remove person, their pours stay unlinked
+
+	AddSettlement(s Settlement) error                        // record the paid tab
+	GetSettlements(from, to time.Time) ([]Settlement, error) // get settlements in [from, to) ordered by time
+
+	SaveKegModel(model KegModel) error // add or replace keg model in the lookup table
+	GetKegModels() ([]KegModel, error) // get all keg models ordered by id
+	DeleteKegModel(id string) error    // remove keg model from the lookup table
+
 	SetBeersLeft(beersLeft int) error // set beers left
 	GetBeersLeft() (int, error)       // get beers left
 
@@ -20,4 +82,57 @@ type Storage interface {
 
 	SetWarehouse(warehouse [5]int) error // set warehouse
 	GetWarehouse() ([5]int, error)       // get warehouse
+
+	SetCleaningUntil(until time.Time) error // set end of line cleaning
+	GetCleaningUntil() (time.Time, error)   // get end of line cleaning
+
+	SetShadow(shadow DeviceShadow) error // set device shadow
+	GetShadow() (DeviceShadow, error)    // get device shadow
+
+	SetSnapshot(snapshot ScaleSnapshot) error // set runtime state of the scale
+	GetSnapshot() (ScaleSnapshot, error)      // get runtime state of the scale
+
+	SetTapBeer(beer TapBeer) error // set beer announced on the tap, empty name removes it
+	GetTapBeer() (TapBeer, error)  // get beer announced on the tap
+
+	SetFirmware(release FirmwareRelease) error // set the latest firmware release uploaded by the admin
+	GetFirmware() (FirmwareRelease, error)     // get the latest firmware release uploaded by the admin
+
+	SetCalibration(calibration Calibration) error  // set conversion of raw counts
+	GetCalibration() (Calibration, error)          // get conversion of raw counts
+	GetCalibrationHistory() ([]Calibration, error) // get stored calibrations, newest first
+
+	AddMeasurement(m Measurement) error                        // append measurement to the history
+	GetMeasurements(from, to time.Time) ([]Measurement, error) // get measurements in [from, to) ordered by time
+	DeleteMeasurements(from, to time.Time) (int, error)        // delete measurements in [from, to), returns number of deleted
+	TrimMeasurements(keep int) (int, error)                    // delete the oldest measurements over keep, returns number of deleted
+	CountMeasurements(from, to time.Time) (int, error)         // count measurements in [from, to)
+
+	AddPour(p Pour) error                        // append finished pour to the history
+	GetPours(from, to time.Time) ([]Pour, error) // get pours finished in [from, to) ordered by time
+	DeletePour(p Pour) error                     // delete the pour returned by GetPours, e.g. detected from a bad measurement
+
+	AddWeather(w WeatherSample) error                       // append weather sample to the history
+	GetWeather(from, to time.Time) ([]WeatherSample, error) // get weather samples in [from, to) ordered by time
+
+	AddRating(r Rating) error                  // append rating of the keg
+	GetRatings(kegId string) ([]Rating, error) // get ratings of the keg ordered by time
+
+	AddPubSession(p PubSession) error                        // append finished opening of the pub to the history
+	GetPubSessions(from, to time.Time) ([]PubSession, error) // get pub sessions opened in [from, to) ordered by time
+
+	SetSessionTag(tag SessionTag) error                      // tag the session opened at the time, empty tag removes it
+	GetSessionTags(from, to time.Time) ([]SessionTag, error) // get tags of sessions opened in [from, to) ordered by time
+}
+
+// DeviceStorage is a storage able to keep state of more scales (taps)
+type DeviceStorage interface {
+	ForDevice(device string) Storage // storage of an additional scale, pub-wide data is shared
+}
+
+// sortKegs orders kegs by tapping time
+func sortKegs(kegs []KegInfo) {
+	sort.Slice(kegs, func(i, j int) bool {
+		return kegs[i].TappedAt.Before(kegs[j].TappedAt)
+	})
 }
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// errChaos is the failure injected by [ChaosStore]
+var errChaos = errors.New("injected storage failure")
+
+// ChaosStore injects failures and latency into every storage operation
+// it verifies the degraded mode, the write ahead log and the self-check actually work
+// It's wired from the environment only in binaries built with the chaos tag, tests use it directly
+type ChaosStore struct {
+	Storage
+	mux       sync.Mutex
+	errorRate float64       // share of failed operations, 1 fails all of them
+	latency   time.Duration // added to every operation
+	down      bool          // all operations fail
+	rand      *rand.Rand
+	failures  map[string]int // injected failures by operation
+}
+
+func NewChaosStore(inner Storage, errorRate float64, latency time.Duration, seed int64) *ChaosStore {
+	return &ChaosStore{
+		Storage:   inner,
+		mux:       sync.Mutex{},
+		errorRate: errorRate,
+		latency:   latency,
+		rand:      rand.New(rand.NewSource(seed)),
+		failures:  map[string]int{},
+	}
+}
+
+// SetDown makes the storage unavailable until it's set back
+func (s *ChaosStore) SetDown(down bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.down = down
+}
+
+// Failures returns the number of failures injected into the operation
+func (s *ChaosStore) Failures(op string) int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.failures[op]
+}
+
+// inject waits for the latency and decides whether the operation fails
+func (s *ChaosStore) inject(op string) error {
+	s.mux.Lock()
+	latency := s.latency
+	fail := s.down || (s.errorRate > 0 && s.rand.Float64() < s.errorRate)
+	if fail {
+		s.failures[op]++
+	}
+	s.mux.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if fail {
+		return fmt.Errorf("%s: %w", op, errChaos)
+	}
+
+	return nil
+}
+
+// fault runs the operation unless a failure is injected
+func (s *ChaosStore) fault(op string, call func() error) error {
+	if err := s.inject(op); err != nil {
+		return err
+	}
+
+	return call()
+}
+
+// chaosCall runs the operation returning a value unless a failure is injected
+func chaosCall[T any](s *ChaosStore, op string, call func() (T, error)) (T, error) {
+	if err := s.inject(op); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return call()
+}
+
+func (s *ChaosStore) Ping() error {
+	return s.fault("Ping", func() error { return s.Storage.Ping() })
+}
+
+func (s *ChaosStore) SetWeight(weight float64) error {
+	return s.fault("SetWeight", func() error { return s.Storage.SetWeight(weight) })
+}
+
+func (s *ChaosStore) GetWeight() (float64, error) {
+	return chaosCall(s, "GetWeight", func() (float64, error) { return s.Storage.GetWeight() })
+}
+
+func (s *ChaosStore) SetWeightAt(weightAt time.Time) error {
+	return s.fault("SetWeightAt", func() error { return s.Storage.SetWeightAt(weightAt) })
+}
+
+func (s *ChaosStore) GetWeightAt() (time.Time, error) {
+	return chaosCall(s, "GetWeightAt", func() (time.Time, error) { return s.Storage.GetWeightAt() })
+}
+
+func (s *ChaosStore) SetActiveKeg(weight int) error {
+	return s.fault("SetActiveKeg", func() error { return s.Storage.SetActiveKeg(weight) })
+}
+
+func (s *ChaosStore) GetActiveKeg() (int, error) {
+	return chaosCall(s, "GetActiveKeg", func() (int, error) { return s.Storage.GetActiveKeg() })
+}
+
+func (s *ChaosStore) SetKegInfo(info KegInfo) error {
+	return s.fault("SetKegInfo", func() error { return s.Storage.SetKegInfo(info) })
+}
+
+func (s *ChaosStore) GetKegInfo() (KegInfo, error) {
+	return chaosCall(s, "GetKegInfo", func() (KegInfo, error) { return s.Storage.GetKegInfo() })
+}
+
+func (s *ChaosStore) SaveKeg(info KegInfo) error {
+	return s.fault("SaveKeg", func() error { return s.Storage.SaveKeg(info) })
+}
+
+func (s *ChaosStore) GetKeg(id string) (KegInfo, error) {
+	return chaosCall(s, "GetKeg", func() (KegInfo, error) { return s.Storage.GetKeg(id) })
+}
+
+func (s *ChaosStore) GetKegs() ([]KegInfo, error) {
+	return chaosCall(s, "GetKegs", func() ([]KegInfo, error) { return s.Storage.GetKegs() })
+}
+
+func (s *ChaosStore) SavePerson(p Person) error {
+	return s.fault("SavePerson", func() error { return s.Storage.SavePerson(p) })
+}
+
+func (s *ChaosStore) GetPeople() ([]Person, error) {
+	return chaosCall(s, "GetPeople", func() ([]Person, error) { return s.Storage.GetPeople() })
+}
+
+func (s *ChaosStore) DeletePerson(id string) error {
+	return s.fault("DeletePerson", func() error { return s.Storage.DeletePerson(id) })
+}
+
+func (s *ChaosStore) AddSettlement(settlement Settlement) error {
+	return s.fault("AddSettlement", func() error { return s.Storage.AddSettlement(settlement) })
+}
+
+func (s *ChaosStore) GetSettlements(from, to time.Time) ([]Settlement, error) {
+	return chaosCall(s, "GetSettlements", func() ([]Settlement, error) { return s.Storage.GetSettlements(from, to) })
+}
+
+func (s *ChaosStore) SaveKegModel(model KegModel) error {
+	return s.fault("SaveKegModel", func() error { return s.Storage.SaveKegModel(model) })
+}
+
+func (s *ChaosStore) GetKegModels() ([]KegModel, error) {
+	return chaosCall(s, "GetKegModels", func() ([]KegModel, error) { return s.Storage.GetKegModels() })
+}
+
+func (s *ChaosStore) DeleteKegModel(id string) error {
+	return s.fault("DeleteKegModel", func() error { return s.Storage.DeleteKegModel(id) })
+}
+
+func (s *ChaosStore) SetBeersLeft(beersLeft int) error {
+	return s.fault("SetBeersLeft", func() error { return s.Storage.SetBeersLeft(beersLeft) })
+}
+
+func (s *ChaosStore) GetBeersLeft() (int, error) {
+	return chaosCall(s, "GetBeersLeft", func() (int, error) { return s.Storage.GetBeersLeft() })
+}
+
+func (s *ChaosStore) SetIsLow(isLow bool) error {
+	return s.fault("SetIsLow", func() error { return s.Storage.SetIsLow(isLow) })
+}
+
+func (s *ChaosStore) GetIsLow() (bool, error) {
+	return chaosCall(s, "GetIsLow", func() (bool, error) { return s.Storage.GetIsLow() })
+}
+
+func (s *ChaosStore) SetWarehouse(warehouse [5]int) error {
+	return s.fault("SetWarehouse", func() error { return s.Storage.SetWarehouse(warehouse) })
+}
+
+func (s *ChaosStore) GetWarehouse() ([5]int, error) {
+	return chaosCall(s, "GetWarehouse", func() ([5]int, error) { return s.Storage.GetWarehouse() })
+}
+
+func (s *ChaosStore) SetCleaningUntil(until time.Time) error {
+	return s.fault("SetCleaningUntil", func() error { return s.Storage.SetCleaningUntil(until) })
+}
+
+func (s *ChaosStore) GetCleaningUntil() (time.Time, error) {
+	return chaosCall(s, "GetCleaningUntil", func() (time.Time, error) { return s.Storage.GetCleaningUntil() })
+}
+
+func (s *ChaosStore) SetShadow(shadow DeviceShadow) error {
+	return s.fault("SetShadow", func() error { return s.Storage.SetShadow(shadow) })
+}
+
+func (s *ChaosStore) GetShadow() (DeviceShadow, error) {
+	return chaosCall(s, "GetShadow", func() (DeviceShadow, error) { return s.Storage.GetShadow() })
+}
+
+func (s *ChaosStore) SetTapBeer(beer TapBeer) error {
+	return s.fault("SetTapBeer", func() error { return s.Storage.SetTapBeer(beer) })
+}
+
+func (s *ChaosStore) GetTapBeer() (TapBeer, error) {
+	return chaosCall(s, "GetTapBeer", func() (TapBeer, error) { return s.Storage.GetTapBeer() })
+}
+
+func (s *ChaosStore) SetSnapshot(snapshot ScaleSnapshot) error {
+	return s.fault("SetSnapshot", func() error { return s.Storage.SetSnapshot(snapshot) })
+}
+
+func (s *ChaosStore) GetSnapshot() (ScaleSnapshot, error) {
+	return chaosCall(s, "GetSnapshot", func() (ScaleSnapshot, error) { return s.Storage.GetSnapshot() })
+}
+
+func (s *ChaosStore) SetFirmware(release FirmwareRelease) error {
+	return s.fault("SetFirmware", func() error { return s.Storage.SetFirmware(release) })
+}
+
+func (s *ChaosStore) GetFirmware() (FirmwareRelease, error) {
+	return chaosCall(s, "GetFirmware", func() (FirmwareRelease, error) { return s.Storage.GetFirmware() })
+}
+
+func (s *ChaosStore) SetCalibration(calibration Calibration) error {
+	return s.fault("SetCalibration", func() error { return s.Storage.SetCalibration(calibration) })
+}
+
+func (s *ChaosStore) GetCalibration() (Calibration, error) {
+	return chaosCall(s, "GetCalibration", func() (Calibration, error) { return s.Storage.GetCalibration() })
+}
+
+func (s *ChaosStore) GetCalibrationHistory() ([]Calibration, error) {
+	return chaosCall(s, "GetCalibrationHistory", func() ([]Calibration, error) { return s.Storage.GetCalibrationHistory() })
+}
+
+func (s *ChaosStore) AddMeasurement(m Measurement) error {
+	return s.fault("AddMeasurement", func() error { return s.Storage.AddMeasurement(m) })
+}
+
+func (s *ChaosStore) GetMeasurements(from, to time.Time) ([]Measurement, error) {
+	return chaosCall(s, "GetMeasurements", func() ([]Measurement, error) { return s.Storage.GetMeasurements(from, to) })
+}
+
+func (s *ChaosStore) DeleteMeasurements(from, to time.Time) (int, error) {
+	return chaosCall(s, "DeleteMeasurements", func() (int, error) { return s.Storage.DeleteMeasurements(from, to) })
+}
+
+func (s *ChaosStore) TrimMeasurements(keep int) (int, error) {
+	return chaosCall(s, "TrimMeasurements", func() (int, error) { return s.Storage.TrimMeasurements(keep) })
+}
+
+func (s *ChaosStore) CountMeasurements(from, to time.Time) (int, error) {
+	return chaosCall(s, "CountMeasurements", func() (int, error) { return s.Storage.CountMeasurements(from, to) })
+}
+
+func (s *ChaosStore) AddPour(p Pour) error {
+	return s.fault("AddPour", func() error { return s.Storage.AddPour(p) })
+}
+
+func (s *ChaosStore) DeletePour(p Pour) error {
+	return s.fault("DeletePour", func() error { return s.Storage.DeletePour(p) })
+}
+
+func (s *ChaosStore) GetPours(from, to time.Time) ([]Pour, error) {
+	return chaosCall(s, "GetPours", func() ([]Pour, error) { return s.Storage.GetPours(from, to) })
+}
+
+func (s *ChaosStore) AddWeather(w WeatherSample) error {
+	return s.fault("AddWeather", func() error { return s.Storage.AddWeather(w) })
+}
+
+func (s *ChaosStore) GetWeather(from, to time.Time) ([]WeatherSample, error) {
+	return chaosCall(s, "GetWeather", func() ([]WeatherSample, error) { return s.Storage.GetWeather(from, to) })
+}
+
+func (s *ChaosStore) AddRating(r Rating) error {
+	return s.fault("AddRating", func() error { return s.Storage.AddRating(r) })
+}
+
+func (s *ChaosStore) GetRatings(kegId string) ([]Rating, error) {
+	return chaosCall(s, "GetRatings", func() ([]Rating, error) { return s.Storage.GetRatings(kegId) })
+}
+
+func (s *ChaosStore) AddPubSession(p PubSession) error {
+	return s.fault("AddPubSession", func() error { return s.Storage.AddPubSession(p) })
+}
+
+func (s *ChaosStore) GetPubSessions(from, to time.Time) ([]PubSession, error) {
+	return chaosCall(s, "GetPubSessions", func() ([]PubSession, error) { return s.Storage.GetPubSessions(from, to) })
+}
+
+func (s *ChaosStore) SetSessionTag(tag SessionTag) error {
+	return s.fault("SetSessionTag", func() error { return s.Storage.SetSessionTag(tag) })
+}
+
+func (s *ChaosStore) GetSessionTags(from, to time.Time) ([]SessionTag, error) {
+	return chaosCall(s, "GetSessionTags", func() ([]SessionTag, error) { return s.Storage.GetSessionTags(from, to) })
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChaosStore(t *testing.T) {
+	store := NewChaosStore(&FakeStore{}, 1, 0, 1)
+	assert.ErrorIs(t, store.SetBeersLeft(10), errChaos)
+	_, err := store.GetMeasurements(time.Now().Add(-time.Hour), time.Now())
+	assert.ErrorIs(t, err, errChaos)
+	assert.Equal(t, 1, store.Failures("SetBeersLeft"))
+
+	store = NewChaosStore(&FakeStore{}, 0, 20*time.Millisecond, 1)
+	start := time.Now()
+	assert.Nil(t, store.SetBeersLeft(10))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	store.SetDown(true)
+	assert.ErrorIs(t, store.Ping(), errChaos)
+	store.SetDown(false)
+	assert.Nil(t, store.Ping())
+}
+
+func TestScale_DegradedModeRecovery(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	inner := &FakeStore{}
+	store := NewChaosStore(inner, 0, 0, 1)
+	s := NewScale(NewConfig(), NewMonitor(), store, logger)
+
+	store.SetDown(true)
+	assert.Nil(t, s.AddMeasurement(22000, SourceHttp)) // full 15l keg
+	assert.Nil(t, s.AddMeasurement(21500, SourceHttp))
+	assert.True(t, s.IsDegraded())
+	assert.Equal(t, 21500.0, s.Weight, "measurements are processed in memory")
+	assert.Equal(t, 15, s.ActiveKeg)
+
+	s.checkStore()
+	assert.True(t, s.IsDegraded(), "storage is still down")
+
+	store.SetDown(false)
+	s.checkStore()
+	assert.False(t, s.IsDegraded())
+	assert.Equal(t, 0.0, gaugeValue(t, s.monitor, "scale_degraded"))
+
+	info, err := inner.GetKegInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, s.KegInfo, info, "state is written back after recovery")
+}
+
+func TestScale_FlakyStorage(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	store := NewChaosStore(&FakeStore{}, 0.3, 0, 42)
+	s := NewScale(NewConfig(), NewMonitor(), store, logger)
+
+	for i := 0; i < 50; i++ {
+		assert.Nil(t, s.AddMeasurement(22000-float64(i*100), SourceHttp))
+	}
+	assert.Equal(t, 17100.0, s.Weight, "failed writes do not lose measurements in memory")
+	assert.True(t, s.IsDegraded())
+	assert.Greater(t, store.Failures("AddMeasurement"), 0)
+
+	store.mux.Lock()
+	store.errorRate = 0
+	store.mux.Unlock()
+	s.checkStore()
+	assert.False(t, s.IsDegraded())
+}
@@ -1,11 +1,38 @@
 package main
 
-import "time"
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
 
 // FakeStore is primarily used for testing purposes
 type FakeStore struct {
-	beersLeft int
-	isLow     bool
+	beersLeft   int
+	isLow       bool
+	shadow      *DeviceShadow
+	snapshot    *ScaleSnapshot
+	firmware    *FirmwareRelease
+	calibration *Calibration
+	tapBeer     *TapBeer
+	kegInfo     *KegInfo
+
+	cleaningUntil time.Time
+
+	kegs      map[string]KegInfo
+	kegModels map[string]KegModel
+	people    map[string]Person
+
+	settlements []Settlement
+
+	measurements []Measurement
+	weather      []WeatherSample
+	ratings      []Rating
+	sessionTags  []SessionTag
+	pours        []Pour
+	calibrations []Calibration
+	pubSessions  []PubSession
 }
 
 func (s *FakeStore) SetWeight(weight float64) error {
@@ -32,6 +59,19 @@ func (s *FakeStore) GetActiveKeg() (int, error) {
 	return 0, nil
 }
 
+func (s *FakeStore) SetKegInfo(info KegInfo) error {
+	s.kegInfo = &info
+	return nil
+}
+
+func (s *FakeStore) GetKegInfo() (KegInfo, error) {
+	if s.kegInfo == nil {
+		return KegInfo{}, fmt.Errorf("keg info %w", ErrNotFound)
+	}
+
+	return *s.kegInfo, nil
+}
+
 func (s *FakeStore) SetBeersLeft(beersLeft int) error {
 	s.beersLeft = beersLeft
 	return nil
@@ -58,3 +98,377 @@ func (s *FakeStore) GetWarehouse() ([5]int, error) {
 	var warehouse = [5]int{1, 2, 3, 4, 5}
 	return warehouse, nil
 }
+
+func (s *FakeStore) SetCleaningUntil(until time.Time) error {
+	s.cleaningUntil = until
+	return nil
+}
+
+func (s *FakeStore) GetCleaningUntil() (time.Time, error) {
+	return s.cleaningUntil, nil
+}
+
+func (s *FakeStore) SetShadow(shadow DeviceShadow) error {
+	s.shadow = &shadow
+	return nil
+}
+
+func (s *FakeStore) GetShadow() (DeviceShadow, error) {
+	if s.shadow == nil {
+		return DeviceShadow{}, fmt.Errorf("shadow %w", ErrNotFound)
+	}
+
+	return *s.shadow, nil
+}
+
+func (s *FakeStore) SetTapBeer(beer TapBeer) error {
+	s.tapBeer = &beer
+	return nil
+}
+
+func (s *FakeStore) GetTapBeer() (TapBeer, error) {
+	if s.tapBeer == nil {
+		return TapBeer{}, fmt.Errorf("tap beer %w", ErrNotFound)
+	}
+
+	return *s.tapBeer, nil
+}
+
+func (s *FakeStore) SetSnapshot(snapshot ScaleSnapshot) error {
+	s.snapshot = &snapshot
+	return nil
+}
+
+func (s *FakeStore) GetSnapshot() (ScaleSnapshot, error) {
+	if s.snapshot == nil {
+		return ScaleSnapshot{}, fmt.Errorf("snapshot %w", ErrNotFound)
+	}
+
+	return *s.snapshot, nil
+}
+
+func (s *FakeStore) SetFirmware(release FirmwareRelease) error {
+	s.firmware = &release
+	return nil
+}
+
+func (s *FakeStore) GetFirmware() (FirmwareRelease, error) {
+	if s.firmware == nil {
+		return FirmwareRelease{}, fmt.Errorf("firmware %w", ErrNotFound)
+	}
+
+	return *s.firmware, nil
+}
+
+func (s *FakeStore) SetCalibration(calibration Calibration) error {
+	s.calibration = &calibration
+	s.calibrations = append([]Calibration{calibration}, s.calibrations...)
+	if len(s.calibrations) > calibrationHistoryLength {
+		s.calibrations = s.calibrations[:calibrationHistoryLength]
+	}
+	return nil
+}
+
+func (s *FakeStore) GetCalibration() (Calibration, error) {
+	if s.calibration == nil {
+		return Calibration{}, fmt.Errorf("calibration %w", ErrNotFound)
+	}
+
+	return *s.calibration, nil
+}
+
+func (s *FakeStore) GetCalibrationHistory() ([]Calibration, error) {
+	return s.calibrations, nil
+}
+
+func (s *FakeStore) AddMeasurement(m Measurement) error {
+	// kept ordered by time, buffered measurements arrive late
+	i := sort.Search(len(s.measurements), func(i int) bool {
+		return s.measurements[i].At.After(m.At)
+	})
+	s.measurements = slices.Insert(s.measurements, i, m)
+	return nil
+}
+
+func (s *FakeStore) GetMeasurements(from, to time.Time) ([]Measurement, error) {
+	var res []Measurement
+	for _, m := range s.measurements {
+		if !m.At.Before(from) && m.At.Before(to) {
+			res = append(res, m)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *FakeStore) CountMeasurements(from, to time.Time) (int, error) {
+	res, err := s.GetMeasurements(from, to)
+	return len(res), err
+}
+
+func (s *FakeStore) DeleteMeasurements(from, to time.Time) (int, error) {
+	keep := s.measurements[:0]
+	for _, m := range s.measurements {
+		if m.At.Before(from) || !m.At.Before(to) {
+			keep = append(keep, m)
+		}
+	}
+
+	deleted := len(s.measurements) - len(keep)
+	s.measurements = keep
+	return deleted, nil
+}
+
+func (s *FakeStore) TrimMeasurements(keep int) (int, error) {
+	if len(s.measurements) <= keep {
+		return 0, nil
+	}
+
+	sort.SliceStable(s.measurements, func(i, j int) bool {
+		return s.measurements[i].At.Before(s.measurements[j].At)
+	})
+	deleted := len(s.measurements) - keep
+	s.measurements = s.measurements[deleted:]
+	return deleted, nil
+}
+
+func (s *FakeStore) SaveKeg(info KegInfo) error {
+	if s.kegs == nil {
+		s.kegs = map[string]KegInfo{}
+	}
+	s.kegs[info.Id] = info
+	return nil
+}
+
+func (s *FakeStore) GetKeg(id string) (KegInfo, error) {
+	keg, found := s.kegs[id]
+	if !found {
+		return KegInfo{}, fmt.Errorf("keg %s not found", id)
+	}
+
+	return keg, nil
+}
+
+func (s *FakeStore) GetKegs() ([]KegInfo, error) {
+	kegs := make([]KegInfo, 0, len(s.kegs))
+	for _, keg := range s.kegs {
+		kegs = append(kegs, keg)
+	}
+	sortKegs(kegs)
+
+	return kegs, nil
+}
+
+func (s *FakeStore) SavePerson(p Person) error {
+	if s.people == nil {
+		s.people = map[string]Person{}
+	}
+	s.people[p.Id] = p
+	return nil
+}
+
+func (s *FakeStore) GetPeople() ([]Person, error) {
+	people := make([]Person, 0, len(s.people))
+	for _, p := range s.people {
+		people = append(people, p)
+	}
+	sortPeople(people)
+
+	return people, nil
+}
+
+func (s *FakeStore) DeletePerson(id string) error {
+	if _, found := s.people[id]; !found {
+		return fmt.Errorf("person %s not found", id)
+	}
+	delete(s.people, id)
+	return nil
+}
+
+func (s *FakeStore) AddSettlement(settlement Settlement) error {
+	s.settlements = append(s.settlements, settlement)
+	return nil
+}
+
+func (s *FakeStore) GetSettlements(from, to time.Time) ([]Settlement, error) {
+	var res []Settlement
+	for _, settlement := range s.settlements {
+		if !settlement.At.Before(from) && settlement.At.Before(to) {
+			res = append(res, settlement)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *FakeStore) SaveKegModel(model KegModel) error {
+	if s.kegModels == nil {
+		s.kegModels = map[string]KegModel{}
+	}
+	s.kegModels[model.Id] = model
+	return nil
+}
+
+func (s *FakeStore) GetKegModels() ([]KegModel, error) {
+	models := make([]KegModel, 0, len(s.kegModels))
+	for _, model := range s.kegModels {
+		models = append(models, model)
+	}
+	sortKegModels(models)
+
+	return models, nil
+}
+
+func (s *FakeStore) DeleteKegModel(id string) error {
+	if _, found := s.kegModels[id]; !found {
+		return fmt.Errorf("keg model %s not found", id)
+	}
+	delete(s.kegModels, id)
+	return nil
+}
+
+func (s *FakeStore) AddWeather(w WeatherSample) error {
+	s.weather = append(s.weather, w)
+	return nil
+}
+
+func (s *FakeStore) GetWeather(from, to time.Time) ([]WeatherSample, error) {
+	var res []WeatherSample
+	for _, w := range s.weather {
+		if !w.At.Before(from) && w.At.Before(to) {
+			res = append(res, w)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *FakeStore) AddRating(r Rating) error {
+	s.ratings = append(s.ratings, r)
+	return nil
+}
+
+func (s *FakeStore) GetRatings(kegId string) ([]Rating, error) {
+	var res []Rating
+	for _, r := range s.ratings {
+		if r.KegId == kegId {
+			res = append(res, r)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *FakeStore) AddPour(p Pour) error {
+	s.pours = append(s.pours, p)
+	return nil
+}
+
+func (s *FakeStore) GetPours(from, to time.Time) ([]Pour, error) {
+	var res []Pour
+	for _, p := range s.pours {
+		if !p.At.Before(from) && p.At.Before(to) {
+			res = append(res, p)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *FakeStore) DeletePour(p Pour) error {
+	s.pours = slices.DeleteFunc(s.pours, func(stored Pour) bool {
+		return stored.StartedAt.Equal(p.StartedAt) && stored.At.Equal(p.At) && stored.KegId == p.KegId
+	})
+	return nil
+}
+
+func (s *FakeStore) AddPubSession(p PubSession) error {
+	s.pubSessions = append(s.pubSessions, p)
+	return nil
+}
+
+func (s *FakeStore) GetPubSessions(from, to time.Time) ([]PubSession, error) {
+	var res []PubSession
+	for _, p := range s.pubSessions {
+		if !p.OpenedAt.Before(from) && p.OpenedAt.Before(to) {
+			res = append(res, p)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *FakeStore) SetSessionTag(tag SessionTag) error {
+	keep := s.sessionTags[:0]
+	for _, t := range s.sessionTags {
+		if !t.OpenedAt.Equal(tag.OpenedAt) {
+			keep = append(keep, t)
+		}
+	}
+	if tag.Tag != "" {
+		keep = append(keep, tag)
+	}
+	sort.Slice(keep, func(i, j int) bool {
+		return keep[i].OpenedAt.Before(keep[j].OpenedAt)
+	})
+
+	s.sessionTags = keep
+	return nil
+}
+
+func (s *FakeStore) GetSessionTags(from, to time.Time) ([]SessionTag, error) {
+	var res []SessionTag
+	for _, t := range s.sessionTags {
+		if !t.OpenedAt.Before(from) && t.OpenedAt.Before(to) {
+			res = append(res, t)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *FakeStore) Ping() error {
+	return nil
+}
+
+// ForDevice returns the in-memory store of an additional scale
+// pub-wide data is shared with the default scale like in Redis
+func (s *FakeStore) ForDevice(device string) Storage {
+	return &fakeDeviceStore{FakeStore: &FakeStore{}, shared: s}
+}
+
+// fakeDeviceStore keeps state of the scale separately and delegates pub-wide data to the shared store
+type fakeDeviceStore struct {
+	*FakeStore
+	shared *FakeStore
+}
+
+func (s *fakeDeviceStore) SavePerson(p Person) error    { return s.shared.SavePerson(p) }
+func (s *fakeDeviceStore) GetPeople() ([]Person, error) { return s.shared.GetPeople() }
+func (s *fakeDeviceStore) DeletePerson(id string) error { return s.shared.DeletePerson(id) }
+
+func (s *fakeDeviceStore) AddSettlement(settlement Settlement) error {
+	return s.shared.AddSettlement(settlement)
+}
+
+func (s *fakeDeviceStore) GetSettlements(from, to time.Time) ([]Settlement, error) {
+	return s.shared.GetSettlements(from, to)
+}
+
+func (s *fakeDeviceStore) SaveKegModel(model KegModel) error { return s.shared.SaveKegModel(model) }
+func (s *fakeDeviceStore) GetKegModels() ([]KegModel, error) { return s.shared.GetKegModels() }
+func (s *fakeDeviceStore) DeleteKegModel(id string) error    { return s.shared.DeleteKegModel(id) }
+
+func (s *fakeDeviceStore) AddWeather(w WeatherSample) error { return s.shared.AddWeather(w) }
+
+func (s *fakeDeviceStore) GetWeather(from, to time.Time) ([]WeatherSample, error) {
+	return s.shared.GetWeather(from, to)
+}
+
+func (s *fakeDeviceStore) AddPour(p Pour) error { return s.shared.AddPour(p) }
+
+func (s *fakeDeviceStore) GetPours(from, to time.Time) ([]Pour, error) {
+	return s.shared.GetPours(from, to)
+}
+
+func (s *fakeDeviceStore) DeletePour(p Pour) error { return s.shared.DeletePour(p) }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"strconv"
@@ -17,10 +18,30 @@ const (
 	IsLowKey           = "is_low"
 	BeersLeftKey       = "beers_left"
 	WarehouseKey       = "warehouse"
+	ShadowKey          = "shadow"
+	TapBeerKey         = "tap_beer"
+	SnapshotKey        = "snapshot"
+	FirmwareKey        = "firmware"
+	KegInfoKey         = "keg_info"
+	CleaningUntilKey   = "cleaning_until"
+	KegsKey            = "kegs"
+	WeatherListKey     = "weather"
+	RatingsKeyPrefix   = "ratings:" // list per keg id
+	SessionTagsKey     = "session_tags"
+	PourListKey        = "pours"
+	CalibrationKey     = "calibration"
+	CalibrationListKey = "calibration_history"
+	PubSessionListKey  = "pub_sessions"
+	KegModelsKey       = "keg_models"
+	PeopleKey          = "people"
+	SettlementListKey  = "settlements"
 )
 
 type RedisStore struct {
-	Client *redis.Client
+	Client    *redis.Client
+	namespace string     // prefix of all keys, isolates instances sharing one Redis (e.g. staging:)
+	prefix    string     // prefix of the keys owned by the scale, empty for the default scale
+	cipher    BlobCipher // encrypts measurements, nil stores them as plain JSON
 }
 
 func NewRedisStore(config *Config) *RedisStore {
@@ -29,23 +50,41 @@ func NewRedisStore(config *Config) *RedisStore {
 			Addr: config.RedisAddr,
 			DB:   config.RedisDB,
 		}),
+		namespace: config.RedisPrefix,
 	}
 }
 
+// ForDevice returns the store of an additional scale sharing the connection
+// keys owned by the scale (weight, kegs, measurements...) are prefixed by the device id,
+// pub-wide data (people, tabs, pours, keg models, weather) is shared with the default scale
+func (s *RedisStore) ForDevice(device string) Storage {
+	return &RedisStore{Client: s.Client, namespace: s.namespace, prefix: "device:" + device + ":", cipher: s.cipher}
+}
+
+// key returns name of the key owned by the scale
+func (s *RedisStore) key(name string) string {
+	return s.namespace + s.prefix + name
+}
+
+// shared returns name of the key shared by all scales of the instance
+func (s *RedisStore) shared(name string) string {
+	return s.namespace + name
+}
+
 func (s *RedisStore) SetWeight(weight float64) error {
-	return s.Client.Set(context.Background(), WeightKey, weight, 0).Err()
+	return s.Client.Set(context.Background(), s.key(WeightKey), weight, 0).Err()
 }
 
 func (s *RedisStore) GetWeight() (float64, error) {
-	return s.Client.Get(context.Background(), WeightKey).Float64()
+	return s.Client.Get(context.Background(), s.key(WeightKey)).Float64()
 }
 
 func (s *RedisStore) SetWeightAt(weightAt time.Time) error {
-	return s.Client.Set(context.Background(), WeightAtKey, weightAt.Format(time.RFC3339), 0).Err()
+	return s.Client.Set(context.Background(), s.key(WeightAtKey), weightAt.Format(time.RFC3339), 0).Err()
 }
 
 func (s *RedisStore) GetWeightAt() (time.Time, error) {
-	res, err := s.Client.Get(context.Background(), WeightAtKey).Result()
+	res, err := s.Client.Get(context.Background(), s.key(WeightAtKey)).Result()
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -54,36 +93,59 @@ func (s *RedisStore) GetWeightAt() (time.Time, error) {
 }
 
 func (s *RedisStore) SetActiveKeg(keg int) error {
-	return s.Client.Set(context.Background(), ActiveKegKey, keg, 0).Err()
+	return s.Client.Set(context.Background(), s.key(ActiveKegKey), keg, 0).Err()
 }
 
 func (s *RedisStore) GetActiveKeg() (int, error) {
-	return s.Client.Get(context.Background(), ActiveKegKey).Int()
+	return s.Client.Get(context.Background(), s.key(ActiveKegKey)).Int()
+}
+
+func (s *RedisStore) SetKegInfo(info KegInfo) error {
+	val, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("could not marshal keg info: %w", err)
+	}
+
+	return s.Client.Set(context.Background(), s.key(KegInfoKey), val, 0).Err()
+}
+
+func (s *RedisStore) GetKegInfo() (KegInfo, error) {
+	res, err := s.Client.Get(context.Background(), s.key(KegInfoKey)).Bytes()
+	if err != nil {
+		return KegInfo{}, err
+	}
+
+	var info KegInfo
+	if err := json.Unmarshal(res, &info); err != nil {
+		return KegInfo{}, fmt.Errorf("invalid keg info format in the storage: %w", err)
+	}
+
+	return info, nil
 }
 
 func (s *RedisStore) SetIsLow(isLow bool) error {
-	return s.Client.Set(context.Background(), IsLowKey, isLow, 0).Err()
+	return s.Client.Set(context.Background(), s.key(IsLowKey), isLow, 0).Err()
 }
 
 func (s *RedisStore) GetIsLow() (bool, error) {
-	return s.Client.Get(context.Background(), IsLowKey).Bool()
+	return s.Client.Get(context.Background(), s.key(IsLowKey)).Bool()
 }
 
 func (s *RedisStore) SetBeersLeft(beersLeft int) error {
-	return s.Client.Set(context.Background(), BeersLeftKey, beersLeft, 0).Err()
+	return s.Client.Set(context.Background(), s.key(BeersLeftKey), beersLeft, 0).Err()
 }
 
 func (s *RedisStore) GetBeersLeft() (int, error) {
-	return s.Client.Get(context.Background(), BeersLeftKey).Int()
+	return s.Client.Get(context.Background(), s.key(BeersLeftKey)).Int()
 }
 
 func (s *RedisStore) SetWarehouse(warehouse [5]int) error {
 	val := fmt.Sprintf("%d,%d,%d,%d,%d", warehouse[0], warehouse[1], warehouse[2], warehouse[3], warehouse[4])
-	return s.Client.Set(context.Background(), WarehouseKey, val, 0).Err()
+	return s.Client.Set(context.Background(), s.key(WarehouseKey), val, 0).Err()
 }
 
 func (s *RedisStore) GetWarehouse() ([5]int, error) {
-	res, err := s.Client.Get(context.Background(), "warehouse").Result()
+	res, err := s.Client.Get(context.Background(), s.key(WarehouseKey)).Result()
 	if err != nil {
 		return [5]int{0, 0, 0, 0, 0}, err
 	}
@@ -107,3 +169,573 @@ func (s *RedisStore) GetWarehouse() ([5]int, error) {
 
 	return warehouse, nil
 }
+
+func (s *RedisStore) SetCleaningUntil(until time.Time) error {
+	return s.Client.Set(context.Background(), s.key(CleaningUntilKey), until.Format(time.RFC3339), 0).Err()
+}
+
+func (s *RedisStore) GetCleaningUntil() (time.Time, error) {
+	res, err := s.Client.Get(context.Background(), s.key(CleaningUntilKey)).Result()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.RFC3339, res)
+}
+
+func (s *RedisStore) SetShadow(shadow DeviceShadow) error {
+	val, err := json.Marshal(shadow)
+	if err != nil {
+		return fmt.Errorf("could not marshal shadow: %w", err)
+	}
+
+	return s.Client.Set(context.Background(), s.key(ShadowKey), val, 0).Err()
+}
+
+func (s *RedisStore) SetSnapshot(snapshot ScaleSnapshot) error {
+	val, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("could not marshal snapshot: %w", err)
+	}
+
+	return s.Client.Set(context.Background(), s.key(SnapshotKey), val, 0).Err()
+}
+
+func (s *RedisStore) GetSnapshot() (ScaleSnapshot, error) {
+	res, err := s.Client.Get(context.Background(), s.key(SnapshotKey)).Bytes()
+	if err != nil {
+		return ScaleSnapshot{}, err
+	}
+
+	var snapshot ScaleSnapshot
+	if err := json.Unmarshal(res, &snapshot); err != nil {
+		return ScaleSnapshot{}, fmt.Errorf("invalid snapshot format in the storage: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// SetFirmware stores the release outside of the scale prefix, all scales run the same firmware
+func (s *RedisStore) SetFirmware(release FirmwareRelease) error {
+	val, err := json.Marshal(release)
+	if err != nil {
+		return fmt.Errorf("could not marshal firmware: %w", err)
+	}
+
+	return s.Client.Set(context.Background(), s.shared(FirmwareKey), val, 0).Err()
+}
+
+func (s *RedisStore) GetFirmware() (FirmwareRelease, error) {
+	res, err := s.Client.Get(context.Background(), s.shared(FirmwareKey)).Bytes()
+	if err != nil {
+		return FirmwareRelease{}, err
+	}
+
+	var release FirmwareRelease
+	if err := json.Unmarshal(res, &release); err != nil {
+		return FirmwareRelease{}, fmt.Errorf("invalid firmware format in the storage: %w", err)
+	}
+
+	return release, nil
+}
+
+func (s *RedisStore) GetShadow() (DeviceShadow, error) {
+	res, err := s.Client.Get(context.Background(), s.key(ShadowKey)).Bytes()
+	if err != nil {
+		return DeviceShadow{}, err
+	}
+
+	var shadow DeviceShadow
+	if err := json.Unmarshal(res, &shadow); err != nil {
+		return DeviceShadow{}, fmt.Errorf("invalid shadow format in the storage: %w", err)
+	}
+
+	return shadow, nil
+}
+
+func (s *RedisStore) SetTapBeer(beer TapBeer) error {
+	val, err := json.Marshal(beer)
+	if err != nil {
+		return fmt.Errorf("could not marshal tap beer: %w", err)
+	}
+
+	return s.Client.Set(context.Background(), s.key(TapBeerKey), val, 0).Err()
+}
+
+func (s *RedisStore) GetTapBeer() (TapBeer, error) {
+	res, err := s.Client.Get(context.Background(), s.key(TapBeerKey)).Bytes()
+	if err != nil {
+		return TapBeer{}, err
+	}
+
+	var beer TapBeer
+	if err := json.Unmarshal(res, &beer); err != nil {
+		return TapBeer{}, fmt.Errorf("invalid tap beer format in the storage: %w", err)
+	}
+
+	return beer, nil
+}
+
+func (s *RedisStore) SetCalibration(calibration Calibration) error {
+	val, err := json.Marshal(calibration)
+	if err != nil {
+		return fmt.Errorf("could not marshal calibration: %w", err)
+	}
+
+	// history keeps the latest calibrations including the current one
+	ctx := context.Background()
+	_, err = s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.key(CalibrationKey), val, 0)
+		pipe.LPush(ctx, s.key(CalibrationListKey), val)
+		pipe.LTrim(ctx, s.key(CalibrationListKey), 0, calibrationHistoryLength-1)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) GetCalibration() (Calibration, error) {
+	res, err := s.Client.Get(context.Background(), s.key(CalibrationKey)).Bytes()
+	if err != nil {
+		return Calibration{}, err
+	}
+
+	var calibration Calibration
+	if err := json.Unmarshal(res, &calibration); err != nil {
+		return Calibration{}, fmt.Errorf("invalid calibration format in the storage: %w", err)
+	}
+
+	return calibration, nil
+}
+
+func (s *RedisStore) GetCalibrationHistory() ([]Calibration, error) {
+	res, err := s.Client.LRange(context.Background(), s.key(CalibrationListKey), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]Calibration, 0, len(res))
+	for _, val := range res {
+		var calibration Calibration
+		if err := json.Unmarshal([]byte(val), &calibration); err != nil {
+			return nil, fmt.Errorf("invalid calibration format in the storage: %w", err)
+		}
+		history = append(history, calibration)
+	}
+
+	return history, nil
+}
+
+// AddMeasurement stores measurement in the sorted set scored by unix milliseconds
+func (s *RedisStore) AddMeasurement(m Measurement) error {
+	val, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("could not marshal measurement: %w", err)
+	}
+	if s.cipher != nil {
+		val = s.cipher.Seal(val)
+	}
+
+	return s.Client.ZAdd(context.Background(), s.key(MeasurementListKey), redis.Z{
+		Score:  float64(m.At.UnixMilli()),
+		Member: val,
+	}).Err()
+}
+
+func (s *RedisStore) GetMeasurements(from, to time.Time) ([]Measurement, error) {
+	res, err := s.Client.ZRangeByScore(context.Background(), s.key(MeasurementListKey), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: "(" + strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	measurements := make([]Measurement, 0, len(res))
+	for _, item := range res {
+		val := []byte(item)
+		if s.cipher != nil {
+			if val, err = s.cipher.Open(val); err != nil {
+				return nil, err
+			}
+		}
+
+		var m Measurement
+		if err := json.Unmarshal(val, &m); err != nil {
+			return nil, fmt.Errorf("invalid measurement format in the storage: %w", err)
+		}
+		measurements = append(measurements, m)
+	}
+
+	return measurements, nil
+}
+
+func (s *RedisStore) CountMeasurements(from, to time.Time) (int, error) {
+	count, err := s.Client.ZCount(
+		context.Background(),
+		s.key(MeasurementListKey),
+		strconv.FormatInt(from.UnixMilli(), 10),
+		"("+strconv.FormatInt(to.UnixMilli(), 10),
+	).Result()
+	return int(count), err
+}
+
+func (s *RedisStore) DeleteMeasurements(from, to time.Time) (int, error) {
+	deleted, err := s.Client.ZRemRangeByScore(
+		context.Background(),
+		s.key(MeasurementListKey),
+		strconv.FormatInt(from.UnixMilli(), 10),
+		"("+strconv.FormatInt(to.UnixMilli(), 10),
+	).Result()
+
+	return int(deleted), err
+}
+
+func (s *RedisStore) TrimMeasurements(keep int) (int, error) {
+	deleted, err := s.Client.ZRemRangeByRank(context.Background(), s.key(MeasurementListKey), 0, int64(-keep-1)).Result()
+	return int(deleted), err
+}
+
+// SaveKeg stores the keg in a hash keyed by keg id
+func (s *RedisStore) SaveKeg(info KegInfo) error {
+	val, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("could not marshal keg: %w", err)
+	}
+
+	return s.Client.HSet(context.Background(), s.key(KegsKey), info.Id, val).Err()
+}
+
+func (s *RedisStore) GetKeg(id string) (KegInfo, error) {
+	res, err := s.Client.HGet(context.Background(), s.key(KegsKey), id).Bytes()
+	if err != nil {
+		return KegInfo{}, err
+	}
+
+	var keg KegInfo
+	if err := json.Unmarshal(res, &keg); err != nil {
+		return KegInfo{}, fmt.Errorf("invalid keg format in the storage: %w", err)
+	}
+
+	return keg, nil
+}
+
+func (s *RedisStore) GetKegs() ([]KegInfo, error) {
+	res, err := s.Client.HGetAll(context.Background(), s.key(KegsKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	kegs := make([]KegInfo, 0, len(res))
+	for _, item := range res {
+		var keg KegInfo
+		if err := json.Unmarshal([]byte(item), &keg); err != nil {
+			return nil, fmt.Errorf("invalid keg format in the storage: %w", err)
+		}
+		kegs = append(kegs, keg)
+	}
+	sortKegs(kegs)
+
+	return kegs, nil
+}
+
+// AddWeather stores weather sample in the sorted set scored by unix milliseconds
+func (s *RedisStore) AddWeather(w WeatherSample) error {
+	val, err := json.Marshal(w)
+	if err != nil {
+		return fmt.Errorf("could not marshal weather: %w", err)
+	}
+
+	return s.Client.ZAdd(context.Background(), s.shared(WeatherListKey), redis.Z{
+		Score:  float64(w.At.UnixMilli()),
+		Member: val,
+	}).Err()
+}
+
+func (s *RedisStore) GetWeather(from, to time.Time) ([]WeatherSample, error) {
+	res, err := s.Client.ZRangeByScore(context.Background(), s.shared(WeatherListKey), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: "(" + strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]WeatherSample, 0, len(res))
+	for _, item := range res {
+		var w WeatherSample
+		if err := json.Unmarshal([]byte(item), &w); err != nil {
+			return nil, fmt.Errorf("invalid weather format in the storage: %w", err)
+		}
+		samples = append(samples, w)
+	}
+
+	return samples, nil
+}
+
+// AddRating appends rating to the list of the keg
+func (s *RedisStore) AddRating(r Rating) error {
+	val, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("could not marshal rating: %w", err)
+	}
+
+	return s.Client.RPush(context.Background(), s.key(RatingsKeyPrefix+r.KegId), val).Err()
+}
+
+func (s *RedisStore) GetRatings(kegId string) ([]Rating, error) {
+	res, err := s.Client.LRange(context.Background(), s.key(RatingsKeyPrefix+kegId), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := make([]Rating, 0, len(res))
+	for _, item := range res {
+		var r Rating
+		if err := json.Unmarshal([]byte(item), &r); err != nil {
+			return nil, fmt.Errorf("invalid rating format in the storage: %w", err)
+		}
+		ratings = append(ratings, r)
+	}
+
+	return ratings, nil
+}
+
+// AddPour stores pour in the sorted set scored by its end in unix milliseconds
+func (s *RedisStore) AddPour(p Pour) error {
+	val, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("could not marshal pour: %w", err)
+	}
+
+	return s.Client.ZAdd(context.Background(), s.shared(PourListKey), redis.Z{
+		Score:  float64(p.At.UnixMilli()),
+		Member: val,
+	}).Err()
+}
+
+// DeletePour removes the member of the pour, it's marshaled the same way as by AddPour
+func (s *RedisStore) DeletePour(p Pour) error {
+	val, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("could not marshal pour: %w", err)
+	}
+
+	return s.Client.ZRem(context.Background(), s.shared(PourListKey), val).Err()
+}
+
+func (s *RedisStore) GetPours(from, to time.Time) ([]Pour, error) {
+	res, err := s.Client.ZRangeByScore(context.Background(), s.shared(PourListKey), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: "(" + strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pours := make([]Pour, 0, len(res))
+	for _, item := range res {
+		var p Pour
+		if err := json.Unmarshal([]byte(item), &p); err != nil {
+			return nil, fmt.Errorf("invalid pour format in the storage: %w", err)
+		}
+		pours = append(pours, p)
+	}
+
+	return pours, nil
+}
+
+// SavePerson stores the person in the hash keyed by id
+func (s *RedisStore) SavePerson(p Person) error {
+	val, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("could not marshal person: %w", err)
+	}
+
+	return s.Client.HSet(context.Background(), s.shared(PeopleKey), p.Id, val).Err()
+}
+
+func (s *RedisStore) GetPeople() ([]Person, error) {
+	res, err := s.Client.HGetAll(context.Background(), s.shared(PeopleKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	people := make([]Person, 0, len(res))
+	for _, item := range res {
+		var p Person
+		if err := json.Unmarshal([]byte(item), &p); err != nil {
+			return nil, fmt.Errorf("invalid person format in the storage: %w", err)
+		}
+		people = append(people, p)
+	}
+	sortPeople(people)
+
+	return people, nil
+}
+
+func (s *RedisStore) DeletePerson(id string) error {
+	deleted, err := s.Client.HDel(context.Background(), s.shared(PeopleKey), id).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("person %s not found", id)
+	}
+
+	return nil
+}
+
+// AddSettlement stores settlement in the sorted set scored by unix milliseconds
+func (s *RedisStore) AddSettlement(settlement Settlement) error {
+	val, err := json.Marshal(settlement)
+	if err != nil {
+		return fmt.Errorf("could not marshal settlement: %w", err)
+	}
+
+	return s.Client.ZAdd(context.Background(), s.shared(SettlementListKey), redis.Z{
+		Score:  float64(settlement.At.UnixMilli()),
+		Member: val,
+	}).Err()
+}
+
+func (s *RedisStore) GetSettlements(from, to time.Time) ([]Settlement, error) {
+	res, err := s.Client.ZRangeByScore(context.Background(), s.shared(SettlementListKey), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: "(" + strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	settlements := make([]Settlement, 0, len(res))
+	for _, item := range res {
+		var settlement Settlement
+		if err := json.Unmarshal([]byte(item), &settlement); err != nil {
+			return nil, fmt.Errorf("invalid settlement format in the storage: %w", err)
+		}
+		settlements = append(settlements, settlement)
+	}
+
+	return settlements, nil
+}
+
+// SaveKegModel stores the model in the hash keyed by its id
+func (s *RedisStore) SaveKegModel(model KegModel) error {
+	val, err := json.Marshal(model)
+	if err != nil {
+		return fmt.Errorf("could not marshal keg model: %w", err)
+	}
+
+	return s.Client.HSet(context.Background(), s.shared(KegModelsKey), model.Id, val).Err()
+}
+
+func (s *RedisStore) GetKegModels() ([]KegModel, error) {
+	res, err := s.Client.HGetAll(context.Background(), s.shared(KegModelsKey)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]KegModel, 0, len(res))
+	for _, item := range res {
+		var model KegModel
+		if err := json.Unmarshal([]byte(item), &model); err != nil {
+			return nil, fmt.Errorf("invalid keg model format in the storage: %w", err)
+		}
+		models = append(models, model)
+	}
+	sortKegModels(models)
+
+	return models, nil
+}
+
+func (s *RedisStore) DeleteKegModel(id string) error {
+	deleted, err := s.Client.HDel(context.Background(), s.shared(KegModelsKey), id).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return fmt.Errorf("keg model %s not found", id)
+	}
+
+	return nil
+}
+
+func (s *RedisStore) AddPubSession(p PubSession) error {
+	val, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("could not marshal pub session: %w", err)
+	}
+
+	return s.Client.ZAdd(context.Background(), s.key(PubSessionListKey), redis.Z{
+		Score:  float64(p.OpenedAt.UnixMilli()),
+		Member: val,
+	}).Err()
+}
+
+func (s *RedisStore) GetPubSessions(from, to time.Time) ([]PubSession, error) {
+	res, err := s.Client.ZRangeByScore(context.Background(), s.key(PubSessionListKey), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: "(" + strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]PubSession, 0, len(res))
+	for _, item := range res {
+		var p PubSession
+		if err := json.Unmarshal([]byte(item), &p); err != nil {
+			return nil, fmt.Errorf("invalid pub session format in the storage: %w", err)
+		}
+		sessions = append(sessions, p)
+	}
+
+	return sessions, nil
+}
+
+// SetSessionTag replaces the tag in the sorted set scored by opening time in unix milliseconds
+func (s *RedisStore) SetSessionTag(tag SessionTag) error {
+	val, err := json.Marshal(tag)
+	if err != nil {
+		return fmt.Errorf("could not marshal session tag: %w", err)
+	}
+
+	score := strconv.FormatInt(tag.OpenedAt.UnixMilli(), 10)
+	_, err = s.Client.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(context.Background(), s.key(SessionTagsKey), score, score)
+		if tag.Tag != "" {
+			pipe.ZAdd(context.Background(), s.key(SessionTagsKey), redis.Z{
+				Score:  float64(tag.OpenedAt.UnixMilli()),
+				Member: val,
+			})
+		}
+		return nil
+	})
+
+	return err
+}
+
+func (s *RedisStore) GetSessionTags(from, to time.Time) ([]SessionTag, error) {
+	res, err := s.Client.ZRangeByScore(context.Background(), s.key(SessionTagsKey), &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.UnixMilli(), 10),
+		Max: "(" + strconv.FormatInt(to.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]SessionTag, 0, len(res))
+	for _, item := range res {
+		var tag SessionTag
+		if err := json.Unmarshal([]byte(item), &tag); err != nil {
+			return nil, fmt.Errorf("invalid session tag format in the storage: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+func (s *RedisStore) Ping() error {
+	return s.Client.Ping(context.Background()).Err()
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisStore_Keys(t *testing.T) {
+	config := NewConfig()
+	config.RedisPrefix = "staging:"
+	store := NewRedisStore(config)
+	defer store.Client.Close()
+
+	assert.Equal(t, "staging:measurements", store.key(MeasurementListKey))
+	assert.Equal(t, "staging:people", store.shared(PeopleKey))
+
+	device := store.ForDevice("tap2").(*RedisStore)
+	assert.Equal(t, "staging:device:tap2:measurements", device.key(MeasurementListKey))
+	assert.Equal(t, "staging:people", device.shared(PeopleKey), "people are shared by all taps of the instance")
+
+	assert.Equal(t, "measurements", (&RedisStore{}).key(MeasurementListKey), "no prefix by default")
+}
@@ -0,0 +1,732 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// SqlStore keeps the whole history in SQL database (sqlite for small installs, postgres)
+// so nothing is trimmed and the data can be analyzed with SQL
+// queries are written to run on both databases, times are stored as unix milliseconds
+type SqlStore struct {
+	db *sql.DB
+}
+
+// sqlMigrations are applied in order and recorded in schema_migrations
+// never change an applied migration, append a new one instead
+var sqlMigrations = [][]string{
+	{
+		`CREATE TABLE state (name TEXT PRIMARY KEY, value TEXT NOT NULL)`,
+		`CREATE TABLE measurements (at BIGINT NOT NULL, weight DOUBLE PRECISION NOT NULL)`,
+		`CREATE INDEX measurements_at ON measurements (at)`,
+		`CREATE TABLE kegs (id TEXT PRIMARY KEY, beer TEXT NOT NULL, size INTEGER NOT NULL, tapped_at BIGINT NOT NULL, finished_at BIGINT NOT NULL, data TEXT NOT NULL)`,
+		`CREATE TABLE pours (started_at BIGINT NOT NULL, at BIGINT NOT NULL, grams DOUBLE PRECISION NOT NULL, glasses DOUBLE PRECISION NOT NULL, duration DOUBLE PRECISION NOT NULL, keg_id TEXT NOT NULL)`,
+		`CREATE INDEX pours_at ON pours (at)`,
+		`CREATE TABLE pub_sessions (opened_at BIGINT PRIMARY KEY, closed_at BIGINT NOT NULL)`,
+		`CREATE TABLE session_tags (opened_at BIGINT PRIMARY KEY, tag TEXT NOT NULL)`,
+		`CREATE TABLE weather (at BIGINT NOT NULL, temperature DOUBLE PRECISION NOT NULL)`,
+		`CREATE INDEX weather_at ON weather (at)`,
+		`CREATE TABLE ratings (keg_id TEXT NOT NULL, at BIGINT NOT NULL, up BOOLEAN NOT NULL, comment TEXT NOT NULL)`,
+		`CREATE INDEX ratings_keg_id ON ratings (keg_id)`,
+		`CREATE TABLE calibrations (updated_at BIGINT NOT NULL, data TEXT NOT NULL)`,
+	},
+	{
+		`CREATE TABLE keg_models (id TEXT PRIMARY KEY, name TEXT NOT NULL, size INTEGER NOT NULL, empty_weight DOUBLE PRECISION NOT NULL)`,
+	},
+	{
+		`CREATE TABLE people (id TEXT PRIMARY KEY, name TEXT NOT NULL, token_hash TEXT NOT NULL UNIQUE, public BOOLEAN NOT NULL, created_at BIGINT NOT NULL)`,
+		`ALTER TABLE pours ADD COLUMN person TEXT NOT NULL DEFAULT ''`,
+	},
+	{
+		`ALTER TABLE keg_models ADD COLUMN brewery TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE keg_models ADD COLUMN beer TEXT NOT NULL DEFAULT ''`,
+	},
+	{
+		`CREATE TABLE settlements (person_id TEXT NOT NULL, at BIGINT NOT NULL, glasses DOUBLE PRECISION NOT NULL, amount DOUBLE PRECISION NOT NULL)`,
+		`CREATE INDEX settlements_at ON settlements (at)`,
+	},
+	{
+		`ALTER TABLE measurements ADD COLUMN source TEXT NOT NULL DEFAULT ''`,
+	},
+	{
+		`ALTER TABLE measurements ADD COLUMN raw DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	},
+	{
+		`ALTER TABLE measurements ADD COLUMN temperature DOUBLE PRECISION`,
+		`ALTER TABLE measurements ADD COLUMN battery DOUBLE PRECISION`,
+	},
+}
+
+// state keys of single values
+const (
+	sqlWeightKey        = "weight"
+	sqlWeightAtKey      = "weight_at"
+	sqlActiveKegKey     = "active_keg"
+	sqlKegInfoKey       = "keg_info"
+	sqlBeersLeftKey     = "beers_left"
+	sqlIsLowKey         = "is_low"
+	sqlWarehouseKey     = "warehouse"
+	sqlCleaningUntilKey = "cleaning_until"
+	sqlShadowKey        = "shadow"
+	sqlTapBeerKey       = "tap_beer"
+	sqlSnapshotKey      = "snapshot"
+	sqlFirmwareKey      = "firmware"
+	sqlCalibrationKey   = "calibration"
+)
+
+// NewSqlStore opens the database and applies missing migrations
+// driver is sqlite or postgres, dsn is a file name or a connection string
+func NewSqlStore(driver, dsn string) (*SqlStore, error) {
+	driverName := map[string]string{"sqlite": "sqlite3", "postgres": "postgres"}[driver]
+	if driverName == "" {
+		return nil, fmt.Errorf("unsupported sql driver %q", driver)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %w", err)
+	}
+	if driver == "sqlite" {
+		db.SetMaxOpenConns(1) // sqlite allows a single writer
+	}
+
+	s := &SqlStore{db: db}
+	if err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SqlStore) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at BIGINT NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("could not create migrations table: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+
+	for i := current; i < len(sqlMigrations); i++ {
+		version := i + 1
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, statement := range sqlMigrations[i] {
+			if _, err := tx.Exec(statement); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("migration %d failed: %w", version, err)
+			}
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)`, version, time.Now().UnixMilli()); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("could not record migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not commit migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SqlStore) Ping() error {
+	return s.db.Ping()
+}
+
+func (s *SqlStore) setState(name, value string) error {
+	_, err := s.db.Exec(`INSERT INTO state (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = excluded.value`, name, value)
+	return err
+}
+
+func (s *SqlStore) getState(name string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM state WHERE name = $1`, name).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%s %w", name, ErrNotFound)
+	}
+	return value, err
+}
+
+func (s *SqlStore) setJsonState(name string, value any) error {
+	val, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("could not marshal %s: %w", name, err)
+	}
+	return s.setState(name, string(val))
+}
+
+func (s *SqlStore) getJsonState(name string, value any) error {
+	val, err := s.getState(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(val), value); err != nil {
+		return fmt.Errorf("invalid %s format in the storage: %w", name, err)
+	}
+	return nil
+}
+
+func (s *SqlStore) SetWeight(weight float64) error {
+	return s.setState(sqlWeightKey, strconv.FormatFloat(weight, 'f', -1, 64))
+}
+
+func (s *SqlStore) GetWeight() (float64, error) {
+	val, err := s.getState(sqlWeightKey)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(val, 64)
+}
+
+func (s *SqlStore) SetWeightAt(weightAt time.Time) error {
+	return s.setState(sqlWeightAtKey, strconv.FormatInt(weightAt.UnixMilli(), 10))
+}
+
+func (s *SqlStore) GetWeightAt() (time.Time, error) {
+	return s.getTimeState(sqlWeightAtKey)
+}
+
+func (s *SqlStore) getTimeState(name string) (time.Time, error) {
+	val, err := s.getState(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ms, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s format in the storage: %w", name, err)
+	}
+	return time.UnixMilli(ms), nil
+}
+
+func (s *SqlStore) SetActiveKeg(keg int) error {
+	return s.setState(sqlActiveKegKey, strconv.Itoa(keg))
+}
+
+func (s *SqlStore) GetActiveKeg() (int, error) {
+	val, err := s.getState(sqlActiveKegKey)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(val)
+}
+
+func (s *SqlStore) SetKegInfo(info KegInfo) error {
+	return s.setJsonState(sqlKegInfoKey, info)
+}
+
+func (s *SqlStore) GetKegInfo() (KegInfo, error) {
+	var info KegInfo
+	err := s.getJsonState(sqlKegInfoKey, &info)
+	return info, err
+}
+
+// SaveKeg upserts the keg, columns besides data are denormalized for SQL analytics
+func (s *SqlStore) SaveKeg(info KegInfo) error {
+	val, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("could not marshal keg: %w", err)
+	}
+
+	_, err = s.db.Exec(`INSERT INTO kegs (id, beer, size, tapped_at, finished_at, data) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET beer = excluded.beer, size = excluded.size, tapped_at = excluded.tapped_at, finished_at = excluded.finished_at, data = excluded.data`,
+		info.Id, info.Beer, info.Size, info.TappedAt.UnixMilli(), unixMilliOrZero(info.FinishedAt), string(val))
+	return err
+}
+
+func (s *SqlStore) GetKeg(id string) (KegInfo, error) {
+	var val string
+	err := s.db.QueryRow(`SELECT data FROM kegs WHERE id = $1`, id).Scan(&val)
+	if errors.Is(err, sql.ErrNoRows) {
+		return KegInfo{}, fmt.Errorf("keg %s not found", id)
+	}
+	if err != nil {
+		return KegInfo{}, err
+	}
+
+	var keg KegInfo
+	if err := json.Unmarshal([]byte(val), &keg); err != nil {
+		return KegInfo{}, fmt.Errorf("invalid keg format in the storage: %w", err)
+	}
+	return keg, nil
+}
+
+func (s *SqlStore) GetKegs() ([]KegInfo, error) {
+	rows, err := s.db.Query(`SELECT data FROM kegs ORDER BY tapped_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kegs := []KegInfo{}
+	for rows.Next() {
+		var val string
+		if err := rows.Scan(&val); err != nil {
+			return nil, err
+		}
+		var keg KegInfo
+		if err := json.Unmarshal([]byte(val), &keg); err != nil {
+			return nil, fmt.Errorf("invalid keg format in the storage: %w", err)
+		}
+		kegs = append(kegs, keg)
+	}
+
+	return kegs, rows.Err()
+}
+
+func (s *SqlStore) SavePerson(p Person) error {
+	_, err := s.db.Exec(`INSERT INTO people (id, name, token_hash, public, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, token_hash = excluded.token_hash, public = excluded.public`,
+		p.Id, p.Name, p.TokenHash, p.Public, p.CreatedAt.UnixMilli())
+	return err
+}
+
+func (s *SqlStore) GetPeople() ([]Person, error) {
+	rows, err := s.db.Query(`SELECT id, name, token_hash, public, created_at FROM people ORDER BY name, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	people := []Person{}
+	for rows.Next() {
+		var createdAt int64
+		var p Person
+		if err := rows.Scan(&p.Id, &p.Name, &p.TokenHash, &p.Public, &createdAt); err != nil {
+			return nil, err
+		}
+		p.CreatedAt = time.UnixMilli(createdAt)
+		people = append(people, p)
+	}
+
+	return people, rows.Err()
+}
+
+func (s *SqlStore) DeletePerson(id string) error {
+	res, err := s.db.Exec(`DELETE FROM people WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err == nil && deleted == 0 {
+		return fmt.Errorf("person %s not found", id)
+	}
+	return nil
+}
+
+func (s *SqlStore) AddSettlement(settlement Settlement) error {
+	_, err := s.db.Exec(`INSERT INTO settlements (person_id, at, glasses, amount) VALUES ($1, $2, $3, $4)`,
+		settlement.PersonId, settlement.At.UnixMilli(), settlement.Glasses, settlement.Amount)
+	return err
+}
+
+func (s *SqlStore) GetSettlements(from, to time.Time) ([]Settlement, error) {
+	rows, err := s.db.Query(`SELECT person_id, at, glasses, amount FROM settlements WHERE at >= $1 AND at < $2 ORDER BY at`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settlements := []Settlement{}
+	for rows.Next() {
+		var at int64
+		var settlement Settlement
+		if err := rows.Scan(&settlement.PersonId, &at, &settlement.Glasses, &settlement.Amount); err != nil {
+			return nil, err
+		}
+		settlement.At = time.UnixMilli(at)
+		settlements = append(settlements, settlement)
+	}
+
+	return settlements, rows.Err()
+}
+
+func (s *SqlStore) SaveKegModel(model KegModel) error {
+	_, err := s.db.Exec(`INSERT INTO keg_models (id, name, size, empty_weight, brewery, beer) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET name = excluded.name, size = excluded.size, empty_weight = excluded.empty_weight, brewery = excluded.brewery, beer = excluded.beer`,
+		model.Id, model.Name, model.Size, model.EmptyWeight, model.Brewery, model.Beer)
+	return err
+}
+
+func (s *SqlStore) GetKegModels() ([]KegModel, error) {
+	rows, err := s.db.Query(`SELECT id, name, size, empty_weight, brewery, beer FROM keg_models ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	models := []KegModel{}
+	for rows.Next() {
+		var model KegModel
+		if err := rows.Scan(&model.Id, &model.Name, &model.Size, &model.EmptyWeight, &model.Brewery, &model.Beer); err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+
+	return models, rows.Err()
+}
+
+func (s *SqlStore) DeleteKegModel(id string) error {
+	res, err := s.db.Exec(`DELETE FROM keg_models WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := res.RowsAffected(); err == nil && deleted == 0 {
+		return fmt.Errorf("keg model %s not found", id)
+	}
+	return nil
+}
+
+func (s *SqlStore) SetBeersLeft(beersLeft int) error {
+	return s.setState(sqlBeersLeftKey, strconv.Itoa(beersLeft))
+}
+
+func (s *SqlStore) GetBeersLeft() (int, error) {
+	val, err := s.getState(sqlBeersLeftKey)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(val)
+}
+
+func (s *SqlStore) SetIsLow(isLow bool) error {
+	return s.setState(sqlIsLowKey, strconv.FormatBool(isLow))
+}
+
+func (s *SqlStore) GetIsLow() (bool, error) {
+	val, err := s.getState(sqlIsLowKey)
+	if err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(val)
+}
+
+func (s *SqlStore) SetWarehouse(warehouse [5]int) error {
+	return s.setJsonState(sqlWarehouseKey, warehouse)
+}
+
+func (s *SqlStore) GetWarehouse() ([5]int, error) {
+	var warehouse [5]int
+	err := s.getJsonState(sqlWarehouseKey, &warehouse)
+	return warehouse, err
+}
+
+func (s *SqlStore) SetCleaningUntil(until time.Time) error {
+	return s.setState(sqlCleaningUntilKey, strconv.FormatInt(unixMilliOrZero(until), 10))
+}
+
+func (s *SqlStore) GetCleaningUntil() (time.Time, error) {
+	until, err := s.getTimeState(sqlCleaningUntilKey)
+	if err == nil && until.UnixMilli() == 0 {
+		return time.Time{}, nil
+	}
+	return until, err
+}
+
+func (s *SqlStore) SetShadow(shadow DeviceShadow) error {
+	return s.setJsonState(sqlShadowKey, shadow)
+}
+
+func (s *SqlStore) GetShadow() (DeviceShadow, error) {
+	var shadow DeviceShadow
+	err := s.getJsonState(sqlShadowKey, &shadow)
+	return shadow, err
+}
+
+func (s *SqlStore) SetTapBeer(beer TapBeer) error {
+	return s.setJsonState(sqlTapBeerKey, beer)
+}
+
+func (s *SqlStore) GetTapBeer() (TapBeer, error) {
+	var beer TapBeer
+	err := s.getJsonState(sqlTapBeerKey, &beer)
+	return beer, err
+}
+
+func (s *SqlStore) SetSnapshot(snapshot ScaleSnapshot) error {
+	return s.setJsonState(sqlSnapshotKey, snapshot)
+}
+
+func (s *SqlStore) GetSnapshot() (ScaleSnapshot, error) {
+	var snapshot ScaleSnapshot
+	err := s.getJsonState(sqlSnapshotKey, &snapshot)
+	return snapshot, err
+}
+
+func (s *SqlStore) SetFirmware(release FirmwareRelease) error {
+	return s.setJsonState(sqlFirmwareKey, release)
+}
+
+func (s *SqlStore) GetFirmware() (FirmwareRelease, error) {
+	var release FirmwareRelease
+	err := s.getJsonState(sqlFirmwareKey, &release)
+	return release, err
+}
+
+// SetCalibration replaces the calibration and appends it to the history
+func (s *SqlStore) SetCalibration(calibration Calibration) error {
+	val, err := json.Marshal(calibration)
+	if err != nil {
+		return fmt.Errorf("could not marshal calibration: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`INSERT INTO state (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = excluded.value`, sqlCalibrationKey, string(val))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO calibrations (updated_at, data) VALUES ($1, $2)`, calibration.UpdatedAt.UnixMilli(), string(val))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SqlStore) GetCalibration() (Calibration, error) {
+	var calibration Calibration
+	err := s.getJsonState(sqlCalibrationKey, &calibration)
+	return calibration, err
+}
+
+func (s *SqlStore) GetCalibrationHistory() ([]Calibration, error) {
+	rows, err := s.db.Query(`SELECT data FROM calibrations ORDER BY updated_at DESC LIMIT $1`, calibrationHistoryLength)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []Calibration{}
+	for rows.Next() {
+		var val string
+		if err := rows.Scan(&val); err != nil {
+			return nil, err
+		}
+		var calibration Calibration
+		if err := json.Unmarshal([]byte(val), &calibration); err != nil {
+			return nil, fmt.Errorf("invalid calibration format in the storage: %w", err)
+		}
+		history = append(history, calibration)
+	}
+
+	return history, rows.Err()
+}
+
+func (s *SqlStore) AddMeasurement(m Measurement) error {
+	_, err := s.db.Exec(`INSERT INTO measurements (at, weight, source, raw, temperature, battery) VALUES ($1, $2, $3, $4, $5, $6)`,
+		m.At.UnixMilli(), m.Weight, m.Source, m.Raw, m.Temperature, m.Battery)
+	return err
+}
+
+func (s *SqlStore) GetMeasurements(from, to time.Time) ([]Measurement, error) {
+	rows, err := s.db.Query(`SELECT at, weight, source, raw, temperature, battery FROM measurements WHERE at >= $1 AND at < $2 ORDER BY at`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	measurements := []Measurement{}
+	for rows.Next() {
+		var at int64
+		var m Measurement
+		if err := rows.Scan(&at, &m.Weight, &m.Source, &m.Raw, &m.Temperature, &m.Battery); err != nil {
+			return nil, err
+		}
+		m.At = time.UnixMilli(at)
+		measurements = append(measurements, m)
+	}
+
+	return measurements, rows.Err()
+}
+
+func (s *SqlStore) DeleteMeasurements(from, to time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM measurements WHERE at >= $1 AND at < $2`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+// TrimMeasurements keeps measurements not older than the keep-th newest one, ties with it are kept
+func (s *SqlStore) TrimMeasurements(keep int) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM measurements WHERE at < (SELECT at FROM measurements ORDER BY at DESC LIMIT 1 OFFSET $1)`, keep-1)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+func (s *SqlStore) CountMeasurements(from, to time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM measurements WHERE at >= $1 AND at < $2`, from.UnixMilli(), to.UnixMilli()).Scan(&count)
+	return count, err
+}
+
+func (s *SqlStore) AddPour(p Pour) error {
+	_, err := s.db.Exec(`INSERT INTO pours (started_at, at, grams, glasses, duration, keg_id, person) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		p.StartedAt.UnixMilli(), p.At.UnixMilli(), p.Grams, p.Glasses, p.Duration, p.KegId, p.Person)
+	return err
+}
+
+func (s *SqlStore) DeletePour(p Pour) error {
+	_, err := s.db.Exec(`DELETE FROM pours WHERE started_at = $1 AND at = $2 AND keg_id = $3`, p.StartedAt.UnixMilli(), p.At.UnixMilli(), p.KegId)
+	return err
+}
+
+func (s *SqlStore) GetPours(from, to time.Time) ([]Pour, error) {
+	rows, err := s.db.Query(`SELECT started_at, at, grams, glasses, duration, keg_id, person FROM pours WHERE at >= $1 AND at < $2 ORDER BY at`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pours := []Pour{}
+	for rows.Next() {
+		var startedAt, at int64
+		var p Pour
+		if err := rows.Scan(&startedAt, &at, &p.Grams, &p.Glasses, &p.Duration, &p.KegId, &p.Person); err != nil {
+			return nil, err
+		}
+		p.StartedAt = time.UnixMilli(startedAt)
+		p.At = time.UnixMilli(at)
+		pours = append(pours, p)
+	}
+
+	return pours, rows.Err()
+}
+
+func (s *SqlStore) AddWeather(w WeatherSample) error {
+	_, err := s.db.Exec(`INSERT INTO weather (at, temperature) VALUES ($1, $2)`, w.At.UnixMilli(), w.Temperature)
+	return err
+}
+
+func (s *SqlStore) GetWeather(from, to time.Time) ([]WeatherSample, error) {
+	rows, err := s.db.Query(`SELECT at, temperature FROM weather WHERE at >= $1 AND at < $2 ORDER BY at`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []WeatherSample{}
+	for rows.Next() {
+		var at int64
+		var w WeatherSample
+		if err := rows.Scan(&at, &w.Temperature); err != nil {
+			return nil, err
+		}
+		w.At = time.UnixMilli(at)
+		samples = append(samples, w)
+	}
+
+	return samples, rows.Err()
+}
+
+func (s *SqlStore) AddRating(r Rating) error {
+	_, err := s.db.Exec(`INSERT INTO ratings (keg_id, at, up, comment) VALUES ($1, $2, $3, $4)`, r.KegId, r.At.UnixMilli(), r.Up, r.Comment)
+	return err
+}
+
+func (s *SqlStore) GetRatings(kegId string) ([]Rating, error) {
+	rows, err := s.db.Query(`SELECT keg_id, at, up, comment FROM ratings WHERE keg_id = $1 ORDER BY at`, kegId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []Rating{}
+	for rows.Next() {
+		var at int64
+		var r Rating
+		if err := rows.Scan(&r.KegId, &at, &r.Up, &r.Comment); err != nil {
+			return nil, err
+		}
+		r.At = time.UnixMilli(at)
+		ratings = append(ratings, r)
+	}
+
+	return ratings, rows.Err()
+}
+
+func (s *SqlStore) AddPubSession(p PubSession) error {
+	_, err := s.db.Exec(`INSERT INTO pub_sessions (opened_at, closed_at) VALUES ($1, $2)
+		ON CONFLICT (opened_at) DO UPDATE SET closed_at = excluded.closed_at`, p.OpenedAt.UnixMilli(), p.ClosedAt.UnixMilli())
+	return err
+}
+
+func (s *SqlStore) GetPubSessions(from, to time.Time) ([]PubSession, error) {
+	rows, err := s.db.Query(`SELECT opened_at, closed_at FROM pub_sessions WHERE opened_at >= $1 AND opened_at < $2 ORDER BY opened_at`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []PubSession{}
+	for rows.Next() {
+		var openedAt, closedAt int64
+		if err := rows.Scan(&openedAt, &closedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, PubSession{OpenedAt: time.UnixMilli(openedAt), ClosedAt: time.UnixMilli(closedAt)})
+	}
+
+	return sessions, rows.Err()
+}
+
+// SetSessionTag replaces the tag of the session, empty tag removes it
+func (s *SqlStore) SetSessionTag(tag SessionTag) error {
+	if tag.Tag == "" {
+		_, err := s.db.Exec(`DELETE FROM session_tags WHERE opened_at = $1`, tag.OpenedAt.UnixMilli())
+		return err
+	}
+
+	_, err := s.db.Exec(`INSERT INTO session_tags (opened_at, tag) VALUES ($1, $2) ON CONFLICT (opened_at) DO UPDATE SET tag = excluded.tag`,
+		tag.OpenedAt.UnixMilli(), tag.Tag)
+	return err
+}
+
+func (s *SqlStore) GetSessionTags(from, to time.Time) ([]SessionTag, error) {
+	rows, err := s.db.Query(`SELECT opened_at, tag FROM session_tags WHERE opened_at >= $1 AND opened_at < $2 ORDER BY opened_at`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []SessionTag{}
+	for rows.Next() {
+		var openedAt int64
+		var tag SessionTag
+		if err := rows.Scan(&openedAt, &tag.Tag); err != nil {
+			return nil, err
+		}
+		tag.OpenedAt = time.UnixMilli(openedAt)
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// unixMilliOrZero stores zero time as 0 instead of a large negative number
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSqliteStore(t *testing.T, path string) *SqlStore {
+	store, err := NewSqlStore("sqlite", path)
+	if err != nil && strings.Contains(err.Error(), "cgo") {
+		t.Skip("sqlite driver requires cgo")
+	}
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = store.db.Close() })
+	return store
+}
+
+func TestSqlStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scale.db")
+	store := newSqliteStore(t, path)
+	assert.Nil(t, store.Ping())
+
+	_, err := store.GetWeight()
+	assert.NotNil(t, err, "nothing stored yet")
+
+	now := time.UnixMilli(time.Now().UnixMilli()) // the storage keeps milliseconds
+	assert.Nil(t, store.SetWeight(20500.5))
+	assert.Nil(t, store.SetWeightAt(now))
+	assert.Nil(t, store.SetWarehouse([5]int{1, 2, 3, 4, 5}))
+	assert.Nil(t, store.SetCleaningUntil(time.Time{}))
+
+	keg := NewKegInfo(15, "Pilsner", now.Add(-time.Hour), 22000)
+	assert.Nil(t, store.SaveKeg(keg))
+	keg.Pours = 3
+	assert.Nil(t, store.SaveKeg(keg))
+
+	temperature, battery := 4.5, 3.71
+	for i := 0; i < 3; i++ {
+		m := Measurement{Weight: float64(20000 - i*500), At: now.Add(time.Duration(i) * time.Minute), Source: SourceMqtt}
+		if i == 1 {
+			m.Sensors = Sensors{Temperature: &temperature, Battery: &battery}
+		}
+		assert.Nil(t, store.AddMeasurement(m))
+	}
+	assert.Nil(t, store.AddPubSession(PubSession{OpenedAt: now.Add(-2 * time.Hour), ClosedAt: now}))
+	assert.Nil(t, store.SetSessionTag(SessionTag{OpenedAt: now.Add(-2 * time.Hour), Tag: "birthday"}))
+	assert.Nil(t, store.SetSessionTag(SessionTag{OpenedAt: now.Add(-2 * time.Hour), Tag: ""}))
+	assert.Nil(t, store.AddPour(Pour{StartedAt: now.Add(-time.Minute), At: now, Grams: 500, Glasses: 1, KegId: keg.Id, Person: "a1"}))
+	assert.Nil(t, store.SavePerson(Person{Id: "a1", Name: "Anna", TokenHash: HashTapToken("04a1"), CreatedAt: now}))
+	assert.Nil(t, store.AddSettlement(Settlement{PersonId: "a1", At: now, Glasses: 1, Amount: 45}))
+	assert.Nil(t, store.SaveKegModel(KegModel{Id: "steel-50", Name: "Steel", Size: 50, EmptyWeight: 12000}))
+	assert.Nil(t, store.SaveKegModel(KegModel{Id: "steel-50", Name: "Steel", Size: 50, EmptyWeight: 12500, Brewery: "Bernard", Beer: "Bernard 11"}))
+
+	// reopening does not apply migrations again
+	store = newSqliteStore(t, path)
+
+	weight, err := store.GetWeight()
+	assert.Nil(t, err)
+	assert.Equal(t, 20500.5, weight)
+	weightAt, err := store.GetWeightAt()
+	assert.Nil(t, err)
+	assert.True(t, now.Equal(weightAt))
+	warehouse, err := store.GetWarehouse()
+	assert.Nil(t, err)
+	assert.Equal(t, [5]int{1, 2, 3, 4, 5}, warehouse)
+	cleaningUntil, err := store.GetCleaningUntil()
+	assert.Nil(t, err)
+	assert.True(t, cleaningUntil.IsZero())
+
+	kegs, err := store.GetKegs()
+	assert.Nil(t, err)
+	assert.Len(t, kegs, 1)
+	assert.Equal(t, 3, kegs[0].Pours)
+
+	measurements, err := store.GetMeasurements(now, now.Add(2*time.Minute))
+	assert.Nil(t, err)
+	assert.Len(t, measurements, 2)
+	assert.Equal(t, 19500.0, measurements[1].Weight)
+	assert.Equal(t, SourceMqtt, measurements[1].Source)
+	assert.Nil(t, measurements[0].Temperature, "not reported")
+	assert.Equal(t, &temperature, measurements[1].Temperature)
+	assert.Equal(t, &battery, measurements[1].Battery)
+
+	deleted, err := store.DeleteMeasurements(now, now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+	count, err := store.CountMeasurements(time.Unix(0, 0), now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	deleted, err = store.TrimMeasurements(5)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, deleted, "within the limit")
+	deleted, err = store.TrimMeasurements(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted, "the oldest one")
+	count, err = store.CountMeasurements(time.Unix(0, 0), now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	sessions, err := store.GetPubSessions(now.Add(-24*time.Hour), now)
+	assert.Nil(t, err)
+	assert.Equal(t, []PubSession{{OpenedAt: now.Add(-2 * time.Hour), ClosedAt: now}}, sessions)
+	tags, err := store.GetSessionTags(now.Add(-24*time.Hour), now)
+	assert.Nil(t, err)
+	assert.Empty(t, tags)
+
+	pours, err := store.GetPours(now.Add(-time.Hour), now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, "a1", pours[0].Person)
+	assert.Nil(t, store.DeletePour(pours[0]))
+	pours, err = store.GetPours(now.Add(-time.Hour), now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Empty(t, pours)
+	people, err := store.GetPeople()
+	assert.Nil(t, err)
+	assert.Equal(t, []Person{{Id: "a1", Name: "Anna", TokenHash: HashTapToken("04a1"), CreatedAt: now}}, people)
+	assert.Nil(t, store.DeletePerson("a1"))
+	settlements, err := store.GetSettlements(now, now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, []Settlement{{PersonId: "a1", At: now, Glasses: 1, Amount: 45}}, settlements)
+
+	models, err := store.GetKegModels()
+	assert.Nil(t, err)
+	assert.Equal(t, []KegModel{{Id: "steel-50", Name: "Steel", Size: 50, EmptyWeight: 12500, Brewery: "Bernard", Beer: "Bernard 11"}}, models)
+	assert.Nil(t, store.DeleteKegModel("steel-50"))
+	assert.NotNil(t, store.DeleteKegModel("steel-50"))
+}
+
+func TestScale_StoresPubSession(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	s.Ping()
+	s.LastOk = time.Now().Add(-2 * OkLimit)
+	s.Recheck()
+	assert.False(t, s.Pub.IsOpen)
+
+	sessions, err := s.store.GetPubSessions(time.Now().Add(-time.Hour), time.Now())
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, s.Pub.ClosedAt, sessions[0].ClosedAt)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// DailySummary aggregates consumption of a single day
+type DailySummary struct {
+	Day         string  `json:"day"` // YYYY-MM-DD in local timezone
+	Liters      float64 `json:"liters"`
+	Beers       float64 `json:"beers"`
+	Sessions    int     `json:"sessions"`               // continuous periods of scale activity (pub open)
+	BusiestHour *int    `json:"busiest_hour,omitempty"` // hour (local timezone) with the most consumption, nil without consumption
+	Holiday     string  `json:"holiday,omitempty"`
+}
+
+// DailyStats contains summaries of the days within the period
+type DailyStats struct {
+	Days    []DailySummary `json:"days"`
+	Busiest *DailySummary  `json:"busiest,omitempty"` // day with the most liters, nil without consumption
+}
+
+// CalcDailySummary calculates consumption from measurements of the day ordered by time
+// weight increases (keg change, lifted keg) are not counted as consumption
+// a gap longer than [OkLimit] closes the pub, so the next measurement starts a new session
+func CalcDailySummary(day time.Time, measurements []Measurement, glass float64) DailySummary {
+	summary := DailySummary{Day: day.In(getTz()).Format(time.DateOnly)}
+
+	consumed := 0.0
+	byHour := map[int]float64{}
+	for i, m := range measurements {
+		if i == 0 || m.At.Sub(measurements[i-1].At) > OkLimit {
+			summary.Sessions++
+		}
+		if i > 0 {
+			if drop := measurements[i-1].Weight - m.Weight; drop > 0 {
+				consumed += drop
+				byHour[m.At.In(getTz()).Hour()] += drop
+			}
+		}
+	}
+
+	summary.Liters = consumed / 1000
+	if glass > 0 {
+		summary.Beers = consumed / glass
+	}
+	summary.BusiestHour = busiestHour(byHour)
+
+	return summary
+}
+
+// busiestHour returns the hour with the most consumption, the earlier one on a tie
+// nil if nothing was consumed
+func busiestHour(byHour map[int]float64) *int {
+	var busiest *int
+	for hour := 0; hour < 24; hour++ {
+		if byHour[hour] > 0 && (busiest == nil || byHour[hour] > byHour[*busiest]) {
+			busiest = &hour
+		}
+	}
+
+	return busiest
+}
+
+// GetDailyStats returns summaries of the last days (including today) split by [Config.PubDayStart]
+func GetDailyStats(store Storage, holidays *HolidayCalendar, days int, glass float64, dayStart int, now time.Time) (DailyStats, error) {
+	today := pubDayStart(now, dayStart)
+	from := today.AddDate(0, 0, -days+1)
+
+	measurements, err := store.GetMeasurements(from, now)
+	if err != nil {
+		return DailyStats{}, fmt.Errorf("could not load measurements: %w", err)
+	}
+
+	stats := DailyStats{Days: make([]DailySummary, 0, days)}
+	for day := from; !day.After(today); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+
+		// measurements are ordered by time
+		count := 0
+		for count < len(measurements) && measurements[count].At.Before(next) {
+			count++
+		}
+
+		summary := CalcDailySummary(day, measurements[:count], glass)
+		summary.Liters = math.Round(summary.Liters*100) / 100
+		summary.Beers = math.Round(summary.Beers*10) / 10
+		summary.Holiday, _ = holidays.Holiday(day)
+		stats.Days = append(stats.Days, summary)
+		measurements = measurements[count:]
+	}
+
+	for i, day := range stats.Days {
+		if day.Liters > 0 && (stats.Busiest == nil || day.Liters > stats.Busiest.Liters) {
+			stats.Busiest = &stats.Days[i]
+		}
+	}
+
+	return stats, nil
+}
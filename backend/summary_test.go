@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcDailySummary(t *testing.T) {
+	start := time.Date(2024, 6, 1, 18, 0, 0, 0, getTz())
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	measurements := []Measurement{
+		{Weight: 20000, At: at(0)},
+		{Weight: 19500, At: at(1)},
+		{Weight: 19000, At: at(2)},
+		// pub closed, new keg tapped next evening
+		{Weight: 25000, At: at(60)},
+		{Weight: 24000, At: at(61)},
+	}
+
+	summary := CalcDailySummary(start, measurements, 500)
+	assert.Equal(t, "2024-06-01", summary.Day)
+	assert.Equal(t, 2.0, summary.Liters)
+	assert.Equal(t, 4.0, summary.Beers)
+	assert.Equal(t, 2, summary.Sessions)
+	assert.Equal(t, 18, *summary.BusiestHour, "the same consumption at 19, the earlier hour wins")
+
+	empty := CalcDailySummary(start, nil, 500)
+	assert.Equal(t, 0, empty.Sessions)
+	assert.Equal(t, 0.0, empty.Liters)
+	assert.Nil(t, empty.BusiestHour)
+}
+
+func TestGetDailyStats(t *testing.T) {
+	config := NewConfig()
+	store := &FakeStore{}
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, getTz())
+	friday := time.Date(2024, 6, 1, 20, 0, 0, 0, getTz())
+
+	// friday night continues after midnight, it's still the same pub day
+	for i, weight := range []float64{30000, 29000, 28000, 26000, 25000} {
+		_ = store.AddMeasurement(Measurement{Weight: weight, At: friday.Add(time.Duration(i) * 80 * time.Minute)})
+	}
+	_ = store.AddMeasurement(Measurement{Weight: 25000, At: friday.AddDate(0, 0, 1)})
+	_ = store.AddMeasurement(Measurement{Weight: 24500, At: friday.AddDate(0, 0, 1).Add(time.Minute)})
+
+	stats, err := GetDailyStats(store, NewHolidayCalendar(config), 3, 500, config.PubDayStart, now)
+	assert.Nil(t, err)
+	assert.Len(t, stats.Days, 3)
+	assert.Equal(t, "2024-06-01", stats.Busiest.Day)
+	assert.Equal(t, 5.0, stats.Busiest.Liters)
+	assert.Equal(t, 10.0, stats.Busiest.Beers)
+	assert.Equal(t, 0, *stats.Busiest.BusiestHour)
+	assert.Equal(t, 0.5, stats.Days[1].Liters)
+	assert.Equal(t, 0.0, stats.Days[2].Liters)
+}
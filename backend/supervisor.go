@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Worker is a long-running background task
+// it has to call heartbeat regularly and return when ctx is done
+type Worker func(ctx context.Context, heartbeat func())
+
+type workerState struct {
+	name     string
+	timeout  time.Duration
+	worker   Worker
+	cancel   context.CancelFunc
+	lastBeat time.Time
+	done     chan struct{}
+}
+
+// Supervisor runs background workers and restarts them
+// when they stop heartbeating or exit unexpectedly
+// A stuck goroutine can't be killed in Go, so it's abandoned (its context is cancelled)
+// and a fresh instance of the worker is started instead
+type Supervisor struct {
+	mux     sync.Mutex
+	workers map[string]*workerState
+	monitor *Monitor
+	logger  *logrus.Logger
+}
+
+func NewSupervisor(monitor *Monitor, logger *logrus.Logger) *Supervisor {
+	return &Supervisor{
+		mux:     sync.Mutex{},
+		workers: map[string]*workerState{},
+		monitor: monitor,
+		logger:  logger,
+	}
+}
+
+// Go starts the worker under supervision
+// the worker is restarted if it does not heartbeat within the timeout
+func (sv *Supervisor) Go(ctx context.Context, name string, timeout time.Duration, worker Worker) {
+	sv.mux.Lock()
+	defer sv.mux.Unlock()
+
+	ws := &workerState{
+		name:    name,
+		timeout: timeout,
+		worker:  worker,
+	}
+	sv.workers[name] = ws
+	sv.start(ctx, ws)
+}
+
+// Run checks workers periodically until ctx is done
+func (sv *Supervisor) Run(ctx context.Context) {
+	tick := time.NewTicker(5 * time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			sv.logger.Debug("Supervisor stopped")
+			return
+		case <-tick.C:
+			sv.check(ctx)
+		}
+	}
+}
+
+func (sv *Supervisor) check(ctx context.Context) {
+	sv.mux.Lock()
+	defer sv.mux.Unlock()
+
+	for _, ws := range sv.workers {
+		reason := ""
+		select {
+		case <-ws.done:
+			reason = "exited"
+		default:
+			if time.Since(ws.lastBeat) > ws.timeout {
+				reason = fmt.Sprintf("no heartbeat for %s", time.Since(ws.lastBeat).Round(time.Second))
+			}
+		}
+
+		if reason == "" || ctx.Err() != nil {
+			continue
+		}
+
+		sv.logger.WithFields(logrus.Fields{
+			"worker": ws.name,
+			"reason": reason,
+		}).Error("Restarting background worker")
+		sv.monitor.workerRestarts.WithLabelValues(sv.monitor.guard.Labels("scale_worker_restarts_total", ws.name)...).Inc()
+
+		ws.cancel()
+		sv.start(ctx, ws)
+	}
+}
+
+// Wait blocks until all workers have returned after their context was cancelled
+// it gives up after the timeout and returns an error naming the workers still running
+func (sv *Supervisor) Wait(timeout time.Duration) error {
+	sv.mux.Lock()
+	workers := make([]*workerState, 0, len(sv.workers))
+	for _, ws := range sv.workers {
+		workers = append(workers, ws)
+	}
+	sv.mux.Unlock()
+
+	deadline := time.After(timeout)
+	var running []string
+	for _, ws := range workers {
+		sv.mux.Lock()
+		done := ws.done
+		sv.mux.Unlock()
+
+		if running != nil {
+			select {
+			case <-done:
+			default:
+				running = append(running, ws.name)
+			}
+			continue
+		}
+
+		select {
+		case <-done:
+		case <-deadline:
+			running = []string{ws.name}
+		}
+	}
+
+	if len(running) > 0 {
+		sort.Strings(running)
+		return fmt.Errorf("workers did not stop in %s: %s", timeout, strings.Join(running, ", "))
+	}
+
+	return nil
+}
+
+// start runs a new instance of the worker
+// caller has to hold the lock
+func (sv *Supervisor) start(ctx context.Context, ws *workerState) {
+	workerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	ws.cancel = cancel
+	ws.done = done
+	ws.lastBeat = time.Now()
+
+	heartbeat := func() {
+		sv.mux.Lock()
+		defer sv.mux.Unlock()
+
+		// heartbeats of abandoned instances are ignored
+		if ws.done == done {
+			ws.lastBeat = time.Now()
+			sv.monitor.workerHeartbeat.WithLabelValues(sv.monitor.guard.Labels("scale_worker_last_heartbeat", ws.name)...).SetToCurrentTime()
+		}
+	}
+
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				sv.logger.WithField("worker", ws.name).Errorf("Background worker panicked: %v", r)
+			}
+		}()
+
+		ws.worker(workerCtx, heartbeat)
+	}()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervisor_RestartsStuckWorker(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	sv := NewSupervisor(NewMonitor(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var starts atomic.Int32
+	sv.Go(ctx, "stuck", time.Millisecond, func(ctx context.Context, heartbeat func()) {
+		starts.Add(1)
+		<-ctx.Done() // never heartbeats
+	})
+
+	time.Sleep(5 * time.Millisecond)
+	sv.check(ctx)
+
+	assert.Eventually(t, func() bool { return starts.Load() == 2 }, time.Second, time.Millisecond)
+}
+
+func TestSupervisor_RestartsExitedWorker(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	sv := NewSupervisor(NewMonitor(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var starts atomic.Int32
+	sv.Go(ctx, "panicking", time.Hour, func(ctx context.Context, heartbeat func()) {
+		starts.Add(1)
+		panic("boom")
+	})
+
+	assert.Eventually(t, func() bool {
+		sv.check(ctx)
+		return starts.Load() >= 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestSupervisor_Wait(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	sv := NewSupervisor(NewMonitor(), logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stopped := atomic.Bool{}
+	sv.Go(ctx, "polite", time.Hour, func(ctx context.Context, heartbeat func()) {
+		<-ctx.Done()
+		stopped.Store(true)
+	})
+	sv.Go(ctx, "stubborn", time.Hour, func(ctx context.Context, heartbeat func()) {
+		time.Sleep(time.Second) // ignores ctx
+	})
+
+	cancel()
+	err := sv.Wait(50 * time.Millisecond)
+	assert.ErrorContains(t, err, "stubborn")
+	assert.NotContains(t, err.Error(), "polite")
+	assert.True(t, stopped.Load())
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tabs replace chalk marks of the evening. A tab of the person sums their attributed pours
+// since the start of the pub day or since their last settlement, whichever is later.
+
+// Settlement records the tab paid by the person
+type Settlement struct {
+	PersonId string    `json:"person_id"`
+	At       time.Time `json:"at"`
+	Glasses  float64   `json:"glasses"`
+	Amount   float64   `json:"amount"`
+}
+
+// Tab is the unsettled consumption of the person
+type Tab struct {
+	PersonId string    `json:"person_id"`
+	Name     string    `json:"name"`
+	Since    time.Time `json:"since"`
+	Pours    int       `json:"pours"`
+	Glasses  float64   `json:"glasses"`
+	Amount   float64   `json:"amount"` // glasses times [Config.GlassPrice]
+}
+
+// Settle records the payment of the tab
+func (t Tab) Settle(at time.Time) Settlement {
+	return Settlement{PersonId: t.PersonId, At: at, Glasses: t.Glasses, Amount: t.Amount}
+}
+
+// GetTabs returns tabs opened in [since, now) ordered by name, since is the start of the pub day
+func GetTabs(store Storage, config *Config, since, now time.Time) ([]Tab, error) {
+	people, err := store.GetPeople()
+	if err != nil {
+		return nil, fmt.Errorf("could not load people: %w", err)
+	}
+	pours, err := store.GetPours(since, now)
+	if err != nil {
+		return nil, fmt.Errorf("could not load pours: %w", err)
+	}
+	settlements, err := store.GetSettlements(since, now)
+	if err != nil {
+		return nil, fmt.Errorf("could not load settlements: %w", err)
+	}
+
+	return CalcTabs(people, pours, settlements, since, config.GlassPrice), nil
+}
+
+// CalcTabs sums pours per person after their last settlement, people without pours are skipped
+func CalcTabs(people []Person, pours []Pour, settlements []Settlement, since time.Time, price float64) []Tab {
+	tabs := map[string]*Tab{}
+	for _, p := range people {
+		tabs[p.Id] = &Tab{PersonId: p.Id, Name: p.Name, Since: since}
+	}
+	for _, s := range settlements {
+		if tab, found := tabs[s.PersonId]; found && s.At.After(tab.Since) {
+			tab.Since = s.At
+		}
+	}
+
+	for _, pour := range pours {
+		tab, found := tabs[pour.Person]
+		if !found || !pour.At.After(tab.Since) {
+			continue
+		}
+		tab.Pours++
+		tab.Glasses += pour.Glasses
+	}
+
+	res := []Tab{}
+	for _, tab := range tabs {
+		if tab.Pours == 0 {
+			continue
+		}
+		tab.Glasses = math.Round(tab.Glasses*100) / 100
+		tab.Amount = math.Round(tab.Glasses*price*100) / 100
+		res = append(res, *tab)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].PersonId < res[j].PersonId
+	})
+
+	return res
+}
+
+// FormatTabsSummary returns the end-of-night summary of open tabs
+func FormatTabsSummary(tabs []Tab, price float64) string {
+	lines := []string{"🧾 Open tabs of the night:"}
+	for _, tab := range tabs {
+		line := fmt.Sprintf("%s: %g glasses", tab.Name, tab.Glasses)
+		if price > 0 {
+			line += fmt.Sprintf(" (%g)", tab.Amount)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
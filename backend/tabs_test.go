@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalcTabs(t *testing.T) {
+	since := time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC)
+	people := []Person{{Id: "a", Name: "Anna"}, {Id: "b", Name: "Bob"}, {Id: "c", Name: "Cyril"}}
+	pours := []Pour{
+		{At: since.Add(12 * time.Hour), Glasses: 1, Person: "a"},
+		{At: since.Add(13 * time.Hour), Glasses: 1.02, Person: "b"},
+		{At: since.Add(14 * time.Hour), Glasses: 0.98, Person: "b"},
+		{At: since.Add(15 * time.Hour), Glasses: 1, Person: "a"},
+		{At: since.Add(15 * time.Hour), Glasses: 1},
+	}
+	settlements := []Settlement{{PersonId: "a", At: since.Add(14 * time.Hour), Glasses: 1}}
+
+	tabs := CalcTabs(people, pours, settlements, since, 45)
+	assert.Equal(t, []Tab{
+		{PersonId: "a", Name: "Anna", Since: since.Add(14 * time.Hour), Pours: 1, Glasses: 1, Amount: 45},
+		{PersonId: "b", Name: "Bob", Since: since, Pours: 2, Glasses: 2, Amount: 90},
+	}, tabs)
+
+	assert.Equal(t, "🧾 Open tabs of the night:\nAnna: 1 glasses (45)\nBob: 2 glasses (90)", FormatTabsSummary(tabs, 45))
+	assert.Equal(t, "🧾 Open tabs of the night:\nAnna: 1 glasses", FormatTabsSummary(tabs[:1], 0))
+}
+
+type recordingChannel struct {
+	messages []string
+}
+
+func (c *recordingChannel) Name() string {
+	return "recording"
+}
+
+func (c *recordingChannel) Send(_ context.Context, text string) error {
+	c.messages = append(c.messages, text)
+	return nil
+}
+
+func TestNotifier_TabsSummary(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	channel := &recordingChannel{}
+	n := NewNotifier(s.config, s, s.monitor, logrus.New())
+	n.channels = []NotifyChannel{channel}
+
+	now := time.Now()
+	closed := Event{Type: OfflineEventType, At: now, Data: OfflineEvent{LastOk: now.Add(-OkLimit)}}
+	n.Handle(context.Background(), closed)
+	assert.Len(t, channel.messages, 1, "no tabs, no summary")
+
+	assert.Nil(t, s.store.SavePerson(Person{Id: "a", Name: "Anna"}))
+	assert.Nil(t, s.store.AddPour(Pour{At: now.Add(-OkLimit - time.Second), Glasses: 1, Person: "a"}))
+	n.config.NotifyCooldown = 0
+	n.Handle(context.Background(), closed)
+	assert.Len(t, channel.messages, 3)
+	assert.Contains(t, channel.messages[2], "Anna: 1 glasses")
+}
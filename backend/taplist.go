@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// TapBeer is what the admin announces on the tap, shown by the taplist widget on the website of the pub
+type TapBeer struct {
+	Name      string    `json:"name"`
+	Brewery   string    `json:"brewery"`
+	Style     string    `json:"style"` // e.g. Czech pale lager
+	Abv       float64   `json:"abv"`   // alcohol by volume in percent
+	Price     float64   `json:"price"` // price of a glass, 0 uses [Config.GlassPrice]
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Validate checks the beer can be published
+func (b TapBeer) Validate() error {
+	if b.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(b.Name) > 100 || len(b.Brewery) > 100 || len(b.Style) > 100 {
+		return fmt.Errorf("name, brewery and style must have at most 100 characters")
+	}
+	if b.Abv < 0 || b.Abv > 100 {
+		return fmt.Errorf("abv must be between 0 and 100")
+	}
+	if b.Price < 0 {
+		return fmt.Errorf("price must not be negative")
+	}
+
+	return nil
+}
+
+// TapListEntry is a single tap of the public taplist
+type TapListEntry struct {
+	Device    string   `json:"device"`   // empty for the default scale
+	Beer      *TapBeer `json:"beer"`     // nil if nothing is announced and no keg is tapped
+	KegSize   int      `json:"keg_size"` // liters, 0 if no keg is tapped
+	BeersLeft int      `json:"beers_left"`
+	IsLow     bool     `json:"is_low"`
+	PubIsOpen bool     `json:"pub_is_open"`
+}
+
+// SetTapBeer announces the beer on the tap, nil removes the announcement
+func (s *Scale) SetTapBeer(beer *TapBeer) error {
+	stored := TapBeer{}
+	if beer != nil {
+		stored = *beer
+	}
+	if err := s.store.SetTapBeer(stored); err != nil {
+		return fmt.Errorf("could not store tap beer: %w", err)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.TapBeer = beer
+	return nil
+}
+
+// TapListEntry returns the tap with the live state of the keg
+// the name of the tapped keg is used when the admin announced nothing
+func (s *Scale) TapListEntry() TapListEntry {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entry := TapListEntry{
+		KegSize:   s.ActiveKeg,
+		BeersLeft: s.BeersLeft,
+		IsLow:     s.IsLow,
+		PubIsOpen: s.Pub.IsOpen,
+	}
+
+	if s.TapBeer != nil {
+		beer := *s.TapBeer
+		entry.Beer = &beer
+	} else if s.KegInfo.Beer != "" {
+		entry.Beer = &TapBeer{Name: s.KegInfo.Beer}
+	}
+	if entry.Beer != nil && entry.Beer.Price == 0 {
+		entry.Beer.Price = s.config.GlassPrice
+	}
+
+	return entry
+}
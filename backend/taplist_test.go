@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerRepository_Taplist(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	s.config.GlassPrice = 50
+	assert.Nil(t, s.SetActiveKeg(15, "Pilsner"))
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+
+	call := func(method, body, auth string) (int, []TapListEntry) {
+		r := httptest.NewRequest(method, "/api/taplist", strings.NewReader(body))
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		hr.taplistHandler()(w, r)
+
+		var taplist []TapListEntry
+		if w.Code == http.StatusOK {
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &taplist))
+		}
+		return w.Code, taplist
+	}
+
+	code, taplist := call(http.MethodGet, "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, taplist, 1)
+	assert.Equal(t, &TapBeer{Name: "Pilsner", Price: 50}, taplist[0].Beer, "beer of the tapped keg")
+	assert.Equal(t, 15, taplist[0].KegSize)
+	assert.Equal(t, s.BeersLeft, taplist[0].BeersLeft)
+
+	beer := `{"name": "Pilsner Urquell", "brewery": "Plzeňský Prazdroj", "style": "Czech pale lager", "abv": 4.4, "price": 65}`
+	code, _ = call(http.MethodPost, beer, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = call(http.MethodPost, `{"abv": 4.4}`, "test")
+	assert.Equal(t, http.StatusBadRequest, code, "name is required")
+
+	code, taplist = call(http.MethodPost, beer, "test")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Pilsner Urquell", taplist[0].Beer.Name)
+	assert.Equal(t, 4.4, taplist[0].Beer.Abv)
+	assert.Equal(t, 65.0, taplist[0].Beer.Price)
+	assert.False(t, taplist[0].Beer.UpdatedAt.IsZero())
+
+	// the announcement survives the restart
+	restarted := NewScale(s.config, NewMonitor(), s.store, s.logger)
+	assert.Equal(t, "Pilsner Urquell", restarted.TapListEntry().Beer.Name)
+
+	code, taplist = call(http.MethodDelete, "", "test")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, &TapBeer{Name: "Pilsner", Price: 50}, taplist[0].Beer)
+}
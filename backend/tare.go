@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+const tareShiftHistoryLength = 20 // number of resolved tare shifts kept for diagnostics
+
+// how the tare shift was resolved
+const (
+	TareShiftRecalibrated = "recalibrated"
+	TareShiftDismissed    = "dismissed"
+)
+
+var (
+	errNoTareShift         = errors.New("no tare shift was detected")
+	errNotServerCalibrated = errors.New("scale is not calibrated by the server, tare the device instead")
+)
+
+// TareShift is a zero drift of the load cell, the scale measures negative weights which can't exist
+// the measurements are not processed, so they are recorded here for diagnostics
+type TareShift struct {
+	Since      time.Time    `json:"since"`       // the first negative measurement
+	At         time.Time    `json:"at"`          // the last negative measurement
+	Weight     float64      `json:"weight"`      // the last negative weight in grams
+	Lowest     float64      `json:"lowest"`      // the lowest weight measured during the shift
+	Count      int          `json:"count"`       // number of negative measurements
+	Suggested  *Calibration `json:"suggested"`   // calibration moved by the last weight, nil if the device converts raw counts itself
+	ResolvedAt time.Time    `json:"resolved_at"` // zero while the shift is active
+	Resolution string       `json:"resolution"`  // recalibrated or dismissed
+}
+
+// Shifted returns the calibration converting raw counts to grams more
+// e.g. the calibration measuring -300 grams shifted by -300 measures 0 for the same raw counts
+func (c Calibration) Shifted(grams float64) Calibration {
+	shifted := c
+	if len(c.Points) >= 2 {
+		shifted.Points = make([]CalibrationPoint, len(c.Points))
+		for i, p := range c.Points {
+			shifted.Points[i] = CalibrationPoint{Raw: p.Raw, Grams: p.Grams - grams}
+		}
+		return shifted
+	}
+
+	shifted.Offset = c.Offset + grams*c.Factor
+	return shifted
+}
+
+// recordTareShift records a negative weight instead of dropping it as an invalid one
+// the first one publishes the tare shift alert asking the admin to recalibrate the scale,
+// the suggested calibration follows the last weight, so it zeroes the current reading
+// caller has to hold the lock
+func (s *Scale) recordTareShift(weight float64, at time.Time) {
+	if s.TareShift == nil {
+		s.TareShift = &TareShift{Since: at, Lowest: weight}
+		s.monitor.tareShift.WithLabelValues().Set(1)
+		defer func() {
+			s.logger.Warnf("Tare of the scale shifted, it measures %.0f grams", weight)
+			s.events.Publish(TareShiftEventType, *s.TareShift)
+		}()
+	}
+
+	shift := s.TareShift
+	shift.At = at
+	shift.Weight = weight
+	shift.Lowest = min(shift.Lowest, weight)
+	shift.Count++
+	shift.Suggested = nil
+	if s.Calibration != nil {
+		suggested := s.Calibration.Shifted(weight)
+		shift.Suggested = &suggested
+	}
+}
+
+// resolveTareShift moves the active tare shift to the history
+// caller has to hold the lock
+func (s *Scale) resolveTareShift(resolution string, now time.Time) {
+	if s.TareShift == nil {
+		return
+	}
+
+	shift := *s.TareShift
+	shift.ResolvedAt = now
+	shift.Resolution = resolution
+	s.tareShifts = append([]TareShift{shift}, s.tareShifts...)
+	if len(s.tareShifts) > tareShiftHistoryLength {
+		s.tareShifts = s.tareShifts[:tareShiftHistoryLength]
+	}
+
+	s.TareShift = nil
+	s.monitor.tareShift.WithLabelValues().Set(0)
+	s.logger.Infof("Tare shift resolved: %s", resolution)
+}
+
+// TareShifts returns the active tare shift (nil if there is none) and resolved ones, newest first
+func (s *Scale) TareShifts() (*TareShift, []TareShift) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var active *TareShift
+	if s.TareShift != nil {
+		shift := *s.TareShift
+		active = &shift
+	}
+
+	return active, append([]TareShift{}, s.tareShifts...)
+}
+
+// ApplyTareShift recalibrates the scale with the suggested calibration of the active tare shift
+func (s *Scale) ApplyTareShift() error {
+	s.mux.Lock()
+	shift := s.TareShift
+	var suggested *Calibration
+	if shift != nil {
+		suggested = shift.Suggested
+	}
+	s.mux.Unlock()
+
+	if shift == nil {
+		return errNoTareShift
+	}
+	if suggested == nil {
+		return errNotServerCalibrated
+	}
+
+	return s.SetCalibration(*suggested)
+}
+
+// DismissTareShift resolves the active tare shift without recalibration, e.g. the platform was lifted
+func (s *Scale) DismissTareShift(now time.Time) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.TareShift == nil {
+		return errNoTareShift
+	}
+
+	s.resolveTareShift(TareShiftDismissed, now)
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalibration_Shifted(t *testing.T) {
+	linear := Calibration{Offset: 8388608, Factor: 21.5}
+	assert.Equal(t, -300.0, linear.Convert(8382158))
+	assert.Equal(t, 0.0, linear.Shifted(-300).Convert(8382158))
+	assert.Equal(t, 8388608.0, linear.Offset, "the original is not changed")
+
+	curve := Calibration{Points: []CalibrationPoint{{Raw: 8388608, Grams: 0}, {Raw: 8603608, Grams: 10000}}}
+	shifted := curve.Shifted(-200)
+	assert.Equal(t, 200.0, shifted.Convert(8388608))
+	assert.Equal(t, 10200.0, shifted.Convert(8603608))
+	assert.Equal(t, 0.0, curve.Points[0].Grams, "the original is not changed")
+}
+
+func TestScale_TareShift(t *testing.T) {
+	s := CreateScaleWithMeasurements(22) // full 15l keg
+	events := s.events.Subscribe()
+	defer s.events.Unsubscribe(events)
+
+	tareShifts := func() []TareShift {
+		var found []TareShift
+		for len(events) > 0 {
+			if event := <-events; event.Type == TareShiftEventType {
+				found = append(found, event.Data.(TareShift))
+			}
+		}
+		return found
+	}
+	measure := func(weight float64, at time.Time) {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		assert.Nil(t, s.addMeasurement(weight, at, SourceHttp, Sensors{}))
+	}
+
+	start := time.Now()
+	measure(-20, start)
+	assert.Empty(t, tareShifts(), "noise of the load cell")
+	assert.False(t, s.Status().TareShift)
+
+	measure(-300, start.Add(time.Minute))
+	measure(-350, start.Add(2*time.Minute))
+	alerts := tareShifts()
+	assert.Len(t, alerts, 1, "once until resolved")
+	assert.Equal(t, -300.0, alerts[0].Weight)
+	assert.True(t, s.Status().TareShift)
+	assert.Equal(t, 1.0, gaugeValue(t, s.monitor, "scale_tare_shift"))
+	assert.Equal(t, 22000.0, s.Weight, "negative weights are not processed")
+
+	active, history := s.TareShifts()
+	assert.Equal(t, start.Add(time.Minute), active.Since)
+	assert.Equal(t, -350.0, active.Lowest)
+	assert.Equal(t, 2, active.Count)
+	assert.Nil(t, active.Suggested, "the device converts raw counts")
+	assert.Empty(t, history)
+	assert.ErrorIs(t, s.ApplyTareShift(), errNotServerCalibrated)
+
+	assert.Nil(t, s.DismissTareShift(start.Add(3*time.Minute)))
+	assert.False(t, s.Status().TareShift)
+	assert.Equal(t, 0.0, gaugeValue(t, s.monitor, "scale_tare_shift"))
+	assert.ErrorIs(t, s.DismissTareShift(start), errNoTareShift)
+
+	// the server converts raw counts, the suggested calibration zeroes the reading
+	assert.Nil(t, s.SetCalibration(Calibration{Offset: 8388608, Factor: 21.5}))
+	measure(-300, start.Add(4*time.Minute))
+	active, _ = s.TareShifts()
+	assert.Equal(t, 0.0, active.Suggested.Convert(8382158))
+
+	assert.Nil(t, s.ApplyTareShift())
+	calibration, _, _ := s.GetCalibration()
+	assert.Equal(t, 0.0, calibration.Convert(8382158))
+
+	active, history = s.TareShifts()
+	assert.Nil(t, active)
+	assert.Len(t, history, 2)
+	assert.Equal(t, TareShiftRecalibrated, history[0].Resolution)
+	assert.Equal(t, TareShiftDismissed, history[1].Resolution)
+}
+
+func TestHandlerRepository_TareShift(t *testing.T) {
+	s := CreateScaleWithMeasurements(22)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+
+	request := func(method string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/scale/tare-shift", nil)
+		r.Header.Set("Authorization", "test")
+		w := httptest.NewRecorder()
+		hr.tareShiftHandler()(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, request(http.MethodDelete).Code)
+	assert.Nil(t, s.AddMeasurement(-500, SourceHttp))
+	assert.Equal(t, http.StatusConflict, request(http.MethodPost).Code)
+
+	w := request(http.MethodGet)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var data struct {
+		Active  *TareShift  `json:"active"`
+		History []TareShift `json:"history"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &data))
+	assert.Equal(t, -500.0, data.Active.Weight)
+	assert.Empty(t, data.History)
+
+	w = request(http.MethodDelete)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &data))
+	assert.Nil(t, data.Active)
+	assert.Len(t, data.History, 1)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// pubRootPaths are served outside of /api by the default pub, a hosted pub serves them under /api/{pub} too
+var pubRootPaths = []string{"/ws", "/ws/admin", "/metrics", "/metrics/public", "/status", "/healthz", "/readyz"}
+
+// pubEnvKey returns the variable overriding the key for the pub, e.g. PUB_U_KOHOUTA_AUTH_TOKEN
+func pubEnvKey(pub, key string) string {
+	return "PUB_" + strings.ToUpper(strings.ReplaceAll(pub, "-", "_")) + "_" + key
+}
+
+// pubFilePath returns the file of the pub next to the shared one, scale.db => scale-pub.db
+func pubFilePath(path, pub string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + pub + ext
+}
+
+// newPubConfig creates configuration of the hosted pub, see [Config.PubConfigs]
+// every variable can be overridden by PUB_<NAME>_<KEY> (dashes of the name are underscores), the shared one is used otherwise
+// credentials are never shared: the pub has to set its own AUTH_TOKEN and PASSWORD, API_TOKENS, SCALE_SECRETS
+// and PUBLIC_TOKENS of the default pub are not accepted by it
+// storage and files are separated unless overridden: redis keys get the pub prefix, sqlite, WAL and capture files
+// the pub suffix and exports a subdirectory, postgres needs its own STORAGE_DSN (e.g. with search_path of the pub schema)
+func newPubConfig(pub string) *Config {
+	env := &configEnv{pub: pub}
+	config := newConfig(env)
+	config.Pub = pub
+	config.Pubs = nil
+
+	if !env.overridden["AUTH_TOKEN"] {
+		config.AuthToken = ""
+	}
+	if !env.overridden["PASSWORD"] {
+		config.Password = ""
+	}
+	if !env.overridden["API_TOKENS"] {
+		config.ApiTokens = map[string]ApiToken{}
+	}
+	if !env.overridden["SCALE_SECRETS"] {
+		config.ScaleSecrets = map[string]string{}
+	}
+	if !env.overridden["PUBLIC_TOKENS"] {
+		config.PublicTokens = map[string]string{}
+	}
+
+	if !env.overridden["REDIS_PREFIX"] {
+		config.RedisPrefix += pub + ":"
+	}
+	if !env.overridden["STORAGE_DSN"] {
+		switch config.StorageDriver {
+		case "sqlite":
+			config.StorageDsn = pubFilePath(config.StorageDsn, pub)
+		case "postgres":
+			config.StorageDsn = "" // pubs must not share the schema
+		}
+	}
+	if config.WalPath != "" && !env.overridden["WAL_PATH"] {
+		config.WalPath = pubFilePath(config.WalPath, pub)
+	}
+	if config.CapturePath != "" && !env.overridden["CAPTURE_PATH"] {
+		config.CapturePath = pubFilePath(config.CapturePath, pub)
+	}
+	if config.ExportPath != "" && !env.overridden["EXPORT_PATH"] {
+		config.ExportPath = filepath.Join(config.ExportPath, pub)
+	}
+
+	return config
+}
+
+// Tenant is the backend of a single pub: its storage, scales, workers and API
+// the default tenant serves single-pub deployments, more pubs are hosted by [Config.Pubs]
+type Tenant struct {
+	config *Config
+	scales *ScaleRegistry
+	wal    *WalStore
+	hr     *HandlerRepository
+	logger *logrus.Logger
+}
+
+// StartTenant opens the storage of the pub, creates its scales and starts its workers by the supervisor
+// workers of a hosted pub are named by the pub, e.g. u-kohouta/recheck
+func StartTenant(ctx context.Context, config *Config, monitor *Monitor, supervisor *Supervisor, logger *logrus.Logger) (*Tenant, error) {
+	worker := func(name string) string {
+		if config.Pub == "" {
+			return name
+		}
+		return config.Pub + "/" + name
+	}
+
+	if config.StorageDriver == "memory" {
+		logger.Warn("Using in-memory storage, data will be lost on restart")
+	}
+	store, err := openStorage(config, config.StorageDriver, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s storage: %w", config.StorageDriver, err)
+	}
+	// additional scales share the connection, the write ahead log and injected failures cover the default scale only
+	deviceStore := store
+	store = wrapChaos(store, logger)
+	var wal *WalStore
+	if config.WalPath != "" {
+		wal = NewWalStore(store, config.WalPath, monitor, logger)
+		store = wal
+	}
+
+	if backfill := NewBackfill(config, store, logger); backfill.Enabled() {
+		go func() {
+			if _, err := backfill.Run(ctx, time.Now()); err != nil {
+				logger.Errorf("Backfill from Prometheus failed: %v", err)
+			}
+		}()
+	}
+
+	scale := NewScale(config, monitor, store, logger)
+	scales := NewScaleRegistry(scale)
+	if err := scales.AddDevices(config, monitor, deviceStore, logger); err != nil {
+		return nil, fmt.Errorf("could not create scales: %w", err)
+	}
+	exporter := NewExporter(config, store, logger)
+	mirror := NewMirror(config, monitor, logger)
+	sheets := NewSheets(config, store, monitor, logger)
+	selfCheck := NewSelfChecker(config, store, monitor, exporter, logger)
+	notifier := NewNotifier(config, scale, monitor, logger)
+	community := NewCommunity(config, store, monitor, logger)
+	closingSoon := NewClosingSoonWebhook(config, scale, monitor, logger)
+	retention := NewRetention(config, scales, monitor, logger)
+	webhooks := NewWebhooks(config, scales, monitor, logger)
+
+	for _, device := range scales.Devices() {
+		name := "recheck"
+		if device != "" {
+			name += ":" + device
+		}
+		s, _ := scales.Get(device)
+		supervisor.Go(ctx, worker(name), 2*recheckMaxSleep, s.RunRecheck)
+	}
+	supervisor.Go(ctx, worker("archiver"), 5*time.Minute, exporter.Run)
+	supervisor.Go(ctx, worker("mirror"), 5*time.Minute, mirror.Run)
+	supervisor.Go(ctx, worker("sheets"), 5*time.Minute, sheets.Run)
+	supervisor.Go(ctx, worker("selfcheck"), 5*time.Minute, selfCheck.Run)
+	if wal != nil {
+		supervisor.Go(ctx, worker("wal"), time.Minute, wal.Run)
+	}
+	if notifier.Enabled() {
+		supervisor.Go(ctx, worker("notifier"), 5*time.Minute, notifier.Run)
+	}
+	if community.Enabled() {
+		supervisor.Go(ctx, worker("community"), 5*time.Minute, community.Run)
+	}
+	if closingSoon.Enabled() {
+		supervisor.Go(ctx, worker("closing_soon"), 5*time.Minute, closingSoon.Run)
+	}
+	if retention.Enabled() {
+		supervisor.Go(ctx, worker("retention"), 5*time.Minute, retention.Run)
+	}
+	if webhooks.Enabled() {
+		supervisor.Go(ctx, worker("webhooks"), 5*time.Minute, webhooks.Run)
+	}
+
+	hr := &HandlerRepository{
+		scale:     scale,
+		scales:    scales,
+		config:    config,
+		monitor:   monitor,
+		exporter:  exporter,
+		mirror:    mirror,
+		capture:   NewCapture(config),
+		holidays:  NewHolidayCalendar(config),
+		selfCheck: selfCheck,
+		retention: retention,
+		community: community,
+		wal:       wal,
+		firmware:  NewFirmwareRegistry(config, scale.store),
+		sequence:  restoreSequence(scales),
+		replays:   NewSignatureReplays(),
+		sources:   NewSourcePolicy(config.SourcePreference, config.SourceFailover),
+		logger:    logger,
+
+		publicLimiter: NewRateLimiter(config.PublicRateLimit, time.Minute),
+		ratingLimiter: NewRateLimiter(config.RatingRateLimit, time.Hour),
+	}
+	if config.IngestRateLimit > 0 {
+		hr.ingestLimiter = NewRateLimiter(config.IngestRateLimit, time.Minute)
+	}
+	if config.IngestDeviceRateLimit > 0 {
+		hr.deviceLimiter = NewRateLimiter(config.IngestDeviceRateLimit, time.Minute)
+	}
+
+	if config.MqttBroker != "" {
+		mqtt := NewMqttSubscriber(config, func(message string) error {
+			_, err := hr.ingestMessage(message, SourceMqtt)
+			return err
+		}, logger)
+		supervisor.Go(ctx, worker("mqtt"), 5*time.Minute, mqtt.Run)
+	}
+
+	simulator := NewSimulator(config, func(message string) error {
+		_, err := hr.ingestMessage(message, SourceSimulator)
+		return err
+	}, time.Now().UnixNano(), logger)
+	if simulator.Enabled() {
+		logger.Warn("Simulated scale feeds the default scale, its measurements are stored like real ones")
+		supervisor.Go(ctx, worker("simulator"), max(5*time.Minute, 2*config.SimulateInterval), simulator.Run)
+	}
+
+	return &Tenant{config: config, scales: scales, wal: wal, hr: hr, logger: logger}, nil
+}
+
+// Flush stores state of all scales and drains the write ahead log, workers have to be stopped already
+func (t *Tenant) Flush() {
+	for _, device := range t.scales.Devices() {
+		s, _ := t.scales.Get(device)
+		if err := s.Flush(); err != nil {
+			t.logger.Errorf("Could not flush state of the scale %q of the pub %q to the storage: %v", device, t.config.Pub, err)
+		}
+	}
+	if t.wal != nil {
+		if err := t.wal.Drain(); err != nil {
+			t.logger.Warnf("Write ahead log of the pub %q was not drained, it will be applied on the next start: %v", t.config.Pub, err)
+		}
+	}
+}
+
+// TenantRegistry holds pubs hosted next to the default one keyed by the name of the pub
+type TenantRegistry struct {
+	tenants map[string]*Tenant
+	routers map[string]http.Handler
+}
+
+func NewTenantRegistry() *TenantRegistry {
+	return &TenantRegistry{tenants: map[string]*Tenant{}, routers: map[string]http.Handler{}}
+}
+
+// Add registers the hosted pub, its API is served by its own router
+func (tr *TenantRegistry) Add(tenant *Tenant) {
+	tr.tenants[tenant.config.Pub] = tenant
+	tr.routers[tenant.config.Pub] = NewRouter(tenant.hr)
+}
+
+// Get returns the hosted pub
+func (tr *TenantRegistry) Get(name string) (*Tenant, bool) {
+	tenant, found := tr.tenants[name]
+	return tenant, found
+}
+
+// Names returns names of the hosted pubs ordered
+func (tr *TenantRegistry) Names() []string {
+	names := make([]string, 0, len(tr.tenants))
+	for name := range tr.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Gatherer gathers metrics of all hosted pubs, their series carry the pub label
+func (tr *TenantRegistry) Gatherer() prometheus.Gatherer {
+	gatherers := prometheus.Gatherers{}
+	for _, name := range tr.Names() {
+		gatherers = append(gatherers, tr.tenants[name].scales.Gatherer())
+	}
+
+	return gatherers
+}
+
+// CheckRoutes returns an error if a pub shadows a route of the default router, e.g. a pub named scale
+func (tr *TenantRegistry) CheckRoutes(router *mux.Router) error {
+	return router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // prefix or matcher routes
+		}
+		segment, _, _ := strings.Cut(strings.TrimPrefix(template, "/api/"), "/")
+		if _, found := tr.tenants[segment]; found && strings.HasPrefix(template, "/api/") {
+			return fmt.Errorf("pub %q collides with the route %s, rename the pub", segment, template)
+		}
+		return nil
+	})
+}
+
+// Handler serves hosted pubs under /api/{pub}/, /api/{pub}/kegs is /api/kegs of the pub
+// root paths like /ws are served as /api/{pub}/ws, other requests are served by the default router
+func (tr *TenantRegistry) Handler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+		router, found := tr.routers[name]
+		if !found || !strings.HasPrefix(r.URL.Path, "/api/") {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		path := "/api/" + rest
+		if slices.Contains(pubRootPaths, "/"+rest) {
+			path = "/" + rest
+		}
+		pubRequest := r.Clone(r.Context())
+		pubRequest.URL.Path = path
+		pubRequest.URL.RawPath = ""
+		router.ServeHTTP(w, pubRequest)
+	})
+}
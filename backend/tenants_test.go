@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Pubs(t *testing.T) {
+	t.Setenv("STORAGE_DRIVER", "sqlite")
+	t.Setenv("STORAGE_DSN", "/data/scale.db")
+	t.Setenv("REDIS_PREFIX", "prod:")
+	t.Setenv("SCALE_SECRETS", "default=0123456789abcdef")
+	t.Setenv("PUBS", "u-kohouta")
+	t.Setenv("PUB_U_KOHOUTA_AUTH_TOKEN", "kohout-scale")
+	t.Setenv("PUB_U_KOHOUTA_PASSWORD", "kohout-admin")
+	t.Setenv("PUB_U_KOHOUTA_SCALE_SECRETS", "default=fedcba9876543210")
+
+	config := NewConfig()
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, "test", config.Password, "the default pub is not affected")
+	pub := config.PubConfigs["u-kohouta"]
+	assert.Equal(t, "u-kohouta", pub.Pub)
+	assert.Equal(t, "kohout-scale", pub.AuthToken)
+	assert.Equal(t, "kohout-admin", pub.Password)
+	assert.Equal(t, map[string]string{"default": "fedcba9876543210"}, pub.ScaleSecrets)
+	assert.Equal(t, "/data/scale-u-kohouta.db", pub.StorageDsn)
+	assert.Equal(t, "prod:u-kohouta:", pub.RedisPrefix)
+
+	// credentials are never shared
+	t.Setenv("PUBS", "u-kohouta,u-pivovaru")
+	t.Setenv("PUB_U_PIVOVARU_PASSWORD", "kohout-admin")
+	t.Setenv("PUB_U_PIVOVARU_AUTH_TOKEN", "test")
+	err := NewConfig().Validate()
+	assert.ErrorContains(t, err, "PUB_U_PIVOVARU_PASSWORD: must differ from the tokens of the pub u-kohouta")
+	assert.ErrorContains(t, err, "PUB_U_PIVOVARU_AUTH_TOKEN: must differ from the tokens of the default pub")
+	t.Setenv("PUBS", "u-kohouta,u-lipy")
+	assert.ErrorContains(t, NewConfig().Validate(), "pub u-lipy: PUB_U_LIPY_PASSWORD: is required")
+	assert.Empty(t, NewConfig().PubConfigs["u-lipy"].ScaleSecrets, "secrets of the default scale are not accepted")
+
+	t.Setenv("PUBS", "u-kohouta")
+	t.Setenv("STORAGE_DRIVER", "postgres")
+	assert.ErrorContains(t, NewConfig().Validate(), "pub u-kohouta: PUB_U_KOHOUTA_STORAGE_DSN: is required by the postgres driver")
+
+	t.Setenv("PUBS", "u-kohouta,U Kohouta,u-kohouta,default")
+	err = NewConfig().Validate()
+	assert.ErrorContains(t, err, `PUBS: "U Kohouta" is not a valid pub name`)
+	assert.ErrorContains(t, err, `PUBS: "u-kohouta" is listed twice`)
+	assert.ErrorContains(t, err, `DEFAULT_PUB: "default" is not a valid pub name or is listed in PUBS`)
+}
+
+func TestTenantRegistry_Handler(t *testing.T) {
+	newTenant := func(config *Config, monitor *Monitor) *Tenant {
+		logger := logrus.New()
+		logger.SetOutput(io.Discard)
+		s := NewScale(config, monitor, &FakeStore{}, logger)
+		_ = s.AddMeasurement(22000, SourceHttp)
+		scales := NewScaleRegistry(s)
+		hr := &HandlerRepository{scale: s, scales: scales, config: config, monitor: monitor, logger: logger}
+		return &Tenant{config: config, scales: scales, hr: hr, logger: logger}
+	}
+	monitor := NewMonitor().ForPub("default")
+	tenant := newTenant(NewConfig(), monitor)
+	pubConfig := NewConfig()
+	pubConfig.Pub = "u-kohouta"
+	pubConfig.Password = "kohout"
+	pubs := NewTenantRegistry()
+	pubs.Add(newTenant(pubConfig, monitor.ForPub("u-kohouta")))
+	tenant.hr.pubs = pubs
+	handler := pubs.Handler(NewRouter(tenant.hr))
+
+	request := func(method, url, auth string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, nil)
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// tokens of the pub
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/u-kohouta/backup", "kohout").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/api/u-kohouta/backup", "test").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPost, "/api/backup", "kohout").Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/backup", "test").Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "/api/u-pivovaru/scale/status", "").Code, "unknown pub")
+
+	// metrics of the pub carry the label, the default pub exposes all of them
+	pubMetrics := request(http.MethodGet, "/api/u-kohouta/metrics", "").Body.String()
+	assert.Contains(t, pubMetrics, `scale_weight{pub="u-kohouta"} 22000`)
+	assert.NotContains(t, pubMetrics, `pub="default"`)
+	metrics := request(http.MethodGet, "/metrics", "").Body.String()
+	assert.Contains(t, metrics, `scale_weight{pub="u-kohouta"} 22000`)
+	assert.Contains(t, metrics, `scale_weight{pub="default"} 22000`)
+	assert.NotContains(t, metrics, "scale_weight 22000", "every series carries the pub label")
+
+	// a pub must not shadow routes of the default pub
+	assert.Nil(t, pubs.CheckRoutes(NewRouter(tenant.hr)))
+	pubConfig = NewConfig()
+	pubConfig.Pub = "scale"
+	pubs.Add(newTenant(pubConfig, monitor.ForPub("scale")))
+	assert.ErrorContains(t, pubs.CheckRoutes(NewRouter(tenant.hr)), `pub "scale" collides with the route /api/scale/push`)
+}
+
+func TestMonitor_ForPub(t *testing.T) {
+	monitor := NewMonitor().ForPub("u-kohouta").ForDevice("tap2")
+	monitor.weight.WithLabelValues().Set(1000)
+
+	families, err := monitor.Registry.Gather()
+	assert.Nil(t, err)
+	labels := map[string]string{}
+	for _, family := range families {
+		if family.GetName() == "scale_weight" {
+			for _, label := range family.GetMetric()[0].GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+		}
+	}
+	assert.Equal(t, map[string]string{"pub": "u-kohouta", "device": "tap2"}, labels)
+}
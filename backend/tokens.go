@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// TokenScope is what the holder of the API token is allowed to do
+type TokenScope string
+
+const (
+	ScopeAdmin        TokenScope = "admin"         // everything, same as the admin password
+	ScopeDeviceIngest TokenScope = "device-ingest" // data sent by devices (scale, tap reader, weather), same as AUTH_TOKEN
+	ScopeReadOnly     TokenScope = "read-only"     // reads of the API, e.g. the frontend
+)
+
+// ApiToken is a named token with its scope, see API_TOKENS
+type ApiToken struct {
+	Scope TokenScope
+	Token string
+}
+
+// Allows returns true if the scope grants the required one, admin grants everything
+func (ts TokenScope) Allows(required TokenScope) bool {
+	return ts == ScopeAdmin || ts == required
+}
+
+// parseApiTokens parses values in the format scope:token by names
+func parseApiTokens(raw map[string]string) map[string]ApiToken {
+	tokens := make(map[string]ApiToken, len(raw))
+	for name, value := range raw {
+		scope, token, _ := strings.Cut(value, ":")
+		tokens[name] = ApiToken{Scope: TokenScope(strings.TrimSpace(scope)), Token: strings.TrimSpace(token)}
+	}
+
+	return tokens
+}
+
+// TokenScope returns the scope of the token, false for an unknown token
+// the admin password and AUTH_TOKEN of the scale keep working as admin and device-ingest tokens
+func (c *Config) TokenScope(token string) (TokenScope, bool) {
+	if token == "" {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.Password)) == 1 {
+		return ScopeAdmin, true
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.AuthToken)) == 1 {
+		return ScopeDeviceIngest, true
+	}
+	for _, apiToken := range c.ApiTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(apiToken.Token)) == 1 {
+			return apiToken.Scope, true
+		}
+	}
+
+	return "", false
+}
+
+// Allows returns true if the token grants the required scope
+func (c *Config) Allows(token string, required TokenScope) bool {
+	scope, found := c.TokenScope(token)
+	return found && scope.Allows(required)
+}
+
+// readAuthExempt are paths with their own authentication or used by devices
+var readAuthExempt = []string{
+	"/api/public/",
+	"/api/guest/",
+	"/api/taplist", // embedded on the website of the pub
+	"/api/firmware",
+	"/api/scale/shadow",
+	"/api/scale/last-ack",
+}
+
+// readAuth requires a read-only (or admin) token for reads of the API when READ_AUTH is enabled
+// the token is taken from the Authorization header or the token parameter, browsers could not set headers of WebSockets
+func (hr *HandlerRepository) readAuth(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hr.config.ReadAuth || !isProtectedRead(r) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if !hr.config.Allows(token, ScopeReadOnly) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// isProtectedRead returns true for reads of the API guarded by [HandlerRepository.readAuth]
+func isProtectedRead(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") && !strings.HasPrefix(r.URL.Path, "/ws") {
+		return false
+	}
+	for _, prefix := range readAuthExempt {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_TokenScope(t *testing.T) {
+	config := NewConfig()
+	config.Password = "admin-password"
+	config.AuthToken = "scale-token"
+	config.ApiTokens = map[string]ApiToken{
+		"frontend": {Scope: ScopeReadOnly, Token: "frontend-token"},
+		"tap":      {Scope: ScopeDeviceIngest, Token: "tap-token"},
+	}
+
+	scope, found := config.TokenScope("admin-password")
+	assert.True(t, found)
+	assert.Equal(t, ScopeAdmin, scope)
+	scope, _ = config.TokenScope("scale-token")
+	assert.Equal(t, ScopeDeviceIngest, scope)
+	_, found = config.TokenScope("")
+	assert.False(t, found)
+
+	assert.True(t, config.Allows("admin-password", ScopeReadOnly), "admin grants everything")
+	assert.True(t, config.Allows("frontend-token", ScopeReadOnly))
+	assert.False(t, config.Allows("frontend-token", ScopeAdmin))
+	assert.False(t, config.Allows("frontend-token", ScopeDeviceIngest))
+	assert.True(t, config.Allows("tap-token", ScopeDeviceIngest))
+	assert.False(t, config.Allows("tap-token", ScopeReadOnly))
+	assert.False(t, config.Allows("unknown", ScopeReadOnly))
+}
+
+func TestReadAuth(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+	hr.config.ApiTokens = map[string]ApiToken{
+		"frontend": {Scope: ScopeReadOnly, Token: "frontend-token"},
+		"tap":      {Scope: ScopeDeviceIngest, Token: "tap-token"},
+	}
+	handler := hr.readAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(method, target, token string) int {
+		r := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/scale/dashboard", ""), "reads are open by default")
+
+	hr.config.ReadAuth = true
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/scale/dashboard", ""))
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/api/scale/dashboard", "tap-token"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/scale/dashboard", "frontend-token"))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/scale/dashboard", hr.config.Password))
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/ws?token=frontend-token", ""), "browsers could not set headers of WebSockets")
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/ws", ""))
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/pub/active_keg", ""), "writes are checked by handlers")
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/public/status", ""), "own authentication")
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/api/firmware", ""), "used by the scale")
+	assert.Equal(t, http.StatusOK, request(http.MethodGet, "/", ""), "frontend")
+}
+
+func TestScopedHandlers(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+	hr.config.ApiTokens = map[string]ApiToken{
+		"frontend": {Scope: ScopeReadOnly, Token: "frontend-token"},
+		"tap":      {Scope: ScopeDeviceIngest, Token: "tap-token"},
+		"ops":      {Scope: ScopeAdmin, Token: "ops-token"},
+	}
+
+	cleaning := func(token string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/pub/cleaning", nil)
+		r.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		hr.cleaningHandler()(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, cleaning("frontend-token"))
+	assert.Equal(t, http.StatusUnauthorized, cleaning("tap-token"))
+	assert.NotEqual(t, http.StatusUnauthorized, cleaning("ops-token"))
+
+	tap := func(token string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/pub/tap", nil)
+		r.Header.Set("Authorization", token)
+		w := httptest.NewRecorder()
+		hr.tapHandler()(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, tap("frontend-token"))
+	assert.NotEqual(t, http.StatusUnauthorized, tap("tap-token"))
+}
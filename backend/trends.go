@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxTrendMonths limits the trend report, the history is read day by day
+const maxTrendMonths = 120
+
+// TrendPeriod aggregates kegs and consumption of a month or a year
+type TrendPeriod struct {
+	Period       string  `json:"period"`       // YYYY-MM or YYYY
+	Kegs         int     `json:"kegs"`         // finished kegs tapped within the period
+	AvgKegDays   float64 `json:"avg_keg_days"` // average time on tap of the finished kegs
+	AvgKegSize   float64 `json:"avg_keg_size"` // liters, the lifetime depends on the size
+	Liters       float64 `json:"liters"`
+	WeeklyLiters float64 `json:"weekly_liters"` // average consumption per week of the period
+
+	// percent against the same period a year before, nil if it's not in the report or has no data
+	KegDaysChange      *float64 `json:"keg_days_change,omitempty"`
+	WeeklyLitersChange *float64 `json:"weekly_liters_change,omitempty"`
+
+	days    float64 // length of the period, the current one is counted until now
+	kegDays float64 // sum of lifetimes of the kegs
+	kegSize int     // sum of sizes of the kegs
+}
+
+// Trends compares keg lifetime and consumption across months and years
+// e.g. for the yearly planning with the brewery
+type Trends struct {
+	Months []TrendPeriod `json:"months"`
+	Years  []TrendPeriod `json:"years"`
+}
+
+// GetTrends returns trends of the last months (including the current one)
+// months start at [Config.PubDayStart] of the first day, so they match daily stats
+func GetTrends(store Storage, months int, dayStart int, now time.Time) (Trends, error) {
+	kegs, err := store.GetKegs()
+	if err != nil {
+		return Trends{}, fmt.Errorf("could not load kegs: %w", err)
+	}
+
+	current := pubDayStart(now, dayStart)
+	current = time.Date(current.Year(), current.Month(), 1, dayStart, 0, 0, 0, getTz())
+
+	trends := Trends{Months: []TrendPeriod{}, Years: []TrendPeriod{}}
+	for i := months - 1; i >= 0; i-- {
+		from := current.AddDate(0, -i, 0)
+		to := from.AddDate(0, 1, 0)
+		if to.After(now) {
+			to = now
+		}
+
+		period := TrendPeriod{Period: from.Format("2006-01"), days: to.Sub(from).Hours() / 24}
+		for _, keg := range kegs {
+			if keg.FinishedAt.IsZero() || keg.TappedAt.Before(from) || !keg.TappedAt.Before(to) {
+				continue
+			}
+			period.Kegs++
+			period.kegDays += keg.OnTap(keg.FinishedAt).Hours() / 24
+			period.kegSize += keg.Size
+		}
+
+		err := forEachDay(from, to, func(dayFrom, dayTo time.Time) error {
+			measurements, err := store.GetMeasurements(dayFrom, dayTo)
+			if err != nil {
+				return err
+			}
+			period.Liters += CalcDailySummary(dayFrom, measurements, 0).Liters
+			return nil
+		})
+		if err != nil {
+			return Trends{}, fmt.Errorf("could not load measurements: %w", err)
+		}
+
+		trends.Months = append(trends.Months, period)
+	}
+
+	for _, month := range trends.Months {
+		year := month.Period[:4]
+		if len(trends.Years) == 0 || trends.Years[len(trends.Years)-1].Period != year {
+			trends.Years = append(trends.Years, TrendPeriod{Period: year})
+		}
+		total := &trends.Years[len(trends.Years)-1]
+		total.Kegs += month.Kegs
+		total.kegDays += month.kegDays
+		total.kegSize += month.kegSize
+		total.Liters += month.Liters
+		total.days += month.days
+	}
+
+	finishTrendPeriods(trends.Months, 12)
+	finishTrendPeriods(trends.Years, 1)
+	return trends, nil
+}
+
+// finishTrendPeriods calculates averages and changes against the period the given number of periods before
+func finishTrendPeriods(periods []TrendPeriod, yearAgo int) {
+	for i := range periods {
+		p := &periods[i]
+		if p.Kegs > 0 {
+			p.AvgKegDays = math.Round(p.kegDays/float64(p.Kegs)*10) / 10
+			p.AvgKegSize = math.Round(float64(p.kegSize)/float64(p.Kegs)*10) / 10
+		}
+		if p.days > 0 {
+			p.WeeklyLiters = math.Round(p.Liters/p.days*7*100) / 100
+		}
+		p.Liters = math.Round(p.Liters*100) / 100
+	}
+
+	for i := yearAgo; i < len(periods); i++ {
+		p, before := &periods[i], periods[i-yearAgo]
+		p.KegDaysChange = trendChange(p.AvgKegDays, before.AvgKegDays)
+		p.WeeklyLitersChange = trendChange(p.WeeklyLiters, before.WeeklyLiters)
+	}
+}
+
+// trendChange returns the change in percent, nil without the base
+func trendChange(value, before float64) *float64 {
+	if before == 0 || value == 0 {
+		return nil
+	}
+
+	change := math.Round((value-before)/before*1000) / 10
+	return &change
+}
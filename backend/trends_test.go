@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTrends(t *testing.T) {
+	store := &FakeStore{}
+	now := time.Date(2024, 6, 16, 12, 0, 0, 0, getTz())
+
+	finished := func(tappedAt time.Time, days int) KegInfo {
+		keg := NewKegInfo(50, "Pilsner", tappedAt, 60000)
+		keg.FinishedAt = tappedAt.AddDate(0, 0, days)
+		return keg
+	}
+	assert.Nil(t, store.SaveKeg(finished(time.Date(2023, 6, 2, 18, 0, 0, 0, getTz()), 20)))
+	assert.Nil(t, store.SaveKeg(finished(time.Date(2024, 6, 1, 18, 0, 0, 0, getTz()), 10)))
+	assert.Nil(t, store.SaveKeg(finished(time.Date(2024, 6, 11, 18, 0, 0, 0, getTz()), 4)))
+	assert.Nil(t, store.SaveKeg(NewKegInfo(30, "Weizen", time.Date(2024, 6, 15, 18, 0, 0, 0, getTz()), 40000)), "active keg is not finished")
+
+	// 7 liters during the first week of June 2023, 14 liters until now in June 2024
+	for i, weight := range []float64{50000, 46000, 43000} {
+		assert.Nil(t, store.AddMeasurement(Measurement{Weight: weight, At: time.Date(2023, 6, 3, 18+i, 0, 0, 0, getTz())}))
+	}
+	for i, weight := range []float64{50000, 40000, 36000} {
+		assert.Nil(t, store.AddMeasurement(Measurement{Weight: weight, At: time.Date(2024, 6, 8, 18+i, 0, 0, 0, getTz())}))
+	}
+
+	trends, err := GetTrends(store, 13, 6, now)
+	assert.Nil(t, err)
+	assert.Len(t, trends.Months, 13)
+	assert.Equal(t, []string{"2023", "2024"}, []string{trends.Years[0].Period, trends.Years[1].Period})
+
+	june2023, june2024 := trends.Months[0], trends.Months[12]
+	assert.Equal(t, "2023-06", june2023.Period)
+	assert.Equal(t, 1, june2023.Kegs)
+	assert.Equal(t, 20.0, june2023.AvgKegDays)
+	assert.Equal(t, 7.0, june2023.Liters)
+	assert.Nil(t, june2023.KegDaysChange, "nothing a year before")
+
+	assert.Equal(t, "2024-06", june2024.Period)
+	assert.Equal(t, 2, june2024.Kegs)
+	assert.Equal(t, 7.0, june2024.AvgKegDays)
+	assert.Equal(t, 50.0, june2024.AvgKegSize)
+	assert.Equal(t, 14.0, june2024.Liters)
+	assert.InDelta(t, 14/15.25*7, june2024.WeeklyLiters, 0.01, "the current month is counted until now")
+	assert.Equal(t, -65.0, *june2024.KegDaysChange)
+	assert.NotNil(t, june2024.WeeklyLitersChange)
+
+	assert.Equal(t, 3, trends.Years[0].Kegs+trends.Years[1].Kegs)
+	assert.Equal(t, -65.0, *trends.Years[1].KegDaysChange)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// UntappedKeg is a partially full keg put aside (e.g. over the weekend) to be tapped again later
+type UntappedKeg struct {
+	At              time.Time `json:"at"`
+	Weight          float64   `json:"weight"`           // grams when the keg was untapped
+	RemainingLiters float64   `json:"remaining_liters"` // beer left in the keg
+}
+
+var (
+	errNoActiveKeg    = errors.New("no keg is tapped")
+	errUnknownKeg     = errors.New("unknown keg")
+	errKegNotUntapped = errors.New("keg is not untapped")
+)
+
+// UntapKeg puts the partially full active keg aside, its statistics are resumed by [Scale.RetapKeg]
+// the scale waits for the next keg afterward, the same as before the first keg
+func (s *Scale) UntapKeg(now time.Time) (KegInfo, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.KegInfo.Id == "" {
+		return KegInfo{}, errNoActiveKeg
+	}
+
+	remaining := 0.0
+	if tare, found := s.tare(); found {
+		remaining = math.Round(math.Max(s.Weight-tare, 0)/100) / 10
+	}
+
+	keg := s.KegInfo
+	keg.EndWeight = s.Weight
+	keg.Untapped = &UntappedKeg{At: now, Weight: s.Weight, RemainingLiters: remaining}
+	if err := s.store.SaveKeg(keg); err != nil {
+		return KegInfo{}, fmt.Errorf("could not store untapped keg: %w", err)
+	}
+
+	s.ActiveKeg = 0
+	s.KegInfo = KegInfo{}
+	s.BeersLeft = 0
+	s.IsLow = false
+	s.PendingKeg = nil
+	s.closedWeight = 0 // removing the keg while closed is not a loss
+	if err := errors.Join(
+		s.store.SetActiveKeg(0),
+		s.store.SetKegInfo(KegInfo{}),
+		s.store.SetBeersLeft(0),
+		s.store.SetIsLow(false),
+	); err != nil {
+		return KegInfo{}, fmt.Errorf("could not store untapping: %w", err)
+	}
+
+	s.monitor.RemoveKeg(keg.Id)
+	s.monitor.activeKeg.WithLabelValues().Set(0)
+	s.monitor.beersLeft.WithLabelValues().Set(0)
+	s.setKegEta(nil)
+	s.events.Publish(KegUntapEventType, keg)
+	s.logger.Infof("Keg %s untapped with %.1f l left", keg.Id, remaining)
+
+	return keg, nil
+}
+
+// RetapKeg taps the untapped keg again, its statistics continue where they stopped
+// the active keg is finished as by tapping a new one, e.g. the keg tapped automatically
+// when the untapped one was put back on the scale
+func (s *Scale) RetapKeg(id string, now time.Time) (KegInfo, error) {
+	keg, err := s.store.GetKeg(id)
+	if err != nil {
+		return KegInfo{}, fmt.Errorf("%w: %v", errUnknownKeg, err)
+	}
+	if keg.Untapped == nil || !keg.FinishedAt.IsZero() {
+		return KegInfo{}, errKegNotUntapped
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	previous := s.KegInfo
+	if err := s.returnPendingToWarehouse(); err != nil {
+		return KegInfo{}, err
+	}
+	if err := s.finishKeg(now); err != nil {
+		return KegInfo{}, err
+	}
+
+	keg.PausedHours += now.Sub(keg.Untapped.At).Hours()
+	keg.Untapped = nil
+	keg.EndWeight = s.Weight
+
+	s.ActiveKeg = keg.Size
+	s.KegInfo = keg
+	s.IsLow = false
+	s.PendingKeg = nil
+	s.closedWeight = 0
+	s.pours.SetGlass(s.config.GlassFor(keg.Beer))
+
+	tare, _ := s.tare()
+	s.BeersLeft = CalcBeersLeftFromTare(tare, s.Weight, s.config.GlassFor(keg.Beer))
+	if err := errors.Join(
+		s.store.SetActiveKeg(keg.Size),
+		s.store.SetBeersLeft(s.BeersLeft),
+		s.store.SetIsLow(false),
+		s.saveKegInfo(),
+	); err != nil {
+		return KegInfo{}, fmt.Errorf("could not store retapping: %w", err)
+	}
+
+	s.monitor.SetKegInfo(keg)
+	s.monitor.AddBeers(keg.Id, keg.Beers)
+	s.monitor.activeKeg.WithLabelValues().Set(float64(keg.Size))
+	s.monitor.beersLeft.WithLabelValues().Set(float64(s.BeersLeft))
+	s.updateKegEta(now)
+	s.events.Publish(KegChangeEventType, keg)
+	s.publishChangeover(previous)
+	s.logger.Infof("Keg %s tapped again, untapped for %.1f hours in total", keg.Id, keg.PausedHours)
+
+	return keg, nil
+}
+
+// UntappedKegs returns partially full kegs waiting to be tapped again ordered by tapping time
+func (s *Scale) UntappedKegs() ([]KegInfo, error) {
+	kegs, err := s.store.GetKegs()
+	if err != nil {
+		return nil, fmt.Errorf("could not load kegs: %w", err)
+	}
+
+	untapped := []KegInfo{}
+	for _, keg := range kegs {
+		if keg.Untapped != nil && keg.FinishedAt.IsZero() {
+			untapped = append(untapped, keg)
+		}
+	}
+
+	return untapped, nil
+}
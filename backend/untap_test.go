@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScale_UntapKeg(t *testing.T) {
+	s := CreateScaleWithMeasurements(22, 12) // 15l keg tapped and partially consumed
+	s.DismissPendingKeg()
+	s.finishPour(PourProgress{Grams: 500, StartedAt: time.Now()})
+	id := s.KegInfo.Id
+	now := time.Now()
+
+	keg, err := s.UntapKeg(now)
+	assert.Nil(t, err)
+	assert.Equal(t, id, keg.Id)
+	assert.Equal(t, &UntappedKeg{At: now, Weight: 12000, RemainingLiters: 5}, keg.Untapped)
+	assert.Equal(t, 0, s.ActiveKeg, "waiting for the next keg")
+	assert.Equal(t, "", s.KegInfo.Id)
+
+	_, err = s.UntapKeg(now)
+	assert.ErrorIs(t, err, errNoActiveKeg)
+
+	untapped, err := s.UntappedKegs()
+	assert.Nil(t, err)
+	assert.Len(t, untapped, 1)
+
+	// put back on the scale, the weight is not a full keg
+	assert.Nil(t, s.AddMeasurement(12000, SourceHttp))
+	assert.Equal(t, 0, s.ActiveKeg)
+
+	keg, err = s.RetapKeg(id, now.Add(48*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, id, s.KegInfo.Id)
+	assert.Equal(t, 15, s.ActiveKeg)
+	assert.Equal(t, 1, s.KegInfo.Pours, "statistics are resumed")
+	assert.Equal(t, 1.0, s.KegInfo.Beers)
+	assert.Nil(t, s.KegInfo.Untapped)
+	assert.InDelta(t, 48.0, keg.PausedHours, 0.01)
+	assert.Equal(t, 10, s.BeersLeft)
+	assert.InDelta(t, 0, keg.OnTap(now.Add(48*time.Hour)).Hours(), 0.01, "untapped time is not on tap")
+
+	untapped, err = s.UntappedKegs()
+	assert.Nil(t, err)
+	assert.Empty(t, untapped)
+
+	_, err = s.RetapKeg(id, now)
+	assert.ErrorIs(t, err, errKegNotUntapped)
+	_, err = s.RetapKeg("unknown", now)
+	assert.ErrorIs(t, err, errUnknownKeg)
+}
+
+func TestCalcKegYield_Untapped(t *testing.T) {
+	tappedAt := time.Date(2024, 5, 3, 18, 0, 0, 0, time.UTC)
+	keg := NewKegInfo(30, "Pilsner", tappedAt, 40000)
+	keg.Untapped = &UntappedKeg{At: tappedAt.Add(6 * time.Hour), Weight: 30000}
+
+	yield := CalcKegYield(keg, 500, 20000, tappedAt.Add(72*time.Hour))
+	assert.Equal(t, 10000.0, yield.ConsumedGrams, "evaluated when it was untapped")
+	assert.Equal(t, 6.0, yield.DurationHours)
+
+	keg.Untapped = nil
+	keg.PausedHours = 60
+	yield = CalcKegYield(keg, 500, 20000, tappedAt.Add(72*time.Hour))
+	assert.Equal(t, 20000.0, yield.ConsumedGrams)
+	assert.Equal(t, 12.0, yield.DurationHours)
+}
+
+func TestRetapKegHandler(t *testing.T) {
+	s := CreateScaleWithMeasurements(22, 15)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+	router := mux.NewRouter()
+	router.HandleFunc("/api/pub/active_keg", hr.activeKegHandler())
+	router.HandleFunc("/api/kegs/{id}/retap", hr.retapKegHandler())
+	id := s.KegInfo.Id
+
+	request := func(method, target string) int {
+		r := httptest.NewRequest(method, target, nil)
+		r.Header.Set("Authorization", s.config.Password)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusConflict, request(http.MethodPost, "/api/kegs/"+id+"/retap"), "still tapped")
+	assert.Equal(t, http.StatusOK, request(http.MethodDelete, "/api/pub/active_keg"))
+	assert.Equal(t, http.StatusConflict, request(http.MethodDelete, "/api/pub/active_keg"), "nothing to untap")
+	assert.Equal(t, http.StatusNotFound, request(http.MethodPost, "/api/kegs/unknown/retap"))
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/api/kegs/"+id+"/retap"))
+	assert.Equal(t, id, s.KegInfo.Id)
+}
@@ -1,6 +1,12 @@
 package main
 
 import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 )
@@ -22,7 +28,7 @@ func formatDate(t time.Time) string {
 		return ""
 	}
 
-	return t.In(getTz()).Format("2006-01-02 15:04:05")
+	return t.In(getTz()).Format(display.dateFormat)
 }
 
 func formatTime(t time.Time) string {
@@ -33,11 +39,94 @@ func formatTime(t time.Time) string {
 	return t.In(getTz()).Format("15:04")
 }
 
+// getTz returns the configured time zone of displayed times and pub days
 func getTz() *time.Location {
-	tz, _ := time.LoadLocation("Europe/Prague")
-	return tz
+	return display.location
+}
+
+// pubDayStart returns the beginning of the pub day containing t
+// pub days start at the given local hour, so sessions crossing midnight belong to the evening they started
+func pubDayStart(t time.Time, hour int) time.Time {
+	t = t.In(getTz())
+	start := time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, getTz())
+	if t.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+
+	return start
+}
+
+// parseKeyValues parses key=value pairs separated by comma
+func parseKeyValues(raw string) (map[string]string, error) {
+	values := map[string]string{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return values, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid key=value pair: %s", pair)
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+
+	return values, nil
+}
+
+// formatKeyValues is the inverse of parseKeyValues, keys are sorted
+func formatKeyValues(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+values[key])
+	}
+	return strings.Join(pairs, ",")
 }
 
 func getOkJson() []byte {
 	return []byte(`{"is_ok":true}`)
 }
+
+// verifiedClientCert returns the client certificate verified by our CA, nil if the request has none
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// certificateOf returns true if the certificate is issued for the device by its common name or a DNS name
+// the default scale is named "default" like its secret in SCALE_SECRETS
+func certificateOf(cert *x509.Certificate, device string) bool {
+	if device == "" {
+		device = defaultDeviceSecret
+	}
+	return cert.Subject.CommonName == device || slices.Contains(cert.DNSNames, device)
+}
+
+// clientIp returns address of the client
+// X-Forwarded-For is used only when the reverse proxy is trusted. Proxies append to the header,
+// so only the last address was added by our proxy, the ones before it are sent by the client and can be spoofed.
+func clientIp(r *http.Request, trustForwarded bool) net.IP {
+	if trustForwarded {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			addresses := strings.Split(values[len(values)-1], ",")
+			return net.ParseIP(strings.TrimSpace(addresses[len(addresses)-1]))
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return net.ParseIP(host)
+}
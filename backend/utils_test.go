@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestStrip(t *testing.T) {
@@ -27,3 +28,15 @@ func TestGetOkJson(t *testing.T) {
 	got := getOkJson()
 	assert.Contains(t, string(got), "ok")
 }
+
+func TestPubDayStart(t *testing.T) {
+	evening := time.Date(2024, 5, 3, 22, 0, 0, 0, getTz())
+	night := time.Date(2024, 5, 4, 2, 0, 0, 0, getTz())
+	morning := time.Date(2024, 5, 4, 6, 0, 0, 0, getTz())
+
+	friday := time.Date(2024, 5, 3, 6, 0, 0, 0, getTz())
+	assert.Equal(t, friday, pubDayStart(evening, 6))
+	assert.Equal(t, friday, pubDayStart(night, 6), "session crossing midnight belongs to friday")
+	assert.Equal(t, morning, pubDayStart(morning, 6))
+	assert.Equal(t, time.Date(2024, 5, 4, 0, 0, 0, 0, getTz()), pubDayStart(night, 0), "calendar days")
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// write ahead log operations
+const (
+	walMeasurement = "measurement"
+	walWeight      = "weight"
+	walWeightAt    = "weight_at"
+)
+
+// WalEntry is a single buffered write
+type WalEntry struct {
+	Op          string       `json:"op"`
+	Measurement *Measurement `json:"measurement,omitempty"`
+	Weight      float64      `json:"weight,omitempty"`
+	At          time.Time    `json:"at,omitempty"`
+}
+
+// WalStore buffers measurement writes in a local file while the storage is unreachable
+// and drains them when it recovers, so no data is lost during Redis restarts
+// once something is buffered, new writes are buffered too to keep their order
+type WalStore struct {
+	Storage
+	mux     sync.Mutex
+	path    string
+	pending int
+	monitor *Monitor
+	logger  *logrus.Logger
+}
+
+func NewWalStore(inner Storage, path string, monitor *Monitor, logger *logrus.Logger) *WalStore {
+	s := &WalStore{
+		Storage: inner,
+		mux:     sync.Mutex{},
+		path:    path,
+		monitor: monitor,
+		logger:  logger,
+	}
+
+	// entries left from the previous run
+	entries, err := s.read()
+	if err != nil {
+		logger.Errorf("Could not read write ahead log: %v", err)
+	}
+	s.pending = len(entries)
+	s.monitor.walPending.WithLabelValues().Set(float64(s.pending))
+
+	return s
+}
+
+func (s *WalStore) AddMeasurement(m Measurement) error {
+	return s.write(WalEntry{Op: walMeasurement, Measurement: &m}, func() error {
+		return s.Storage.AddMeasurement(m)
+	})
+}
+
+func (s *WalStore) SetWeight(weight float64) error {
+	return s.write(WalEntry{Op: walWeight, Weight: weight}, func() error {
+		return s.Storage.SetWeight(weight)
+	})
+}
+
+func (s *WalStore) SetWeightAt(weightAt time.Time) error {
+	return s.write(WalEntry{Op: walWeightAt, At: weightAt}, func() error {
+		return s.Storage.SetWeightAt(weightAt)
+	})
+}
+
+// Pending returns number of buffered writes
+func (s *WalStore) Pending() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.pending
+}
+
+// Run drains buffered writes until ctx is done
+// it's supposed to run as a supervised worker
+func (s *WalStore) Run(ctx context.Context, heartbeat func()) {
+	tick := time.NewTicker(10 * time.Second)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Debug("Write ahead log stopped")
+			return
+		case <-tick.C:
+			heartbeat()
+			if err := s.Drain(); err != nil {
+				s.logger.Warnf("Could not drain write ahead log: %v", err)
+			}
+		}
+	}
+}
+
+// Drain applies buffered writes in order
+// writes which could not be applied stay in the log
+func (s *WalStore) Drain() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.pending == 0 {
+		return nil
+	}
+
+	entries, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	applied := 0
+	for _, entry := range entries {
+		if err = s.apply(entry); err != nil {
+			break
+		}
+		applied++
+	}
+
+	if applied > 0 {
+		if werr := s.rewrite(entries[applied:]); werr != nil {
+			return werr
+		}
+		s.logger.Infof("Drained %d writes from the write ahead log", applied)
+	}
+
+	return err
+}
+
+func (s *WalStore) write(entry WalEntry, direct func() error) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.pending == 0 {
+		err := direct()
+		if err == nil {
+			return nil
+		}
+		s.logger.Warnf("Storage write failed, buffering into write ahead log: %v", err)
+	}
+
+	return s.append(entry)
+}
+
+func (s *WalStore) apply(entry WalEntry) error {
+	switch entry.Op {
+	case walMeasurement:
+		return s.Storage.AddMeasurement(*entry.Measurement)
+	case walWeight:
+		return s.Storage.SetWeight(entry.Weight)
+	case walWeightAt:
+		return s.Storage.SetWeightAt(entry.At)
+	}
+
+	s.logger.Warnf("Skipping unknown write ahead log operation %q", entry.Op)
+	return nil
+}
+
+func (s *WalStore) append(entry WalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open write ahead log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not write to write ahead log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("could not sync write ahead log: %w", err)
+	}
+
+	s.pending++
+	s.monitor.walPending.WithLabelValues().Set(float64(s.pending))
+	return nil
+}
+
+func (s *WalStore) read() ([]WalEntry, error) {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries := []WalEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry WalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// torn write after a crash, the rest of the line is lost anyway
+			s.logger.Warnf("Skipping invalid write ahead log entry: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// rewrite replaces the log with the remaining entries
+func (s *WalStore) rewrite(entries []WalEntry) error {
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("could not rewrite write ahead log: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		_, _ = w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("could not rewrite write ahead log: %w", err)
+	}
+
+	s.pending = len(entries)
+	s.monitor.walPending.WithLabelValues().Set(float64(s.pending))
+	return nil
+}
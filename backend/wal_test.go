@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore simulates unreachable Redis
+type failingStore struct {
+	FakeStore
+	down bool
+}
+
+func (s *failingStore) AddMeasurement(m Measurement) error {
+	if s.down {
+		return fmt.Errorf("connection refused")
+	}
+	return s.FakeStore.AddMeasurement(m)
+}
+
+func (s *failingStore) Ping() error {
+	if s.down {
+		return fmt.Errorf("connection refused")
+	}
+	return nil
+}
+
+func TestWalStore(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+
+	inner := &failingStore{down: true}
+	path := filepath.Join(t.TempDir(), "wal.jsonl")
+	store := NewWalStore(inner, path, NewMonitor(), logger)
+
+	start := time.Now()
+	assert.Nil(t, store.AddMeasurement(Measurement{Weight: 20000, At: start}))
+	assert.Nil(t, store.AddMeasurement(Measurement{Weight: 19500, At: start.Add(time.Second)}))
+	assert.Equal(t, 2, store.Pending())
+
+	assert.NotNil(t, store.Drain(), "storage is still down")
+	assert.Equal(t, 2, store.Pending())
+
+	// entries survive restart
+	assert.Equal(t, 2, NewWalStore(inner, path, NewMonitor(), logger).Pending())
+
+	inner.down = false
+	assert.Nil(t, store.AddMeasurement(Measurement{Weight: 19000, At: start.Add(2 * time.Second)}))
+	assert.Equal(t, 3, store.Pending(), "order is kept while draining")
+
+	assert.Nil(t, store.Drain())
+	assert.Equal(t, 0, store.Pending())
+
+	measurements, _ := inner.GetMeasurements(start, start.Add(time.Minute))
+	assert.Len(t, measurements, 3)
+	assert.Equal(t, 19000.0, measurements[2].Weight)
+}
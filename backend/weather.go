@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// WeatherSample is a single outdoor temperature reading
+// pushed by a weather webhook (home weather station, Home Assistant, ...)
+type WeatherSample struct {
+	Temperature float64   `json:"temperature"` // °C
+	At          time.Time `json:"at"`
+}
+
+// WeatherDay is consumption of a single day together with its weather
+type WeatherDay struct {
+	DailySummary
+	AvgTemperature *float64 `json:"avg_temperature"` // nil when no weather data arrived that day
+	MaxTemperature *float64 `json:"max_temperature"`
+}
+
+// WeatherStats correlates daily consumption with temperature
+type WeatherStats struct {
+	Days        []WeatherDay `json:"days"`
+	Correlation *float64     `json:"correlation"` // Pearson coefficient of max temperature and liters, nil if not enough data
+}
+
+// GetWeatherStats returns consumption and weather of the last days (including today)
+// holidays are not used for the correlation, people drink differently on them regardless of weather
+func GetWeatherStats(store Storage, holidays *HolidayCalendar, days int, glass float64, dayStart int, now time.Time) (WeatherStats, error) {
+	today := pubDayStart(now, dayStart)
+
+	stats := WeatherStats{Days: []WeatherDay{}}
+	var temperatures, liters []float64
+	for i := days - 1; i >= 0; i-- {
+		from := today.AddDate(0, 0, -i)
+		to := from.AddDate(0, 0, 1)
+
+		measurements, err := store.GetMeasurements(from, to)
+		if err != nil {
+			return WeatherStats{}, fmt.Errorf("could not load measurements: %w", err)
+		}
+		samples, err := store.GetWeather(from, to)
+		if err != nil {
+			return WeatherStats{}, fmt.Errorf("could not load weather: %w", err)
+		}
+
+		day := WeatherDay{DailySummary: CalcDailySummary(from, measurements, glass)}
+		day.Holiday, _ = holidays.Holiday(from)
+		if len(samples) > 0 {
+			sum, max := 0.0, math.Inf(-1)
+			for _, s := range samples {
+				sum += s.Temperature
+				max = math.Max(max, s.Temperature)
+			}
+			avg := math.Round(sum/float64(len(samples))*10) / 10
+			day.AvgTemperature = &avg
+			day.MaxTemperature = &max
+
+			// closed days say nothing about the weather influence
+			if day.Sessions > 0 && day.Holiday == "" {
+				temperatures = append(temperatures, max)
+				liters = append(liters, day.Liters)
+			}
+		}
+
+		stats.Days = append(stats.Days, day)
+	}
+
+	if r, ok := pearson(temperatures, liters); ok {
+		stats.Correlation = &r
+	}
+
+	return stats, nil
+}
+
+// pearson returns the correlation coefficient of two series
+// at least 3 pairs with non-zero variance are required
+func pearson(x, y []float64) (float64, bool) {
+	n := float64(len(x))
+	if len(x) < 3 || len(x) != len(y) {
+		return 0, false
+	}
+
+	var sx, sy float64
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+	}
+	mx, my := sx/n, sy/n
+
+	var cov, vx, vy float64
+	for i := range x {
+		cov += (x[i] - mx) * (y[i] - my)
+		vx += (x[i] - mx) * (x[i] - mx)
+		vy += (y[i] - my) * (y[i] - my)
+	}
+	if vx == 0 || vy == 0 {
+		return 0, false
+	}
+
+	return math.Round(cov/math.Sqrt(vx*vy)*1000) / 1000, true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPearson(t *testing.T) {
+	r, ok := pearson([]float64{15, 20, 25, 30}, []float64{10, 15, 20, 25})
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, r)
+
+	r, ok = pearson([]float64{15, 20, 25}, []float64{30, 20, 10})
+	assert.True(t, ok)
+	assert.Equal(t, -1.0, r)
+
+	_, ok = pearson([]float64{15, 20}, []float64{10, 15})
+	assert.False(t, ok, "not enough data")
+
+	_, ok = pearson([]float64{20, 20, 20}, []float64{10, 15, 20})
+	assert.False(t, ok, "no variance")
+}
+
+func TestGetWeatherStats(t *testing.T) {
+	now := time.Date(2024, 7, 3, 23, 0, 0, 0, getTz())
+	store := &FakeStore{}
+
+	for i, temperature := range []float64{18, 25, 32} {
+		day := time.Date(2024, 7, 1+i, 18, 0, 0, 0, getTz())
+		_ = store.AddWeather(WeatherSample{Temperature: temperature, At: day})
+		_ = store.AddMeasurement(Measurement{Weight: 30000, At: day})
+		_ = store.AddMeasurement(Measurement{Weight: 30000 - float64(i+1)*5000, At: day.Add(time.Hour)})
+	}
+
+	stats, err := GetWeatherStats(store, NewHolidayCalendar(&Config{HolidayCalendar: "cz"}), 4, 500, 6, now)
+	assert.Nil(t, err)
+	assert.Len(t, stats.Days, 4)
+	assert.Nil(t, stats.Days[0].MaxTemperature)
+	assert.Equal(t, 32.0, *stats.Days[3].MaxTemperature)
+	assert.Equal(t, 15.0, stats.Days[3].Liters)
+	assert.NotNil(t, stats.Correlation)
+	assert.Greater(t, *stats.Correlation, 0.9)
+
+	// 5th and 6th of July are holidays, only a single day is left for the correlation
+	now = time.Date(2024, 7, 6, 23, 0, 0, 0, getTz())
+	for i, temperature := range []float64{20, 30, 35} {
+		day := time.Date(2024, 7, 4+i, 18, 0, 0, 0, getTz())
+		_ = store.AddWeather(WeatherSample{Temperature: temperature, At: day})
+		_ = store.AddMeasurement(Measurement{Weight: 30000, At: day})
+		_ = store.AddMeasurement(Measurement{Weight: 29000, At: day.Add(time.Hour)})
+	}
+
+	stats, err = GetWeatherStats(store, NewHolidayCalendar(&Config{HolidayCalendar: "cz"}), 3, 500, 6, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "", stats.Days[0].Holiday)
+	assert.NotEqual(t, "", stats.Days[1].Holiday)
+	assert.Nil(t, stats.Correlation)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Webhook deliveries are signed like scale messages: HMAC-SHA256 of "timestamp\nbody" by [Config.WebhookSecret],
+// the receiver should reject old timestamps, so a captured delivery can't be replayed
+const (
+	WebhookTimestampHeader = "X-Webhook-Timestamp" // unix seconds of sending the delivery
+	WebhookSignatureHeader = "X-Webhook-Signature" // hex encoded signature, see [SignScaleMessage]
+
+	webhookQueueSize  = 100
+	webhookMaxBackoff = time.Minute
+)
+
+// webhookBackoff is the delay before the first retry, it doubles with every next one
+var webhookBackoff = time.Second
+
+// WebhookEvent is the body posted to the webhooks
+type WebhookEvent struct {
+	Id     string `json:"id"`     // the same for all retries, receivers can drop duplicates
+	Device string `json:"device"` // empty for the default scale
+	Event
+}
+
+// webhookError is a failed delivery, permanent ones (rejected by the receiver) are not retried
+type webhookError struct {
+	status    int
+	permanent bool
+}
+
+func (e *webhookError) Error() string {
+	return fmt.Sprintf("webhook returned status %d", e.status)
+}
+
+// Webhooks post events of all scales to [Config.WebhookUrls], so other systems of the pub (POS, signage) can react
+// every url has its own queue, a slow or failing receiver does not delay the others
+// events are dropped when the queue is full, the scale is never blocked
+type Webhooks struct {
+	mux     sync.Mutex
+	config  *Config
+	scales  *ScaleRegistry
+	monitor *Monitor
+	logger  *logrus.Logger
+	client  *http.Client
+	queues  map[string]chan WebhookEvent
+	posted  map[string]time.Time // device => last posted measurement
+}
+
+func NewWebhooks(config *Config, scales *ScaleRegistry, monitor *Monitor, logger *logrus.Logger) *Webhooks {
+	queues := make(map[string]chan WebhookEvent, len(config.WebhookUrls))
+	for _, webhook := range config.WebhookUrls {
+		queues[webhook] = make(chan WebhookEvent, webhookQueueSize)
+	}
+
+	return &Webhooks{
+		mux:     sync.Mutex{},
+		config:  config,
+		scales:  scales,
+		monitor: monitor,
+		logger:  logger,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queues:  queues,
+		posted:  map[string]time.Time{},
+	}
+}
+
+// Enabled returns true if any webhook is configured
+func (wh *Webhooks) Enabled() bool {
+	return len(wh.config.WebhookUrls) > 0
+}
+
+// Run posts events of all scales until ctx is done
+// it's supposed to run as a supervised worker
+func (wh *Webhooks) Run(ctx context.Context, heartbeat func()) {
+	wg := sync.WaitGroup{}
+	for webhook, queue := range wh.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wh.deliver(ctx, webhook, queue)
+		}()
+	}
+
+	for _, device := range wh.scales.Devices() {
+		scale, _ := wh.scales.Get(device)
+		events := scale.events.Subscribe()
+		defer scale.events.Unsubscribe(events)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-events:
+					wh.Publish(device, event)
+				}
+			}
+		}()
+	}
+
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			wh.logger.Debug("Webhooks stopped")
+			return
+		case <-tick.C:
+			heartbeat()
+		}
+	}
+}
+
+// Publish enqueues the event for all webhooks if its type is configured
+// measurements are throttled per scale by [Config.WebhookThrottle]
+func (wh *Webhooks) Publish(device string, event Event) {
+	if !slices.Contains(wh.config.WebhookEvents, event.Type) {
+		return
+	}
+	if event.Type == StateChangeEventType {
+		change, ok := event.Data.(StateChangeEvent)
+		if !ok || change.Reason != "measurement" {
+			return
+		}
+
+		wh.mux.Lock()
+		throttled := event.At.Sub(wh.posted[device]) < wh.config.WebhookThrottle
+		if !throttled {
+			wh.posted[device] = event.At
+		}
+		wh.mux.Unlock()
+		if throttled {
+			return
+		}
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	delivery := WebhookEvent{Id: hex.EncodeToString(id), Device: device, Event: event}
+	for webhook, queue := range wh.queues {
+		select {
+		case queue <- delivery:
+		default:
+			wh.monitor.webhookEvents.WithLabelValues("dropped").Inc()
+			wh.logger.Warnf("Webhook %s is too slow, %s event dropped", webhookChannel(webhook), event.Type)
+		}
+	}
+}
+
+// deliver posts queued events to the webhook one by one, so the receiver gets them in order
+func (wh *Webhooks) deliver(ctx context.Context, webhook string, queue chan WebhookEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-queue:
+			err := wh.monitor.deliveries.Track(webhookChannel(webhook), func() error {
+				return wh.retry(ctx, webhook, event)
+			})
+			if err != nil {
+				wh.monitor.webhookEvents.WithLabelValues("failed").Inc()
+				wh.logger.Warnf("Could not post %s event to webhook %s: %v", event.Type, webhookChannel(webhook), err)
+			} else {
+				wh.monitor.webhookEvents.WithLabelValues("sent").Inc()
+			}
+		}
+	}
+}
+
+// retry sends the event with exponential backoff up to [Config.WebhookRetries] times
+func (wh *Webhooks) retry(ctx context.Context, webhook string, event WebhookEvent) error {
+	backoff := webhookBackoff
+	for attempt := 0; ; attempt++ {
+		err := wh.send(ctx, webhook, event, time.Now())
+		if err == nil {
+			return nil
+		}
+		var failed *webhookError
+		if errors.As(err, &failed) && failed.permanent {
+			return err
+		}
+		if attempt >= wh.config.WebhookRetries {
+			return fmt.Errorf("%w (%d attempts)", err, attempt+1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, webhookMaxBackoff)
+	}
+}
+
+// send posts the signed event, 4xx responses except 408 and 429 are permanent failures
+func (wh *Webhooks) send(ctx context.Context, webhook string, event WebhookEvent, at time.Time) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if wh.config.DryRun {
+		wh.logger.Infof("Dry run, not posting event to webhook %s: %s", webhookChannel(webhook), body)
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(at.Unix(), 10))
+	req.Header.Set(WebhookSignatureHeader, SignScaleMessage(wh.config.WebhookSecret, at, string(body)))
+
+	res, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		permanent := res.StatusCode >= 400 && res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests
+		return &webhookError{status: res.StatusCode, permanent: permanent}
+	}
+
+	return nil
+}
+
+// webhookChannel names the webhook in logs and delivery health without the path, it may contain a token
+func webhookChannel(webhook string) string {
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return "webhook"
+	}
+
+	return "webhook:" + u.Host
+}
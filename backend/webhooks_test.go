@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooks(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	mux := sync.Mutex{}
+	received := []WebhookEvent{}
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		unix, _ := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		if r.Header.Get(WebhookSignatureHeader) != SignScaleMessage("s3cret", time.Unix(unix, 0), string(body)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		mux.Lock()
+		defer mux.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event WebhookEvent
+		_ = json.Unmarshal(body, &event)
+		received = append(received, event)
+	}))
+	defer srv.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	config := NewConfig()
+	config.WebhookUrls = []string{srv.URL + "/hooks/scale"}
+	config.WebhookSecret = "s3cret"
+	s := CreateScaleWithMeasurements(22)
+	wh := NewWebhooks(config, NewScaleRegistry(s), s.monitor, logger)
+	assert.True(t, wh.Enabled())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		wh.Run(ctx, func() {})
+		close(done)
+	}()
+
+	now := time.Now()
+	wh.Publish("", Event{Type: StateChangeEventType, Version: 1, At: now, Data: StateChangeEvent{Reason: "measurement", Weight: 22000}})
+	wh.Publish("", Event{Type: StateChangeEventType, Version: 1, At: now.Add(time.Second), Data: StateChangeEvent{Reason: "measurement", Weight: 21500}})
+	wh.Publish("", Event{Type: StateChangeEventType, Version: 1, At: now.Add(time.Second), Data: StateChangeEvent{Reason: "ping", Weight: 21500}})
+	wh.Publish("", Event{Type: PourProgressEventType, Version: 1, At: now.Add(time.Second)})
+
+	// a low keg is published by the scale and delivered after the retries
+	time.Sleep(50 * time.Millisecond) // the subscription of Run
+	for _, weight := range []float64{21500, 15000, 9000, 8500} {
+		assert.Nil(t, s.AddMeasurement(weight, SourceHttp))
+	}
+
+	assert.Eventually(t, func() bool {
+		mux.Lock()
+		defer mux.Unlock()
+		for _, event := range received {
+			if event.Type == KegLowEventType {
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	mux.Lock()
+	defer mux.Unlock()
+	assert.Equal(t, StateChangeEventType, received[0].Type, "the first measurement after retries")
+	assert.Equal(t, map[string]any{"reason": "measurement", "weight": 22000.0}, received[0].Data)
+	assert.Len(t, received[0].Id, 16)
+	for _, event := range received[1:] {
+		assert.NotEqual(t, StateChangeEventType, event.Type, "measurements are throttled")
+		assert.NotEqual(t, PourProgressEventType, event.Type, "not configured")
+	}
+	assert.Equal(t, float64(len(received)), counterValue(t, s.monitor, "scale_webhook_events_total"), "sent")
+}
+
+func TestWebhooks_PermanentFailure(t *testing.T) {
+	defer func(backoff time.Duration) { webhookBackoff = backoff }(webhookBackoff)
+	webhookBackoff = time.Millisecond
+
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	config := NewConfig()
+	config.WebhookRetries = 3
+	wh := NewWebhooks(config, nil, NewMonitor(), logrus.New())
+	event := WebhookEvent{Id: "1", Event: Event{Type: PourEventType, At: time.Now()}}
+
+	assert.ErrorContains(t, wh.retry(context.Background(), srv.URL+"/gone", event), "status 410")
+	assert.Equal(t, 1, attempts, "rejected by the receiver")
+
+	attempts = 0
+	assert.ErrorContains(t, wh.retry(context.Background(), srv.URL, event), "status 502 (4 attempts)")
+	assert.Equal(t, 4, attempts)
+
+	assert.Equal(t, "webhook:pos.example.com", webhookChannel("https://pos.example.com/hook?token=abc"))
+}
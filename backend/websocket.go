@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minimal server side of RFC 6455, enough to push text messages to browsers
+// and to receive short unfragmented text messages (admin console commands)
+
+const (
+	wsGuid         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsOpText       = 0x1
+	wsOpClose      = 0x8
+	wsOpPing       = 0x9
+	wsOpPong       = 0xA
+	wsMaxFrame     = 4096 // client frames are control frames and short commands, bigger frames close the connection
+	wsWriteTimeout = 10 * time.Second
+)
+
+// WsConn is an upgraded WebSocket connection
+type WsConn struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	mux      sync.Mutex // guards writes
+	closed   chan struct{}
+	once     sync.Once
+	messages chan []byte // text messages from the client
+}
+
+// UpgradeWebSocket performs the opening handshake and hijacks the connection
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WsConn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("unsupported websocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing websocket key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("could not hijack connection: %w", err)
+	}
+
+	sum := sha1.Sum([]byte(key + wsGuid))
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("could not finish handshake: %w", err)
+	}
+
+	ws := &WsConn{conn: conn, reader: rw.Reader, closed: make(chan struct{}), messages: make(chan []byte, 16)}
+	go ws.readLoop()
+	return ws, nil
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Closed is closed once the client disconnects
+func (ws *WsConn) Closed() <-chan struct{} {
+	return ws.closed
+}
+
+// Messages receives text messages from the client
+// messages are dropped when nobody reads them (push-only connections)
+func (ws *WsConn) Messages() <-chan []byte {
+	return ws.messages
+}
+
+// WriteText sends a single text message
+func (ws *WsConn) WriteText(data []byte) error {
+	return ws.writeFrame(wsOpText, data)
+}
+
+// Ping sends a ping keeping proxies from dropping idle connection
+func (ws *WsConn) Ping() error {
+	return ws.writeFrame(wsOpPing, nil)
+}
+
+// Close closes the connection (close handshake is best effort)
+func (ws *WsConn) Close() {
+	ws.once.Do(func() {
+		_ = ws.writeFrame(wsOpClose, nil)
+		_ = ws.conn.Close()
+		close(ws.closed)
+	})
+}
+
+func (ws *WsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.mux.Lock()
+	defer ws.mux.Unlock()
+
+	// server frames are never masked
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	_ = ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := ws.conn.Write(append(header, payload...)); err != nil {
+		return fmt.Errorf("could not write websocket frame: %w", err)
+	}
+	return nil
+}
+
+func (ws *WsConn) readLoop() {
+	defer ws.Close()
+
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil || !fin {
+			return // fragmented messages are not supported
+		}
+
+		switch opcode {
+		case wsOpClose:
+			return
+		case wsOpText:
+			select {
+			case ws.messages <- payload:
+			default:
+			}
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, payload); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (ws *WsConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxFrame {
+		return false, 0, nil, fmt.Errorf("websocket frame too big: %d bytes", length)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readTextFrame reads a single unmasked frame sent by the server
+func readTextFrame(t *testing.T, r *bufio.Reader) []byte {
+	head := make([]byte, 2)
+	_, err := io.ReadFull(r, head)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x80|wsOpText), head[0])
+
+	length := int(head[1] & 0x7F)
+	if length == 126 {
+		ext := make([]byte, 2)
+		_, err = io.ReadFull(r, ext)
+		assert.Nil(t, err)
+		length = int(ext[0])<<8 | int(ext[1])
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	assert.Nil(t, err)
+	return payload
+}
+
+func TestDashboardSocket(t *testing.T) {
+	s := CreateScaleWithMeasurements(20)
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+	server := httptest.NewServer(hr.requestLogger(http.HandlerFunc(hr.dashboardSocketHandler())))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"))
+	assert.Nil(t, err)
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", res.Header.Get("Sec-WebSocket-Accept")) // RFC 6455 example
+
+	var dashboard Dashboard
+	assert.Nil(t, json.Unmarshal(readTextFrame(t, reader), &dashboard))
+	assert.Equal(t, 20000.0, dashboard.LastWeight)
+
+	assert.Nil(t, s.AddMeasurement(19500, SourceHttp))
+	assert.Nil(t, json.Unmarshal(readTextFrame(t, reader), &dashboard))
+	assert.Equal(t, 19500.0, dashboard.LastWeight)
+}
+
+func TestDashboardSocket_NotUpgrade(t *testing.T) {
+	s := CreateScaleWithMeasurements()
+	hr := &HandlerRepository{scale: s, config: s.config, logger: s.logger}
+
+	w := httptest.NewRecorder()
+	hr.dashboardSocketHandler()(w, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -34,7 +34,7 @@ void HttpConnection::push(String message, String value)
     connect();
 
     // format:
-    // messageType|messageId|rssi|value
+    // messageType|messageId|rssi|value|fw=version
     message.concat("|");
     message.concat(String(millis() / 1000));
     message.concat("|");
@@ -42,6 +42,8 @@ void HttpConnection::push(String message, String value)
     message.concat(String(rssi));
     message.concat("|");
     message.concat(String(value));
+    message.concat("|fw=");
+    message.concat(FIRMWARE_VERSION);
     
     backend->beginRequest();
     backend->setHttpResponseTimeout(5000);
@@ -5,6 +5,9 @@
 #include <ArduinoHttpClient.h>
 #include "secrets.h"
 
+// reported to the backend, it hints when a newer firmware is released
+#define FIRMWARE_VERSION "1.0.0"
+
 class HttpConnection
 {
 public:
@@ -1,10 +1,22 @@
 // REACT_APP_BACKEND_PREFIX is defined in .env file for development
 // and it is empty for production because the backend is on the same domain and port
+// REACT_APP_READ_TOKEN is the read-only API token, it's required when the backend has READ_AUTH enabled
 export function buildUrl(endpoint) {
     let url = endpoint
     if (process.env.REACT_APP_BACKEND_PREFIX !== undefined) {
         url = process.env.REACT_APP_BACKEND_PREFIX + endpoint
     }
 
+    if (process.env.REACT_APP_READ_TOKEN) {
+        url += (url.includes("?") ? "&" : "?") + "token=" + encodeURIComponent(process.env.REACT_APP_READ_TOKEN)
+    }
+
     return url
+}
+
+// buildWsUrl returns WebSocket url of the endpoint on the backend
+export function buildWsUrl(endpoint) {
+    const url = new URL(buildUrl(endpoint), window.location.href)
+    url.protocol = url.protocol === "https:" ? "wss:" : "ws:"
+    return url.toString()
 }
\ No newline at end of file
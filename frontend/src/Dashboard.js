@@ -4,7 +4,7 @@ import "./Dashboard.css";
 import Menu from "./Menu";
 import Warehouse from "./Warehouse";
 import Keg from "./Keg";
-import {buildUrl} from "./Api";
+import {buildUrl, buildWsUrl} from "./Api";
 import Pivo from "./Pivo";
 import Field from "./Field";
 
@@ -15,6 +15,7 @@ function Dashboard() {
         beers_left: 0,
         last_weight: 0.0,
         last_weight_formated: "0.0",
+        weight_unit: "kg",
         last_at: "0",
         last_at_duration: "0",
         rssi: 0,
@@ -48,7 +49,8 @@ function Dashboard() {
                 "keg": 50,
                 "amount": 0
             }
-        ]
+        ],
+        alerts: []
     }
 
     const [scale, setScale] = useState(defaultScale);
@@ -61,11 +63,32 @@ function Dashboard() {
         void refresh()
 
         window.addEventListener("focus", refresh)
+
+        // live updates are pushed over the WebSocket, polling is only a fallback when it is down
+        let socket = null
+        let closed = false
+        const connect = () => {
+            socket = new WebSocket(buildWsUrl("/ws"))
+            socket.onmessage = (message) => {
+                setScale(JSON.parse(message.data))
+            }
+            socket.onclose = () => {
+                if (!closed) {
+                    setTimeout(connect, 5000)
+                }
+            }
+        }
+        connect()
+
         const interval = setInterval(() => {
-            void refresh()
+            if (socket === null || socket.readyState !== WebSocket.OPEN) {
+                void refresh()
+            }
         }, 10000)
 
         return () => {
+            closed = true
+            socket.close()
             window.removeEventListener("focus", refresh)
             clearInterval(interval)
         }
@@ -133,7 +156,7 @@ function Dashboard() {
                     loading={showSpinner}
                     hidden={!scale.is_ok || scale.last_at <= 0}
                 >
-                    {scale.last_weight_formated}&nbsp;kg
+                    {scale.last_weight_formated}&nbsp;{scale.weight_unit}
                 </Field>
 
                 <Field
@@ -156,6 +179,16 @@ function Dashboard() {
                     {scale.is_ok ? "OK" : "OFFLINE"}
                 </Field>
 
+                <Field
+                    title={"Upozornění"}
+                    info={""}
+                    variant={"red"}
+                    loading={showSpinner}
+                    hidden={!scale.alerts || scale.alerts.length === 0}
+                >
+                    {(scale.alerts || []).map(alert => <div key={alert.fingerprint}>{alert.summary}</div>)}
+                </Field>
+
                 <Field
                     title={"WiFi"}
                     info={"před " + scale.last_update_duration}